@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"api-service/internal/config"
+	"api-service/internal/events"
+	"api-service/internal/rolemap"
+)
+
+// applyAppConfig applies the settings an App Configuration refresh changed that can change at
+// runtime, and logs the others, which only take effect after a restart. Settings overridden
+// by a flag, the environment or .env are left alone.
+func applyAppConfig(previous, current map[string]string, roleMapper *rolemap.Mapper, protocols *events.ProtocolSwitch) {
+	var changed []string
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+
+	var restart []string
+	for _, key := range changed {
+		if config.Overridden(key) {
+			continue
+		}
+		value := current[key]
+		switch key {
+		case "LOG_LEVEL":
+			level := slog.LevelInfo
+			if value != "" {
+				if err := level.UnmarshalText([]byte(value)); err != nil {
+					log.Printf("⚠️  Ignoring App Configuration LOG_LEVEL %q: %v", value, err)
+					continue
+				}
+			}
+			setLogLevel(level)
+			log.Printf("🔄 Log level set to %s", level)
+		case "ROLE_GROUP_MAPPINGS":
+			mappings, err := rolemap.Parse(value)
+			if err == nil {
+				err = roleMapper.Replace(context.Background(), mappings)
+			}
+			if err != nil {
+				log.Printf("⚠️  Ignoring App Configuration ROLE_GROUP_MAPPINGS: %v", err)
+			}
+		case "EVENT_PROTOCOL_DEFAULT":
+			if value == "" {
+				value = string(events.ProtocolV1)
+			}
+			version, err := events.ParseProtocolVersion(value)
+			if err == nil {
+				err = protocols.SetDefault(version)
+			}
+			if err != nil {
+				log.Printf("⚠️  Ignoring App Configuration EVENT_PROTOCOL_DEFAULT: %v", err)
+			}
+		default:
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		log.Printf("⚠️  App Configuration changed %s; restart to apply", strings.Join(restart, ", "))
+	}
+}
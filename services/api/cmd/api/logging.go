@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+var (
+	// logLevel is the minimum level of levelled logs, which App Configuration can change at runtime
+	logLevel = new(slog.LevelVar)
+	// jsonLogs is set when every log line is written as a JSON record (LOG_FORMAT=json)
+	jsonLogs bool
+)
+
+// setupLogging writes logs in the configured format: the standard log lines, or JSON records
+// (with log.Printf lines at the info level) for log collectors such as Log Analytics
+func setupLogging(format string, level slog.Level) {
+	if format == "json" {
+		jsonLogs = true
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+	}
+	setLogLevel(level)
+}
+
+// setLogLevel changes the minimum level of levelled logs
+func setLogLevel(level slog.Level) {
+	logLevel.Set(level)
+	if !jsonLogs {
+		slog.SetLogLoggerLevel(level)
+	}
+}
@@ -1,13 +1,69 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/quic-go/webtransport-go"
+	"google.golang.org/grpc"
+
+	"api-service/internal/announcements"
+	"api-service/internal/appconfig"
+	"api-service/internal/attachments"
+	"api-service/internal/audit"
+	"api-service/internal/backplane"
+	"api-service/internal/blob"
+	"api-service/internal/blocks"
+	"api-service/internal/certs"
+	"api-service/internal/chat"
+	"api-service/internal/clienterrors"
+	"api-service/internal/clientversion"
 	"api-service/internal/config"
+	"api-service/internal/contentsafety"
+	"api-service/internal/deadletter"
+	"api-service/internal/eventgrid"
+	"api-service/internal/eventhubs"
 	"api-service/internal/events"
+	"api-service/internal/features"
+	"api-service/internal/graph"
 	"api-service/internal/handlers"
+	"api-service/internal/health"
+	"api-service/internal/identity"
+	"api-service/internal/jobs"
+	"api-service/internal/locks"
+	"api-service/internal/longpoll"
 	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/notificationhubs"
+	"api-service/internal/onboarding"
+	"api-service/internal/openapi"
+	"api-service/internal/origins"
+	"api-service/internal/outbox"
+	"api-service/internal/redact"
+	"api-service/internal/retention"
+	"api-service/internal/rolemap"
+	"api-service/internal/rooms"
+	"api-service/internal/rpc"
+	"api-service/internal/sanctions"
+	"api-service/internal/search"
+	"api-service/internal/store"
+	"api-service/internal/teams"
+	"api-service/internal/tenants"
+	"api-service/internal/topics"
+	"api-service/internal/usage"
+	"api-service/internal/webhooks"
+	"api-service/internal/webpush"
 )
 
 const (
@@ -21,54 +77,1406 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	setupLogging(cfg.LogFormat, cfg.LogLevel)
 
 	log.Printf("✅ Configuration loaded")
 	log.Printf("   Tenant ID: %s", cfg.AzureTenantID)
 	log.Printf("   Client ID: %s", cfg.AzureClientID)
+	log.Printf("   Environment: %s", cfg.Environment)
+
+	// Cancelled on SIGTERM/SIGINT to shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// Background workers run until ctx is cancelled, and shutdown waits for them to finish
+	var workers sync.WaitGroup
+	background := func(run func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run()
+		}()
+	}
 
 	// Initialize event manager
 	eventManager := events.NewManager()
-	handlers.EventManager = eventManager
-	go eventManager.Run()
-	log.Printf("🎯 Event manager started")
+	defaultProtocol, err := events.ParseProtocolVersion(cfg.EventProtocolDefault)
+	if err != nil {
+		log.Fatalf("Invalid EVENT_PROTOCOL_DEFAULT: %v", err)
+	}
+	protocolSwitch, err := events.NewProtocolSwitch(defaultProtocol, cfg.EventProtocolV2Enabled)
+	if err != nil {
+		log.Fatalf("Invalid event protocol configuration: %v", err)
+	}
+	eventManager.SetProtocolSwitch(protocolSwitch)
+
+	// Redaction profiles for data leaving through outbound sinks and for audit record details
+	redactionProfiles, err := redact.ParseProfiles(cfg.RedactionProfiles)
+	if err != nil {
+		log.Fatalf("Invalid REDACTION_PROFILES: %v", err)
+	}
+	sinkAssignments, err := redact.ParseAssignments(cfg.SinkRedaction)
+	if err != nil {
+		log.Fatalf("Invalid SINK_REDACTION: %v", err)
+	}
+	redactionSinks, err := redact.NewSinks(redact.Config{
+		Profiles:       redactionProfiles,
+		Assignments:    sinkAssignments,
+		DefaultProfile: cfg.RedactionDefaultProfile,
+		HashKey:        cfg.RedactionHashKey,
+		Profanity:      cfg.RedactionProfanityWords,
+	})
+	if err != nil {
+		log.Fatalf("Invalid redaction configuration: %v", err)
+	}
+	log.Printf("🕶️  Redaction: export=%s, webhooks=%s, eventhubs=%s, eventgrid=%s, audit=%s", redactionSinks.ProfileName(redact.SinkExport),
+		redactionSinks.ProfileName(redact.SinkWebhooks), redactionSinks.ProfileName(redact.SinkEventHubs), redactionSinks.ProfileName(redact.SinkEventGrid),
+		redactionSinks.ProfileName(redact.SinkAudit))
+
+	// Audit log for security-relevant actions, chained in a local file and optionally copied
+	// to Blob Storage and Log Analytics
+	managedIdentity := identity.NewManagedIdentity(cfg.ManagedIdentityClientID)
+	auditLog, err := audit.NewLogger(audit.Config{File: cfg.AuditFile, InstanceID: cfg.InstanceID})
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	auditLog.SetRedactor(redactionSinks.For(redact.SinkAudit))
+	if cfg.AuditBlobURL != "" {
+		auditLog.AddSink(audit.NewBlobSink(cfg.AuditBlobURL, cfg.InstanceID))
+	}
+	if cfg.AuditLogsEndpoint != "" && cfg.AuditLogsRuleID != "" {
+		auditLog.AddSink(audit.NewLogAnalyticsSink(audit.LogAnalyticsConfig{
+			Endpoint: cfg.AuditLogsEndpoint,
+			RuleID:   cfg.AuditLogsRuleID,
+			Stream:   cfg.AuditLogsStream,
+		}, managedIdentity))
+	}
+	background(func() { auditLog.Run(ctx, cfg.AuditFlushInterval) })
+	auditFile := cfg.AuditFile
+	if auditFile == "" {
+		auditFile = "memory"
+	}
+	log.Printf("🧾 Audit log: %s (%d external sinks)", auditFile, len(auditLog.Sinks()))
+
+	// Per-connection inbound quotas; violations are audited
+	eventManager.SetInboundLimits(events.InboundLimits{
+		MaxFrameBytes:     cfg.WSMaxFrameBytes,
+		MessagesPerSecond: cfg.WSMessagesPerSecond,
+		Burst:             cfg.WSBurst,
+		MaxViolations:     cfg.WSMaxViolations,
+	})
+	eventManager.SetResumption(cfg.WSResumeEvents, cfg.WSResumeTTL)
+	eventManager.SetFanOutWorkers(cfg.WSFanOutWorkers)
+	eventManager.SetSendBuffer(cfg.WSSendBuffer)
+	handlers.SetWebSocketBuffers(cfg.WSReadBufferBytes, cfg.WSWriteBufferBytes)
+	handlers.SetWebSocketCompression(cfg.WSCompression, cfg.WSCompressionLevel)
+	eventManager.SetCompressionThreshold(cfg.WSCompressionMinBytes)
+	eventManager.SetSchemaCompat(cfg.EventSchemaCompat)
+	overflowPolicy, err := events.ParseOverflowPolicy(cfg.WSOverflowPolicy)
+	if err != nil {
+		log.Fatalf("Invalid WS_OVERFLOW_POLICY: %v", err)
+	}
+	overflowPolicies, err := events.ParseOverflowPolicies(cfg.WSOverflowPolicies)
+	if err != nil {
+		log.Fatalf("Invalid WS_OVERFLOW_POLICIES: %v", err)
+	}
+	eventManager.SetOverflowPolicies(events.OverflowPolicies{
+		Default:      overflowPolicy,
+		ByType:       overflowPolicies,
+		MaxOverflows: cfg.WSMaxOverflows,
+	})
+	tokenExpiry, err := events.ParseTokenExpiryPolicy(cfg.WSTokenExpiry)
+	if err != nil {
+		log.Fatalf("Invalid WS_TOKEN_EXPIRY: %v", err)
+	}
+	eventManager.SetTokenExpiry(tokenExpiry, cfg.WSReauthNotice)
+	eventManager.SetViolationHandler(func(v events.Violation) {
+		outcome := "denied"
+		if v.Closed {
+			outcome = "closed"
+		}
+		auditLog.Record(audit.Record{
+			Action:   "ws.quota_violation",
+			Actor:    v.ClientID,
+			TenantID: v.TenantID,
+			Target:   "/api/ws",
+			Outcome:  outcome,
+			Details:  map[string]interface{}{"kind": v.Kind, "count": v.Count, "remoteAddr": v.RemoteAddr},
+		})
+	})
+
+	// Locks shared by every replica, for singleton jobs and changes to persisted state
+	var jobLocker locks.Locker = locks.NewMemoryLocker(cfg.InstanceID)
+	if cfg.JobLockContainerURL != "" {
+		jobLocker = locks.NewBlobLocker(cfg.JobLockContainerURL, cfg.InstanceID)
+	}
+
+	// Deliveries that failed for good (webhooks, dropped offline notifications, broadcasts the
+	// backplane refused) are kept for admins to redrive
+	deadLetters := deadletter.NewQueue(deadletter.Config{ContainerURL: cfg.DeadLettersURL}, jobLocker)
+	if err := deadLetters.Load(ctx); err != nil {
+		log.Printf("⚠️  Failed to load dead letters: %v", err)
+	}
+	background(func() { deadLetters.Run(ctx, cfg.DeadLettersInterval) })
+	eventManager.SetDeadLetters(deadLetters)
+
+	// Relay broadcasts to clients connected to other replicas
+	var backplaneHealth func(ctx context.Context) error
+	switch cfg.Backplane {
+	case "redis":
+		redisBackplane, err := backplane.NewRedis(context.Background(), cfg.RedisURL, cfg.BackplaneChannel)
+		if err != nil {
+			log.Fatalf("Failed to connect the Redis backplane: %v", err)
+		}
+		eventManager.ConnectBackplane(ctx, redisBackplane, cfg.InstanceID)
+		backplaneHealth = redisBackplane.Ping
+		log.Printf("📡 Redis backplane connected (channel %s, instance %s)", cfg.BackplaneChannel, cfg.InstanceID)
+	case "servicebus":
+		serviceBusBackplane, err := backplane.NewServiceBus(context.Background(), cfg.ServiceBusNamespace, cfg.BackplaneChannel, cfg.InstanceID, managedIdentity)
+		if err != nil {
+			log.Fatalf("Failed to connect the Service Bus backplane: %v", err)
+		}
+		eventManager.ConnectBackplane(ctx, serviceBusBackplane, cfg.InstanceID)
+		backplaneHealth = serviceBusBackplane.Ping
+		log.Printf("📡 Service Bus backplane connected (topic %s, subscription %s)", cfg.BackplaneChannel, serviceBusBackplane.Subscription())
+	case "nats":
+		natsBackplane, err := backplane.NewNATS(cfg.NATSURL, cfg.BackplaneChannel, serviceName+"/"+cfg.InstanceID)
+		if err != nil {
+			log.Fatalf("Failed to connect the NATS backplane: %v", err)
+		}
+		eventManager.ConnectBackplane(ctx, natsBackplane, cfg.InstanceID)
+		backplaneHealth = natsBackplane.Ping
+		log.Printf("📡 NATS backplane connected (subject %s, instance %s)", cfg.BackplaneChannel, cfg.InstanceID)
+	}
+
+	background(func() { eventManager.Run(ctx) })
+	background(func() { eventManager.RunIdleDetection(ctx, cfg.PresenceIdleTimeout) })
+	log.Printf("🎯 Event manager started (presence idle after %s)", cfg.PresenceIdleTimeout)
+
+	// Initialize group → role mappings
+	roleMappings, err := rolemap.Parse(cfg.RoleGroupMappings)
+	if err != nil {
+		log.Fatalf("Invalid ROLE_GROUP_MAPPINGS: %v", err)
+	}
+	roleMapper, err := rolemap.NewMapper(cfg.RoleMappingsURL, roleMappings)
+	if err != nil {
+		log.Fatalf("Invalid ROLE_GROUP_MAPPINGS: %v", err)
+	}
+	if err := roleMapper.Load(ctx); err != nil {
+		log.Printf("⚠️  Failed to load group role mappings: %v", err)
+	}
+	background(func() { roleMapper.Run(ctx, cfg.RoleMappingsInterval) })
+
+	// Feature flags from FEATURE_FLAGS, over those from App Configuration
+	featureFlags := features.NewSet(cfg.FeatureFlags)
+
+	// Azure App Configuration, refreshed when its sentinel key changes
+	if cfg.AppConfig != nil {
+		featureFlags.SetRemote(cfg.AppConfig.Snapshot().Features)
+		cfg.AppConfig.OnChange(func(previous, current appconfig.Snapshot) {
+			applyAppConfig(previous.Settings, current.Settings, roleMapper, protocolSwitch)
+			featureFlags.SetRemote(current.Features)
+		})
+		background(func() { cfg.AppConfig.Run(ctx) })
+		log.Printf("🔄 App Configuration refresh enabled")
+	}
+	log.Printf("🚩 Feature flags: %v", featureFlags.Evaluate(nil))
+
+	// Per-topic ACLs, enforced when clients subscribe or publish; topics without a rule stay open
+	topicACL, err := topics.NewACL(cfg.TopicACLMode, auditLog)
+	if err != nil {
+		log.Fatalf("Invalid TOPIC_ACL_MODE: %v", err)
+	}
+	topicRules, err := topics.ParseRules(cfg.TopicACLs)
+	if err != nil {
+		log.Fatalf("Invalid TOPIC_ACLS: %v", err)
+	}
+	for _, rule := range topicRules {
+		if _, err := topicACL.Set(rule); err != nil {
+			log.Fatalf("Invalid TOPIC_ACLS: %v", err)
+		}
+	}
+	eventManager.SetTopicACL(topicACL)
+
+	// Persist messages, rooms and tenants in memory unless Cosmos DB or PostgreSQL is configured
+	var messageStore store.Store = store.NewMemory()
+	var messageStoreHealth func(ctx context.Context) error
+	switch cfg.MessageStore {
+	case "cosmos":
+		cosmosStore, err := store.NewCosmos(context.Background(), store.CosmosConfig{
+			Endpoint:       cfg.CosmosEndpoint,
+			Database:       cfg.CosmosDatabase,
+			Container:      cfg.CosmosContainer,
+			RoomsContainer: cfg.CosmosRoomsContainer,
+			ReadsContainer: cfg.CosmosReadsContainer,
+			Key:            cfg.CosmosKey,
+			Emulator:       cfg.CosmosEmulator,
+		}, managedIdentity)
+		if err != nil {
+			log.Fatalf("Failed to connect the Cosmos DB message store: %v", err)
+		}
+		messageStore = cosmosStore
+		messageStoreHealth = cosmosStore.Ping
+	case "postgres":
+		var postgresIdentity *identity.ManagedIdentity
+		if cfg.PostgresEntraAuth {
+			postgresIdentity = managedIdentity
+		}
+		postgresStore, err := store.NewPostgres(context.Background(), cfg.PostgresURL, postgresIdentity)
+		if err != nil {
+			log.Fatalf("Failed to connect the PostgreSQL message store: %v", err)
+		}
+		messageStore = postgresStore
+		messageStoreHealth = postgresStore.Ping
+	}
+	log.Printf("💾 Message store: %s", messageStore.Backend())
+	// Saved messages are also recorded in the store's outbox, for the relay to publish
+	var messageOutbox store.OutboxStore
+	if cfg.EventHubsOutbox {
+		var ok bool
+		if messageOutbox, ok = messageStore.(store.OutboxStore); !ok {
+			log.Fatalf("EVENTHUBS_OUTBOX requires an outbox, which the %s message store doesn't have", messageStore.Backend())
+		}
+		messageOutbox.EnableOutbox()
+	}
+
+	// Initialize tenant registry (tenants onboarded at runtime via the admin API), persisted to
+	// the message store and reloaded by every replica
+	tenantRegistry := tenants.NewRegistry(messageStore)
+	tenantRegistry.AddProvisioner(func(ctx context.Context, tenant *tenants.Tenant) error {
+		return messageStore.ProvisionTenant(ctx, tenant.ID, tenant.StoragePartition)
+	})
+	if err := tenantRegistry.Load(ctx); err != nil {
+		log.Printf("⚠️  Failed to load tenants: %v", err)
+	}
+	background(func() { tenantRegistry.Run(ctx, cfg.TenantsInterval) })
+
+	decommissioner := tenants.NewDecommissioner(tenantRegistry)
+	decommissioner.SetRedactor(redactionSinks.For(redact.SinkExport))
+	decommissioner.AddDataOwner(tenants.NewDataOwner("connections",
+		func(ctx context.Context, tenantID string) (int, error) {
+			return eventManager.DisconnectTenant(tenantID), nil
+		},
+		func(ctx context.Context, tenantID string) (int, error) {
+			return eventManager.CountTenantClients(tenantID), nil
+		},
+	))
+	// Every store holding tenant data must register its owner, or decommissions can't verify
+	decommissioner.Require("messages", "push-subscriptions", "devices")
+	if cfg.SearchEndpoint != "" {
+		decommissioner.Require("search")
+	}
+	if cfg.AttachmentsStorageURL != "" {
+		decommissioner.Require("attachments")
+	}
+	decommissioner.AddDataOwner(tenants.NewExportingDataOwner("messages",
+		func(ctx context.Context, tenantID string) (interface{}, error) {
+			return messageStore.ExportTenant(ctx, tenantID)
+		},
+		messageStore.PurgeTenant, messageStore.CountTenant,
+	))
+	decommissioner.AddDataOwner(tenants.NewExportingDataOwner("push-subscriptions",
+		func(ctx context.Context, tenantID string) (interface{}, error) {
+			return messageStore.TenantPushSubscriptions(ctx, tenantID)
+		},
+		messageStore.PurgeTenantPushSubscriptions,
+		func(ctx context.Context, tenantID string) (int, error) {
+			subs, err := messageStore.TenantPushSubscriptions(ctx, tenantID)
+			count := 0
+			for _, userSubs := range subs {
+				count += len(userSubs)
+			}
+			return count, err
+		},
+	))
+	decommissioner.AddDataOwner(tenants.NewExportingDataOwner("devices",
+		func(ctx context.Context, tenantID string) (interface{}, error) {
+			return messageStore.TenantDevices(ctx, tenantID)
+		},
+		messageStore.PurgeTenantDevices,
+		func(ctx context.Context, tenantID string) (int, error) {
+			devices, err := messageStore.TenantDevices(ctx, tenantID)
+			count := 0
+			for _, userDevices := range devices {
+				count += len(userDevices)
+			}
+			return count, err
+		},
+	))
+
+	// Send the onboarding sequence on each user's first-ever connection
+	onboardingSteps, err := onboarding.ParseSteps(cfg.OnboardingMessages)
+	if err != nil {
+		log.Fatalf("Invalid ONBOARDING_MESSAGES: %v", err)
+	}
+	onboardingService := onboarding.NewService(onboardingSteps, tenantRegistry, messageStore, eventManager)
+	eventManager.AddConnectHook(onboardingService.HandleConnect)
+
+	// Refuse frontends below the minimum app version and ask those below the recommended one to upgrade
+	clientVersions, err := clientversion.NewService(tenants.ClientVersionPolicy{
+		Minimum:           cfg.ClientMinVersion,
+		Recommended:       cfg.ClientRecommendedVersion,
+		UpgradeURL:        cfg.ClientUpgradeURL,
+		RejectUnversioned: cfg.ClientRejectUnversioned,
+	}, tenantRegistry, eventManager)
+	if err != nil {
+		log.Fatalf("Invalid client version policy: %v", err)
+	}
+	eventManager.AddConnectHook(clientVersions.HandleConnect)
+	storageUsage := usage.NewTracker(usage.Limits{UserBytes: cfg.StorageQuotaUserBytes, RoomBytes: cfg.StorageQuotaRoomBytes}, messageStore)
+	var searchIndex *search.Index // Nil when search is disabled
+	if cfg.SearchEndpoint != "" {
+		searchIndex, err = search.NewIndex(search.Config{
+			Endpoint: cfg.SearchEndpoint,
+			Index:    cfg.SearchIndex,
+			APIKey:   cfg.SearchAPIKey,
+		}, managedIdentity)
+		if err != nil {
+			log.Fatalf("Invalid search configuration: %v", err)
+		}
+		if err := searchIndex.EnsureIndex(ctx); err != nil {
+			log.Fatalf("Failed to create the search index: %v", err)
+		}
+		messageStore = search.NewIndexedStore(messageStore, searchIndex)
+		background(func() { searchIndex.Run(ctx) })
+		// Indexed messages are copies of stored ones, exported by the messages owner
+		decommissioner.AddDataOwner(tenants.NewDataOwner("search", searchIndex.PurgeTenant, searchIndex.CountTenant))
+		log.Printf("🔎 Indexing messages into search index %s", cfg.SearchIndex)
+	}
+	chatService := chat.NewService(eventManager, tenantRegistry, storageUsage, messageStore)
+	chatService.SetDeadLetters(deadLetters)
+	roomService := rooms.NewService(eventManager, tenantRegistry, storageUsage, messageStore)
+	blockService := blocks.NewService(eventManager, messageStore)
+	eventManager.AddConnectHook(blockService.HandleConnect)
+	var moderator *moderation.Moderator               // Nil when moderation is disabled
+	var moderationHandler *handlers.ModerationHandler // Nil when moderation is disabled
+	if len(cfg.ModerationFilters) > 0 {
+		var filters, reviewers []moderation.Filter
+		for _, name := range cfg.ModerationFilters {
+			switch name {
+			case "regex":
+				regexFilter, err := moderation.NewRegexFilter(moderation.RegexConfig{
+					Words:           cfg.ModerationWords,
+					ProfanityAction: moderation.Outcome(cfg.ModerationProfanity),
+					PIIAction:       moderation.Outcome(cfg.ModerationPII),
+				})
+				if err != nil {
+					log.Fatalf("Invalid moderation configuration: %v", err)
+				}
+				filters = append(filters, regexFilter)
+			case "contentsafety":
+				rejectThresholds, err := contentsafety.ParseThresholds(cfg.ContentSafetyReject)
+				if err != nil {
+					log.Fatalf("Invalid CONTENT_SAFETY_REJECT_THRESHOLDS: %v", err)
+				}
+				flagThresholds, err := contentsafety.ParseThresholds(cfg.ContentSafetyFlag)
+				if err != nil {
+					log.Fatalf("Invalid CONTENT_SAFETY_FLAG_THRESHOLDS: %v", err)
+				}
+				contentSafetyFilter, err := contentsafety.NewFilter(contentsafety.Config{
+					Endpoint: cfg.ContentSafetyEndpoint,
+					APIKey:   cfg.ContentSafetyAPIKey,
+					Reject:   rejectThresholds,
+					Flag:     flagThresholds,
+					Images:   cfg.ContentSafetyImages,
+				}, managedIdentity)
+				if err != nil {
+					log.Fatalf("Invalid content safety configuration: %v", err)
+				}
+				if cfg.ContentSafetyAsync {
+					reviewers = append(reviewers, contentSafetyFilter)
+				} else {
+					filters = append(filters, contentSafetyFilter)
+				}
+			}
+		}
+		moderator, err = moderation.NewModerator(filters, cfg.ModerationFailure, auditLog)
+		if err != nil {
+			log.Fatalf("Invalid MODERATION_FAILURE: %v", err)
+		}
+		for _, reviewer := range reviewers {
+			moderator.AddReviewer(reviewer)
+		}
+
+		// Messages flagged for quarantine wait for an admin to approve or remove them
+		quarantine := moderation.NewQuarantine(cfg.QuarantineSize, func(ctx context.Context, reviewer *models.User, flag moderation.Flag) error {
+			_, err := chatService.Remove(ctx, reviewer, flag.MessageID)
+			if errors.Is(err, chat.ErrMessageDeleted) || errors.Is(err, chat.ErrMessageNotFound) {
+				return nil // Already gone
+			}
+			return err
+		}, auditLog)
+		moderator.AddFlagHandler(quarantine.Hold)
+		moderationHandler = handlers.NewModerationHandler(quarantine)
+
+		chatService.SetModerator(moderator)
+		roomService.SetModerator(moderator)
+		background(func() { moderator.Run(ctx) })
+		log.Printf("🛡️  Moderating messages with %s", strings.Join(moderator.Filters(), ", "))
+	}
+	if cfg.MessageAcks {
+		ackTracker := chat.NewAckTracker(eventManager, cfg.MessageAckTimeout, cfg.MessageDeliveryAttempts)
+		eventManager.HandleFrame("ack", ackTracker.HandleFrame)
+		chatService.SetAckTracker(ackTracker)
+		background(func() { ackTracker.Run(ctx) })
+		log.Printf("📬 Message acks enabled (timeout %s, %d attempts)", cfg.MessageAckTimeout, cfg.MessageDeliveryAttempts)
+	}
+
+	// Singleton background jobs (retention, digests, ...) run on whichever replica holds the job's lock
+	jobRunner := jobs.NewRunner(jobLocker, cfg.JobLockTTL)
+
+	// Messages older than their tenant's or room's retention policy are deleted or archived
+	retentionPolicies, err := retention.NewPolicies(retention.Policy{
+		Days:   cfg.RetentionDays,
+		Action: retention.Action(cfg.RetentionAction),
+	}, cfg.RetentionArchiveURL != "")
+	if err != nil {
+		log.Fatalf("Invalid retention configuration: %v", err)
+	}
+	roomService.SetRetention(retentionPolicies)
+	reaper := retention.NewReaper(retentionPolicies, messageStore, chatService.Purge, cfg.RetentionArchiveURL)
+	jobRunner.Register(jobs.Job{Name: retention.JobName, Interval: cfg.RetentionInterval, Run: reaper.Run})
+	if cfg.RetentionDays > 0 {
+		log.Printf("🗑️  Messages kept %d days by default, then %sd (checked every %s)", cfg.RetentionDays, cfg.RetentionAction, cfg.RetentionInterval)
+	}
+
+	// Admin announcements, delivered to connected clients and to those connecting while active
+	announcementService := announcements.NewService(eventManager, messageStore, jobLocker, cfg.AnnouncementsURL, auditLog)
+	if err := announcementService.Load(ctx); err != nil {
+		log.Printf("⚠️  Failed to load announcements: %v", err)
+	}
+	eventManager.AddConnectHook(announcementService.HandleConnect)
+	background(func() { announcementService.Run(ctx, cfg.AnnouncementsInterval) })
 
 	// Initialize middleware
-	corsMiddleware := middleware.NewCORSMiddleware(middleware.DefaultCORSConfig())
+	corsConfig := middleware.DefaultCORSConfig()
+	if len(cfg.AllowedOrigins) > 0 || cfg.CORSPolicy == "strict" {
+		corsConfig = middleware.ProductionCORSConfig(cfg.AllowedOrigins)
+	}
+	corsConfig.AllowCredentials = cfg.CORSAllowCredentials
+	corsConfig.AllowedHeaders = append(corsConfig.AllowedHeaders, cfg.CORSAllowedHeaders...)
+	corsConfig.ExposedHeaders = append(corsConfig.ExposedHeaders, cfg.CORSExposedHeaders...)
+	corsConfig.MaxAge = cfg.CORSMaxAge
+	corsConfig.AllowOriginFunc = tenantRegistry.IsOriginAllowed
+	log.Printf("🌐 CORS: %s policy, allowed origins %v, credentials %t", cfg.CORSPolicy, cfg.AllowedOrigins, corsConfig.AllowCredentials)
+	handlers.SetWebSocketOrigins(cfg.WSAllowAnyOrigin, func(origin string) bool {
+		return origins.Match(origin, cfg.AllowedOrigins) || tenantRegistry.IsOriginAllowed(origin)
+	})
+	corsMiddleware := middleware.NewCORSMiddleware(corsConfig)
 	authMiddleware := middleware.NewAuthMiddleware(cfg)
+	authMiddleware.SetTenantResolver(tenantRegistry)
+	authMiddleware.SetRoleMapper(roleMapper)
+	authMiddleware.SetAuditLog(auditLog)
+	sanctionService := sanctions.NewService(eventManager, auditLog)
+	authMiddleware.SetBanChecker(sanctionService)
+	if cfg.JWKSFallbackKeys != "" {
+		if err := authMiddleware.SetFallbackKeys(cfg.JWKSFallbackKeys, cfg.JWKSFallbackAfter); err != nil {
+			log.Fatalf("Invalid JWKS_FALLBACK_KEYS: %v", err)
+		}
+	}
+	requireAdmin := middleware.RequireRoles(auditLog, models.RoleAdmin)
+	requireCompliance := middleware.RequireRoles(auditLog, models.RoleCompliance)
+	requireIngest := middleware.RequireRoles(auditLog, models.RoleEventsIngest)
+	tenantGuard := middleware.NewTenantGuardMiddleware(tenantRegistry)
+	timeoutMiddleware := middleware.NewTimeoutMiddleware(cfg.HandlerTimeout)
+	bodyLimitMiddleware := middleware.NewBodyLimitMiddleware(cfg.MaxBodyBytes)
+
+	// Register health checks (subsystems add their own as they are initialized)
+	healthChecks := health.NewRegistry()
+	healthChecks.Register(health.NewChecker("jwks", func(ctx context.Context) error {
+		return authMiddleware.JWKSReady()
+	}))
+	if backplaneHealth != nil {
+		healthChecks.Register(health.NewChecker("backplane", backplaneHealth))
+	}
+	if messageStoreHealth != nil {
+		healthChecks.Register(health.NewChecker("message_store", messageStoreHealth))
+	}
+	healthChecks.Register(health.NewChecker("event_manager", func(ctx context.Context) error {
+		if !eventManager.Running() {
+			return fmt.Errorf("event manager is not running")
+		}
+		return nil
+	}))
 
 	// Initialize handlers
-	healthHandler := handlers.NewHealthHandler(serviceName, version)
+	healthHandler := handlers.NewHealthHandler(serviceName, version, healthChecks)
+	probeHandler := handlers.NewProbeHandler(healthChecks)
 	userHandler := handlers.NewUserHandler()
+	chatHandler := handlers.NewChatHandler(eventManager, chatService, clientVersions)
+	tenantHandler := handlers.NewTenantHandler(tenantRegistry, decommissioner)
+	roleMappingHandler := handlers.NewRoleMappingHandler(roleMapper)
+	protocolHandler := handlers.NewProtocolHandler(protocolSwitch)
+	featureHandler := handlers.NewFeatureHandler(featureFlags)
+	topicACLHandler := handlers.NewTopicACLHandler(topicACL, auditLog)
+	topicHandler := handlers.NewTopicHandler(eventManager, topicACL)
+	clientVersionHandler := handlers.NewClientVersionHandler(clientVersions, tenantRegistry)
+	graphSchema, err := graph.NewSchema(eventManager)
+	if err != nil {
+		log.Fatalf("Invalid GraphQL schema: %v", err)
+	}
+	graphQLHandler := handlers.NewGraphQLHandler(graphSchema)
+	pushNotifications, err := webpush.NewService(cfg.PushContent, webpush.NewInbox(cfg.PushNotificationTTL), tenantRegistry)
+	if err != nil {
+		log.Fatalf("Invalid push notification configuration: %v", err)
+	}
+	// Web Push notifications of messages sent to offline users, to the browsers they subscribed
+	var pushHandler *handlers.PushHandler // Nil when not configured
+	var pusher *webpush.Pusher
+	if cfg.PushVAPIDPrivateKey != "" {
+		vapid, err := webpush.NewVAPID(cfg.PushVAPIDPrivateKey, cfg.PushVAPIDSubject)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_VAPID_PRIVATE_KEY: %v", err)
+		}
+		pusher = webpush.NewPusher(pushNotifications, vapid, messageStore, messageStore, webpush.PusherConfig{
+			AllowedHosts: cfg.PushAllowedHosts,
+			TTL:          cfg.PushNotificationTTL,
+		})
+		pushHandler = handlers.NewPushHandler(pusher)
+		chatService.AddOfflineNotifier("webPush", pusher)
+		background(func() { pusher.Run(ctx) })
+		log.Printf("🔔 Web Push notifications enabled")
+	}
+	// Mobile push notifications of messages sent to offline users, to the devices they registered
+	var deviceHandler *handlers.DeviceHandler // Nil when not configured
+	var devicePush *notificationhubs.Dispatcher
+	if cfg.NotificationHubs != "" {
+		hub, err := notificationhubs.NewHub(cfg.NotificationHubs, cfg.NotificationHub)
+		if err != nil {
+			log.Fatalf("Invalid NOTIFICATION_HUBS_CONNECTION: %v", err)
+		}
+		devicePush = notificationhubs.NewDispatcher(hub, pushNotifications, messageStore, messageStore)
+		deviceHandler = handlers.NewDeviceHandler(devicePush)
+		chatService.AddOfflineNotifier("mobilePush", devicePush)
+		background(func() { devicePush.Run(ctx) })
+		log.Printf("📱 Mobile push notifications enabled (hub %s)", cfg.NotificationHub)
+	}
+	// Teams cards about messages sent to offline users who opted in
+	var teamsNotifier *teams.Notifier // Nil when not configured
+	if cfg.TeamsNotifications != "" {
+		teamsNotifier, err = teams.NewNotifier(teams.Config{
+			Mode:       cfg.TeamsNotifications,
+			WebhookURL: cfg.TeamsWebhookURL,
+			Timeout:    cfg.TeamsTimeout,
+		}, messageStore, managedIdentity, pushNotifications)
+		if err != nil {
+			log.Fatalf("Invalid Teams notification configuration: %v", err)
+		}
+		chatService.AddOfflineNotifier("teams", teamsNotifier)
+		background(func() { teamsNotifier.Run(ctx) })
+		log.Printf("💬 Teams notifications enabled (%s mode)", teamsNotifier.Mode())
+	}
+	notificationHandler := handlers.NewNotificationHandler(pushNotifications.Inbox(), messageStore, teamsNotifier)
+	usageHandler := handlers.NewUsageHandler(storageUsage)
+	presenceHandler := handlers.NewPresenceHandler(eventManager)
+	roomHandler := handlers.NewRoomHandler(roomService)
+	handlers.NewFrameHandler(eventManager, chatService, roomService, featureFlags).Register(eventManager)
+	eventManager.HandleFrame("refresh_auth", handlers.NewAuthRefreshHandler(authMiddleware, eventManager).HandleFrame)
+	eventSinceHandler := handlers.NewEventSinceHandler(eventManager)
+	eventSchemaHandler := handlers.NewEventSchemaHandler(eventManager)
+	streamTickets := middleware.NewTicketStore(cfg.WSTicketTTL)
+	ticketHandler := handlers.NewTicketHandler(streamTickets)
+	idempotent := middleware.Idempotency(middleware.NewIdempotencyCache(cfg.IdempotencyKeyTTL))
+	eventPollHandler := handlers.NewEventPollHandler(longpoll.NewPoller(chatService, cfg.LongPollIdleTimeout))
+	eventStreamHandler := handlers.NewEventStreamHandler(chatService, events.NewReplayBuffer(cfg.SSEReplayEvents, cfg.SSEReplayTTL))
+	webTransportHandler := handlers.NewWebTransportHandler(eventManager)
+	clientErrorAggregator := clienterrors.NewAggregator(cfg.ClientErrorSampleRate)
+	clientErrorHandler := handlers.NewClientErrorHandler(clientErrorAggregator)
+	statsHandler := handlers.NewStatsHandler(eventManager, clientErrorAggregator, authMiddleware)
+	if cfg.EventHubsNamespace != "" {
+		eventTypes := make([]events.EventType, len(cfg.EventHubsEventTypes))
+		for i, eventType := range cfg.EventHubsEventTypes {
+			eventTypes[i] = events.EventType(eventType)
+		}
+		eventHubsPublisher := eventhubs.NewPublisher(eventhubs.Config{
+			Namespace:     cfg.EventHubsNamespace,
+			Hub:           cfg.EventHubsName,
+			Types:         eventTypes,
+			InstanceID:    cfg.InstanceID,
+			BatchSize:     cfg.EventHubsBatchSize,
+			FlushInterval: cfg.EventHubsFlushInterval,
+			BufferSize:    cfg.EventHubsBufferSize,
+			Outbox:        messageOutbox != nil,
+		}, managedIdentity, redactionSinks.For(redact.SinkEventHubs))
+		eventManager.AddEventObserver(eventHubsPublisher.Observe)
+		background(func() { eventHubsPublisher.Run(ctx) })
+		statsHandler.SetEventHubs(eventHubsPublisher)
+		log.Printf("📊 Mirroring %s events to Event Hub %s", strings.Join(cfg.EventHubsEventTypes, ", "), cfg.EventHubsName)
+		if messageOutbox != nil {
+			outboxRelay := outbox.NewRelay(messageOutbox, eventHubsPublisher)
+			jobRunner.Register(jobs.Job{Name: outbox.JobName, Interval: cfg.EventHubsOutboxEvery, Run: outboxRelay.Run})
+			statsHandler.SetOutbox(outboxRelay)
+			log.Printf("📤 Chat messages are published from the outbox once persisted (every %s)", cfg.EventHubsOutboxEvery)
+		}
+	}
+
+	jobRunner.Start(ctx)
+	background(jobRunner.Wait)
+	log.Printf("🔐 Job locks: %s (instance %s)", jobLocker.Backend(), cfg.InstanceID)
+	// Admin actions are audited, and published to Event Grid when configured
+	adminObservers := []func(middleware.Activity){func(a middleware.Activity) {
+		rec := audit.Record{
+			Action:  "admin.request",
+			Target:  "/api" + a.Path,
+			Outcome: "succeeded",
+			Details: map[string]interface{}{"method": a.Method, "route": a.Route, "status": a.Status, "params": a.Params},
+		}
+		if a.User != nil {
+			rec.Actor, rec.TenantID = a.User.ID, a.User.TenantID
+		}
+		auditLog.Record(rec)
+	}}
+	if cfg.EventGridTopicEndpoint != "" {
+		eventTypes := cfg.EventGridEventTypes
+		if len(eventTypes) == 0 {
+			eventTypes = eventgrid.Types
+		}
+		eventGridPublisher, err := eventgrid.NewPublisher(eventgrid.Config{
+			Endpoint: cfg.EventGridTopicEndpoint,
+			Source:   cfg.EventGridSource,
+			Types:    eventTypes,
+		}, managedIdentity, redactionSinks.For(redact.SinkEventGrid))
+		if err != nil {
+			log.Fatalf("Invalid EVENTGRID_EVENT_TYPES: %v", err)
+		}
+		eventManager.AddEventObserver(eventGridPublisher.ObserveEvent)
+		adminObservers = append(adminObservers, eventGridPublisher.ObserveActivity)
+		background(func() { eventGridPublisher.Run(ctx) })
+		statsHandler.SetEventGrid(eventGridPublisher)
+		log.Printf("📣 Publishing %s events to Event Grid", strings.Join(eventTypes, ", "))
+	}
+	// Events from Event Grid subscriptions, delivered to the subscribers of the topics they're routed to
+	var eventGridHandler *handlers.EventGridHandler // Nil when not configured
+	if cfg.EventGridInboundKey != "" {
+		routes, err := eventgrid.ParseRoutes(cfg.EventGridInboundRoutes)
+		if err != nil {
+			log.Fatalf("Invalid EVENTGRID_INBOUND_ROUTES: %v", err)
+		}
+		receiver := eventgrid.NewReceiver(routes, eventManager)
+		eventGridHandler = handlers.NewEventGridHandler(receiver, cfg.EventGridInboundKey)
+		statsHandler.SetEventGridReceiver(receiver)
+		log.Printf("📥 Receiving Event Grid events (%d routes)", len(routes))
+	}
+	// Outgoing webhooks registered by admins, delivered the events this replica observes
+	webhookService := webhooks.NewService(webhooks.Config{
+		ContainerURL: cfg.WebhooksURL,
+		MaxAttempts:  cfg.WebhooksMaxAttempts,
+		Timeout:      cfg.WebhooksTimeout,
+		AllowHTTP:    cfg.Environment == config.EnvDev,
+		HomeTenantID: cfg.AzureTenantID,
+	}, jobLocker, redactionSinks.For(redact.SinkWebhooks), auditLog, deadLetters)
+	if err := webhookService.Load(ctx); err != nil {
+		log.Printf("⚠️  Failed to load webhooks: %v", err)
+	}
+	eventManager.AddEventObserver(webhookService.Observe)
+	background(func() { webhookService.Run(ctx, cfg.WebhooksInterval) })
+	statsHandler.SetWebhooks(webhookService)
+	if teamsNotifier != nil {
+		statsHandler.SetTeams(teamsNotifier)
+	}
+	if pusher != nil {
+		statsHandler.SetPush(pusher)
+	}
+	if devicePush != nil {
+		statsHandler.SetDevicePush(devicePush)
+	}
+	adminActivity := middleware.NewActivityMiddleware(func(a middleware.Activity) {
+		for _, observe := range adminObservers {
+			observe(a)
+		}
+	})
+	var attachmentHandler *handlers.AttachmentHandler // Nil when attachments are disabled
+	if cfg.AttachmentsStorageURL != "" {
+		signer, err := blob.NewSigner(cfg.AttachmentsStorageURL, cfg.AttachmentsStorageKey, managedIdentity)
+		if err != nil {
+			log.Fatalf("Invalid attachments configuration: %v", err)
+		}
+		attachmentService := attachments.NewService(signer, chatService, attachments.Config{
+			Container:          cfg.AttachmentsContainer,
+			MaxBytes:           cfg.AttachmentsMaxBytes,
+			ContentTypes:       cfg.AttachmentsContentTypes,
+			UploadTTL:          cfg.AttachmentsUploadTTL,
+			DownloadTTL:        cfg.AttachmentsDownloadTTL,
+			ThumbnailSizes:     cfg.ThumbnailSizes,
+			ThumbnailContainer: cfg.ThumbnailContainer,
+			ThumbnailWorkers:   cfg.ThumbnailWorkers,
+		})
+		if moderator != nil {
+			attachmentService.SetModerator(moderator)
+		}
+		attachmentHandler = handlers.NewAttachmentHandler(attachmentService)
+		decommissioner.AddDataOwner(tenants.NewExportingDataOwner("attachments",
+			func(ctx context.Context, tenantID string) (interface{}, error) {
+				return attachmentService.ExportTenant(ctx, tenantID)
+			},
+			attachmentService.PurgeTenant, attachmentService.CountTenant,
+		))
+		log.Printf("📎 Attachments enabled (container %s, max %d bytes, %s)", cfg.AttachmentsContainer, cfg.AttachmentsMaxBytes, strings.Join(cfg.AttachmentsContentTypes, ", "))
+		if len(cfg.ThumbnailSizes) > 0 {
+			background(func() { attachmentService.Run(ctx) })
+			log.Printf("🖼️  Making %v pixel thumbnails of image attachments in container %s (%d workers)", cfg.ThumbnailSizes, cfg.ThumbnailContainer, cfg.ThumbnailWorkers)
+		}
+	}
+	var searchHandler *handlers.SearchHandler // Nil when search is disabled
+	if searchIndex != nil {
+		searchHandler = handlers.NewSearchHandler(search.NewService(searchIndex, messageStore))
+		statsHandler.SetSearch(searchIndex)
+	}
+	exportHandler := handlers.NewExportHandler(chatService, auditLog)
+	jobsHandler := handlers.NewJobsHandler(jobRunner, cfg.InstanceID)
+	configHandler := handlers.NewConfigHandler(cfg, cfg.InstanceID)
+	retentionHandler := handlers.NewRetentionHandler(retentionPolicies, messageStore, auditLog)
+	sanctionHandler := handlers.NewSanctionHandler(sanctionService)
+	auditHandler := handlers.NewAuditHandler(auditLog)
+	blockHandler := handlers.NewBlockHandler(blockService)
+	announcementHandler := handlers.NewAnnouncementHandler(announcementService, messageStore)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	deadLetterHandler := handlers.NewDeadLetterHandler(deadLetters)
+	statsHandler.SetDeadLetters(deadLetters)
+	ingestHandler := handlers.NewIngestHandler(eventManager)
+	clientErrorBodyLimit := middleware.NewBodyLimitMiddleware(16 << 10) // Reports are small; 16KB max
+
+	// API routes are served under /api/v1, with the original /api paths kept as aliases,
+	// and documented in the generated OpenAPI spec
+	apiSpec := openapi.NewSpec(openapi.Info{Title: serviceName, Version: version})
+	apiSpec.Define(models.MessageContent{}, &openapi.Schema{
+		Type:        "object",
+		Description: "Versioned message body; fields unknown to this server are preserved and relayed",
+		Properties: map[string]*openapi.Schema{
+			"schemaVersion": {Type: "integer", Format: "int32"},
+			"text":          {Type: "string"},
+		},
+		AdditionalProperties: &openapi.Schema{},
+	})
+	openAPIHandler := handlers.NewOpenAPIHandler(apiSpec, "/api/v1/openapi.json")
+	admin := []string{models.RoleAdmin}
+	// Endpoints of features being rolled out answer 404 to users their flag is off for
+	roomsFeature := requireFeature(featureFlags, features.Rooms)
+	reactionsFeature := requireFeature(featureFlags, features.Reactions)
+	router := newRouter(cfg, apiSpec, func(api apiRouter) {
+		// Runs before routing so CORS preflights are answered for every route
+		api.Use(corsMiddleware.Middleware)
+
+		// Public endpoints
+		api.Group(func(api apiRouter) {
+			api.Use(func(next http.Handler) http.Handler { return timeoutMiddleware.WithTimeout(2*time.Second, next) })
+			api.Endpoint(http.MethodGet, "/health", healthHandler.ServeHTTP,
+				openapi.Operation{Summary: "Service health with per-dependency checks", Tags: []string{"health"}, Public: true, Response: models.HealthResponse{}})
+		})
+		api.Endpoint(http.MethodGet, "/openapi.json", openAPIHandler.ServeHTTP,
+			openapi.Operation{Summary: "This OpenAPI document", Tags: []string{"docs"}, Public: true})
+		if cfg.SwaggerUIEnabled {
+			api.Get("/docs", openAPIHandler.SwaggerUI)
+		}
+
+		// Streaming endpoints - Browser WebSocket and EventSource APIs cannot send custom Authorization
+		// headers, so these also accept a one-time ?ticket= (POST /api/ws/ticket), a bearer token in
+		// the WebSocket subprotocols and, while WS_QUERY_TOKEN allows it, the deprecated ?token=.
+		// These routes are exempt from handler timeouts as the connections are long-lived.
+		api.Group(func(api apiRouter) {
+			api.Use(authMiddleware.StreamMiddleware(middleware.StreamCredentials{Tickets: streamTickets, QueryToken: cfg.WSQueryToken}))
+			api.Endpoint(http.MethodGet, "/ws", chatHandler.HandleWebSocket, openapi.Operation{
+				Summary:     "Open the realtime event WebSocket",
+				Description: "Upgrades to a WebSocket. Negotiate the event protocol with the events.v1/events.v2 subprotocol or ?protocol=; append .msgpack or .proto (or set ?encoding=) for binary frames. Reconnecting with ?resume=&seq= replays missed events.",
+				Tags:        []string{"events"},
+				Status:      http.StatusSwitchingProtocols,
+				Query: []openapi.Param{
+					{Name: "ticket", Description: "One-time ticket from POST /api/ws/ticket (browsers can't set headers on WebSocket requests); or offer the subprotocols bearer, <token>"},
+					{Name: "token", Description: "Deprecated: bearer token, which ends up in access logs; use ticket"},
+					{Name: "protocol", Description: "Event protocol version (v1 or v2)"},
+					{Name: "encoding", Description: "Event encoding (json, msgpack or proto)"},
+					{Name: "schema", Description: "Payload schema version the client was built against (newest by default)"},
+					{Name: "appVersion", Description: "Frontend app version, checked against the tenant's client version policy"},
+					{Name: "resume", Description: "Resume token from the session event of a dropped connection"},
+					{Name: "seq", Description: "Sequence number of the last event received on that connection"},
+				},
+			})
+			api.Endpoint(http.MethodGet, "/events/stream", eventStreamHandler.ServeHTTP, openapi.Operation{
+				Summary:     "Stream realtime events over Server-Sent Events",
+				Description: "Alternative to the WebSocket for networks that block it. Events use the v2 envelope; reconnecting with Last-Event-ID replays missed events.",
+				Tags:        []string{"events"},
+				Query: []openapi.Param{
+					{Name: "ticket", Description: "One-time ticket from POST /api/ws/ticket (EventSource can't set headers)"},
+					{Name: "token", Description: "Deprecated: bearer token, which ends up in access logs; use ticket"},
+					{Name: "lastEventId", Description: "Resume after this event ID when the Last-Event-ID header can't be sent"},
+				},
+			})
+			api.Endpoint(http.MethodGet, "/events/since/{seq}", eventSinceHandler.ServeHTTP, openapi.Operation{
+				Summary:     "Backfill missed WebSocket events",
+				Description: "Returns the events of your WebSocket session after the sequence number, from the last few kept by the replica, so a client that noticed a gap in seq can fill it without reconnecting. Sessions with a binary encoding get 409 and should resume instead.",
+				Tags:        []string{"events"},
+				Response:    handlers.EventsSinceResponse{},
+			})
+			api.Endpoint(http.MethodGet, "/events/schemas", eventSchemaHandler.ServeHTTP, openapi.Operation{
+				Summary:     "List realtime event payload schemas",
+				Description: "Returns the payload fields of each event type and the schema version that added them. WebSocket clients built against an older version connect with ?schema= to receive payloads without newer fields.",
+				Tags:        []string{"events"},
+				Response:    handlers.EventSchemasResponse{},
+			})
+			api.Endpoint(http.MethodGet, "/events/poll", eventPollHandler.ServeHTTP, openapi.Operation{
+				Summary:     "Long-poll for realtime events",
+				Description: "Fallback for networks that allow neither WebSockets nor SSE. Waits until events arrive or the timeout elapses; events up to the cursor are acknowledged.",
+				Tags:        []string{"events"},
+				Query: []openapi.Param{
+					{Name: "cursor", Description: "Cursor returned by the previous poll"},
+					{Name: "timeout", Description: "Maximum wait (default 25s, max 30s)"},
+					{Name: "ticket", Description: "One-time ticket from POST /api/ws/ticket, when the Authorization header can't be sent"},
+					{Name: "token", Description: "Deprecated: bearer token, which ends up in access logs; use ticket"},
+				},
+				Response: longpoll.Result{},
+			})
+		})
+
+		// Compliance exports stream whole conversations, so they're exempt from handler timeouts
+		api.Group(func(api apiRouter) {
+			api.Use(authMiddleware.Middleware, requireCompliance)
+			api.Endpoint(http.MethodGet, "/conversations/{id}/export", exportHandler.Export, openapi.Operation{
+				Summary:     "Export a conversation for compliance",
+				Description: "Streams every message of a direct conversation (dm:<userId>:<userId>) or room (room:<roomId>) of your tenant as a file, thread replies, deleted messages and attachment manifests included, oldest first. Every export is audited.",
+				Tags:        []string{"compliance"},
+				Query:       []openapi.Param{{Name: "format", Description: "json (default) or csv"}},
+				Roles:       []string{models.RoleCompliance},
+			})
+		})
+
+		// Event Grid subscriptions authenticate with the inbound key rather than a bearer token
+		if eventGridHandler != nil {
+			api.Group(func(api apiRouter) {
+				api.Use(timeoutMiddleware.Middleware, bodyLimitMiddleware.Middleware)
+				api.Endpoint(http.MethodOptions, "/eventgrid/events", eventGridHandler.Validate, openapi.Operation{
+					Summary:     "CloudEvents webhook validation handshake",
+					Description: "Answers Event Grid's validation request for CloudEvents schema subscriptions. Requires the inbound key (?key= or X-Event-Grid-Key).",
+					Tags:        []string{"events"},
+					Public:      true,
+				})
+				api.Endpoint(http.MethodPost, "/eventgrid/events", eventGridHandler.Deliver, openapi.Operation{
+					Summary:     "Receive Event Grid events",
+					Description: "Accepts Event Grid schema batches (answering the SubscriptionValidationEvent) and CloudEvents v1.0 in structured or binary mode. Events are delivered as topic_event to the subscribers of the topic their type is routed to. Requires the inbound key (?key= or X-Event-Grid-Key).",
+					Tags:        []string{"events"},
+					Public:      true,
+					Response:    handlers.EventGridDeliveryResponse{},
+				})
+			})
+		}
+
+		// Backend applications push application events with an API key or an app token holding
+		// the Events.Ingest role
+		api.Group(func(api apiRouter) {
+			api.Use(timeoutMiddleware.Middleware, bodyLimitMiddleware.Middleware,
+				authMiddleware.APIKeyMiddleware(cfg.IngestAPIKeys, models.RoleEventsIngest), requireIngest)
+			api.Endpoint(http.MethodPost, "/events/ingest", ingestHandler.Ingest, openapi.Operation{
+				Summary:     "Push an application event to users, a topic or everyone",
+				Description: "The type must be a registered application event type; its payload is validated and persisted as registered, then the event is sent to the userIds, the topic's subscribers (optionally only a tenant's) or, with broadcast, every connected client.",
+				Tags:        []string{"events"},
+				APIKey:      true,
+				Roles:       []string{models.RoleEventsIngest},
+				Request:     handlers.IngestEventRequest{},
+				Response:    handlers.IngestEventResponse{},
+				Status:      http.StatusAccepted,
+			})
+		})
+
+		// Authenticated endpoints
+		api.Group(func(api apiRouter) {
+			api.Use(timeoutMiddleware.Middleware, bodyLimitMiddleware.Middleware, authMiddleware.Middleware)
+
+			api.Endpoint(http.MethodGet, "/user/me", userHandler.ServeHTTP,
+				openapi.Operation{Summary: "Get the current user", Tags: []string{"users"}, Response: models.User{}})
+			api.Endpoint(http.MethodGet, "/user/me/usage", usageHandler.Me,
+				openapi.Operation{Summary: "Get the current user's storage usage and quota", Tags: []string{"users"}, Response: handlers.UserUsageResponse{}})
+			api.Endpoint(http.MethodGet, "/features", featureHandler.ServeHTTP,
+				openapi.Operation{Summary: "List the feature flags and whether each is on for you", Description: "Endpoints of features that are off for the caller answer 404 feature_disabled.", Tags: []string{"features"}, Response: handlers.FeaturesResponse{}})
+			api.Endpoint(http.MethodPost, "/ws/ticket", ticketHandler.ServeHTTP,
+				openapi.Operation{Summary: "Issue a one-time ticket for opening a stream", Description: "Pass the ticket as ?ticket= when opening the WebSocket, SSE or long-poll stream instead of putting the bearer token in the URL. Tickets expire after WS_TICKET_TTL and must be used on the replica that issued them.", Tags: []string{"events"}, Response: handlers.TicketResponse{}})
+			api.Endpoint(http.MethodGet, "/users/active", chatHandler.GetActiveUsers,
+				openapi.Operation{Summary: "List connected users", Tags: []string{"users"}, Response: handlers.ActiveUsersResponse{}})
+			api.Endpoint(http.MethodGet, "/users/blocked", blockHandler.List,
+				openapi.Operation{Summary: "List the users you blocked or muted", Tags: []string{"users"}, Response: handlers.BlocksResponse{}})
+			api.Endpoint(http.MethodPost, "/users/{id}/block", blockHandler.Block,
+				openapi.Operation{Summary: "Block a user", Description: "Their messages, mentions, edits, reactions and attachments are no longer delivered to you, and their direct messages to you are refused with 403. Replaces a mute.", Tags: []string{"users"}, Response: store.Block{}})
+			api.Endpoint(http.MethodDelete, "/users/{id}/block", blockHandler.Unblock,
+				openapi.Operation{Summary: "Unblock a user", Tags: []string{"users"}, Status: http.StatusNoContent})
+			api.Endpoint(http.MethodPost, "/users/{id}/mute", blockHandler.Mute,
+				openapi.Operation{Summary: "Mute a user", Description: "Like blocking, but their direct messages are still accepted and kept in your conversation's history; they can't tell they're muted. Replaces a block.", Tags: []string{"users"}, Response: store.Block{}})
+			api.Endpoint(http.MethodDelete, "/users/{id}/mute", blockHandler.Unmute,
+				openapi.Operation{Summary: "Unmute a user", Tags: []string{"users"}, Status: http.StatusNoContent})
+			api.Endpoint(http.MethodPut, "/presence", presenceHandler.Set,
+				openapi.Operation{Summary: "Set the current user's presence status", Description: "The caller must be connected (WebSocket, SSE, long-poll or gRPC stream); 409 otherwise.", Tags: []string{"presence"}, Request: handlers.SetPresenceRequest{}, Response: events.Presence{}})
+			api.Endpoint(http.MethodGet, "/presence/{userId}", presenceHandler.Get,
+				openapi.Operation{Summary: "Get a user's presence", Description: "Users who aren't connected are reported as offline.", Tags: []string{"presence"}, Response: events.Presence{}})
+			api.Endpoint(http.MethodPost, "/graphql", graphQLHandler.ServeHTTP,
+				openapi.Operation{Summary: "Query users and live sessions with GraphQL", Description: "Fields the caller may not read resolve to null with a FORBIDDEN error.", Tags: []string{"graphql"}, Request: handlers.GraphQLRequest{}, Response: handlers.GraphQLResponse{}})
+			api.Endpoint(http.MethodGet, "/retention", retentionHandler.Get,
+				openapi.Operation{Summary: "Get how long your direct messages are kept", Description: "Room policies are part of the room details.", Tags: []string{"messages"}, Response: retention.Effective{}})
+			api.Endpoint(http.MethodGet, "/announcements", announcementHandler.Active,
+				openapi.Operation{Summary: "List the active announcements addressed to you", Description: "Connected clients also get them as system_announcement events.", Tags: []string{"announcements"}, Response: handlers.AnnouncementsResponse{}})
+			api.Endpoint(http.MethodGet, "/user/me/notifications", notificationHandler.Preferences,
+				openapi.Operation{Summary: "Get your notification preferences", Description: "Users who never saved any get push notifications only.", Tags: []string{"notifications"}, Response: store.NotificationPreferences{}})
+			api.Endpoint(http.MethodPut, "/user/me/notifications", notificationHandler.SetPreferences,
+				openapi.Operation{Summary: "Replace your notification preferences", Description: "Choose the channels telling you about direct messages sent while you're offline (push, email, teams; all off leaves live connections only), quiet hours during which nothing is sent, and per-event-type toggles. push is on when omitted. In Teams graph mode teamsChatId names the chat cards are posted to; turning teams on while Teams notifications aren't enabled is 400.", Tags: []string{"notifications"}, Request: handlers.NotificationPreferencesRequest{}, Response: store.NotificationPreferences{}})
+			api.Endpoint(http.MethodGet, "/notifications/{id}", notificationHandler.Get,
+				openapi.Operation{Summary: "Fetch the full message behind a push notification", Description: "Recipient only; expires after PUSH_NOTIFICATION_TTL.", Tags: []string{"notifications"}, Response: webpush.Message{}})
+			if pushHandler != nil {
+				api.Endpoint(http.MethodGet, "/push/vapid-public-key", pushHandler.VAPIDKey,
+					openapi.Operation{Summary: "Get the VAPID public key", Description: "The applicationServerKey to pass to PushManager.subscribe().", Tags: []string{"notifications"}, Response: handlers.VAPIDKeyResponse{}})
+				api.Endpoint(http.MethodGet, "/push/subscriptions", pushHandler.List,
+					openapi.Operation{Summary: "List your push subscriptions", Tags: []string{"notifications"}, Response: handlers.PushSubscriptionsResponse{}})
+				api.Endpoint(http.MethodPost, "/push/subscriptions", pushHandler.Subscribe,
+					openapi.Operation{Summary: "Register a push subscription", Description: "The browser's PushSubscription.toJSON(). Direct messages sent while you're offline are pushed to it. The endpoint must be on a known push service; registering it again replaces its keys. At most 10 per user (409).", Tags: []string{"notifications"}, Request: handlers.PushSubscribeRequest{}, Response: store.PushSubscription{}, Status: http.StatusCreated})
+				api.Endpoint(http.MethodDelete, "/push/subscriptions/{id}", pushHandler.Unsubscribe,
+					openapi.Operation{Summary: "Remove a push subscription", Tags: []string{"notifications"}, Status: http.StatusNoContent})
+			}
+			if deviceHandler != nil {
+				api.Endpoint(http.MethodGet, "/devices", deviceHandler.List,
+					openapi.Operation{Summary: "List your mobile devices", Tags: []string{"notifications"}, Response: handlers.DevicesResponse{}})
+				api.Endpoint(http.MethodPost, "/devices", deviceHandler.Register,
+					openapi.Operation{Summary: "Register a mobile device's push token", Description: "platform is fcm or apns. Direct messages sent while you're offline are pushed to the device through Azure Notification Hubs; devices whose token is rejected are removed. Registering a token again replaces it. At most 10 per user (409).", Tags: []string{"notifications"}, Request: handlers.RegisterDeviceRequest{}, Response: store.Device{}, Status: http.StatusCreated})
+				api.Endpoint(http.MethodDelete, "/devices/{id}", deviceHandler.Unregister,
+					openapi.Operation{Summary: "Remove a mobile device", Description: "Call it when the user signs out of the app.", Tags: []string{"notifications"}, Status: http.StatusNoContent})
+			}
+
+			api.Endpoint(http.MethodGet, "/messages", chatHandler.GetMessageHistory, openapi.Operation{
+				Summary: "List the messages exchanged with another user, newest first",
+				Tags:    []string{"messages"},
+				Query: []openapi.Param{
+					{Name: "with", Description: "ID of the other user", Required: true},
+					{Name: "limit", Description: "Messages per page (default 50, max 200)"},
+					{Name: "before", Description: "Only messages sent before this time (the previous page's before value)"},
+				},
+				Response: handlers.MessageHistoryResponse{},
+			})
 
-	// Set up routes with CORS
-	http.Handle("/api/health", corsMiddleware.Middleware(healthHandler))
-	http.Handle("/api/user/me", corsMiddleware.Middleware(authMiddleware.Middleware(userHandler)))
-
-	// Chat endpoints
-	// WebSocket endpoint - Browser WebSocket API cannot send custom Authorization headers,
-	// so we extract the JWT token from the query parameter and inject it into the header
-	// before passing the request to the auth middleware.
-	http.HandleFunc("/api/ws", func(w http.ResponseWriter, r *http.Request) {
-		token := r.URL.Query().Get("token")
-		if token != "" {
-			r.Header.Set("Authorization", "Bearer "+token)
-		}
-		authHandler := authMiddleware.Middleware(http.HandlerFunc(handlers.HandleWebSocket))
-		authHandler.ServeHTTP(w, r)
+			api.Endpoint(http.MethodGet, "/messages/{id}/thread", chatHandler.GetThread, openapi.Operation{
+				Summary:     "Get a message's thread",
+				Description: "The message (or, for a reply, the message it replies to) with its replies, newest first. Participants of the conversation only.",
+				Tags:        []string{"messages"},
+				Query: []openapi.Param{
+					{Name: "limit", Description: "Replies per page (default 50, max 200)"},
+					{Name: "before", Description: "Only replies sent before this time (the previous page's before value)"},
+				},
+				Response: handlers.ThreadResponse{},
+			})
+
+			if searchHandler != nil {
+				api.Endpoint(http.MethodGet, "/messages/search", searchHandler.Search, openapi.Operation{
+					Summary:     "Search your messages",
+					Description: "Full-text search over the direct conversations and rooms you take part in, best matches first. Highlights are HTML with matches in <mark> tags.",
+					Tags:        []string{"messages"},
+					Query: []openapi.Param{
+						{Name: "q", Description: "Words to find", Required: true},
+						{Name: "peer", Description: "Only messages exchanged with this user"},
+						{Name: "limit", Description: "Hits per page (default 20, max 50)"},
+						{Name: "offset", Description: "Hits to skip (the previous page's nextOffset value)"},
+					},
+					Response: search.Results{},
+				})
+			}
+
+			api.Endpoint(http.MethodGet, "/conversations", chatHandler.ListConversations,
+				openapi.Operation{Summary: "List your direct conversations and rooms", Description: "Most recently active first, with each one's last message and unread count.", Tags: []string{"messages"}, Response: handlers.ConversationsResponse{}})
+			api.Endpoint(http.MethodPost, "/messages/{id}/read", chatHandler.MarkRead,
+				openapi.Operation{Summary: "Mark a conversation read up to a message", Description: "Participants only. Read markers never move back.", Tags: []string{"messages"}, Status: http.StatusNoContent})
+			if attachmentHandler != nil {
+				api.Endpoint(http.MethodGet, "/messages/{id}/attachments/{attachmentId}", attachmentHandler.Download,
+					openapi.Operation{Summary: "Get a short-lived download URL for a message's attachment", Description: "Participants only.", Tags: []string{"attachments"}, Response: attachments.Download{}})
+			}
+
+			api.Endpoint(http.MethodGet, "/rooms", roomsFeature(roomHandler.List),
+				openapi.Operation{Summary: "List the rooms you've joined", Tags: []string{"rooms"}, Response: handlers.RoomListResponse{}})
+			api.Endpoint(http.MethodGet, "/rooms/{id}", roomsFeature(roomHandler.Get),
+				openapi.Operation{Summary: "Get a room with its members and storage usage", Description: "Members only.", Tags: []string{"rooms"}, Response: rooms.Details{}})
+			api.Endpoint(http.MethodPost, "/rooms/{id}/leave", roomsFeature(roomHandler.Leave),
+				openapi.Operation{Summary: "Leave a room", Tags: []string{"rooms"}, Status: http.StatusNoContent})
+			api.Endpoint(http.MethodGet, "/rooms/{id}/messages", roomsFeature(roomHandler.History), openapi.Operation{
+				Summary:     "List a room's messages, newest first",
+				Description: "Members only.",
+				Tags:        []string{"rooms"},
+				Query: []openapi.Param{
+					{Name: "limit", Description: "Messages per page (default 50, max 200)"},
+					{Name: "before", Description: "Only messages sent before this time (the previous page's before value)"},
+				},
+				Response: handlers.MessageHistoryResponse{},
+			})
+
+			api.Group(func(api apiRouter) {
+				api.Use(tenantGuard.Middleware)
+				api.Endpoint(http.MethodPost, "/messages/send", idempotent(http.HandlerFunc(chatHandler.SendMessage)).ServeHTTP, openapi.Operation{
+					Summary:  "Send a message to a user",
+					Tags:     []string{"messages"},
+					Headers:  []openapi.Param{{Name: middleware.IdempotencyKeyHeader, Description: "Retries with the same key within IDEMPOTENCY_KEY_TTL get the original response (marked Idempotent-Replayed) instead of sending again; 409 while the original is in progress, 422 when the key was used for a different request. Responses are kept by the replica that answered, so a retry reaching another replica sends again."}},
+					Request:  handlers.SendMessageRequest{},
+					Response: handlers.SendMessageResponse{},
+				})
+				api.Endpoint(http.MethodPatch, "/messages/{id}", chatHandler.EditMessage,
+					openapi.Operation{Summary: "Edit a message", Description: "Sender or tenant admin only. The replaced version is kept in the message's revisions.", Tags: []string{"messages"}, Request: handlers.EditMessageRequest{}, Response: store.Message{}})
+				api.Endpoint(http.MethodDelete, "/messages/{id}", chatHandler.DeleteMessage,
+					openapi.Operation{Summary: "Delete a message", Description: "Sender or tenant admin only. The message stays in its conversation as a tombstone without content.", Tags: []string{"messages"}, Status: http.StatusNoContent})
+				api.Endpoint(http.MethodPost, "/messages/{id}/reactions", reactionsFeature(chatHandler.AddReaction),
+					openapi.Operation{Summary: "React to a message with an emoji", Description: "Participants of the conversation only. Reacting again with the same emoji is a no-op.", Tags: []string{"messages"}, Request: handlers.ReactionRequest{}, Response: handlers.ReactionsResponse{}})
+				api.Endpoint(http.MethodDelete, "/messages/{id}/reactions", reactionsFeature(chatHandler.RemoveReaction), openapi.Operation{
+					Summary:  "Remove your emoji reaction from a message",
+					Tags:     []string{"messages"},
+					Query:    []openapi.Param{{Name: "emoji", Description: "The emoji to remove (URL-encoded)", Required: true}},
+					Response: handlers.ReactionsResponse{},
+				})
+				if attachmentHandler != nil {
+					api.Endpoint(http.MethodPost, "/attachments/initiate", attachmentHandler.Initiate,
+						openapi.Operation{Summary: "Start a file upload", Description: "Returns a short-lived SAS URL; PUT the file to it with the returned headers, then complete the upload.", Tags: []string{"attachments"}, Request: handlers.InitiateAttachmentRequest{}, Response: attachments.Upload{}})
+					api.Endpoint(http.MethodPost, "/attachments/complete", attachmentHandler.Complete,
+						openapi.Operation{Summary: "Attach an uploaded file to a message", Description: "Sender only. The uploaded blob's size and content type are checked against the limits.", Tags: []string{"attachments"}, Request: handlers.CompleteAttachmentRequest{}, Response: store.Message{}})
+				}
+				api.Endpoint(http.MethodPost, "/rooms", roomsFeature(roomHandler.Create),
+					openapi.Operation{Summary: "Create a room", Description: "The caller becomes its first member; only users of the caller's tenant can join.", Tags: []string{"rooms"}, Request: handlers.CreateRoomRequest{}, Response: rooms.Details{}, Status: http.StatusCreated})
+				api.Endpoint(http.MethodPost, "/rooms/{id}/join", roomsFeature(roomHandler.Join),
+					openapi.Operation{Summary: "Join a room", Tags: []string{"rooms"}, Response: rooms.Details{}})
+				api.Endpoint(http.MethodPost, "/rooms/{id}/messages", roomsFeature(roomHandler.SendMessage),
+					openapi.Operation{Summary: "Send a message to a room's members", Tags: []string{"rooms"}, Request: handlers.RoomMessageRequest{}, Response: rooms.Delivery{}})
+				api.Endpoint(http.MethodPost, "/topics/{topic}/events", topicHandler.Publish,
+					openapi.Operation{Summary: "Publish an event on a topic", Description: "Delivered as a topic_event to WebSocket clients of the caller's tenant subscribed to a matching pattern.", Tags: []string{"topics"}, Request: handlers.PublishTopicEventRequest{}, Response: handlers.PublishTopicEventResponse{}, Status: http.StatusAccepted})
+			})
+			api.Endpoint(http.MethodPost, "/messages/{id}/ack", chatHandler.AckMessage,
+				openapi.Operation{Summary: "Acknowledge receipt of a message", Description: "For clients that can't send WebSocket frames; 404 unless the message is awaiting the caller's ack (MESSAGE_ACKS).", Tags: []string{"messages"}, Status: http.StatusNoContent})
+
+			api.Group(func(api apiRouter) {
+				api.Use(clientErrorBodyLimit.Middleware)
+				api.Endpoint(http.MethodPost, "/client-errors", clientErrorHandler.ServeHTTP,
+					openapi.Operation{Summary: "Report a frontend error or WebSocket disconnect", Tags: []string{"diagnostics"}, Request: handlers.ClientErrorRequest{}, Status: http.StatusAccepted})
+			})
+
+			// Admin endpoints
+			api.Group(func(api apiRouter) {
+				api.Use(requireAdmin)
+				api.Use(adminActivity.Middleware)
+
+				api.Endpoint(http.MethodGet, "/admin/tenants", tenantHandler.List,
+					openapi.Operation{Summary: "List tenants", Tags: []string{"admin"}, Roles: admin})
+				api.Endpoint(http.MethodPost, "/admin/tenants", tenantHandler.Onboard,
+					openapi.Operation{Summary: "Onboard a tenant", Tags: []string{"admin"}, Roles: admin, Request: handlers.OnboardTenantRequest{}, Response: tenants.Tenant{}, Status: http.StatusCreated})
+				api.Endpoint(http.MethodGet, "/admin/tenants/{id}", tenantHandler.Get,
+					openapi.Operation{Summary: "Get a tenant", Tags: []string{"admin"}, Roles: admin, Response: tenants.Tenant{}})
+				api.Endpoint(http.MethodPost, "/admin/tenants/{id}/freeze", tenantHandler.Freeze,
+					openapi.Operation{Summary: "Freeze a tenant (read-only)", Tags: []string{"admin"}, Roles: admin, Response: tenants.Tenant{}})
+				api.Endpoint(http.MethodPost, "/admin/tenants/{id}/decommission", tenantHandler.Decommission,
+					openapi.Operation{Summary: "Export and purge a tenant's data", Tags: []string{"admin"}, Roles: admin, Request: handlers.DecommissionTenantRequest{}, Response: tenants.DecommissionReport{}, Status: http.StatusAccepted})
+
+				api.Endpoint(http.MethodGet, "/admin/tenants/{id}/client-versions", clientVersionHandler.Get,
+					openapi.Operation{Summary: "Get the client version policy applied to a tenant", Tags: []string{"admin"}, Roles: admin, Response: handlers.ClientVersionPolicyResponse{}})
+				api.Endpoint(http.MethodPut, "/admin/tenants/{id}/client-versions", clientVersionHandler.Put,
+					openapi.Operation{Summary: "Set a tenant's client version policy, forcing outdated connected clients to upgrade", Tags: []string{"admin"}, Roles: admin, Request: handlers.ClientVersionPolicyRequest{}, Response: handlers.ClientVersionPolicyResponse{}})
+				api.Endpoint(http.MethodDelete, "/admin/tenants/{id}/client-versions", clientVersionHandler.Delete,
+					openapi.Operation{Summary: "Restore the default client version policy for a tenant", Tags: []string{"admin"}, Roles: admin, Response: handlers.ClientVersionPolicyResponse{}})
+
+				api.Endpoint(http.MethodPost, "/admin/broadcast", announcementHandler.Broadcast,
+					openapi.Operation{Summary: "Broadcast an announcement", Description: "Sent as a system_announcement event to connected users, optionally only a tenant's or a room's, once it starts and to users connecting until it expires.", Tags: []string{"admin"}, Roles: admin, Request: handlers.BroadcastRequest{}, Response: announcements.Announcement{}, Status: http.StatusCreated})
+				api.Endpoint(http.MethodGet, "/admin/broadcast", announcementHandler.List,
+					openapi.Operation{Summary: "List scheduled and active announcements", Tags: []string{"admin"}, Roles: admin, Response: handlers.AnnouncementsResponse{}})
+				api.Endpoint(http.MethodDelete, "/admin/broadcast/{id}", announcementHandler.Cancel,
+					openapi.Operation{Summary: "Cancel an announcement", Tags: []string{"admin"}, Roles: admin, Status: http.StatusNoContent})
+
+				api.Endpoint(http.MethodPost, "/webhooks", webhookHandler.Create,
+					openapi.Operation{Summary: "Register a webhook", Description: "Events of the listed types are POSTed to the URL, signed with the secret (generated when omitted, and only returned here) in X-Webhook-Signature.", Tags: []string{"webhooks"}, Roles: admin, Request: handlers.CreateWebhookRequest{}, Response: webhooks.Webhook{}, Status: http.StatusCreated})
+				api.Endpoint(http.MethodGet, "/webhooks", webhookHandler.List,
+					openapi.Operation{Summary: "List webhooks", Tags: []string{"webhooks"}, Roles: admin, Response: handlers.WebhooksResponse{}})
+				api.Endpoint(http.MethodGet, "/webhooks/{id}", webhookHandler.Get,
+					openapi.Operation{Summary: "Get a webhook", Tags: []string{"webhooks"}, Roles: admin, Response: webhooks.Webhook{}})
+				api.Endpoint(http.MethodDelete, "/webhooks/{id}", webhookHandler.Delete,
+					openapi.Operation{Summary: "Delete a webhook", Tags: []string{"webhooks"}, Roles: admin, Status: http.StatusNoContent})
+
+				api.Endpoint(http.MethodPost, "/admin/users/{id}/kick", sanctionHandler.Kick,
+					openapi.Operation{Summary: "Close a user's connections", Description: "The user gets a kicked event and may reconnect.", Tags: []string{"admin"}, Roles: admin, Request: handlers.KickRequest{}, Response: handlers.KickResponse{}})
+				api.Endpoint(http.MethodPost, "/admin/users/{id}/ban", sanctionHandler.Ban,
+					openapi.Operation{Summary: "Ban a user for a while", Description: "The user gets a banned event, is disconnected and can't authenticate until the ban expires.", Tags: []string{"admin"}, Roles: admin, Request: handlers.BanRequest{}, Response: sanctions.Ban{}})
+				api.Endpoint(http.MethodDelete, "/admin/users/{id}/ban", sanctionHandler.Unban,
+					openapi.Operation{Summary: "Lift a user's ban", Tags: []string{"admin"}, Roles: admin, Status: http.StatusNoContent})
+				api.Endpoint(http.MethodGet, "/admin/bans", sanctionHandler.ListBans,
+					openapi.Operation{Summary: "List the bans in force", Tags: []string{"admin"}, Roles: admin, Response: handlers.BansResponse{}})
+
+				api.Endpoint(http.MethodGet, "/admin/audit", auditHandler.List,
+					openapi.Operation{
+						Summary:     "Search the audit log",
+						Description: "Returns this replica's audit records (auth failures, admin actions, bans, exports and more), newest first, and the state of the Blob and Log Analytics sinks.",
+						Tags:        []string{"admin"},
+						Roles:       admin,
+						Response:    handlers.AuditResponse{},
+						Query: []openapi.Param{
+							{Name: "action", Description: "Exact action, or a prefix ending in * (e.g. auth.*)"},
+							{Name: "actor", Description: "User ID performing the action"},
+							{Name: "tenantId", Description: "Tenant of the actor"},
+							{Name: "target", Description: "Resource acted on"},
+							{Name: "outcome", Description: "e.g. denied"},
+							{Name: "since", Description: "RFC 3339 timestamp, inclusive"},
+							{Name: "until", Description: "RFC 3339 timestamp, exclusive"},
+							{Name: "limit", Description: "Maximum records (default 100, max 1000)"},
+						},
+					})
+				api.Endpoint(http.MethodGet, "/admin/audit/verify", auditHandler.Verify,
+					openapi.Operation{Summary: "Verify the hash chain of this replica's audit log", Tags: []string{"admin"}, Roles: admin, Response: audit.Verification{}})
+
+				api.Endpoint(http.MethodGet, "/admin/role-mappings", roleMappingHandler.Get,
+					openapi.Operation{Summary: "Get group → role mappings", Tags: []string{"admin"}, Roles: admin})
+				api.Endpoint(http.MethodPut, "/admin/role-mappings", roleMappingHandler.Put,
+					openapi.Operation{Summary: "Replace group → role mappings", Tags: []string{"admin"}, Roles: admin, Request: handlers.RoleMappingsRequest{}})
+
+				api.Endpoint(http.MethodGet, "/admin/topic-acls", topicACLHandler.List,
+					openapi.Operation{Summary: "List topic access control rules", Tags: []string{"admin"}, Roles: admin, Response: handlers.TopicACLsResponse{}})
+				api.Endpoint(http.MethodPut, "/admin/topic-acls/{pattern}", topicACLHandler.Put,
+					openapi.Operation{Summary: "Set who may subscribe and publish to matching topics", Tags: []string{"admin"}, Roles: admin, Request: handlers.TopicACLRequest{}, Response: topics.Rule{}})
+				api.Endpoint(http.MethodDelete, "/admin/topic-acls/{pattern}", topicACLHandler.Delete,
+					openapi.Operation{Summary: "Remove a topic access control rule", Tags: []string{"admin"}, Roles: admin, Status: http.StatusNoContent})
+
+				api.Endpoint(http.MethodGet, "/admin/events/protocol", protocolHandler.Get,
+					openapi.Operation{Summary: "Get event protocol rollout status", Tags: []string{"admin"}, Roles: admin, Response: events.ProtocolStatus{}})
+				api.Endpoint(http.MethodPut, "/admin/events/protocol", protocolHandler.Put,
+					openapi.Operation{Summary: "Change the default event protocol", Tags: []string{"admin"}, Roles: admin, Request: handlers.SetProtocolRequest{}, Response: events.ProtocolStatus{}})
+				api.Endpoint(http.MethodPost, "/admin/events/protocol/rollback", protocolHandler.Rollback,
+					openapi.Operation{Summary: "Roll back to the previous default event protocol", Tags: []string{"admin"}, Roles: admin, Response: events.ProtocolStatus{}})
+
+				api.Endpoint(http.MethodGet, "/admin/deadletters", deadLetterHandler.List,
+					openapi.Operation{Summary: "List deliveries that failed for good", Description: "Dead letters of webhooks, offline notifications and backplane broadcasts, of every replica when DEADLETTERS_CONTAINER_URL is set (in memory on the replica that gave up on them otherwise); ?source= and ?target= filter them.", Tags: []string{"admin"}, Roles: admin, Response: handlers.DeadLetterListResponse{}})
+				api.Endpoint(http.MethodPost, "/admin/deadletters/{id}/redrive", deadLetterHandler.Redrive,
+					openapi.Operation{Summary: "Hand a dead letter back to the component that gave up on it", Tags: []string{"admin"}, Roles: admin, Status: http.StatusAccepted})
+				api.Endpoint(http.MethodDelete, "/admin/deadletters/{id}", deadLetterHandler.Delete,
+					openapi.Operation{Summary: "Discard a dead letter", Tags: []string{"admin"}, Roles: admin, Status: http.StatusNoContent})
+
+				api.Endpoint(http.MethodGet, "/admin/stats", statsHandler.ServeHTTP,
+					openapi.Operation{Summary: "Operational statistics", Tags: []string{"admin"}, Roles: admin})
+				api.Endpoint(http.MethodGet, "/admin/jobs", jobsHandler.ServeHTTP,
+					openapi.Operation{Summary: "Background jobs and their lock holders", Tags: []string{"admin"}, Roles: admin})
+				api.Endpoint(http.MethodGet, "/admin/config", configHandler.ServeHTTP,
+					openapi.Operation{Summary: "The effective configuration of this replica", Description: "Every setting with its value and source (default, profile, dev, file, appconfig, keyvault, dotenv, env or flag); credentials are masked.", Tags: []string{"admin"}, Roles: admin, Response: handlers.ConfigResponse{}})
+
+				api.Endpoint(http.MethodGet, "/admin/retention", retentionHandler.List,
+					openapi.Operation{Summary: "Get the default retention policy and its tenant and room overrides", Tags: []string{"admin"}, Roles: admin, Response: retention.Overrides{}})
+				api.Endpoint(http.MethodPut, "/admin/retention/tenants/{id}", retentionHandler.PutTenant,
+					openapi.Operation{Summary: "Set how long a tenant's messages are kept", Tags: []string{"admin"}, Roles: admin, Request: handlers.RetentionPolicyRequest{}, Response: retention.Policy{}})
+				api.Endpoint(http.MethodDelete, "/admin/retention/tenants/{id}", retentionHandler.DeleteTenant,
+					openapi.Operation{Summary: "Restore the default retention policy for a tenant", Tags: []string{"admin"}, Roles: admin, Status: http.StatusNoContent})
+				api.Endpoint(http.MethodPut, "/admin/retention/rooms/{id}", retentionHandler.PutRoom,
+					openapi.Operation{Summary: "Set how long a room's messages are kept", Tags: []string{"admin"}, Roles: admin, Request: handlers.RetentionPolicyRequest{}, Response: retention.Policy{}})
+				api.Endpoint(http.MethodDelete, "/admin/retention/rooms/{id}", retentionHandler.DeleteRoom,
+					openapi.Operation{Summary: "Restore the tenant's retention policy for a room", Tags: []string{"admin"}, Roles: admin, Status: http.StatusNoContent})
+
+				if moderationHandler != nil {
+					api.Endpoint(http.MethodGet, "/admin/moderation/quarantine", moderationHandler.List,
+						openapi.Operation{Summary: "List messages held in the moderation quarantine", Description: "Filter with ?status=pending, approved or removed.", Tags: []string{"admin"}, Roles: admin, Response: handlers.QuarantineResponse{}})
+					api.Endpoint(http.MethodPost, "/admin/moderation/quarantine/{id}/approve", moderationHandler.Approve,
+						openapi.Operation{Summary: "Keep a quarantined message", Tags: []string{"admin"}, Roles: admin, Response: moderation.QuarantineItem{}})
+					api.Endpoint(http.MethodPost, "/admin/moderation/quarantine/{id}/remove", moderationHandler.Remove,
+						openapi.Operation{Summary: "Take down a quarantined message", Tags: []string{"admin"}, Roles: admin, Response: moderation.QuarantineItem{}})
+				}
+			})
+		})
 	})
-	http.Handle("/api/users/active", corsMiddleware.Middleware(authMiddleware.Middleware(http.HandlerFunc(handlers.GetActiveUsers))))
-	http.Handle("/api/messages/send", corsMiddleware.Middleware(authMiddleware.Middleware(http.HandlerFunc(handlers.SendMessage))))
+
+	// Probes (Kubernetes/Container Apps, no CORS or auth)
+	router.Method(http.MethodGet, "/healthz", timeoutMiddleware.WithTimeout(2*time.Second, http.HandlerFunc(probeHandler.Liveness)))
+	router.Method(http.MethodGet, "/readyz", timeoutMiddleware.WithTimeout(5*time.Second, http.HandlerFunc(probeHandler.Readiness)))
+	router.Method(http.MethodGet, "/startupz", timeoutMiddleware.WithTimeout(5*time.Second, http.HandlerFunc(probeHandler.Startup)))
 
 	// Start server
 	log.Printf("🚀 %s v%s starting on port %s", serviceName, version, cfg.Port)
-	log.Printf("📍 Endpoints:")
+	log.Printf("📍 Endpoints (API routes are also served under /api/v1):")
+	log.Printf("   GET /healthz, /readyz, /startupz - Liveness/Readiness/Startup Probes (public)")
 	log.Printf("   GET /api/health - Health Check (public)")
+	log.Printf("   GET /api/openapi.json - OpenAPI Document (public)")
+	if cfg.SwaggerUIEnabled {
+		log.Printf("   GET /api/docs - Swagger UI (public)")
+	}
 	log.Printf("   GET /api/user/me - Get Current User (authenticated)")
+	log.Printf("   GET /api/user/me/usage - Storage Usage and Quota (authenticated)")
+	log.Printf("   GET /api/features - Feature Flags (authenticated)")
 	log.Printf("   GET /api/ws - WebSocket Connection (authenticated)")
+	log.Printf("   POST /api/ws/ticket - One-Time Stream Ticket (authenticated)")
+	log.Printf("   GET /api/events/stream - Server-Sent Events Stream (authenticated)")
+	log.Printf("   GET /api/events/poll - Long-Poll Events (authenticated)")
+	if cfg.WebTransportPort != "" {
+		log.Printf("   CONNECT /api/events/webtransport - WebTransport Event Stream over HTTP/3 (authenticated, webtransport flag)")
+	}
+	log.Printf("   GET /api/events/since/{seq} - Backfill Missed WebSocket Events (authenticated)")
+	log.Printf("   GET /api/events/schemas - Event Payload Schemas (authenticated)")
+	log.Printf("   POST /api/events/ingest - Ingest Application Event (API key or Events.Ingest app role)")
+	if eventGridHandler != nil {
+		log.Printf("   OPTIONS/POST /api/eventgrid/events - Event Grid Subscription Endpoint (inbound key)")
+	}
 	log.Printf("   GET /api/users/active - Get Active Users (authenticated)")
+	log.Printf("   PUT /api/presence - Set Presence Status (authenticated)")
+	log.Printf("   GET /api/presence/{userId} - Get User Presence (authenticated)")
 	log.Printf("   POST /api/messages/send - Send Chat Message (authenticated)")
+	log.Printf("   GET /api/messages?with={userId} - Message History (authenticated)")
+	log.Printf("   GET /api/messages/{id}/thread - Message Thread (participants)")
+	if searchHandler != nil {
+		log.Printf("   GET /api/messages/search?q= - Search Messages (authenticated)")
+	}
+	log.Printf("   POST /api/messages/{id}/read - Mark Read (participants)")
+	log.Printf("   GET /api/conversations - Conversations with Unread Counts (authenticated)")
+	log.Printf("   GET /api/conversations/{id}/export?format= - Compliance Export (compliance)")
+	log.Printf("   PATCH/DELETE /api/messages/{id} - Edit/Delete Message (sender or admin)")
+	log.Printf("   POST/DELETE /api/messages/{id}/reactions - Add/Remove Reaction (participants)")
+	log.Printf("   POST /api/messages/{id}/ack - Acknowledge Message (authenticated)")
+	if attachmentHandler != nil {
+		log.Printf("   POST /api/attachments/initiate - Start File Upload (authenticated)")
+		log.Printf("   POST /api/attachments/complete - Attach Uploaded File (sender)")
+		log.Printf("   GET /api/messages/{id}/attachments/{attachmentId} - Attachment Download URL (participants)")
+	}
+	log.Printf("   POST /api/rooms - Create Room (authenticated)")
+	log.Printf("   GET /api/rooms - List Joined Rooms (authenticated)")
+	log.Printf("   GET /api/rooms/{id} - Room Details (members)")
+	log.Printf("   POST /api/rooms/{id}/join - Join Room (authenticated)")
+	log.Printf("   POST /api/rooms/{id}/leave - Leave Room (members)")
+	log.Printf("   POST /api/rooms/{id}/messages - Send Room Message (members)")
+	log.Printf("   GET /api/rooms/{id}/messages - Room Message History (members)")
+	log.Printf("   POST /api/topics/{topic}/events - Publish Topic Event (authenticated)")
+	log.Printf("   POST /api/graphql - GraphQL Queries (authenticated)")
+	log.Printf("   GET /api/notifications/{id} - Fetch Notified Message (authenticated)")
+	log.Printf("   GET /api/user/me/notifications - Get Notification Preferences (authenticated)")
+	log.Printf("   PUT /api/user/me/notifications - Set Notification Preferences (authenticated)")
+	if pushHandler != nil {
+		log.Printf("   GET /api/push/vapid-public-key - VAPID Public Key (authenticated)")
+		log.Printf("   GET/POST /api/push/subscriptions - Push Subscriptions (authenticated)")
+		log.Printf("   DELETE /api/push/subscriptions/{id} - Remove Push Subscription (authenticated)")
+	}
+	if deviceHandler != nil {
+		log.Printf("   GET/POST /api/devices - Mobile Devices (authenticated)")
+		log.Printf("   DELETE /api/devices/{id} - Remove Mobile Device (authenticated)")
+	}
+	log.Printf("   GET /api/retention - Direct Message Retention Policy (authenticated)")
+	log.Printf("   GET /api/announcements - Active Announcements (authenticated)")
+	log.Printf("   GET /api/users/blocked - Blocked and Muted Users (authenticated)")
+	log.Printf("   POST/DELETE /api/users/{id}/{block|mute} - Block/Mute User (authenticated)")
+	log.Printf("   POST /api/client-errors - Report Client Error (authenticated)")
+	log.Printf("   GET /api/admin/deadletters - Failed Deliveries (admin)")
+	log.Printf("   POST /api/admin/deadletters/{id}/redrive - Redrive Dead Letter (admin)")
+	log.Printf("   DELETE /api/admin/deadletters/{id} - Discard Dead Letter (admin)")
+	log.Printf("   GET /api/admin/stats - Operational Stats (admin)")
+	log.Printf("   GET /api/admin/jobs - Background Jobs and Lock Holders (admin)")
+	log.Printf("   GET /api/admin/config - Effective Configuration (admin)")
+	log.Printf("   GET /api/admin/retention - Retention Policies (admin)")
+	log.Printf("   PUT/DELETE /api/admin/retention/{tenants|rooms}/{id} - Tenant/Room Retention Policy (admin)")
+	if moderationHandler != nil {
+		log.Printf("   GET /api/admin/moderation/quarantine - Quarantined Messages (admin)")
+		log.Printf("   POST /api/admin/moderation/quarantine/{id}/{approve|remove} - Review Quarantined Message (admin)")
+	}
+	log.Printf("   GET/POST /api/admin/tenants - List/Onboard Tenants (admin)")
+	log.Printf("   GET /api/admin/tenants/{id} - Get Tenant (admin)")
+	log.Printf("   POST /api/admin/tenants/{id}/freeze - Freeze Tenant (admin)")
+	log.Printf("   POST /api/admin/tenants/{id}/decommission - Export and Purge Tenant (admin)")
+	log.Printf("   GET/PUT/DELETE /api/admin/tenants/{id}/client-versions - Tenant Client Version Policy (admin)")
+	log.Printf("   GET/POST /api/admin/broadcast - List/Broadcast Announcements (admin)")
+	log.Printf("   DELETE /api/admin/broadcast/{id} - Cancel Announcement (admin)")
+	log.Printf("   GET/POST /api/webhooks - List/Register Webhooks (admin)")
+	log.Printf("   GET/DELETE /api/webhooks/{id} - Get/Delete Webhook (admin)")
+	log.Printf("   POST /api/admin/users/{id}/kick - Kick User (admin)")
+	log.Printf("   POST/DELETE /api/admin/users/{id}/ban - Ban/Unban User (admin)")
+	log.Printf("   GET /api/admin/bans - Bans in Force (admin)")
+	log.Printf("   GET /api/admin/audit[/verify] - Audit Log (admin)")
+	log.Printf("   GET/PUT /api/admin/role-mappings - Group Role Mappings (admin)")
+	log.Printf("   GET/PUT/DELETE /api/admin/topic-acls[/{pattern}] - Topic Access Control (admin)")
+	log.Printf("   GET/PUT /api/admin/events/protocol - Default Event Protocol (admin)")
+	log.Printf("   POST /api/admin/events/protocol/rollback - Roll Back Event Protocol (admin)")
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	log.Printf("⏱️  Timeouts: read=%s, write=%s, idle=%s, handler=%s", cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout, cfg.HandlerTimeout)
+
+	if cfg.TLSEnabled() {
+		reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		if err := reloader.Watch(ctx); err != nil {
+			log.Printf("⚠️  TLS certificate hot reload disabled: %v", err)
+		}
+		server.TLSConfig = reloader.TLSConfig()
+	}
+
+	// gRPC API for internal services, sharing the chat service and TLS certificate with HTTP
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		listener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			log.Fatalf("Failed to listen on gRPC port %s: %v", cfg.GRPCPort, err)
+		}
+		grpcServer = rpc.NewServer(authMiddleware, chatService, server.TLSConfig)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
+		log.Printf("📡 gRPC API listening on port %s (chat.v1.ChatService)", cfg.GRPCPort)
+	}
+
+	// WebTransport listener on UDP, sharing the event hub and certificate. It only serves the
+	// WebTransport endpoint, which OpenAPI can't describe (there are no CONNECT operations).
+	var webTransportServer *webtransport.Server
+	if cfg.WebTransportPort != "" {
+		webTransportRouter := newRouter(cfg, nil, func(api apiRouter) {
+			api.Use(authMiddleware.StreamMiddleware(middleware.StreamCredentials{Tickets: streamTickets, QueryToken: cfg.WSQueryToken}))
+			api.Method(http.MethodConnect, "/events/webtransport", requireFeature(featureFlags, features.WebTransport)(webTransportHandler.ServeHTTP))
+		})
+		webTransportServer = webTransportHandler.Server(":"+cfg.WebTransportPort, server.TLSConfig, webTransportRouter)
+		go func() {
+			if err := webTransportServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("WebTransport server failed: %v", err)
+			}
+		}()
+		log.Printf("🧪 WebTransport (HTTP/3) listening on UDP port %s (experimental, webtransport flag)", cfg.WebTransportPort)
+	}
+
+	go func() {
+		var err error
+		if cfg.TLSEnabled() {
+			log.Printf("🔒 Serving HTTPS (certificate reloads on file change or SIGHUP)")
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Printf("🛑 Shutting down (waiting up to %s for in-flight requests and background workers)", cfg.ShutdownTimeout)
+
+	// Closing the event clients first ends the streams (WebSocket, SSE, long-poll, gRPC, WebTransport) that
+	// would otherwise keep the servers from shutting down
+	eventManager.Stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if grpcServer != nil {
+		go func() {
+			<-shutdownCtx.Done()
+			grpcServer.Stop()
+		}()
+		grpcServer.GracefulStop()
+	}
+	if webTransportServer != nil {
+		if err := webTransportServer.Close(); err != nil {
+			log.Printf("⚠️  WebTransport server shutdown: %v", err)
+		}
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️  Graceful shutdown timed out: %v", err)
+	}
 
-	if err := http.ListenAndServe(":"+cfg.Port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// The workers saw ctx cancelled with the signal; wait for them to flush and release their locks
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		log.Printf("⚠️  Background workers did not stop within %s", cfg.ShutdownTimeout)
 	}
+	log.Printf("👋 Stopped")
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"api-service/internal/config"
+	"api-service/internal/features"
+	"api-service/internal/middleware"
+	"api-service/internal/openapi"
+	"api-service/internal/problem"
+)
+
+// routeMethods are the methods reported in the Allow header of 405 responses
+var routeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions, http.MethodConnect,
+}
+
+// apiRouter registers API routes relative to /api and documents each one in the OpenAPI spec
+// under its /api/v1 path
+type apiRouter struct {
+	chi.Router
+	spec *openapi.Spec
+}
+
+// Group creates a route group sharing its own middleware stack (added with Use)
+func (ar apiRouter) Group(fn func(api apiRouter)) {
+	ar.Router.Group(func(r chi.Router) {
+		fn(apiRouter{Router: r, spec: ar.spec})
+	})
+}
+
+// Endpoint registers handler for method and path and documents the operation
+func (ar apiRouter) Endpoint(method, path string, handler http.HandlerFunc, op openapi.Operation) {
+	ar.Router.Method(method, path, handler)
+	ar.spec.Add(method+" /api/v1"+path, op)
+}
+
+// requireFeature wraps the handlers of a feature's endpoints with middleware.RequireFeature
+func requireFeature(flags *features.Set, name string) func(http.HandlerFunc) http.HandlerFunc {
+	require := middleware.RequireFeature(flags, name)
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return require(handler).ServeHTTP
+	}
+}
+
+// newRouter builds the service router. API routes declared by the routes function are served
+// under /api/v1, with the unversioned /api paths kept as aliases; aliases are marked deprecated
+// once API_LEGACY_DEPRECATED_AT is configured. spec may be nil when routes registers no
+// Endpoint.
+func newRouter(cfg *config.Config, spec *openapi.Spec, routes func(api apiRouter)) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(middleware.NewRequestIDMiddleware().Middleware)
+	router.Use(middleware.NewClientIPResolver(cfg.TrustedProxies).Middleware)
+	router.NotFound(notFound)
+	router.MethodNotAllowed(methodNotAllowed(router))
+
+	api := chi.NewRouter()
+	api.NotFound(notFound)
+	api.MethodNotAllowed(methodNotAllowed(api))
+	routes(apiRouter{Router: api, spec: spec})
+
+	router.Mount("/api/v1", api)
+	if cfg.LegacyAPIDeprecatedAt.IsZero() {
+		router.Mount("/api", api)
+	} else {
+		router.Mount("/api", legacyAlias(middleware.Deprecation{
+			Since:  cfg.LegacyAPIDeprecatedAt,
+			Sunset: cfg.LegacyAPISunset,
+		})(api))
+	}
+
+	return router
+}
+
+// legacyAlias marks unversioned /api requests deprecated, pointing at the matching /api/v1 path
+func legacyAlias(d middleware.Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deprecation := d
+			deprecation.Successor = "/api/v1" + strings.TrimPrefix(r.URL.Path, "/api")
+			middleware.Deprecated(deprecation)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// notFound responds with a not_found problem
+func notFound(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusNotFound, "not_found", "No route matches "+r.URL.Path)
+}
+
+// methodNotAllowed responds with a method_not_allowed problem, listing the methods the
+// matched route supports in the Allow header
+func methodNotAllowed(mux *chi.Mux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+			path = rctx.RoutePath // Path relative to the mount point of a subrouter
+		}
+
+		var allowed []string
+		for _, method := range routeMethods {
+			if mux.Match(chi.NewRouteContext(), method, path) {
+				allowed = append(allowed, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed",
+			fmt.Sprintf("%s is not supported here; allowed: %s", r.Method, strings.Join(allowed, ", ")))
+	}
+}
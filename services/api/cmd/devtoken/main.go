@@ -0,0 +1,98 @@
+// Command devtoken issues locally signed tokens the API accepts, so the REST API and the
+// WebSocket can be exercised without a real Azure AD tenant.
+//
+// Serve the signing key's JWKS and point the API at it (with the printed settings):
+//
+//	go run ./cmd/devtoken -serve
+//
+// Then mint tokens, printed on stdout:
+//
+//	TOKEN=$(go run ./cmd/devtoken -name "Alice" -roles Admin -exp 2h)
+//	curl -H "Authorization: Bearer $TOKEN" http://localhost:8080/api/user/me
+//
+// The key is kept in the user config directory, so tokens stay valid across restarts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"api-service/internal/testidp"
+)
+
+func main() {
+	serve := flag.Bool("serve", false, "Serve the JWKS instead of printing a token")
+	addr := flag.String("addr", "localhost:9999", "Address the JWKS is served on (also sets the token issuer)")
+	keyFile := flag.String("key", defaultKeyFile(), "PEM file of the signing key, created if missing")
+	tenantID := flag.String("tenant", testidp.DefaultTenantID, "Tenant ID (tid claim; the API's AZURE_TENANT_ID)")
+	clientID := flag.String("client", testidp.DefaultClientID, "Application ID (aud claim; the API's AZURE_CLIENT_ID)")
+	oid := flag.String("oid", "00000000-0000-0000-0000-000000000001", "User object ID (oid claim)")
+	name := flag.String("name", "Dev User", "Display name (name claim)")
+	email := flag.String("email", "", "Email (email and preferred_username claims; derived from -name when empty)")
+	roles := flag.String("roles", "", "Comma-separated app roles (roles claim), e.g. Admin,Compliance")
+	groups := flag.String("groups", "", "Comma-separated group object IDs (groups claim)")
+	exp := flag.Duration("exp", 8*time.Hour, "Token lifetime")
+	flag.Parse()
+
+	key, err := testidp.LoadOrCreateKey(*keyFile)
+	if err != nil {
+		log.Fatalf("Failed to load the signing key: %v", err)
+	}
+	idp := testidp.NewWithKey(key, "http://"+*addr)
+	idp.TenantID = *tenantID
+	idp.ClientID = *clientID
+
+	if *serve {
+		fmt.Fprintf(os.Stderr, "🔑 Serving the JWKS of %s on %s; run the API with:\n\n", *keyFile, idp.JWKSURL())
+		fmt.Fprintf(os.Stderr, "AZURE_TENANT_ID=%s\nAZURE_CLIENT_ID=%s\nAUTH_JWKS_URL=%s\nAUTH_ISSUER=%s\n\n", idp.TenantID, idp.ClientID, idp.JWKSURL(), idp.Issuer())
+		log.Fatal(http.ListenAndServe(*addr, idp.Handler()))
+	}
+
+	if *email == "" {
+		*email = strings.ToLower(strings.Join(strings.Fields(*name), ".")) + "@example.com"
+	}
+	claims := testidp.Claims{
+		"oid":                *oid,
+		"name":               *name,
+		"email":              *email,
+		"preferred_username": *email,
+		"exp":                time.Now().Add(*exp).Unix(),
+	}
+	if list := splitList(*roles); len(list) > 0 {
+		claims["roles"] = list
+	}
+	if list := splitList(*groups); len(list) > 0 {
+		claims["groups"] = list
+	}
+	fmt.Println(idp.Token(claims))
+}
+
+// defaultKeyFile returns the key file in the user config directory, or the working directory
+func defaultKeyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "devtoken.pem"
+	}
+	dir = filepath.Join(dir, "api-service")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "devtoken.pem"
+	}
+	return filepath.Join(dir, "devtoken.pem")
+}
+
+// splitList splits a comma-separated flag, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -33,6 +33,8 @@ fi
 # Get required outputs
 AZURE_CLIENT_ID=$(terraform output -raw azure_ad_application_id 2>/dev/null || echo "")
 AZURE_TENANT_ID=$(terraform output -raw azure_ad_tenant_id 2>/dev/null || echo "")
+# The UI reaches the API through the Application Gateway, which rewrites the Host header
+APPLICATION_URL=$(terraform output -raw application_url 2>/dev/null || echo "")
 
 cd ../../services/api
 
@@ -59,6 +61,7 @@ cat > .env << EOF
 
 # Server Configuration
 PORT=8080
+ENVIRONMENT=$ENVIRONMENT
 
 # Azure AD Authentication
 AZURE_TENANT_ID=$AZURE_TENANT_ID
@@ -66,13 +69,23 @@ AZURE_CLIENT_ID=$AZURE_CLIENT_ID
 
 # Development Only - DO NOT SET TO true IN PRODUCTION
 SKIP_TOKEN_VERIFICATION=false
+
+# Origins allowed by CORS and WebSocket Origin validation
+ALLOWED_ORIGINS=$APPLICATION_URL
+
+# Proxies whose X-Forwarded-For identifies clients: the Container Apps and Application Gateway
+# subnets (infra/core/network.tf)
+TRUSTED_PROXIES=10.0.0.0/23,10.0.5.0/24
 EOF
 
 echo "✅ .env file generated successfully!"
 echo ""
 echo "📄 Generated values:"
 echo "   PORT=8080"
+echo "   ENVIRONMENT=$ENVIRONMENT"
 echo "   AZURE_TENANT_ID=$AZURE_TENANT_ID"
 echo "   AZURE_CLIENT_ID=$AZURE_CLIENT_ID"
 echo "   SKIP_TOKEN_VERIFICATION=false"
+echo "   ALLOWED_ORIGINS=$APPLICATION_URL"
+echo "   TRUSTED_PROXIES=10.0.0.0/23,10.0.5.0/24"
 echo ""
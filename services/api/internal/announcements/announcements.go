@@ -0,0 +1,471 @@
+// Package announcements broadcasts system announcements from admins to connected clients,
+// optionally only a tenant's or a room's. Announcements can be scheduled and stay active
+// until they expire, so clients connecting later still receive them.
+package announcements
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/blob"
+	"api-service/internal/events"
+	"api-service/internal/locks"
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// Announcement levels
+const (
+	LevelInfo     = "info"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// MaxDuration bounds how long an announcement stays active
+const MaxDuration = 30 * 24 * time.Hour
+
+// DefaultDuration is how long an announcement stays active when no expiry is given
+const DefaultDuration = 24 * time.Hour
+
+// blobName is the blob announcements are persisted to, in the announcements container
+const blobName = "announcements.json"
+
+// maxBlobBytes bounds the persisted announcements
+const maxBlobBytes = 4 << 20
+
+// lockName is the lock serializing changes to the persisted announcements across replicas
+const lockName = "announcements"
+
+var (
+	ErrAnnouncementNotFound = errors.New("announcement not found")
+	ErrInvalidAnnouncement  = errors.New("invalid announcement")
+)
+
+// Announcement is a message from admins shown to connected users between StartsAt and
+// ExpiresAt. TenantID and RoomID restrict who sees it; both empty addresses everyone.
+type Announcement struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	Level     string    `json:"level"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	RoomID    string    `json:"roomId,omitempty"`
+	StartsAt  time.Time `json:"startsAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Active reports whether the announcement is shown at the given time
+func (a *Announcement) Active(now time.Time) bool {
+	return !now.Before(a.StartsAt) && now.Before(a.ExpiresAt)
+}
+
+// Service holds the scheduled and active announcements and delivers them to the clients
+// connected to this replica. With a container URL, announcements are persisted to Blob
+// Storage and reloaded periodically, so every replica delivers them and they survive restarts.
+type Service struct {
+	manager      *events.Manager
+	rooms        store.RoomStore
+	locker       locks.Locker
+	containerURL string
+	audit        audit.Log
+
+	mu        sync.Mutex
+	items     map[string]*Announcement // ID -> announcement
+	delivered map[string]bool          // IDs delivered to this replica's clients
+}
+
+// NewService creates an announcements service; containerURL (a container SAS URL) may be
+// empty, keeping announcements in memory on this replica only
+func NewService(manager *events.Manager, rooms store.RoomStore, locker locks.Locker, containerURL string, auditLog audit.Log) *Service {
+	return &Service{
+		manager:      manager,
+		rooms:        rooms,
+		locker:       locker,
+		containerURL: containerURL,
+		audit:        auditLog,
+		items:        make(map[string]*Announcement),
+		delivered:    make(map[string]bool),
+	}
+}
+
+// Create validates and schedules an announcement, delivering it right away when it's
+// already active
+func (s *Service) Create(ctx context.Context, admin *models.User, a *Announcement) (*Announcement, error) {
+	now := time.Now().UTC()
+	created := *a
+	created.ID = newAnnouncementID()
+	created.Message = strings.TrimSpace(created.Message)
+	created.CreatedBy = admin.ID
+	created.CreatedAt = now
+	if created.Level == "" {
+		created.Level = LevelInfo
+	}
+	if created.StartsAt.IsZero() || created.StartsAt.Before(now) {
+		created.StartsAt = now
+	}
+	if created.ExpiresAt.IsZero() {
+		created.ExpiresAt = created.StartsAt.Add(DefaultDuration)
+	}
+	created.StartsAt = created.StartsAt.UTC()
+	created.ExpiresAt = created.ExpiresAt.UTC()
+	if !created.ExpiresAt.After(created.StartsAt) {
+		return nil, fmt.Errorf("%w: expiresAt must be after startsAt", ErrInvalidAnnouncement)
+	}
+	if created.ExpiresAt.Sub(created.StartsAt) > MaxDuration {
+		return nil, fmt.Errorf("%w: announcements can be active for at most %s", ErrInvalidAnnouncement, MaxDuration)
+	}
+
+	if err := s.change(ctx, func(items map[string]*Announcement) error {
+		items[created.ID] = &created
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(audit.Record{
+		Action:   "broadcast.create",
+		Actor:    admin.ID,
+		TenantID: admin.TenantID,
+		Target:   created.ID,
+		Outcome:  "success",
+		Details:  map[string]interface{}{"tenantId": created.TenantID, "roomId": created.RoomID, "startsAt": created.StartsAt, "expiresAt": created.ExpiresAt},
+	})
+	s.deliverDue(ctx)
+	result := created
+	return &result, nil
+}
+
+// Cancel withdraws a scheduled or active announcement; clients that were shown it get a
+// system_announcement_withdrawn event
+func (s *Service) Cancel(ctx context.Context, admin *models.User, id string) error {
+	var cancelled *Announcement
+	if err := s.change(ctx, func(items map[string]*Announcement) error {
+		if cancelled = items[id]; cancelled == nil {
+			return ErrAnnouncementNotFound
+		}
+		delete(items, id)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	s.audit.Record(audit.Record{
+		Action:   "broadcast.cancel",
+		Actor:    admin.ID,
+		TenantID: admin.TenantID,
+		Target:   id,
+		Outcome:  "success",
+	})
+	s.withdraw(ctx, cancelled)
+	return nil
+}
+
+// List returns the scheduled and active announcements, soonest to start first
+func (s *Service) List() []Announcement {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []Announcement{}
+	for _, a := range s.items {
+		if now.Before(a.ExpiresAt) {
+			list = append(list, *a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartsAt.Before(list[j].StartsAt) })
+	return list
+}
+
+// ActiveFor returns the active announcements addressed to a user
+func (s *Service) ActiveFor(ctx context.Context, user *models.User) ([]Announcement, error) {
+	now := time.Now()
+	var active []Announcement
+	for _, a := range s.List() {
+		if a.Active(now) {
+			active = append(active, a)
+		}
+	}
+
+	rooms, err := s.userRooms(ctx, user.ID, active)
+	if err != nil {
+		return nil, err
+	}
+	matching := []Announcement{}
+	for _, a := range active {
+		if addressed(&a, user.TenantID, rooms) {
+			matching = append(matching, a)
+		}
+	}
+	return matching, nil
+}
+
+// HandleConnect sends a newly connected client the active announcements addressed to it
+func (s *Service) HandleConnect(client *events.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	active, err := s.ActiveFor(ctx, &models.User{ID: client.ID, TenantID: client.TenantID})
+	if err != nil {
+		log.Printf("⚠️  Failed to look up announcements for %s: %v", client.ID, err)
+		return
+	}
+	for i := range active {
+		s.manager.SendEventToUser(client.ID, announcementEvent(&active[i]))
+	}
+}
+
+// Run reloads persisted announcements and delivers those that become active every interval,
+// until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if s.containerURL != "" {
+			if err := s.reload(ctx); err != nil {
+				log.Printf("⚠️  Failed to reload announcements: %v", err)
+			}
+		}
+		s.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Load reads the persisted announcements, at startup
+func (s *Service) Load(ctx context.Context) error {
+	if s.containerURL == "" {
+		return nil
+	}
+	return s.reload(ctx)
+}
+
+// reload replaces the announcements with the persisted ones. Announcements this replica
+// delivered that were cancelled elsewhere are withdrawn.
+func (s *Service) reload(ctx context.Context) error {
+	items, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	var withdrawn []*Announcement
+	for id, a := range s.items {
+		if _, ok := items[id]; !ok && s.delivered[id] {
+			withdrawn = append(withdrawn, a)
+		}
+	}
+	s.items = items
+	s.mu.Unlock()
+
+	for _, a := range withdrawn {
+		s.withdraw(ctx, a)
+	}
+	return nil
+}
+
+// change applies a change to the announcements and persists them. With a container, the
+// change is made to the latest persisted announcements while holding the announcements lock.
+func (s *Service) change(ctx context.Context, apply func(items map[string]*Announcement) error) error {
+	if s.containerURL == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return apply(s.items)
+	}
+
+	lock, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(context.Background()); err != nil {
+			log.Printf("⚠️  Failed to release the announcements lock: %v", err)
+		}
+	}()
+
+	items, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+	if err := apply(items); err != nil {
+		return err
+	}
+	if err := s.write(ctx, items); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.items = items
+	s.mu.Unlock()
+	return nil
+}
+
+// acquire takes the announcements lock, waiting a few seconds for another replica to
+// release it
+func (s *Service) acquire(ctx context.Context) (locks.Lock, error) {
+	for attempt := 0; attempt < 20; attempt++ {
+		lock, err := s.locker.TryAcquire(ctx, lockName, 15*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if lock != nil {
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	return nil, fmt.Errorf("announcements are being changed by another replica")
+}
+
+// read loads the persisted announcements, dropping expired ones
+func (s *Service) read(ctx context.Context) (map[string]*Announcement, error) {
+	data, err := blob.DownloadBlob(ctx, s.containerURL, blobName, maxBlobBytes)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Announcement
+	if data != nil {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("decoding announcements: %w", err)
+		}
+	}
+
+	now := time.Now()
+	items := make(map[string]*Announcement, len(list))
+	for _, a := range list {
+		if now.Before(a.ExpiresAt) {
+			items[a.ID] = a
+		}
+	}
+	return items, nil
+}
+
+// write persists the announcements
+func (s *Service) write(ctx context.Context, items map[string]*Announcement) error {
+	list := make([]*Announcement, 0, len(items))
+	for _, a := range items {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartsAt.Before(list[j].StartsAt) })
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return blob.UploadBlockBlob(ctx, s.containerURL, blobName, "application/json", data)
+}
+
+// deliverDue delivers the announcements that became active since they were last checked to
+// this replica's clients, and forgets expired ones
+func (s *Service) deliverDue(ctx context.Context) {
+	now := time.Now()
+	var due []*Announcement
+	s.mu.Lock()
+	for id, a := range s.items {
+		switch {
+		case !now.Before(a.ExpiresAt):
+			delete(s.items, id)
+			delete(s.delivered, id)
+		case a.Active(now) && !s.delivered[id]:
+			s.delivered[id] = true
+			due = append(due, a)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, a := range due {
+		delivered := s.send(ctx, a, announcementEvent(a))
+		log.Printf("📣 Announcement %s delivered to %d connected users", a.ID, delivered)
+	}
+}
+
+// withdraw tells the clients shown an announcement that it was cancelled
+func (s *Service) withdraw(ctx context.Context, a *Announcement) {
+	s.mu.Lock()
+	delivered := s.delivered[a.ID]
+	delete(s.delivered, a.ID)
+	s.mu.Unlock()
+	if delivered {
+		s.send(ctx, a, events.NewAnnouncementWithdrawnEvent(a.ID))
+	}
+}
+
+// send delivers an event about an announcement to the connected clients it is addressed to,
+// returning how many received it
+func (s *Service) send(ctx context.Context, a *Announcement, event *events.Event) int {
+	var userIDs []string
+	if a.RoomID != "" {
+		members, err := s.rooms.Members(ctx, a.RoomID)
+		if err != nil {
+			log.Printf("⚠️  Failed to look up the members of room %s for announcement %s: %v", a.RoomID, a.ID, err)
+			return 0
+		}
+		for _, member := range members {
+			userIDs = append(userIDs, member.UserID)
+		}
+	} else {
+		for _, session := range s.manager.Sessions() {
+			if a.TenantID == "" || strings.EqualFold(session.TenantID, a.TenantID) {
+				userIDs = append(userIDs, session.UserID)
+			}
+		}
+	}
+	return s.manager.SendEventToUsers(userIDs, event)
+}
+
+// userRooms returns the IDs of the rooms a user joined, when any of the announcements is
+// addressed to a room
+func (s *Service) userRooms(ctx context.Context, userID string, active []Announcement) (map[string]bool, error) {
+	rooms := map[string]bool{}
+	for _, a := range active {
+		if a.RoomID == "" {
+			continue
+		}
+		joined, err := s.rooms.UserRooms(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, room := range joined {
+			rooms[room.ID] = true
+		}
+		break
+	}
+	return rooms, nil
+}
+
+// addressed reports whether an announcement is addressed to a user of the tenant who joined
+// the given rooms
+func addressed(a *Announcement, tenantID string, rooms map[string]bool) bool {
+	if a.TenantID != "" && !strings.EqualFold(a.TenantID, tenantID) {
+		return false
+	}
+	return a.RoomID == "" || rooms[a.RoomID]
+}
+
+// announcementEvent is the system_announcement event delivering an announcement
+func announcementEvent(a *Announcement) *events.Event {
+	return events.NewAnnouncementEvent(a.ID, a.Message, a.Level, a.RoomID, a.StartsAt, a.ExpiresAt)
+}
+
+// newAnnouncementID returns a random 64-bit hex announcement ID
+func newAnnouncementID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,448 @@
+// Package appconfig reads settings and feature flags from Azure App Configuration and
+// refreshes them when a sentinel key changes, so a fleet picks up changes without a redeploy
+package appconfig
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/features"
+	"api-service/internal/identity"
+)
+
+// appConfigResource is the token audience for App Configuration
+const appConfigResource = "https://azconfig.io"
+
+// apiVersion is the App Configuration REST API version used
+const apiVersion = "1.0"
+
+// featureFlagPrefix prefixes the keys of feature flags
+const featureFlagPrefix = ".appconfig.featureflag/"
+
+// nullLabel selects key-values without a label
+const nullLabel = "\x00"
+
+// keyVaultRefContentType is the content type of key-values referencing a Key Vault secret
+const keyVaultRefContentType = "application/vnd.microsoft.appconfig.keyvaultref+json"
+
+// keyVaultResource is the token audience for Key Vault
+const keyVaultResource = "https://vault.azure.net"
+
+// keyVaultAPIVersion is the Key Vault REST API version used
+const keyVaultAPIVersion = "7.4"
+
+// Config configures the store
+type Config struct {
+	Endpoint         string        // Store endpoint, e.g. https://<store>.azconfig.io
+	ConnectionString string        // Access key connection string; the managed identity is used when empty
+	Label            string        // Key-values with this label override unlabeled ones (e.g. the environment)
+	KeyPrefix        string        // Only keys with this prefix are read, without it (e.g. "api-service:")
+	SentinelKey      string        // Key whose change reloads every setting and feature flag
+	RefreshInterval  time.Duration // How often the sentinel key is checked
+}
+
+// Snapshot is the settings and feature flags read at one point in time
+type Snapshot struct {
+	Settings map[string]string // Key (without KeyPrefix) -> value
+	Secrets  map[string]string // Key -> URI of the Key Vault secret its value was resolved from
+	Features []features.Flag
+}
+
+// ChangeFunc is called with the previous and current snapshot after a refresh changed them
+type ChangeFunc func(previous, current Snapshot)
+
+// Store reads an App Configuration store and keeps the latest snapshot of it
+type Store struct {
+	cfg      Config
+	endpoint string
+	keyID    string // Access key credential; empty when the managed identity is used
+	secret   []byte
+	identity *identity.ManagedIdentity
+	client   *http.Client
+
+	mu        sync.RWMutex
+	snapshot  Snapshot
+	sentinel  string // ETags of the sentinel key, to detect changes
+	listeners []ChangeFunc
+}
+
+// keyValue is a key-value as listed by the REST API
+type keyValue struct {
+	Key         string `json:"key"`
+	Label       string `json:"label"`
+	Value       string `json:"value"`
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+// keyVaultRef is the value of a Key Vault reference key-value
+type keyVaultRef struct {
+	URI string `json:"uri"` // https://<vault>.vault.azure.net/secrets/<name>[/<version>]
+}
+
+// featureFlag is the value of a feature flag key-value
+type featureFlag struct {
+	ID         string `json:"id"`
+	Enabled    bool   `json:"enabled"`
+	Conditions struct {
+		ClientFilters []clientFilter `json:"client_filters"`
+	} `json:"conditions"`
+}
+
+// clientFilter is a feature flag filter; a flag with filters is on for the users any of them
+// lets through
+type clientFilter struct {
+	Name       string `json:"name"`
+	Parameters struct {
+		Value float64 `json:"Value"` // Microsoft.Percentage
+		// Microsoft.Targeting
+		Audience struct {
+			Users  []string `json:"Users"`
+			Groups []struct {
+				Name              string  `json:"Name"`
+				RolloutPercentage float64 `json:"RolloutPercentage"`
+			} `json:"Groups"`
+			DefaultRolloutPercentage float64 `json:"DefaultRolloutPercentage"`
+			Exclusion                struct {
+				Users  []string `json:"Users"`
+				Groups []string `json:"Groups"`
+			} `json:"Exclusion"`
+		} `json:"Audience"`
+	} `json:"parameters"`
+}
+
+// flag converts a feature flag to the features package's. Percentage and targeting filters are
+// supported; others (e.g. time windows) never let users through, so a flag that only has
+// those is off.
+func (ff featureFlag) flag() features.Flag {
+	flag := features.Flag{Name: ff.ID, Enabled: ff.Enabled}
+	if len(ff.Conditions.ClientFilters) == 0 {
+		flag.Rollout = 100
+		return flag
+	}
+	for _, filter := range ff.Conditions.ClientFilters {
+		switch filter.Name {
+		case "Microsoft.Percentage", "Percentage", "PercentageFilter":
+			flag.Rollout = max(flag.Rollout, filter.Parameters.Value)
+		case "Microsoft.Targeting", "Targeting", "TargetingFilter":
+			audience := filter.Parameters.Audience
+			flag.Rollout = max(flag.Rollout, audience.DefaultRolloutPercentage)
+			flag.Users = append(flag.Users, audience.Users...)
+			for _, group := range audience.Groups {
+				flag.Groups = append(flag.Groups, features.Group{Name: group.Name, Rollout: group.RolloutPercentage})
+			}
+			flag.ExcludedUsers = append(flag.ExcludedUsers, audience.Exclusion.Users...)
+			flag.ExcludedGroups = append(flag.ExcludedGroups, audience.Exclusion.Groups...)
+		default:
+			log.Printf("⚠️  Feature flag %s: unsupported filter %s never matches", ff.ID, filter.Name)
+		}
+	}
+	return flag
+}
+
+// New creates a store client; mi is used when cfg has no connection string
+func New(cfg Config, mi *identity.ManagedIdentity) (*Store, error) {
+	s := &Store{
+		cfg:      cfg,
+		endpoint: cfg.Endpoint,
+		identity: mi,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if cfg.ConnectionString != "" {
+		for _, part := range strings.Split(cfg.ConnectionString, ";") {
+			name, value, _ := strings.Cut(part, "=")
+			switch strings.ToLower(name) {
+			case "endpoint":
+				s.endpoint = value
+			case "id":
+				s.keyID = value
+			case "secret":
+				secret, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid App Configuration connection string secret: %w", err)
+				}
+				s.secret = secret
+			}
+		}
+		if s.keyID == "" || s.secret == nil {
+			return nil, fmt.Errorf("App Configuration connection string must have an Id and a Secret")
+		}
+	}
+	if s.endpoint == "" {
+		return nil, fmt.Errorf("an App Configuration endpoint is required")
+	}
+	if !strings.Contains(s.endpoint, "://") {
+		s.endpoint = "https://" + s.endpoint
+	}
+	if _, err := url.Parse(s.endpoint); err != nil {
+		return nil, fmt.Errorf("invalid App Configuration endpoint %q: %w", s.endpoint, err)
+	}
+	s.endpoint = strings.TrimSuffix(s.endpoint, "/")
+	if s.keyID == "" && mi == nil {
+		return nil, fmt.Errorf("an App Configuration connection string or managed identity is required")
+	}
+	return s, nil
+}
+
+// Load reads every setting and feature flag, replacing the current snapshot
+func (s *Store) Load(ctx context.Context) (Snapshot, error) {
+	sentinel, err := s.sentinelETags(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot, err := s.read(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	s.mu.Lock()
+	s.snapshot = snapshot
+	s.sentinel = sentinel
+	s.mu.Unlock()
+	return snapshot, nil
+}
+
+// Snapshot returns the latest settings and feature flags
+func (s *Store) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshot
+}
+
+// OnChange registers fn to be called after a refresh changed the snapshot (call before Run)
+func (s *Store) OnChange(fn ChangeFunc) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// Run checks the sentinel key every RefreshInterval until ctx is cancelled, reloading the
+// store and notifying listeners when its ETag changed. Failed checks keep the current
+// snapshot and are retried at the next interval.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️  App Configuration refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// refresh reloads the store when the sentinel key changed
+func (s *Store) refresh(ctx context.Context) error {
+	sentinel, err := s.sentinelETags(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	unchanged := sentinel == s.sentinel
+	previous := s.snapshot
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	current, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.snapshot = current
+	s.sentinel = sentinel
+	s.mu.Unlock()
+
+	log.Printf("🔄 App Configuration refreshed: %d settings, %d feature flags", len(current.Settings), len(current.Features))
+	for _, fn := range s.listeners {
+		fn(previous, current)
+	}
+	return nil
+}
+
+// read lists the settings and feature flags, unlabeled ones first so that those with the
+// configured label override them. Key Vault references are resolved to their secret's value.
+func (s *Store) read(ctx context.Context) (Snapshot, error) {
+	snapshot := Snapshot{Settings: make(map[string]string), Secrets: make(map[string]string)}
+
+	settings, err := s.list(ctx, s.cfg.KeyPrefix+"*")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, kv := range settings {
+		if strings.HasPrefix(kv.Key, featureFlagPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(kv.Key, s.cfg.KeyPrefix)
+		if !strings.HasPrefix(kv.ContentType, keyVaultRefContentType) {
+			snapshot.Settings[key] = kv.Value
+			delete(snapshot.Secrets, key)
+			continue
+		}
+		var ref keyVaultRef
+		if err := json.Unmarshal([]byte(kv.Value), &ref); err != nil || ref.URI == "" {
+			return Snapshot{}, fmt.Errorf("invalid Key Vault reference %s", kv.Key)
+		}
+		value, err := s.keyVaultSecret(ctx, ref.URI)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("resolving Key Vault reference %s: %w", kv.Key, err)
+		}
+		snapshot.Settings[key] = value
+		snapshot.Secrets[key] = ref.URI
+	}
+
+	flags, err := s.list(ctx, featureFlagPrefix+"*")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, kv := range flags {
+		var flag featureFlag
+		if err := json.Unmarshal([]byte(kv.Value), &flag); err != nil {
+			log.Printf("⚠️  Ignoring App Configuration feature flag %s: %v", kv.Key, err)
+			continue
+		}
+		if flag.ID == "" {
+			flag.ID = strings.TrimPrefix(kv.Key, featureFlagPrefix)
+		}
+		snapshot.Features = append(snapshot.Features, flag.flag())
+	}
+	return snapshot, nil
+}
+
+// sentinelETags returns the ETags of the sentinel key's unlabeled and labeled values, which
+// change whenever either is updated
+func (s *Store) sentinelETags(ctx context.Context) (string, error) {
+	if s.cfg.SentinelKey == "" {
+		return "", nil
+	}
+	kvs, err := s.list(ctx, s.cfg.SentinelKey)
+	if err != nil {
+		return "", err
+	}
+	etags := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		etags = append(etags, kv.Label+"="+kv.ETag)
+	}
+	return strings.Join(etags, ","), nil
+}
+
+// list returns the key-values matching the key filter, unlabeled ones before those with the
+// configured label
+func (s *Store) list(ctx context.Context, keyFilter string) ([]keyValue, error) {
+	labels := nullLabel
+	if s.cfg.Label != "" {
+		labels += "," + s.cfg.Label
+	}
+	query := url.Values{"key": {keyFilter}, "label": {labels}, "api-version": {apiVersion}}
+	next := "/kv?" + query.Encode()
+
+	var kvs []keyValue
+	for next != "" {
+		var page struct {
+			Items    []keyValue `json:"items"`
+			NextLink string     `json:"@nextLink"`
+		}
+		if err := s.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, page.Items...)
+		next = page.NextLink
+	}
+
+	sort.SliceStable(kvs, func(i, j int) bool { return kvs[i].Label == "" && kvs[j].Label != "" })
+	return kvs, nil
+}
+
+// get sends an authenticated GET request for pathAndQuery and decodes the JSON response
+func (s *Store) get(ctx context.Context, pathAndQuery string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+pathAndQuery, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.microsoft.appconfig.kvset+json, application/problem+json")
+	if s.keyID != "" {
+		s.sign(req)
+	} else {
+		token, err := s.identity.Token(ctx, appConfigResource)
+		if err != nil {
+			return fmt.Errorf("acquiring App Configuration token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("App Configuration returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding App Configuration response: %w", err)
+	}
+	return nil
+}
+
+// keyVaultSecret reads the value of a Key Vault secret with the managed identity (Key Vault Secrets
+// User role), whichever credential the store uses
+func (s *Store) keyVaultSecret(ctx context.Context, uri string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri+"?api-version="+keyVaultAPIVersion, nil)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.identity.Token(ctx, keyVaultResource)
+	if err != nil {
+		return "", fmt.Errorf("acquiring Key Vault token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("Key Vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	var secret struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("decoding Key Vault response: %w", err)
+	}
+	return secret.Value, nil
+}
+
+// sign authenticates a bodiless request with the access key (HMAC-SHA256)
+func (s *Store) sign(req *http.Request) {
+	date := time.Now().UTC().Format(http.TimeFormat)
+	emptyHash := sha256.Sum256(nil)
+	contentHash := base64.StdEncoding.EncodeToString(emptyHash[:])
+
+	stringToSign := req.Method + "\n" + req.URL.RequestURI() + "\n" + date + ";" + req.URL.Host + ";" + contentHash
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("x-ms-content-sha256", contentHash)
+	req.Header.Set("Authorization", "HMAC-SHA256 Credential="+s.keyID+"&SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature="+signature)
+}
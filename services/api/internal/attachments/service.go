@@ -0,0 +1,389 @@
+// Package attachments lets users share files in conversations without the bytes flowing
+// through the API: clients upload straight to Blob Storage with a short-lived SAS URL, then
+// complete the upload, which validates the blob and attaches it to a message
+package attachments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"api-service/internal/blob"
+	"api-service/internal/chat"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/store"
+)
+
+var (
+	ErrUploadNotFound     = errors.New("no upload with this attachment ID")
+	ErrTooLarge           = errors.New("file is larger than allowed")
+	ErrUnsupportedType    = errors.New("file content type is not allowed")
+	ErrAttachmentInUse    = errors.New("upload is already attached to another message")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+)
+
+// messageIDMetadata is the blob metadata key recording the message an upload is attached to
+const messageIDMetadata = "messageid"
+
+// fileNameMetadata is the blob metadata key holding the uploaded file's URL-escaped name
+const fileNameMetadata = "filename"
+
+// uploadSuffix ends the names of blobs clients upload to. Completing an upload copies it to
+// the attachment's blob, which no upload URL can write.
+const uploadSuffix = ".upload"
+
+// blobOperationTTL is the lifetime of the SAS the service itself uses to inspect and delete blobs
+const blobOperationTTL = 5 * time.Minute
+
+// Config configures attachments
+type Config struct {
+	Container    string        // Blob container holding uploads
+	MaxBytes     int64         // Largest file accepted
+	ContentTypes []string      // Accepted content types; "type/*" accepts a whole type
+	UploadTTL    time.Duration // Lifetime of upload URLs
+	DownloadTTL  time.Duration // Lifetime of download URLs
+
+	ThumbnailSizes     []int  // Longest edges of the thumbnails made of images, smallest first; none disables them
+	ThumbnailContainer string // Blob container holding thumbnails, which must allow anonymous blob reads
+	ThumbnailWorkers   int    // Images scaled at once
+}
+
+// Upload is a pending upload: the client PUTs the file to URL with Headers, then completes it
+type Upload struct {
+	AttachmentID string            `json:"attachmentId"`
+	URL          string            `json:"uploadUrl"`
+	Headers      map[string]string `json:"uploadHeaders"` // Headers the upload request must send
+	ExpiresAt    time.Time         `json:"expiresAt"`
+	MaxBytes     int64             `json:"maxBytes"`
+}
+
+// Download is a short-lived URL to read an attachment
+type Download struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Service issues upload and download URLs and attaches completed uploads to messages
+type Service struct {
+	signer     *blob.Signer
+	chat       *chat.Service
+	cfg        Config
+	thumbnails chan thumbnailJob     // Image attachments waiting for thumbnails
+	moderator  *moderation.Moderator // Nil when images aren't screened
+}
+
+// NewService creates an attachments service and registers it with the chat service, so
+// deleting a message deletes its attachments' blobs
+func NewService(signer *blob.Signer, chatService *chat.Service, cfg Config) *Service {
+	s := &Service{
+		signer:     signer,
+		chat:       chatService,
+		cfg:        cfg,
+		thumbnails: make(chan thumbnailJob, thumbnailQueueSize),
+	}
+	chatService.SetAttachmentBlobs(s)
+	return s
+}
+
+// SetModerator screens images before they are attached, when the moderator has filters that
+// screen images
+func (s *Service) SetModerator(moderator *moderation.Moderator) {
+	if moderator.ScreensImages() {
+		s.moderator = moderator
+	}
+}
+
+// Config returns the attachment limits
+func (s *Service) Config() Config {
+	return s.cfg
+}
+
+// Initiate checks a file the user wants to upload against the limits and returns an upload
+// URL for it. size and contentType are checked again against the blob when it's completed.
+func (s *Service) Initiate(ctx context.Context, user *models.User, fileName, contentType string, size int64) (*Upload, error) {
+	if size > s.cfg.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	if !s.Allowed(contentType) {
+		return nil, ErrUnsupportedType
+	}
+
+	id := newAttachmentID()
+	expiresAt := time.Now().UTC().Add(s.cfg.UploadTTL)
+	uploadURL, err := s.signer.BlobURL(ctx, s.cfg.Container, blobName(user.TenantID, user.ID, id)+uploadSuffix, blob.SASOptions{
+		Permissions: blob.PermissionCreate + blob.PermissionWrite,
+		Expiry:      expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Upload{
+		AttachmentID: id,
+		URL:          uploadURL,
+		Headers: map[string]string{
+			"x-ms-blob-type":                "BlockBlob",
+			"x-ms-blob-content-type":        contentType,
+			"x-ms-meta-" + fileNameMetadata: url.PathEscape(fileName),
+		},
+		ExpiresAt: expiresAt,
+		MaxBytes:  s.cfg.MaxBytes,
+	}, nil
+}
+
+// Complete copies the blob the user uploaded for attachmentID to the attachment's own blob,
+// out of reach of the upload URL, validates the copy and attaches it to one of their messages,
+// returning the updated message. Blobs that are too large or of a type that isn't allowed are
+// deleted. Thumbnails of images are made in the background once Run is running, and arrive in
+// an attachment_updated event.
+func (s *Service) Complete(ctx context.Context, user *models.User, messageID, attachmentID string) (*store.Message, error) {
+	if !validAttachmentID(attachmentID) {
+		return nil, ErrUploadNotFound
+	}
+	attachable, err := s.chat.Attachable(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+	containerURL, err := s.containerURL(ctx, s.cfg.Container)
+	if err != nil {
+		return nil, err
+	}
+	name := blobName(user.TenantID, user.ID, attachmentID)
+	props, err := s.commit(ctx, containerURL, name)
+	if err != nil {
+		return nil, err
+	}
+	if props == nil {
+		return nil, ErrUploadNotFound
+	}
+
+	contentType, _, _ := strings.Cut(props.ContentType, ";")
+	switch {
+	case props.ContentLength > s.cfg.MaxBytes:
+		err = ErrTooLarge
+	case !s.Allowed(contentType):
+		err = ErrUnsupportedType
+	}
+	if err != nil {
+		if deleteErr := blob.DeleteBlob(ctx, containerURL, name); deleteErr != nil {
+			log.Printf("⚠️  Failed to delete rejected upload %s: %v", name, deleteErr)
+		}
+		return nil, err
+	}
+
+	decision, err := s.screen(ctx, user, attachable, attachmentID, contentType, containerURL, name, props.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the blob for the message, so it can't also be attached to another one and deleted
+	// from under it when that one is deleted. The claim fails if another completion claimed it
+	// since it was read.
+	if claimed := props.Metadata[messageIDMetadata]; claimed != "" && claimed != messageID {
+		return nil, ErrAttachmentInUse
+	}
+	props.Metadata[messageIDMetadata] = messageID
+	if err := blob.SetMetadataIfMatch(ctx, containerURL, name, props.ETag, props.Metadata); err != nil {
+		if errors.Is(err, blob.ErrConditionNotMet) {
+			return nil, ErrAttachmentInUse
+		}
+		return nil, err
+	}
+
+	fileName, err := url.PathUnescape(props.Metadata[fileNameMetadata])
+	if err != nil || strings.TrimSpace(fileName) == "" {
+		fileName = attachmentID
+	}
+	msg, err := s.chat.Attach(ctx, user, messageID, &store.Attachment{
+		ID:          attachmentID,
+		FileName:    fileName,
+		ContentType: strings.TrimSpace(contentType),
+		Size:        props.ContentLength,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range msg.Attachments {
+		if attachment.ID == attachmentID {
+			s.enqueueThumbnails(msg, attachment)
+		}
+	}
+	if decision != nil {
+		s.moderator.Delivered(decision, messageID)
+	}
+	return msg, nil
+}
+
+// commit copies an upload to the attachment's blob name and deletes the upload, so the upload
+// URL, which stays valid until it expires, can't change the file once it's been validated.
+// It returns the properties of the attachment's blob, or nil if nothing was uploaded. Uploads
+// completed before are already committed.
+func (s *Service) commit(ctx context.Context, containerURL, name string) (*blob.Properties, error) {
+	props, err := blob.GetProperties(ctx, containerURL, name)
+	if err != nil || props != nil {
+		return props, err
+	}
+	upload, err := blob.GetProperties(ctx, containerURL, name+uploadSuffix)
+	if err != nil || upload == nil {
+		return nil, err
+	}
+	if upload.ContentLength > s.cfg.MaxBytes {
+		if deleteErr := blob.DeleteBlob(ctx, containerURL, name+uploadSuffix); deleteErr != nil {
+			log.Printf("⚠️  Failed to delete rejected upload %s: %v", name+uploadSuffix, deleteErr)
+		}
+		return nil, ErrTooLarge
+	}
+
+	// Only the file name is carried over; metadata the client set on the upload isn't trusted
+	metadata := make(map[string]string)
+	if fileName := upload.Metadata[fileNameMetadata]; fileName != "" {
+		metadata[fileNameMetadata] = fileName
+	}
+	_, err = blob.CopyBlob(ctx, containerURL, name+uploadSuffix, upload.ETag, name, metadata)
+	switch {
+	case errors.Is(err, blob.ErrConditionNotMet):
+		// Another completion committed it first, or the upload was rewritten since it was read
+	case err != nil:
+		return nil, err
+	default:
+		if err := blob.DeleteBlob(ctx, containerURL, name+uploadSuffix); err != nil {
+			log.Printf("⚠️  Failed to delete committed upload %s: %v", name+uploadSuffix, err)
+		}
+	}
+	return blob.GetProperties(ctx, containerURL, name)
+}
+
+// screen runs the moderator's image filters over an uploaded image, deleting it when it's
+// rejected. Images larger than moderation.MaxImageBytes and other files aren't screened, and
+// a nil decision is returned.
+func (s *Service) screen(ctx context.Context, user *models.User, msg *store.Message, attachmentID, contentType, containerURL, name string, size int64) (*moderation.Decision, error) {
+	if s.moderator == nil || !strings.HasPrefix(contentType, "image/") || size > moderation.MaxImageBytes {
+		return nil, nil
+	}
+	data, err := blob.DownloadBlob(ctx, containerURL, name, moderation.MaxImageBytes)
+	if err != nil {
+		return nil, err
+	}
+	decision, err := s.moderator.ScreenImage(ctx, &moderation.ImageRequest{
+		SenderID:       user.ID,
+		TenantID:       user.TenantID,
+		ConversationID: msg.ConversationID,
+		MessageID:      msg.ID,
+		AttachmentID:   attachmentID,
+		ContentType:    strings.TrimSpace(contentType),
+		Data:           data,
+	})
+	if err != nil {
+		if deleteErr := blob.DeleteBlob(ctx, containerURL, name); deleteErr != nil {
+			log.Printf("⚠️  Failed to delete rejected upload %s: %v", name, deleteErr)
+		}
+		return nil, err
+	}
+	return decision, nil
+}
+
+// Download returns a short-lived URL to read an attachment of a message the user can read
+func (s *Service) Download(ctx context.Context, user *models.User, messageID, attachmentID string) (*Download, error) {
+	msg, err := s.chat.Message(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range msg.Attachments {
+		if attachment.ID != attachmentID {
+			continue
+		}
+		expiresAt := time.Now().UTC().Add(s.cfg.DownloadTTL)
+		downloadURL, err := s.signer.BlobURL(ctx, s.cfg.Container, blobName(msg.TenantID, msg.SenderID, attachment.ID), blob.SASOptions{
+			Permissions:        blob.PermissionRead,
+			Expiry:             expiresAt,
+			ContentDisposition: mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Download{URL: downloadURL, ExpiresAt: expiresAt}, nil
+	}
+	return nil, ErrAttachmentNotFound
+}
+
+// DeleteBlobs deletes the blobs and thumbnails of a deleted message's attachments, logging
+// failures
+func (s *Service) DeleteBlobs(ctx context.Context, msg *store.Message, attachments []*store.Attachment) {
+	containerURL, err := s.containerURL(ctx, s.cfg.Container)
+	if err != nil {
+		log.Printf("⚠️  Failed to delete attachments of message %s: %v", msg.ID, err)
+		return
+	}
+	var thumbnails []string
+	for _, attachment := range attachments {
+		name := blobName(msg.TenantID, msg.SenderID, attachment.ID)
+		if err := blob.DeleteBlob(ctx, containerURL, name); err != nil {
+			log.Printf("⚠️  Failed to delete attachment %s: %v", name, err)
+		}
+		for _, thumbnail := range attachment.Thumbnails {
+			thumbnails = append(thumbnails, thumbnailBlobName(msg, attachment.ID, thumbnail.Size))
+		}
+	}
+	s.deleteThumbnails(ctx, thumbnails)
+}
+
+// Allowed reports whether files of the content type can be attached
+func (s *Service) Allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range s.cfg.ContentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// containerURL returns a short-lived container SAS URL for the service's own blob operations
+func (s *Service) containerURL(ctx context.Context, container string) (string, error) {
+	containerURL, err := s.signer.ContainerURL(ctx, container, blob.SASOptions{
+		Permissions: blob.PermissionRead + blob.PermissionWrite + blob.PermissionDelete + blob.PermissionList,
+		Expiry:      time.Now().Add(blobOperationTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("signing %s container URL: %w", container, err)
+	}
+	return containerURL, nil
+}
+
+// blobName returns the name of an attachment's blob; its upload is named with uploadSuffix
+// appended. Uploads are keyed by their uploader, so completing an upload can only attach the
+// caller's own files.
+func blobName(tenantID, userID, attachmentID string) string {
+	return tenantID + "/" + userID + "/" + attachmentID
+}
+
+// newAttachmentID returns a random 128-bit hex attachment ID
+func newAttachmentID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validAttachmentID reports whether id could have been returned by newAttachmentID
+func validAttachmentID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,70 @@
+package attachments
+
+import (
+	"context"
+	"fmt"
+
+	"api-service/internal/blob"
+)
+
+// TenantBlobs are the names of a tenant's blobs, by container
+type TenantBlobs map[string][]string
+
+// containers returns the containers holding the service's blobs
+func (s *Service) containers() []string {
+	if len(s.cfg.ThumbnailSizes) == 0 {
+		return []string{s.cfg.Container}
+	}
+	return []string{s.cfg.Container, s.cfg.ThumbnailContainer}
+}
+
+// ExportTenant lists the tenant's attachment and thumbnail blobs. Blob names start with the
+// tenant ID (see blobName), so the listing needs no message store.
+func (s *Service) ExportTenant(ctx context.Context, tenantID string) (TenantBlobs, error) {
+	blobs := make(TenantBlobs)
+	for _, container := range s.containers() {
+		containerURL, err := s.containerURL(ctx, container)
+		if err != nil {
+			return nil, err
+		}
+		names, err := blob.ListBlobs(ctx, containerURL, tenantID+"/")
+		if err != nil {
+			return nil, err
+		}
+		blobs[container] = append([]string{}, names...)
+	}
+	return blobs, nil
+}
+
+// PurgeTenant deletes the tenant's attachment and thumbnail blobs and returns how many were
+// deleted
+func (s *Service) PurgeTenant(ctx context.Context, tenantID string) (int, error) {
+	purged := 0
+	for _, container := range s.containers() {
+		containerURL, err := s.containerURL(ctx, container)
+		if err != nil {
+			return purged, err
+		}
+		names, err := blob.ListBlobs(ctx, containerURL, tenantID+"/")
+		if err != nil {
+			return purged, err
+		}
+		for _, name := range names {
+			if err := blob.DeleteBlob(ctx, containerURL, name); err != nil {
+				return purged, fmt.Errorf("deleting %s: %w", name, err)
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CountTenant counts the tenant's attachment and thumbnail blobs
+func (s *Service) CountTenant(ctx context.Context, tenantID string) (int, error) {
+	blobs, err := s.ExportTenant(ctx, tenantID)
+	count := 0
+	for _, names := range blobs {
+		count += len(names)
+	}
+	return count, err
+}
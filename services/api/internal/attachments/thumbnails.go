@@ -0,0 +1,269 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registers the decoders of the image types thumbnails are made for
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-service/internal/blob"
+	"api-service/internal/chat"
+	"api-service/internal/store"
+)
+
+// thumbnailQueueSize bounds the images waiting for thumbnails; more are skipped
+const thumbnailQueueSize = 100
+
+// maxThumbnailSourcePixels bounds the images decoded for thumbnails (about 160MB in memory),
+// so small files with huge dimensions can't exhaust memory
+const maxThumbnailSourcePixels = 40_000_000
+
+// thumbnailQuality is the JPEG quality of thumbnails
+const thumbnailQuality = 80
+
+// thumbnailTimeout bounds making and storing one attachment's thumbnails
+const thumbnailTimeout = 2 * time.Minute
+
+// thumbnailTypes are the image content types thumbnails are made for
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// thumbnailJob is an image attachment waiting for thumbnails
+type thumbnailJob struct {
+	msg        *store.Message
+	attachment *store.Attachment
+}
+
+// Run makes thumbnails of completed image attachments with ThumbnailWorkers workers until
+// ctx is cancelled. Without it, or without ThumbnailSizes, no thumbnails are made.
+func (s *Service) Run(ctx context.Context) {
+	if len(s.cfg.ThumbnailSizes) == 0 {
+		return
+	}
+	var workers sync.WaitGroup
+	for i := 0; i < s.cfg.ThumbnailWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.thumbnails:
+					s.makeThumbnails(ctx, job)
+				}
+			}
+		}()
+	}
+	workers.Wait()
+}
+
+// enqueueThumbnails queues an image attachment for thumbnails, skipping it when the queue is full
+func (s *Service) enqueueThumbnails(msg *store.Message, attachment *store.Attachment) {
+	if len(s.cfg.ThumbnailSizes) == 0 || !thumbnailTypes[attachment.ContentType] || len(attachment.Thumbnails) > 0 {
+		return
+	}
+	select {
+	case s.thumbnails <- thumbnailJob{msg: msg, attachment: attachment}:
+	default:
+		log.Printf("⚠️  Thumbnail queue full, skipping attachment %s", attachment.ID)
+	}
+}
+
+// makeThumbnails stores thumbnails of an image attachment in the thumbnail container and
+// records them on its message. Failures are logged; the attachment just has no thumbnails.
+func (s *Service) makeThumbnails(ctx context.Context, job thumbnailJob) {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+
+	thumbnails, names, err := s.storeThumbnails(ctx, job)
+	if err != nil {
+		log.Printf("⚠️  Failed to make thumbnails of attachment %s: %v", job.attachment.ID, err)
+	}
+	if len(thumbnails) == 0 {
+		return
+	}
+
+	_, err = s.chat.SetThumbnails(ctx, job.msg.ID, job.attachment.ID, thumbnails)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, chat.ErrMessageDeleted) && !errors.Is(err, chat.ErrMessageNotFound) && !errors.Is(err, store.ErrAttachmentNotFound) {
+		log.Printf("⚠️  Failed to record thumbnails of attachment %s: %v", job.attachment.ID, err)
+	}
+	// The message was deleted meanwhile, or the thumbnails couldn't be recorded
+	s.deleteThumbnails(ctx, names)
+}
+
+// storeThumbnails downloads an image attachment, scales it to each thumbnail size and uploads
+// the results, returning the thumbnails and blob names of those uploaded
+func (s *Service) storeThumbnails(ctx context.Context, job thumbnailJob) ([]*store.Thumbnail, []string, error) {
+	containerURL, err := s.containerURL(ctx, s.cfg.Container)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := blob.DownloadBlob(ctx, containerURL, blobName(job.msg.TenantID, job.msg.SenderID, job.attachment.ID), s.cfg.MaxBytes)
+	if err != nil || data == nil {
+		return nil, nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if config.Width*config.Height > maxThumbnailSourcePixels {
+		return nil, nil, fmt.Errorf("image is %dx%d, larger than %d pixels", config.Width, config.Height, maxThumbnailSourcePixels)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding image: %w", err)
+	}
+	pixels := flatten(src)
+	orientation := exifOrientation(data)
+
+	thumbnailsURL, err := s.containerURL(ctx, s.cfg.ThumbnailContainer)
+	if err != nil {
+		return nil, nil, err
+	}
+	var thumbnails []*store.Thumbnail
+	var names []string
+	for _, size := range s.cfg.ThumbnailSizes {
+		scaled := orient(scaleToFit(pixels, size), orientation)
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return thumbnails, names, err
+		}
+
+		name := thumbnailBlobName(job.msg, job.attachment.ID, size)
+		if err := blob.UploadBlockBlob(ctx, thumbnailsURL, name, "image/jpeg", encoded.Bytes()); err != nil {
+			return thumbnails, names, err
+		}
+		names = append(names, name)
+		thumbnails = append(thumbnails, &store.Thumbnail{
+			Size:   size,
+			Width:  scaled.Bounds().Dx(),
+			Height: scaled.Bounds().Dy(),
+			URL:    s.signer.URL(s.cfg.ThumbnailContainer, name),
+		})
+
+		// Images smaller than this size aren't scaled up, so larger sizes would be copies
+		if size >= config.Width && size >= config.Height {
+			break
+		}
+	}
+	return thumbnails, names, nil
+}
+
+// deleteThumbnails deletes thumbnail blobs, logging failures
+func (s *Service) deleteThumbnails(ctx context.Context, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	containerURL, err := s.containerURL(ctx, s.cfg.ThumbnailContainer)
+	if err != nil {
+		log.Printf("⚠️  Failed to delete thumbnails: %v", err)
+		return
+	}
+	for _, name := range names {
+		if err := blob.DeleteBlob(ctx, containerURL, name); err != nil {
+			log.Printf("⚠️  Failed to delete thumbnail %s: %v", name, err)
+		}
+	}
+}
+
+// thumbnailBlobName returns the name of an attachment's thumbnail of a size
+func thumbnailBlobName(msg *store.Message, attachmentID string, size int) string {
+	return blobName(msg.TenantID, msg.SenderID, attachmentID) + "/" + strconv.Itoa(size) + ".jpg"
+}
+
+// flatten converts an image to RGBA over a white background, as JPEG has no transparency
+func flatten(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+	return dst
+}
+
+// scaleToFit scales an image down to fit in a size x size square, averaging the source pixels
+// each output pixel covers. Images that already fit are returned as they are.
+func scaleToFit(src *image.RGBA, size int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, max(1, h*size/w)
+	if h > w {
+		dw, dh = max(1, w*size/h), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := y*h/dh, max(y*h/dh+1, (y+1)*h/dh)
+		for x := 0; x < dw; x++ {
+			sx0, sx1 := x*w/dw, max(x*w/dw+1, (x+1)*w/dw)
+			var r, g, b, n int
+			for sy := sy0; sy < sy1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+		}
+	}
+	return dst
+}
+
+// orient rotates and flips an image as its EXIF orientation (1-8) says it should be shown
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := x, y
+			switch orientation {
+			case 2: // Mirrored
+				sx = w - 1 - x
+			case 3: // Upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored upside down
+				sy = h - 1 - y
+			case 5: // Mirrored, rotated 90° counterclockwise
+				sx, sy = y, x
+			case 6: // Rotated 90° counterclockwise
+				sx, sy = y, h-1-x
+			case 7: // Mirrored, rotated 90° clockwise
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotated 90° clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"api-service/internal/blob"
+)
+
+// BlobSink appends records as JSON lines to one append blob per replica and day, e.g.
+// audit/2026/10/15/<instance>.jsonl. Appended blocks can't be modified; a container
+// immutability policy also keeps the blobs from being deleted.
+type BlobSink struct {
+	containerURL string
+	instanceID   string
+}
+
+// NewBlobSink creates a sink appending to blobs in the container (a SAS URL)
+func NewBlobSink(containerURL, instanceID string) *BlobSink {
+	return &BlobSink{containerURL: containerURL, instanceID: instanceID}
+}
+
+// Name returns "blob"
+func (s *BlobSink) Name() string {
+	return "blob"
+}
+
+// Write appends the records to today's blob in blocks of at most 4MB
+func (s *BlobSink) Write(ctx context.Context, records [][]byte) error {
+	name := "audit/" + time.Now().UTC().Format("2006/01/02") + "/" + s.instanceID + ".jsonl"
+
+	var block bytes.Buffer
+	for _, record := range records {
+		if block.Len() > 0 && block.Len()+len(record)+1 > blob.MaxAppendBlockBytes {
+			if err := blob.AppendBlock(ctx, s.containerURL, name, block.Bytes()); err != nil {
+				return err
+			}
+			block.Reset()
+		}
+		block.Write(record)
+		block.WriteByte('\n')
+	}
+	return blob.AppendBlock(ctx, s.containerURL, name, block.Bytes())
+}
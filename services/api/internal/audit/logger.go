@@ -0,0 +1,312 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/redact"
+)
+
+// defaultBufferSize is the records buffered per sink unless configured
+const defaultBufferSize = 10000
+
+// recentSize bounds the records kept in memory for queries when there is no local file
+const recentSize = 1000
+
+// maxLineBytes bounds one record read back from the local file
+const maxLineBytes = 1 << 20
+
+// Config configures the audit logger
+type Config struct {
+	File       string // Local file records are appended to as JSON lines; memory only when empty
+	InstanceID string // Recorded on each record and naming this replica's chain
+	BufferSize int    // Records buffered per sink while it's unreachable (default 10000); the oldest are dropped beyond this
+}
+
+// Logger appends audit records to the service log, a local file and any number of sinks
+// (Blob Storage, Log Analytics). Each replica's records form a hash chain: every record
+// carries the hash of the one before it, so editing or deleting a record breaks the chain
+// (see Verify). Records are written to the file before Record returns; sinks receive them in
+// batches off the request path.
+type Logger struct {
+	cfg Config
+
+	mu       sync.Mutex
+	file     *os.File
+	seq      int64
+	lastHash string
+	recent   []Record // Newest last; only kept without a file
+
+	redactor   redact.Redactor // Applied to record details; nil keeps them as is
+	forwarders []*forwarder
+}
+
+// NewLogger creates a logger, continuing the chain of records already in the file
+func NewLogger(cfg Config) (*Logger, error) {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	l := &Logger{cfg: cfg}
+	if cfg.File == "" {
+		return l, nil
+	}
+
+	err := l.scan(func(rec *Record) bool {
+		l.seq, l.lastHash = rec.Seq, rec.Hash
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l.file, err = os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit file: %w", err)
+	}
+	return l, nil
+}
+
+// SetRedactor redacts the details of every record before it's chained, so the service log,
+// the file and the sinks only ever see the redacted details (call before recording)
+func (l *Logger) SetRedactor(r redact.Redactor) {
+	l.redactor = r
+}
+
+// AddSink forwards records to a sink (call before Run)
+func (l *Logger) AddSink(sink Sink) {
+	l.forwarders = append(l.forwarders, newForwarder(sink, l.cfg.BufferSize))
+}
+
+// Record chains the record, stamping its time if unset, and appends it everywhere
+func (l *Logger) Record(rec Record) {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	rec.Instance = l.cfg.InstanceID
+	if l.redactor != nil && rec.Details != nil {
+		rec.Details = l.redactDetails(rec.Details)
+	}
+
+	l.mu.Lock()
+	data, err := chain(&rec, l.seq+1, l.lastHash)
+	if err != nil {
+		l.mu.Unlock()
+		log.Printf("Error encoding audit record: %v", err)
+		return
+	}
+	if l.file != nil {
+		if _, err := l.file.Write(append(data, '\n')); err != nil {
+			log.Printf("⚠️  Failed to append audit record %d to %s: %v", rec.Seq, l.cfg.File, err)
+		}
+	} else {
+		l.recent = append(l.recent, rec)
+		if len(l.recent) > recentSize {
+			l.recent = l.recent[len(l.recent)-recentSize:]
+		}
+	}
+	l.seq, l.lastHash = rec.Seq, rec.Hash
+	l.mu.Unlock()
+
+	log.Printf("🧾 AUDIT %s", data)
+	for _, f := range l.forwarders {
+		f.add(data)
+	}
+}
+
+// Run forwards buffered records to the sinks every interval until ctx is cancelled, then
+// writes what is still buffered
+func (l *Logger) Run(ctx context.Context, interval time.Duration) {
+	var wg sync.WaitGroup
+	for _, f := range l.forwarders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.run(ctx, interval)
+		}()
+	}
+	wg.Wait()
+}
+
+// Sinks reports the state of each sink
+func (l *Logger) Sinks() []SinkStats {
+	stats := make([]SinkStats, len(l.forwarders))
+	for i, f := range l.forwarders {
+		stats[i] = f.stats()
+	}
+	return stats
+}
+
+// Query filters audit records
+type Query struct {
+	Action   string // Exact action, or a prefix ending in "*" (e.g. "user.*")
+	Actor    string
+	TenantID string
+	Target   string
+	Outcome  string
+	Since    time.Time // Inclusive; zero for no bound
+	Until    time.Time // Exclusive; zero for no bound
+	Limit    int       // Must be positive
+}
+
+// matches reports whether rec passes the query's filters
+func (q *Query) matches(rec *Record) bool {
+	if prefix, ok := strings.CutSuffix(q.Action, "*"); ok {
+		if !strings.HasPrefix(rec.Action, prefix) {
+			return false
+		}
+	} else if q.Action != "" && rec.Action != q.Action {
+		return false
+	}
+	switch {
+	case q.Actor != "" && rec.Actor != q.Actor,
+		q.TenantID != "" && rec.TenantID != q.TenantID,
+		q.Target != "" && rec.Target != q.Target,
+		q.Outcome != "" && rec.Outcome != q.Outcome,
+		!q.Since.IsZero() && rec.Time.Before(q.Since),
+		!q.Until.IsZero() && !rec.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns up to q.Limit of this replica's records matching q, newest first. With a
+// local file the whole file is searched; otherwise only the last records kept in memory.
+func (l *Logger) Query(q Query) ([]Record, error) {
+	var matched []Record
+	keep := func(rec *Record) bool {
+		if q.matches(rec) {
+			matched = append(matched, *rec)
+			if len(matched) > q.Limit {
+				matched = matched[1:] // Oldest first until reversed below
+			}
+		}
+		return true
+	}
+
+	if l.cfg.File != "" {
+		if err := l.scan(keep); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		l.mu.Lock()
+		for i := range l.recent {
+			keep(&l.recent[i])
+		}
+		l.mu.Unlock()
+	}
+
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched, nil
+}
+
+// Verification is the result of checking a replica's chain of records
+type Verification struct {
+	Records  int64  `json:"records"`
+	Valid    bool   `json:"valid"`
+	BrokenAt int64  `json:"brokenAt,omitempty"` // Sequence number of the first record that doesn't chain
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify recomputes the hashes of this replica's records and checks that each links to the
+// one before it. Without a local file only the records kept in memory are checked.
+func (l *Logger) Verify() (*Verification, error) {
+	v := &Verification{Valid: true}
+	var prev *Record
+	check := func(rec *Record) bool {
+		v.Records++
+		hash, err := hashRecord(*rec)
+		switch {
+		case err != nil || hash != rec.Hash:
+			v.Reason = "hash doesn't match the record"
+		case prev != nil && rec.Seq != prev.Seq+1:
+			v.Reason = fmt.Sprintf("expected sequence number %d", prev.Seq+1)
+		case prev != nil && rec.PrevHash != prev.Hash:
+			v.Reason = "previous hash doesn't match the record before"
+		default:
+			copied := *rec
+			prev = &copied
+			return true
+		}
+		v.Valid, v.BrokenAt = false, rec.Seq
+		return false
+	}
+
+	if l.cfg.File != "" {
+		if err := l.scan(check); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return v, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.recent {
+		if !check(&l.recent[i]) {
+			break
+		}
+	}
+	return v, nil
+}
+
+// scan reads the records of the local file in order until each returns false. Only records
+// completely written when it starts are read. Lines that can't be decoded are reported as
+// records with only a sequence number, so they fail verification.
+func (l *Logger) scan(each func(rec *Record) bool) error {
+	var size int64 = -1
+	l.mu.Lock()
+	if l.file != nil {
+		info, err := l.file.Stat()
+		if err != nil {
+			l.mu.Unlock()
+			return err
+		}
+		size = info.Size()
+	}
+	l.mu.Unlock()
+
+	f, err := os.Open(l.cfg.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if size >= 0 {
+		reader = io.LimitReader(f, size)
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64<<10), maxLineBytes)
+	var last int64
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			rec = Record{Seq: last + 1}
+		}
+		last = rec.Seq
+		if !each(&rec) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// redactDetails returns a redacted copy of a record's details
+func (l *Logger) redactDetails(details map[string]interface{}) map[string]interface{} {
+	redacted, err := redact.Apply(l.redactor, details)
+	if err != nil {
+		log.Printf("⚠️  Failed to redact audit record details, dropping them: %v", err)
+		return map[string]interface{}{"redactionError": err.Error()}
+	}
+	if m, ok := redacted.(map[string]interface{}); ok {
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxBatchRecords bounds the records handed to a sink at once
+const maxBatchRecords = 500
+
+// finalFlushTimeout bounds writing the records still buffered when shutting down
+const finalFlushTimeout = 5 * time.Second
+
+// Sink stores batches of encoded audit records outside the replica
+type Sink interface {
+	Name() string
+	// Write stores records (JSON objects, oldest first); on error the whole batch is retried
+	Write(ctx context.Context, records [][]byte) error
+}
+
+// SinkStats reports the state of a sink
+type SinkStats struct {
+	Name     string `json:"name"`
+	Buffered int    `json:"buffered"`
+	Written  int64  `json:"written"`
+	Dropped  int64  `json:"dropped"` // Buffer overflow while the sink was unreachable
+	Failures int64  `json:"failures"`
+}
+
+// forwarder buffers records for a sink and writes them in batches
+type forwarder struct {
+	sink Sink
+	size int
+
+	mu      sync.Mutex
+	buffer  [][]byte // Oldest first
+	removed int64    // Records ever removed from the front of buffer (written or dropped)
+
+	written  atomic.Int64
+	dropped  atomic.Int64
+	failures atomic.Int64
+}
+
+// newForwarder creates a forwarder buffering up to size records
+func newForwarder(sink Sink, size int) *forwarder {
+	return &forwarder{sink: sink, size: size}
+}
+
+// add queues a record, dropping the oldest beyond the buffer size
+func (f *forwarder) add(record []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buffer = append(f.buffer, record)
+	if overflow := len(f.buffer) - f.size; overflow > 0 {
+		f.buffer = f.buffer[overflow:]
+		f.removed += int64(overflow)
+		f.dropped.Add(int64(overflow))
+	}
+}
+
+// run writes buffered records every interval until ctx is cancelled
+func (f *forwarder) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Write what's still buffered before shutting down
+			finalCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalFlushTimeout)
+			f.flushAll(finalCtx, interval)
+			cancel()
+			return
+		case <-ticker.C:
+		}
+		f.flushAll(ctx, interval)
+	}
+}
+
+// flushAll writes batches until the buffer is empty or a write fails
+func (f *forwarder) flushAll(ctx context.Context, interval time.Duration) {
+	for {
+		written, err := f.flush(ctx)
+		if err != nil {
+			f.failures.Add(1)
+			log.Printf("⚠️  Failed to write audit records to %s (%d buffered), retrying in %s: %v", f.sink.Name(), f.stats().Buffered, interval, err)
+			return
+		}
+		if written < maxBatchRecords {
+			return
+		}
+	}
+}
+
+// flush writes one batch from the front of the buffer and removes it once written
+func (f *forwarder) flush(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	start := f.removed
+	batch := f.buffer[:min(len(f.buffer), maxBatchRecords)]
+	f.mu.Unlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := f.sink.Write(ctx, batch); err != nil {
+		return 0, err
+	}
+
+	// Written records are still at the front unless some were dropped as overflow meanwhile
+	f.mu.Lock()
+	if remaining := start + int64(len(batch)) - f.removed; remaining > 0 {
+		f.buffer = f.buffer[remaining:]
+		f.removed += remaining
+	}
+	f.mu.Unlock()
+
+	f.written.Add(int64(len(batch)))
+	return len(batch), nil
+}
+
+// stats returns the forwarder's metrics
+func (f *forwarder) stats() SinkStats {
+	f.mu.Lock()
+	buffered := len(f.buffer)
+	f.mu.Unlock()
+
+	return SinkStats{
+		Name:     f.sink.Name(),
+		Buffered: buffered,
+		Written:  f.written.Load(),
+		Dropped:  f.dropped.Load(),
+		Failures: f.failures.Load(),
+	}
+}
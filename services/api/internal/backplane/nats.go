@@ -0,0 +1,86 @@
+package backplane
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS relays broadcasts over a NATS subject, for on-premises and development environments
+// without Azure messaging
+type NATS struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewNATS connects to the NATS server(s) at url (comma-separated nats:// or tls:// URLs, with
+// optional credentials) and relays broadcasts on subject. name identifies the connection in
+// the server's monitoring.
+func NewNATS(url, subject, name string) (*NATS, error) {
+	conn, err := nats.Connect(url,
+		nats.Name(name),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("⚠️  NATS backplane disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Printf("📡 NATS backplane reconnected to %s", conn.ConnectedUrlRedacted())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+
+	return &NATS{
+		conn:    conn,
+		subject: subject,
+	}, nil
+}
+
+// Publish sends a message to every subscribed replica. NATS delivers one publisher's messages
+// on a subject in order, so the key isn't needed.
+func (n *NATS) Publish(ctx context.Context, key string, message []byte) error {
+	return n.conn.Publish(n.subject, message)
+}
+
+// Subscribe delivers messages published on the subject until ctx is cancelled. The client
+// reconnects and resubscribes by itself; messages published meanwhile are lost.
+func (n *NATS) Subscribe(ctx context.Context, deliver func(message []byte)) error {
+	messages := make(chan *nats.Msg, 1024)
+	sub, err := n.conn.ChanSubscribe(n.subject, messages)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	// Wait for the server to process the subscription so startup errors surface
+	if err := n.conn.FlushTimeout(10 * time.Second); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-messages:
+			deliver(msg.Data)
+		}
+	}
+}
+
+// Ping checks the connection with a round trip to the server, for health checks
+func (n *NATS) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second) // Flushing requires a deadline
+	defer cancel()
+	return n.conn.FlushWithContext(ctx)
+}
+
+// Close drains the subscription and closes the connection
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
@@ -0,0 +1,76 @@
+// Package backplane implements events.Backplane transports that relay broadcasts between replicas
+package backplane
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis relays broadcasts over a Redis pub/sub channel (e.g. Azure Cache for Redis)
+type Redis struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedis connects to the Redis server at url (redis:// or rediss:// for TLS) and relays
+// broadcasts on channel
+func NewRedis(ctx context.Context, url, channel string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+
+	return &Redis{
+		client:  client,
+		channel: channel,
+	}, nil
+}
+
+// Publish sends a message to every subscribed replica. Redis delivers a channel's messages in
+// order, so the key isn't needed.
+func (r *Redis) Publish(ctx context.Context, key string, message []byte) error {
+	return r.client.Publish(ctx, r.channel, message).Err()
+}
+
+// Subscribe delivers messages published on the channel until ctx is cancelled. The client
+// resubscribes by itself after connection failures; messages published meanwhile are lost.
+func (r *Redis) Subscribe(ctx context.Context, deliver func(message []byte)) error {
+	pubsub := r.client.Subscribe(ctx, r.channel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed so startup errors surface
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("redis subscription closed")
+			}
+			deliver([]byte(msg.Payload))
+		}
+	}
+}
+
+// Ping checks the connection, for health checks
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis connections
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,209 @@
+package backplane
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"api-service/internal/identity"
+)
+
+// serviceBusResource is the token audience for Service Bus data and management calls
+const serviceBusResource = "https://servicebus.azure.net"
+
+// serviceBusReceiveTimeout is how long a receive waits for a message (server-side long poll)
+const serviceBusReceiveTimeout = 30 * time.Second
+
+// invalidSubscriptionChars are replaced in subscription names derived from the instance ID
+var invalidSubscriptionChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// subscriptionDescription provisions a replica's subscription. Broadcasts are only useful
+// briefly, and subscriptions of replicas that went away are deleted once idle.
+const subscriptionDescription = `<entry xmlns="http://www.w3.org/2005/Atom">
+  <content type="application/xml">
+    <SubscriptionDescription xmlns:i="http://www.w3.org/2001/XMLSchema-instance" xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect">
+      <DefaultMessageTimeToLive>PT1M</DefaultMessageTimeToLive>
+      <DeadLetteringOnMessageExpiration>false</DeadLetteringOnMessageExpiration>
+      <AutoDeleteOnIdle>PT10M</AutoDeleteOnIdle>
+    </SubscriptionDescription>
+  </content>
+</entry>`
+
+// ServiceBus relays broadcasts through an Azure Service Bus topic over the Service Bus HTTP API,
+// authenticating with the app's managed identity. Each replica reads its own subscription,
+// created at startup, with a single sequential receiver, so events arrive in publish order.
+type ServiceBus struct {
+	endpoint     string // https://<namespace>.servicebus.windows.net
+	topic        string
+	subscription string
+	identity     *identity.ManagedIdentity
+	client       *http.Client
+}
+
+// NewServiceBus provisions this replica's subscription on topic and returns the backplane.
+// namespace is a namespace name, host name or endpoint URL.
+func NewServiceBus(ctx context.Context, namespace, topic, instanceID string, mi *identity.ManagedIdentity) (*ServiceBus, error) {
+	endpoint := namespace
+	switch {
+	case strings.Contains(namespace, "://"):
+	case strings.Contains(namespace, "."):
+		endpoint = "https://" + namespace
+	default:
+		endpoint = "https://" + namespace + ".servicebus.windows.net"
+	}
+
+	subscription := invalidSubscriptionChars.ReplaceAllString(instanceID, "-")
+	if len(subscription) > 50 {
+		subscription = subscription[:50]
+	}
+
+	sb := &ServiceBus{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		topic:        topic,
+		subscription: subscription,
+		identity:     mi,
+		client:       &http.Client{Timeout: serviceBusReceiveTimeout + 10*time.Second},
+	}
+	if err := sb.provision(ctx); err != nil {
+		return nil, err
+	}
+	return sb, nil
+}
+
+// Subscription returns the name of this replica's subscription
+func (sb *ServiceBus) Subscription() string {
+	return sb.subscription
+}
+
+// provision creates this replica's subscription if it doesn't exist
+func (sb *ServiceBus) provision(ctx context.Context) error {
+	path := fmt.Sprintf("/%s/subscriptions/%s?api-version=2021-05", url.PathEscape(sb.topic), url.PathEscape(sb.subscription))
+	resp, err := sb.do(ctx, http.MethodPut, path, strings.NewReader(subscriptionDescription), map[string]string{
+		"Content-Type": "application/atom+xml;type=entry;charset=utf-8",
+	})
+	if err != nil {
+		return fmt.Errorf("provisioning subscription %s: %w", sb.subscription, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		log.Printf("📡 Service Bus subscription %s/%s provisioned", sb.topic, sb.subscription)
+		return nil
+	case http.StatusConflict:
+		return nil // Already exists (restarted replica)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("provisioning subscription %s returned status %d: %s", sb.subscription, resp.StatusCode, body)
+	}
+}
+
+// Publish sends a message to the topic. The key becomes the message's session ID, so
+// session-aware consumers of the topic also see each user's events in order.
+func (sb *ServiceBus) Publish(ctx context.Context, key string, message []byte) error {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if key != "" {
+		properties, _ := json.Marshal(map[string]string{"SessionId": key})
+		headers["BrokerProperties"] = string(properties)
+	}
+
+	resp, err := sb.do(ctx, http.MethodPost, "/"+url.PathEscape(sb.topic)+"/messages", bytes.NewReader(message), headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("service bus send returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Subscribe receives (and deletes) messages from this replica's subscription one at a time
+// until ctx is cancelled, backing off after failures
+func (sb *ServiceBus) Subscribe(ctx context.Context, deliver func(message []byte)) error {
+	path := fmt.Sprintf("/%s/subscriptions/%s/messages/head?timeout=%d",
+		url.PathEscape(sb.topic), url.PathEscape(sb.subscription), int(serviceBusReceiveTimeout.Seconds()))
+	backoff := time.Second
+
+	for ctx.Err() == nil {
+		message, err := sb.receive(ctx, path)
+		if err != nil {
+			log.Printf("⚠️  Service Bus receive failed, retrying in %s: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+		if message != nil {
+			deliver(message)
+		}
+	}
+	return ctx.Err()
+}
+
+// receive performs one receive-and-delete; it returns nil when no message arrived in time
+func (sb *ServiceBus) receive(ctx context.Context, path string) ([]byte, error) {
+	resp, err := sb.do(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("service bus receive returned status %d", resp.StatusCode)
+	}
+}
+
+// Ping checks that the subscription is reachable, for health checks
+func (sb *ServiceBus) Ping(ctx context.Context) error {
+	path := fmt.Sprintf("/%s/subscriptions/%s?api-version=2021-05", url.PathEscape(sb.topic), url.PathEscape(sb.subscription))
+	resp, err := sb.do(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("service bus subscription lookup returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close is a no-op; the HTTP API holds no connections that need closing
+func (sb *ServiceBus) Close() error {
+	return nil
+}
+
+// do sends an authenticated request to the namespace
+func (sb *ServiceBus) do(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	token, err := sb.identity.Token(ctx, serviceBusResource)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, sb.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return sb.client.Do(req)
+}
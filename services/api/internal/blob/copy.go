@@ -0,0 +1,54 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CopyBlob copies a blob within a container to a new blob with Put Blob From URL, which
+// completes before returning. The copy keeps the source's content properties, gets metadata
+// in place of the source's, and is made only if the source's ETag is still sourceETag and the
+// destination doesn't exist yet; otherwise ErrConditionNotMet is returned. It returns the
+// copy's ETag. Sources up to 5000 MiB can be copied.
+func CopyBlob(ctx context.Context, containerURL, sourceName, sourceETag, destName string, metadata map[string]string) (string, error) {
+	sourceURL, err := BlobURL(containerURL, sourceName)
+	if err != nil {
+		return "", err
+	}
+	destURL, err := BlobURL(containerURL, destName)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, destURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create copy request: %w", err)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-copy-source", sourceURL)
+	req.Header.Set("x-ms-source-if-match", sourceETag)
+	req.Header.Set("If-None-Match", "*")
+	for k, v := range metadata {
+		req.Header.Set("x-ms-meta-"+k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy %s to %s: %w", sourceName, destName, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return resp.Header.Get("ETag"), nil
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return "", ErrConditionNotMet
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("copy of %s to %s returned status %d: %s", sourceName, destName, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
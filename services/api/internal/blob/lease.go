@@ -0,0 +1,249 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLeaseConflict is returned when a blob is already leased by someone else
+var ErrLeaseConflict = errors.New("blob is leased by another holder")
+
+// ErrConditionNotMet is returned when a conditional request finds the blob changed, or
+// already created
+var ErrConditionNotMet = errors.New("blob condition not met")
+
+// Properties is the subset of blob properties used for leases and attachments
+type Properties struct {
+	LeaseState    string // available, leased, expired, breaking, broken
+	ETag          string
+	Metadata      map[string]string // x-ms-meta-* headers, keys lower-cased
+	ContentLength int64
+	ContentType   string
+}
+
+// AcquireLease acquires a lease on a blob, creating an empty blob first if it doesn't exist.
+// duration must be between 15s and 60s; proposedID must be a GUID.
+func AcquireLease(ctx context.Context, containerURL, blobName, proposedID string, duration time.Duration) error {
+	status, err := leaseRequest(ctx, containerURL, blobName, "acquire", map[string]string{
+		"x-ms-lease-duration":    strconv.Itoa(int(duration.Seconds())),
+		"x-ms-proposed-lease-id": proposedID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if status == http.StatusNotFound {
+		if err := createEmptyBlob(ctx, containerURL, blobName); err != nil {
+			return err
+		}
+		status, err = leaseRequest(ctx, containerURL, blobName, "acquire", map[string]string{
+			"x-ms-lease-duration":    strconv.Itoa(int(duration.Seconds())),
+			"x-ms-proposed-lease-id": proposedID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	switch status {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return ErrLeaseConflict
+	default:
+		return fmt.Errorf("lease acquire on %s returned status %d", blobName, status)
+	}
+}
+
+// RenewLease renews a lease held with leaseID
+func RenewLease(ctx context.Context, containerURL, blobName, leaseID string) error {
+	status, err := leaseRequest(ctx, containerURL, blobName, "renew", map[string]string{"x-ms-lease-id": leaseID})
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return ErrLeaseConflict
+	default:
+		return fmt.Errorf("lease renew on %s returned status %d", blobName, status)
+	}
+}
+
+// ReleaseLease releases a lease held with leaseID
+func ReleaseLease(ctx context.Context, containerURL, blobName, leaseID string) error {
+	status, err := leaseRequest(ctx, containerURL, blobName, "release", map[string]string{"x-ms-lease-id": leaseID})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("lease release on %s returned status %d", blobName, status)
+	}
+	return nil
+}
+
+// SetMetadata replaces a blob's metadata. leaseID is required when the blob is leased.
+func SetMetadata(ctx context.Context, containerURL, blobName, leaseID string, metadata map[string]string) error {
+	var conditions map[string]string
+	if leaseID != "" {
+		conditions = map[string]string{"x-ms-lease-id": leaseID}
+	}
+	return setMetadata(ctx, containerURL, blobName, conditions, metadata)
+}
+
+// SetMetadataIfMatch replaces a blob's metadata if its ETag is still etag, returning
+// ErrConditionNotMet if the blob was changed meanwhile
+func SetMetadataIfMatch(ctx context.Context, containerURL, blobName, etag string, metadata map[string]string) error {
+	return setMetadata(ctx, containerURL, blobName, map[string]string{"If-Match": etag}, metadata)
+}
+
+// setMetadata replaces a blob's metadata, sending conditions as request headers
+func setMetadata(ctx context.Context, containerURL, blobName string, conditions, metadata map[string]string) error {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, withQuery(blobURL, "comp=metadata"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	for k, v := range conditions {
+		req.Header.Set(k, v)
+	}
+	for k, v := range metadata {
+		req.Header.Set("x-ms-meta-"+k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to set metadata on %s: %w", blobName, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed:
+		return ErrConditionNotMet
+	default:
+		return fmt.Errorf("set metadata on %s returned status %d", blobName, resp.StatusCode)
+	}
+}
+
+// GetProperties reads a blob's lease state, metadata and content properties. It returns nil
+// if the blob doesn't exist.
+func GetProperties(ctx context.Context, containerURL, blobName string) (*Properties, error) {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, blobURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create properties request: %w", err)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read properties of %s: %w", blobName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get properties of %s returned status %d", blobName, resp.StatusCode)
+	}
+
+	props := &Properties{
+		LeaseState:    resp.Header.Get("x-ms-lease-state"),
+		ETag:          resp.Header.Get("ETag"),
+		Metadata:      make(map[string]string),
+		ContentLength: resp.ContentLength,
+		ContentType:   resp.Header.Get("Content-Type"),
+	}
+	for key, values := range resp.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-ms-meta-") && len(values) > 0 {
+			props.Metadata[strings.TrimPrefix(lower, "x-ms-meta-")] = values[0]
+		}
+	}
+	return props, nil
+}
+
+// leaseRequest performs a lease operation and returns the response status
+func leaseRequest(ctx context.Context, containerURL, blobName, action string, headers map[string]string) (int, error) {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, withQuery(blobURL, "comp=lease"), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create lease request: %w", err)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-lease-action", action)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s lease on %s: %w", action, blobName, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	return resp.StatusCode, nil
+}
+
+// createEmptyBlob creates an empty block blob if it doesn't already exist
+func createEmptyBlob(ctx context.Context, containerURL, blobName string) error {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, blobURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create blob request: %w", err)
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("If-None-Match", "*")
+	req.ContentLength = 0
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to create blob %s: %w", blobName, err)
+	}
+	defer resp.Body.Close()
+
+	// 409/412: created concurrently by another instance
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusConflict, http.StatusPreconditionFailed:
+		return nil
+	default:
+		return fmt.Errorf("create blob %s returned status %d", blobName, resp.StatusCode)
+	}
+}
+
+// withQuery appends a query parameter to a URL that may already carry a SAS query string
+func withQuery(rawURL, param string) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + param
+	}
+	return rawURL + "?" + param
+}
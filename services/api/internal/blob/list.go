@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ListBlobs returns the names of the blobs whose names start with prefix, using a container
+// SAS URL with list permission
+func ListBlobs(ctx context.Context, containerURL, prefix string) ([]string, error) {
+	var names []string
+	marker := ""
+	for {
+		listURL := withQuery(containerURL, "restype=container&comp=list&prefix="+url.QueryEscape(prefix))
+		if marker != "" {
+			listURL = withQuery(listURL, "marker="+url.QueryEscape(marker))
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create list request: %w", err)
+		}
+		req.Header.Set("x-ms-version", apiVersion)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs under %s: %w", prefix, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("blob list under %s returned status %d: %s", prefix, resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		var page struct {
+			Blobs []struct {
+				Name string `xml:"Name"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode blob list under %s: %w", prefix, err)
+		}
+
+		for _, b := range page.Blobs {
+			names = append(names, b.Name)
+		}
+		if page.NextMarker == "" {
+			return names, nil
+		}
+		marker = page.NextMarker
+	}
+}
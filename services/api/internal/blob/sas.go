@@ -0,0 +1,240 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/identity"
+)
+
+// storageResource is the token audience for Azure Storage
+const storageResource = "https://storage.azure.com"
+
+// SAS permissions, combined in this order (e.g. PermissionRead+PermissionWrite)
+const (
+	PermissionRead   = "r"
+	PermissionCreate = "c"
+	PermissionWrite  = "w"
+	PermissionDelete = "d"
+	PermissionList   = "l"
+)
+
+// sasClockSkew backdates SAS start times so clocks running slightly behind ours accept them
+const sasClockSkew = 5 * time.Minute
+
+// delegationKeyLifetime is how long requested user delegation keys are valid (at most 7 days)
+const delegationKeyLifetime = 24 * time.Hour
+
+// SASOptions configures a SAS
+type SASOptions struct {
+	Permissions        string    // E.g. PermissionRead
+	Expiry             time.Time // At most delegationKeyLifetime away when signing with a delegation key
+	ContentDisposition string    // Overrides the Content-Disposition of reads, e.g. to set a download's file name
+}
+
+// Signer issues SAS URLs for blobs in one storage account. With an account key it signs
+// service SAS tokens; without one it signs user delegation SAS tokens with a key obtained
+// using the managed identity, which needs the Storage Blob Data Contributor role.
+type Signer struct {
+	endpoint *url.URL // Blob service endpoint, e.g. https://<account>.blob.core.windows.net
+	account  string
+	key      []byte
+	identity *identity.ManagedIdentity
+
+	mu         sync.Mutex
+	delegation *delegationKey // Cached user delegation key
+}
+
+// delegationKey is a user delegation key returned by the Blob service
+type delegationKey struct {
+	SignedOID     string `xml:"SignedOid"`
+	SignedTID     string `xml:"SignedTid"`
+	SignedStart   string `xml:"SignedStart"`
+	SignedExpiry  string `xml:"SignedExpiry"`
+	SignedService string `xml:"SignedService"`
+	SignedVersion string `xml:"SignedVersion"`
+	Value         string `xml:"Value"`
+
+	expiry time.Time
+	key    []byte
+}
+
+// NewSigner creates a signer for the Blob service at endpoint. The account name is the
+// endpoint's first host label, or its first path segment for emulators such as Azurite
+// (http://127.0.0.1:10000/devstoreaccount1). key is the base64 account key; mi is used
+// when it's empty.
+func NewSigner(endpoint, key string, mi *identity.ManagedIdentity) (*Signer, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Blob Storage endpoint %q", endpoint)
+	}
+	u.RawQuery = ""
+
+	account, _, _ := strings.Cut(u.Hostname(), ".")
+	if net.ParseIP(u.Hostname()) != nil || u.Hostname() == "localhost" {
+		account, _, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	}
+	if account == "" {
+		return nil, fmt.Errorf("no storage account name in Blob Storage endpoint %q", endpoint)
+	}
+
+	s := &Signer{endpoint: u, account: account, identity: mi}
+	if key != "" {
+		if s.key, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return nil, fmt.Errorf("invalid storage account key: %w", err)
+		}
+	} else if mi == nil {
+		return nil, fmt.Errorf("a storage account key or managed identity is required")
+	}
+	return s, nil
+}
+
+// ContainerURL returns a container URL carrying a SAS, for use with the container URL based
+// functions of this package
+func (s *Signer) ContainerURL(ctx context.Context, container string, opts SASOptions) (string, error) {
+	return s.sign(ctx, container, "", opts)
+}
+
+// BlobURL returns the URL of a blob carrying a SAS, which can be handed to clients to read
+// or upload the blob directly
+func (s *Signer) BlobURL(ctx context.Context, container, blobName string, opts SASOptions) (string, error) {
+	return s.sign(ctx, container, blobName, opts)
+}
+
+// URL returns the URL of a blob without a SAS, for containers that allow anonymous reads
+func (s *Signer) URL(container, blobName string) string {
+	target := *s.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + container + "/" + blobName
+	return target.String()
+}
+
+// sign builds a container (empty blobName) or blob URL with a SAS
+func (s *Signer) sign(ctx context.Context, container, blobName string, opts SASOptions) (string, error) {
+	resource, signedResource := "/blob/"+s.account+"/"+container, "c"
+	target := *s.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + container
+	if blobName != "" {
+		resource += "/" + blobName
+		signedResource = "b"
+		target.Path += "/" + blobName
+	}
+
+	start := time.Now().UTC().Add(-sasClockSkew).Format(time.RFC3339)
+	expiry := opts.Expiry.UTC().Format(time.RFC3339)
+	protocol := "https"
+	if s.endpoint.Scheme == "http" {
+		protocol = "https,http"
+	}
+
+	query := url.Values{
+		"sv":  {apiVersion},
+		"sr":  {signedResource},
+		"sp":  {opts.Permissions},
+		"st":  {start},
+		"se":  {expiry},
+		"spr": {protocol},
+	}
+	if opts.ContentDisposition != "" {
+		query.Set("rscd", opts.ContentDisposition)
+	}
+
+	var key []byte
+	var fields []string
+	if s.key != nil {
+		key = s.key
+		// Service SAS string-to-sign (version 2020-12-06 and later)
+		fields = []string{opts.Permissions, start, expiry, resource, "", "", protocol, apiVersion, signedResource,
+			"", "", "", opts.ContentDisposition, "", "", ""}
+	} else {
+		delegation, err := s.delegationKey(ctx, opts.Expiry)
+		if err != nil {
+			return "", err
+		}
+		key = delegation.key
+		query.Set("skoid", delegation.SignedOID)
+		query.Set("sktid", delegation.SignedTID)
+		query.Set("skt", delegation.SignedStart)
+		query.Set("ske", delegation.SignedExpiry)
+		query.Set("sks", delegation.SignedService)
+		query.Set("skv", delegation.SignedVersion)
+		// User delegation SAS string-to-sign (version 2020-12-06 and later)
+		fields = []string{opts.Permissions, start, expiry, resource,
+			delegation.SignedOID, delegation.SignedTID, delegation.SignedStart, delegation.SignedExpiry, delegation.SignedService, delegation.SignedVersion,
+			"", "", "", "", protocol, apiVersion, signedResource, "", "", "", opts.ContentDisposition, "", "", ""}
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	query.Set("sig", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// delegationKey returns a cached user delegation key valid until at least expiry, requesting
+// a new one when needed
+func (s *Signer) delegationKey(ctx context.Context, expiry time.Time) (*delegationKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.delegation != nil && s.delegation.expiry.After(expiry) {
+		return s.delegation, nil
+	}
+
+	token, err := s.identity.Token(ctx, storageResource)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><KeyInfo><Start>%s</Start><Expiry>%s</Expiry></KeyInfo>`,
+		now.Add(-sasClockSkew).Format(time.RFC3339), now.Add(delegationKeyLifetime).Format(time.RFC3339))
+
+	serviceURL := *s.endpoint
+	serviceURL.Path = strings.TrimSuffix(serviceURL.Path, "/") + "/"
+	serviceURL.RawQuery = "restype=service&comp=userdelegationkey"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serviceURL.String(), bytes.NewReader([]byte(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user delegation key request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("Content-Type", "application/xml")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user delegation key: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("get user delegation key returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	var key delegationKey
+	if err := xml.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return nil, fmt.Errorf("decoding user delegation key: %w", err)
+	}
+	if key.key, err = base64.StdEncoding.DecodeString(key.Value); err != nil {
+		return nil, fmt.Errorf("decoding user delegation key: %w", err)
+	}
+	if key.expiry, err = time.Parse(time.RFC3339, key.SignedExpiry); err != nil {
+		return nil, fmt.Errorf("decoding user delegation key expiry: %w", err)
+	}
+	if !key.expiry.After(expiry) {
+		return nil, fmt.Errorf("SAS expiry %s is past the user delegation key's", expiry.Format(time.RFC3339))
+	}
+	s.delegation = &key
+	return s.delegation, nil
+}
@@ -0,0 +1,193 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiVersion is the Blob Storage REST API version used for requests
+const apiVersion = "2021-08-06"
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// BlobURL builds the URL of a blob inside a container URL, preserving any SAS query string
+func BlobURL(containerURL, blobName string) (string, error) {
+	u, err := url.Parse(containerURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid container URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid container URL scheme: %s", u.Scheme)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(blobName, "/")
+	return u.String(), nil
+}
+
+// UploadBlockBlob uploads data as a block blob using a container SAS URL
+// (e.g. https://account.blob.core.windows.net/container?sv=...&sig=...)
+func UploadBlockBlob(ctx context.Context, containerURL, blobName, contentType string, data []byte) error {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, blobURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", blobName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("blob upload %s returned status %d: %s", blobName, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// DownloadBlob reads a blob of at most maxBytes. It returns nil if the blob doesn't exist.
+func DownloadBlob(ctx context.Context, containerURL, blobName string, maxBytes int64) ([]byte, error) {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, blobURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", blobName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("blob download %s returned status %d: %s", blobName, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", blobName, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("blob %s is larger than %d bytes", blobName, maxBytes)
+	}
+	return data, nil
+}
+
+// DeleteBlob deletes a blob and its snapshots. Deleting a blob that doesn't exist succeeds.
+func DeleteBlob(ctx context.Context, containerURL, blobName string) error {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, blobURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-delete-snapshots", "include")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob %s: %w", blobName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("blob delete %s returned status %d: %s", blobName, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// MaxAppendBlockBytes bounds the data of one AppendBlock call
+const MaxAppendBlockBytes = 4 << 20
+
+// AppendBlock appends data to an append blob, creating the blob first if it doesn't exist.
+// Blocks already appended can't be changed, which suits append-only logs.
+func AppendBlock(ctx context.Context, containerURL, blobName string, data []byte) error {
+	blobURL, err := BlobURL(containerURL, blobName)
+	if err != nil {
+		return err
+	}
+
+	status, body, err := appendBlock(ctx, blobURL, data)
+	if err == nil && status == http.StatusNotFound {
+		if err := createAppendBlob(ctx, blobURL); err != nil {
+			return fmt.Errorf("failed to create append blob %s: %w", blobName, err)
+		}
+		status, body, err = appendBlock(ctx, blobURL, data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append to blob %s: %w", blobName, err)
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("blob append %s returned status %d: %s", blobName, status, body)
+	}
+	return nil
+}
+
+// appendBlock sends an Append Block request and returns the status and (truncated) body
+func appendBlock(ctx context.Context, blobURL string, data []byte) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, withQuery(blobURL, "comp=appendblock"), bytes.NewReader(data))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, strings.TrimSpace(string(body)), nil
+}
+
+// createAppendBlob creates an empty append blob unless it already exists
+func createAppendBlob(ctx context.Context, blobURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, blobURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-blob-type", "AppendBlob")
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("If-None-Match", "*")
+	req.ContentLength = 0
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 409/412: created concurrently
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusConflict, http.StatusPreconditionFailed:
+		return nil
+	default:
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,123 @@
+// Package blocks lets users block or mute other users. The chat activity of blocked and
+// muted users is withheld from their connections, and blocked users can't send them direct
+// messages.
+package blocks
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// ErrBlockSelf is returned when users try to block or mute themselves
+var ErrBlockSelf = errors.New("you can't block or mute yourself")
+
+// ErrBlockNotFound is returned when the user hasn't blocked (or muted) the other user
+var ErrBlockNotFound = store.ErrBlockNotFound
+
+// Service manages block lists, which are persisted in the message store. Changes apply right
+// away to the user's connection on the replica handling the request; a connection on
+// another replica picks them up when it reconnects.
+type Service struct {
+	manager *events.Manager
+	store   store.BlockStore
+}
+
+// NewService creates a block list service withholding events through manager
+func NewService(manager *events.Manager, blocks store.BlockStore) *Service {
+	return &Service{
+		manager: manager,
+		store:   blocks,
+	}
+}
+
+// Add puts blockedID on the user's block list with the given kind, replacing a block with a
+// mute or the other way round, and returns the entry
+func (s *Service) Add(ctx context.Context, user *models.User, blockedID string, kind store.BlockKind) (*store.Block, error) {
+	if blockedID == user.ID {
+		return nil, ErrBlockSelf
+	}
+	err := s.store.SaveBlock(ctx, &store.Block{
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		BlockedID: blockedID,
+		Kind:      kind,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.apply(ctx, user.ID)
+	log.Printf("User %s added %s to their block list (%s)", user.ID, blockedID, kind)
+	return s.store.Block(ctx, user.ID, blockedID)
+}
+
+// Remove takes blockedID off the user's block list. ErrBlockNotFound is returned unless the
+// entry has the given kind.
+func (s *Service) Remove(ctx context.Context, user *models.User, blockedID string, kind store.BlockKind) error {
+	block, err := s.store.Block(ctx, user.ID, blockedID)
+	if err != nil {
+		return err
+	}
+	if block.Kind != kind {
+		return ErrBlockNotFound
+	}
+	if _, err := s.store.DeleteBlock(ctx, user.ID, blockedID); err != nil {
+		return err
+	}
+	s.apply(ctx, user.ID)
+	log.Printf("User %s removed %s from their block list", user.ID, blockedID)
+	return nil
+}
+
+// List returns the user's block list, oldest first
+func (s *Service) List(ctx context.Context, user *models.User) ([]*store.Block, error) {
+	blocks, err := s.store.Blocks(ctx, user.ID)
+	if blocks == nil {
+		blocks = []*store.Block{}
+	}
+	return blocks, err
+}
+
+// HandleConnect withholds the chat activity of the users a newly connected client blocked
+// or muted
+func (s *Service) HandleConnect(client *events.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	senders, err := s.senders(ctx, client.ID)
+	if err != nil {
+		log.Printf("⚠️  Failed to load the block list of %s: %v", client.ID, err)
+		return
+	}
+	client.SetWithheld(senders)
+}
+
+// apply updates what the user's connection on this replica withholds after their block list
+// changed
+func (s *Service) apply(ctx context.Context, userID string) {
+	senders, err := s.senders(ctx, userID)
+	if err != nil {
+		log.Printf("⚠️  Failed to reload the block list of %s: %v", userID, err)
+		return
+	}
+	s.manager.WithholdFrom(userID, senders)
+}
+
+// senders returns the IDs of the users on the user's block list
+func (s *Service) senders(ctx context.Context, userID string) ([]string, error) {
+	blocks, err := s.store.Blocks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.BlockedID
+	}
+	return ids, nil
+}
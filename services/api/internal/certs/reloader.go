@@ -0,0 +1,135 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Reloader serves a TLS certificate that is reloaded from disk when the files change
+// (e.g. cert-manager rotation) or the process receives SIGHUP
+type Reloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	mu       sync.RWMutex
+}
+
+// NewReloader loads the certificate and key pair and returns a reloader for them
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate and key from disk. The previous certificate is kept if loading fails.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+
+	if cert.Leaf != nil {
+		log.Printf("🔒 TLS certificate loaded: subject=%s, expires=%s", cert.Leaf.Subject.CommonName, cert.Leaf.NotAfter.Format(time.RFC3339))
+	} else {
+		log.Printf("🔒 TLS certificate loaded from %s", r.certFile)
+	}
+	return nil
+}
+
+// GetCertificate returns the current certificate (for tls.Config.GetCertificate)
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server TLS configuration backed by the reloader
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Watch reloads the certificate on SIGHUP and whenever the certificate or key files change.
+// The parent directories are watched rather than the files themselves, because Kubernetes
+// secret volumes rotate files by swapping symlinks. Watching stops when ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	dirs := map[string]bool{
+		filepath.Dir(r.certFile): true,
+		filepath.Dir(r.keyFile):  true,
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(hup)
+
+		// Debounce bursts of events produced by a single rotation
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Printf("🔒 SIGHUP received, reloading TLS certificate")
+				if err := r.Reload(); err != nil {
+					log.Printf("❌ TLS certificate reload failed: %v", err)
+				}
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+					debounce = time.After(500 * time.Millisecond)
+				}
+			case <-debounce:
+				debounce = nil
+				log.Printf("🔒 TLS certificate files changed, reloading")
+				if err := r.Reload(); err != nil {
+					log.Printf("❌ TLS certificate reload failed: %v", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("TLS certificate watcher error: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
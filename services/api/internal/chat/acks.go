@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"api-service/internal/events"
+)
+
+// ErrMessageNotPending is returned when acknowledging a message that isn't awaiting the
+// caller's acknowledgment (unknown, already acknowledged, failed, or sent to someone else)
+var ErrMessageNotPending = errors.New("message is not awaiting acknowledgment")
+
+// AckTracker tracks delivered messages until their recipient acknowledges them. Unacknowledged
+// messages are redelivered with the same event ID; the sender gets a delivered event once the
+// recipient acknowledges, or a delivery_failed event when the attempts run out.
+type AckTracker struct {
+	manager  *events.Manager
+	timeout  time.Duration // Wait for an acknowledgment before redelivering
+	attempts int           // Deliveries before a message fails
+	pending  map[string]*pendingMessage
+	mu       sync.Mutex
+}
+
+// pendingMessage is a delivered message awaiting acknowledgment
+type pendingMessage struct {
+	event       *events.Event
+	senderID    string
+	recipientID string
+	attempts    int
+	deadline    time.Time
+}
+
+// NewAckTracker creates a tracker; attempts counts the first delivery
+func NewAckTracker(manager *events.Manager, timeout time.Duration, attempts int) *AckTracker {
+	return &AckTracker{
+		manager:  manager,
+		timeout:  timeout,
+		attempts: attempts,
+		pending:  make(map[string]*pendingMessage),
+	}
+}
+
+// Track starts waiting for the acknowledgment of a chat event delivered to recipientID
+func (t *AckTracker) Track(event *events.Event, senderID, recipientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending[event.ID] = &pendingMessage{
+		event:       event,
+		senderID:    senderID,
+		recipientID: recipientID,
+		attempts:    1,
+		deadline:    time.Now().Add(t.timeout),
+	}
+}
+
+// Ack records the recipient's acknowledgment and notifies the sender
+func (t *AckTracker) Ack(recipientID, messageID string) error {
+	t.mu.Lock()
+	msg, ok := t.pending[messageID]
+	if !ok || msg.recipientID != recipientID {
+		t.mu.Unlock()
+		return ErrMessageNotPending
+	}
+	delete(t.pending, messageID)
+	t.mu.Unlock()
+
+	t.manager.SendEventToUser(msg.senderID, events.NewDeliveredEvent(messageID, recipientID))
+	return nil
+}
+
+// Pending returns the number of messages awaiting acknowledgment
+func (t *AckTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// Run redelivers or fails overdue messages until ctx is cancelled
+func (t *AckTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(t.timeout, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.expire(now)
+		}
+	}
+}
+
+// expire redelivers messages past their deadline, failing those out of attempts
+func (t *AckTracker) expire(now time.Time) {
+	var redeliver, failed []*pendingMessage
+
+	t.mu.Lock()
+	for id, msg := range t.pending {
+		if now.Before(msg.deadline) {
+			continue
+		}
+		if msg.attempts >= t.attempts {
+			delete(t.pending, id)
+			failed = append(failed, msg)
+			continue
+		}
+		msg.attempts++
+		msg.deadline = now.Add(t.timeout)
+		redeliver = append(redeliver, msg)
+	}
+	t.mu.Unlock()
+
+	// Redeliveries count as attempts even when the recipient has disconnected meanwhile
+	for _, msg := range redeliver {
+		t.manager.SendEventToUser(msg.recipientID, msg.event)
+	}
+	for _, msg := range failed {
+		log.Printf("Message %s to %s was not acknowledged after %d attempts", msg.event.ID, msg.recipientID, msg.attempts)
+		t.manager.SendEventToUser(msg.senderID, events.NewDeliveryFailedEvent(msg.event.ID, msg.recipientID, msg.attempts))
+	}
+}
+
+// ackFrame is the payload of an acknowledgment sent over the WebSocket:
+// {"type": "ack", "payload": {"messageId": "..."}}
+type ackFrame struct {
+	MessageID string `json:"messageId"`
+}
+
+// HandleFrame acknowledges messages from ack frames; register it with Manager.HandleFrame.
+// Acks of messages that aren't pending (typically a redelivery acknowledged twice) are ignored.
+func (t *AckTracker) HandleFrame(client *events.Client, frame events.InboundFrame) error {
+	var ack ackFrame
+	if err := json.Unmarshal(frame.Payload, &ack); err != nil || ack.MessageID == "" {
+		return events.NewFrameError("invalid_payload", "Expected {\"messageId\": \"...\"}")
+	}
+	if err := t.Ack(client.ID, ack.MessageID); err != nil {
+		log.Printf("Ignoring ack from %s for %s: %v", client.ID, ack.MessageID, err)
+	}
+	return nil
+}
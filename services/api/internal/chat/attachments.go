@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"context"
+
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/store"
+	"api-service/internal/usage"
+)
+
+// ErrTooManyAttachments is returned when attaching a file to a message with store.MaxAttachments
+var ErrTooManyAttachments = store.ErrTooManyAttachments
+
+// AttachmentBlobs deletes the uploaded files of attachments
+type AttachmentBlobs interface {
+	// DeleteBlobs deletes the files attached to msg, logging failures
+	DeleteBlobs(ctx context.Context, msg *store.Message, attachments []*store.Attachment)
+}
+
+// SetAttachmentBlobs makes deleting a message delete its attachments' files
+func (s *Service) SetAttachmentBlobs(blobs AttachmentBlobs) {
+	s.blobs = blobs
+}
+
+// Attachable loads a message the user sent and may attach another file to. Other participants
+// get ErrNotSender; anyone else gets ErrMessageNotFound.
+func (s *Service) Attachable(ctx context.Context, user *models.User, messageID string) (*store.Message, error) {
+	msg, _, err := s.attachable(ctx, user, messageID)
+	return msg, err
+}
+
+// Attach attaches an uploaded file to a message the user sent and returns the updated message.
+// The file counts against the sender's storage quota; a *usage.QuotaError is returned when
+// it's exhausted. The other participants connected to this replica get an attachment_added
+// event; attaching the same file again changes nothing.
+func (s *Service) Attach(ctx context.Context, user *models.User, messageID string, attachment *store.Attachment) (*store.Message, error) {
+	msg, participants, err := s.attachable(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	roomID := messageRoomID(msg)
+	if err := s.usage.Reserve(ctx, msg.SenderID, roomID, usage.KindAttachments, attachment.Size); err != nil {
+		return nil, err
+	}
+	updated, added, err := s.store.AddAttachment(ctx, msg, attachment)
+	if err != nil || !added {
+		s.usage.Release(ctx, msg.SenderID, roomID, usage.KindAttachments, attachment.Size)
+		return updated, err
+	}
+	s.notify(updated, participants, user.ID, events.InThread(events.NewAttachmentAddedEvent(updated.ID, user.ID, user.Name,
+		attachment.ID, attachment.FileName, attachment.ContentType, attachment.Size), updated.ParentID))
+	return updated, nil
+}
+
+// SetThumbnails records the thumbnails generated for an image attachment and returns the
+// updated message. All participants connected to this replica, including the sender, get an
+// attachment_updated event.
+func (s *Service) SetThumbnails(ctx context.Context, messageID, attachmentID string, thumbnails []*store.Thumbnail) (*store.Message, error) {
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.store.SetThumbnails(ctx, msg, attachmentID, thumbnails)
+	if err != nil {
+		return nil, err
+	}
+	participants, err := s.participants(ctx, updated)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(updated, participants, "", events.InThread(events.NewAttachmentUpdatedEvent(updated.ID, attachmentID, thumbnails), updated.ParentID))
+	return updated, nil
+}
+
+// Message returns a message of a conversation the user takes part in
+func (s *Service) Message(ctx context.Context, user *models.User, messageID string) (*store.Message, error) {
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := s.canRead(ctx, user, msg); err != nil || !ok {
+		if err == nil {
+			err = ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// attachable loads a message the user may attach a file to, with its conversation's
+// participants. Unlike edits, admins can't attach files to others' messages.
+func (s *Service) attachable(ctx context.Context, user *models.User, messageID string) (*store.Message, []string, error) {
+	msg, participants, err := s.changeable(ctx, user, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.SenderID != user.ID {
+		return nil, nil, ErrNotSender
+	}
+	if len(msg.Attachments) >= store.MaxAttachments {
+		return nil, nil, ErrTooManyAttachments
+	}
+	return msg, participants, nil
+}
+
+// releaseAttachments releases the storage used by a deleted message's attachments and
+// deletes their files
+func (s *Service) releaseAttachments(ctx context.Context, msg *store.Message) {
+	if len(msg.Attachments) == 0 {
+		return
+	}
+	var size int64
+	for _, attachment := range msg.Attachments {
+		size += attachment.Size
+	}
+	s.usage.Release(ctx, msg.SenderID, messageRoomID(msg), usage.KindAttachments, size)
+	if s.blobs != nil {
+		s.blobs.DeleteBlobs(ctx, msg, msg.Attachments)
+	}
+}
@@ -0,0 +1,23 @@
+package chat
+
+import (
+	"context"
+	"errors"
+
+	"api-service/internal/store"
+)
+
+// ErrBlocked is returned for direct messages to a user who blocked the sender
+var ErrBlocked = errors.New("recipient has blocked you")
+
+// blockKind returns how the recipient keeps the sender out of their way, or "" when they don't
+func (s *Service) blockKind(ctx context.Context, recipientID, senderID string) (store.BlockKind, error) {
+	block, err := s.store.Block(ctx, recipientID, senderID)
+	if errors.Is(err, store.ErrBlockNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return block.Kind, nil
+}
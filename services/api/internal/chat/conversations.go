@@ -0,0 +1,149 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// PreviewLength bounds the text of a conversation's last message preview, in characters
+const PreviewLength = 140
+
+// Conversation summarizes a direct conversation or room for the user's inbox
+type Conversation struct {
+	ID             string          `json:"id"`   // Conversation ID
+	Type           string          `json:"type"` // "direct" or "room"
+	PeerID         string          `json:"peerId,omitempty"`
+	RoomID         string          `json:"roomId,omitempty"`
+	Name           string          `json:"name"` // The peer's or room's name
+	LastMessage    *MessagePreview `json:"lastMessage,omitempty"`
+	LastActivityAt time.Time       `json:"lastActivityAt"` // The last message's time, or when the room was created
+	UnreadCount    int             `json:"unreadCount"`
+	ReadAt         *time.Time      `json:"readAt,omitempty"` // The user's read marker
+}
+
+// MessagePreview is the start of a conversation's last message outside threads
+type MessagePreview struct {
+	ID         string    `json:"id"`
+	SenderID   string    `json:"senderId"`
+	SenderName string    `json:"senderName"`
+	Text       string    `json:"text"`
+	Truncated  bool      `json:"truncated,omitempty"`
+	Deleted    bool      `json:"deleted,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Conversations returns the user's direct conversations and rooms, most recently active
+// first, with their last message and how many messages from others arrived after the
+// user's read marker
+func (s *Service) Conversations(ctx context.Context, user *models.User) ([]*Conversation, error) {
+	markers, err := s.store.ReadMarkers(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversations []*Conversation
+	direct, err := s.store.DirectConversations(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range direct {
+		conversations = append(conversations, &Conversation{ID: id, Type: "direct"})
+	}
+	rooms, err := s.store.UserRooms(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		conversations = append(conversations, &Conversation{
+			ID:             store.RoomConversationID(room.ID),
+			Type:           "room",
+			RoomID:         room.ID,
+			Name:           room.Name,
+			LastActivityAt: room.CreatedAt,
+		})
+	}
+
+	// Names of peers who only received messages come from their sessions, when connected
+	names := make(map[string]string)
+	for _, session := range s.manager.Sessions() {
+		names[session.UserID] = session.Name
+	}
+	for _, conversation := range conversations {
+		if err := s.summarize(ctx, user, conversation, markers, names); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].LastActivityAt.After(conversations[j].LastActivityAt)
+	})
+	return conversations, nil
+}
+
+// summarize fills in a conversation's last message, peer and unread count
+func (s *Service) summarize(ctx context.Context, user *models.User, conversation *Conversation, markers map[string]time.Time, names map[string]string) error {
+	last, err := s.store.Messages(ctx, conversation.ID, time.Time{}, 1)
+	if err != nil {
+		return err
+	}
+	if len(last) > 0 {
+		msg := last[0]
+		conversation.LastMessage = newMessagePreview(msg)
+		conversation.LastActivityAt = msg.CreatedAt
+		if conversation.Type == "direct" {
+			conversation.PeerID, conversation.Name = msg.RecipientID, names[msg.RecipientID]
+			if msg.RecipientID == user.ID {
+				conversation.PeerID, conversation.Name = msg.SenderID, msg.SenderName
+			}
+			if conversation.Name == "" {
+				conversation.Name = conversation.PeerID
+			}
+		}
+	}
+
+	readAt, read := markers[conversation.ID]
+	if read {
+		conversation.ReadAt = &readAt
+	}
+	conversation.UnreadCount, err = s.store.CountUnread(ctx, conversation.ID, user.ID, readAt)
+	return err
+}
+
+// MarkRead moves the user's read marker for a message's conversation forward to the message,
+// so it and everything before it count as read
+func (s *Service) MarkRead(ctx context.Context, user *models.User, messageID string) error {
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if ok, err := s.canRead(ctx, user, msg); err != nil || !ok {
+		if err == nil {
+			err = ErrMessageNotFound
+		}
+		return err
+	}
+	return s.store.MarkRead(ctx, user.ID, user.TenantID, msg.ConversationID, msg.CreatedAt)
+}
+
+// newMessagePreview returns the preview of a message
+func newMessagePreview(msg *store.Message) *MessagePreview {
+	preview := &MessagePreview{
+		ID:         msg.ID,
+		SenderID:   msg.SenderID,
+		SenderName: msg.SenderName,
+		Deleted:    msg.DeletedAt != nil,
+		CreatedAt:  msg.CreatedAt,
+	}
+	if msg.Message != nil {
+		text := []rune(strings.TrimSpace(msg.Message.Text))
+		if len(text) > PreviewLength {
+			text, preview.Truncated = text[:PreviewLength], true
+		}
+		preview.Text = string(text)
+	}
+	return preview
+}
@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/store"
+	"api-service/internal/usage"
+)
+
+// ErrNotSender is returned when a user other than the sender, or an admin, changes a message
+var ErrNotSender = errors.New("only the sender or an admin can change this message")
+
+// EditMessage replaces the content of a message sent by user (or by anyone in their tenant,
+// for admins) and returns the updated message; the replaced version is kept in its revisions.
+// The new content counts against the sender's storage quota. The other participants connected
+// to this replica get a message_updated event. The new content is moderated like a new message.
+func (s *Service) EditMessage(ctx context.Context, user *models.User, messageID string, content *models.MessageContent) (*store.Message, error) {
+	msg, participants, err := s.changeable(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+	decision, err := Moderate(ctx, s.moderator, user, msg.ConversationID, content)
+	if err != nil {
+		return nil, err
+	}
+	content = decision.Message
+
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(encoded))
+	roomID := messageRoomID(msg)
+	if err := s.usage.Reserve(ctx, msg.SenderID, roomID, usage.KindMessages, size); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.store.EditMessage(ctx, msg, content, user.ID, time.Now().UTC())
+	if err != nil {
+		s.usage.Release(ctx, msg.SenderID, roomID, usage.KindMessages, size)
+		return nil, err
+	}
+	Delivered(s.moderator, decision, updated.ID)
+	s.notify(updated, participants, user.ID,
+		events.InThread(events.NewMessageUpdatedEvent(updated.ID, user.ID, user.Name, content, *updated.EditedAt), updated.ParentID))
+	return updated, nil
+}
+
+// DeleteMessage replaces a message sent by user (or by anyone in their tenant, for admins)
+// with a tombstone, releasing the storage its versions and attachments used and deleting the
+// attached files. The other participants connected
+// to this replica get a message_deleted event.
+func (s *Service) DeleteMessage(ctx context.Context, user *models.User, messageID string) (*store.Message, error) {
+	msg, participants, err := s.changeable(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tombstone(ctx, user, msg, participants)
+}
+
+// tombstone replaces a message with a tombstone deleted by user and notifies the participants
+func (s *Service) tombstone(ctx context.Context, user *models.User, msg *store.Message, participants []string) (*store.Message, error) {
+	deleted, err := s.store.DeleteMessage(ctx, msg, user.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	s.release(ctx, msg)
+
+	s.notify(deleted, participants, user.ID,
+		events.InThread(events.NewMessageDeletedEvent(deleted.ID, user.ID, user.Name), deleted.ParentID))
+	return deleted, nil
+}
+
+// changeable loads a message the user may edit or delete, with its conversation's participants.
+// Participants other than the sender get ErrNotSender; anyone else gets ErrMessageNotFound.
+func (s *Service) changeable(ctx context.Context, user *models.User, messageID string) (*store.Message, []string, error) {
+	if s.tenants.IsReadOnly(user.TenantID) {
+		return nil, nil, ErrTenantReadOnly
+	}
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	participants, err := s.participants(ctx, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	admin := (user.HasRole(models.RoleAdmin) || user.HasRole(models.RoleTenantAdmin)) && msg.TenantID == user.TenantID
+	if msg.SenderID != user.ID && !admin {
+		for _, id := range participants {
+			if id == user.ID {
+				return nil, nil, ErrNotSender
+			}
+		}
+		return nil, nil, ErrMessageNotFound
+	}
+	if msg.DeletedAt != nil {
+		return nil, nil, ErrMessageDeleted
+	}
+	return msg, participants, nil
+}
+
+// messageRoomID returns the ID of the room msg was sent in, or "" for direct messages
+func messageRoomID(msg *store.Message) string {
+	roomID, _ := strings.CutPrefix(msg.ConversationID, store.RoomConversationID(""))
+	return roomID
+}
+
+// release releases the storage used by the versions and attachments of a message that is
+// being deleted, and deletes the attached files
+func (s *Service) release(ctx context.Context, msg *store.Message) {
+	var size int64
+	for _, content := range append([]*models.MessageContent{msg.Message}, revisionContents(msg)...) {
+		if content == nil { // Deleted already
+			continue
+		}
+		if encoded, err := json.Marshal(content); err == nil {
+			size += int64(len(encoded))
+		}
+	}
+	s.usage.Release(ctx, msg.SenderID, messageRoomID(msg), usage.KindMessages, size)
+	s.releaseAttachments(ctx, msg)
+}
+
+// revisionContents returns the content of each earlier version of msg
+func revisionContents(msg *store.Message) []*models.MessageContent {
+	contents := make([]*models.MessageContent, len(msg.Revisions))
+	for i, revision := range msg.Revisions {
+		contents[i] = revision.Message
+	}
+	return contents
+}
@@ -0,0 +1,83 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// ErrConversationNotFound is returned when exporting a conversation that doesn't exist or
+// belongs to another tenant
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// exportPageSize is how many messages an export reads from the store at a time
+const exportPageSize = store.MaxPageSize
+
+// errTenantFound stops the scan of a direct conversation once a message from the exporting
+// user's tenant is found
+var errTenantFound = errors.New("tenant found")
+
+// Export calls each with every persisted message of a conversation, thread replies and
+// deleted messages included, oldest first. Users may only export the conversations of their
+// own tenant: its rooms, and the direct conversations one of its users sent a message in;
+// others get ErrConversationNotFound. An error returned by each stops the export.
+func (s *Service) Export(ctx context.Context, user *models.User, conversationID string, each func(msg *store.Message) error) error {
+	if err := s.exportable(ctx, user, conversationID); err != nil {
+		return err
+	}
+	return s.scan(ctx, conversationID, each)
+}
+
+// exportable checks that a conversation belongs to the user's tenant
+func (s *Service) exportable(ctx context.Context, user *models.User, conversationID string) error {
+	if roomID, ok := strings.CutPrefix(conversationID, store.RoomConversationID("")); ok {
+		room, err := s.store.Room(ctx, roomID)
+		if errors.Is(err, store.ErrRoomNotFound) || (err == nil && room.TenantID != user.TenantID) {
+			return ErrConversationNotFound
+		}
+		return err
+	}
+	if !strings.HasPrefix(conversationID, "dm:") {
+		return ErrConversationNotFound
+	}
+
+	// Direct conversations have no record of their own, and may be between tenants
+	err := s.scan(ctx, conversationID, func(msg *store.Message) error {
+		if msg.TenantID == user.TenantID {
+			return errTenantFound
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errTenantFound):
+		return nil
+	case err == nil:
+		return ErrConversationNotFound
+	default:
+		return err
+	}
+}
+
+// scan calls each with the messages of a conversation, oldest first, a page at a time
+func (s *Service) scan(ctx context.Context, conversationID string, each func(msg *store.Message) error) error {
+	var after time.Time
+	for {
+		page, err := s.store.ConversationMessages(ctx, conversationID, after, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range page {
+			if err := each(msg); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+		after = page[len(page)-1].CreatedAt
+	}
+}
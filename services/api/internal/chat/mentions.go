@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"strings"
+
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// ResolveMentions resolves the @handles in a message's text against its conversation's
+// participants: a handle names the participant with that user ID, or with that email local
+// part, ignoring case. Handles naming anyone else are left as plain text.
+func ResolveMentions(message *models.MessageContent, participants []*store.Member) []*store.Mention {
+	var mentions []*store.Mention
+	for _, handle := range models.ParseMentions(message.Text) {
+		for _, member := range participants {
+			local, _, _ := strings.Cut(member.Email, "@")
+			if strings.EqualFold(handle, member.UserID) || (local != "" && strings.EqualFold(handle, local)) {
+				if !isMentioned(mentions, member.UserID) {
+					mentions = append(mentions, &store.Mention{UserID: member.UserID, Name: member.Name})
+				}
+				break
+			}
+		}
+	}
+	return mentions
+}
+
+// NotifyMentions sends a mention event to each mentioned user other than the sender
+func NotifyMentions(manager *events.Manager, msg *store.Message, event *events.Event) {
+	ids := make([]string, 0, len(msg.Mentions))
+	for _, mention := range msg.Mentions {
+		if mention.UserID != msg.SenderID {
+			ids = append(ids, mention.UserID)
+		}
+	}
+	if len(ids) > 0 {
+		manager.SendEventToUsers(ids, event)
+	}
+}
+
+// isMentioned reports whether mentions include the user
+func isMentioned(mentions []*store.Mention, userID string) bool {
+	for _, mention := range mentions {
+		if mention.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
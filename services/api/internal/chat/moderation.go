@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"context"
+
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/store"
+)
+
+// Moderate screens a message sender wants to deliver to a conversation. Without a moderator
+// the message is delivered as is.
+func Moderate(ctx context.Context, moderator *moderation.Moderator, sender *models.User, conversationID string, message *models.MessageContent) (*moderation.Decision, error) {
+	if moderator == nil {
+		return &moderation.Decision{Message: message}, nil
+	}
+	return moderator.Screen(ctx, &moderation.Request{
+		SenderID:       sender.ID,
+		TenantID:       sender.TenantID,
+		ConversationID: conversationID,
+		Message:        message,
+	})
+}
+
+// Delivered reports the flags raised while screening a message once it has been delivered
+func Delivered(moderator *moderation.Moderator, decision *moderation.Decision, messageID string) {
+	if moderator != nil {
+		moderator.Delivered(decision, messageID)
+	}
+}
+
+// Remove replaces a message a reviewer took down from the moderation quarantine with a
+// tombstone, whoever sent it. The participants connected to this replica get a
+// message_deleted event.
+func (s *Service) Remove(ctx context.Context, reviewer *models.User, messageID string) (*store.Message, error) {
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	participants, err := s.participants(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.tombstone(ctx, reviewer, msg, participants)
+}
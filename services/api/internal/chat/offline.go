@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"api-service/internal/deadletter"
+	"api-service/internal/models"
+)
+
+// errOfflineQueueFull is the reason a notification dropped by a full queue is dead-lettered
+var errOfflineQueueFull = errors.New("notification queue full")
+
+// offlineLetter is the payload of a dead-lettered offline notification
+type offlineLetter struct {
+	SenderID   string                 `json:"senderId"`
+	SenderName string                 `json:"senderName"`
+	TenantID   string                 `json:"tenantId,omitempty"`
+	MessageID  string                 `json:"messageId"`
+	Message    *models.MessageContent `json:"message"`
+}
+
+// SetDeadLetters keeps the offline notifications dropped by a notifier's full queue in
+// deadLetters, which queues them with the same notifier again when redriven
+func (s *Service) SetDeadLetters(deadLetters *deadletter.Queue) {
+	s.letters = deadLetters
+	deadLetters.Handle(deadletter.SourceOffline, s.redriveOffline)
+}
+
+// notifyOffline tells a recipient who isn't connected about a message through every offline
+// notifier
+func (s *Service) notifyOffline(sender *models.User, recipientID, messageID string, message *models.MessageContent) {
+	for _, offline := range s.offline {
+		if offline.notifier.NotifyOffline(sender, recipientID, messageID, message) || s.letters == nil {
+			continue
+		}
+		payload, err := json.Marshal(offlineLetter{
+			SenderID:   sender.ID,
+			SenderName: sender.Name,
+			TenantID:   sender.TenantID,
+			MessageID:  messageID,
+			Message:    message,
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to encode a dropped %s notification: %v", offline.name, err)
+			continue
+		}
+		s.letters.Add(deadletter.Letter{
+			Source:   deadletter.SourceOffline,
+			Type:     offline.name,
+			Target:   recipientID,
+			Attempts: 1,
+			Error:    errOfflineQueueFull.Error(),
+			Payload:  payload,
+		})
+	}
+}
+
+// redriveOffline queues a dead-lettered notification with its notifier again
+func (s *Service) redriveOffline(_ context.Context, letter *deadletter.Letter) error {
+	var payload offlineLetter
+	if err := json.Unmarshal(letter.Payload, &payload); err != nil {
+		return fmt.Errorf("malformed dead letter: %w", err)
+	}
+	sender := &models.User{ID: payload.SenderID, Name: payload.SenderName, TenantID: payload.TenantID}
+	for _, offline := range s.offline {
+		if offline.name != letter.Type {
+			continue
+		}
+		if !offline.notifier.NotifyOffline(sender, letter.Target, payload.MessageID, payload.Message) {
+			return errOfflineQueueFull
+		}
+		return nil
+	}
+	return fmt.Errorf("%s notifications are no longer enabled", letter.Type)
+}
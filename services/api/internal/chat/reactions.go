@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"context"
+	"errors"
+
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// MaxReactionKinds bounds the distinct emoji on one message
+const MaxReactionKinds = 50
+
+var (
+	ErrReactionNotFound = errors.New("reaction not found")
+	ErrTooManyReactions = errors.New("message has too many distinct reactions")
+)
+
+// React adds the user's emoji reaction to a message of a conversation they take part in and
+// returns the message's reactions. The other participants connected to this replica get a
+// reaction_added event; reacting again with the same emoji changes nothing.
+func (s *Service) React(ctx context.Context, user *models.User, messageID, emoji string) ([]*store.Reaction, error) {
+	msg, participants, err := s.reactable(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Reactions) >= MaxReactionKinds && !hasEmoji(msg.Reactions, emoji) {
+		return nil, ErrTooManyReactions
+	}
+
+	reactions, added, err := s.store.AddReaction(ctx, msg, emoji, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		s.notifyReaction(msg, participants, events.EventTypeReactionAdded, emoji, user, reactions)
+	}
+	return reactions, nil
+}
+
+// Unreact removes the user's emoji reaction to a message and returns the message's reactions.
+// The other connected participants get a reaction_removed event.
+func (s *Service) Unreact(ctx context.Context, user *models.User, messageID, emoji string) ([]*store.Reaction, error) {
+	msg, participants, err := s.reactable(ctx, user, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, removed, err := s.store.RemoveReaction(ctx, msg, emoji, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return nil, ErrReactionNotFound
+	}
+	s.notifyReaction(msg, participants, events.EventTypeReactionRemoved, emoji, user, reactions)
+	return reactions, nil
+}
+
+// reactable loads a message the user may react to, with its conversation's participants
+func (s *Service) reactable(ctx context.Context, user *models.User, messageID string) (*store.Message, []string, error) {
+	if s.tenants.IsReadOnly(user.TenantID) {
+		return nil, nil, ErrTenantReadOnly
+	}
+	msg, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, nil, ErrMessageDeleted
+	}
+	participants, err := s.participants(ctx, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range participants {
+		if id == user.ID {
+			return msg, participants, nil
+		}
+	}
+	return nil, nil, ErrMessageNotFound
+}
+
+// notifyReaction sends a reaction event to the participants other than the reacting user
+func (s *Service) notifyReaction(msg *store.Message, participants []string, eventType events.EventType, emoji string, user *models.User, reactions []*store.Reaction) {
+	count := 0
+	for _, reaction := range reactions {
+		if reaction.Emoji == emoji {
+			count = reaction.Count
+		}
+	}
+	s.notify(msg, participants, user.ID, events.NewReactionEvent(eventType, msg.ID, emoji, user.ID, user.Name, count))
+}
+
+// hasEmoji reports whether reactions include emoji
+func hasEmoji(reactions []*store.Reaction, emoji string) bool {
+	for _, reaction := range reactions {
+		if reaction.Emoji == emoji {
+			return true
+		}
+	}
+	return false
+}
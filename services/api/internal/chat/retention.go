@@ -0,0 +1,20 @@
+package chat
+
+import (
+	"context"
+
+	"api-service/internal/store"
+)
+
+// Purge removes messages for good, e.g. once they outlive their retention policy, releasing
+// the storage they used and deleting their attachments' files. Unlike DeleteMessage, no
+// tombstone is left and participants aren't notified.
+func (s *Service) Purge(ctx context.Context, msgs []*store.Message) error {
+	if err := s.store.PurgeMessages(ctx, msgs); err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		s.release(ctx, msg)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// Package chat holds the messaging operations shared by the HTTP API and the gRPC service
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"api-service/internal/deadletter"
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/store"
+	"api-service/internal/tenants"
+	"api-service/internal/usage"
+)
+
+var (
+	ErrRecipientUnavailable = errors.New("user not connected or unreachable")
+	ErrTenantReadOnly       = errors.New("tenant is frozen and read-only")
+	ErrParentNotFound       = errors.New("parent message not found in this conversation")
+	ErrMessageDeleted       = store.ErrMessageDeleted
+	// ErrMessageNotFound is also returned for messages the caller can't read
+	ErrMessageNotFound = store.ErrMessageNotFound
+)
+
+// Thread is a message and a page of its replies
+type Thread struct {
+	Parent  *store.Message   `json:"parent"`
+	Replies []*store.Message `json:"replies"` // Newest first
+}
+
+// OfflineNotifier tells recipients about direct messages sent to them while they're offline
+type OfflineNotifier interface {
+	// NotifyOffline queues a notification without blocking, reporting false when it was
+	// dropped because the queue is full
+	NotifyOffline(sender *models.User, recipientID, messageID string, message *models.MessageContent) bool
+}
+
+// offlineNotifier is an offline notifier and the name its dead letters carry
+type offlineNotifier struct {
+	name     string
+	notifier OfflineNotifier
+}
+
+// Service sends messages and exposes the realtime event stream
+type Service struct {
+	manager   *events.Manager
+	tenants   *tenants.Registry
+	usage     *usage.Tracker
+	store     store.Store
+	acks      *AckTracker           // Nil when acknowledgments are disabled
+	blobs     AttachmentBlobs       // Nil when attachments are disabled
+	moderator *moderation.Moderator // Nil when moderation is disabled
+	offline   []offlineNotifier
+	letters   *deadletter.Queue // Nil when dropped notifications aren't kept
+}
+
+// NewService creates a new chat service
+func NewService(manager *events.Manager, registry *tenants.Registry, tracker *usage.Tracker, messages store.Store) *Service {
+	return &Service{
+		manager: manager,
+		tenants: registry,
+		usage:   tracker,
+		store:   messages,
+	}
+}
+
+// SetAckTracker turns on delivery acknowledgments for messages sent to v2 clients (v1 events
+// carry no ID to acknowledge)
+func (s *Service) SetAckTracker(acks *AckTracker) {
+	s.acks = acks
+}
+
+// SetModerator screens the content of sent and edited messages before it is delivered
+func (s *Service) SetModerator(moderator *moderation.Moderator) {
+	s.moderator = moderator
+}
+
+// AddOfflineNotifier tells recipients about the messages that couldn't be delivered because
+// they weren't connected. name identifies the notifier in dead letters.
+func (s *Service) AddOfflineNotifier(name string, notifier OfflineNotifier) {
+	s.offline = append(s.offline, offlineNotifier{name: name, notifier: notifier})
+}
+
+// SendMessage delivers a message from sender to a connected user, persists it and returns its
+// ID. A non-empty parentID makes it a reply in the thread of an earlier message of their
+// conversation. A mentioned recipient also gets a mention event. Message bytes count against the sender's storage quota; a *usage.QuotaError
+// is returned when it's exhausted. A *moderation.RejectedError is returned when moderation
+// refuses the message; it may also deliver the message redacted. ErrBlocked is returned when
+// the recipient blocked the sender; a recipient who muted them keeps the message in the
+// conversation without being shown it. A recipient who isn't connected gets
+// ErrRecipientUnavailable, and the offline notifiers tell them about the message.
+func (s *Service) SendMessage(ctx context.Context, sender *models.User, to string, message *models.MessageContent, parentID string) (string, error) {
+	if s.tenants.IsReadOnly(sender.TenantID) {
+		return "", ErrTenantReadOnly
+	}
+	blocked, err := s.blockKind(ctx, to, sender.ID)
+	if err != nil {
+		return "", err
+	}
+	if blocked == store.BlockKindBlock {
+		return "", ErrBlocked
+	}
+	conversationID := store.ConversationID(sender.ID, to)
+	threadID, err := ThreadRoot(ctx, s.store, conversationID, parentID)
+	if err != nil {
+		return "", err
+	}
+	decision, err := Moderate(ctx, s.moderator, sender, conversationID, message)
+	if err != nil {
+		return "", err
+	}
+	message = decision.Message
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	size := int64(len(encoded))
+	if err := s.usage.Reserve(ctx, sender.ID, "", usage.KindMessages, size); err != nil {
+		return "", err
+	}
+
+	if message.IsNewerSchema() {
+		log.Printf("Relaying message with newer schema version %d (server supports %d)", message.SchemaVersion, models.MessageSchemaVersion)
+	}
+
+	s.manager.MarkActive(sender.ID)
+	event := events.InThread(events.NewChatEvent(sender.ID, sender.Name, sender.Email, message), threadID)
+	protocol, _ := s.manager.UserProtocol(to)
+	if !s.manager.SendEventToUser(to, event) {
+		s.usage.Release(ctx, sender.ID, "", usage.KindMessages, size)
+		if _, connected := s.manager.Client(to); !connected && blocked != store.BlockKindMute {
+			s.notifyOffline(sender, to, event.ID, message)
+		}
+		return "", ErrRecipientUnavailable
+	}
+	// The manager withholds a muted sender's message, so there's no ack to wait for
+	if s.acks != nil && protocol == events.ProtocolV2 && blocked != store.BlockKindMute {
+		s.acks.Track(event, sender.ID, to)
+	}
+
+	msg := &store.Message{
+		ID:             event.ID,
+		ConversationID: conversationID,
+		SenderID:       sender.ID,
+		SenderName:     sender.Name,
+		RecipientID:    to,
+		TenantID:       sender.TenantID,
+		ParentID:       threadID,
+		Message:        message,
+		Mentions:       ResolveMentions(message, s.directParticipants(sender, to)),
+		CreatedAt:      event.Timestamp,
+	}
+	NotifyMentions(s.manager, msg, events.InThread(events.NewMentionEvent(msg.ID, sender.ID, sender.Name, message), threadID))
+	Delivered(s.moderator, decision, msg.ID)
+
+	// The message has been delivered, so a storage failure is logged rather than reported
+	// to the sender (who would otherwise send it again)
+	if err := s.store.SaveMessage(ctx, msg); err != nil {
+		log.Printf("⚠️  Failed to persist message %s: %v", event.ID, err)
+	}
+
+	log.Printf("Message sent from %s to %s", sender.Name, to)
+	return event.ID, nil
+}
+
+// Ack acknowledges receipt of a message by its recipient
+func (s *Service) Ack(recipient *models.User, messageID string) error {
+	if s.acks == nil {
+		return ErrMessageNotPending
+	}
+	return s.acks.Ack(recipient.ID, messageID)
+}
+
+// History returns up to limit messages exchanged between user and another user, sent
+// before the given time (zero for the latest), newest first
+func (s *Service) History(ctx context.Context, user *models.User, with string, before time.Time, limit int) ([]*store.Message, error) {
+	return s.store.Messages(ctx, store.ConversationID(user.ID, with), before, limit)
+}
+
+// Thread returns a message of a conversation the user takes part in (a direct conversation
+// or a room they're a member of) with up to limit of its replies sent before the given time
+// (zero for the latest). For a reply, the thread it belongs to is returned.
+func (s *Service) Thread(ctx context.Context, user *models.User, messageID string, before time.Time, limit int) (*Thread, error) {
+	parent, err := s.store.Message(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.ParentID != "" {
+		if parent, err = s.store.Message(ctx, parent.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	if ok, err := s.canRead(ctx, user, parent); err != nil || !ok {
+		if err == nil {
+			err = ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	replies, err := s.store.Replies(ctx, parent.ConversationID, parent.ID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Thread{Parent: parent, Replies: replies}, nil
+}
+
+// canRead reports whether user takes part in the conversation of msg
+func (s *Service) canRead(ctx context.Context, user *models.User, msg *store.Message) (bool, error) {
+	participants, err := s.participants(ctx, msg)
+	for _, id := range participants {
+		if id == user.ID {
+			return true, err
+		}
+	}
+	return false, err
+}
+
+// participants returns the IDs of the users taking part in the conversation of msg: the
+// sender and recipient of a direct message, or the members of a room
+func (s *Service) participants(ctx context.Context, msg *store.Message) ([]string, error) {
+	roomID, ok := strings.CutPrefix(msg.ConversationID, store.RoomConversationID(""))
+	if !ok {
+		return []string{msg.SenderID, msg.RecipientID}, nil
+	}
+	members, err := s.store.Members(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = member.UserID
+	}
+	return ids, nil
+}
+
+// notify sends an event about msg to the participants of its conversation other than
+// except (the user who caused it). Events about room messages name the room.
+func (s *Service) notify(msg *store.Message, participants []string, except string, event *events.Event) {
+	if roomID, ok := strings.CutPrefix(msg.ConversationID, store.RoomConversationID("")); ok {
+		events.InRoom(event, roomID)
+	}
+
+	others := make([]string, 0, len(participants))
+	for _, id := range participants {
+		if id != except {
+			others = append(others, id)
+		}
+	}
+	s.manager.SendEventToUsers(others, event)
+}
+
+// directParticipants returns the sender and recipient of a direct message, with the name and
+// email of the recipient's session (the recipient is connected, or the send would have failed)
+func (s *Service) directParticipants(sender *models.User, to string) []*store.Member {
+	recipient := &store.Member{UserID: to, Name: to}
+	for _, session := range s.manager.Sessions() {
+		if session.UserID == to {
+			recipient.Name, recipient.Email = session.Name, session.Email
+			break
+		}
+	}
+	return []*store.Member{{UserID: sender.ID, Name: sender.Name, Email: sender.Email}, recipient}
+}
+
+// ThreadRoot returns the ID of the thread a reply to parentID joins: the parent itself, or
+// the root of the parent's thread when replying to a reply, so threads stay one level deep.
+// It returns "" for an empty parentID, and ErrParentNotFound unless the parent belongs to
+// the conversation.
+func ThreadRoot(ctx context.Context, messages store.Store, conversationID, parentID string) (string, error) {
+	if parentID == "" {
+		return "", nil
+	}
+	parent, err := messages.Message(ctx, parentID)
+	if errors.Is(err, store.ErrMessageNotFound) || (err == nil && parent.ConversationID != conversationID) {
+		return "", ErrParentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if parent.ParentID != "" {
+		return parent.ParentID, nil
+	}
+	return parent.ID, nil
+}
+
+// ActiveUsers returns the currently connected users
+func (s *Service) ActiveUsers() []map[string]string {
+	return s.manager.GetActiveUsers()
+}
+
+// Subscribe connects user to the event stream without a WebSocket. Events arrive
+// v2-encoded on the returned channel, which is closed when the subscription ends;
+// call unsubscribe when the caller goes away.
+func (s *Service) Subscribe(user *models.User) (stream <-chan []byte, unsubscribe func()) {
+	client := &events.Client{
+		ID:       user.ID,
+		Name:     user.Name,
+		Email:    user.Email,
+		TenantID: user.TenantID,
+		Protocol: events.ProtocolV2,
+		User:     user,
+	}
+	return s.manager.Subscribe(client, s.manager.SendBuffer()), func() { s.manager.UnregisterClient(client) }
+}
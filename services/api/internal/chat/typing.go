@@ -0,0 +1,24 @@
+package chat
+
+import (
+	"context"
+
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// Typing tells a user that the sender started or stopped typing in their conversation.
+// Typing indicators aren't persisted; nothing is sent to a user who blocked the sender or
+// isn't connected, and the sender isn't told either way.
+func (s *Service) Typing(ctx context.Context, sender *models.User, to string, typing bool) error {
+	blocked, err := s.blockKind(ctx, to, sender.ID)
+	if err != nil {
+		return err
+	}
+	if blocked == store.BlockKindBlock {
+		return nil
+	}
+	s.manager.SendEventToUser(to, events.NewTypingEvent(sender.ID, sender.Name, typing))
+	return nil
+}
@@ -0,0 +1,160 @@
+package clienterrors
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBuckets caps the number of distinct tenant/version/kind combinations tracked
+	maxBuckets = 1000
+	// maxSamples is the number of recent sampled reports kept per bucket
+	maxSamples = 5
+	// maxMessageLength truncates reported messages and stacks
+	maxMessageLength = 1024
+
+	// overflowValue replaces tenant/version values once maxBuckets is reached
+	overflowValue = "other"
+)
+
+// Report is a client-side error or WebSocket disconnect reported by a frontend
+type Report struct {
+	Kind       string    `json:"kind"`       // e.g. "js_error", "ws_disconnect"
+	AppVersion string    `json:"appVersion"` // Frontend build version
+	TenantID   string    `json:"tenantId"`
+	Message    string    `json:"message"`
+	Stack      string    `json:"stack,omitempty"`
+	CloseCode  int       `json:"closeCode,omitempty"` // WebSocket close code for disconnects
+	URL        string    `json:"url,omitempty"`
+	ReportedAt time.Time `json:"reportedAt"`
+}
+
+// bucketKey groups reports for aggregation
+type bucketKey struct {
+	TenantID   string
+	AppVersion string
+	Kind       string
+}
+
+// bucket holds the aggregate for one tenant/version/kind
+type bucket struct {
+	count    int64
+	lastSeen time.Time
+	samples  []Report
+}
+
+// BucketStats is the aggregate for one tenant/version/kind combination
+type BucketStats struct {
+	TenantID   string    `json:"tenantId"`
+	AppVersion string    `json:"appVersion"`
+	Kind       string    `json:"kind"`
+	Count      int64     `json:"count"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Samples    []Report  `json:"samples"`
+}
+
+// Stats is a snapshot of all aggregated client errors
+type Stats struct {
+	Total      int64         `json:"total"`
+	SampleRate float64       `json:"sampleRate"`
+	Buckets    []BucketStats `json:"buckets"`
+}
+
+// Aggregator counts client error reports per tenant and frontend version.
+// Every report is counted; only a sampled fraction is kept in full for inspection.
+type Aggregator struct {
+	sampleRate float64
+	buckets    map[bucketKey]*bucket
+	total      int64
+	mu         sync.Mutex
+}
+
+// NewAggregator creates an aggregator keeping the given fraction (0-1) of reports as samples
+func NewAggregator(sampleRate float64) *Aggregator {
+	if sampleRate < 0 {
+		sampleRate = 0
+	}
+	if sampleRate > 1 {
+		sampleRate = 1
+	}
+	return &Aggregator{
+		sampleRate: sampleRate,
+		buckets:    make(map[bucketKey]*bucket),
+	}
+}
+
+// Record adds a report to the aggregate
+func (a *Aggregator) Record(report Report) {
+	report.Message = truncate(report.Message)
+	report.Stack = truncate(report.Stack)
+	report.URL = truncate(report.URL)
+	if report.ReportedAt.IsZero() {
+		report.ReportedAt = time.Now().UTC()
+	}
+
+	key := bucketKey{TenantID: report.TenantID, AppVersion: report.AppVersion, Kind: report.Kind}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b, ok := a.buckets[key]
+	if !ok {
+		if len(a.buckets) >= maxBuckets {
+			key = bucketKey{TenantID: overflowValue, AppVersion: overflowValue, Kind: report.Kind}
+			b = a.buckets[key]
+		}
+		if b == nil {
+			b = &bucket{}
+			a.buckets[key] = b
+		}
+	}
+
+	a.total++
+	b.count++
+	b.lastSeen = report.ReportedAt
+
+	if a.sampleRate > 0 && rand.Float64() < a.sampleRate {
+		b.samples = append(b.samples, report)
+		if len(b.samples) > maxSamples {
+			b.samples = b.samples[len(b.samples)-maxSamples:]
+		}
+		log.Printf("Client error (%s) from tenant=%s version=%s: %s", report.Kind, report.TenantID, report.AppVersion, report.Message)
+	}
+}
+
+// Stats returns a snapshot of the aggregate, most frequent first
+func (a *Aggregator) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := Stats{
+		Total:      a.total,
+		SampleRate: a.sampleRate,
+		Buckets:    make([]BucketStats, 0, len(a.buckets)),
+	}
+	for key, b := range a.buckets {
+		stats.Buckets = append(stats.Buckets, BucketStats{
+			TenantID:   key.TenantID,
+			AppVersion: key.AppVersion,
+			Kind:       key.Kind,
+			Count:      b.count,
+			LastSeen:   b.lastSeen,
+			Samples:    append([]Report{}, b.samples...),
+		})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Count > stats.Buckets[j].Count
+	})
+	return stats
+}
+
+// truncate limits a string to maxMessageLength bytes
+func truncate(s string) string {
+	if len(s) > maxMessageLength {
+		return s[:maxMessageLength]
+	}
+	return s
+}
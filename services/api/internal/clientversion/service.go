@@ -0,0 +1,172 @@
+package clientversion
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"api-service/internal/events"
+	"api-service/internal/tenants"
+)
+
+// CloseOutdated is the WebSocket close code sent to clients below the minimum version
+// (application range; mirrors HTTP 426 Upgrade Required)
+const CloseOutdated = 4426
+
+// Decision is the outcome of checking a client's version against a policy
+type Decision string
+
+const (
+	Allow  Decision = "allow"  // Up to date
+	Warn   Decision = "warn"   // Connects, but is asked to upgrade
+	Refuse Decision = "refuse" // Below the minimum version
+)
+
+// Service gates WebSocket connections on the frontend app version. Each tenant's policy
+// replaces the service-wide default policy when set.
+type Service struct {
+	defaults tenants.ClientVersionPolicy
+	tenants  *tenants.Registry
+	manager  *events.Manager
+}
+
+// NewService creates a new client version service
+func NewService(defaults tenants.ClientVersionPolicy, registry *tenants.Registry, manager *events.Manager) (*Service, error) {
+	if err := ValidatePolicy(defaults); err != nil {
+		return nil, err
+	}
+	return &Service{
+		defaults: defaults,
+		tenants:  registry,
+		manager:  manager,
+	}, nil
+}
+
+// ValidatePolicy checks that a policy's versions parse and are consistent
+func ValidatePolicy(policy tenants.ClientVersionPolicy) error {
+	var minimum, recommended Version
+	var err error
+	if policy.Minimum != "" {
+		if minimum, err = Parse(policy.Minimum); err != nil {
+			return fmt.Errorf("minimum: %w", err)
+		}
+	}
+	if policy.Recommended != "" {
+		if recommended, err = Parse(policy.Recommended); err != nil {
+			return fmt.Errorf("recommended: %w", err)
+		}
+		if policy.Minimum != "" && recommended.Compare(minimum) < 0 {
+			return fmt.Errorf("recommended version %s is older than the minimum %s", policy.Recommended, policy.Minimum)
+		}
+	}
+	if policy.UpgradeURL != "" && !strings.HasPrefix(policy.UpgradeURL, "https://") && !strings.HasPrefix(policy.UpgradeURL, "http://") {
+		return fmt.Errorf("upgradeUrl must be an http(s) URL")
+	}
+	return nil
+}
+
+// Defaults returns the service-wide policy
+func (s *Service) Defaults() tenants.ClientVersionPolicy {
+	return s.defaults
+}
+
+// PolicyFor returns the policy that applies to a tenant's clients
+func (s *Service) PolicyFor(tenantID string) tenants.ClientVersionPolicy {
+	if tenant, ok := s.tenants.Get(tenantID); ok && tenant.ClientVersions != nil {
+		return *tenant.ClientVersions
+	}
+	return s.defaults
+}
+
+// Check decides whether a client of the tenant reporting appVersion may connect
+func (s *Service) Check(tenantID, appVersion string) Decision {
+	return Evaluate(s.PolicyFor(tenantID), appVersion)
+}
+
+// Evaluate checks appVersion against a policy. Clients that don't report a (parseable)
+// version are warned, or refused when the policy rejects unversioned clients.
+func Evaluate(policy tenants.ClientVersionPolicy, appVersion string) Decision {
+	if policy.Minimum == "" && policy.Recommended == "" {
+		return Allow
+	}
+
+	version, err := Parse(appVersion)
+	if appVersion == "" || err != nil {
+		if policy.RejectUnversioned {
+			return Refuse
+		}
+		return Warn
+	}
+
+	if policy.Minimum != "" {
+		if minimum, err := Parse(policy.Minimum); err == nil && version.Compare(minimum) < 0 {
+			return Refuse
+		}
+	}
+	if policy.Recommended != "" {
+		if recommended, err := Parse(policy.Recommended); err == nil && version.Compare(recommended) < 0 {
+			return Warn
+		}
+	}
+	return Allow
+}
+
+// UpgradeEvent builds the client_upgrade event for a client reporting appVersion
+func UpgradeEvent(policy tenants.ClientVersionPolicy, appVersion string, required bool) *events.Event {
+	return events.NewClientUpgradeEvent(events.ClientUpgrade{
+		Required:           required,
+		CurrentVersion:     appVersion,
+		MinimumVersion:     policy.Minimum,
+		RecommendedVersion: policy.Recommended,
+		UpgradeURL:         policy.UpgradeURL,
+	})
+}
+
+// CloseReason is the close frame reason sent to refused clients
+func CloseReason(policy tenants.ClientVersionPolicy) string {
+	if policy.Minimum == "" {
+		return "client version required"
+	}
+	return "client version below minimum " + policy.Minimum
+}
+
+// HandleConnect asks newly connected clients below the recommended version to upgrade
+func (s *Service) HandleConnect(client *events.Client) {
+	policy := s.PolicyFor(client.TenantID)
+	if Evaluate(policy, client.AppVersion) != Warn {
+		return
+	}
+	s.manager.SendEventToUser(client.ID, UpgradeEvent(policy, client.AppVersion, false))
+}
+
+// SetTenantPolicy replaces a tenant's policy (nil restores the default) and forces connected
+// clients that no longer meet it to upgrade: they get a required client_upgrade event and are
+// disconnected with CloseOutdated. Returns the updated tenant and the number of clients disconnected.
+func (s *Service) SetTenantPolicy(ctx context.Context, tenantID string, policy *tenants.ClientVersionPolicy) (*tenants.Tenant, int, error) {
+	if policy != nil {
+		if err := ValidatePolicy(*policy); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	tenant, err := s.tenants.SetClientVersions(ctx, tenantID, policy)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	effective := s.PolicyFor(tenant.ID)
+	forced := 0
+	for _, client := range s.manager.TenantClients(tenant.ID) {
+		if Evaluate(effective, client.AppVersion) != Refuse {
+			continue
+		}
+		s.manager.SendEventToUser(client.ID, UpgradeEvent(effective, client.AppVersion, true))
+		s.manager.CloseClient(client, CloseOutdated, CloseReason(effective))
+		forced++
+	}
+	if forced > 0 {
+		log.Printf("⬆️  Forced %d outdated clients of tenant %s to upgrade", forced, tenant.ID)
+	}
+	return tenant, forced, nil
+}
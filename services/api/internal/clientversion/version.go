@@ -0,0 +1,72 @@
+package clientversion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted numeric app version such as 1.4.2 or 2025.10.1, optionally with a
+// pre-release suffix (1.5.0-beta.2). Build metadata (+abc123) is ignored.
+type Version struct {
+	numbers    []int
+	prerelease string
+}
+
+// Parse parses a version string
+func Parse(value string) (Version, error) {
+	value, _, _ = strings.Cut(strings.TrimPrefix(strings.TrimSpace(value), "v"), "+")
+	core, prerelease, _ := strings.Cut(value, "-")
+	if core == "" {
+		return Version{}, fmt.Errorf("invalid version %q", value)
+	}
+
+	segments := strings.Split(core, ".")
+	if len(segments) > 4 {
+		return Version{}, fmt.Errorf("invalid version %q: too many segments", value)
+	}
+
+	v := Version{numbers: make([]int, len(segments)), prerelease: prerelease}
+	for i, segment := range segments {
+		n, err := strconv.Atoi(segment)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q: segments must be numbers", value)
+		}
+		v.numbers[i] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as or newer than other.
+// Missing segments count as zero, and a pre-release is older than its release.
+func (v Version) Compare(other Version) int {
+	for i := 0; i < len(v.numbers) || i < len(other.numbers); i++ {
+		a, b := segment(v.numbers, i), segment(other.numbers, i)
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	case v.prerelease < other.prerelease:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func segment(numbers []int, i int) int {
+	if i < len(numbers) {
+		return numbers[i]
+	}
+	return 0
+}
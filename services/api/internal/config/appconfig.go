@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"api-service/internal/appconfig"
+	"api-service/internal/identity"
+)
+
+// loadAppConfig reads Azure App Configuration when APP_CONFIG_ENDPOINT or
+// APP_CONFIG_CONNECTION_STRING is set, and sets its settings as defaults over the
+// configuration file's. It returns the store, for refreshing at runtime, or nil when there's
+// none.
+func loadAppConfig() (*appconfig.Store, error) {
+	endpoint := getString("APP_CONFIG_ENDPOINT")
+	connectionString := getString("APP_CONFIG_CONNECTION_STRING")
+	if endpoint == "" && connectionString == "" {
+		return nil, nil
+	}
+
+	// Settings are labeled per environment by default
+	label, _ := parseEnvironment(getString("ENVIRONMENT"))
+	if isSet("APP_CONFIG_LABEL") {
+		label = getString("APP_CONFIG_LABEL")
+	}
+	sentinelKey := "Sentinel"
+	if isSet("APP_CONFIG_SENTINEL_KEY") {
+		sentinelKey = getString("APP_CONFIG_SENTINEL_KEY")
+	}
+
+	store, err := appconfig.New(appconfig.Config{
+		Endpoint:         endpoint,
+		ConnectionString: connectionString,
+		Label:            label,
+		KeyPrefix:        getString("APP_CONFIG_KEY_PREFIX"),
+		SentinelKey:      sentinelKey,
+		RefreshInterval:  getDuration("APP_CONFIG_REFRESH_INTERVAL", 30*time.Second),
+	}, identity.NewManagedIdentity(getString("AZURE_MANAGED_IDENTITY_CLIENT_ID")))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	snapshot, err := store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading App Configuration: %w", err)
+	}
+	for key, value := range snapshot.Settings {
+		if _, ok := snapshot.Secrets[key]; ok {
+			setDefault(key, value, SourceKeyVault)
+		} else {
+			setDefault(key, value, SourceAppConfig)
+		}
+	}
+
+	log.Printf("✅ Loaded App Configuration (label %q): %d settings, %d feature flags", label, len(snapshot.Settings), len(snapshot.Features))
+	return store, nil
+}
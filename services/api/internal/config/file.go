@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultConfigFiles are looked up in the working directory when CONFIG_FILE isn't set
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.json"}
+
+// File is the structured configuration file (YAML or JSON), for settings outgrowing flat
+// environment variables. Each field stands for the variable in its env tag: values from the
+// file replace the built-in defaults, and .env and the environment still override them, so
+// they're validated like any other setting by Load. Unknown keys are rejected.
+type File struct {
+	Server   ServerFile        `mapstructure:"server"`
+	Auth     AuthFile          `mapstructure:"auth"`
+	CORS     CORSFile          `mapstructure:"cors"`
+	Events   EventsFile        `mapstructure:"events"`
+	Features map[string]string `mapstructure:"features" env:"FEATURE_FLAGS"` // Flag -> on, off or a percentage
+}
+
+// ServerFile is the server section of the configuration file
+type ServerFile struct {
+	Port              *string        `mapstructure:"port" env:"PORT"`
+	GRPCPort          *string        `mapstructure:"grpcPort" env:"GRPC_PORT"`
+	WebTransportPort  *string        `mapstructure:"webTransportPort" env:"WEBTRANSPORT_PORT"`
+	Environment       *string        `mapstructure:"environment" env:"ENVIRONMENT"`
+	LogLevel          *string        `mapstructure:"logLevel" env:"LOG_LEVEL"`
+	LogFormat         *string        `mapstructure:"logFormat" env:"LOG_FORMAT"`
+	ReadTimeout       *time.Duration `mapstructure:"readTimeout" env:"READ_TIMEOUT"`
+	ReadHeaderTimeout *time.Duration `mapstructure:"readHeaderTimeout" env:"READ_HEADER_TIMEOUT"`
+	WriteTimeout      *time.Duration `mapstructure:"writeTimeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout       *time.Duration `mapstructure:"idleTimeout" env:"IDLE_TIMEOUT"`
+	HandlerTimeout    *time.Duration `mapstructure:"handlerTimeout" env:"HANDLER_TIMEOUT"`
+	ShutdownTimeout   *time.Duration `mapstructure:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	MaxBodyBytes      *int64         `mapstructure:"maxBodyBytes" env:"MAX_BODY_BYTES"`
+	TLSCertFile       *string        `mapstructure:"tlsCertFile" env:"TLS_CERT_FILE"`
+	TLSKeyFile        *string        `mapstructure:"tlsKeyFile" env:"TLS_KEY_FILE"`
+	SwaggerUI         *bool          `mapstructure:"swaggerUI" env:"SWAGGER_UI_ENABLED"`
+}
+
+// AuthFile is the auth section of the configuration file
+type AuthFile struct {
+	TenantID              *string        `mapstructure:"tenantId" env:"AZURE_TENANT_ID"`
+	ClientID              *string        `mapstructure:"clientId" env:"AZURE_CLIENT_ID"`
+	SkipTokenVerification *bool          `mapstructure:"skipTokenVerification" env:"SKIP_TOKEN_VERIFICATION"`
+	JWKSURL               *string        `mapstructure:"jwksUrl" env:"AUTH_JWKS_URL"`
+	Issuer                *string        `mapstructure:"issuer" env:"AUTH_ISSUER"`
+	JWKSFallbackKeys      *string        `mapstructure:"jwksFallbackKeys" env:"JWKS_FALLBACK_KEYS"`
+	JWKSFallbackAfter     *time.Duration `mapstructure:"jwksFallbackAfter" env:"JWKS_FALLBACK_AFTER"`
+	RoleGroupMappings     *string        `mapstructure:"roleGroupMappings" env:"ROLE_GROUP_MAPPINGS"`
+}
+
+// CORSFile is the cors section of the configuration file
+type CORSFile struct {
+	Policy           *string        `mapstructure:"policy" env:"CORS_POLICY"`
+	AllowedOrigins   []string       `mapstructure:"allowedOrigins" env:"ALLOWED_ORIGINS"`
+	AllowCredentials *bool          `mapstructure:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	AllowedHeaders   []string       `mapstructure:"allowedHeaders" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string       `mapstructure:"exposedHeaders" env:"CORS_EXPOSED_HEADERS"`
+	MaxAge           *time.Duration `mapstructure:"maxAge" env:"CORS_MAX_AGE"`
+	WSAllowAnyOrigin *bool          `mapstructure:"wsAllowAnyOrigin" env:"WS_ALLOW_ANY_ORIGIN"`
+}
+
+// EventsFile is the events section of the configuration file
+type EventsFile struct {
+	ProtocolDefault     *string        `mapstructure:"protocolDefault" env:"EVENT_PROTOCOL_DEFAULT"`
+	ProtocolV2Enabled   *bool          `mapstructure:"protocolV2Enabled" env:"EVENT_PROTOCOL_V2_ENABLED"`
+	SchemaCompat        *bool          `mapstructure:"schemaCompat" env:"EVENT_SCHEMA_COMPAT"`
+	PresenceIdleTimeout *time.Duration `mapstructure:"presenceIdleTimeout" env:"PRESENCE_IDLE_TIMEOUT"`
+	LongPollIdleTimeout *time.Duration `mapstructure:"longPollIdleTimeout" env:"LONG_POLL_IDLE_TIMEOUT"`
+	SSEReplayEvents     *int           `mapstructure:"sseReplayEvents" env:"SSE_REPLAY_EVENTS"`
+	SSEReplayTTL        *time.Duration `mapstructure:"sseReplayTtl" env:"SSE_REPLAY_TTL"`
+	Backplane           BackplaneFile  `mapstructure:"backplane"`
+	WebSocket           WebSocketFile  `mapstructure:"websocket"`
+}
+
+// BackplaneFile is the events.backplane section of the configuration file
+type BackplaneFile struct {
+	Type                *string `mapstructure:"type" env:"BACKPLANE"`
+	Channel             *string `mapstructure:"channel" env:"BACKPLANE_CHANNEL"`
+	RedisURL            *string `mapstructure:"redisUrl" env:"REDIS_URL"`
+	ServiceBusNamespace *string `mapstructure:"serviceBusNamespace" env:"SERVICEBUS_NAMESPACE"`
+	NATSURL             *string `mapstructure:"natsUrl" env:"NATS_URL"`
+}
+
+// WebSocketFile is the events.websocket section of the configuration file
+type WebSocketFile struct {
+	MaxFrameBytes       *int              `mapstructure:"maxFrameBytes" env:"WS_MAX_FRAME_BYTES"`
+	MessagesPerSecond   *float64          `mapstructure:"messagesPerSecond" env:"WS_MESSAGES_PER_SECOND"`
+	Burst               *int              `mapstructure:"burst" env:"WS_BURST"`
+	MaxViolations       *int              `mapstructure:"maxViolations" env:"WS_MAX_VIOLATIONS"`
+	TicketTTL           *time.Duration    `mapstructure:"ticketTtl" env:"WS_TICKET_TTL"`
+	QueryToken          *bool             `mapstructure:"queryToken" env:"WS_QUERY_TOKEN"`
+	TokenExpiry         *string           `mapstructure:"tokenExpiry" env:"WS_TOKEN_EXPIRY"`
+	ReauthNotice        *time.Duration    `mapstructure:"reauthNotice" env:"WS_REAUTH_NOTICE"`
+	ResumeEvents        *int              `mapstructure:"resumeEvents" env:"WS_RESUME_EVENTS"`
+	ResumeTTL           *time.Duration    `mapstructure:"resumeTtl" env:"WS_RESUME_TTL"`
+	FanOutWorkers       *int              `mapstructure:"fanOutWorkers" env:"WS_FANOUT_WORKERS"`
+	SendBuffer          *int              `mapstructure:"sendBuffer" env:"WS_SEND_BUFFER"`
+	ReadBufferBytes     *int              `mapstructure:"readBufferBytes" env:"WS_READ_BUFFER_BYTES"`
+	WriteBufferBytes    *int              `mapstructure:"writeBufferBytes" env:"WS_WRITE_BUFFER_BYTES"`
+	Compression         *bool             `mapstructure:"compression" env:"WS_COMPRESSION"`
+	CompressionLevel    *int              `mapstructure:"compressionLevel" env:"WS_COMPRESSION_LEVEL"`
+	CompressionMinBytes *int              `mapstructure:"compressionMinBytes" env:"WS_COMPRESSION_MIN_BYTES"`
+	OverflowPolicy      *string           `mapstructure:"overflowPolicy" env:"WS_OVERFLOW_POLICY"`
+	OverflowPolicies    map[string]string `mapstructure:"overflowPolicies" env:"WS_OVERFLOW_POLICIES"` // Event type -> policy
+	MaxOverflows        *int              `mapstructure:"maxOverflows" env:"WS_MAX_OVERFLOWS"`
+}
+
+// loadFile reads the configuration file at path, or else the first of defaultConfigFiles that
+// exists, and sets its values as defaults. It returns the file read, or "" when there's none.
+func loadFile(path string) (string, error) {
+	if path == "" {
+		for _, candidate := range defaultConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("checking for %s: %w", candidate, err)
+			}
+		}
+		if path == "" {
+			return "", nil
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return "", fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	var file File
+	if err := v.UnmarshalExact(&file); err != nil {
+		return "", fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	setFileDefaults(reflect.ValueOf(file))
+	return path, nil
+}
+
+// setFileDefaults sets the value of every field present in a File section as the default of
+// the variable in its env tag, formatted as it would be in the environment
+func setFileDefaults(section reflect.Value) {
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Field(i)
+		key := section.Type().Field(i).Tag.Get("env")
+		if key == "" {
+			if field.Kind() == reflect.Struct {
+				setFileDefaults(field)
+			}
+			continue
+		}
+		if field.IsNil() {
+			continue
+		}
+
+		switch value := field.Interface().(type) {
+		case []string:
+			setDefault(key, strings.Join(value, ","), SourceFile)
+		case map[string]string:
+			pairs := make([]string, 0, len(value))
+			for name, setting := range value {
+				pairs = append(pairs, name+"="+setting)
+			}
+			sort.Strings(pairs)
+			setDefault(key, strings.Join(pairs, ","), SourceFile)
+		case *time.Duration:
+			setDefault(key, value.String(), SourceFile)
+		case *float64:
+			setDefault(key, strconv.FormatFloat(*value, 'f', -1, 64), SourceFile)
+		default:
+			setDefault(key, fmt.Sprint(field.Elem().Interface()), SourceFile)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// devDefaults replace the built-in defaults in dev mode (DEV_MODE or --dev), for running the
+// API locally next to a frontend dev server. Like any default, they're overridden by the
+// configuration file, .env and the environment.
+var devDefaults = map[string]string{
+	"LOG_LEVEL":           "debug",
+	"SWAGGER_UI_ENABLED":  "true",
+	"WS_ALLOW_ANY_ORIGIN": "true",
+}
+
+// flagNames are the flags overriding each variable
+var flagNames = map[string]string{
+	"PORT":        "port",
+	"LOG_LEVEL":   "log-level",
+	"CONFIG_FILE": "config",
+	"DEV_MODE":    "dev",
+}
+
+// commandLine is the parsed command-line flags
+var commandLine *pflag.FlagSet
+
+// parseFlags parses the command-line flags and binds them to the variables they override, so
+// flags take precedence over the environment: ./api-service --port 9090 --log-level debug.
+// --help prints the usage and exits.
+func parseFlags(args []string) error {
+	flags := pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+	flags.String("port", "", "HTTP port (PORT, default 8080)")
+	flags.String("log-level", "", "Minimum level of levelled logs: debug, info, warn or error (LOG_LEVEL, default info)")
+	flags.String("config", "", "Configuration file (CONFIG_FILE, default config.yaml, config.yml or config.json if present)")
+	flags.Bool("dev", false, "Local development defaults: debug logs, Swagger UI, WebSockets from any origin (DEV_MODE)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	commandLine = flags
+
+	for key, name := range flagNames {
+		if err := viper.BindPFlag(key, flags.Lookup(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDevDefaults sets devDefaults for the settings the configuration file left unset
+func setDevDefaults() {
+	for key, value := range devDefaults {
+		if !viper.IsSet(key) {
+			setDefault(key, value, SourceDev)
+		}
+	}
+}
+
+// Overridden reports whether a flag, the environment or .env sets the variable, so that
+// changes from lower-precedence sources (e.g. an App Configuration refresh) don't apply to it
+func Overridden(key string) bool {
+	if name, ok := flagNames[key]; ok && commandLine != nil && commandLine.Changed(name) {
+		return true
+	}
+	if _, ok := os.LookupEnv(key); ok {
+		return true
+	}
+	return viper.InConfig(key)
+}
@@ -0,0 +1,59 @@
+package config
+
+import "strings"
+
+// Environments selected by ENVIRONMENT, each with its own default bundle and guard rails
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// environmentAliases are the other names accepted for each environment (e.g. the "stag"
+// Terraform workspace ./env.sh is run with)
+var environmentAliases = map[string]string{
+	"development": EnvDev,
+	"local":       EnvDev,
+	"stag":        EnvStaging,
+	"stage":       EnvStaging,
+	"production":  EnvProd,
+}
+
+// profileDefaults replace the built-in defaults in each environment. Like dev mode's, they're
+// overridden by every other source.
+var profileDefaults = map[string]map[string]string{
+	EnvDev: {
+		"LOG_FORMAT":  "text",
+		"CORS_POLICY": "permissive",
+	},
+	EnvStaging: {
+		"LOG_FORMAT":  "json",
+		"CORS_POLICY": "strict",
+	},
+	EnvProd: {
+		"LOG_FORMAT":  "json",
+		"CORS_POLICY": "strict",
+	},
+}
+
+// parseEnvironment normalizes an ENVIRONMENT value ("" is dev); ok is false for unknown ones
+func parseEnvironment(value string) (environment string, ok bool) {
+	environment = strings.ToLower(strings.TrimSpace(value))
+	if environment == "" {
+		return EnvDev, true
+	}
+	if alias, found := environmentAliases[environment]; found {
+		environment = alias
+	}
+	_, ok = profileDefaults[environment]
+	return environment, ok
+}
+
+// setProfileDefaults sets the environment's defaults for the settings no other source set
+func setProfileDefaults(environment string) {
+	for key, value := range profileDefaults[environment] {
+		if !isSet(key) {
+			setDefault(key, value, SourceProfile)
+		}
+	}
+}
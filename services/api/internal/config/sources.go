@@ -0,0 +1,190 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"api-service/internal/redact"
+)
+
+// Sources of a setting's value, from lowest to highest precedence
+const (
+	SourceDefault   = "default"   // Built-in default (the value isn't reported)
+	SourceProfile   = "profile"   // Default of the ENVIRONMENT's profile
+	SourceDev       = "dev"       // Dev mode default
+	SourceFile      = "file"      // Configuration file
+	SourceAppConfig = "appconfig" // Azure App Configuration
+	SourceKeyVault  = "keyvault"  // Key Vault secret referenced from App Configuration
+	SourceDotEnv    = "dotenv"    // .env file
+	SourceEnv       = "env"       // Environment variable
+	SourceFlag      = "flag"      // Command-line flag
+)
+
+// secretKeys are the settings whose values are credentials
+var secretKeys = map[string]bool{
+	"APP_CONFIG_CONNECTION_STRING": true,
+	"ATTACHMENTS_STORAGE_KEY":      true,
+	"CONTENT_SAFETY_API_KEY":       true,
+	"COSMOS_KEY":                   true,
+	"EVENTGRID_INBOUND_KEY":        true,
+	"INGEST_API_KEYS":              true,
+	"NOTIFICATION_HUBS_CONNECTION": true,
+	"PUSH_VAPID_PRIVATE_KEY":       true,
+	"REDACTION_HASH_KEY":           true,
+	"SEARCH_API_KEY":               true,
+	"TEAMS_WEBHOOK_URL":            true,
+}
+
+// dsnPassword matches the password of a key=value PostgreSQL DSN
+var dsnPassword = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+var (
+	// readKeys are the settings Load read, whether or not they're set
+	readKeys = make(map[string]bool)
+	// defaultSources are the sources of the defaults set over the built-in ones
+	defaultSources = make(map[string]string)
+)
+
+// Setting is the effective value of a setting and where it came from
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"` // Credentials are masked
+	Source string `json:"source"`
+	Secret bool   `json:"secret,omitempty"` // The value is a credential and was masked
+}
+
+// Settings returns every setting read at startup, sorted by key, with credentials masked.
+// Settings from App Configuration have their latest refreshed value.
+func (c *Config) Settings() []Setting {
+	var secrets map[string]string
+	var remote map[string]string
+	if c.AppConfig != nil {
+		snapshot := c.AppConfig.Snapshot()
+		remote, secrets = snapshot.Settings, snapshot.Secrets
+	}
+
+	settings := make([]Setting, 0, len(readKeys))
+	for key := range readKeys {
+		setting := Setting{Key: key, Source: source(key), Value: viper.GetString(key)}
+		if setting.Source == SourceAppConfig || setting.Source == SourceKeyVault {
+			setting.Value = remote[key]
+			if _, ok := secrets[key]; ok {
+				setting.Source = SourceKeyVault
+			}
+		}
+		if setting.Value != "" && (secretKeys[key] || setting.Source == SourceKeyVault) {
+			setting.Value, setting.Secret = redact.Placeholder, true
+		} else {
+			setting.Value = maskCredentials(setting.Value)
+		}
+		settings = append(settings, setting)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// source returns where the value of a setting came from
+func source(key string) string {
+	switch {
+	case commandLine != nil && flagNames[key] != "" && commandLine.Changed(flagNames[key]):
+		return SourceFlag
+	case isEnv(key):
+		return SourceEnv
+	case viper.InConfig(key):
+		return SourceDotEnv
+	case defaultSources[key] != "":
+		return defaultSources[key]
+	default:
+		return SourceDefault
+	}
+}
+
+// isEnv reports whether the environment sets the variable
+func isEnv(key string) bool {
+	_, ok := os.LookupEnv(key)
+	return ok
+}
+
+// getString reads a setting, recording it for Settings (as do the other getters)
+func getString(key string) string {
+	readKeys[key] = true
+	return viper.GetString(key)
+}
+
+// getBool reads a boolean setting
+func getBool(key string) bool {
+	readKeys[key] = true
+	return viper.GetBool(key)
+}
+
+// getInt reads an integer setting
+func getInt(key string) int {
+	readKeys[key] = true
+	return viper.GetInt(key)
+}
+
+// getInt64 reads a 64-bit integer setting
+func getInt64(key string) int64 {
+	readKeys[key] = true
+	return viper.GetInt64(key)
+}
+
+// getFloat64 reads a floating-point setting
+func getFloat64(key string) float64 {
+	readKeys[key] = true
+	return viper.GetFloat64(key)
+}
+
+// isSet reports whether any source sets a setting
+func isSet(key string) bool {
+	readKeys[key] = true
+	return viper.IsSet(key)
+}
+
+// setDefault sets a default over the built-in one, recording its source
+func setDefault(key, value, source string) {
+	viper.SetDefault(key, value)
+	defaultSources[key] = source
+}
+
+// maskCredentials masks the passwords and SAS signatures of the URLs in a value (e.g.
+// REDIS_URL, container SAS URLs or comma separated NATS URLs) and of key=value DSNs
+func maskCredentials(value string) string {
+	if dsnPassword.MatchString(value) && !strings.Contains(value, "://") {
+		return dsnPassword.ReplaceAllString(value, "${1}"+redact.Placeholder)
+	}
+	if !strings.Contains(value, "://") {
+		return value
+	}
+
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		u, err := url.Parse(strings.TrimSpace(part))
+		if err != nil || u.Host == "" {
+			continue
+		}
+		masked := false
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+			masked = true
+		}
+		if query := u.Query(); query.Has("sig") || query.Has("password") {
+			for _, name := range []string{"sig", "password"} {
+				if query.Has(name) {
+					query.Set(name, "redacted")
+				}
+			}
+			u.RawQuery = query.Encode()
+			masked = true
+		}
+		if masked {
+			parts[i] = u.String()
+		}
+	}
+	return strings.Join(parts, ",")
+}
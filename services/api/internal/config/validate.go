@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// guidPattern matches Azure AD tenant and application IDs
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Problem is a setting that failed validation
+type Problem struct {
+	Key     string // Variable name, e.g. AZURE_TENANT_ID
+	Message string // What's wrong with it
+	Hint    string // How to fix it, when the message doesn't say
+}
+
+// ValidationError lists every problem found by Load, so they can be fixed in one go rather
+// than one restart at a time
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("1 configuration problem:")
+	} else {
+		fmt.Fprintf(&b, "%d configuration problems:", len(e.Problems))
+	}
+	for _, problem := range e.Problems {
+		fmt.Fprintf(&b, "\n  - %s %s", problem.Key, problem.Message)
+		if problem.Hint != "" {
+			fmt.Fprintf(&b, "\n    → %s", problem.Hint)
+		}
+	}
+	return b.String()
+}
+
+// problemList collects the problems found while Load reads the settings
+type problemList []Problem
+
+// add records a problem with a setting
+func (l *problemList) add(key, message, hint string) {
+	*l = append(*l, Problem{Key: key, Message: message, Hint: hint})
+}
+
+// err returns a *ValidationError listing the problems, or nil when there are none
+func (l problemList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: l}
+}
+
+// requireGUID records a problem unless the setting is a GUID
+func (l *problemList) requireGUID(key, value, hint string) {
+	switch {
+	case value == "":
+		l.add(key, "is required", hint)
+	case !guidPattern.MatchString(value):
+		l.add(key, fmt.Sprintf("must be a GUID, got %q", value), hint)
+	}
+}
+
+// requirePort records a problem unless the setting is a TCP port number
+func (l *problemList) requirePort(key, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		l.add(key, fmt.Sprintf("must be a port number between 1 and 65535, got %q", value), "")
+	}
+}
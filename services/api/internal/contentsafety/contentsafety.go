@@ -0,0 +1,274 @@
+// Package contentsafety is a moderation filter classifying message text and attached images
+// with Azure AI Content Safety. Each harm category (hate, self-harm, sexual, violence) is
+// scored by severity, and configurable thresholds decide whether a message is flagged for
+// review or rejected.
+package contentsafety
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-service/internal/identity"
+	"api-service/internal/moderation"
+)
+
+// cognitiveServicesResource is the token audience for Azure AI services
+const cognitiveServicesResource = "https://cognitiveservices.azure.com"
+
+// apiVersion is the Azure AI Content Safety REST API version used
+const apiVersion = "2024-09-01"
+
+// maxTextRunes is the longest text analyzed in one request; longer messages are analyzed in
+// chunks
+const maxTextRunes = 10000
+
+// Harm categories, as reported in verdicts and used as threshold keys
+const (
+	CategoryHate     = "hate"
+	CategorySelfHarm = "self_harm"
+	CategorySexual   = "sexual"
+	CategoryViolence = "violence"
+)
+
+// serviceCategories maps the service's category names to ours
+var serviceCategories = map[string]string{
+	"Hate":     CategoryHate,
+	"SelfHarm": CategorySelfHarm,
+	"Sexual":   CategorySexual,
+	"Violence": CategoryViolence,
+}
+
+// imageTypes are the image content types the service analyzes
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/bmp":  true,
+	"image/tiff": true,
+	"image/webp": true,
+}
+
+// Thresholds maps harm categories to the lowest severity (0, 2, 4 or 6) acted on. Categories
+// without a threshold are never acted on.
+type Thresholds map[string]int
+
+// ParseThresholds parses comma-separated category=severity pairs, e.g. "hate=4,violence=6"
+func ParseThresholds(s string) (Thresholds, error) {
+	thresholds := Thresholds{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		category, value, ok := strings.Cut(pair, "=")
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !ok || !validCategory(category) {
+			return nil, fmt.Errorf("invalid threshold %q (expected <category>=<severity> with category %s, %s, %s or %s)",
+				pair, CategoryHate, CategorySelfHarm, CategorySexual, CategoryViolence)
+		}
+		severity, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || severity < 0 || severity > 7 {
+			return nil, fmt.Errorf("invalid severity in threshold %q (expected 0 to 7)", pair)
+		}
+		thresholds[category] = severity
+	}
+	return thresholds, nil
+}
+
+func validCategory(category string) bool {
+	for _, known := range serviceCategories {
+		if category == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Config configures the filter
+type Config struct {
+	Endpoint string     // Content Safety resource name, host name or endpoint URL
+	APIKey   string     // Resource key; the managed identity is used when empty
+	Reject   Thresholds // Severities rejecting a message
+	Flag     Thresholds // Severities flagging a message, holding it in quarantine
+	Images   bool       // Also screen attached images
+}
+
+// Filter screens messages with Azure AI Content Safety
+type Filter struct {
+	cfg      Config
+	endpoint string
+	identity *identity.ManagedIdentity
+	client   *http.Client
+}
+
+// NewFilter creates a Content Safety filter; mi is used when cfg has no API key
+func NewFilter(cfg Config, mi *identity.ManagedIdentity) (*Filter, error) {
+	endpoint := cfg.Endpoint
+	switch {
+	case strings.Contains(endpoint, "://"):
+	case strings.Contains(endpoint, "."):
+		endpoint = "https://" + endpoint
+	default:
+		endpoint = "https://" + endpoint + ".cognitiveservices.azure.com"
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid content safety endpoint %q: %w", cfg.Endpoint, err)
+	}
+	if cfg.APIKey == "" && mi == nil {
+		return nil, fmt.Errorf("a content safety API key or managed identity is required")
+	}
+
+	return &Filter{
+		cfg:      cfg,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		identity: mi,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name identifies the filter
+func (f *Filter) Name() string {
+	return "contentsafety"
+}
+
+// analysis is an analyze response
+type analysis struct {
+	CategoriesAnalysis []struct {
+		Category string `json:"category"`
+		Severity int    `json:"severity"`
+	} `json:"categoriesAnalysis"`
+}
+
+// Check classifies the message text
+func (f *Filter) Check(ctx context.Context, req *moderation.Request) (*moderation.Verdict, error) {
+	if strings.TrimSpace(req.Message.Text) == "" {
+		return nil, nil
+	}
+	severities := map[string]int{}
+	for _, chunk := range chunks(req.Message.Text, maxTextRunes) {
+		result, err := f.analyze(ctx, "/contentsafety/text:analyze", map[string]interface{}{
+			"text":       chunk,
+			"outputType": "FourSeverityLevels",
+		})
+		if err != nil {
+			return nil, err
+		}
+		merge(severities, result)
+	}
+	return f.verdict(severities, "message"), nil
+}
+
+// CheckImage classifies an attached image. Images of types the service can't analyze, or
+// when image screening is off, are allowed.
+func (f *Filter) CheckImage(ctx context.Context, req *moderation.ImageRequest) (*moderation.Verdict, error) {
+	if !f.cfg.Images || !imageTypes[req.ContentType] {
+		return nil, nil
+	}
+	result, err := f.analyze(ctx, "/contentsafety/image:analyze", map[string]interface{}{
+		"image":      map[string][]byte{"content": req.Data}, // Base64 encoded by encoding/json
+		"outputType": "FourSeverityLevels",
+	})
+	if err != nil {
+		return nil, err
+	}
+	severities := map[string]int{}
+	merge(severities, result)
+	return f.verdict(severities, "image"), nil
+}
+
+// verdict applies the thresholds to the highest severity found in each category
+func (f *Filter) verdict(severities map[string]int, content string) *moderation.Verdict {
+	var rejected, flagged []string
+	for category, severity := range severities {
+		if threshold, ok := f.cfg.Reject[category]; ok && severity >= threshold {
+			rejected = append(rejected, category)
+		} else if threshold, ok := f.cfg.Flag[category]; ok && severity >= threshold {
+			flagged = append(flagged, category)
+		}
+	}
+	sort.Strings(rejected)
+	sort.Strings(flagged)
+
+	switch {
+	case len(rejected) > 0:
+		return &moderation.Verdict{
+			Outcome:    moderation.OutcomeReject,
+			Reason:     content + " contains " + strings.Join(rejected, ", ") + " content",
+			Categories: append(rejected, flagged...),
+			Quarantine: true,
+		}
+	case len(flagged) > 0:
+		return &moderation.Verdict{Outcome: moderation.OutcomeFlag, Categories: flagged, Quarantine: true}
+	default:
+		return nil
+	}
+}
+
+// analyze sends an analyze request
+func (f *Filter) analyze(ctx context.Context, path string, body interface{}) (*analysis, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint+path+"?api-version="+apiVersion, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.cfg.APIKey != "" {
+		req.Header.Set("Ocp-Apim-Subscription-Key", f.cfg.APIKey)
+	} else {
+		token, err := f.identity.Token(ctx, cognitiveServicesResource)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("content safety analysis returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	var result analysis
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding content safety response: %w", err)
+	}
+	return &result, nil
+}
+
+// merge keeps the highest severity of each category
+func merge(severities map[string]int, result *analysis) {
+	for _, item := range result.CategoriesAnalysis {
+		if category, ok := serviceCategories[item.Category]; ok && item.Severity > severities[category] {
+			severities[category] = item.Severity
+		}
+	}
+}
+
+// chunks splits text into pieces of at most n runes
+func chunks(text string, n int) []string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return []string{text}
+	}
+	var pieces []string
+	for len(runes) > 0 {
+		size := min(n, len(runes))
+		pieces = append(pieces, string(runes[:size]))
+		runes = runes[size:]
+	}
+	return pieces
+}
@@ -0,0 +1,218 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"api-service/internal/blob"
+	"api-service/internal/locks"
+)
+
+// maxLetterBytes bounds a persisted letter
+const maxLetterBytes = 4 << 20
+
+// lockName is the lock serializing taking persisted letters across replicas
+const lockName = "deadletters"
+
+// finalFlushTimeout bounds persisting the letters still unsaved at shutdown
+const finalFlushTimeout = 10 * time.Second
+
+// blobName returns the blob a letter is persisted to, in the dead letters container
+func blobName(letter *Letter) string {
+	return letter.Source + "/" + letter.ID + ".json"
+}
+
+// Load reads the persisted letters, at startup
+func (q *Queue) Load(ctx context.Context) error {
+	if q.cfg.ContainerURL == "" {
+		return nil
+	}
+	return q.reload(ctx)
+}
+
+// Run persists added letters as they come and reloads every replica's letters every interval,
+// until ctx is cancelled; it returns at once without a container
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	if q.cfg.ContainerURL == "" {
+		return
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalFlushTimeout)
+		defer cancel()
+		q.flush(flushCtx)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+			q.flush(ctx)
+		case <-ticker.C:
+			q.flush(ctx)
+			if err := q.reload(ctx); err != nil {
+				log.Printf("⚠️  Failed to reload dead letters: %v", err)
+			}
+		}
+	}
+}
+
+// flush persists the letters added on this replica and deletes the blobs of those it evicted.
+// Letters that fail stay unsaved for the next flush.
+func (q *Queue) flush(ctx context.Context) {
+	q.mu.Lock()
+	var saving []*Letter
+	for _, letter := range q.letters {
+		if q.unsaved[letter.ID] {
+			saving = append(saving, letter)
+		}
+	}
+	discarded := q.discarded
+	q.discarded = nil
+	q.mu.Unlock()
+
+	for _, letter := range saving {
+		data, err := json.Marshal(letter)
+		if err == nil {
+			err = blob.UploadBlockBlob(ctx, q.cfg.ContainerURL, blobName(letter), "application/json", data)
+		}
+		if err != nil {
+			log.Printf("⚠️  Failed to persist dead letter %s: %v", letter.ID, err)
+			break
+		}
+
+		q.mu.Lock()
+		i := q.index(letter.ID)
+		switch {
+		case i < 0:
+			discarded = append(discarded, letter) // Taken while it was being persisted
+		case q.letters[i] == letter:
+			delete(q.unsaved, letter.ID)
+		}
+		q.mu.Unlock()
+	}
+
+	for i, letter := range discarded {
+		if err := blob.DeleteBlob(ctx, q.cfg.ContainerURL, blobName(letter)); err != nil {
+			log.Printf("⚠️  Failed to delete dead letter %s: %v", letter.ID, err)
+			q.mu.Lock()
+			q.discarded = append(q.discarded, discarded[i:]...)
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// reload merges the persisted letters with those of this replica: letters persisted by other
+// replicas are added, and persisted letters whose blobs are gone (taken or evicted elsewhere)
+// are dropped
+func (q *Queue) reload(ctx context.Context) error {
+	names, err := blob.ListBlobs(ctx, q.cfg.ContainerURL, "")
+	if err != nil {
+		return err
+	}
+	persisted := make(map[string]string, len(names)) // ID -> blob name
+	for _, name := range names {
+		if _, file, ok := strings.Cut(name, "/"); ok && strings.HasSuffix(file, ".json") {
+			persisted[strings.TrimSuffix(file, ".json")] = name
+		}
+	}
+
+	q.mu.Lock()
+	known := make(map[string]bool, len(q.letters))
+	for _, letter := range q.letters {
+		known[letter.ID] = true
+	}
+	q.mu.Unlock()
+
+	var loaded []*Letter
+	for id, name := range persisted {
+		if known[id] {
+			continue
+		}
+		data, err := blob.DownloadBlob(ctx, q.cfg.ContainerURL, name, maxLetterBytes)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue // Taken since it was listed
+		}
+		var letter Letter
+		if err := json.Unmarshal(data, &letter); err != nil {
+			log.Printf("⚠️  Skipping dead letter %s: %v", name, err)
+			continue
+		}
+		loaded = append(loaded, &letter)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	letters := q.letters[:0]
+	for _, letter := range q.letters {
+		if persisted[letter.ID] != "" || q.unsaved[letter.ID] {
+			letters = append(letters, letter)
+		}
+	}
+	q.letters = letters
+	sources := make(map[string]bool)
+	for _, letter := range loaded {
+		if q.index(letter.ID) < 0 {
+			q.letters = append(q.letters, letter)
+			sources[letter.Source] = true
+		}
+	}
+	sort.SliceStable(q.letters, func(i, j int) bool { return q.letters[i].FailedAt.Before(q.letters[j].FailedAt) })
+	for source := range sources {
+		q.evict(source)
+	}
+	return nil
+}
+
+// claim deletes a persisted letter's blob while holding the dead letters lock, returning
+// ErrNotFound when it's already gone
+func (q *Queue) claim(ctx context.Context, letter *Letter) error {
+	lock, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(context.Background()); err != nil {
+			log.Printf("⚠️  Failed to release the dead letters lock: %v", err)
+		}
+	}()
+
+	props, err := blob.GetProperties(ctx, q.cfg.ContainerURL, blobName(letter))
+	if err != nil {
+		return err
+	}
+	if props == nil {
+		return ErrNotFound
+	}
+	return blob.DeleteBlob(ctx, q.cfg.ContainerURL, blobName(letter))
+}
+
+// acquire takes the dead letters lock, waiting a few seconds for another replica to release it
+func (q *Queue) acquire(ctx context.Context) (locks.Lock, error) {
+	for attempt := 0; attempt < 20; attempt++ {
+		lock, err := q.locker.TryAcquire(ctx, lockName, 15*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if lock != nil {
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	return nil, fmt.Errorf("dead letters are being taken by another replica")
+}
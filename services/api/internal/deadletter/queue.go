@@ -0,0 +1,294 @@
+// Package deadletter keeps what failed delivery for good (webhook deliveries out of retries,
+// offline notifications dropped by full queues, broadcasts the backplane refused) so admins can
+// inspect it and redrive it instead of it only being logged
+package deadletter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/locks"
+)
+
+// Sources of dead letters
+const (
+	SourceWebhooks  = "webhooks"  // Webhook deliveries; Target is the webhook ID, Type the event type
+	SourceOffline   = "offline"   // Offline notifications; Target is the recipient ID, Type the notifier
+	SourceBackplane = "backplane" // Broadcasts to other replicas; Target is the user the event concerns
+)
+
+// maxPerSource bounds the letters kept per source, oldest dropped first, so a noisy source
+// can't push out the others'
+const maxPerSource = 1000
+
+var (
+	ErrNotFound      = errors.New("dead letter not found")
+	ErrNotRedrivable = errors.New("dead letter source has no redrive")
+)
+
+// Letter is something that failed delivery and won't be retried on its own
+type Letter struct {
+	ID       string          `json:"id"`
+	Source   string          `json:"source"`
+	Type     string          `json:"type,omitempty"`   // What it was, within the source
+	Target   string          `json:"target,omitempty"` // Who it was for, within the source
+	Attempts int             `json:"attempts"`
+	Status   int             `json:"status,omitempty"` // Last response status, 0 when no response was received
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failedAt"`
+	Payload  json.RawMessage `json:"payload,omitempty"` // What its source needs to redrive it
+}
+
+// Filter selects letters; empty fields match any
+type Filter struct {
+	Source string
+	Target string
+}
+
+// Config configures the queue
+type Config struct {
+	ContainerURL string // Container SAS URL letters are persisted to; in memory on this replica when empty
+}
+
+// Stats reports dead letter metrics. Letters counts every replica's letters when they're
+// persisted; the totals are this replica's.
+type Stats struct {
+	Letters      int            `json:"letters"`
+	BySource     map[string]int `json:"bySource"`
+	Unsaved      int            `json:"unsaved"` // Added on this replica and not persisted yet
+	DeadLettered int64          `json:"deadLettered"`
+	Redriven     int64          `json:"redriven"`
+	Evicted      int64          `json:"evicted"` // Dropped to stay within the per-source limit
+}
+
+// Redriver delivers a letter of its source again. Letters it fails are kept.
+type Redriver func(ctx context.Context, letter *Letter) error
+
+// Queue keeps dead letters. Sources add letters and register how they're redriven. With a
+// container URL, each letter is persisted to a blob of its own in the background and the
+// letters of every replica are reloaded periodically, so they survive restarts and any replica
+// can redrive them.
+type Queue struct {
+	cfg    Config
+	locker locks.Locker
+	wake   chan struct{} // Signals letters to persist
+
+	mu        sync.Mutex
+	letters   []*Letter       // Oldest first; not changed once added
+	unsaved   map[string]bool // IDs of letters added on this replica and not persisted yet
+	discarded []*Letter       // Persisted letters evicted on this replica, whose blobs are to delete
+	redrivers map[string]Redriver
+
+	deadLettered atomic.Int64
+	redriven     atomic.Int64
+	evicted      atomic.Int64
+}
+
+// NewQueue creates an empty dead letter queue. locker serializes taking persisted letters, so
+// two replicas don't redrive the same one.
+func NewQueue(cfg Config, locker locks.Locker) *Queue {
+	return &Queue{
+		cfg:       cfg,
+		locker:    locker,
+		wake:      make(chan struct{}, 1),
+		unsaved:   make(map[string]bool),
+		redrivers: make(map[string]Redriver),
+	}
+}
+
+// Handle registers how the letters of a source are redriven
+func (q *Queue) Handle(source string, redrive Redriver) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.redrivers[source] = redrive
+}
+
+// Add keeps a letter, giving it an ID and failure time when it has none
+func (q *Queue) Add(letter Letter) {
+	if letter.ID == "" {
+		letter.ID = newID()
+	}
+	if letter.FailedAt.IsZero() {
+		letter.FailedAt = time.Now().UTC()
+	}
+	q.deadLettered.Add(1)
+	q.keep(&letter)
+}
+
+// keep adds a letter and, with a container, has it persisted
+func (q *Queue) keep(letter *Letter) {
+	q.mu.Lock()
+	q.letters = append(q.letters, letter)
+	q.evict(letter.Source)
+	if q.cfg.ContainerURL != "" {
+		q.unsaved[letter.ID] = true
+	}
+	q.mu.Unlock()
+
+	if q.cfg.ContainerURL != "" {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// evict drops the oldest letters of a source beyond maxPerSource. Call with mu held.
+func (q *Queue) evict(source string) {
+	count := 0
+	for i := len(q.letters) - 1; i >= 0; i-- {
+		letter := q.letters[i]
+		if letter.Source != source {
+			continue
+		}
+		if count++; count <= maxPerSource {
+			continue
+		}
+		q.letters = append(q.letters[:i], q.letters[i+1:]...)
+		if q.unsaved[letter.ID] {
+			delete(q.unsaved, letter.ID)
+		} else if q.cfg.ContainerURL != "" {
+			q.discarded = append(q.discarded, letter)
+		}
+		q.evicted.Add(1)
+	}
+}
+
+// List returns the letters matching filter, newest first
+func (q *Queue) List(filter Filter) []Letter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := []Letter{}
+	for i := len(q.letters) - 1; i >= 0; i-- {
+		letter := q.letters[i]
+		if (filter.Source == "" || letter.Source == filter.Source) && (filter.Target == "" || letter.Target == filter.Target) {
+			list = append(list, *letter)
+		}
+	}
+	return list
+}
+
+// Get returns a letter
+func (q *Queue) Get(id string) (Letter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := q.index(id); i >= 0 {
+		return *q.letters[i], nil
+	}
+	return Letter{}, ErrNotFound
+}
+
+// Redrive removes a letter and hands it to its source's redriver. When that fails the letter is
+// kept, with the redrive's error, and the error returned.
+func (q *Queue) Redrive(ctx context.Context, id string) error {
+	q.mu.Lock()
+	i := q.index(id)
+	if i < 0 {
+		q.mu.Unlock()
+		return ErrNotFound
+	}
+	source := q.letters[i].Source
+	redrive, ok := q.redrivers[source]
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRedrivable, source)
+	}
+
+	letter, err := q.take(ctx, id)
+	if err != nil {
+		return err
+	}
+	redriven := *letter
+	if err := redrive(ctx, &redriven); err != nil {
+		kept := *letter
+		kept.Error = "redrive failed: " + err.Error()
+		kept.FailedAt = time.Now().UTC()
+		q.keep(&kept)
+		return err
+	}
+	q.redriven.Add(1)
+	return nil
+}
+
+// Delete discards a letter
+func (q *Queue) Delete(ctx context.Context, id string) error {
+	_, err := q.take(ctx, id)
+	return err
+}
+
+// take removes a letter and, when it was persisted, its blob. It returns ErrNotFound when
+// another replica took the letter first.
+func (q *Queue) take(ctx context.Context, id string) (*Letter, error) {
+	q.mu.Lock()
+	i := q.index(id)
+	if i < 0 {
+		q.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	letter := q.letters[i]
+	q.letters = append(q.letters[:i], q.letters[i+1:]...)
+	unsaved := q.unsaved[id]
+	delete(q.unsaved, id)
+	q.mu.Unlock()
+
+	if q.cfg.ContainerURL == "" || unsaved {
+		return letter, nil
+	}
+	if err := q.claim(ctx, letter); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			q.mu.Lock()
+			q.letters = append(q.letters, letter)
+			sort.SliceStable(q.letters, func(i, j int) bool { return q.letters[i].FailedAt.Before(q.letters[j].FailedAt) })
+			q.mu.Unlock()
+		}
+		return nil, err
+	}
+	return letter, nil
+}
+
+// Stats returns dead letter metrics
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	bySource := make(map[string]int)
+	for _, letter := range q.letters {
+		bySource[letter.Source]++
+	}
+	letters := len(q.letters)
+	unsaved := len(q.unsaved)
+	q.mu.Unlock()
+
+	return Stats{
+		Letters:      letters,
+		BySource:     bySource,
+		Unsaved:      unsaved,
+		DeadLettered: q.deadLettered.Load(),
+		Redriven:     q.redriven.Load(),
+		Evicted:      q.evicted.Load(),
+	}
+}
+
+// index returns the position of a letter, -1 if there's none with the ID. Call with mu held.
+func (q *Queue) index(id string) int {
+	for i, letter := range q.letters {
+		if letter.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// newID returns a random letter ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
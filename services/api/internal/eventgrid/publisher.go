@@ -0,0 +1,279 @@
+// Package eventgrid publishes system events to an Azure Event Grid topic as CloudEvents,
+// so other Azure workloads can react to activity in the service, and routes events delivered
+// by Event Grid subscriptions to topic subscribers
+package eventgrid
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/events"
+	"api-service/internal/identity"
+	"api-service/internal/middleware"
+	"api-service/internal/redact"
+)
+
+// eventGridResource is the token audience for Event Grid
+const eventGridResource = "https://eventgrid.azure.net"
+
+// TypePrefix prefixes the CloudEvents type of every event
+const TypePrefix = "api-service."
+
+// Event types that can be published (without TypePrefix)
+const (
+	TypeUserJoined  = "user.joined"
+	TypeUserLeft    = "user.left"
+	TypeAdminAction = "admin.action"
+)
+
+// Types lists every event type that can be published
+var Types = []string{TypeUserJoined, TypeUserLeft, TypeAdminAction}
+
+const (
+	queueSize   = 1024 // Events waiting to be sent; more are dropped
+	maxBatch    = 100  // Events per request
+	maxAttempts = 3    // Send attempts before a batch is dropped
+)
+
+// CloudEvent is a CloudEvents 1.0 event in the JSON format
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// Config configures the publisher
+type Config struct {
+	Endpoint string   // Topic endpoint, e.g. https://<topic>.<region>-1.eventgrid.azure.net/api/events
+	Source   string   // CloudEvents source
+	Types    []string // Event types published (see Types)
+}
+
+// Stats reports publisher metrics
+type Stats struct {
+	Published int64 `json:"published"`
+	Dropped   int64 `json:"dropped"` // Queue overflow, encoding errors or batches that exhausted their retries
+	Failures  int64 `json:"failures"`
+}
+
+// Publisher sends CloudEvents to an Event Grid topic in the background
+type Publisher struct {
+	cfg      Config
+	endpoint string
+	types    map[string]bool
+	identity *identity.ManagedIdentity
+	redactor redact.Redactor
+	client   *http.Client
+	queue    chan CloudEvent
+
+	published atomic.Int64
+	dropped   atomic.Int64
+	failures  atomic.Int64
+}
+
+// NewPublisher creates a publisher; redactor is applied to event data (nil sends it as is)
+func NewPublisher(cfg Config, mi *identity.ManagedIdentity, redactor redact.Redactor) (*Publisher, error) {
+	types := make(map[string]bool, len(cfg.Types))
+	for _, eventType := range cfg.Types {
+		known := false
+		for _, t := range Types {
+			known = known || t == eventType
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event grid event type %q (expected one of %s)", eventType, strings.Join(Types, ", "))
+		}
+		types[eventType] = true
+	}
+
+	endpoint := cfg.Endpoint
+	if !strings.Contains(endpoint, "?") {
+		endpoint += "?api-version=2018-01-01"
+	}
+
+	return &Publisher{
+		cfg:      cfg,
+		endpoint: endpoint,
+		types:    types,
+		identity: mi,
+		redactor: redactor,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		queue:    make(chan CloudEvent, queueSize),
+	}, nil
+}
+
+// Publish queues an event of the given type if it is enabled. It never blocks.
+func (p *Publisher) Publish(eventType, subject string, data map[string]interface{}) {
+	if !p.types[eventType] {
+		return
+	}
+
+	redacted, err := redact.Apply(p.redactor, data)
+	if err != nil {
+		p.dropped.Add(1)
+		return
+	}
+	p.enqueue(eventType, subject, redacted)
+}
+
+// enqueue queues an event whose data has been redacted
+func (p *Publisher) enqueue(eventType, subject string, redacted interface{}) {
+	select {
+	case p.queue <- CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              newEventID(),
+		Source:          p.cfg.Source,
+		Type:            TypePrefix + eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            redacted,
+	}:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// ObserveEvent publishes user join and leave events; register it with Manager.AddEventObserver
+func (p *Publisher) ObserveEvent(event *events.Event) {
+	var eventType string
+	switch event.Type {
+	case events.EventTypeUserJoined:
+		eventType = TypeUserJoined
+	case events.EventTypeUserLeft:
+		eventType = TypeUserLeft
+	default:
+		return
+	}
+
+	if !p.types[eventType] {
+		return
+	}
+
+	// The subject carries the user ID as redacted (e.g. hashed) in the data
+	redacted, err := redact.Apply(p.redactor, event.Payload)
+	if err != nil {
+		p.dropped.Add(1)
+		return
+	}
+	subject := ""
+	if data, ok := redacted.(map[string]interface{}); ok {
+		if userID, ok := data["user_id"].(string); ok {
+			subject = "/users/" + userID
+		}
+	}
+	p.enqueue(eventType, subject, redacted)
+}
+
+// ObserveActivity publishes admin actions; use it with middleware.NewActivityMiddleware
+func (p *Publisher) ObserveActivity(activity middleware.Activity) {
+	data := map[string]interface{}{
+		"action": activity.Method + " " + activity.Route,
+		"params": activity.Params,
+		"status": activity.Status,
+	}
+	if activity.User != nil {
+		data["actor"] = activity.User.ID
+		data["actorTenantId"] = activity.User.TenantID
+	}
+	p.Publish(TypeAdminAction, activity.Path, data)
+}
+
+// Run sends queued events until ctx is cancelled
+func (p *Publisher) Run(ctx context.Context) {
+	for {
+		var batch []CloudEvent
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-p.queue:
+			batch = append(batch, event)
+		}
+	collect:
+		for len(batch) < maxBatch {
+			select {
+			case event := <-p.queue:
+				batch = append(batch, event)
+			default:
+				break collect
+			}
+		}
+
+		for attempt := 1; ; attempt++ {
+			err := p.send(ctx, batch)
+			if err == nil {
+				p.published.Add(int64(len(batch)))
+				break
+			}
+			p.failures.Add(1)
+			if attempt == maxAttempts || ctx.Err() != nil {
+				p.dropped.Add(int64(len(batch)))
+				log.Printf("⚠️  Event Grid publish failed, dropped %d events: %v", len(batch), err)
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+	}
+}
+
+// send posts a batch in the CloudEvents batch format
+func (p *Publisher) send(ctx context.Context, batch []CloudEvent) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	token, err := p.identity.Token(ctx, eventGridResource)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/cloudevents-batch+json; charset=utf-8")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event grid publish returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stats returns publisher metrics
+func (p *Publisher) Stats() Stats {
+	return Stats{
+		Published: p.published.Load(),
+		Dropped:   p.dropped.Load(),
+		Failures:  p.failures.Load(),
+	}
+}
+
+// newEventID returns a random event ID
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,227 @@
+package eventgrid
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/events"
+	"api-service/internal/topics"
+)
+
+// Event Grid schema event types handled by the receiver itself
+const (
+	TypeSubscriptionValidation = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	TypeSubscriptionDeleted    = "Microsoft.EventGrid.SubscriptionDeletedEvent"
+)
+
+// ReceivedFrom is the "from" of the topic events incoming events are delivered as
+const ReceivedFrom = "eventgrid"
+
+// Content types of the CloudEvents HTTP binding's structured mode
+const (
+	contentTypeCloudEvent      = "application/cloudevents+json"
+	contentTypeCloudEventBatch = "application/cloudevents-batch+json"
+)
+
+// Route delivers incoming events of a type to the subscribers of a topic
+type Route struct {
+	EventType string // Exact type, or a prefix ending in ".*" (e.g. Microsoft.Storage.*)
+	Topic     string
+}
+
+// Matches reports whether the route applies to an event type
+func (r Route) Matches(eventType string) bool {
+	if prefix, ok := strings.CutSuffix(r.EventType, "*"); ok {
+		return strings.HasPrefix(eventType, prefix)
+	}
+	return r.EventType == eventType
+}
+
+// ParseRoutes parses comma separated type=topic routes, e.g.
+// "Microsoft.Storage.BlobCreated=storage.uploads,Contoso.Orders.*=orders"
+func ParseRoutes(value string) ([]Route, error) {
+	var routes []Route
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		eventType, topic, ok := strings.Cut(entry, "=")
+		eventType, topic = strings.TrimSpace(eventType), strings.TrimSpace(topic)
+		if !ok || eventType == "" || topic == "" {
+			return nil, fmt.Errorf("invalid route %q (expected <event type>=<topic>)", entry)
+		}
+		if strings.Contains(strings.TrimSuffix(eventType, "*"), "*") {
+			return nil, fmt.Errorf("invalid route %q: '*' may only end the event type", entry)
+		}
+		if err := topics.ValidateTopic(topic); err != nil {
+			return nil, fmt.Errorf("invalid route %q: %w", entry, err)
+		}
+		routes = append(routes, Route{EventType: eventType, Topic: topic})
+	}
+	return routes, nil
+}
+
+// ReceiverStats reports receiver metrics
+type ReceiverStats struct {
+	Received  int64 `json:"received"`
+	Delivered int64 `json:"delivered"` // Routed to a topic
+	Unrouted  int64 `json:"unrouted"`  // No route matched the event type
+}
+
+// Receiver delivers events from Event Grid subscriptions to the WebSocket clients subscribed
+// to the topic each event type is routed to
+type Receiver struct {
+	routes  []Route
+	manager *events.Manager
+
+	received  atomic.Int64
+	delivered atomic.Int64
+	unrouted  atomic.Int64
+}
+
+// NewReceiver creates a receiver; an event goes to the topic of the first route matching
+// its type
+func NewReceiver(routes []Route, manager *events.Manager) *Receiver {
+	return &Receiver{routes: routes, manager: manager}
+}
+
+// Deliver sends an event to its route's topic subscribers as a topic_event, reporting false
+// when no route matches it
+func (r *Receiver) Deliver(event CloudEvent) bool {
+	r.received.Add(1)
+	for _, route := range r.routes {
+		if route.Matches(event.Type) {
+			r.manager.BroadcastEvent(events.NewTopicEvent(route.Topic, "", ReceivedFrom, event))
+			r.delivered.Add(1)
+			return true
+		}
+	}
+	r.unrouted.Add(1)
+	return false
+}
+
+// Stats returns receiver metrics
+func (r *Receiver) Stats() ReceiverStats {
+	return ReceiverStats{
+		Received:  r.received.Load(),
+		Delivered: r.delivered.Load(),
+		Unrouted:  r.unrouted.Load(),
+	}
+}
+
+// gridEvent is an event in the Event Grid schema
+type gridEvent struct {
+	ID          string          `json:"id"`
+	Topic       string          `json:"topic"`
+	Subject     string          `json:"subject"`
+	EventType   string          `json:"eventType"`
+	EventTime   time.Time       `json:"eventTime"`
+	Data        json.RawMessage `json:"data"`
+	DataVersion string          `json:"dataVersion"`
+}
+
+// Delivery is a decoded Event Grid delivery
+type Delivery struct {
+	Events         []CloudEvent
+	ValidationCode string // Set for a SubscriptionValidationEvent, which must be echoed back
+}
+
+// DecodeDelivery decodes a delivery in the Event Grid schema or either CloudEvents v1.0 HTTP
+// binding mode (structured, single or batched, and binary, with ce- headers). Events of the
+// Event Grid schema are converted to CloudEvents.
+func DecodeDelivery(header http.Header, body []byte) (*Delivery, error) {
+	if header.Get("ce-specversion") != "" {
+		return decodeBinary(header, body)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch mediaType {
+	case contentTypeCloudEvent:
+		var event CloudEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, fmt.Errorf("decoding cloud event: %w", err)
+		}
+		return checked(&Delivery{Events: []CloudEvent{event}})
+	case contentTypeCloudEventBatch:
+		var batch []CloudEvent
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("decoding cloud event batch: %w", err)
+		}
+		return checked(&Delivery{Events: batch})
+	}
+
+	var batch []gridEvent
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("decoding event grid events: %w", err)
+	}
+	delivery := &Delivery{}
+	for _, e := range batch {
+		switch e.EventType {
+		case TypeSubscriptionValidation:
+			var data struct {
+				ValidationCode string `json:"validationCode"`
+			}
+			if err := json.Unmarshal(e.Data, &data); err != nil || data.ValidationCode == "" {
+				return nil, fmt.Errorf("subscription validation event without a validation code")
+			}
+			delivery.ValidationCode = data.ValidationCode
+			return delivery, nil
+		case TypeSubscriptionDeleted:
+			continue
+		}
+		delivery.Events = append(delivery.Events, CloudEvent{
+			SpecVersion:     "1.0",
+			ID:              e.ID,
+			Source:          e.Topic,
+			Type:            e.EventType,
+			Subject:         e.Subject,
+			Time:            e.EventTime,
+			DataContentType: "application/json",
+			Data:            e.Data,
+		})
+	}
+	return checked(delivery)
+}
+
+// decodeBinary decodes a CloudEvent in binary mode: attributes in ce- headers, data in the body
+func decodeBinary(header http.Header, body []byte) (*Delivery, error) {
+	event := CloudEvent{
+		SpecVersion:     header.Get("ce-specversion"),
+		ID:              header.Get("ce-id"),
+		Source:          header.Get("ce-source"),
+		Type:            header.Get("ce-type"),
+		Subject:         header.Get("ce-subject"),
+		DataContentType: header.Get("Content-Type"),
+	}
+	if t := header.Get("ce-time"); t != "" {
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ce-time %q", t)
+		}
+		event.Time = parsed
+	}
+	if mediaType, _, _ := mime.ParseMediaType(event.DataContentType); mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		event.Data = json.RawMessage(body)
+	} else if len(body) > 0 {
+		event.Data = string(body)
+	}
+	return checked(&Delivery{Events: []CloudEvent{event}})
+}
+
+// checked requires the CloudEvents 1.0 attributes (id, source, type) of every event
+func checked(delivery *Delivery) (*Delivery, error) {
+	for _, event := range delivery.Events {
+		if event.SpecVersion != "" && event.SpecVersion != "1.0" {
+			return nil, fmt.Errorf("unsupported cloud events version %q", event.SpecVersion)
+		}
+		if event.ID == "" || event.Source == "" || event.Type == "" {
+			return nil, fmt.Errorf("event without an id, source or type")
+		}
+	}
+	return delivery, nil
+}
@@ -0,0 +1,309 @@
+// Package eventhubs mirrors domain events to Azure Event Hubs for downstream analytics,
+// off the API's hot path
+package eventhubs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/events"
+	"api-service/internal/identity"
+	"api-service/internal/redact"
+)
+
+// eventHubsResource is the token audience for Event Hubs
+const eventHubsResource = "https://eventhubs.azure.net"
+
+// maxBatchBytes keeps a batch request under the Event Hubs 1MB limit
+const maxBatchBytes = 900 << 10
+
+// Config configures the publisher
+type Config struct {
+	Namespace     string             // Namespace name, host name or endpoint URL
+	Hub           string             // Event Hub name
+	Types         []events.EventType // Event types mirrored
+	InstanceID    string             // Recorded on each event
+	BatchSize     int                // Events per send
+	FlushInterval time.Duration      // Longest an event waits before being sent
+	BufferSize    int                // Events buffered while Event Hubs is unreachable; the oldest are dropped beyond this
+	Outbox        bool               // Chat messages are published from the message store's outbox, not observed
+}
+
+// Record is the JSON body of each mirrored event
+type Record struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Timestamp  time.Time   `json:"timestamp"`
+	InstanceID string      `json:"instanceId"`
+	Payload    interface{} `json:"payload"` // Redacted with the eventhubs sink profile
+}
+
+// Stats reports publisher metrics
+type Stats struct {
+	Buffered  int   `json:"buffered"`
+	Published int64 `json:"published"`
+	Dropped   int64 `json:"dropped"` // Buffer overflow or unencodable events
+	Failures  int64 `json:"failures"`
+}
+
+// Publisher buffers events and sends them to an Event Hub in batches, retrying with backoff
+type Publisher struct {
+	cfg      Config
+	endpoint string
+	types    map[events.EventType]bool
+	identity *identity.ManagedIdentity
+	redactor redact.Redactor
+	client   *http.Client
+
+	buffer  [][]byte // Encoded records, oldest first
+	removed int64    // Records ever removed from the front of buffer (sent or dropped)
+	mu      sync.Mutex
+	wake    chan struct{}
+
+	published atomic.Int64
+	dropped   atomic.Int64
+	failures  atomic.Int64
+}
+
+// NewPublisher creates a publisher; redactor is applied to event payloads (nil sends them as is)
+func NewPublisher(cfg Config, mi *identity.ManagedIdentity, redactor redact.Redactor) *Publisher {
+	endpoint := cfg.Namespace
+	switch {
+	case strings.Contains(endpoint, "://"):
+	case strings.Contains(endpoint, "."):
+		endpoint = "https://" + endpoint
+	default:
+		endpoint = "https://" + endpoint + ".servicebus.windows.net"
+	}
+
+	types := make(map[events.EventType]bool, len(cfg.Types))
+	for _, t := range cfg.Types {
+		types[t] = true
+	}
+
+	return &Publisher{
+		cfg:      cfg,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		types:    types,
+		identity: mi,
+		redactor: redactor,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Observe queues an event for publishing if its type is mirrored. It never blocks, so it
+// can be registered with Manager.AddEventObserver.
+func (p *Publisher) Observe(event *events.Event) {
+	if !p.types[event.Type] || (p.cfg.Outbox && event.Type == events.EventTypeChat) {
+		return
+	}
+
+	record, err := p.encode(event)
+	if err != nil {
+		p.dropped.Add(1)
+		return
+	}
+
+	p.mu.Lock()
+	p.buffer = append(p.buffer, record)
+	if overflow := len(p.buffer) - p.cfg.BufferSize; overflow > 0 {
+		p.buffer = p.buffer[overflow:]
+		p.removed += int64(overflow)
+		p.dropped.Add(int64(overflow))
+	}
+	full := len(p.buffer) >= p.cfg.BatchSize
+	p.mu.Unlock()
+
+	if full {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Publish sends events right away, bypassing the buffer, and returns once Event Hubs accepted
+// them. Events of types that aren't mirrored are skipped. The outbox relay uses it to know
+// when persisted messages are published.
+func (p *Publisher) Publish(ctx context.Context, evts []*events.Event) error {
+	var batch [][]byte
+	size := 0
+	for _, event := range evts {
+		if !p.types[event.Type] {
+			continue
+		}
+		record, err := p.encode(event)
+		if err != nil {
+			p.dropped.Add(1)
+			continue
+		}
+		if len(batch) == p.cfg.BatchSize || (len(batch) > 0 && size+len(record) > maxBatchBytes) {
+			if err := p.sendBatch(ctx, batch); err != nil {
+				return err
+			}
+			batch, size = nil, 0
+		}
+		batch = append(batch, record)
+		size += len(record)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return p.sendBatch(ctx, batch)
+}
+
+// sendBatch sends a batch, counting it in the stats
+func (p *Publisher) sendBatch(ctx context.Context, batch [][]byte) error {
+	if err := p.send(ctx, batch); err != nil {
+		p.failures.Add(1)
+		return err
+	}
+	p.published.Add(int64(len(batch)))
+	return nil
+}
+
+// encode redacts an event's payload and encodes it as a record
+func (p *Publisher) encode(event *events.Event) ([]byte, error) {
+	payload, err := redact.Apply(p.redactor, event.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Record{
+		ID:         event.ID,
+		Type:       string(event.Type),
+		Timestamp:  event.Timestamp,
+		InstanceID: p.cfg.InstanceID,
+		Payload:    payload,
+	})
+}
+
+// Run sends buffered events until ctx is cancelled
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	backoff := time.Duration(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+
+		for {
+			sent, err := p.flush(ctx)
+			if err != nil {
+				p.failures.Add(1)
+				backoff = min(max(2*backoff, time.Second), time.Minute)
+				log.Printf("⚠️  Event Hubs publish failed (%d events buffered), retrying in %s: %v", p.Stats().Buffered, backoff, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				continue
+			}
+			backoff = 0
+			if sent < p.cfg.BatchSize {
+				break // Drained
+			}
+		}
+	}
+}
+
+// flush sends one batch from the front of the buffer and removes it once accepted
+func (p *Publisher) flush(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	start := p.removed
+	var batch [][]byte
+	size := 0
+	for _, record := range p.buffer {
+		if len(batch) == p.cfg.BatchSize || (len(batch) > 0 && size+len(record) > maxBatchBytes) {
+			break
+		}
+		batch = append(batch, record)
+		size += len(record)
+	}
+	p.mu.Unlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := p.send(ctx, batch); err != nil {
+		return 0, err
+	}
+
+	// Sent records are still at the front unless some were dropped as overflow meanwhile
+	p.mu.Lock()
+	if remaining := start + int64(len(batch)) - p.removed; remaining > 0 {
+		p.buffer = p.buffer[remaining:]
+		p.removed += remaining
+	}
+	p.mu.Unlock()
+
+	p.published.Add(int64(len(batch)))
+	return len(batch), nil
+}
+
+// send posts a batch using the Event Hubs REST API
+func (p *Publisher) send(ctx context.Context, batch [][]byte) error {
+	type message struct {
+		Body string `json:"Body"`
+	}
+	messages := make([]message, len(batch))
+	for i, record := range batch {
+		messages[i] = message{Body: string(record)}
+	}
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+
+	token, err := p.identity.Token(ctx, eventHubsResource)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/%s/messages?timeout=60&api-version=2014-01", p.endpoint, url.PathEscape(p.cfg.Hub)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/vnd.microsoft.servicebus.json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("event hubs send returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stats returns publisher metrics
+func (p *Publisher) Stats() Stats {
+	p.mu.Lock()
+	buffered := len(p.buffer)
+	p.mu.Unlock()
+
+	return Stats{
+		Buffered:  buffered,
+		Published: p.published.Load(),
+		Dropped:   p.dropped.Load(),
+		Failures:  p.failures.Load(),
+	}
+}
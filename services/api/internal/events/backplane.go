@@ -0,0 +1,216 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/deadletter"
+)
+
+// backplaneQueueSize bounds broadcasts waiting to be published; more are dropped
+const backplaneQueueSize = 1024
+
+// Backplane relays broadcasts between replicas so clients connected to any replica receive them
+type Backplane interface {
+	// Publish sends an encoded message to every replica (including, possibly, this one).
+	// key identifies the user the event concerns (empty if none); transports that can
+	// order or partition messages use it to keep each user's events in order.
+	Publish(ctx context.Context, key string, message []byte) error
+	// Subscribe calls deliver for each message published by any replica until ctx is cancelled
+	Subscribe(ctx context.Context, deliver func(message []byte)) error
+	// Close releases the backplane's connections
+	Close() error
+}
+
+// backplaneMessage is the wire format of a relayed broadcast
+type backplaneMessage struct {
+	Origin    string          `json:"origin"` // Instance ID of the publishing replica
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload"`
+	Topic     string          `json:"topic,omitempty"`
+	TenantID  string          `json:"tenantId,omitempty"`
+}
+
+// outboundMessage is an encoded broadcast waiting to be published
+type outboundMessage struct {
+	key       string
+	eventType EventType
+	data      []byte
+}
+
+// BackplaneStats reports relayed broadcast metrics
+type BackplaneStats struct {
+	Enabled    bool   `json:"enabled"`
+	InstanceID string `json:"instanceId,omitempty"`
+	Published  int64  `json:"published"`
+	Received   int64  `json:"received"` // From other replicas
+	Dropped    int64  `json:"dropped"`  // Publish queue full
+	Errors     int64  `json:"errors"`
+}
+
+// backplaneCounters are the manager-wide backplane metrics
+type backplaneCounters struct {
+	published atomic.Int64
+	received  atomic.Int64
+	dropped   atomic.Int64
+	errors    atomic.Int64
+}
+
+// ConnectBackplane relays broadcasts through bp, tagging them with instanceID so this replica
+// ignores its own messages instead of delivering them twice. Call before Run.
+func (m *Manager) ConnectBackplane(ctx context.Context, bp Backplane, instanceID string) {
+	m.backplane = bp
+	m.instanceID = instanceID
+	m.outbound = make(chan outboundMessage, backplaneQueueSize)
+
+	// Broadcasts queued while shutting down are still published
+	publishCtx := context.WithoutCancel(ctx)
+	go func() {
+		for message := range m.outbound {
+			if err := bp.Publish(publishCtx, message.key, message.data); err != nil {
+				m.backplaneStats.errors.Add(1)
+				log.Printf("⚠️  Backplane publish failed: %v", err)
+				m.deadLetter(message, err.Error())
+				continue
+			}
+			m.backplaneStats.published.Add(1)
+		}
+	}()
+
+	go func() {
+		if err := bp.Subscribe(ctx, m.receive); err != nil && ctx.Err() == nil {
+			log.Printf("🚨 ALERT: Backplane subscription ended, broadcasts from other replicas are lost: %v", err)
+		}
+	}()
+}
+
+// BackplaneStats returns backplane metrics
+func (m *Manager) BackplaneStats() BackplaneStats {
+	return BackplaneStats{
+		Enabled:    m.backplane != nil,
+		InstanceID: m.instanceID,
+		Published:  m.backplaneStats.published.Load(),
+		Received:   m.backplaneStats.received.Load(),
+		Dropped:    m.backplaneStats.dropped.Load(),
+		Errors:     m.backplaneStats.errors.Load(),
+	}
+}
+
+// publish queues a locally broadcast event for the other replicas
+func (m *Manager) publish(event *Event) {
+	if m.backplane == nil {
+		return
+	}
+
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		m.backplaneStats.errors.Add(1)
+		log.Printf("Failed to marshal backplane event: %v", err)
+		return
+	}
+	message, err := json.Marshal(backplaneMessage{
+		Origin:    m.instanceID,
+		ID:        event.ID,
+		Type:      event.Type,
+		Timestamp: event.Timestamp,
+		Payload:   payload,
+		Topic:     event.Topic,
+		TenantID:  event.TenantID,
+	})
+	if err != nil {
+		m.backplaneStats.errors.Add(1)
+		log.Printf("Failed to marshal backplane event: %v", err)
+		return
+	}
+
+	outbound := outboundMessage{key: eventUser(event), eventType: event.Type, data: message}
+	select {
+	case m.outbound <- outbound:
+	default:
+		m.backplaneStats.dropped.Add(1)
+		m.deadLetter(outbound, "publish queue full")
+	}
+}
+
+// SetDeadLetters keeps the broadcasts that couldn't be published in deadLetters, which
+// publishes them again when redriven. Call before ConnectBackplane.
+func (m *Manager) SetDeadLetters(deadLetters *deadletter.Queue) {
+	m.deadLetters = deadLetters
+	deadLetters.Handle(deadletter.SourceBackplane, func(ctx context.Context, letter *deadletter.Letter) error {
+		if m.backplane == nil {
+			return errors.New("no backplane is connected")
+		}
+		if err := m.backplane.Publish(ctx, letter.Target, letter.Payload); err != nil {
+			m.backplaneStats.errors.Add(1)
+			return err
+		}
+		m.backplaneStats.published.Add(1)
+		return nil
+	})
+}
+
+// deadLetter keeps a broadcast that couldn't be published
+func (m *Manager) deadLetter(message outboundMessage, reason string) {
+	if m.deadLetters == nil {
+		return
+	}
+	m.deadLetters.Add(deadletter.Letter{
+		Source:   deadletter.SourceBackplane,
+		Type:     string(message.eventType),
+		Target:   message.key,
+		Attempts: 1,
+		Error:    reason,
+		Payload:  message.data,
+	})
+}
+
+// eventUser returns the ID of the user an event concerns, or "" for events about no one user
+func eventUser(event *Event) string {
+	if a, ok := event.Payload.(actor); ok {
+		return a.actorID()
+	}
+	if fields, ok := event.Payload.(Fields); ok {
+		for _, field := range []string{"user_id", "from"} {
+			if id, ok := fields[field].(string); ok {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// receive delivers a broadcast relayed from another replica to local clients
+func (m *Manager) receive(message []byte) {
+	var msg backplaneMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		m.backplaneStats.errors.Add(1)
+		log.Printf("Ignoring malformed backplane message: %v", err)
+		return
+	}
+	if msg.Origin == m.instanceID {
+		return // Already delivered locally
+	}
+
+	payload, err := decodePayload(msg.Type, msg.Payload)
+	if err != nil {
+		m.backplaneStats.errors.Add(1)
+		log.Printf("Ignoring backplane %s event with a malformed payload: %v", msg.Type, err)
+		return
+	}
+
+	m.backplaneStats.received.Add(1)
+	m.broadcastLocal(&Event{
+		Type:      msg.Type,
+		Payload:   payload,
+		ID:        msg.ID,
+		Timestamp: msg.Timestamp,
+		Topic:     msg.Topic,
+		TenantID:  msg.TenantID,
+	})
+}
@@ -0,0 +1,50 @@
+package events
+
+// WithholdFrom replaces the senders whose chat activity is withheld from a user's connection
+// on this replica (see withholds). It reports false when the user isn't connected here.
+func (m *Manager) WithholdFrom(userID string, senderIDs []string) bool {
+	client, ok := m.Client(userID)
+	if !ok {
+		return false
+	}
+	client.SetWithheld(senderIDs)
+	return true
+}
+
+// SetWithheld replaces the senders whose chat activity is withheld from the client
+func (c *Client) SetWithheld(senderIDs []string) {
+	withheld := make(map[string]struct{}, len(senderIDs))
+	for _, id := range senderIDs {
+		withheld[id] = struct{}{}
+	}
+
+	c.withheldMu.Lock()
+	c.withheld = withheld
+	c.withheldMu.Unlock()
+}
+
+// withholds reports whether an event is chat activity (a message, mention, edit, reaction or
+// attachment) of a sender the client blocked or muted
+func (c *Client) withholds(event *Event) bool {
+	sender := eventSender(event)
+	if sender == "" {
+		return false
+	}
+
+	c.withheldMu.Lock()
+	defer c.withheldMu.Unlock()
+	_, ok := c.withheld[sender]
+	return ok
+}
+
+// eventSender returns the ID of the user whose chat activity an event reports, or "" for
+// other events
+func eventSender(event *Event) string {
+	switch event.Type {
+	case EventTypeChat, EventTypeMention, EventTypeMessageUpdated, EventTypeReactionAdded,
+		EventTypeReactionRemoved, EventTypeAttachmentAdded, EventTypeTyping:
+		return eventUser(event)
+	default:
+		return ""
+	}
+}
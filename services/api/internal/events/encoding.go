@@ -0,0 +1,295 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Encoding identifies how events are serialized on a client's connection
+type Encoding string
+
+const (
+	// EncodingJSON sends the envelope of the protocol version as JSON text frames
+	EncodingJSON Encoding = "json"
+	// EncodingMsgpack sends the same envelope as MessagePack binary frames
+	EncodingMsgpack Encoding = "msgpack"
+	// EncodingProto sends events.v1.Event protobuf binary frames (see proto/events/v1/events.proto),
+	// whatever the protocol version
+	EncodingProto Encoding = "proto"
+)
+
+// ParseEncoding parses "json", "msgpack" or "proto" ("" is JSON)
+func ParseEncoding(value string) (Encoding, error) {
+	switch encoding := Encoding(strings.ToLower(strings.TrimSpace(value))); encoding {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingMsgpack, EncodingProto:
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("unknown event encoding %q (expected json, msgpack or proto)", value)
+	}
+}
+
+// SplitEncoding splits a subprotocol such as "events.v1.msgpack" into the protocol version
+// part ("events.v1") and its encoding; subprotocols without a suffix are JSON
+func SplitEncoding(subprotocol string) (string, Encoding, error) {
+	parts := strings.Split(subprotocol, ".")
+	if len(parts) < 3 {
+		return subprotocol, EncodingJSON, nil
+	}
+	encoding, err := ParseEncoding(parts[len(parts)-1])
+	if err != nil {
+		return "", "", err
+	}
+	return strings.Join(parts[:len(parts)-1], "."), encoding, nil
+}
+
+// Binary reports whether the encoding is sent in binary frames
+func (e Encoding) Binary() bool {
+	return e == EncodingMsgpack || e == EncodingProto
+}
+
+// MessageType returns the WebSocket frame type of the encoding
+func (e Encoding) MessageType() int {
+	if e.Binary() {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// wireFormat is the protocol version, encoding and payload schema version events are sent in
+type wireFormat struct {
+	version  ProtocolVersion
+	encoding Encoding
+	schema   int
+}
+
+// EncodeAs marshals the event in the envelope of the protocol version and the given encoding
+func (e *Event) EncodeAs(version ProtocolVersion, encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case EncodingMsgpack:
+		data, err := e.Encode(version)
+		if err != nil {
+			return nil, err
+		}
+		return jsonToMsgpack(data)
+	case EncodingProto:
+		return e.encodeProto()
+	default:
+		return e.Encode(version)
+	}
+}
+
+// Protobuf field numbers of events.v1.Event
+const (
+	protoFieldID protowire.Number = iota + 1
+	protoFieldType
+	protoFieldTimestamp
+	protoFieldPayload
+	protoFieldSeq
+	protoFieldSchema
+)
+
+// encodeProto marshals the event as an events.v1.Event. The payload goes through JSON first,
+// like the gRPC event stream, so it holds exactly what JSON clients receive.
+func (e *Event) encodeProto() ([]byte, error) {
+	data, err := json.Marshal(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	payload, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, protoFieldID, protowire.BytesType)
+	b = protowire.AppendString(b, e.ID)
+	b = protowire.AppendTag(b, protoFieldType, protowire.BytesType)
+	b = protowire.AppendString(b, string(e.Type))
+	if !e.Timestamp.IsZero() {
+		timestamp, err := proto.Marshal(timestamppb.New(e.Timestamp))
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, protoFieldTimestamp, protowire.BytesType)
+		b = protowire.AppendBytes(b, timestamp)
+	}
+	b = protowire.AppendTag(b, protoFieldSchema, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(e.schemaVersion()))
+	b = protowire.AppendTag(b, protoFieldPayload, protowire.BytesType)
+	return protowire.AppendBytes(b, payloadBytes), nil
+}
+
+// jsonToMsgpack transcodes a JSON document to MessagePack
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(make([]byte, 0, len(data)), value)
+}
+
+// appendMsgpack appends a decoded JSON value in its most compact MessagePack form
+func appendMsgpack(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case string:
+		return appendMsgpackString(b, v), nil
+	case []interface{}:
+		switch n := len(v); {
+		case n < 16:
+			b = append(b, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+		}
+		for _, item := range v {
+			var err error
+			if b, err = appendMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackMapHeader(b, len(keys))
+		for _, key := range keys {
+			b = appendMsgpackString(b, key)
+			var err error
+			if b, err = appendMsgpack(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported MessagePack value %T", value)
+	}
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i >= -32 && i < 0:
+		return append(b, byte(0xe0|(i+32)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// stampSeq adds the sequence number to an encoded event: a "seq" member of the JSON or
+// MessagePack envelope, or the seq field of a protobuf one
+func stampSeq(data []byte, seq int64, encoding Encoding) []byte {
+	switch encoding {
+	case EncodingMsgpack:
+		return stampMsgpackSeq(data, seq)
+	case EncodingProto:
+		stamped := make([]byte, 0, len(data)+11)
+		stamped = append(stamped, data...)
+		stamped = protowire.AppendTag(stamped, protoFieldSeq, protowire.VarintType)
+		return protowire.AppendVarint(stamped, uint64(seq))
+	default:
+		stamped := make([]byte, 0, len(data)+24)
+		stamped = append(stamped, `{"seq":`...)
+		stamped = strconv.AppendInt(stamped, seq, 10)
+		if len(data) > 2 {
+			stamped = append(stamped, ',')
+		}
+		return append(stamped, data[1:]...)
+	}
+}
+
+// stampMsgpackSeq prepends a "seq" entry to a MessagePack map, growing its header
+func stampMsgpackSeq(data []byte, seq int64) []byte {
+	var n, header int
+	switch {
+	case len(data) >= 1 && data[0]&0xf0 == 0x80:
+		n, header = int(data[0]&0x0f), 1
+	case len(data) >= 3 && data[0] == 0xde:
+		n, header = int(binary.BigEndian.Uint16(data[1:])), 3
+	case len(data) >= 5 && data[0] == 0xdf:
+		n, header = int(binary.BigEndian.Uint32(data[1:])), 5
+	default:
+		return data // Not a map; left unstamped
+	}
+	stamped := make([]byte, 0, len(data)+16)
+	stamped = appendMsgpackMapHeader(stamped, n+1)
+	stamped = appendMsgpackString(stamped, "seq")
+	stamped = appendMsgpackInt(stamped, seq)
+	return append(stamped, data[header:]...)
+}
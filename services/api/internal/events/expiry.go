@@ -0,0 +1,119 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// Close codes sent to clients whose token expired or couldn't be renewed (application range;
+// mirror the 440 Login Time-out status)
+const (
+	CloseTokenExpired      = 4440
+	CloseAuthRefreshFailed = 4441 // A refresh_auth frame carried an invalid token or another user's
+)
+
+// TokenExpiryPolicy decides what happens to a connection when the token it was opened with
+// expires
+type TokenExpiryPolicy string
+
+const (
+	TokenExpiryClose  TokenExpiryPolicy = "close"  // Close the connection at expiry
+	TokenExpiryReauth TokenExpiryPolicy = "reauth" // Send reauth_required ahead of expiry, then close unless the token is renewed
+	TokenExpiryIgnore TokenExpiryPolicy = "ignore" // Keep the connection open
+)
+
+// ParseTokenExpiryPolicy parses "close", "reauth" or "ignore"
+func ParseTokenExpiryPolicy(value string) (TokenExpiryPolicy, error) {
+	switch policy := TokenExpiryPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case TokenExpiryClose, TokenExpiryReauth, TokenExpiryIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown token expiry policy %q (expected close, reauth or ignore)", value)
+	}
+}
+
+// SetTokenExpiry sets what happens when a client's token expires; with TokenExpiryReauth,
+// clients are told notice before it does (call before Run)
+func (m *Manager) SetTokenExpiry(policy TokenExpiryPolicy, notice time.Duration) {
+	m.tokenExpiry = policy
+	m.reauthNotice = notice
+}
+
+// scheduleExpiry arms the client's expiry timer for its current ExpiresAt, replacing any
+// earlier one. Clients without an expiry, or under TokenExpiryIgnore, are left alone.
+func (m *Manager) scheduleExpiry(client *Client) {
+	client.authMu.Lock()
+	defer client.authMu.Unlock()
+
+	if client.expiryTimer != nil {
+		client.expiryTimer.Stop()
+		client.expiryTimer = nil
+	}
+	if m.tokenExpiry == TokenExpiryIgnore || client.ExpiresAt.IsZero() {
+		return
+	}
+
+	expiresAt := client.ExpiresAt
+	if m.tokenExpiry == TokenExpiryReauth {
+		// Timers run on their own goroutine, so a client too close to expiry for the full
+		// notice is warned right away without blocking registration
+		client.expiryTimer = time.AfterFunc(time.Until(expiresAt.Add(-m.reauthNotice)), func() { m.requireReauth(client, expiresAt) })
+		return
+	}
+	client.expiryTimer = time.AfterFunc(time.Until(expiresAt), func() { m.expireClient(client, expiresAt) })
+}
+
+// requireReauth asks a client to renew its token before it expires at expiresAt
+func (m *Manager) requireReauth(client *Client, expiresAt time.Time) {
+	client.authMu.Lock()
+	renewed := !client.ExpiresAt.Equal(expiresAt)
+	if !renewed {
+		client.expiryTimer = time.AfterFunc(time.Until(expiresAt), func() { m.expireClient(client, expiresAt) })
+	}
+	client.authMu.Unlock()
+	if renewed {
+		return
+	}
+
+	m.deliver(client.ID, newEncodedEvent(NewReauthRequiredEvent(expiresAt)))
+}
+
+// expireClient closes a client whose token expired at expiresAt
+func (m *Manager) expireClient(client *Client, expiresAt time.Time) {
+	client.authMu.Lock()
+	renewed := !client.ExpiresAt.Equal(expiresAt)
+	client.expiryTimer = nil
+	client.authMu.Unlock()
+	if renewed {
+		return
+	}
+
+	log.Printf("🔑 Closing connection for %s (%s): token expired at %s", client.Name, client.ID, expiresAt.Format(time.RFC3339))
+	m.CloseClient(client, CloseTokenExpired, "token expired")
+}
+
+// RenewClient replaces a connected client's user with the one of a renewed token, which
+// expires at expiresAt (zero never), reschedules its expiry and replies with auth_refreshed
+func (m *Manager) RenewClient(client *Client, user *models.User, expiresAt time.Time) {
+	client.authMu.Lock()
+	client.User = user
+	client.ExpiresAt = expiresAt
+	client.authMu.Unlock()
+
+	m.scheduleExpiry(client)
+	m.deliver(client.ID, newEncodedEvent(NewAuthRefreshedEvent(expiresAt)))
+}
+
+// stopExpiry disarms the client's expiry timer once it disconnects
+func (c *Client) stopExpiry() {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// fanOutQueueSize bounds the broadcasts waiting for each worker; broadcasting blocks while a
+// worker's queue is full
+const fanOutQueueSize = 1024
+
+// fanOutBatchSize bounds the broadcasts a worker delivers in one pass over its shards
+const fanOutBatchSize = 64
+
+// fanOutJob is a broadcast being delivered by the workers
+type fanOutJob struct {
+	encoded  *encodedEvent
+	queuedAt time.Time
+	pending  atomic.Int32 // Workers yet to deliver it
+}
+
+// fanOutCounters are the fan-out metrics
+type fanOutCounters struct {
+	broadcasts   atomic.Int64
+	totalLatency atomic.Int64 // Nanoseconds
+	maxLatency   atomic.Int64
+	lastLatency  atomic.Int64
+	queueFull    atomic.Int64
+}
+
+// FanOutStats reports how long broadcasts take to reach every local client
+type FanOutStats struct {
+	Workers       int     `json:"workers"` // 0 when broadcasts are delivered on the caller's goroutine
+	Queued        int     `json:"queued"`  // Broadcasts waiting in the fullest worker's queue
+	Broadcasts    int64   `json:"broadcasts"`
+	AvgLatencyMs  float64 `json:"avgLatencyMs"` // From broadcast to the last client's send queue
+	MaxLatencyMs  float64 `json:"maxLatencyMs"`
+	LastLatencyMs float64 `json:"lastLatencyMs"`
+	QueueFull     int64   `json:"queueFull"` // Broadcasts that waited for room in a worker's queue
+}
+
+// SetFanOutWorkers sets the number of workers broadcasts are delivered by (call before Run).
+// Each worker owns a fixed set of shards, so a client receives broadcasts in order. 0 uses
+// GOMAXPROCS; there are never more workers than shards.
+func (m *Manager) SetFanOutWorkers(workers int) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	m.fanOutWorkers = min(workers, clientShards)
+}
+
+// startFanOut starts the fan-out workers
+func (m *Manager) startFanOut() {
+	if m.fanOutWorkers <= 0 {
+		m.SetFanOutWorkers(0)
+	}
+	m.fanOutQueues = make([]chan *fanOutJob, m.fanOutWorkers)
+	for i := range m.fanOutQueues {
+		queue := make(chan *fanOutJob, fanOutQueueSize)
+		m.fanOutQueues[i] = queue
+
+		var shards []*clientShard
+		for j := i; j < len(m.shards); j += m.fanOutWorkers {
+			shards = append(shards, m.shards[j])
+		}
+		go m.runFanOutWorker(queue, shards)
+	}
+	m.fanOutStarted.Store(true)
+}
+
+// fanOut queues a broadcast for every worker, or delivers it on the caller's goroutine until
+// the workers are started
+func (m *Manager) fanOut(encoded *encodedEvent) {
+	if !m.fanOutStarted.Load() {
+		start := time.Now()
+		batch := []*encodedEvent{encoded}
+		for _, shard := range m.shards {
+			m.broadcastShard(shard, batch)
+		}
+		m.recordFanOut(time.Since(start))
+		return
+	}
+
+	job := &fanOutJob{encoded: encoded, queuedAt: time.Now()}
+	job.pending.Store(int32(len(m.fanOutQueues)))
+	for _, queue := range m.fanOutQueues {
+		select {
+		case queue <- job:
+		default:
+			m.fanOutStats.queueFull.Add(1)
+			queue <- job
+		}
+	}
+}
+
+// runFanOutWorker delivers queued broadcasts to the clients of its shards, taking up to
+// fanOutBatchSize at a time so each shard is snapshotted once per batch
+func (m *Manager) runFanOutWorker(queue <-chan *fanOutJob, shards []*clientShard) {
+	jobs := make([]*fanOutJob, 0, fanOutBatchSize)
+	batch := make([]*encodedEvent, 0, fanOutBatchSize)
+	for job := range queue {
+		jobs = append(jobs[:0], job)
+	drain:
+		for len(jobs) < fanOutBatchSize {
+			select {
+			case next := <-queue:
+				jobs = append(jobs, next)
+			default:
+				break drain
+			}
+		}
+
+		batch = batch[:0]
+		for _, job := range jobs {
+			batch = append(batch, job.encoded)
+		}
+		for _, shard := range shards {
+			m.broadcastShard(shard, batch)
+		}
+		for _, job := range jobs {
+			if job.pending.Add(-1) == 0 {
+				m.recordFanOut(time.Since(job.queuedAt))
+			}
+		}
+	}
+}
+
+// recordFanOut records the latency of a delivered broadcast
+func (m *Manager) recordFanOut(latency time.Duration) {
+	m.fanOutStats.broadcasts.Add(1)
+	m.fanOutStats.totalLatency.Add(int64(latency))
+	m.fanOutStats.lastLatency.Store(int64(latency))
+	for {
+		current := m.fanOutStats.maxLatency.Load()
+		if int64(latency) <= current || m.fanOutStats.maxLatency.CompareAndSwap(current, int64(latency)) {
+			break
+		}
+	}
+}
+
+// FanOutStats returns fan-out metrics
+func (m *Manager) FanOutStats() FanOutStats {
+	stats := FanOutStats{
+		Broadcasts:    m.fanOutStats.broadcasts.Load(),
+		MaxLatencyMs:  milliseconds(m.fanOutStats.maxLatency.Load()),
+		LastLatencyMs: milliseconds(m.fanOutStats.lastLatency.Load()),
+		QueueFull:     m.fanOutStats.queueFull.Load(),
+	}
+	if stats.Broadcasts > 0 {
+		stats.AvgLatencyMs = milliseconds(m.fanOutStats.totalLatency.Load() / stats.Broadcasts)
+	}
+	if m.fanOutStarted.Load() {
+		stats.Workers = len(m.fanOutQueues)
+		for _, queue := range m.fanOutQueues {
+			stats.Queued = max(stats.Queued, len(queue))
+		}
+	}
+	return stats
+}
+
+// milliseconds converts nanoseconds to fractional milliseconds
+func milliseconds(nanos int64) float64 {
+	return float64(nanos) / float64(time.Millisecond)
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// InboundFrame is a message sent by a WebSocket client. Frames are JSON whatever the
+// connection's encoding:
+//
+//	{"type": "send_chat", "id": "c1", "payload": {"to": "user-2", "content": "hi"}}
+type InboundFrame struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"` // Chosen by the client and echoed in replies
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// FrameHandler handles a frame of one type. Handlers run on the client's read loop, so they
+// must not block for long. A *FrameError is sent to the client as is; other errors are
+// logged and reported as frame_failed.
+type FrameHandler func(client *Client, frame InboundFrame) error
+
+// FrameError refuses an inbound frame with a code clients can act on
+type FrameError struct {
+	Code   string
+	Detail string
+}
+
+// NewFrameError creates a frame error
+func NewFrameError(code, detail string) *FrameError {
+	return &FrameError{Code: code, Detail: detail}
+}
+
+func (e *FrameError) Error() string {
+	return e.Code + ": " + e.Detail
+}
+
+// frameRoute is the handler of a frame type and the roles allowed to send it (any of them)
+type frameRoute struct {
+	handle FrameHandler
+	roles  []string
+}
+
+// HandleFrame registers the handler of a frame type, replacing any previous one. With roles,
+// only users with one of them may send it. Register handlers before clients start connecting.
+func (m *Manager) HandleFrame(frameType string, handler FrameHandler, roles ...string) {
+	m.frames[frameType] = frameRoute{handle: handler, roles: roles}
+}
+
+// ReplyFrame sends the result of a frame to the client that sent it
+func (m *Manager) ReplyFrame(client *Client, frame InboundFrame, result interface{}) {
+	m.deliver(client.ID, newEncodedEvent(NewEvent(EventTypeFrameResult, &FrameResultPayload{
+		ID:     frame.ID,
+		Type:   frame.Type,
+		Result: result,
+	})))
+}
+
+// dispatchFrame decodes an inbound frame and passes it to the handler of its type, replying
+// with a frame_error when it's malformed, unknown, not allowed or fails
+func (m *Manager) dispatchFrame(client *Client, data []byte) {
+	var frame InboundFrame
+	if err := json.Unmarshal(data, &frame); err != nil || frame.Type == "" {
+		m.refuseFrame(client, frame, NewFrameError("invalid_frame", "Frames must be JSON objects with a type"))
+		return
+	}
+
+	route, ok := m.frames[frame.Type]
+	if !ok {
+		m.refuseFrame(client, frame, NewFrameError("unknown_frame_type", "Unknown frame type "+frame.Type))
+		return
+	}
+	if !hasAnyRole(client, route.roles) {
+		m.refuseFrame(client, frame, NewFrameError("forbidden", "You are not allowed to send "+frame.Type+" frames"))
+		return
+	}
+
+	if err := route.handle(client, frame); err != nil {
+		var frameErr *FrameError
+		if !errors.As(err, &frameErr) {
+			log.Printf("Error handling %s frame from %s: %v", frame.Type, client.ID, err)
+			frameErr = NewFrameError("frame_failed", "The frame could not be handled")
+		}
+		m.refuseFrame(client, frame, frameErr)
+	}
+}
+
+// refuseFrame tells a client why one of its frames was refused
+func (m *Manager) refuseFrame(client *Client, frame InboundFrame, err *FrameError) {
+	m.deliver(client.ID, newEncodedEvent(NewEvent(EventTypeFrameError, &FrameErrorPayload{
+		ID:     frame.ID,
+		Type:   frame.Type,
+		Code:   err.Code,
+		Detail: err.Detail,
+	})))
+}
+
+// hasAnyRole reports whether the client's user has one of the roles, or roles is empty
+func hasAnyRole(client *Client, roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	user := client.Identity()
+	for _, role := range roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePingFrame answers a ping frame with a pong, so clients can measure latency and check
+// the connection without a REST call
+func (m *Manager) handlePingFrame(client *Client, frame InboundFrame) error {
+	m.deliver(client.ID, newEncodedEvent(NewEvent(EventTypePong, &FrameResultPayload{ID: frame.ID, Type: frame.Type})))
+	return nil
+}
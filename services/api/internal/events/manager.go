@@ -1,28 +1,105 @@
 package events
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"log"
+	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	"api-service/internal/deadletter"
+	"api-service/internal/models"
+	"api-service/internal/topics"
 )
 
 // Client represents a connected WebSocket client
 type Client struct {
-	ID      string          // User ID from JWT
-	Name    string          // User display name
-	Email   string          // User email
-	Conn    *websocket.Conn // WebSocket connection
-	send    chan []byte     // Buffered channel for outbound messages
-	manager *Manager        // Reference to the manager
+	ID            string          // User ID from JWT
+	Name          string          // User display name
+	Email         string          // User email
+	TenantID      string          // Azure AD tenant ID (tid claim)
+	Protocol      ProtocolVersion // Negotiated event protocol version
+	Encoding      Encoding        // Negotiated event encoding ("" is JSON)
+	SchemaVersion int             // Payload schema version the client was built against (see schema.go)
+	AppVersion    string          // Frontend app version reported at connect (may be empty)
+	User          *models.User    // Authenticated user, for topic access checks; read it with Identity once registered
+	ExpiresAt     time.Time       // Expiry of the connection's token; zero never expires. Replaced by RenewClient (see expiry.go)
+	ConnectedAt   time.Time       // Set when the client is registered
+	Conn          *websocket.Conn // WebSocket connection
+	RemoteAddr    string          // Client address, resolved behind trusted proxies (see middleware.ClientIP)
+	send          chan []byte     // Buffered channel for outbound messages
+	manager       *Manager        // Reference to the manager
+
+	sendMu     sync.Mutex // Guards sending on send against closing it
+	sendClosed bool
+	dropped    atomic.Int64 // Events dropped from a full send channel (see overflow.go)
+
+	closeCode   int // Close code sent once queued messages are flushed (see CloseClient)
+	closeReason string
+
+	// Token expiry and renewal (see expiry.go)
+	authMu      sync.Mutex // Guards User and ExpiresAt once registered
+	expiryTimer *time.Timer
+
+	// Topic subscriptions (see topics.go)
+	topicsMu sync.Mutex
+	topics   map[string]struct{}
+
+	// Blocked and muted senders (see blocks.go)
+	withheldMu sync.Mutex
+	withheld   map[string]struct{}
+
+	// Session resumption (see resume.go)
+	ResumeToken string // Token of the session to resume, from ?resume=
+	ResumeSeq   int64  // Sequence number of the last frame received in that session, from ?seq=
+	session     *resumeSession
 }
 
+// DefaultSendBuffer is the number of outbound events queued per client by default
+const DefaultSendBuffer = 256
+
 // InitSendChannel initializes the send channel
 func (c *Client) InitSendChannel(size int) {
 	c.send = make(chan []byte, size)
 }
 
+// trySend queues an encoded frame without blocking. When the channel is full the overflow
+// policy for the event type applies; it reports false when the channel is already closed or
+// the client has to be disconnected.
+func (c *Client) trySend(data []byte, eventType EventType) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		if c.manager == nil {
+			return false
+		}
+		return c.manager.handleOverflow(c, data, eventType)
+	}
+}
+
+// closeSend closes the send channel, ending the write pump once queued frames are written
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.send)
+	}
+}
+
 // SetManager sets the manager reference
 func (c *Client) SetManager(m *Manager) {
 	c.manager = m
@@ -30,69 +107,302 @@ func (c *Client) SetManager(m *Manager) {
 
 // Manager manages all active WebSocket connections and event distribution
 type Manager struct {
-	clients    map[string]*Client // User ID -> Client
-	register   chan *Client       // Register requests
-	unregister chan *Client       // Unregister requests
-	mu         sync.RWMutex       // Protect clients map
+	shards       []*clientShard // Clients by user ID hash (see shards.go)
+	clientCount  atomic.Int64   // Connected clients across the shards
+	register     chan *Client   // Register requests
+	unregister   chan *Client   // Unregister requests
+	running      atomic.Bool    // Set while the main loop is running
+	started      atomic.Bool    // Set once Run is called
+	stop         chan struct{}  // Closed by Stop
+	stopOnce     sync.Once
+	done         chan struct{}         // Closed once Run has returned and every client is closed
+	protocols    *ProtocolSwitch       // Default protocol selection and per-version metrics
+	onConnect    []func(*Client)       // Hooks run after a client is registered
+	observers    []func(*Event)        // Called with events originating on this replica
+	frames       map[string]frameRoute // Handlers of inbound frames by type (see frames.go)
+	sendBuffer   int                   // Outbound events queued per client
+	compressMin  int                   // Smallest frame compressed on connections that negotiated permessage-deflate
+	schemaCompat bool                  // Downgrade payloads for clients of older schema versions (see schema.go)
+	tokenExpiry  TokenExpiryPolicy     // What happens when a client's token expires (see expiry.go)
+	reauthNotice time.Duration         // How long before expiry clients are asked to renew
+
+	// Cross-replica broadcast (see backplane.go)
+	backplane      Backplane
+	instanceID     string
+	outbound       chan outboundMessage
+	backplaneStats backplaneCounters
+	deadLetters    *deadletter.Queue // Broadcasts that couldn't be published; nil when not kept
+
+	// Inbound quotas (see quota.go)
+	quotaMu     sync.Mutex
+	limits      InboundLimits
+	onViolation func(Violation)
+	quotas      quotaCounters
+
+	// Presence (see presence.go)
+	presenceMu sync.Mutex
+	presence   map[string]*presenceState
+
+	// Topic subscriptions (see topics.go)
+	topicACL *topics.ACL
+
+	// Session resumption (see resume.go)
+	resumeSize int
+	resumeTTL  time.Duration
+
+	// Slow clients (see overflow.go)
+	overflow overflowState
+
+	// Broadcast fan-out workers (see fanout.go)
+	fanOutWorkers int
+	fanOutQueues  []chan *fanOutJob
+	fanOutStarted atomic.Bool
+	fanOutStats   fanOutCounters
 }
 
 // NewManager creates a new event manager
 func NewManager() *Manager {
-	return &Manager{
-		clients:    make(map[string]*Client),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+	protocols, _ := NewProtocolSwitch(ProtocolV1, false)
+	m := &Manager{
+		shards:       newClientShards(),
+		sendBuffer:   DefaultSendBuffer,
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		protocols:    protocols,
+		schemaCompat: true,
+		tokenExpiry:  TokenExpiryClose,
+		reauthNotice: time.Minute,
+		limits:       DefaultInboundLimits(),
+		presence:     make(map[string]*presenceState),
+	}
+	m.frames = map[string]frameRoute{
+		"ping":        {handle: m.handlePingFrame},
+		"subscribe":   {handle: m.handleSubscribeFrame},
+		"unsubscribe": {handle: m.handleUnsubscribeFrame},
+	}
+	return m
+}
+
+// SetProtocolSwitch replaces the protocol switch (call before Run)
+func (m *Manager) SetProtocolSwitch(protocols *ProtocolSwitch) {
+	m.protocols = protocols
+}
+
+// AddConnectHook registers a function run (in its own goroutine) after each client registers.
+// Hooks must be added before clients start connecting.
+func (m *Manager) AddConnectHook(hook func(*Client)) {
+	m.onConnect = append(m.onConnect, hook)
+}
+
+// AddEventObserver registers a function called with every event broadcast from, or delivered
+// to a user by, this replica (events relayed from other replicas are excluded). Observers
+// must not block. Add them before clients start connecting.
+func (m *Manager) AddEventObserver(observer func(*Event)) {
+	m.observers = append(m.observers, observer)
+}
+
+// observe notifies the event observers
+func (m *Manager) observe(event *Event) {
+	for _, observer := range m.observers {
+		observer(event)
 	}
 }
 
-// Run starts the manager's main loop
-func (m *Manager) Run() {
+// Protocols returns the manager's protocol switch
+func (m *Manager) Protocols() *ProtocolSwitch {
+	return m.protocols
+}
+
+// Run runs the manager's main loop until ctx is cancelled or Stop is called, then closes
+// every client (see shutdown)
+func (m *Manager) Run(ctx context.Context) {
+	m.started.Store(true)
+	m.startFanOut()
+	m.running.Store(true)
+	defer close(m.done)
+	defer m.running.Store(false)
+
 	for {
 		select {
 		case client := <-m.register:
 			m.registerClient(client)
 		case client := <-m.unregister:
 			m.unregisterClient(client)
+		case <-ctx.Done():
+			m.shutdown()
+			return
+		case <-m.stop:
+			m.shutdown()
+			return
 		}
 	}
 }
 
+// Stop stops the main loop and waits until every client is closed; it returns at once if
+// Run was never called
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	if m.started.Load() {
+		<-m.done
+	}
+}
+
+// Done returns a channel closed once the main loop has stopped and every client is closed
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
+
+// shutdown drains the pending registrations, refusing them, and unregistrations, then closes
+// every connected and parked client with 1001 Going Away. Clients registering afterwards
+// are refused by RegisterClient.
+func (m *Manager) shutdown() {
+	for drained := false; !drained; {
+		select {
+		case client := <-m.register:
+			client.refuse()
+		case client := <-m.unregister:
+			m.unregisterClient(client)
+		default:
+			drained = true
+		}
+	}
+
+	closed := 0
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		for userID, client := range shard.clients {
+			client.closeCode = websocket.CloseGoingAway
+			client.closeReason = "server shutting down"
+			client.retireSession()
+			client.stopExpiry()
+			client.closeSend()
+			m.protocols.recordDisconnect(client.Protocol)
+			delete(shard.clients, userID)
+			closed++
+		}
+		clear(shard.parked)
+		shard.mu.Unlock()
+	}
+	m.clientCount.Store(0)
+	log.Printf("Event manager stopped, closed %d connections", closed)
+}
+
+// refuse closes a client that registered after the manager stopped
+func (c *Client) refuse() {
+	c.closeCode = websocket.CloseGoingAway
+	c.closeReason = "server shutting down"
+	c.closeSend()
+}
+
+// Running reports whether the manager's main loop is running
+func (m *Manager) Running() bool {
+	return m.running.Load()
+}
+
 // registerClient registers a new client
 func (m *Manager) registerClient(client *Client) {
-	m.mu.Lock()
-	m.clients[client.ID] = client
-	m.mu.Unlock()
+	if client.Protocol == "" {
+		client.Protocol = ProtocolV1
+	}
+	if client.Encoding == "" {
+		client.Encoding = EncodingJSON
+	}
+	if !m.schemaCompat || client.SchemaVersion <= 0 || client.SchemaVersion > EventSchemaVersion {
+		client.SchemaVersion = EventSchemaVersion
+	}
+
+	client.ConnectedAt = time.Now().UTC()
+
+	shard := m.shard(client.ID)
+	shard.mu.Lock()
+	previous, ok := shard.clients[client.ID]
+	if !ok || previous == client {
+		previous = nil
+	}
+	missed, resumed := m.attachSession(shard, client, previous)
+	if previous != nil {
+		// The latest connection wins (e.g. an SSE reconnect before the old stream noticed it
+		// was dropped); the previous one is closed once its queued events are flushed
+		previous.retireSession()
+		previous.stopExpiry()
+		previous.closeSend()
+		m.protocols.recordDisconnect(previous.Protocol)
+	}
+	if client.session != nil {
+		// Queued before the client can be found, so nothing gets ahead of the replay
+		frames := missed
+		if sessionBytes, err := client.encodeEvent(client.newSessionEvent(resumed)); err == nil {
+			frames = append([][]byte{sessionBytes}, missed...)
+		}
+		for _, frame := range frames {
+			select {
+			case client.send <- frame:
+			default:
+			}
+		}
+		if resumed {
+			log.Printf("Client %s (%s) resumed its session after seq %d, replaying %d events", client.Name, client.ID, client.ResumeSeq, len(missed))
+		}
+	}
+	shard.clients[client.ID] = client
+	shard.mu.Unlock()
+	if previous == nil {
+		m.clientCount.Add(1)
+	}
+	m.protocols.recordConnect(client.Protocol)
+	m.trackPresence(client.ID)
+	m.scheduleExpiry(client)
 
-	log.Printf("Client connected: %s (%s)", client.Name, client.ID)
-	log.Printf("Active connections: %d", len(m.clients))
+	log.Printf("Client connected: %s (%s), protocol=%s, encoding=%s, schema=%d", client.Name, client.ID, client.Protocol, client.Encoding, client.SchemaVersion)
+	log.Printf("Active connections: %d", m.ClientCount())
 
 	// Send a welcome message to the newly connected client
 	welcomeEvent := NewUserJoinedEvent(client.ID, client.Name, client.Email)
-	welcomeBytes, err := json.Marshal(welcomeEvent)
+	welcomeBytes, err := client.encodeEvent(welcomeEvent)
 	if err == nil {
-		select {
-		case client.send <- welcomeBytes:
+		if client.enqueue(welcomeBytes, welcomeEvent.Type) {
 			log.Printf("Sent welcome message to %s", client.Name)
-		default:
+		} else {
 			log.Printf("Failed to send welcome message to %s (channel full)", client.Name)
 		}
 	}
 
 	// Notify all clients that a user joined
 	m.BroadcastEvent(NewUserJoinedEvent(client.ID, client.Name, client.Email))
+
+	// Run connect hooks off the manager loop; they may send events back through the manager
+	for _, hook := range m.onConnect {
+		go hook(client)
+	}
 }
 
 // unregisterClient unregisters a client
 func (m *Manager) unregisterClient(client *Client) {
-	m.mu.Lock()
-	if _, ok := m.clients[client.ID]; ok {
-		delete(m.clients, client.ID)
-		close(client.send)
+	shard := m.shard(client.ID)
+	shard.mu.Lock()
+	current, ok := shard.clients[client.ID]
+	removed := ok && current == client // A replaced connection was already closed
+	if removed {
+		delete(shard.clients, client.ID)
+		if !m.parkSession(shard, client) {
+			client.retireSession()
+		}
+		client.stopExpiry()
+		client.closeSend()
+		m.protocols.recordDisconnect(client.Protocol)
+	}
+	shard.mu.Unlock()
+
+	if !removed {
+		return
 	}
-	m.mu.Unlock()
+	m.clientCount.Add(-1)
+	m.forgetPresence(client.ID)
 
 	log.Printf("Client disconnected: %s (%s)", client.Name, client.ID)
-	log.Printf("Active connections: %d", len(m.clients))
+	log.Printf("Active connections: %d", m.ClientCount())
 
 	// Notify all clients that a user left
 	m.BroadcastEvent(NewUserLeftEvent(client.ID, client.Name, client.Email))
@@ -101,73 +411,278 @@ func (m *Manager) unregisterClient(client *Client) {
 // RegisterClient queues a client for registration
 func (m *Manager) RegisterClient(client *Client) {
 	client.SetManager(m)
-	m.register <- client
+	select {
+	case m.register <- client:
+	case <-m.done:
+		client.refuse()
+	}
+}
+
+// SetSendBuffer sets the number of outbound events queued per client before the overflow
+// policy applies (see overflow.go); it also bounds the events replayed on resumption
+func (m *Manager) SetSendBuffer(size int) {
+	if size <= 0 {
+		size = DefaultSendBuffer
+	}
+	m.sendBuffer = size
+}
+
+// SendBuffer returns the number of outbound events queued per client
+func (m *Manager) SendBuffer() int {
+	return m.sendBuffer
+}
+
+// SetCompressionThreshold sets the smallest frame compressed on WebSocket connections that
+// negotiated permessage-deflate; smaller frames aren't worth the CPU
+func (m *Manager) SetCompressionThreshold(minBytes int) {
+	m.compressMin = minBytes
+}
+
+// Subscribe registers a client that isn't backed by a WebSocket connection (such as a gRPC
+// stream) and returns the channel its encoded events are delivered on. The channel is
+// closed once the client is unregistered.
+func (m *Manager) Subscribe(client *Client, buffer int) <-chan []byte {
+	client.InitSendChannel(buffer)
+	m.RegisterClient(client)
+	return client.send
 }
 
 // UnregisterClient queues a client for unregistration
 func (m *Manager) UnregisterClient(client *Client) {
-	m.unregister <- client
+	select {
+	case m.unregister <- client:
+	case <-m.done: // Already closed by shutdown
+	}
 }
 
 // GetActiveUsers returns a list of all connected users
 func (m *Manager) GetActiveUsers() []map[string]string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	users := make([]map[string]string, 0, len(m.clients))
-	for _, client := range m.clients {
+	users := make([]map[string]string, 0, m.ClientCount())
+	m.eachClient(func(client *Client) {
+		presence := m.GetPresence(client.ID)
 		users = append(users, map[string]string{
-			"id":    client.ID,
-			"name":  client.Name,
-			"email": client.Email,
+			"id":         client.ID,
+			"name":       client.Name,
+			"email":      client.Email,
+			"status":     string(presence.Status),
+			"statusText": presence.Text,
 		})
-	}
+	})
 	return users
 }
 
+// Session describes a live WebSocket connection
+type Session struct {
+	UserID        string          `json:"userId"`
+	Name          string          `json:"name"`
+	Email         string          `json:"email"`
+	TenantID      string          `json:"tenantId"`
+	Protocol      ProtocolVersion `json:"protocol"`
+	Encoding      Encoding        `json:"encoding,omitempty"`
+	SchemaVersion int             `json:"schemaVersion"`
+	AppVersion    string          `json:"appVersion,omitempty"`
+	ConnectedAt   time.Time       `json:"connectedAt"`
+	DroppedEvents int64           `json:"droppedEvents"` // Events dropped from a full send queue
+}
+
+// Sessions returns the live connections ordered by user ID
+func (m *Manager) Sessions() []Session {
+	sessions := make([]Session, 0, m.ClientCount())
+	m.eachClient(func(client *Client) {
+		sessions = append(sessions, Session{
+			UserID:        client.ID,
+			Name:          client.Name,
+			Email:         client.Email,
+			TenantID:      client.TenantID,
+			Protocol:      client.Protocol,
+			Encoding:      client.Encoding,
+			SchemaVersion: client.SchemaVersion,
+			AppVersion:    client.AppVersion,
+			ConnectedAt:   client.ConnectedAt,
+			DroppedEvents: client.dropped.Load(),
+		})
+	})
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].UserID < sessions[j].UserID })
+	return sessions
+}
+
+// TenantClients returns the connected clients belonging to a tenant
+func (m *Manager) TenantClients(tenantID string) []*Client {
+	var tenantClients []*Client
+	m.eachClient(func(client *Client) {
+		if client.TenantID == tenantID {
+			tenantClients = append(tenantClients, client)
+		}
+	})
+	return tenantClients
+}
+
+// DisconnectTenant closes the connections of all clients belonging to a tenant
+// and returns the number of clients disconnected
+func (m *Manager) DisconnectTenant(tenantID string) int {
+	tenantClients := m.TenantClients(tenantID)
+	for _, client := range tenantClients {
+		m.UnregisterClient(client)
+	}
+	return len(tenantClients)
+}
+
+// CloseClient disconnects a client with the given close code once the events already
+// queued for it have been sent
+func (m *Manager) CloseClient(client *Client, code int, reason string) {
+	client.closeCode = code
+	client.closeReason = reason
+	m.UnregisterClient(client)
+}
+
+// CountTenantClients returns the number of connected clients belonging to a tenant
+func (m *Manager) CountTenantClients(tenantID string) int {
+	count := 0
+	m.eachClient(func(client *Client) {
+		if client.TenantID == tenantID {
+			count++
+		}
+	})
+	return count
+}
+
+// Client returns the connected client of a user
+func (m *Manager) Client(userID string) (*Client, bool) {
+	shard := m.shard(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	client, exists := shard.clients[userID]
+	return client, exists
+}
+
+// UserProtocol returns the protocol version a connected user negotiated
+func (m *Manager) UserProtocol(userID string) (ProtocolVersion, bool) {
+	client, exists := m.Client(userID)
+	if !exists {
+		return "", false
+	}
+	return client.Protocol, true
+}
+
 // SendEventToUser sends an event to a specific user
 func (m *Manager) SendEventToUser(userID string, event *Event) bool {
-	m.mu.RLock()
-	client, exists := m.clients[userID]
-	m.mu.RUnlock()
+	if !m.deliver(userID, newEncodedEvent(event)) {
+		return false
+	}
+	m.observe(event)
+	return true
+}
 
+// deliver queues an event for a connected user, without notifying observers
+func (m *Manager) deliver(userID string, encoded *encodedEvent) bool {
+	event := encoded.event
+	client, parked, exists := m.lookup(userID)
 	if !exists {
 		return false
 	}
+	if !encoded.authorized(client) {
+		return false
+	}
+	if client.withholds(event) {
+		return !parked // Dropped, but reported as delivered so muted senders can't tell
+	}
 
-	eventBytes, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Failed to marshal event: %v", err)
+	eventBytes, ok := encoded.encode(client, m.protocols)
+	if !ok {
 		return false
 	}
 
-	select {
-	case client.send <- eventBytes:
-		return true
-	default:
-		// Channel is full, close the connection
-		m.UnregisterClient(client)
+	if !client.enqueue(eventBytes, event.Type) {
+		if !parked {
+			// Channel is full and the overflow policy gave up on the client, close the connection
+			m.UnregisterClient(client)
+		}
 		return false
 	}
+	// A parked session replays the event if the client resumes, but the user is offline
+	return !parked
 }
 
-// BroadcastEvent sends an event to all connected clients
+// SendEventToUsers sends an event to each of the given users connected to this replica and
+// returns how many received it. Observers see the event once.
+func (m *Manager) SendEventToUsers(userIDs []string, event *Event) int {
+	delivered := 0
+	encoded := newEncodedEvent(event)
+	for _, userID := range userIDs {
+		if m.deliver(userID, encoded) {
+			delivered++
+		}
+	}
+	if delivered > 0 {
+		m.observe(event)
+	}
+	return delivered
+}
+
+// BroadcastEvent sends an event to all connected clients, on every replica when a backplane
+// is connected. Events with a Topic only go to clients subscribed to it (in the event's
+// tenant, when it has one).
 func (m *Manager) BroadcastEvent(event *Event) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.broadcastLocal(event)
+	m.publish(event)
+	m.observe(event)
+}
 
-	eventBytes, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Failed to marshal event: %v", err)
-		return
+// recipientsPool recycles the client snapshots taken by broadcasts
+var recipientsPool = sync.Pool{
+	New: func() interface{} {
+		recipients := make([]*Client, 0, 256)
+		return &recipients
+	},
+}
+
+// broadcastLocal sends an event to the clients connected to this replica, and records it for
+// parked sessions, through the fan-out workers. The event is encoded once per protocol
+// version in use.
+func (m *Manager) broadcastLocal(event *Event) {
+	m.fanOut(newEncodedEvent(event))
+}
+
+// broadcastShard sends a batch of events, in order, to the clients of a shard. The clients
+// are snapshotted under the shard's read lock, which is released before sending.
+func (m *Manager) broadcastShard(shard *clientShard, batch []*encodedEvent) {
+	recipients := recipientsPool.Get().(*[]*Client)
+	defer func() {
+		clear(*recipients)
+		*recipients = (*recipients)[:0]
+		recipientsPool.Put(recipients)
+	}()
+
+	shard.mu.RLock()
+	for _, client := range shard.clients {
+		*recipients = append(*recipients, client)
+	}
+	connected := len(*recipients)
+	for _, client := range shard.parked {
+		*recipients = append(*recipients, client)
 	}
+	shard.mu.RUnlock()
 
-	for _, client := range m.clients {
-		select {
-		case client.send <- eventBytes:
-		default:
-			// Channel is full, close the connection
-			go m.UnregisterClient(client)
+	for i, client := range *recipients {
+		for _, encoded := range batch {
+			event := encoded.event
+			if event.Topic != "" && !m.receives(client, event) {
+				continue
+			}
+			if client.withholds(event) || !encoded.authorized(client) {
+				continue
+			}
+			eventBytes, ok := encoded.encode(client, m.protocols)
+			if !ok {
+				continue
+			}
+			if !client.enqueue(eventBytes, event.Type) && i < connected {
+				// Channel is full and the overflow policy gave up on the client, close the connection
+				go m.UnregisterClient(client)
+				break
+			}
 		}
 	}
 }
@@ -181,25 +696,116 @@ func (c *Client) Start() {
 // readPump handles incoming messages from the WebSocket
 func (c *Client) readPump() {
 	defer func() {
-		log.Printf("readPump ending for client %s (%s)", c.Name, c.ID)
+		slog.Debug("readPump ending", "client", c.Name, "id", c.ID)
 		c.manager.UnregisterClient(c)
 		c.Conn.Close()
 	}()
 
-	log.Printf("readPump started for client %s (%s)", c.Name, c.ID)
+	slog.Debug("readPump started", "client", c.Name, "id", c.ID)
+
+	limits := c.manager.inboundLimits()
+	if limits.MaxFrameBytes > 0 {
+		c.Conn.SetReadLimit(limits.MaxFrameBytes * hardFrameLimitFactor)
+	}
+	var bucket *tokenBucket
+	if limits.MessagesPerSecond > 0 {
+		bucket = newTokenBucket(limits.MessagesPerSecond, limits.Burst)
+	}
+	violations := 0
 
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, reader, err := c.Conn.NextReader()
+		if err == nil {
+			err = c.readFrame(reader, limits, bucket, &violations)
+		}
 		if err != nil {
+			if errors.Is(err, errQuotaExceeded) {
+				break
+			}
+			if errors.Is(err, websocket.ErrReadLimit) {
+				// Beyond the hard limit the frame can't be skipped; gorilla has already sent close 1009
+				violations++
+				c.closeCode = websocket.CloseMessageTooBig
+				log.Printf("🚫 Closing connection for %s (%s) from %s: frame over the hard limit of %d bytes", c.Name, c.ID, c.RemoteAddr, limits.MaxFrameBytes*hardFrameLimitFactor)
+				c.manager.recordViolation(c.violation(ViolationFrameTooLarge, violations, true))
+				break
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error for %s: %v", c.Name, err)
+				c.manager.protocols.recordAbnormalClose(c.Protocol)
 			} else {
 				log.Printf("WebSocket closed normally for %s", c.Name)
 			}
 			break
 		}
-		// We don't expect clients to send messages through WebSocket
-		// All actions should go through REST API
+	}
+}
+
+// maxHandledFrameBytes bounds the frames passed to handlers when no frame size limit is set
+const maxHandledFrameBytes = 64 << 10
+
+// errQuotaExceeded ends the read loop after a client was closed for quota violations
+var errQuotaExceeded = errors.New("inbound quota exceeded")
+
+// readFrame consumes one inbound frame, enforcing the frame size and rate limits, and passes
+// frames within them to the frame handlers. Oversized frames are drained without buffering.
+func (c *Client) readFrame(reader io.Reader, limits InboundLimits, bucket *tokenBucket, violations *int) error {
+	capacity := limits.MaxFrameBytes
+	if capacity <= 0 {
+		capacity = maxHandledFrameBytes
+	}
+
+	var frame bytes.Buffer
+	n, err := io.Copy(&frame, io.LimitReader(reader, capacity+1))
+	if err != nil {
+		return err
+	}
+	oversized := n > capacity
+	if oversized {
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return err
+		}
+	}
+
+	kind := ""
+	if oversized && limits.MaxFrameBytes > 0 {
+		kind = ViolationFrameTooLarge
+	}
+	if kind == "" && bucket != nil && !bucket.allow() {
+		kind = ViolationRateExceeded
+	}
+	if kind == "" {
+		c.manager.MarkActive(c.ID)
+		if !oversized {
+			c.manager.dispatchFrame(c, frame.Bytes())
+		}
+		return nil
+	}
+
+	*violations++
+	closing := limits.MaxViolations > 0 && *violations >= limits.MaxViolations
+	c.manager.recordViolation(c.violation(kind, *violations, closing))
+	if !closing {
+		return nil
+	}
+
+	log.Printf("🚫 Closing connection for %s (%s) from %s: %d inbound quota violations", c.Name, c.ID, c.RemoteAddr, *violations)
+	closeMessage := websocket.FormatCloseMessage(CloseQuotaExceeded, "inbound quota exceeded")
+	c.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	c.closeCode = CloseQuotaExceeded // Not resumable
+	return errQuotaExceeded
+}
+
+// violation describes a quota violation by this client
+func (c *Client) violation(kind string, count int, closed bool) Violation {
+	return Violation{
+		Kind:       kind,
+		ClientID:   c.ID,
+		ClientName: c.Name,
+		TenantID:   c.TenantID,
+		RemoteAddr: c.RemoteAddr,
+		Count:      count,
+		Closed:     closed,
 	}
 }
 
@@ -207,16 +813,27 @@ func (c *Client) readPump() {
 func (c *Client) writePump() {
 	defer c.Conn.Close()
 
-	log.Printf("writePump started for client %s (%s)", c.Name, c.ID)
+	slog.Debug("writePump started", "client", c.Name, "id", c.ID)
 
 	for message := range c.send {
-		log.Printf("Sending message to %s: %s", c.Name, string(message))
-		if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		if c.Encoding.Binary() {
+			slog.Debug("Sending message", "client", c.Name, "bytes", len(message), "encoding", c.Encoding)
+		} else {
+			slog.Debug("Sending message", "client", c.Name, "message", string(message))
+		}
+		// No-op unless permessage-deflate was negotiated
+		c.Conn.EnableWriteCompression(len(message) >= c.manager.compressMin)
+		if err := c.Conn.WriteMessage(c.Encoding.MessageType(), message); err != nil {
 			log.Printf("Write error for %s: %v", c.Name, err)
+			c.manager.protocols.recordWriteError(c.Protocol)
 			return
 		}
-		log.Printf("Message sent successfully to %s", c.Name)
+		slog.Debug("Message sent successfully", "client", c.Name)
 	}
 
-	log.Printf("writePump ended for client %s (channel closed)", c.Name)
+	if c.closeCode != 0 {
+		closeMessage := websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+		c.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	}
+	slog.Debug("writePump ended (channel closed)", "client", c.Name)
 }
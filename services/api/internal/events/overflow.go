@@ -0,0 +1,142 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens to an event when a client's send queue is full
+type OverflowPolicy string
+
+const (
+	OverflowDisconnect OverflowPolicy = "disconnect"  // Close the connection (the client can resume it)
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // Drop the oldest queued event to make room
+	OverflowDropNewest OverflowPolicy = "drop_newest" // Drop the event
+)
+
+// ParseOverflowPolicy parses "disconnect", "drop_oldest" or "drop_newest"
+func ParseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case OverflowDisconnect, OverflowDropOldest, OverflowDropNewest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q (expected disconnect, drop_oldest or drop_newest)", value)
+	}
+}
+
+// OverflowPolicies configures how slow clients are handled
+type OverflowPolicies struct {
+	Default      OverflowPolicy               `json:"default"`
+	ByType       map[EventType]OverflowPolicy `json:"byType,omitempty"`
+	MaxOverflows int                          `json:"maxOverflows"` // Dropped events tolerated per connection before it is closed anyway; 0 never closes
+}
+
+// ParseOverflowPolicies parses "event_type=policy" pairs separated by commas
+func ParseOverflowPolicies(value string) (map[EventType]OverflowPolicy, error) {
+	policies := make(map[EventType]OverflowPolicy)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eventType, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid overflow policy %q: expected <event type>=<policy>", entry)
+		}
+		policy, err := ParseOverflowPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		policies[EventType(strings.TrimSpace(eventType))] = policy
+	}
+	return policies, nil
+}
+
+// For returns the policy applied to an event type
+func (p *OverflowPolicies) For(eventType EventType) OverflowPolicy {
+	if policy, ok := p.ByType[eventType]; ok {
+		return policy
+	}
+	if p.Default == "" {
+		return OverflowDisconnect
+	}
+	return p.Default
+}
+
+// OverflowStats reports events that didn't fit in clients' send queues
+type OverflowStats struct {
+	Policies      OverflowPolicies `json:"policies"`
+	DroppedOldest int64            `json:"droppedOldest"`
+	DroppedNewest int64            `json:"droppedNewest"`
+	Disconnected  int64            `json:"disconnected"` // Connections closed for a full send queue
+}
+
+// overflowState holds the policies and the manager-wide overflow metrics
+type overflowState struct {
+	mu       sync.RWMutex
+	policies OverflowPolicies
+
+	droppedOldest atomic.Int64
+	droppedNewest atomic.Int64
+	disconnected  atomic.Int64
+}
+
+// SetOverflowPolicies sets how events that don't fit in a client's send queue are handled
+func (m *Manager) SetOverflowPolicies(policies OverflowPolicies) {
+	m.overflow.mu.Lock()
+	m.overflow.policies = policies
+	m.overflow.mu.Unlock()
+}
+
+// OverflowStats returns overflow metrics
+func (m *Manager) OverflowStats() OverflowStats {
+	m.overflow.mu.RLock()
+	policies := m.overflow.policies
+	m.overflow.mu.RUnlock()
+
+	return OverflowStats{
+		Policies:      policies,
+		DroppedOldest: m.overflow.droppedOldest.Load(),
+		DroppedNewest: m.overflow.droppedNewest.Load(),
+		Disconnected:  m.overflow.disconnected.Load(),
+	}
+}
+
+// handleOverflow applies the policy for an event that didn't fit in the client's send queue
+// and reports false when the client must be disconnected (caller holds c.sendMu)
+func (m *Manager) handleOverflow(c *Client, data []byte, eventType EventType) bool {
+	m.overflow.mu.RLock()
+	policy := m.overflow.policies.For(eventType)
+	maxOverflows := m.overflow.policies.MaxOverflows
+	m.overflow.mu.RUnlock()
+
+	switch policy {
+	case OverflowDropOldest:
+		select {
+		case <-c.send:
+		default:
+		}
+		select {
+		case c.send <- data:
+		default:
+		}
+		m.overflow.droppedOldest.Add(1)
+	case OverflowDropNewest:
+		m.overflow.droppedNewest.Add(1)
+	default:
+		m.overflow.disconnected.Add(1)
+		log.Printf("🐢 Disconnecting slow client %s (%s): send queue full for a %s event", c.Name, c.ID, eventType)
+		return false
+	}
+
+	dropped := c.dropped.Add(1)
+	if maxOverflows > 0 && dropped >= int64(maxOverflows) {
+		m.overflow.disconnected.Add(1)
+		log.Printf("🐢 Disconnecting slow client %s (%s): %d events dropped from a full send queue", c.Name, c.ID, dropped)
+		return false
+	}
+	return true
+}
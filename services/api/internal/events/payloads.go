@@ -0,0 +1,287 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// Fields is an ad hoc payload, for events without a payload struct (such as onboarding steps)
+type Fields = map[string]interface{}
+
+// PayloadType lists the payloads an Event can carry. The JSON keys of the payload structs
+// are the wire format clients rely on; add new payload structs here and to payloadTypes.
+type PayloadType interface {
+	*ChatPayload | *UserPayload | *ClientUpgrade | *DeliveryPayload | *ReactionPayload |
+		*MessageUpdatedPayload | *MessageDeletedPayload | *MentionPayload | *AttachmentPayload |
+		*AttachmentUpdatedPayload | *ModerationPayload | *AnnouncementPayload | *AnnouncementWithdrawnPayload |
+		*TopicPayload | *SubscriptionPayload | *PresencePayload | *SessionPayload | *TypingPayload |
+		*FrameResultPayload | *FrameErrorPayload | *AuthExpiryPayload | Fields
+}
+
+// PayloadAs returns an event's payload as T, reporting false when it carries another type
+func PayloadAs[T PayloadType](event *Event) (T, bool) {
+	payload, ok := event.Payload.(T)
+	return payload, ok
+}
+
+// payloadTypes creates the payload struct of each built-in event type, for decoding events
+// relayed by other replicas. Other event types decode to their registered payload (see
+// registry.go) or Fields.
+var payloadTypes = map[EventType]func() interface{}{
+	EventTypeChat:               func() interface{} { return &ChatPayload{} },
+	EventTypeUserJoined:         func() interface{} { return &UserPayload{} },
+	EventTypeUserLeft:           func() interface{} { return &UserPayload{} },
+	EventTypeUpgrade:            func() interface{} { return &ClientUpgrade{} },
+	EventTypeDelivered:          func() interface{} { return &DeliveryPayload{} },
+	EventTypeFailed:             func() interface{} { return &DeliveryPayload{} },
+	EventTypePresence:           func() interface{} { return &PresencePayload{} },
+	EventTypeTopic:              func() interface{} { return &TopicPayload{} },
+	EventTypeSubscribed:         func() interface{} { return &SubscriptionPayload{} },
+	EventTypeUnsubscribed:       func() interface{} { return &SubscriptionPayload{} },
+	EventTypeSubscriptionDenied: func() interface{} { return &SubscriptionPayload{} },
+	EventTypeReactionAdded:      func() interface{} { return &ReactionPayload{} },
+	EventTypeReactionRemoved:    func() interface{} { return &ReactionPayload{} },
+	EventTypeMessageUpdated:     func() interface{} { return &MessageUpdatedPayload{} },
+	EventTypeMessageDeleted:     func() interface{} { return &MessageDeletedPayload{} },
+	EventTypeMention:            func() interface{} { return &MentionPayload{} },
+	EventTypeAttachmentAdded:    func() interface{} { return &AttachmentPayload{} },
+	EventTypeAttachmentUpdated:  func() interface{} { return &AttachmentUpdatedPayload{} },
+	EventTypeKicked:             func() interface{} { return &ModerationPayload{} },
+	EventTypeBanned:             func() interface{} { return &ModerationPayload{} },
+	EventTypeAnnouncement:       func() interface{} { return &AnnouncementPayload{} },
+	EventTypeAnnouncementEnded:  func() interface{} { return &AnnouncementWithdrawnPayload{} },
+	EventTypeSession:            func() interface{} { return &SessionPayload{} },
+	EventTypeTyping:             func() interface{} { return &TypingPayload{} },
+	EventTypeFrameResult:        func() interface{} { return &FrameResultPayload{} },
+	EventTypeFrameError:         func() interface{} { return &FrameErrorPayload{} },
+	EventTypePong:               func() interface{} { return &FrameResultPayload{} },
+	EventTypeReauthRequired:     func() interface{} { return &AuthExpiryPayload{} },
+	EventTypeAuthRefreshed:      func() interface{} { return &AuthExpiryPayload{} },
+}
+
+// decodePayload decodes an encoded payload into the payload struct of the event type
+func decodePayload(eventType EventType, data json.RawMessage) (interface{}, error) {
+	var payload interface{} = &Fields{}
+	if newPayload, ok := payloadTypes[eventType]; ok {
+		payload = newPayload()
+	} else if def := definition(eventType); def != nil && def.NewPayload != nil {
+		payload = def.NewPayload()
+	}
+	if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, payload); err != nil {
+			return nil, err
+		}
+	}
+	if fields, ok := payload.(*Fields); ok {
+		return *fields, nil
+	}
+	return payload, nil
+}
+
+// Conversation places a message event in a room and thread; both are omitted for direct
+// messages outside threads
+type Conversation struct {
+	RoomID          string `json:"room_id,omitempty"`
+	ParentMessageID string `json:"parent_message_id,omitempty"` // The message is a reply in this thread
+}
+
+func (c *Conversation) conversation() *Conversation { return c }
+
+// inConversation is implemented by payloads embedding Conversation
+type inConversation interface {
+	conversation() *Conversation
+}
+
+// actor is implemented by payloads reporting something a user did or that happened to them
+type actor interface {
+	actorID() string
+}
+
+// ChatPayload delivers a chat message. The versioned message body is relayed as-is
+// (including fields this server does not understand); Content carries the plain text for
+// clients that predate versioned messages.
+type ChatPayload struct {
+	From    string                 `json:"from"`
+	Name    string                 `json:"name"`
+	Email   string                 `json:"email"`
+	Content string                 `json:"content"`
+	Message *models.MessageContent `json:"message"`
+	Conversation
+}
+
+func (p *ChatPayload) actorID() string { return p.From }
+
+// UserPayload reports a user joining or leaving
+type UserPayload struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Conversation
+}
+
+func (p *UserPayload) actorID() string { return p.UserID }
+
+// DeliveryPayload reports whether a sent message was acknowledged by its recipient
+type DeliveryPayload struct {
+	MessageID string `json:"messageId"`
+	To        string `json:"to"`
+	Attempts  int    `json:"attempts,omitempty"` // Set when delivery failed
+}
+
+// ReactionPayload reports an emoji reaction added or removed; Count is the emoji's new total
+type ReactionPayload struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	UserID    string `json:"user_id"`
+	Name      string `json:"name"`
+	Count     int    `json:"count"`
+	Conversation
+}
+
+func (p *ReactionPayload) actorID() string { return p.UserID }
+
+// MessageUpdatedPayload carries the new content of an edited message
+type MessageUpdatedPayload struct {
+	MessageID string                 `json:"message_id"`
+	UserID    string                 `json:"user_id"`
+	Name      string                 `json:"name"`
+	Content   string                 `json:"content"`
+	Message   *models.MessageContent `json:"message"`
+	EditedAt  time.Time              `json:"edited_at"`
+	Conversation
+}
+
+func (p *MessageUpdatedPayload) actorID() string { return p.UserID }
+
+// MessageDeletedPayload reports a deleted message
+type MessageDeletedPayload struct {
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Name      string `json:"name"`
+	Conversation
+}
+
+func (p *MessageDeletedPayload) actorID() string { return p.UserID }
+
+// MentionPayload tells a user they were mentioned in a message
+type MentionPayload struct {
+	MessageID string                 `json:"message_id"`
+	From      string                 `json:"from"`
+	Name      string                 `json:"name"`
+	Content   string                 `json:"content"`
+	Message   *models.MessageContent `json:"message"`
+	Conversation
+}
+
+func (p *MentionPayload) actorID() string { return p.From }
+
+// AttachmentPayload reports a file attached to a message
+type AttachmentPayload struct {
+	MessageID    string `json:"message_id"`
+	UserID       string `json:"user_id"`
+	Name         string `json:"name"`
+	AttachmentID string `json:"attachment_id"`
+	FileName     string `json:"file_name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Conversation
+}
+
+func (p *AttachmentPayload) actorID() string { return p.UserID }
+
+// AttachmentUpdatedPayload carries the thumbnails generated for an image attachment
+type AttachmentUpdatedPayload struct {
+	MessageID    string      `json:"message_id"`
+	AttachmentID string      `json:"attachment_id"`
+	Thumbnails   interface{} `json:"thumbnails"`
+	Conversation
+}
+
+// ModerationPayload tells a user an admin kicked or banned them; ExpiresAt is set for bans
+type ModerationPayload struct {
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AnnouncementPayload delivers an admin announcement; RoomID is set for announcements to a
+// room's members
+type AnnouncementPayload struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	Level     string    `json:"level"`
+	StartsAt  time.Time `json:"starts_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RoomID    string    `json:"room_id,omitempty"`
+}
+
+// AnnouncementWithdrawnPayload names a cancelled announcement
+type AnnouncementWithdrawnPayload struct {
+	ID string `json:"id"`
+}
+
+// TopicPayload carries an application event published on a topic
+type TopicPayload struct {
+	Topic string      `json:"topic"`
+	From  string      `json:"from"`
+	Data  interface{} `json:"data"`
+}
+
+func (p *TopicPayload) actorID() string { return p.From }
+
+// SubscriptionPayload confirms or refuses a topic subscription; Reason is set on refusals
+type SubscriptionPayload struct {
+	Topic  string `json:"topic"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PresencePayload reports a user's new presence
+type PresencePayload struct {
+	UserID string         `json:"user_id"`
+	Status PresenceStatus `json:"status"`
+	Text   string         `json:"text"`
+	Idle   bool           `json:"idle"`
+}
+
+func (p *PresencePayload) actorID() string { return p.UserID }
+
+// SessionPayload tells a WebSocket client the token and sequence number to resume its
+// session with (see resume.go)
+type SessionPayload struct {
+	ResumeToken string `json:"resume_token"`
+	Seq         int64  `json:"seq"`
+	Resumed     bool   `json:"resumed"`
+}
+
+// TypingPayload reports a user typing in a direct conversation or, with RoomID, a room
+type TypingPayload struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Typing bool   `json:"typing"` // False once they stopped
+	Conversation
+}
+
+func (p *TypingPayload) actorID() string { return p.UserID }
+
+// FrameResultPayload answers an inbound frame (see frames.go). ID echoes the frame's ID so
+// clients can match replies to the frames they sent.
+type FrameResultPayload struct {
+	ID     string      `json:"id,omitempty"`
+	Type   string      `json:"type"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// FrameErrorPayload tells a client why an inbound frame was refused or failed
+type FrameErrorPayload struct {
+	ID     string `json:"id,omitempty"`
+	Type   string `json:"type"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// AuthExpiryPayload tells a client when the token of its connection expires; zero when it
+// never does
+type AuthExpiryPayload struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
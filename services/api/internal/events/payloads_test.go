@@ -0,0 +1,139 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// newerMessage returns a message body of the next schema version with a field this version
+// doesn't know
+func newerMessage(t *testing.T) *models.MessageContent {
+	t.Helper()
+	input := fmt.Sprintf(`{"schemaVersion":%d,"text":"hi","poll":{"question":"Lunch?","options":["Pizza","Sushi"]}}`, models.MessageSchemaVersion+1)
+	var content models.MessageContent
+	if err := json.Unmarshal([]byte(input), &content); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return &content
+}
+
+// assertPoll checks that a chat payload's message kept the poll of newerMessage
+func assertPoll(t *testing.T, payload json.RawMessage) {
+	t.Helper()
+	var chat struct {
+		Message struct {
+			SchemaVersion int             `json:"schemaVersion"`
+			Poll          json.RawMessage `json:"poll"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(payload, &chat); err != nil {
+		t.Fatalf("decoding the payload: %v", err)
+	}
+	if chat.Message.SchemaVersion != models.MessageSchemaVersion+1 {
+		t.Errorf("schemaVersion = %d, want %d", chat.Message.SchemaVersion, models.MessageSchemaVersion+1)
+	}
+	if got, want := string(chat.Message.Poll), `{"question":"Lunch?","options":["Pizza","Sushi"]}`; got != want {
+		t.Errorf("poll = %s, want %s", got, want)
+	}
+}
+
+func TestChatEventEncodingKeepsUnknownMessageFields(t *testing.T) {
+	event := NewChatEvent("u1", "Ada", "ada@example.com", newerMessage(t))
+
+	for _, version := range []ProtocolVersion{ProtocolV1, ProtocolV2} {
+		t.Run(string(version), func(t *testing.T) {
+			client := &Client{Protocol: version, Encoding: EncodingJSON, SchemaVersion: EventSchemaVersion}
+			data, err := client.encodeEvent(event)
+			if err != nil {
+				t.Fatalf("encodeEvent: %v", err)
+			}
+			var envelope struct {
+				Payload json.RawMessage `json:"payload"`
+			}
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatalf("decoding the envelope: %v", err)
+			}
+			assertPoll(t, envelope.Payload)
+		})
+	}
+
+	// Binary encodings carry the field names and strings verbatim
+	for _, encoding := range []Encoding{EncodingMsgpack, EncodingProto} {
+		t.Run(string(encoding), func(t *testing.T) {
+			client := &Client{Protocol: ProtocolV2, Encoding: encoding, SchemaVersion: EventSchemaVersion}
+			data, err := client.encodeEvent(event)
+			if err != nil {
+				t.Fatalf("encodeEvent: %v", err)
+			}
+			for _, want := range []string{"poll", "question", "Lunch?", "Sushi"} {
+				if !bytes.Contains(data, []byte(want)) {
+					t.Errorf("encoded event is missing %q", want)
+				}
+			}
+		})
+	}
+}
+
+// loopback is a Backplane handing published messages to the test
+type loopback struct {
+	messages chan []byte
+}
+
+func (b *loopback) Publish(ctx context.Context, key string, message []byte) error {
+	b.messages <- message
+	return nil
+}
+
+func (b *loopback) Subscribe(ctx context.Context, deliver func(message []byte)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (b *loopback) Close() error {
+	return nil
+}
+
+func TestBackplaneRelayKeepsUnknownMessageFields(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bp := &loopback{messages: make(chan []byte, 1)}
+	m := NewManager()
+	m.ConnectBackplane(ctx, bp, "replica-1")
+
+	m.publish(NewChatEvent("u1", "Ada", "ada@example.com", newerMessage(t)))
+	var message []byte
+	select {
+	case message = <-bp.messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was published")
+	}
+
+	// Decoded as the receiving replica does
+	var relayed backplaneMessage
+	if err := json.Unmarshal(message, &relayed); err != nil {
+		t.Fatalf("decoding the backplane message: %v", err)
+	}
+	payload, err := decodePayload(relayed.Type, relayed.Payload)
+	if err != nil {
+		t.Fatalf("decodePayload: %v", err)
+	}
+	chat, ok := payload.(*ChatPayload)
+	if !ok {
+		t.Fatalf("payload is a %T, want *ChatPayload", payload)
+	}
+	if _, ok := chat.Message.Extra["poll"]; !ok {
+		t.Errorf("Extra is missing poll: %v", chat.Message.Extra)
+	}
+
+	data, err := json.Marshal(chat)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	assertPoll(t, data)
+}
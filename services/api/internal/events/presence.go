@@ -0,0 +1,187 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PresenceStatus is a connected user's availability
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceBusy    PresenceStatus = "busy"
+	PresenceOffline PresenceStatus = "offline" // Reported for users who aren't connected
+)
+
+// ErrNotConnected is returned when setting the presence of a user without a live connection
+var ErrNotConnected = errors.New("user is not connected")
+
+// Presence is a user's current availability. Status is what other users see: a user who
+// chose "online" shows as "away" while idle.
+type Presence struct {
+	UserID       string         `json:"userId"`
+	Status       PresenceStatus `json:"status"`
+	Text         string         `json:"text,omitempty"` // Custom status text, e.g. "In a meeting"
+	Idle         bool           `json:"idle"`
+	LastActiveAt time.Time      `json:"lastActiveAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+}
+
+// presenceState is the presence kept for a connected user
+type presenceState struct {
+	chosen       PresenceStatus // Status set by the user (online by default)
+	text         string
+	idle         bool
+	lastActiveAt time.Time
+	updatedAt    time.Time
+}
+
+// effective returns the status shown to other users
+func (p *presenceState) effective() PresenceStatus {
+	if p.idle && p.chosen == PresenceOnline {
+		return PresenceAway
+	}
+	return p.chosen
+}
+
+// snapshot returns the presence as reported to clients
+func (p *presenceState) snapshot(userID string) Presence {
+	return Presence{
+		UserID:       userID,
+		Status:       p.effective(),
+		Text:         p.text,
+		Idle:         p.idle,
+		LastActiveAt: p.lastActiveAt,
+		UpdatedAt:    p.updatedAt,
+	}
+}
+
+// NewPresenceChangedEvent tells clients that a user's presence changed
+func NewPresenceChangedEvent(presence Presence) *Event {
+	return NewEvent(EventTypePresence, &PresencePayload{
+		UserID: presence.UserID,
+		Status: presence.Status,
+		Text:   presence.Text,
+		Idle:   presence.Idle,
+	})
+}
+
+// trackPresence starts a connected user's presence as online
+func (m *Manager) trackPresence(userID string) {
+	now := time.Now().UTC()
+
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+	m.presence[userID] = &presenceState{chosen: PresenceOnline, lastActiveAt: now, updatedAt: now}
+}
+
+// forgetPresence drops a disconnected user's presence
+func (m *Manager) forgetPresence(userID string) {
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+	delete(m.presence, userID)
+}
+
+// GetPresence returns a user's presence, reporting users who aren't connected as offline
+func (m *Manager) GetPresence(userID string) Presence {
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+
+	state, ok := m.presence[userID]
+	if !ok {
+		return Presence{UserID: userID, Status: PresenceOffline}
+	}
+	return state.snapshot(userID)
+}
+
+// SetPresence sets the status and custom text chosen by a connected user, which also counts
+// as activity. Other users get a presence_changed event when what they see changes.
+func (m *Manager) SetPresence(userID string, status PresenceStatus, text string) (Presence, error) {
+	now := time.Now().UTC()
+
+	m.presenceMu.Lock()
+	state, ok := m.presence[userID]
+	if !ok {
+		m.presenceMu.Unlock()
+		return Presence{}, ErrNotConnected
+	}
+	before, beforeText, beforeIdle := state.effective(), state.text, state.idle
+	state.chosen = status
+	state.text = text
+	state.idle = false
+	state.lastActiveAt = now
+	changed := state.effective() != before || state.text != beforeText || beforeIdle
+	if changed {
+		state.updatedAt = now
+	}
+	presence := state.snapshot(userID)
+	m.presenceMu.Unlock()
+
+	if changed {
+		m.BroadcastEvent(NewPresenceChangedEvent(presence))
+	}
+	return presence, nil
+}
+
+// MarkActive records activity by a connected user, bringing them back from idle
+func (m *Manager) MarkActive(userID string) {
+	now := time.Now().UTC()
+
+	m.presenceMu.Lock()
+	state, ok := m.presence[userID]
+	if !ok {
+		m.presenceMu.Unlock()
+		return
+	}
+	state.lastActiveAt = now
+	wasIdle := state.idle
+	state.idle = false
+	if wasIdle {
+		state.updatedAt = now
+	}
+	presence := state.snapshot(userID)
+	m.presenceMu.Unlock()
+
+	if wasIdle {
+		m.BroadcastEvent(NewPresenceChangedEvent(presence))
+	}
+}
+
+// RunIdleDetection marks users idle once they've been inactive for idleTimeout, until ctx
+// is cancelled. Idle users who chose "online" are shown as away.
+func (m *Manager) RunIdleDetection(ctx context.Context, idleTimeout time.Duration) {
+	ticker := time.NewTicker(min(idleTimeout/4, 15*time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.markIdle(now.UTC(), idleTimeout)
+		}
+	}
+}
+
+// markIdle flags users inactive since before now-idleTimeout and announces the transitions
+func (m *Manager) markIdle(now time.Time, idleTimeout time.Duration) {
+	var changed []Presence
+
+	m.presenceMu.Lock()
+	for userID, state := range m.presence {
+		if state.idle || now.Sub(state.lastActiveAt) < idleTimeout {
+			continue
+		}
+		state.idle = true
+		state.updatedAt = now
+		changed = append(changed, state.snapshot(userID))
+	}
+	m.presenceMu.Unlock()
+
+	for _, presence := range changed {
+		m.BroadcastEvent(NewPresenceChangedEvent(presence))
+	}
+}
@@ -0,0 +1,264 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProtocolVersion identifies the wire format of events sent to a client
+type ProtocolVersion string
+
+const (
+	// ProtocolV1 is the original envelope: {"type": ..., "payload": ...}
+	ProtocolV1 ProtocolVersion = "v1"
+	// ProtocolV2 adds version, id, timestamp and payload schema version:
+	// {"v": 2, "id": ..., "type": ..., "timestamp": ..., "schema": ..., "payload": ...}
+	ProtocolV2 ProtocolVersion = "v2"
+)
+
+// ParseProtocolVersion parses "v1"/"v2" or the "events.v1"/"events.v2" subprotocol names
+func ParseProtocolVersion(value string) (ProtocolVersion, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "events.") {
+	case "v1":
+		return ProtocolV1, nil
+	case "v2":
+		return ProtocolV2, nil
+	default:
+		return "", fmt.Errorf("unknown event protocol version %q", value)
+	}
+}
+
+// envelopeV2 is the v2 wire format of an event
+type envelopeV2 struct {
+	Version   int         `json:"v"`
+	ID        string      `json:"id"`
+	Type      EventType   `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Schema    int         `json:"schema"`
+	Payload   interface{} `json:"payload"`
+}
+
+// Encode marshals the event in the wire format of the given protocol version
+func (e *Event) Encode(version ProtocolVersion) ([]byte, error) {
+	if version == ProtocolV2 {
+		return json.Marshal(envelopeV2{
+			Version:   2,
+			ID:        e.ID,
+			Type:      e.Type,
+			Timestamp: e.Timestamp,
+			Schema:    e.schemaVersion(),
+			Payload:   e.Payload,
+		})
+	}
+	return json.Marshal(e)
+}
+
+// encodedEvent caches an event's encodings so fan-out marshals it once per wire format and
+// schema version in use
+type encodedEvent struct {
+	event *Event
+	def   *TypeDefinition // Registration of an application event type (see registry.go)
+	mu    sync.Mutex
+	data  map[wireFormat][]byte // Nil entries record failed encodings
+}
+
+func newEncodedEvent(event *Event) *encodedEvent {
+	return &encodedEvent{event: event, def: definition(event.Type), data: make(map[wireFormat][]byte, 2)}
+}
+
+// encode returns the event encoded for a client's wire format, counting failures once
+// against ps
+func (e *encodedEvent) encode(c *Client, ps *ProtocolSwitch) ([]byte, bool) {
+	format := wireFormat{version: c.Protocol, encoding: c.Encoding, schema: c.SchemaVersion}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if data, ok := e.data[format]; ok {
+		return data, data != nil
+	}
+	data, err := c.encodeEvent(e.event)
+	if err != nil {
+		log.Printf("Failed to marshal event: %v", err)
+		ps.recordEncodeError(format.version)
+		data = nil
+	}
+	e.data[format] = data
+	return data, data != nil
+}
+
+// protocolCounters holds live metrics for one protocol version
+type protocolCounters struct {
+	active         atomic.Int64
+	total          atomic.Int64
+	writeErrors    atomic.Int64
+	abnormalCloses atomic.Int64
+	encodeErrors   atomic.Int64
+}
+
+// ProtocolStats is a snapshot of the metrics for one protocol version
+type ProtocolStats struct {
+	ActiveConnections int64   `json:"activeConnections"`
+	TotalConnections  int64   `json:"totalConnections"`
+	WriteErrors       int64   `json:"writeErrors"`
+	AbnormalCloses    int64   `json:"abnormalCloses"`
+	EncodeErrors      int64   `json:"encodeErrors"`
+	ErrorRate         float64 `json:"errorRate"` // Errors per connection since startup
+}
+
+// ProtocolSwitch controls which protocol version new connections negotiate by default.
+// It supports flipping the default at runtime (blue/green) and rolling back to the previous version.
+type ProtocolSwitch struct {
+	current   ProtocolVersion
+	previous  ProtocolVersion
+	v2Enabled bool // Feature flag: v2 may be negotiated at all
+	changedAt time.Time
+	counters  map[ProtocolVersion]*protocolCounters
+	mu        sync.RWMutex
+}
+
+// NewProtocolSwitch creates a protocol switch with the given default version
+func NewProtocolSwitch(defaultVersion ProtocolVersion, v2Enabled bool) (*ProtocolSwitch, error) {
+	if defaultVersion == ProtocolV2 && !v2Enabled {
+		return nil, fmt.Errorf("event protocol v2 cannot be the default while it is disabled")
+	}
+	return &ProtocolSwitch{
+		current:   defaultVersion,
+		previous:  defaultVersion,
+		v2Enabled: v2Enabled,
+		changedAt: time.Now().UTC(),
+		counters: map[ProtocolVersion]*protocolCounters{
+			ProtocolV1: {},
+			ProtocolV2: {},
+		},
+	}, nil
+}
+
+// Default returns the version negotiated by clients that don't request one
+func (ps *ProtocolSwitch) Default() ProtocolVersion {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.current
+}
+
+// SetDefault flips the default version for new connections, remembering the previous one for rollback
+func (ps *ProtocolSwitch) SetDefault(version ProtocolVersion) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if version == ProtocolV2 && !ps.v2Enabled {
+		return fmt.Errorf("event protocol v2 is disabled")
+	}
+	if version == ps.current {
+		return nil
+	}
+
+	log.Printf("🔀 Default event protocol switched: %s -> %s", ps.current, version)
+	ps.previous = ps.current
+	ps.current = version
+	ps.changedAt = time.Now().UTC()
+	return nil
+}
+
+// Rollback restores the previous default version and returns it
+func (ps *ProtocolSwitch) Rollback() ProtocolVersion {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.previous != ps.current {
+		log.Printf("⏪ Default event protocol rolled back: %s -> %s", ps.current, ps.previous)
+		ps.current, ps.previous = ps.previous, ps.current
+		ps.changedAt = time.Now().UTC()
+	}
+	return ps.current
+}
+
+// Negotiate resolves the version requested by a client ("" selects the current default)
+func (ps *ProtocolSwitch) Negotiate(requested string) (ProtocolVersion, error) {
+	if requested == "" {
+		return ps.Default(), nil
+	}
+
+	version, err := ParseProtocolVersion(requested)
+	if err != nil {
+		return "", err
+	}
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	if version == ProtocolV2 && !ps.v2Enabled {
+		return "", fmt.Errorf("event protocol v2 is disabled")
+	}
+	return version, nil
+}
+
+// ProtocolStatus describes the switch state and live metrics
+type ProtocolStatus struct {
+	Default   ProtocolVersion                   `json:"default"`
+	Previous  ProtocolVersion                   `json:"previous"`
+	V2Enabled bool                              `json:"v2Enabled"`
+	ChangedAt time.Time                         `json:"changedAt"`
+	Versions  map[ProtocolVersion]ProtocolStats `json:"versions"`
+}
+
+// Status returns the current switch state and per-version metrics
+func (ps *ProtocolSwitch) Status() ProtocolStatus {
+	ps.mu.RLock()
+	status := ProtocolStatus{
+		Default:   ps.current,
+		Previous:  ps.previous,
+		V2Enabled: ps.v2Enabled,
+		ChangedAt: ps.changedAt,
+		Versions:  make(map[ProtocolVersion]ProtocolStats, len(ps.counters)),
+	}
+	ps.mu.RUnlock()
+
+	for version, c := range ps.counters {
+		stats := ProtocolStats{
+			ActiveConnections: c.active.Load(),
+			TotalConnections:  c.total.Load(),
+			WriteErrors:       c.writeErrors.Load(),
+			AbnormalCloses:    c.abnormalCloses.Load(),
+			EncodeErrors:      c.encodeErrors.Load(),
+		}
+		if stats.TotalConnections > 0 {
+			errors := stats.WriteErrors + stats.AbnormalCloses + stats.EncodeErrors
+			stats.ErrorRate = float64(errors) / float64(stats.TotalConnections)
+		}
+		status.Versions[version] = stats
+	}
+	return status
+}
+
+// counter returns the metrics for a version (v1 for unknown versions)
+func (ps *ProtocolSwitch) counter(version ProtocolVersion) *protocolCounters {
+	if c, ok := ps.counters[version]; ok {
+		return c
+	}
+	return ps.counters[ProtocolV1]
+}
+
+func (ps *ProtocolSwitch) recordConnect(version ProtocolVersion) {
+	c := ps.counter(version)
+	c.active.Add(1)
+	c.total.Add(1)
+}
+
+func (ps *ProtocolSwitch) recordDisconnect(version ProtocolVersion) {
+	ps.counter(version).active.Add(-1)
+}
+
+func (ps *ProtocolSwitch) recordWriteError(version ProtocolVersion) {
+	ps.counter(version).writeErrors.Add(1)
+}
+
+func (ps *ProtocolSwitch) recordAbnormalClose(version ProtocolVersion) {
+	ps.counter(version).abnormalCloses.Add(1)
+}
+
+func (ps *ProtocolSwitch) recordEncodeError(version ProtocolVersion) {
+	ps.counter(version).encodeErrors.Add(1)
+}
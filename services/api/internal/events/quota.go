@@ -0,0 +1,148 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseQuotaExceeded is the close code sent to clients closed for repeated quota violations
+const CloseQuotaExceeded = websocket.ClosePolicyViolation
+
+// hardFrameLimitFactor sizes the absolute read limit relative to InboundLimits.MaxFrameBytes.
+// Frames between the two limits are discarded and counted as violations; larger frames
+// close the connection immediately (close code 1009).
+const hardFrameLimitFactor = 16
+
+// Violation kinds
+const (
+	ViolationFrameTooLarge = "frame_too_large"
+	ViolationRateExceeded  = "rate_exceeded"
+)
+
+// InboundLimits bounds what a single client may send over its WebSocket
+type InboundLimits struct {
+	MaxFrameBytes     int64   `json:"maxFrameBytes"`     // Largest accepted frame; 0 disables the check
+	MessagesPerSecond float64 `json:"messagesPerSecond"` // Sustained inbound message rate; 0 disables rate limiting
+	Burst             int     `json:"burst"`             // Messages allowed in a burst above the sustained rate
+	MaxViolations     int     `json:"maxViolations"`     // Violations tolerated before the connection is closed; 0 never closes
+}
+
+// DefaultInboundLimits returns the limits used when none are configured
+func DefaultInboundLimits() InboundLimits {
+	return InboundLimits{
+		MaxFrameBytes:     64 << 10,
+		MessagesPerSecond: 20,
+		Burst:             40,
+		MaxViolations:     10,
+	}
+}
+
+// Violation describes a client exceeding its inbound limits
+type Violation struct {
+	Kind       string // ViolationFrameTooLarge or ViolationRateExceeded
+	ClientID   string
+	ClientName string
+	TenantID   string
+	RemoteAddr string // Client address of the connection
+	Count      int    // Violations by this connection so far
+	Closed     bool   // The connection is being closed as a result
+}
+
+// QuotaStats reports inbound quota enforcement across all connections
+type QuotaStats struct {
+	Limits            InboundLimits `json:"limits"`
+	FramesTooLarge    int64         `json:"framesTooLarge"`
+	RateExceeded      int64         `json:"rateExceeded"`
+	ConnectionsClosed int64         `json:"connectionsClosed"`
+}
+
+// quotaCounters are the manager-wide violation metrics
+type quotaCounters struct {
+	framesTooLarge    atomic.Int64
+	rateExceeded      atomic.Int64
+	connectionsClosed atomic.Int64
+}
+
+// SetInboundLimits sets the per-connection inbound limits for new connections
+func (m *Manager) SetInboundLimits(limits InboundLimits) {
+	m.quotaMu.Lock()
+	m.limits = limits
+	m.quotaMu.Unlock()
+}
+
+// SetViolationHandler registers a function called for every quota violation (e.g. to audit it)
+func (m *Manager) SetViolationHandler(handler func(Violation)) {
+	m.quotaMu.Lock()
+	m.onViolation = handler
+	m.quotaMu.Unlock()
+}
+
+// QuotaStats returns inbound quota metrics
+func (m *Manager) QuotaStats() QuotaStats {
+	return QuotaStats{
+		Limits:            m.inboundLimits(),
+		FramesTooLarge:    m.quotas.framesTooLarge.Load(),
+		RateExceeded:      m.quotas.rateExceeded.Load(),
+		ConnectionsClosed: m.quotas.connectionsClosed.Load(),
+	}
+}
+
+func (m *Manager) inboundLimits() InboundLimits {
+	m.quotaMu.Lock()
+	defer m.quotaMu.Unlock()
+	return m.limits
+}
+
+// recordViolation updates metrics and notifies the violation handler
+func (m *Manager) recordViolation(v Violation) {
+	switch v.Kind {
+	case ViolationFrameTooLarge:
+		m.quotas.framesTooLarge.Add(1)
+	case ViolationRateExceeded:
+		m.quotas.rateExceeded.Add(1)
+	}
+	if v.Closed {
+		m.quotas.connectionsClosed.Add(1)
+	}
+
+	m.quotaMu.Lock()
+	handler := m.onViolation
+	m.quotaMu.Unlock()
+	if handler != nil {
+		handler(v)
+	}
+}
+
+// tokenBucket is a simple rate limiter for a single connection's reader
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token, reporting false when the bucket is empty
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
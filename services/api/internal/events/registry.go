@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"api-service/internal/models"
+)
+
+var (
+	// ErrUnknownEventType is returned when publishing an event of a type that wasn't registered
+	ErrUnknownEventType = errors.New("event type is not registered")
+	// ErrInvalidEvent is returned when publishing an event its type's Validate rule rejects
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
+// TypeDefinition describes an application event type (an order update, job progress...)
+// defined outside this package. Only Type is required.
+type TypeDefinition struct {
+	Type EventType
+
+	// NewPayload creates an empty payload to decode events relayed by other replicas into;
+	// without it they decode to Fields
+	NewPayload func() interface{}
+
+	// Validate rejects malformed payloads before they're published
+	Validate func(payload interface{}) error
+
+	// Authorize reports whether a user may receive an event; without it, every client the
+	// event is addressed to receives it
+	Authorize func(recipient *models.User, event *Event) bool
+
+	// Persist stores a published event before it's delivered; a failure aborts the publish
+	Persist func(ctx context.Context, event *Event) error
+}
+
+// ApplicationPayload is the payload of a registered application event type
+type ApplicationPayload interface {
+	EventType() EventType
+}
+
+// typeRegistry holds the registered application event types
+var typeRegistry = struct {
+	mu    sync.RWMutex
+	types map[EventType]*TypeDefinition
+}{types: make(map[EventType]*TypeDefinition)}
+
+// RegisterType defines an application event type. Built-in types and types that are already
+// registered can't be registered (again).
+func RegisterType(def TypeDefinition) error {
+	if def.Type == "" {
+		return fmt.Errorf("event type is required")
+	}
+	if _, builtin := payloadTypes[def.Type]; builtin || def.Type == EventTypeSystem {
+		return fmt.Errorf("event type %q is built in", def.Type)
+	}
+
+	typeRegistry.mu.Lock()
+	defer typeRegistry.mu.Unlock()
+	if _, exists := typeRegistry.types[def.Type]; exists {
+		return fmt.Errorf("event type %q is already registered", def.Type)
+	}
+	typeRegistry.types[def.Type] = &def
+	return nil
+}
+
+// MustRegisterType is RegisterType for package initialization; it panics on error
+func MustRegisterType(def TypeDefinition) {
+	if err := RegisterType(def); err != nil {
+		panic(err)
+	}
+}
+
+// RegisteredTypes returns the registered application event types in order
+func RegisteredTypes() []EventType {
+	typeRegistry.mu.RLock()
+	defer typeRegistry.mu.RUnlock()
+
+	types := make([]EventType, 0, len(typeRegistry.types))
+	for eventType := range typeRegistry.types {
+		types = append(types, eventType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// definition returns the registration of an application event type, or nil
+func definition(eventType EventType) *TypeDefinition {
+	typeRegistry.mu.RLock()
+	defer typeRegistry.mu.RUnlock()
+	return typeRegistry.types[eventType]
+}
+
+// NewApplicationEvent creates an event of a registered application type with a fresh ID and
+// timestamp
+func NewApplicationEvent(payload ApplicationPayload) *Event {
+	return &Event{
+		Type:      payload.EventType(),
+		Payload:   payload,
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// DecodeApplicationEvent creates an event of a registered application type from an encoded
+// payload (e.g. received from a backend job), with a fresh ID and timestamp. Publish it to
+// validate it.
+func DecodeApplicationEvent(eventType EventType, data json.RawMessage) (*Event, error) {
+	if definition(eventType) == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEventType, eventType)
+	}
+	payload, err := decodePayload(eventType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidEvent, eventType, err)
+	}
+	return &Event{
+		Type:      eventType,
+		Payload:   payload,
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+	}, nil
+}
+
+// Publish validates and persists an application event, then sends it to the given users or,
+// without any, broadcasts it. Recipients the type's Authorize rule excludes don't receive it.
+func (m *Manager) Publish(ctx context.Context, event *Event, userIDs ...string) error {
+	def := definition(event.Type)
+	if def == nil {
+		return fmt.Errorf("%w: %q", ErrUnknownEventType, event.Type)
+	}
+	if def.Validate != nil {
+		if err := def.Validate(event.Payload); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidEvent, event.Type, err)
+		}
+	}
+	if def.Persist != nil {
+		if err := def.Persist(ctx, event); err != nil {
+			return fmt.Errorf("failed to persist %s event: %w", event.Type, err)
+		}
+	}
+
+	if len(userIDs) == 0 {
+		m.BroadcastEvent(event)
+	} else {
+		m.SendEventToUsers(userIDs, event)
+	}
+	return nil
+}
+
+// authorized reports whether a client may receive an event under its type's Authorize rule
+func (e *encodedEvent) authorized(client *Client) bool {
+	return e.def == nil || e.def.Authorize == nil || e.def.Authorize(client.Identity(), e.event)
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayBuffer remembers the most recent events delivered to each user's stream so a client
+// that reconnects with the ID of the last event it received (SSE Last-Event-ID) gets the
+// ones it missed. A user's history is dropped once they've been gone for the TTL.
+type ReplayBuffer struct {
+	size  int
+	ttl   time.Duration
+	users map[string]*replayLog
+	mu    sync.Mutex
+}
+
+// replayLog is one user's recent events, oldest first
+type replayLog struct {
+	entries  []replayEntry
+	lastSeen time.Time
+}
+
+// replayEntry is an encoded event and its ID
+type replayEntry struct {
+	id   string
+	data []byte
+}
+
+// NewReplayBuffer creates a buffer keeping up to size events per user for ttl after their last event
+func NewReplayBuffer(size int, ttl time.Duration) *ReplayBuffer {
+	return &ReplayBuffer{
+		size:  size,
+		ttl:   ttl,
+		users: make(map[string]*replayLog),
+	}
+}
+
+// Record appends an event to a user's history
+func (b *ReplayBuffer) Record(userID, eventID string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+
+	history, ok := b.users[userID]
+	if !ok {
+		history = &replayLog{}
+		b.users[userID] = history
+	}
+	history.entries = append(history.entries, replayEntry{id: eventID, data: data})
+	if len(history.entries) > b.size {
+		history.entries = history.entries[len(history.entries)-b.size:]
+	}
+	history.lastSeen = time.Now()
+}
+
+// Since returns the user's events recorded after lastEventID. ok is false when the ID is no
+// longer (or was never) in the history, meaning events may have been lost.
+func (b *ReplayBuffer) Since(userID, lastEventID string) (missed [][]byte, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+
+	history, exists := b.users[userID]
+	if !exists {
+		return nil, false
+	}
+	for i, entry := range history.entries {
+		if entry.id == lastEventID {
+			for _, next := range history.entries[i+1:] {
+				missed = append(missed, next.data)
+			}
+			return missed, true
+		}
+	}
+	return nil, false
+}
+
+// expire drops the history of users idle for longer than the TTL (caller holds the lock)
+func (b *ReplayBuffer) expire() {
+	cutoff := time.Now().Add(-b.ttl)
+	for userID, history := range b.users {
+		if history.lastSeen.Before(cutoff) {
+			delete(b.users, userID)
+		}
+	}
+}
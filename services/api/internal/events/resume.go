@@ -0,0 +1,234 @@
+package events
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Errors returned when missed frames can't be returned
+var (
+	ErrNoSession     = errors.New("no WebSocket session on this replica")
+	ErrSeqAhead      = errors.New("sequence number is ahead of the session")
+	ErrEventsExpired = errors.New("missed events are no longer buffered")
+	ErrBinarySession = errors.New("session uses a binary event encoding")
+)
+
+// resumeSession is the resumable state of a WebSocket connection. Every frame sent on it is
+// stamped with the next sequence number ("seq") and kept in a ring, and when the connection
+// drops the session is parked: events keep being recorded until the client reconnects with
+// ?resume=<token>&seq=<last seq received>, and the frames it missed are replayed.
+type resumeSession struct {
+	token string
+
+	mu         sync.Mutex
+	owner      *Client   // Connection the session belongs to; frames enqueued by others are dropped
+	detachedAt time.Time // Set while parked
+	seq        int64
+	frames     []resumeFrame // Oldest first
+	size       int
+}
+
+// resumeFrame is a stamped frame and its sequence number
+type resumeFrame struct {
+	seq  int64
+	data []byte
+}
+
+// SetResumption lets WebSocket clients resume their session after reconnecting within ttl,
+// replaying up to size missed frames (call before Run). A size of 0 disables resumption.
+func (m *Manager) SetResumption(size int, ttl time.Duration) {
+	m.resumeSize = size
+	m.resumeTTL = ttl
+}
+
+// attachSession gives a newly registered WebSocket client a session, taking over the one it
+// asked to resume from the connection it replaces or from the parked ones. It returns the
+// frames the client missed, and resumed is false when a new session was started instead
+// (caller holds the client's shard lock).
+func (m *Manager) attachSession(shard *clientShard, client *Client, previous *Client) (missed [][]byte, resumed bool) {
+	if m.resumeSize <= 0 {
+		return nil, false
+	}
+	m.expireParked(shard)
+	parked := shard.parked[client.ID]
+	delete(shard.parked, client.ID)
+	if client.Conn == nil {
+		return nil, false // Other transports have their own replay
+	}
+
+	var from *Client
+	// Recorded frames are replayed as is, so the wire format can't change
+	for _, candidate := range []*Client{previous, parked} {
+		if candidate != nil && candidate.session != nil && client.ResumeToken != "" &&
+			candidate.Protocol == client.Protocol && candidate.Encoding == client.Encoding &&
+			candidate.SchemaVersion == client.SchemaVersion &&
+			subtle.ConstantTimeCompare([]byte(candidate.session.token), []byte(client.ResumeToken)) == 1 {
+			from = candidate
+			break
+		}
+	}
+	if from != nil {
+		session := from.session
+		session.mu.Lock()
+		var err error
+		missed, err = session.since(client.ResumeSeq)
+		// The replay has to fit the fresh send channel ahead of the welcome event
+		if err == nil && len(missed) < cap(client.send)-1 {
+			session.owner = client
+			session.detachedAt = time.Time{}
+			client.session = session
+			resumed = true
+		} else {
+			missed = nil
+		}
+		session.mu.Unlock()
+	}
+	if !resumed {
+		client.session = &resumeSession{token: newEventID(), owner: client, size: m.resumeSize}
+		return nil, false
+	}
+
+	// The session's topic subscriptions and block list carry over to the new connection
+	from.topicsMu.Lock()
+	client.topics = from.topics
+	from.topicsMu.Unlock()
+	from.withheldMu.Lock()
+	client.withheld = from.withheld
+	from.withheldMu.Unlock()
+	return missed, true
+}
+
+// parkSession keeps an unregistered client's session until it is resumed or expires, and
+// reports whether it did. Clients closed on purpose (kicked, banned, over quota) aren't parked,
+// but clients whose token expired are, since they reconnect with a fresh one (caller holds the
+// client's shard lock).
+func (m *Manager) parkSession(shard *clientShard, client *Client) bool {
+	if client.session == nil || (client.closeCode != 0 && client.closeCode != CloseTokenExpired) {
+		return false
+	}
+	m.expireParked(shard)
+	session := client.session
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.owner != client {
+		return false
+	}
+	session.detachedAt = time.Now()
+	shard.parked[client.ID] = client
+	return true
+}
+
+// expireParked drops a shard's sessions parked for longer than the TTL (caller holds the
+// shard lock)
+func (m *Manager) expireParked(shard *clientShard) {
+	cutoff := time.Now().Add(-m.resumeTTL)
+	for userID, client := range shard.parked {
+		client.session.mu.Lock()
+		expired := client.session.detachedAt.Before(cutoff)
+		client.session.mu.Unlock()
+		if expired {
+			delete(shard.parked, userID)
+		}
+	}
+}
+
+// retireSession stops frames being queued for a client whose send channel is about to be
+// closed, unless its session was taken over
+func (c *Client) retireSession() {
+	if c.session == nil {
+		return
+	}
+	c.session.mu.Lock()
+	if c.session.owner == c {
+		c.session.owner = nil
+	}
+	c.session.mu.Unlock()
+}
+
+// newSessionEvent tells a client the token and sequence number to resume its session with,
+// and whether its previous session was resumed
+func (c *Client) newSessionEvent(resumed bool) *Event {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	return NewEvent(EventTypeSession, &SessionPayload{
+		ResumeToken: c.session.token,
+		Seq:         c.session.seq,
+		Resumed:     resumed,
+	})
+}
+
+// enqueue queues an encoded frame for the client without blocking, reporting false when it
+// wasn't queued and the client has to be disconnected (see trySend). Frames of a resumable
+// session are stamped and recorded first, so one dropped by the overflow policy shows up as
+// a gap in the sequence; a parked session only records them.
+func (c *Client) enqueue(data []byte, eventType EventType) bool {
+	session := c.session
+	if session == nil {
+		return c.trySend(data, eventType)
+	}
+
+	// Held while sending, so frames are queued in sequence order
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.owner != c {
+		return false // Taken over by a resumed connection
+	}
+	data = session.record(data, c.Encoding)
+	if !session.detachedAt.IsZero() {
+		return true
+	}
+	return c.trySend(data, eventType)
+}
+
+// record stamps a frame with the next sequence number and keeps it (caller holds s.mu)
+func (s *resumeSession) record(data []byte, encoding Encoding) []byte {
+	s.seq++
+	data = stampSeq(data, s.seq, encoding)
+	s.frames = append(s.frames, resumeFrame{seq: s.seq, data: data})
+	if len(s.frames) > s.size {
+		s.frames = s.frames[len(s.frames)-s.size:]
+	}
+	return data
+}
+
+// EventsSince returns the frames of the user's WebSocket session on this replica after seq,
+// connected or parked, and the session's last sequence number, so a client that noticed a
+// gap in the sequence can backfill it
+func (m *Manager) EventsSince(userID string, seq int64) ([][]byte, int64, error) {
+	client, _, ok := m.lookup(userID)
+	if !ok || client.session == nil {
+		return nil, 0, ErrNoSession
+	}
+	if client.Encoding.Binary() {
+		return nil, 0, ErrBinarySession // Replayed by resuming instead
+	}
+
+	session := client.session
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	missed, err := session.since(seq)
+	return missed, session.seq, err
+}
+
+// since returns the frames after seq, failing when some of them are no longer kept or seq
+// is ahead of the session (caller holds s.mu)
+func (s *resumeSession) since(seq int64) ([][]byte, error) {
+	if seq < 0 || seq > s.seq {
+		return nil, ErrSeqAhead
+	}
+	if seq == s.seq {
+		return nil, nil
+	}
+	if len(s.frames) == 0 || s.frames[0].seq > seq+1 {
+		return nil, ErrEventsExpired
+	}
+	var missed [][]byte
+	for _, frame := range s.frames {
+		if frame.seq > seq {
+			missed = append(missed, frame.data)
+		}
+	}
+	return missed, nil
+}
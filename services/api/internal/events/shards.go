@@ -0,0 +1,66 @@
+package events
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// clientShards is the number of independently locked parts of the client map. Registering a
+// client locks only its user's shard, and a broadcast read-locks one shard at a time.
+const clientShards = 32
+
+// clientShard holds the clients, and parked sessions, of the users hashing to it
+type clientShard struct {
+	mu      sync.RWMutex
+	clients map[string]*Client // User ID -> Client
+	parked  map[string]*Client // User ID -> disconnected client whose session can be resumed (see resume.go)
+}
+
+// newClientShards creates empty shards
+func newClientShards() []*clientShard {
+	shards := make([]*clientShard, clientShards)
+	for i := range shards {
+		shards[i] = &clientShard{
+			clients: make(map[string]*Client),
+			parked:  make(map[string]*Client),
+		}
+	}
+	return shards
+}
+
+// shard returns the shard holding a user's client
+func (m *Manager) shard(userID string) *clientShard {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return m.shards[h.Sum32()%clientShards]
+}
+
+// eachClient calls fn with every connected client, read-locking one shard at a time. fn must
+// not register or unregister clients.
+func (m *Manager) eachClient(fn func(*Client)) {
+	for _, shard := range m.shards {
+		shard.mu.RLock()
+		for _, client := range shard.clients {
+			fn(client)
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// lookup returns a user's connected client, or else their parked one
+func (m *Manager) lookup(userID string) (client *Client, parked bool, ok bool) {
+	shard := m.shard(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	if client, ok := shard.clients[userID]; ok {
+		return client, false, true
+	}
+	client, ok = shard.parked[userID]
+	return client, ok, ok
+}
+
+// ClientCount returns the number of clients connected to this replica
+func (m *Manager) ClientCount() int {
+	return int(m.clientCount.Load())
+}
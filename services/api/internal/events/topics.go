@@ -0,0 +1,134 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"api-service/internal/models"
+	"api-service/internal/topics"
+)
+
+// maxTopicSubscriptions bounds the topic patterns one connection can subscribe to
+const maxTopicSubscriptions = 100
+
+// topicFrame is the payload of a subscribe or unsubscribe frame sent by a client:
+// {"type": "subscribe", "payload": {"topic": "orders.*"}}
+type topicFrame struct {
+	Topic string `json:"topic"`
+}
+
+// SetTopicACL sets the ACL checked when clients subscribe to topics (call before Run).
+// Without one, every topic is open to every client.
+func (m *Manager) SetTopicACL(acl *topics.ACL) {
+	m.topicACL = acl
+}
+
+// handleSubscribeFrame subscribes a client to the topic pattern of a subscribe frame,
+// replying with a subscribed or subscription_denied event
+func (m *Manager) handleSubscribeFrame(client *Client, frame InboundFrame) error {
+	var msg topicFrame
+	if err := json.Unmarshal(frame.Payload, &msg); err != nil {
+		return NewFrameError("invalid_payload", "Expected {\"topic\": \"...\"}")
+	}
+	pattern := msg.Topic
+
+	if err := m.subscribe(client, pattern); err != nil {
+		log.Printf("Topic subscription of %s to %q denied: %v", client.ID, pattern, err)
+		m.deliver(client.ID, newEncodedEvent(NewSubscriptionDeniedEvent(pattern, err.Error())))
+		return nil
+	}
+	m.deliver(client.ID, newEncodedEvent(NewSubscribedEvent(pattern)))
+	return nil
+}
+
+// handleUnsubscribeFrame removes the topic pattern of an unsubscribe frame from the client's
+// subscriptions, replying with an unsubscribed event
+func (m *Manager) handleUnsubscribeFrame(client *Client, frame InboundFrame) error {
+	var msg topicFrame
+	if err := json.Unmarshal(frame.Payload, &msg); err != nil {
+		return NewFrameError("invalid_payload", "Expected {\"topic\": \"...\"}")
+	}
+
+	client.topicsMu.Lock()
+	delete(client.topics, msg.Topic)
+	client.topicsMu.Unlock()
+	m.deliver(client.ID, newEncodedEvent(NewUnsubscribedEvent(msg.Topic)))
+	return nil
+}
+
+// subscribe validates and authorizes a topic pattern and adds it to the client's subscriptions
+func (m *Manager) subscribe(client *Client, pattern string) error {
+	if err := topics.ValidatePattern(pattern); err != nil {
+		return err
+	}
+	if m.topicACL != nil {
+		if err := m.topicACL.Authorize(client.Identity(), pattern, topics.ActionSubscribe); err != nil {
+			return err
+		}
+	}
+
+	client.topicsMu.Lock()
+	defer client.topicsMu.Unlock()
+	if _, ok := client.topics[pattern]; ok {
+		return nil
+	}
+	if len(client.topics) >= maxTopicSubscriptions {
+		return errors.New("too many topic subscriptions")
+	}
+	if client.topics == nil {
+		client.topics = make(map[string]struct{})
+	}
+	client.topics[pattern] = struct{}{}
+	return nil
+}
+
+// receives reports whether a topic event is for the client: the client belongs to the
+// event's tenant and subscribed to a matching pattern. Patterns are authorized when
+// subscribing, but a wildcard can cover topics whose own ACL rule excludes the client,
+// so topics reached only through a wildcard are checked again.
+func (m *Manager) receives(client *Client, event *Event) bool {
+	if event.TenantID != "" && event.TenantID != client.TenantID {
+		return false
+	}
+
+	client.topicsMu.Lock()
+	_, exact := client.topics[event.Topic]
+	wildcard := false
+	if !exact {
+		for pattern := range client.topics {
+			if topics.Match(pattern, event.Topic) {
+				wildcard = true
+				break
+			}
+		}
+	}
+	client.topicsMu.Unlock()
+
+	if exact {
+		return true
+	}
+	return wildcard && (m.topicACL == nil || m.topicACL.Allowed(client.Identity(), event.Topic, topics.ActionSubscribe))
+}
+
+// Subscriptions returns the topic patterns the client is subscribed to
+func (c *Client) Subscriptions() []string {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	patterns := make([]string, 0, len(c.topics))
+	for pattern := range c.topics {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// Identity returns the client's authenticated user, falling back to its ID, name and tenant alone
+func (c *Client) Identity() *models.User {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.User != nil {
+		return c.User
+	}
+	return &models.User{ID: c.ID, Name: c.Name, Email: c.Email, TenantID: c.TenantID}
+}
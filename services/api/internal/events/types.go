@@ -1,69 +1,289 @@
 package events
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"api-service/internal/models"
+)
+
 // EventType represents the type of event being sent
 type EventType string
 
 const (
-	EventTypeChat       EventType = "chat"
-	EventTypeUserJoined EventType = "user_joined"
-	EventTypeUserLeft   EventType = "user_left"
+	EventTypeChat               EventType = "chat"
+	EventTypeUserJoined         EventType = "user_joined"
+	EventTypeUserLeft           EventType = "user_left"
+	EventTypeSystem             EventType = "system_message"
+	EventTypeUpgrade            EventType = "client_upgrade"
+	EventTypeDelivered          EventType = "delivered"       // A sent message was acknowledged by its recipient
+	EventTypeFailed             EventType = "delivery_failed" // A sent message was never acknowledged
+	EventTypePresence           EventType = "presence_changed"
+	EventTypeTopic              EventType = "topic_event" // An application event published on a topic
+	EventTypeSubscribed         EventType = "subscribed"
+	EventTypeUnsubscribed       EventType = "unsubscribed"
+	EventTypeSubscriptionDenied EventType = "subscription_denied"
+	EventTypeReactionAdded      EventType = "reaction_added"
+	EventTypeReactionRemoved    EventType = "reaction_removed"
+	EventTypeMessageUpdated     EventType = "message_updated"
+	EventTypeMessageDeleted     EventType = "message_deleted"
+	EventTypeMention            EventType = "mention" // The user was mentioned in a message
+	EventTypeAttachmentAdded    EventType = "attachment_added"
+	EventTypeAttachmentUpdated  EventType = "attachment_updated"            // Thumbnails of an image attachment are ready
+	EventTypeKicked             EventType = "kicked"                        // An admin closed the user's connections
+	EventTypeBanned             EventType = "banned"                        // An admin banned the user for a while
+	EventTypeAnnouncement       EventType = "system_announcement"           // An admin broadcast an announcement
+	EventTypeAnnouncementEnded  EventType = "system_announcement_withdrawn" // An admin cancelled an announcement
+	EventTypeSession            EventType = "session"                       // Resume token and sequence number of a WebSocket connection
+	EventTypeTyping             EventType = "typing"                        // A user started or stopped typing
+	EventTypeFrameResult        EventType = "frame_result"                  // Result of an inbound frame (see frames.go)
+	EventTypeFrameError         EventType = "frame_error"                   // An inbound frame was refused or failed
+	EventTypePong               EventType = "pong"                          // Reply to a ping frame
+	EventTypeReauthRequired     EventType = "reauth_required"               // The connection's token is about to expire
+	EventTypeAuthRefreshed      EventType = "auth_refreshed"                // The connection's token was renewed
 	// Add more event types as needed
 )
 
 // Event represents a generic event that can be sent through WebSocket
 type Event struct {
-	Type    EventType              `json:"type"`
-	Payload map[string]interface{} `json:"payload"`
+	Type    EventType   `json:"type"`
+	Payload interface{} `json:"payload"` // A payload struct or Fields (see PayloadType)
+
+	ID        string    `json:"-"` // Unique event ID (sent in the v2 envelope)
+	Timestamp time.Time `json:"-"` // Creation time (sent in the v2 envelope)
+	Schema    int       `json:"-"` // Payload schema version (sent in the v2 envelope); 0 is the newest (see schema.go)
+	Topic     string    `json:"-"` // Deliver only to clients subscribed to this topic
+	TenantID  string    `json:"-"` // Deliver only to clients of this tenant (topic events)
 }
 
-// ChatEvent represents a chat message event
-type ChatEvent struct {
-	From    string `json:"from"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Content string `json:"content"`
+// NewEvent creates an event with a fresh ID and timestamp
+func NewEvent[T PayloadType](eventType EventType, payload T) *Event {
+	return &Event{
+		Type:      eventType,
+		Payload:   payload,
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+	}
 }
 
-// UserEvent represents a user join/leave event
-type UserEvent struct {
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
-	Email  string `json:"email"`
+// newEventID returns a random 128-bit hex event ID
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // NewChatEvent creates a new chat event
-func NewChatEvent(from, name, email, content string) *Event {
-	return &Event{
-		Type: EventTypeChat,
-		Payload: map[string]interface{}{
-			"from":    from,
-			"name":    name,
-			"email":   email,
-			"content": content,
-		},
-	}
+func NewChatEvent(from, name, email string, message *models.MessageContent) *Event {
+	return NewEvent(EventTypeChat, &ChatPayload{
+		From:    from,
+		Name:    name,
+		Email:   email,
+		Content: message.Text,
+		Message: message,
+	})
 }
 
 // NewUserJoinedEvent creates a new user joined event
 func NewUserJoinedEvent(userID, name, email string) *Event {
-	return &Event{
-		Type: EventTypeUserJoined,
-		Payload: map[string]interface{}{
-			"user_id": userID,
-			"name":    name,
-			"email":   email,
-		},
-	}
+	return NewEvent(EventTypeUserJoined, &UserPayload{UserID: userID, Name: name, Email: email})
 }
 
 // NewUserLeftEvent creates a new user left event
 func NewUserLeftEvent(userID, name, email string) *Event {
-	return &Event{
-		Type: EventTypeUserLeft,
-		Payload: map[string]interface{}{
-			"user_id": userID,
-			"name":    name,
-			"email":   email,
-		},
+	return NewEvent(EventTypeUserLeft, &UserPayload{UserID: userID, Name: name, Email: email})
+}
+
+// ClientUpgrade describes why a client should upgrade and where to get the new version
+type ClientUpgrade struct {
+	Required           bool   `json:"required"` // The client is being disconnected
+	CurrentVersion     string `json:"currentVersion"`
+	MinimumVersion     string `json:"minimumVersion"`
+	RecommendedVersion string `json:"recommendedVersion"`
+	UpgradeURL         string `json:"upgradeUrl"`
+}
+
+// NewClientUpgradeEvent creates an event asking the client to upgrade
+func NewClientUpgradeEvent(upgrade ClientUpgrade) *Event {
+	return NewEvent(EventTypeUpgrade, &upgrade)
+}
+
+// NewDeliveredEvent tells a sender that the recipient acknowledged a message
+func NewDeliveredEvent(messageID, to string) *Event {
+	return NewEvent(EventTypeDelivered, &DeliveryPayload{MessageID: messageID, To: to})
+}
+
+// NewDeliveryFailedEvent tells a sender that a message wasn't acknowledged after every attempt
+func NewDeliveryFailedEvent(messageID, to string, attempts int) *Event {
+	return NewEvent(EventTypeFailed, &DeliveryPayload{MessageID: messageID, To: to, Attempts: attempts})
+}
+
+// NewRoomChatEvent creates a chat event for a message sent to a room
+func NewRoomChatEvent(roomID, from, name, email string, message *models.MessageContent) *Event {
+	return InRoom(NewChatEvent(from, name, email, message), roomID)
+}
+
+// InThread marks a message event as a reply in the thread started by parentID; clients show
+// it in the thread rather than the conversation. Events with an empty parentID, or without a
+// conversation, are unchanged.
+func InThread(event *Event, parentID string) *Event {
+	if c, ok := event.Payload.(inConversation); ok && parentID != "" {
+		c.conversation().ParentMessageID = parentID
+	}
+	return event
+}
+
+// InRoom marks an event as concerning a room's conversation. Events with an empty roomID, or
+// without a conversation, are unchanged.
+func InRoom(event *Event, roomID string) *Event {
+	if c, ok := event.Payload.(inConversation); ok && roomID != "" {
+		c.conversation().RoomID = roomID
 	}
+	return event
+}
+
+// NewReactionEvent tells a conversation's participants that a user added (reaction_added) or
+// removed (reaction_removed) an emoji reaction; count is the emoji's new total on the message
+func NewReactionEvent(eventType EventType, messageID, emoji, userID, name string, count int) *Event {
+	return NewEvent(eventType, &ReactionPayload{
+		MessageID: messageID,
+		Emoji:     emoji,
+		UserID:    userID,
+		Name:      name,
+		Count:     count,
+	})
+}
+
+// NewMessageUpdatedEvent tells a conversation's participants that a message was edited and
+// carries its new content
+func NewMessageUpdatedEvent(messageID, userID, name string, message *models.MessageContent, editedAt time.Time) *Event {
+	return NewEvent(EventTypeMessageUpdated, &MessageUpdatedPayload{
+		MessageID: messageID,
+		UserID:    userID,
+		Name:      name,
+		Content:   message.Text,
+		Message:   message,
+		EditedAt:  editedAt,
+	})
+}
+
+// NewMessageDeletedEvent tells a conversation's participants that a message was deleted;
+// clients replace it with a tombstone
+func NewMessageDeletedEvent(messageID, userID, name string) *Event {
+	return NewEvent(EventTypeMessageDeleted, &MessageDeletedPayload{MessageID: messageID, UserID: userID, Name: name})
+}
+
+// NewMentionEvent tells a user they were mentioned in a message, separately from the chat
+// event delivering it, so clients can notify them even in a busy room
+func NewMentionEvent(messageID, from, name string, message *models.MessageContent) *Event {
+	return NewEvent(EventTypeMention, &MentionPayload{
+		MessageID: messageID,
+		From:      from,
+		Name:      name,
+		Content:   message.Text,
+		Message:   message,
+	})
+}
+
+// NewAttachmentAddedEvent tells a conversation's participants that a file was attached to a
+// message; clients fetch a download URL from the API when the user opens it
+func NewAttachmentAddedEvent(messageID, userID, name, attachmentID, fileName, contentType string, size int64) *Event {
+	return NewEvent(EventTypeAttachmentAdded, &AttachmentPayload{
+		MessageID:    messageID,
+		UserID:       userID,
+		Name:         name,
+		AttachmentID: attachmentID,
+		FileName:     fileName,
+		ContentType:  contentType,
+		Size:         size,
+	})
+}
+
+// NewAttachmentUpdatedEvent tells a conversation's participants, including the sender, that
+// thumbnails of an image attachment were generated
+func NewAttachmentUpdatedEvent(messageID, attachmentID string, thumbnails interface{}) *Event {
+	return NewEvent(EventTypeAttachmentUpdated, &AttachmentUpdatedPayload{
+		MessageID:    messageID,
+		AttachmentID: attachmentID,
+		Thumbnails:   thumbnails,
+	})
+}
+
+// NewKickedEvent tells a user an admin is closing their connections; they may reconnect
+func NewKickedEvent(reason string) *Event {
+	return NewEvent(EventTypeKicked, &ModerationPayload{Reason: reason})
+}
+
+// NewBannedEvent tells a user an admin banned them and is closing their connections; they
+// can't authenticate again until expiresAt
+func NewBannedEvent(reason string, expiresAt time.Time) *Event {
+	return NewEvent(EventTypeBanned, &ModerationPayload{Reason: reason, ExpiresAt: &expiresAt})
+}
+
+// NewAnnouncementEvent delivers an admin announcement, shown until expiresAt; roomID is set
+// for announcements to a room's members
+func NewAnnouncementEvent(id, message, level, roomID string, startsAt, expiresAt time.Time) *Event {
+	return NewEvent(EventTypeAnnouncement, &AnnouncementPayload{
+		ID:        id,
+		Message:   message,
+		Level:     level,
+		StartsAt:  startsAt,
+		ExpiresAt: expiresAt,
+		RoomID:    roomID,
+	})
+}
+
+// NewAnnouncementWithdrawnEvent tells clients to stop showing a cancelled announcement
+func NewAnnouncementWithdrawnEvent(id string) *Event {
+	return NewEvent(EventTypeAnnouncementEnded, &AnnouncementWithdrawnPayload{ID: id})
+}
+
+// NewRoomUserJoinedEvent tells a room's members that a user joined the room
+func NewRoomUserJoinedEvent(roomID, userID, name, email string) *Event {
+	return InRoom(NewUserJoinedEvent(userID, name, email), roomID)
+}
+
+// NewRoomUserLeftEvent tells a room's members that a user left the room
+func NewRoomUserLeftEvent(roomID, userID, name, email string) *Event {
+	return InRoom(NewUserLeftEvent(userID, name, email), roomID)
+}
+
+// NewTopicEvent creates an application event published on a topic by a user of tenantID.
+// It's delivered only to that tenant's clients subscribed to the topic.
+func NewTopicEvent(topic, tenantID, from string, data interface{}) *Event {
+	event := NewEvent(EventTypeTopic, &TopicPayload{Topic: topic, From: from, Data: data})
+	event.Topic = topic
+	event.TenantID = tenantID
+	return event
+}
+
+// NewTypingEvent tells a user that someone in their conversation started or stopped typing
+func NewTypingEvent(userID, name string, typing bool) *Event {
+	return NewEvent(EventTypeTyping, &TypingPayload{UserID: userID, Name: name, Typing: typing})
+}
+
+// NewReauthRequiredEvent tells a client the token its connection was opened with expires soon
+func NewReauthRequiredEvent(expiresAt time.Time) *Event {
+	return NewEvent(EventTypeReauthRequired, &AuthExpiryPayload{ExpiresAt: expiresAt.UTC()})
+}
+
+// NewAuthRefreshedEvent confirms a connection's token was renewed, until expiresAt
+func NewAuthRefreshedEvent(expiresAt time.Time) *Event {
+	return NewEvent(EventTypeAuthRefreshed, &AuthExpiryPayload{ExpiresAt: expiresAt.UTC()})
+}
+
+// NewSubscribedEvent confirms a topic subscription
+func NewSubscribedEvent(topic string) *Event {
+	return NewEvent(EventTypeSubscribed, &SubscriptionPayload{Topic: topic})
+}
+
+// NewUnsubscribedEvent confirms a topic was unsubscribed
+func NewUnsubscribedEvent(topic string) *Event {
+	return NewEvent(EventTypeUnsubscribed, &SubscriptionPayload{Topic: topic})
+}
+
+// NewSubscriptionDeniedEvent tells a client why a topic subscription was refused
+func NewSubscriptionDeniedEvent(topic, reason string) *Event {
+	return NewEvent(EventTypeSubscriptionDenied, &SubscriptionPayload{Topic: topic, Reason: reason})
 }
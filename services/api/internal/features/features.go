@@ -0,0 +1,246 @@
+// Package features evaluates feature flags, which switch features on for everyone, a
+// percentage of users, or targeted users and groups, so features can be rolled out gradually
+package features
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"api-service/internal/models"
+)
+
+// Flags gating features of the service
+const (
+	Rooms        = "rooms"        // Group chat rooms (REST endpoints and room frames)
+	Reactions    = "reactions"    // Emoji reactions to messages
+	WebTransport = "webtransport" // Experimental event stream over WebTransport (HTTP/3)
+)
+
+// Defaults are the flags every deployment has, as they are unless configured otherwise
+var Defaults = []Flag{
+	{Name: Rooms, Enabled: true, Rollout: 100},
+	{Name: Reactions, Enabled: true, Rollout: 100},
+	{Name: WebTransport}, // Off until a deployment opts users in
+}
+
+// Flag is a feature flag. Users are each assigned a stable bucket per flag, so raising a
+// rollout percentage only ever adds users.
+type Flag struct {
+	Name           string   `json:"name"`
+	Enabled        bool     `json:"enabled"`                  // A disabled flag is off for everyone
+	Rollout        float64  `json:"rollout"`                  // Percentage (0-100) of users it's on for
+	Users          []string `json:"users,omitempty"`          // Users it's on for (IDs or emails)
+	Groups         []Group  `json:"groups,omitempty"`         // Groups with their own rollout percentage
+	ExcludedUsers  []string `json:"excludedUsers,omitempty"`  // Users it's off for, whatever else applies
+	ExcludedGroups []string `json:"excludedGroups,omitempty"` // Groups it's off for, whatever else applies
+}
+
+// Group is a group (ID from the groups claim) or app role targeted by a flag
+type Group struct {
+	Name    string  `json:"name"`
+	Rollout float64 `json:"rollout"` // Percentage (0-100) of the group's users it's on for
+}
+
+// EnabledFor reports whether the flag is on for the user. Without a user, only a flag that's
+// on for everyone is.
+func (f Flag) EnabledFor(user *models.User) bool {
+	if !f.Enabled {
+		return false
+	}
+	if user == nil {
+		return f.Rollout >= 100 && len(f.ExcludedUsers) == 0 && len(f.ExcludedGroups) == 0
+	}
+
+	if matchesUser(user, f.ExcludedUsers) {
+		return false
+	}
+	for _, group := range f.ExcludedGroups {
+		if inGroup(user, group) {
+			return false
+		}
+	}
+	if matchesUser(user, f.Users) {
+		return true
+	}
+
+	bucket := f.bucket(user.ID)
+	for _, group := range f.Groups {
+		if inGroup(user, group.Name) && (group.Rollout >= 100 || bucket < group.Rollout) {
+			return true
+		}
+	}
+	return f.Rollout >= 100 || bucket < f.Rollout
+}
+
+// bucket places a user in [0, 100) for the flag
+func (f Flag) bucket(userID string) float64 {
+	sum := sha256.Sum256([]byte(f.Name + "\n" + userID))
+	return float64(binary.BigEndian.Uint64(sum[:8])) / math.MaxUint64 * 100
+}
+
+// matchesUser reports whether the user's ID or email is listed
+func matchesUser(user *models.User, users []string) bool {
+	for _, u := range users {
+		if strings.EqualFold(u, user.ID) || (user.Email != "" && strings.EqualFold(u, user.Email)) {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroup reports whether the user is a member of the group or holds the app role
+func inGroup(user *models.User, group string) bool {
+	for _, g := range user.Groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return user.HasRole(group)
+}
+
+// Parse parses comma separated flags, each on for everyone, off, or on for a percentage of
+// users: "rooms=on,reactions=off,threads=25%". true/false and 1/0 are accepted for on/off.
+func Parse(value string) ([]Flag, error) {
+	var flags []Flag
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, setting, ok := strings.Cut(entry, "=")
+		name, setting = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(setting))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid feature flag %q (expected name=on, name=off or name=<percent>%%)", entry)
+		}
+
+		flag := Flag{Name: name}
+		switch {
+		case setting == "on":
+			flag.Enabled, flag.Rollout = true, 100
+		case setting == "off":
+		case strings.HasSuffix(setting, "%"):
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(setting, "%"), 64)
+			if err != nil || percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("invalid rollout percentage %q for feature flag %s (expected 0%% to 100%%)", setting, name)
+			}
+			flag.Enabled, flag.Rollout = true, percent
+		default:
+			on, err := strconv.ParseBool(setting)
+			if err != nil {
+				return nil, fmt.Errorf("invalid setting %q for feature flag %s (expected on, off or a percentage)", setting, name)
+			}
+			if on {
+				flag.Enabled, flag.Rollout = true, 100
+			}
+		}
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+// Set holds the flags from every source. Flags configured locally (FEATURE_FLAGS) override
+// those from App Configuration, which override Defaults; unknown flags are off.
+type Set struct {
+	mu     sync.RWMutex
+	local  map[string]Flag
+	remote map[string]Flag
+}
+
+// NewSet creates a set with the locally configured flags
+func NewSet(local []Flag) *Set {
+	return &Set{local: byName(local), remote: map[string]Flag{}}
+}
+
+// SetRemote replaces the flags from App Configuration
+func (s *Set) SetRemote(flags []Flag) {
+	remote := byName(flags)
+	s.mu.Lock()
+	s.remote = remote
+	s.mu.Unlock()
+}
+
+// Lookup returns the flag with the given name
+func (s *Set) Lookup(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if flag, ok := s.local[name]; ok {
+		return flag, true
+	}
+	if flag, ok := s.remote[name]; ok {
+		return flag, true
+	}
+	for _, flag := range Defaults {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// Enabled reports whether the flag is on for everyone
+func (s *Set) Enabled(name string) bool {
+	flag, _ := s.Lookup(name)
+	return flag.EnabledFor(nil)
+}
+
+// Percentage returns the percentage of users the flag is on for, besides targeted ones (0
+// when it's disabled)
+func (s *Set) Percentage(name string) float64 {
+	flag, _ := s.Lookup(name)
+	if !flag.Enabled {
+		return 0
+	}
+	return flag.Rollout
+}
+
+// EnabledFor reports whether the flag is on for the user
+func (s *Set) EnabledFor(name string, user *models.User) bool {
+	flag, _ := s.Lookup(name)
+	return flag.EnabledFor(user)
+}
+
+// Evaluate returns every flag and whether it's on for the user
+func (s *Set) Evaluate(user *models.User) map[string]bool {
+	evaluated := make(map[string]bool)
+	for _, name := range s.Names() {
+		evaluated[name] = s.EnabledFor(name, user)
+	}
+	return evaluated
+}
+
+// Names returns the names of every flag, sorted
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	seen := make(map[string]bool)
+	for name := range s.local {
+		seen[name] = true
+	}
+	for name := range s.remote {
+		seen[name] = true
+	}
+	s.mu.RUnlock()
+	for _, flag := range Defaults {
+		seen[flag.Name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// byName indexes flags by name; later flags replace earlier ones
+func byName(flags []Flag) map[string]Flag {
+	indexed := make(map[string]Flag, len(flags))
+	for _, flag := range flags {
+		indexed[flag.Name] = flag
+	}
+	return indexed
+}
@@ -0,0 +1,235 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+)
+
+// errUnauthenticated is returned when the request carries no user (the route requires auth)
+var errUnauthenticated = errors.New("authentication required")
+
+// ForbiddenError is returned for fields the caller may not see
+type ForbiddenError struct {
+	Field string
+}
+
+func (e *ForbiddenError) Error() string {
+	return "not authorized to read " + e.Field
+}
+
+// Extensions adds a machine-readable code to the GraphQL error
+func (e *ForbiddenError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "FORBIDDEN"}
+}
+
+// Resolver is the root query resolver
+type Resolver struct {
+	manager *events.Manager
+}
+
+// Me resolves Query.me
+func (r *Resolver) Me(ctx context.Context) (*UserResolver, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	user := &UserResolver{root: r, id: caller.ID, name: caller.Name, email: caller.Email, tenantID: caller.TenantID, roles: caller.Roles}
+	user.session = r.session(caller.ID)
+	return user, nil
+}
+
+// User resolves Query.user
+func (r *Resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*UserResolver, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	session := r.session(string(args.ID))
+	if session == nil || !canSeeTenant(caller, session.TenantID) {
+		return nil, nil
+	}
+	return r.userFromSession(session), nil
+}
+
+// Users resolves Query.users
+func (r *Resolver) Users(ctx context.Context, args struct{ TenantID *string }) ([]*UserResolver, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	sessions := r.sessions(caller, args.TenantID)
+	users := make([]*UserResolver, 0, len(sessions))
+	for i := range sessions {
+		users = append(users, r.userFromSession(&sessions[i]))
+	}
+	return users, nil
+}
+
+// Sessions resolves Query.sessions
+func (r *Resolver) Sessions(ctx context.Context, args struct{ TenantID *string }) (*[]*SessionResolver, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if !caller.HasRole(models.RoleAdmin) && !caller.HasRole(models.RoleTenantAdmin) {
+		return nil, &ForbiddenError{Field: "sessions"}
+	}
+
+	sessions := r.sessions(caller, args.TenantID)
+	resolvers := make([]*SessionResolver, 0, len(sessions))
+	for i := range sessions {
+		resolvers = append(resolvers, &SessionResolver{root: r, session: &sessions[i]})
+	}
+	return &resolvers, nil
+}
+
+// sessions returns the live sessions visible to the caller, optionally filtered by tenant
+func (r *Resolver) sessions(caller *models.User, tenantID *string) []events.Session {
+	var visible []events.Session
+	for _, session := range r.manager.Sessions() {
+		if !canSeeTenant(caller, session.TenantID) {
+			continue
+		}
+		if tenantID != nil && session.TenantID != *tenantID {
+			continue
+		}
+		visible = append(visible, session)
+	}
+	return visible
+}
+
+// session returns the live session of a user, or nil
+func (r *Resolver) session(userID string) *events.Session {
+	for _, session := range r.manager.Sessions() {
+		if session.UserID == userID {
+			return &session
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) userFromSession(session *events.Session) *UserResolver {
+	return &UserResolver{root: r, id: session.UserID, name: session.Name, email: session.Email, tenantID: session.TenantID, session: session}
+}
+
+// canSeeTenant reports whether the caller may see users of a tenant
+func canSeeTenant(caller *models.User, tenantID string) bool {
+	return caller.TenantID == tenantID || caller.HasRole(models.RoleAdmin)
+}
+
+// canAdministerTenant reports whether the caller is a platform admin or an admin of the tenant
+func canAdministerTenant(caller *models.User, tenantID string) bool {
+	return caller.HasRole(models.RoleAdmin) || (caller.HasRole(models.RoleTenantAdmin) && caller.TenantID == tenantID)
+}
+
+// UserResolver resolves the User type
+type UserResolver struct {
+	root     *Resolver
+	id       string
+	name     string
+	email    string
+	tenantID string
+	roles    []string        // Only known for the authenticated user
+	session  *events.Session // nil when offline
+}
+
+// ID resolves User.id
+func (u *UserResolver) ID() graphql.ID {
+	return graphql.ID(u.id)
+}
+
+// Name resolves User.name
+func (u *UserResolver) Name() string {
+	return u.name
+}
+
+// Email resolves User.email, visible to users of the same tenant and admins
+func (u *UserResolver) Email(ctx context.Context) (*string, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok || !canSeeTenant(caller, u.tenantID) {
+		return nil, &ForbiddenError{Field: "email"}
+	}
+	return &u.email, nil
+}
+
+// TenantID resolves User.tenantId
+func (u *UserResolver) TenantID() string {
+	return u.tenantID
+}
+
+// Roles resolves User.roles, visible to the user themselves and admins
+func (u *UserResolver) Roles(ctx context.Context) (*[]string, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok || (caller.ID != u.id && !canAdministerTenant(caller, u.tenantID)) {
+		return nil, &ForbiddenError{Field: "roles"}
+	}
+	if u.roles == nil {
+		return nil, nil
+	}
+	return &u.roles, nil
+}
+
+// Online resolves User.online
+func (u *UserResolver) Online() bool {
+	return u.session != nil
+}
+
+// Session resolves User.session (Admin, or TenantAdmin of the user's tenant)
+func (u *UserResolver) Session(ctx context.Context) (*SessionResolver, error) {
+	caller, ok := middleware.GetUserFromContext(ctx)
+	if !ok || !canAdministerTenant(caller, u.tenantID) {
+		return nil, &ForbiddenError{Field: "session"}
+	}
+	if u.session == nil {
+		return nil, nil
+	}
+	return &SessionResolver{root: u.root, session: u.session}, nil
+}
+
+// SessionResolver resolves the Session type
+type SessionResolver struct {
+	root    *Resolver
+	session *events.Session
+}
+
+// User resolves Session.user
+func (s *SessionResolver) User() *UserResolver {
+	return s.root.userFromSession(s.session)
+}
+
+// TenantID resolves Session.tenantId
+func (s *SessionResolver) TenantID() string {
+	return s.session.TenantID
+}
+
+// Protocol resolves Session.protocol
+func (s *SessionResolver) Protocol() string {
+	return string(s.session.Protocol)
+}
+
+// AppVersion resolves Session.appVersion
+func (s *SessionResolver) AppVersion() *string {
+	if s.session.AppVersion == "" {
+		return nil
+	}
+	return &s.session.AppVersion
+}
+
+// ConnectedAt resolves Session.connectedAt
+func (s *SessionResolver) ConnectedAt() graphql.Time {
+	return graphql.Time{Time: s.session.ConnectedAt}
+}
+
+// DroppedEvents resolves Session.droppedEvents
+func (s *SessionResolver) DroppedEvents() int32 {
+	return int32(s.session.DroppedEvents)
+}
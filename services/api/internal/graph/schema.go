@@ -0,0 +1,29 @@
+// Package graph serves the GraphQL API over users and live sessions.
+// Field-level authorization is enforced in the resolvers: fields a caller may not see
+// resolve to null with a FORBIDDEN error at their path, the rest of the query still succeeds.
+package graph
+
+import (
+	_ "embed"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"api-service/internal/events"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// Query limits protecting the server from expensive documents
+const (
+	MaxDepth       = 8
+	MaxQueryLength = 8 << 10
+)
+
+// NewSchema parses the schema and binds it to resolvers backed by the event manager
+func NewSchema(manager *events.Manager) (*graphql.Schema, error) {
+	return graphql.ParseSchema(schemaSDL, &Resolver{manager: manager},
+		graphql.MaxDepth(MaxDepth),
+		graphql.MaxQueryLength(MaxQueryLength),
+	)
+}
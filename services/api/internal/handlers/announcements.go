@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"api-service/internal/announcements"
+	"api-service/internal/middleware"
+	"api-service/internal/store"
+)
+
+// AnnouncementHandler lets admins broadcast announcements and users fetch the active ones
+type AnnouncementHandler struct {
+	announcements *announcements.Service
+	rooms         store.RoomStore
+}
+
+// NewAnnouncementHandler creates a new announcement handler
+func NewAnnouncementHandler(service *announcements.Service, rooms store.RoomStore) *AnnouncementHandler {
+	return &AnnouncementHandler{
+		announcements: service,
+		rooms:         rooms,
+	}
+}
+
+// BroadcastRequest schedules an announcement
+type BroadcastRequest struct {
+	Message   string     `json:"message" validate:"trim,required,max=2000"`
+	Level     string     `json:"level,omitempty" validate:"oneof=info warning critical"` // Default info
+	TenantID  string     `json:"tenantId,omitempty" validate:"trim"`                     // Only this tenant's users
+	RoomID    string     `json:"roomId,omitempty" validate:"trim"`                       // Only this room's members
+	StartsAt  *time.Time `json:"startsAt,omitempty"`                                     // Default now
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`                                    // Default a day after it starts
+}
+
+// AnnouncementsResponse lists announcements
+type AnnouncementsResponse struct {
+	Announcements []announcements.Announcement `json:"announcements"`
+}
+
+// Broadcast handles POST /api/admin/broadcast
+func (h *AnnouncementHandler) Broadcast(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req BroadcastRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.RoomID != "" {
+		if _, err := h.rooms.Room(r.Context(), req.RoomID); err != nil {
+			if errors.Is(err, store.ErrRoomNotFound) {
+				writeError(w, r, http.StatusNotFound, "room_not_found", "Room not found")
+				return
+			}
+			log.Printf("Failed to look up room %s: %v", req.RoomID, err)
+			writeError(w, r, http.StatusServiceUnavailable, "rooms_unavailable", "Rooms are temporarily unavailable")
+			return
+		}
+	}
+
+	announcement := &announcements.Announcement{
+		Message:  req.Message,
+		Level:    req.Level,
+		TenantID: req.TenantID,
+		RoomID:   req.RoomID,
+	}
+	if req.StartsAt != nil {
+		announcement.StartsAt = *req.StartsAt
+	}
+	if req.ExpiresAt != nil {
+		announcement.ExpiresAt = *req.ExpiresAt
+	}
+
+	created, err := h.announcements.Create(r.Context(), admin, announcement)
+	if errors.Is(err, announcements.ErrInvalidAnnouncement) {
+		writeError(w, r, http.StatusBadRequest, "invalid_announcement", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to schedule announcement: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "announcements_unavailable", "Announcements are temporarily unavailable")
+		return
+	}
+	log.Printf("Announcement %s scheduled by %s (%s)", created.ID, admin.Email, admin.ID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// List handles GET /api/admin/broadcast, the scheduled and active announcements
+func (h *AnnouncementHandler) List(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, AnnouncementsResponse{Announcements: h.announcements.List()})
+}
+
+// Cancel handles DELETE /api/admin/broadcast/{id}
+func (h *AnnouncementHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	err := h.announcements.Cancel(r.Context(), admin, r.PathValue("id"))
+	switch {
+	case errors.Is(err, announcements.ErrAnnouncementNotFound):
+		writeError(w, r, http.StatusNotFound, "announcement_not_found", "Announcement not found")
+	case err != nil:
+		log.Printf("Failed to cancel announcement %s: %v", r.PathValue("id"), err)
+		writeError(w, r, http.StatusServiceUnavailable, "announcements_unavailable", "Announcements are temporarily unavailable")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Active handles GET /api/announcements, the active announcements addressed to the caller
+func (h *AnnouncementHandler) Active(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	active, err := h.announcements.ActiveFor(r.Context(), user)
+	if err != nil {
+		log.Printf("Failed to look up announcements for %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "announcements_unavailable", "Announcements are temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, AnnouncementsResponse{Announcements: active})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"api-service/internal/attachments"
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+	"api-service/internal/moderation"
+	"api-service/internal/usage"
+	"api-service/internal/validate"
+)
+
+// AttachmentHandler serves file uploads to Blob Storage and their attachment to messages
+type AttachmentHandler struct {
+	attachments *attachments.Service
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(service *attachments.Service) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachments: service,
+	}
+}
+
+// InitiateAttachmentRequest describes a file the caller wants to upload
+type InitiateAttachmentRequest struct {
+	FileName    string `json:"fileName" validate:"trim,required,max=255"`
+	ContentType string `json:"contentType" validate:"trim,required,max=255"`
+	Size        int64  `json:"size" validate:"required"` // In bytes
+}
+
+// Validate requires a positive size
+func (req *InitiateAttachmentRequest) Validate(errs *validate.Errors) {
+	if req.Size < 0 {
+		errs.Add("size", "must be positive")
+	}
+}
+
+// CompleteAttachmentRequest attaches an uploaded file to one of the caller's messages
+type CompleteAttachmentRequest struct {
+	AttachmentID string `json:"attachmentId" validate:"trim,required"`
+	MessageID    string `json:"messageId" validate:"trim,required"`
+}
+
+// Initiate handles POST /api/attachments/initiate, returning an upload URL
+func (h *AttachmentHandler) Initiate(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req InitiateAttachmentRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	upload, err := h.attachments.Initiate(r.Context(), user, req.FileName, req.ContentType, req.Size)
+	if err != nil {
+		h.writeAttachmentError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, upload)
+}
+
+// Complete handles POST /api/attachments/complete, returning the updated message
+func (h *AttachmentHandler) Complete(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req CompleteAttachmentRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	msg, err := h.attachments.Complete(r.Context(), user, req.MessageID, req.AttachmentID)
+	if err != nil {
+		h.writeAttachmentError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// Download handles GET /api/messages/{id}/attachments/{attachmentId}, returning a short-lived
+// download URL
+func (h *AttachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	download, err := h.attachments.Download(r.Context(), user, r.PathValue("id"), r.PathValue("attachmentId"))
+	if err != nil {
+		h.writeAttachmentError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, download)
+}
+
+// writeAttachmentError maps an attachment error to a problem response
+func (h *AttachmentHandler) writeAttachmentError(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *usage.QuotaError
+	var rejectedErr *moderation.RejectedError
+	switch {
+	case errors.As(err, &quotaErr):
+		writeQuotaError(w, r, quotaErr)
+	case errors.As(err, &rejectedErr):
+		writeRejectedError(w, r, rejectedErr)
+	case errors.Is(err, attachments.ErrTooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, "attachment_too_large",
+			fmt.Sprintf("Files can be at most %d bytes", h.attachments.Config().MaxBytes))
+	case errors.Is(err, attachments.ErrUnsupportedType):
+		writeError(w, r, http.StatusUnsupportedMediaType, "unsupported_attachment_type", "Files of this content type can't be attached")
+	case errors.Is(err, attachments.ErrUploadNotFound):
+		writeError(w, r, http.StatusNotFound, "upload_not_found", "No uploaded file with this attachment ID")
+	case errors.Is(err, attachments.ErrAttachmentNotFound):
+		writeError(w, r, http.StatusNotFound, "attachment_not_found", "Attachment not found")
+	case errors.Is(err, attachments.ErrAttachmentInUse):
+		writeError(w, r, http.StatusConflict, "attachment_in_use", "The upload is already attached to another message")
+	case errors.Is(err, chat.ErrTooManyAttachments):
+		writeError(w, r, http.StatusConflict, "too_many_attachments", "Message has too many attachments")
+	case errors.Is(err, chat.ErrMessageNotFound):
+		writeError(w, r, http.StatusNotFound, "message_not_found", "Message not found")
+	case errors.Is(err, chat.ErrNotSender):
+		writeError(w, r, http.StatusForbidden, "not_message_sender", "Only the sender can attach files to this message")
+	case errors.Is(err, chat.ErrMessageDeleted):
+		writeError(w, r, http.StatusConflict, "message_deleted", "Message was deleted")
+	case errors.Is(err, chat.ErrTenantReadOnly):
+		writeError(w, r, http.StatusForbidden, "tenant_read_only", "Tenant is frozen and read-only")
+	default:
+		log.Printf("Attachment request failed: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "attachments_unavailable", "Attachments are temporarily unavailable")
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api-service/internal/audit"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditHandler lets admins search and verify this replica's audit log
+type AuditHandler struct {
+	log *audit.Logger
+}
+
+// NewAuditHandler creates a new audit log handler
+func NewAuditHandler(log *audit.Logger) *AuditHandler {
+	return &AuditHandler{log: log}
+}
+
+// AuditResponse lists matching audit records and the state of the external sinks
+type AuditResponse struct {
+	Records []audit.Record    `json:"records"`
+	Sinks   []audit.SinkStats `json:"sinks"`
+}
+
+// List handles GET /api/admin/audit
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := audit.Query{
+		Action:   query.Get("action"),
+		Actor:    query.Get("actor"),
+		TenantID: query.Get("tenantId"),
+		Target:   query.Get("target"),
+		Outcome:  query.Get("outcome"),
+		Limit:    defaultAuditLimit,
+	}
+	for name, bound := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "invalid_"+name, name+" must be an RFC 3339 timestamp")
+				return
+			}
+			*bound = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeError(w, r, http.StatusBadRequest, "invalid_limit", fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+			return
+		}
+		q.Limit = n
+	}
+
+	records, err := h.log.Query(q)
+	if err != nil {
+		log.Printf("Failed to query the audit log: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "audit_unavailable", "The audit log is temporarily unavailable")
+		return
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+	writeJSON(w, http.StatusOK, AuditResponse{Records: records, Sinks: h.log.Sinks()})
+}
+
+// Verify handles GET /api/admin/audit/verify
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	verification, err := h.log.Verify()
+	if err != nil {
+		log.Printf("Failed to verify the audit log: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "audit_unavailable", "The audit log is temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, verification)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+)
+
+// AuthRefreshHandler renews the token of an open WebSocket from refresh_auth frames, so
+// clients can keep their connection across token rotations
+type AuthRefreshHandler struct {
+	auth    *middleware.AuthMiddleware
+	manager *events.Manager
+}
+
+// NewAuthRefreshHandler creates a new auth refresh handler
+func NewAuthRefreshHandler(auth *middleware.AuthMiddleware, manager *events.Manager) *AuthRefreshHandler {
+	return &AuthRefreshHandler{
+		auth:    auth,
+		manager: manager,
+	}
+}
+
+// RefreshAuthFrame is the payload of a refresh_auth frame
+type RefreshAuthFrame struct {
+	Token string `json:"token"`
+}
+
+// HandleFrame validates the token of a refresh_auth frame and, when it's a valid token of the
+// same user, renews the connection with it (replying with auth_refreshed). Otherwise the
+// connection is closed with events.CloseAuthRefreshFailed.
+func (h *AuthRefreshHandler) HandleFrame(client *events.Client, frame events.InboundFrame) error {
+	var req RefreshAuthFrame
+	if err := json.Unmarshal(frame.Payload, &req); err != nil || req.Token == "" {
+		return events.NewFrameError("invalid_payload", "Expected {\"token\": \"...\"}")
+	}
+
+	remoteAddr := client.RemoteAddr
+	current := client.Identity()
+	user, err := h.auth.ValidateToken(req.Token)
+	switch {
+	case errors.Is(err, middleware.ErrUserBanned):
+		h.auth.RecordFailure("/api/ws", remoteAddr, "user_banned", err)
+		h.refuse(client, "user banned", err)
+		return nil
+	case err != nil:
+		h.auth.RecordFailure("/api/ws", remoteAddr, "", err)
+		h.refuse(client, "invalid token", err)
+		return nil
+	case user.ID != current.ID || user.TenantID != current.TenantID:
+		h.auth.RecordFailure("/api/ws", remoteAddr, "token_user_mismatch", nil)
+		h.refuse(client, "token of another user", nil)
+		return nil
+	}
+
+	h.manager.RenewClient(client, user, tokenExpiry(user))
+	log.Printf("🔑 Renewed the token of %s (%s)", user.Name, user.ID)
+	return nil
+}
+
+// refuse closes a connection whose token couldn't be renewed
+func (h *AuthRefreshHandler) refuse(client *events.Client, reason string, err error) {
+	log.Printf("🔑 Closing connection for %s (%s): token refresh failed (%s): %v", client.Name, client.ID, reason, err)
+	h.manager.CloseClient(client, events.CloseAuthRefreshFailed, reason)
+}
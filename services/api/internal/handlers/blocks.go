@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/blocks"
+	"api-service/internal/middleware"
+	"api-service/internal/store"
+)
+
+// BlockHandler lets users block and mute other users
+type BlockHandler struct {
+	blocks *blocks.Service
+}
+
+// NewBlockHandler creates a new block list handler
+func NewBlockHandler(service *blocks.Service) *BlockHandler {
+	return &BlockHandler{blocks: service}
+}
+
+// BlocksResponse lists the caller's block list
+type BlocksResponse struct {
+	Blocks []*store.Block `json:"blocks"`
+}
+
+// Block handles POST /api/users/{id}/block
+func (h *BlockHandler) Block(w http.ResponseWriter, r *http.Request) {
+	h.add(w, r, store.BlockKindBlock)
+}
+
+// Mute handles POST /api/users/{id}/mute
+func (h *BlockHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	h.add(w, r, store.BlockKindMute)
+}
+
+// Unblock handles DELETE /api/users/{id}/block
+func (h *BlockHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	h.remove(w, r, store.BlockKindBlock, "User is not blocked")
+}
+
+// Unmute handles DELETE /api/users/{id}/mute
+func (h *BlockHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	h.remove(w, r, store.BlockKindMute, "User is not muted")
+}
+
+// List handles GET /api/users/blocked
+func (h *BlockHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	list, err := h.blocks.List(r.Context(), user)
+	if err != nil {
+		log.Printf("Failed to list the block list of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "blocks_unavailable", "Block lists are temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, BlocksResponse{Blocks: list})
+}
+
+func (h *BlockHandler) add(w http.ResponseWriter, r *http.Request, kind store.BlockKind) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	block, err := h.blocks.Add(r.Context(), user, r.PathValue("id"), kind)
+	switch {
+	case errors.Is(err, blocks.ErrBlockSelf):
+		writeError(w, r, http.StatusBadRequest, "cannot_block_self", "You can't block or mute yourself")
+	case err != nil:
+		log.Printf("Failed to %s %s for %s: %v", kind, r.PathValue("id"), user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "blocks_unavailable", "Block lists are temporarily unavailable")
+	default:
+		writeJSON(w, http.StatusOK, block)
+	}
+}
+
+func (h *BlockHandler) remove(w http.ResponseWriter, r *http.Request, kind store.BlockKind, notFound string) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	err := h.blocks.Remove(r.Context(), user, r.PathValue("id"), kind)
+	switch {
+	case errors.Is(err, blocks.ErrBlockNotFound):
+		writeError(w, r, http.StatusNotFound, "block_not_found", notFound)
+	case err != nil:
+		log.Printf("Failed to un%s %s for %s: %v", kind, r.PathValue("id"), user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "blocks_unavailable", "Block lists are temporarily unavailable")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1,66 +1,225 @@
 package handlers
 
 import (
+	"compress/flate"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 
+	"api-service/internal/chat"
+	"api-service/internal/clientversion"
 	"api-service/internal/events"
 	"api-service/internal/middleware"
 	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/store"
+	"api-service/internal/usage"
+	"api-service/internal/validate"
 )
 
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins in development
-		// In production, validate the origin
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     checkOrigin,
+}
+
+// Origins allowed to open WebSockets besides the API's own host, so other sites can't ride on
+// a user's credentials (cross-site WebSocket hijacking)
+var (
+	allowAnyOrigin bool
+	allowedOrigin  func(origin string) bool
+)
+
+// SetWebSocketOrigins sets which origins may open WebSockets besides the API's own host
+// (call before serving); allowAny disables the check, for development only
+func SetWebSocketOrigins(allowAny bool, allowed func(origin string) bool) {
+	allowAnyOrigin = allowAny
+	allowedOrigin = allowed
+}
+
+// checkOrigin accepts upgrades without an Origin (non-browser clients), from the API's own
+// host, or from an allowed origin
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if allowAnyOrigin || origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
 		return true
-	},
+	}
+	if allowedOrigin != nil && allowedOrigin(origin) {
+		return true
+	}
+	log.Printf("🚫 Refused WebSocket upgrade from origin %s (%s)", origin, middleware.ClientIP(r))
+	return false
+}
+
+// SetWebSocketBuffers sets the I/O buffer sizes of upgraded connections (call before serving).
+// Frames larger than the write buffer are written in several chunks; 0 keeps the default.
+func SetWebSocketBuffers(readBytes, writeBytes int) {
+	if readBytes > 0 {
+		upgrader.ReadBufferSize = readBytes
+	}
+	if writeBytes > 0 {
+		upgrader.WriteBufferSize = writeBytes
+	}
 }
 
-// EventManager is the global event manager
-var EventManager *events.Manager
+// compressionLevel is the flate level of connections that negotiated permessage-deflate
+var compressionLevel = flate.BestSpeed
+
+// SetWebSocketCompression lets clients negotiate permessage-deflate (call before serving).
+// level is a compress/flate level from -2 (Huffman only) to 9 (best compression).
+func SetWebSocketCompression(enabled bool, level int) {
+	upgrader.EnableCompression = enabled
+	compressionLevel = level
+}
+
+// EventPublisher is the part of the event manager the chat handlers use: it negotiates the
+// protocol of new WebSocket connections, registers them, and replies to their frames
+type EventPublisher interface {
+	Protocols() *events.ProtocolSwitch
+	SendBuffer() int
+	RegisterClient(client *events.Client)
+	ReplyFrame(client *events.Client, frame events.InboundFrame, result interface{})
+}
+
+// ChatHandler serves WebSocket connections and the direct message REST API
+type ChatHandler struct {
+	events   EventPublisher
+	chat     *chat.Service
+	versions *clientversion.Service // Gates connections on the frontend app version; nil disables gating
+}
+
+// NewChatHandler creates a new chat handler
+func NewChatHandler(publisher EventPublisher, service *chat.Service, versions *clientversion.Service) *ChatHandler {
+	return &ChatHandler{
+		events:   publisher,
+		chat:     service,
+		versions: versions,
+	}
+}
 
 // HandleWebSocket handles WebSocket connections
 // The auth middleware must be applied before this handler to set user in context
-func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+func (h *ChatHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Get user from context (set by auth middleware)
 	userInterface := r.Context().Value(middleware.UserContextKey)
 	if userInterface == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
 		return
 	}
 
 	user, ok := userInterface.(*models.User)
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Invalid user context")
+		return
+	}
+
+	// Negotiate the event protocol version and encoding: an "events.v1"/"events.v2" subprotocol,
+	// optionally suffixed with ".msgpack" or ".proto" for binary frames, or ?protocol= and ?encoding=
+	requested := r.URL.Query().Get("protocol")
+	requestedEncoding := r.URL.Query().Get("encoding")
+	var responseHeader http.Header
+	bearer := false
+	for _, subprotocol := range websocket.Subprotocols(r) {
+		if subprotocol == middleware.BearerSubprotocol {
+			bearer = true
+		}
+		if strings.HasPrefix(subprotocol, "events.") && responseHeader == nil {
+			requested = subprotocol
+			requestedEncoding = ""
+			responseHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+		}
+	}
+	// Browsers fail the handshake unless one of the offered subprotocols is selected, so a
+	// client that only offered its token (bearer, <token>) gets "bearer" back
+	if responseHeader == nil && bearer {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {middleware.BearerSubprotocol}}
+	}
+
+	requested, encoding, err := events.SplitEncoding(requested)
+	if err == nil && requestedEncoding != "" {
+		encoding, err = events.ParseEncoding(requestedEncoding)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "unsupported_encoding", err.Error())
+		return
+	}
+	protocol, err := h.events.Protocols().Negotiate(requested)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "unsupported_protocol", err.Error())
+		return
+	}
+
+	// Payload schema version the client was built against: ?schema= (newest by default)
+	schemaVersion, err := events.ParseSchemaVersion(r.URL.Query().Get("schema"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "unsupported_schema", err.Error())
 		return
 	}
 
+	// Resume a dropped session: ?resume=<token>&seq=<last sequence number received>
+	resumeToken := r.URL.Query().Get("resume")
+	var resumeSeq int64
+	if value := r.URL.Query().Get("seq"); value != "" {
+		resumeSeq, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || resumeSeq < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_seq", "seq must be a non-negative integer")
+			return
+		}
+	}
+
 	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Printf("Failed to upgrade WebSocket connection: %v", err)
 		return
 	}
+	if err := conn.SetCompressionLevel(compressionLevel); err != nil {
+		log.Printf("Failed to set WebSocket compression level: %v", err)
+	}
+
+	// Browsers can't read the HTTP status of a failed handshake, so outdated clients are
+	// refused after the upgrade with a client_upgrade event and a dedicated close code
+	appVersion := clientAppVersion(r)
+	if h.versions != nil && h.versions.Check(user.TenantID, appVersion) == clientversion.Refuse {
+		h.refuseOutdatedClient(conn, protocol, encoding, user, appVersion)
+		return
+	}
 
 	// Create a new client
 	client := &events.Client{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
-		Conn:  conn,
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		TenantID:      user.TenantID,
+		Protocol:      protocol,
+		Encoding:      encoding,
+		SchemaVersion: schemaVersion,
+		AppVersion:    appVersion,
+		Conn:          conn,
+		RemoteAddr:    middleware.ClientIP(r),
+		User:          user,
+		ExpiresAt:     tokenExpiry(user),
+		ResumeToken:   resumeToken,
+		ResumeSeq:     resumeSeq,
 	}
 
 	// Initialize the send channel
-	client.InitSendChannel(256)
+	client.InitSendChannel(h.events.SendBuffer())
 
 	// Register the client
-	EventManager.RegisterClient(client)
+	h.events.RegisterClient(client)
 
 	// Start the client's pumps
 	client.Start()
@@ -68,63 +227,291 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebSocket connected: %s (%s)", user.Name, user.Email)
 }
 
+// tokenExpiry returns when the user's token expires, or zero for tokens without an exp claim
+func tokenExpiry(user *models.User) time.Time {
+	if user.ExpiresAt.Unix() <= 0 {
+		return time.Time{}
+	}
+	return user.ExpiresAt
+}
+
+// clientAppVersion returns the app version the client reported with ?appVersion= or the
+// X-Client-Version header, or "" when missing or malformed
+func clientAppVersion(r *http.Request) string {
+	appVersion := r.URL.Query().Get("appVersion")
+	if appVersion == "" {
+		appVersion = r.Header.Get("X-Client-Version")
+	}
+	if re, ok := validate.Pattern("version"); ok && !re.MatchString(appVersion) {
+		return ""
+	}
+	return appVersion
+}
+
+// refuseOutdatedClient tells a client below the minimum version to upgrade and closes the connection
+func (h *ChatHandler) refuseOutdatedClient(conn *websocket.Conn, protocol events.ProtocolVersion, encoding events.Encoding, user *models.User, appVersion string) {
+	defer conn.Close()
+
+	policy := h.versions.PolicyFor(user.TenantID)
+	log.Printf("⬆️  Refusing outdated client for %s (%s): version %q, minimum %q", user.Name, user.ID, appVersion, policy.Minimum)
+
+	deadline := time.Now().Add(time.Second)
+	conn.SetWriteDeadline(deadline)
+	if message, err := clientversion.UpgradeEvent(policy, appVersion, true).EncodeAs(protocol, encoding); err == nil {
+		conn.WriteMessage(encoding.MessageType(), message)
+	}
+	closeMessage := websocket.FormatCloseMessage(clientversion.CloseOutdated, clientversion.CloseReason(policy))
+	conn.WriteControl(websocket.CloseMessage, closeMessage, deadline)
+}
+
 // GetActiveUsers returns all currently connected users
-func GetActiveUsers(w http.ResponseWriter, r *http.Request) {
-	users := EventManager.GetActiveUsers()
+func (h *ChatHandler) GetActiveUsers(w http.ResponseWriter, r *http.Request) {
+	users := h.chat.ActiveUsers()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"users": users,
-		"count": len(users),
+	json.NewEncoder(w).Encode(ActiveUsersResponse{
+		Users: users,
+		Count: len(users),
 	})
 }
 
-// SendMessageRequest represents a message send request
+// ActiveUsersResponse lists the currently connected users
+type ActiveUsersResponse struct {
+	Users []map[string]string `json:"users"`
+	Count int                 `json:"count"`
+}
+
+// SendMessageRequest represents a message send request.
+// Clients send either plain-text "content" or a versioned "message" body; unknown fields
+// inside "message" are preserved and relayed untouched.
 type SendMessageRequest struct {
-	To      string `json:"to"`
-	Content string `json:"content"`
+	To              string                 `json:"to" validate:"trim,required,pattern=id"`
+	Content         *string                `json:"content,omitempty" validate:"trim"`
+	Message         *models.MessageContent `json:"message,omitempty"`
+	ParentMessageID string                 `json:"parentMessageId,omitempty" validate:"trim,pattern=id"` // Reply in this message's thread
+}
+
+// Validate requires exactly one non-empty body and enforces the message length limit
+func (req *SendMessageRequest) Validate(errs *validate.Errors) {
+	validateMessageBody(errs, req.Content, req.Message)
+}
+
+// validateMessageBody requires exactly one of plain-text content or a versioned message,
+// within the message length limit. Sending both is rejected even when content is blank,
+// rather than one silently winning.
+func validateMessageBody(errs *validate.Errors, content *string, message *models.MessageContent) {
+	switch {
+	case content != nil && message != nil:
+		errs.Add("message", "send either 'content' or 'message', not both")
+	case message != nil:
+		if message.Text == "" && len(message.Extra) == 0 {
+			errs.Add("message", "is empty")
+		}
+		if utf8.RuneCountInString(message.Text) > models.MaxMessageTextLength {
+			errs.Add("message.text", fmt.Sprintf("must be at most %d characters", models.MaxMessageTextLength))
+		}
+	case content == nil || *content == "":
+		errs.Add("content", "is required")
+	case utf8.RuneCountInString(*content) > models.MaxMessageTextLength:
+		errs.Add("content", fmt.Sprintf("must be at most %d characters", models.MaxMessageTextLength))
+	}
 }
 
 // SendMessage sends a message to a specific user
-func SendMessage(w http.ResponseWriter, r *http.Request) {
+func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	// Get sender from context
 	userInterface := r.Context().Value(middleware.UserContextKey)
 	if userInterface == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
 		return
 	}
 
 	sender, ok := userInterface.(*models.User)
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Invalid user context")
 		return
 	}
 
 	// Parse request body
 	var req SendMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
-	if req.To == "" || req.Content == "" {
-		http.Error(w, "Missing 'to' or 'content' field", http.StatusBadRequest)
+	message := req.Message
+	if message == nil {
+		message = models.NewMessageContent(*req.Content)
+	}
+
+	var quotaErr *usage.QuotaError
+	var rejectedErr *moderation.RejectedError
+	messageID, err := h.chat.SendMessage(r.Context(), sender, req.To, message, req.ParentMessageID)
+	switch {
+	case errors.As(err, &quotaErr):
+		writeQuotaError(w, r, quotaErr)
+		return
+	case errors.As(err, &rejectedErr):
+		writeRejectedError(w, r, rejectedErr)
+		return
+	case errors.Is(err, chat.ErrTenantReadOnly):
+		writeError(w, r, http.StatusForbidden, "tenant_read_only", "Tenant is frozen and read-only")
+		return
+	case errors.Is(err, chat.ErrParentNotFound):
+		writeError(w, r, http.StatusNotFound, "parent_message_not_found", "Parent message not found in this conversation")
+		return
+	case errors.Is(err, chat.ErrRecipientUnavailable):
+		writeError(w, r, http.StatusNotFound, "recipient_unavailable", "User not connected or unreachable")
+		return
+	case errors.Is(err, chat.ErrBlocked):
+		writeError(w, r, http.StatusForbidden, "recipient_blocked_sender", "The recipient has blocked you")
+		return
+	case err != nil:
+		log.Printf("Error sending message: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "messages_unavailable", "Messages are temporarily unavailable")
 		return
 	}
 
-	// Create and send chat event
-	event := events.NewChatEvent(sender.ID, sender.Name, sender.Email, req.Content)
-	sent := EventManager.SendEventToUser(req.To, event)
-	if !sent {
-		http.Error(w, "User not connected or unreachable", http.StatusNotFound)
+	writeJSON(w, http.StatusOK, SendMessageResponse{
+		Success:   true,
+		Message:   "Message sent",
+		MessageID: messageID,
+	})
+}
+
+// writeRejectedError writes a 422 problem for a message refused by moderation
+func writeRejectedError(w http.ResponseWriter, r *http.Request, err *moderation.RejectedError) {
+	writeError(w, r, http.StatusUnprocessableEntity, "message_rejected", "Message rejected: "+err.Reason)
+}
+
+// SendMessageResponse confirms a message was delivered to the recipient's connections
+type SendMessageResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	MessageID string `json:"messageId"` // ID of the chat event, acknowledged by the recipient
+}
+
+// AckMessage handles POST /api/messages/{id}/ack, acknowledging receipt of a message for
+// clients that can't send WebSocket frames (SSE, long-polling)
+func (h *ChatHandler) AckMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	if err := h.chat.Ack(user, r.PathValue("id")); err != nil {
+		writeError(w, r, http.StatusNotFound, "message_not_pending", "Message is not awaiting your acknowledgment")
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	log.Printf("Message sent from %s to %s", sender.Name, req.To)
+// MessageHistoryResponse is a page of a conversation's messages, newest first
+type MessageHistoryResponse struct {
+	Messages []*store.Message `json:"messages"`
+	Count    int              `json:"count"`
+	Before   string           `json:"before,omitempty"` // Pass as ?before= for the next (older) page; empty on the last page
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Message sent",
+// GetMessageHistory returns the messages exchanged with another user (?with=), newest first.
+// Pages are limited by ?limit= and continue from ?before=.
+func (h *ChatHandler) GetMessageHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	with := strings.TrimSpace(r.URL.Query().Get("with"))
+	if with == "" {
+		writeError(w, r, http.StatusBadRequest, "invalid_with", "with must be the ID of the other user")
+		return
+	}
+
+	before, limit, ok := parseHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := h.chat.History(r.Context(), user, with, before, limit)
+	if err != nil {
+		log.Printf("Error reading message history: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "history_unavailable", "Message history is temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageHistoryResponse(messages, limit))
+}
+
+// ThreadResponse is a message and a page of its replies, newest first
+type ThreadResponse struct {
+	Parent *store.Message `json:"parent"`
+	MessageHistoryResponse
+}
+
+// GetThread handles GET /api/messages/{id}/thread: the thread a message starts (or, for a
+// reply, belongs to) with its replies, newest first. Pages are limited by ?limit= and
+// continue from ?before=.
+func (h *ChatHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	before, limit, ok := parseHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	thread, err := h.chat.Thread(r.Context(), user, r.PathValue("id"), before, limit)
+	switch {
+	case errors.Is(err, chat.ErrMessageNotFound):
+		writeError(w, r, http.StatusNotFound, "message_not_found", "Message not found")
+		return
+	case err != nil:
+		log.Printf("Error reading thread: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "history_unavailable", "Message history is temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, ThreadResponse{
+		Parent:                 thread.Parent,
+		MessageHistoryResponse: newMessageHistoryResponse(thread.Replies, limit),
 	})
 }
+
+// parseHistoryPage reads the ?before= and ?limit= paging parameters. On failure an error
+// response is written and ok is false.
+func parseHistoryPage(w http.ResponseWriter, r *http.Request) (before time.Time, limit int, ok bool) {
+	query := r.URL.Query()
+	if value := query.Get("before"); value != "" {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_before", "before must be an RFC 3339 timestamp")
+			return time.Time{}, 0, false
+		}
+		before = t
+	}
+
+	limit = store.DefaultPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > store.MaxPageSize {
+			writeError(w, r, http.StatusBadRequest, "invalid_limit", fmt.Sprintf("limit must be between 1 and %d", store.MaxPageSize))
+			return time.Time{}, 0, false
+		}
+		limit = n
+	}
+	return before, limit, true
+}
+
+// newMessageHistoryResponse wraps a page of messages, pointing at the next page when it's full
+func newMessageHistoryResponse(messages []*store.Message, limit int) MessageHistoryResponse {
+	resp := MessageHistoryResponse{Messages: messages, Count: len(messages)}
+	if resp.Messages == nil {
+		resp.Messages = []*store.Message{}
+	}
+	if len(messages) == limit {
+		resp.Before = messages[len(messages)-1].CreatedAt.Format(time.RFC3339Nano)
+	}
+	return resp
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendMessageRequestBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"content", `{"to":"u2","content":"hi"}`, http.StatusOK},
+		{"message", `{"to":"u2","message":{"schemaVersion":2,"text":"hi","extra":true}}`, http.StatusOK},
+		{"content and message", `{"to":"u2","content":"hi","message":{"text":"hi"}}`, http.StatusBadRequest},
+		{"empty content and message", `{"to":"u2","content":"","message":{"text":"hi"}}`, http.StatusBadRequest},
+		{"blank content and message", `{"to":"u2","content":"   ","message":{"text":"hi"}}`, http.StatusBadRequest},
+		{"blank content", `{"to":"u2","content":"   "}`, http.StatusBadRequest},
+		{"neither", `{"to":"u2"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/messages/send", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			var req SendMessageRequest
+			if decodeJSONBody(w, r, &req) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/clienterrors"
+	"api-service/internal/middleware"
+)
+
+// ClientErrorHandler accepts error reports from authenticated frontends
+type ClientErrorHandler struct {
+	aggregator *clienterrors.Aggregator
+}
+
+// NewClientErrorHandler creates a new client error handler
+func NewClientErrorHandler(aggregator *clienterrors.Aggregator) *ClientErrorHandler {
+	return &ClientErrorHandler{
+		aggregator: aggregator,
+	}
+}
+
+// ClientErrorRequest represents a client error report
+type ClientErrorRequest struct {
+	Kind       string `json:"kind" validate:"required,oneof=js_error ws_disconnect api_error"`
+	AppVersion string `json:"appVersion" validate:"trim,required,pattern=version"`
+	Message    string `json:"message"`
+	Stack      string `json:"stack,omitempty"`
+	CloseCode  int    `json:"closeCode,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+// ServeHTTP handles POST /api/client-errors
+func (h *ClientErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	var req ClientErrorRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	h.aggregator.Record(clienterrors.Report{
+		Kind:       req.Kind,
+		AppVersion: req.AppVersion,
+		TenantID:   user.TenantID,
+		Message:    req.Message,
+		Stack:      req.Stack,
+		CloseCode:  req.CloseCode,
+		URL:        req.URL,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
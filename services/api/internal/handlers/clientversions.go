@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/clientversion"
+	"api-service/internal/middleware"
+	"api-service/internal/tenants"
+)
+
+// ClientVersionHandler manages per-tenant client version policies
+type ClientVersionHandler struct {
+	versions *clientversion.Service
+	registry *tenants.Registry
+}
+
+// NewClientVersionHandler creates a new client version handler
+func NewClientVersionHandler(versions *clientversion.Service, registry *tenants.Registry) *ClientVersionHandler {
+	return &ClientVersionHandler{
+		versions: versions,
+		registry: registry,
+	}
+}
+
+// ClientVersionPolicyRequest sets a tenant's client version policy
+type ClientVersionPolicyRequest struct {
+	Minimum           string `json:"minimum,omitempty" validate:"trim,pattern=version"`
+	Recommended       string `json:"recommended,omitempty" validate:"trim,pattern=version"`
+	UpgradeURL        string `json:"upgradeUrl,omitempty" validate:"trim,max=2048"`
+	RejectUnversioned bool   `json:"rejectUnversioned,omitempty"`
+}
+
+// ClientVersionPolicyResponse shows the policy that applies to a tenant's clients
+type ClientVersionPolicyResponse struct {
+	TenantID  string                      `json:"tenantId"`
+	Policy    tenants.ClientVersionPolicy `json:"policy"`
+	IsDefault bool                        `json:"isDefault"`          // No tenant policy; the service-wide default applies
+	Upgraded  int                         `json:"upgraded,omitempty"` // Connected clients forced to upgrade by this change
+}
+
+// Get handles GET /api/admin/tenants/{id}/client-versions
+func (h *ClientVersionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.registry.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "tenant_not_found", "Tenant not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.response(tenant, 0))
+}
+
+// Put handles PUT /api/admin/tenants/{id}/client-versions. Connected clients below the new
+// minimum are sent a required client_upgrade event and disconnected.
+func (h *ClientVersionHandler) Put(w http.ResponseWriter, r *http.Request) {
+	var req ClientVersionPolicyRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	h.set(w, r, &tenants.ClientVersionPolicy{
+		Minimum:           req.Minimum,
+		Recommended:       req.Recommended,
+		UpgradeURL:        req.UpgradeURL,
+		RejectUnversioned: req.RejectUnversioned,
+	})
+}
+
+// Delete handles DELETE /api/admin/tenants/{id}/client-versions, restoring the default policy
+func (h *ClientVersionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	h.set(w, r, nil)
+}
+
+func (h *ClientVersionHandler) set(w http.ResponseWriter, r *http.Request, policy *tenants.ClientVersionPolicy) {
+	tenant, upgraded, err := h.versions.SetTenantPolicy(r.Context(), r.PathValue("id"), policy)
+	if errors.Is(err, tenants.ErrTenantNotFound) {
+		writeError(w, r, http.StatusNotFound, "tenant_not_found", "Tenant not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_client_version_policy", err.Error())
+		return
+	}
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Client version policy of tenant %s updated by %s (%s); %d clients forced to upgrade", tenant.ID, admin.Email, admin.ID, upgraded)
+	}
+
+	writeJSON(w, http.StatusOK, h.response(tenant, upgraded))
+}
+
+func (h *ClientVersionHandler) response(tenant *tenants.Tenant, upgraded int) ClientVersionPolicyResponse {
+	return ClientVersionPolicyResponse{
+		TenantID:  tenant.ID,
+		Policy:    h.versions.PolicyFor(tenant.ID),
+		IsDefault: tenant.ClientVersions == nil,
+		Upgraded:  upgraded,
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/config"
+)
+
+// ConfigHandler shows admins the effective configuration of the answering replica, to debug
+// configuration drift between environments and replicas
+type ConfigHandler struct {
+	cfg        *config.Config
+	instanceID string
+}
+
+// NewConfigHandler creates a new config handler
+func NewConfigHandler(cfg *config.Config, instanceID string) *ConfigHandler {
+	return &ConfigHandler{
+		cfg:        cfg,
+		instanceID: instanceID,
+	}
+}
+
+// ConfigResponse is the effective configuration of a replica
+type ConfigResponse struct {
+	Instance    string           `json:"instance"`
+	Environment string           `json:"environment"`
+	Settings    []config.Setting `json:"settings"`
+}
+
+// ServeHTTP handles GET /api/admin/config
+func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ConfigResponse{
+		Instance:    h.instanceID,
+		Environment: h.cfg.Environment,
+		Settings:    h.cfg.Settings(),
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+)
+
+// ConversationsResponse lists the caller's conversations, most recently active first
+type ConversationsResponse struct {
+	Conversations []*chat.Conversation `json:"conversations"`
+	Count         int                  `json:"count"`
+}
+
+// ListConversations handles GET /api/conversations
+func (h *ChatHandler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	conversations, err := h.chat.Conversations(r.Context(), user)
+	if err != nil {
+		log.Printf("Listing conversations failed: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "messages_unavailable", "Messages are temporarily unavailable")
+		return
+	}
+	if conversations == nil {
+		conversations = []*chat.Conversation{}
+	}
+	writeJSON(w, http.StatusOK, ConversationsResponse{Conversations: conversations, Count: len(conversations)})
+}
+
+// MarkRead handles POST /api/messages/{id}/read
+func (h *ChatHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	err := h.chat.MarkRead(r.Context(), user, r.PathValue("id"))
+	switch {
+	case errors.Is(err, chat.ErrMessageNotFound):
+		writeError(w, r, http.StatusNotFound, "message_not_found", "Message not found")
+	case err != nil:
+		log.Printf("Marking message read failed: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "messages_unavailable", "Messages are temporarily unavailable")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/deadletter"
+	"api-service/internal/middleware"
+	"api-service/internal/webhooks"
+)
+
+// DeadLetterHandler lets admins inspect, redrive and discard what failed delivery for good
+type DeadLetterHandler struct {
+	letters *deadletter.Queue
+}
+
+// NewDeadLetterHandler creates a new dead letter handler
+func NewDeadLetterHandler(letters *deadletter.Queue) *DeadLetterHandler {
+	return &DeadLetterHandler{letters: letters}
+}
+
+// DeadLetterListResponse lists dead letters
+type DeadLetterListResponse struct {
+	DeadLetters []deadletter.Letter `json:"deadLetters"`
+}
+
+// List handles GET /api/admin/deadletters, the dead letters (every replica's when persisted), newest first,
+// optionally only a source's (?source=webhooks, offline or backplane) or a target's (?target=)
+func (h *DeadLetterHandler) List(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	switch source {
+	case "", deadletter.SourceWebhooks, deadletter.SourceOffline, deadletter.SourceBackplane:
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid_source", "source must be webhooks, offline or backplane")
+		return
+	}
+	writeJSON(w, http.StatusOK, DeadLetterListResponse{
+		DeadLetters: h.letters.List(deadletter.Filter{Source: source, Target: r.URL.Query().Get("target")}),
+	})
+}
+
+// Redrive handles POST /api/admin/deadletters/{id}/redrive, handing a dead letter back to the
+// component that gave up on it. A letter that can't be redriven is kept.
+func (h *DeadLetterHandler) Redrive(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	id := r.PathValue("id")
+	err := h.letters.Redrive(r.Context(), id)
+	switch {
+	case errors.Is(err, deadletter.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "dead_letter_not_found", "Dead letter not found")
+		return
+	case errors.Is(err, webhooks.ErrWebhookNotFound):
+		writeError(w, r, http.StatusConflict, "webhook_not_found", "The dead letter's webhook was deleted")
+		return
+	case err != nil:
+		log.Printf("Failed to redrive dead letter %s: %v", id, err)
+		writeError(w, r, http.StatusServiceUnavailable, "redrive_failed", "The dead letter could not be redriven and was kept")
+		return
+	}
+
+	log.Printf("Dead letter %s redriven by %s (%s)", id, admin.Email, admin.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Delete handles DELETE /api/admin/deadletters/{id}, discarding a dead letter
+func (h *DeadLetterHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.letters.Delete(r.Context(), id)
+	switch {
+	case errors.Is(err, deadletter.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "dead_letter_not_found", "Dead letter not found")
+		return
+	case err != nil:
+		log.Printf("Failed to delete dead letter %s: %v", id, err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Failed to delete the dead letter")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/middleware"
+	"api-service/internal/notificationhubs"
+	"api-service/internal/store"
+)
+
+// DeviceHandler lets users register the mobile devices they want push notifications on
+type DeviceHandler struct {
+	dispatcher *notificationhubs.Dispatcher
+}
+
+// NewDeviceHandler creates a new device handler
+func NewDeviceHandler(dispatcher *notificationhubs.Dispatcher) *DeviceHandler {
+	return &DeviceHandler{dispatcher: dispatcher}
+}
+
+// RegisterDeviceRequest registers a device's push token
+type RegisterDeviceRequest struct {
+	Platform string `json:"platform" validate:"trim,required,oneof=fcm apns"`
+	Token    string `json:"token" validate:"trim,required,max=4096"`
+	Name     string `json:"name,omitempty" validate:"trim,max=100"` // E.g. "Ada's iPhone"
+}
+
+// DevicesResponse lists the caller's devices
+type DevicesResponse struct {
+	Devices []*store.Device `json:"devices"`
+}
+
+// Register handles POST /api/devices
+func (h *DeviceHandler) Register(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req RegisterDeviceRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	device, err := h.dispatcher.Register(r.Context(), user, req.Platform, req.Token, req.Name)
+	switch {
+	case errors.Is(err, notificationhubs.ErrInvalidDevice):
+		writeError(w, r, http.StatusBadRequest, "invalid_device", err.Error())
+	case errors.Is(err, notificationhubs.ErrTooManyDevices):
+		writeError(w, r, http.StatusConflict, "too_many_devices", err.Error())
+	case err != nil:
+		log.Printf("Failed to register device of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "devices_unavailable", "Device registration is temporarily unavailable")
+	default:
+		writeJSON(w, http.StatusCreated, device)
+	}
+}
+
+// List handles GET /api/devices
+func (h *DeviceHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	devices, err := h.dispatcher.Devices(r.Context(), user)
+	if err != nil {
+		log.Printf("Failed to list devices of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "devices_unavailable", "Device registration is temporarily unavailable")
+		return
+	}
+	if devices == nil {
+		devices = []*store.Device{}
+	}
+	writeJSON(w, http.StatusOK, DevicesResponse{Devices: devices})
+}
+
+// Unregister handles DELETE /api/devices/{id}
+func (h *DeviceHandler) Unregister(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	err := h.dispatcher.Unregister(r.Context(), user, r.PathValue("id"))
+	switch {
+	case errors.Is(err, notificationhubs.ErrDeviceNotFound):
+		writeError(w, r, http.StatusNotFound, "device_not_found", "Device not found")
+	case err != nil:
+		log.Printf("Failed to unregister device of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "devices_unavailable", "Device registration is temporarily unavailable")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/usage"
+	"api-service/internal/validate"
+)
+
+// EditMessageRequest replaces a message's content
+type EditMessageRequest struct {
+	Content *string                `json:"content,omitempty" validate:"trim"`
+	Message *models.MessageContent `json:"message,omitempty"`
+}
+
+// Validate requires exactly one non-empty body and enforces the message length limit
+func (req *EditMessageRequest) Validate(errs *validate.Errors) {
+	validateMessageBody(errs, req.Content, req.Message)
+}
+
+// EditMessage handles PATCH /api/messages/{id}, returning the updated message
+func (h *ChatHandler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req EditMessageRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	message := req.Message
+	if message == nil {
+		message = models.NewMessageContent(*req.Content)
+	}
+
+	updated, err := h.chat.EditMessage(r.Context(), user, r.PathValue("id"), message)
+	if err != nil {
+		writeMessageChangeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteMessage handles DELETE /api/messages/{id}
+func (h *ChatHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	if _, err := h.chat.DeleteMessage(r.Context(), user, r.PathValue("id")); err != nil {
+		writeMessageChangeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMessageChangeError maps an edit or delete error to a problem response
+func writeMessageChangeError(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *usage.QuotaError
+	var rejectedErr *moderation.RejectedError
+	switch {
+	case errors.As(err, &quotaErr):
+		writeQuotaError(w, r, quotaErr)
+	case errors.As(err, &rejectedErr):
+		writeRejectedError(w, r, rejectedErr)
+	case errors.Is(err, chat.ErrMessageNotFound):
+		writeError(w, r, http.StatusNotFound, "message_not_found", "Message not found")
+	case errors.Is(err, chat.ErrNotSender):
+		writeError(w, r, http.StatusForbidden, "not_message_sender", "Only the sender or an admin can change this message")
+	case errors.Is(err, chat.ErrMessageDeleted):
+		writeError(w, r, http.StatusConflict, "message_deleted", "Message was deleted")
+	case errors.Is(err, chat.ErrTenantReadOnly):
+		writeError(w, r, http.StatusForbidden, "tenant_read_only", "Tenant is frozen and read-only")
+	default:
+		log.Printf("Message change failed: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "messages_unavailable", "Messages are temporarily unavailable")
+	}
+}
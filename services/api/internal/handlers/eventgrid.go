@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"api-service/internal/eventgrid"
+)
+
+// EventGridKeyHeader carries the key of an Event Grid subscription's deliveries, set as a
+// static delivery header (or sent as ?key= in the endpoint URL)
+const EventGridKeyHeader = "X-Event-Grid-Key"
+
+// EventGridHandler receives deliveries from Event Grid subscriptions, answering their
+// validation handshakes
+type EventGridHandler struct {
+	receiver *eventgrid.Receiver
+	key      string
+}
+
+// NewEventGridHandler creates a new Event Grid handler; deliveries must carry the key
+func NewEventGridHandler(receiver *eventgrid.Receiver, key string) *EventGridHandler {
+	return &EventGridHandler{
+		receiver: receiver,
+		key:      key,
+	}
+}
+
+// EventGridValidationResponse completes the Event Grid schema's subscription validation
+type EventGridValidationResponse struct {
+	ValidationResponse string `json:"validationResponse"`
+}
+
+// EventGridDeliveryResponse reports what became of a delivery's events
+type EventGridDeliveryResponse struct {
+	Received  int `json:"received"`
+	Delivered int `json:"delivered"` // Routed to a topic
+}
+
+// Validate handles OPTIONS /api/eventgrid/events, the CloudEvents webhook validation
+// handshake: the requesting origin is allowed to deliver events
+func (h *EventGridHandler) Validate(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeError(w, r, http.StatusUnauthorized, "invalid_key", "Missing or invalid Event Grid key")
+		return
+	}
+	origin := r.Header.Get("WebHook-Request-Origin")
+	if origin == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_origin", "WebHook-Request-Origin header is required")
+		return
+	}
+	w.Header().Set("WebHook-Allowed-Origin", origin)
+	w.Header().Set("WebHook-Allowed-Rate", "*")
+	w.WriteHeader(http.StatusOK)
+}
+
+// Deliver handles POST /api/eventgrid/events: events in the Event Grid schema (including the
+// SubscriptionValidationEvent) or the CloudEvents v1.0 schema
+func (h *EventGridHandler) Deliver(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeError(w, r, http.StatusUnauthorized, "invalid_key", "Missing or invalid Event Grid key")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Could not read the request body")
+		return
+	}
+
+	delivery, err := eventgrid.DecodeDelivery(r.Header, body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_events", err.Error())
+		return
+	}
+	if delivery.ValidationCode != "" {
+		log.Printf("📥 Event Grid subscription validated")
+		writeJSON(w, http.StatusOK, EventGridValidationResponse{ValidationResponse: delivery.ValidationCode})
+		return
+	}
+
+	response := EventGridDeliveryResponse{Received: len(delivery.Events)}
+	for _, event := range delivery.Events {
+		if h.receiver.Deliver(event) {
+			response.Delivered++
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// authorized reports whether the request carries the key, compared in constant time
+func (h *EventGridHandler) authorized(r *http.Request) bool {
+	key := r.Header.Get(EventGridKeyHeader)
+	if key == "" {
+		key = r.URL.Query().Get("key")
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(h.key)) == 1
+}
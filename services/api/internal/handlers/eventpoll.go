@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"api-service/internal/longpoll"
+	"api-service/internal/middleware"
+)
+
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 30 * time.Second
+)
+
+// EventPollHandler delivers realtime events by long-polling, the fallback for networks that
+// allow neither WebSockets nor SSE
+type EventPollHandler struct {
+	poller *longpoll.Poller
+}
+
+// NewEventPollHandler creates a new long-poll handler
+func NewEventPollHandler(poller *longpoll.Poller) *EventPollHandler {
+	return &EventPollHandler{
+		poller: poller,
+	}
+}
+
+// ServeHTTP handles GET /api/events/poll. The request is held open until events arrive or
+// ?timeout= (default 25s, max 30s) elapses; pass the returned cursor on the next poll.
+func (h *EventPollHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	wait := defaultPollWait
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_timeout", "timeout must be a duration such as 25s")
+			return
+		}
+		wait = min(d, maxPollWait)
+	}
+
+	// The wait may outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 5*time.Second))
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, h.poller.Poll(r.Context(), user, r.URL.Query().Get("cursor"), wait))
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/events"
+)
+
+// EventSchemaHandler describes the payload schemas of realtime events
+type EventSchemaHandler struct {
+	manager *events.Manager
+}
+
+// NewEventSchemaHandler creates a new event schema handler
+func NewEventSchemaHandler(manager *events.Manager) *EventSchemaHandler {
+	return &EventSchemaHandler{
+		manager: manager,
+	}
+}
+
+// EventSchemasResponse lists the payload fields of each event type and the schema version
+// that added them
+type EventSchemasResponse struct {
+	Current int                    `json:"current"` // Newest schema version
+	Compat  bool                   `json:"compat"`  // Older clients receive downgraded payloads
+	Schemas []events.PayloadSchema `json:"schemas"`
+
+	ApplicationTypes []events.EventType `json:"applicationTypes"` // Event types registered by other packages
+}
+
+// ServeHTTP handles GET /api/events/schemas
+func (h *EventSchemaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, EventSchemasResponse{
+		Current: events.EventSchemaVersion,
+		Compat:  h.manager.SchemaCompat(),
+		Schemas: events.PayloadSchemas(),
+
+		ApplicationTypes: events.RegisteredTypes(),
+	})
+}
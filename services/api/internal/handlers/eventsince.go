@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+)
+
+// EventSinceHandler lets WebSocket clients backfill gaps in the sequence numbers of their
+// events without reconnecting
+type EventSinceHandler struct {
+	manager *events.Manager
+}
+
+// NewEventSinceHandler creates a new backfill handler
+func NewEventSinceHandler(manager *events.Manager) *EventSinceHandler {
+	return &EventSinceHandler{
+		manager: manager,
+	}
+}
+
+// EventsSinceResponse lists the events of a WebSocket session after a sequence number
+type EventsSinceResponse struct {
+	Events []json.RawMessage `json:"events"` // Encoded as on the WebSocket, seq included
+	Seq    int64             `json:"seq"`    // Last sequence number of the session
+}
+
+// ServeHTTP handles GET /api/events/since/{seq}
+func (h *EventSinceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	seq, err := strconv.ParseInt(r.PathValue("seq"), 10, 64)
+	if err != nil || seq < 0 {
+		writeError(w, r, http.StatusBadRequest, "invalid_seq", "seq must be a non-negative integer")
+		return
+	}
+
+	frames, last, err := h.manager.EventsSince(user.ID, seq)
+	switch {
+	case errors.Is(err, events.ErrNoSession):
+		writeError(w, r, http.StatusNotFound, "session_not_found", "You have no WebSocket session on this replica")
+		return
+	case errors.Is(err, events.ErrSeqAhead):
+		writeError(w, r, http.StatusBadRequest, "invalid_seq", "seq is ahead of the session's last sequence number")
+		return
+	case errors.Is(err, events.ErrBinarySession):
+		writeError(w, r, http.StatusConflict, "binary_session", "Your session uses a binary event encoding; resume it to replay missed events")
+		return
+	case errors.Is(err, events.ErrEventsExpired):
+		writeError(w, r, http.StatusGone, "events_expired", "The missed events are no longer buffered; refetch the message history instead")
+		return
+	}
+
+	resp := EventsSinceResponse{Events: make([]json.RawMessage, len(frames)), Seq: last}
+	for i, frame := range frames {
+		resp.Events[i] = frame
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
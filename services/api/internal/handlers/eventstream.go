@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"api-service/internal/chat"
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+)
+
+// sseHeartbeatInterval keeps idle streams alive through proxies that drop quiet connections
+const sseHeartbeatInterval = 20 * time.Second
+
+// EventStreamHandler delivers realtime events over Server-Sent Events, for clients behind
+// proxies that block WebSockets. Streams are registered with the event manager like
+// WebSocket connections, so both transports share fan-out.
+type EventStreamHandler struct {
+	chat   *chat.Service
+	replay *events.ReplayBuffer
+}
+
+// NewEventStreamHandler creates a new SSE handler
+func NewEventStreamHandler(chatService *chat.Service, replay *events.ReplayBuffer) *EventStreamHandler {
+	return &EventStreamHandler{
+		chat:   chatService,
+		replay: replay,
+	}
+}
+
+// ServeHTTP handles GET /api/events/stream. Events are sent in the v2 envelope with their ID
+// as the SSE event ID; reconnecting with Last-Event-ID replays events the client missed.
+func (h *EventStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("SSE: could not clear write deadline: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx-style proxies
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	stream, unsubscribe := h.chat.Subscribe(user)
+	defer unsubscribe()
+
+	// EventSource sends Last-Event-ID itself; ?lastEventId= covers polyfills that can't
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	if lastEventID != "" {
+		missed, found := h.replay.Since(user.ID, lastEventID)
+		if !found {
+			log.Printf("SSE: cannot resume %s (%s) after event %s; history expired", user.Name, user.ID, lastEventID)
+		}
+		for _, data := range missed {
+			writeSSEEvent(w, data)
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("SSE: streaming not supported: %v", err)
+		return
+	}
+
+	log.Printf("SSE stream connected: %s (%s)", user.Name, user.ID)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("SSE stream disconnected: %s (%s)", user.Name, user.ID)
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case data, ok := <-stream:
+			if !ok {
+				return
+			}
+			// Recorded before writing so an event lost with the connection can be replayed
+			h.replay.Record(user.ID, eventID(data), data)
+			writeSSEEvent(w, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes one encoded (v2) event as an SSE message
+func writeSSEEvent(w http.ResponseWriter, data []byte) {
+	if id := eventID(data); id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// eventID extracts the ID of a v2-encoded event
+func eventID(data []byte) string {
+	var envelope struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(data, &envelope)
+	return envelope.ID
+}
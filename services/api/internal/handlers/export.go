@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+	"api-service/internal/store"
+)
+
+// exportColumns is the header row of CSV exports. Revisions and attachments are JSON arrays;
+// the attachments manifest lists each file's ID, name, content type, size and thumbnails.
+var exportColumns = []string{
+	"id", "conversationId", "parentMessageId", "senderId", "senderName", "recipientId", "tenantId",
+	"createdAt", "editedAt", "deletedAt", "deletedBy", "text", "revisions", "attachments",
+}
+
+// exportWriteTimeout bounds the write of each exported message. Extending the deadline as the
+// export progresses lets large exports outlive the server's write timeout, while a stalled
+// client still fails the export.
+const exportWriteTimeout = 30 * time.Second
+
+// ExportHandler serves compliance exports of whole conversations
+type ExportHandler struct {
+	chat     *chat.Service
+	auditLog audit.Log
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(service *chat.Service, auditLog audit.Log) *ExportHandler {
+	return &ExportHandler{
+		chat:     service,
+		auditLog: auditLog,
+	}
+}
+
+// messageWriter streams exported messages in one format
+type messageWriter interface {
+	Write(msg *store.Message) error
+	Close() error
+}
+
+// Export handles GET /api/conversations/{id}/export?format=json|csv, streaming every message
+// of a conversation of the caller's tenant, thread replies and deleted messages included,
+// oldest first, as a file download. Every export is audited.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeError(w, r, http.StatusBadRequest, "invalid_format", "format must be json or csv")
+		return
+	}
+
+	conversationID := r.PathValue("id")
+	rec := audit.Record{
+		Action:   "conversation.export",
+		Actor:    user.ID,
+		TenantID: user.TenantID,
+		Target:   conversationID,
+		Details:  map[string]interface{}{"format": format},
+	}
+
+	// The response starts with the first message, so that a conversation that can't be
+	// exported still gets an error response
+	var out messageWriter
+	start := func() {
+		fileName := "conversation-" + strings.ReplaceAll(conversationID, ":", "-") + "." + format
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			out = newCSVMessageWriter(w)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			out = newJSONMessageWriter(w, conversationID)
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	count := 0
+	err := h.chat.Export(r.Context(), user, conversationID, func(msg *store.Message) error {
+		if out == nil {
+			start()
+		}
+		rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		count++
+		return out.Write(msg)
+	})
+	if err == nil {
+		if out == nil {
+			start()
+		}
+		err = out.Close()
+	}
+	rec.Details["messages"] = count
+
+	switch {
+	case errors.Is(err, chat.ErrConversationNotFound):
+		rec.Outcome = "not_found"
+		h.auditLog.Record(rec)
+		writeError(w, r, http.StatusNotFound, "conversation_not_found", "Conversation not found")
+	case err != nil:
+		rec.Outcome = "failed"
+		h.auditLog.Record(rec)
+		log.Printf("Exporting conversation %s failed after %d messages: %v", conversationID, count, err)
+		if out == nil {
+			writeError(w, r, http.StatusServiceUnavailable, "messages_unavailable", "Messages are temporarily unavailable")
+			return
+		}
+		// Abort the response so the client sees the download is incomplete
+		panic(http.ErrAbortHandler)
+	default:
+		rec.Outcome = "success"
+		h.auditLog.Record(rec)
+		log.Printf("Conversation %s exported as %s by %s (%s): %d messages", conversationID, format, user.Email, user.ID, count)
+	}
+}
+
+// jsonMessageWriter writes an object with the conversation ID, export time and messages
+type jsonMessageWriter struct {
+	w     io.Writer
+	count int
+	err   error
+}
+
+// newJSONMessageWriter writes the start of the object
+func newJSONMessageWriter(w io.Writer, conversationID string) *jsonMessageWriter {
+	jw := &jsonMessageWriter{w: w}
+	header, _ := json.Marshal(map[string]interface{}{
+		"conversationId": conversationID,
+		"exportedAt":     time.Now().UTC(),
+	})
+	// Leave the object open to append the messages array to
+	jw.write(header[:len(header)-1], []byte(`,"messages":[`))
+	return jw
+}
+
+// Write appends a message to the array
+func (jw *jsonMessageWriter) Write(msg *store.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if jw.count > 0 {
+		jw.write([]byte(","))
+	}
+	jw.count++
+	jw.write([]byte("\n"), data)
+	return jw.err
+}
+
+// Close ends the array and the object with the message count
+func (jw *jsonMessageWriter) Close() error {
+	count, _ := json.Marshal(jw.count)
+	jw.write([]byte("\n],\"count\":"), count, []byte("}\n"))
+	return jw.err
+}
+
+// write writes chunks until one fails
+func (jw *jsonMessageWriter) write(chunks ...[]byte) {
+	for _, chunk := range chunks {
+		if jw.err == nil {
+			_, jw.err = jw.w.Write(chunk)
+		}
+	}
+}
+
+// csvMessageWriter writes a header row then a row per message
+type csvMessageWriter struct {
+	w *csv.Writer
+}
+
+// newCSVMessageWriter writes the header row
+func newCSVMessageWriter(w io.Writer) *csvMessageWriter {
+	cw := &csvMessageWriter{w: csv.NewWriter(w)}
+	cw.w.Write(exportColumns)
+	return cw
+}
+
+// Write writes a message's row
+func (cw *csvMessageWriter) Write(msg *store.Message) error {
+	var text string
+	if msg.Message != nil {
+		text = msg.Message.Text
+	}
+	revisions, err := json.Marshal(msg.Revisions)
+	if err != nil {
+		return err
+	}
+	attachments, err := json.Marshal(msg.Attachments)
+	if err != nil {
+		return err
+	}
+	return cw.w.Write([]string{
+		msg.ID, msg.ConversationID, msg.ParentID, msg.SenderID, msg.SenderName, msg.RecipientID, msg.TenantID,
+		formatExportTime(&msg.CreatedAt), formatExportTime(msg.EditedAt), formatExportTime(msg.DeletedAt), msg.DeletedBy,
+		text, jsonArray(revisions), jsonArray(attachments),
+	})
+}
+
+// Close flushes the rows buffered
+func (cw *csvMessageWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// formatExportTime formats an optional time as RFC 3339 in UTC
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// jsonArray turns an encoded nil slice into an empty array
+func jsonArray(data []byte) string {
+	if string(data) == "null" {
+		return "[]"
+	}
+	return string(data)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/features"
+	"api-service/internal/middleware"
+)
+
+// FeatureHandler tells clients which features are on for them, so they can hide those that
+// aren't rolled out to them yet
+type FeatureHandler struct {
+	flags *features.Set
+}
+
+// NewFeatureHandler creates a new feature handler
+func NewFeatureHandler(flags *features.Set) *FeatureHandler {
+	return &FeatureHandler{
+		flags: flags,
+	}
+}
+
+// FeaturesResponse lists the feature flags
+type FeaturesResponse struct {
+	Features map[string]bool `json:"features"` // Flag -> on for the caller
+}
+
+// ServeHTTP handles GET /api/features
+func (h *FeatureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUserFromContext(r.Context())
+	writeJSON(w, http.StatusOK, FeaturesResponse{Features: h.flags.Evaluate(user)})
+}
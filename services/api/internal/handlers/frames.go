@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"api-service/internal/chat"
+	"api-service/internal/events"
+	"api-service/internal/features"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/rooms"
+	"api-service/internal/usage"
+	"api-service/internal/validate"
+)
+
+// FrameHandler handles chat frames sent over the WebSocket, so interactive clients don't need
+// a REST call per message or keystroke
+type FrameHandler struct {
+	events   EventPublisher
+	chat     *chat.Service
+	rooms    *rooms.Service
+	features *features.Set
+}
+
+// NewFrameHandler creates a new frame handler; frames to rooms are refused to users the rooms
+// feature flag is off for
+func NewFrameHandler(publisher EventPublisher, chatService *chat.Service, roomService *rooms.Service, flags *features.Set) *FrameHandler {
+	return &FrameHandler{
+		events:   publisher,
+		chat:     chatService,
+		rooms:    roomService,
+		features: flags,
+	}
+}
+
+// Register adds the send_chat and typing frame handlers to the manager
+func (h *FrameHandler) Register(manager *events.Manager) {
+	manager.HandleFrame("send_chat", h.SendChat)
+	manager.HandleFrame("typing", h.Typing)
+}
+
+// SendChatFrame is the payload of a send_chat frame: a message to a user ("to") or a room
+// ("roomId"), as plain-text "content" or a versioned "message" body
+type SendChatFrame struct {
+	To              string                 `json:"to,omitempty" validate:"trim,pattern=id"`
+	RoomID          string                 `json:"roomId,omitempty" validate:"trim,pattern=id"`
+	Content         *string                `json:"content,omitempty" validate:"trim"`
+	Message         *models.MessageContent `json:"message,omitempty"`
+	ParentMessageID string                 `json:"parentMessageId,omitempty" validate:"trim,pattern=id"` // Reply in this message's thread
+}
+
+// Validate requires exactly one recipient and one non-empty body
+func (f *SendChatFrame) Validate(errs *validate.Errors) {
+	validateFrameRecipient(errs, f.To, f.RoomID)
+	validateMessageBody(errs, f.Content, f.Message)
+}
+
+// TypingFrame is the payload of a typing frame, sent when the user starts and stops typing
+// to a user ("to") or in a room ("roomId")
+type TypingFrame struct {
+	To     string `json:"to,omitempty" validate:"trim,pattern=id"`
+	RoomID string `json:"roomId,omitempty" validate:"trim,pattern=id"`
+	Typing bool   `json:"typing"`
+}
+
+// Validate requires exactly one recipient
+func (f *TypingFrame) Validate(errs *validate.Errors) {
+	validateFrameRecipient(errs, f.To, f.RoomID)
+}
+
+// validateFrameRecipient requires exactly one of a user or a room
+func validateFrameRecipient(errs *validate.Errors, to, roomID string) {
+	switch {
+	case to != "" && roomID != "":
+		errs.Add("to", "send to either 'to' or 'roomId', not both")
+	case to == "" && roomID == "":
+		errs.Add("to", "'to' or 'roomId' is required")
+	}
+}
+
+// SendChat handles send_chat frames, replying with a frame_result carrying the message ID
+func (h *FrameHandler) SendChat(client *events.Client, frame events.InboundFrame) error {
+	var req SendChatFrame
+	if err := decodeFrame(frame, &req); err != nil {
+		return err
+	}
+	message := req.Message
+	if message == nil {
+		message = models.NewMessageContent(*req.Content)
+	}
+
+	ctx := context.Background()
+	sender := client.Identity()
+	if req.RoomID != "" {
+		if !h.features.EnabledFor(features.Rooms, sender) {
+			return roomsDisabledFrameError()
+		}
+		delivery, err := h.rooms.SendMessage(ctx, sender, req.RoomID, message, req.ParentMessageID)
+		if err != nil {
+			return chatFrameError(err)
+		}
+		h.events.ReplyFrame(client, frame, delivery)
+		return nil
+	}
+
+	messageID, err := h.chat.SendMessage(ctx, sender, req.To, message, req.ParentMessageID)
+	if err != nil {
+		return chatFrameError(err)
+	}
+	h.events.ReplyFrame(client, frame, SendMessageResponse{
+		Success:   true,
+		Message:   "Message sent",
+		MessageID: messageID,
+	})
+	return nil
+}
+
+// Typing handles typing frames; nothing is sent back
+func (h *FrameHandler) Typing(client *events.Client, frame events.InboundFrame) error {
+	var req TypingFrame
+	if err := decodeFrame(frame, &req); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if req.RoomID != "" {
+		if !h.features.EnabledFor(features.Rooms, client.Identity()) {
+			return roomsDisabledFrameError()
+		}
+		return chatFrameError(h.rooms.Typing(ctx, client.Identity(), req.RoomID, req.Typing))
+	}
+	return h.chat.Typing(ctx, client.Identity(), req.To, req.Typing)
+}
+
+// decodeFrame decodes and validates a frame payload, like decodeJSONBody does request bodies
+func decodeFrame(frame events.InboundFrame, dst interface{}) error {
+	if err := json.Unmarshal(frame.Payload, dst); err != nil {
+		return events.NewFrameError("invalid_payload", "Frame payload is not valid JSON for "+frame.Type)
+	}
+	if err := validate.Struct(dst); err != nil {
+		return events.NewFrameError("validation_failed", err.Error())
+	}
+	return nil
+}
+
+// roomsDisabledFrameError refuses a frame to a room from a user the rooms feature is off for
+func roomsDisabledFrameError() error {
+	return events.NewFrameError("feature_disabled", "The "+features.Rooms+" feature isn't enabled for you")
+}
+
+// chatFrameError maps a chat or rooms service error to the frame error with the code the
+// REST API uses for it; other errors (and nil) are returned as is
+func chatFrameError(err error) error {
+	var quotaErr *usage.QuotaError
+	var rejectedErr *moderation.RejectedError
+	switch {
+	case errors.As(err, &quotaErr):
+		return events.NewFrameError("storage_quota_exceeded", fmt.Sprintf("The %s storage quota is exhausted", quotaErr.Scope))
+	case errors.As(err, &rejectedErr):
+		return events.NewFrameError("message_rejected", "Message rejected: "+rejectedErr.Reason)
+	case errors.Is(err, chat.ErrTenantReadOnly):
+		return events.NewFrameError("tenant_read_only", "Tenant is frozen and read-only")
+	case errors.Is(err, chat.ErrParentNotFound):
+		return events.NewFrameError("parent_message_not_found", "Parent message not found in this conversation")
+	case errors.Is(err, chat.ErrRecipientUnavailable):
+		return events.NewFrameError("recipient_unavailable", "User not connected or unreachable")
+	case errors.Is(err, chat.ErrBlocked):
+		return events.NewFrameError("recipient_blocked_sender", "The recipient has blocked you")
+	case errors.Is(err, rooms.ErrRoomNotFound):
+		return events.NewFrameError("room_not_found", "Room not found")
+	case errors.Is(err, rooms.ErrNotMember):
+		return events.NewFrameError("not_room_member", "You are not a member of this room")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+// GraphQLHandler executes GraphQL queries against the service schema
+type GraphQLHandler struct {
+	schema *graphql.Schema
+}
+
+// NewGraphQLHandler creates a new GraphQL handler
+func NewGraphQLHandler(schema *graphql.Schema) *GraphQLHandler {
+	return &GraphQLHandler{
+		schema: schema,
+	}
+}
+
+// GraphQLRequest is a GraphQL-over-HTTP request
+type GraphQLRequest struct {
+	Query         string                 `json:"query" validate:"required"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"` // Accepted for client compatibility; unused
+}
+
+// GraphQLResponse carries the query result; errors (including per-field FORBIDDEN errors)
+// are listed alongside whatever data could be resolved
+type GraphQLResponse struct {
+	Data   map[string]interface{}   `json:"data,omitempty"`
+	Errors []map[string]interface{} `json:"errors,omitempty"`
+}
+
+// ServeHTTP handles POST /api/graphql
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	// Query errors are part of a 200 response, as GraphQL clients expect
+	writeJSON(w, http.StatusOK, h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables))
+}
@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 
+	"api-service/internal/health"
+	"api-service/internal/middleware"
 	"api-service/internal/models"
 )
 
@@ -12,31 +14,39 @@ import (
 type HealthHandler struct {
 	serviceName string
 	version     string
+	checks      *health.Registry
 }
 
-// NewHealthHandler creates a new health handler
-func NewHealthHandler(serviceName, version string) *HealthHandler {
+// NewHealthHandler creates a new health handler reporting the checks in the registry
+func NewHealthHandler(serviceName, version string, checks *health.Registry) *HealthHandler {
 	return &HealthHandler{
 		serviceName: serviceName,
 		version:     version,
+		checks:      checks,
 	}
 }
 
 // ServeHTTP handles the health check endpoint
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	results, healthy := h.checks.Run(r.Context())
 
 	response := models.HealthResponse{
 		Status:  "healthy",
 		Service: h.serviceName,
 		Version: h.version,
+		Checks:  results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		response.Status = "unhealthy"
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding health response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Health check from %s", r.RemoteAddr)
+	log.Printf("Health check from %s", middleware.ClientIP(r))
 }
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+	"api-service/internal/topics"
+	"api-service/internal/validate"
+)
+
+// maxIngestRecipients bounds the users an ingested event is sent to
+const maxIngestRecipients = 1000
+
+// IngestHandler lets backend applications push application events to connected clients
+type IngestHandler struct {
+	manager *events.Manager
+}
+
+// NewIngestHandler creates a new ingest handler
+func NewIngestHandler(manager *events.Manager) *IngestHandler {
+	return &IngestHandler{manager: manager}
+}
+
+// IngestEventRequest is an event envelope: a registered application event type, its payload
+// and exactly one route (users, a topic or everyone)
+type IngestEventRequest struct {
+	Type      events.EventType `json:"type" validate:"trim,required,max=64"`
+	Payload   json.RawMessage  `json:"payload"`
+	UserIDs   []string         `json:"userIds,omitempty"`                  // Send to these users
+	Topic     string           `json:"topic,omitempty" validate:"trim"`    // Or to this topic's subscribers
+	TenantID  string           `json:"tenantId,omitempty" validate:"trim"` // Only the topic's subscribers of this tenant
+	Broadcast bool             `json:"broadcast,omitempty"`                // Or to everyone
+}
+
+// Validate requires a payload, exactly one route and valid user IDs and topic
+func (req *IngestEventRequest) Validate(errs *validate.Errors) {
+	if len(req.Payload) == 0 || bytes.Equal(req.Payload, []byte("null")) {
+		errs.Add("payload", "is required")
+	}
+
+	routes := 0
+	for _, set := range []bool{len(req.UserIDs) > 0, req.Topic != "", req.Broadcast} {
+		if set {
+			routes++
+		}
+	}
+	if routes != 1 {
+		errs.Add("userIds", "set exactly one of 'userIds', 'topic' or 'broadcast'")
+	}
+	if len(req.UserIDs) > maxIngestRecipients {
+		errs.Add("userIds", "must have at most 1000 elements")
+	}
+	idPattern, _ := validate.Pattern("id")
+	for _, userID := range req.UserIDs {
+		if !idPattern.MatchString(userID) {
+			errs.Add("userIds", "contains an invalid user ID")
+			break
+		}
+	}
+	if req.Topic != "" {
+		if err := topics.ValidateTopic(req.Topic); err != nil {
+			errs.Add("topic", err.Error())
+		}
+	}
+	if req.TenantID != "" && req.Topic == "" {
+		errs.Add("tenantId", "can only be set with 'topic'")
+	}
+}
+
+// IngestEventResponse identifies an ingested event
+type IngestEventResponse struct {
+	EventID string           `json:"eventId"`
+	Type    events.EventType `json:"type"`
+}
+
+// Ingest handles POST /api/events/ingest
+func (h *IngestHandler) Ingest(w http.ResponseWriter, r *http.Request) {
+	caller, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req IngestEventRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	event, err := events.DecodeApplicationEvent(req.Type, req.Payload)
+	if err == nil {
+		event.Topic, event.TenantID = req.Topic, req.TenantID
+		err = h.manager.Publish(r.Context(), event, req.UserIDs...)
+	}
+	switch {
+	case errors.Is(err, events.ErrUnknownEventType):
+		writeError(w, r, http.StatusBadRequest, "unknown_event_type", "Event type "+string(req.Type)+" is not registered")
+	case errors.Is(err, events.ErrInvalidEvent):
+		writeError(w, r, http.StatusBadRequest, "invalid_event", err.Error())
+	case err != nil:
+		log.Printf("Failed to publish ingested %s event from %s: %v", req.Type, caller.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "publish_failed", "The event could not be published")
+	default:
+		writeJSON(w, http.StatusAccepted, IngestEventResponse{EventID: event.ID, Type: event.Type})
+	}
+}
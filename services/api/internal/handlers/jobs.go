@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/jobs"
+)
+
+// JobsHandler exposes the state of singleton background jobs to admins
+type JobsHandler struct {
+	runner     *jobs.Runner
+	instanceID string
+}
+
+// NewJobsHandler creates a new jobs handler
+func NewJobsHandler(runner *jobs.Runner, instanceID string) *JobsHandler {
+	return &JobsHandler{
+		runner:     runner,
+		instanceID: instanceID,
+	}
+}
+
+// ServeHTTP handles GET /api/admin/jobs
+func (h *JobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"instance":    h.instanceID,
+		"lockBackend": h.runner.Backend(),
+		"jobs":        h.runner.Statuses(r.Context()),
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"api-service/internal/problem"
+	"api-service/internal/validate"
+)
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeError writes an RFC 7807 problem response; code identifies the problem type
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	problem.Write(w, r, status, code, detail)
+}
+
+// decodeJSONBody strictly decodes a single JSON object from the request body into dst,
+// then validates it. Unknown fields, trailing data, oversized bodies and invalid fields
+// are rejected. On failure an error response is written and false is returned.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		status, message := describeDecodeError(err)
+		code := "invalid_request_body"
+		if status == http.StatusRequestEntityTooLarge {
+			code = "request_too_large"
+		}
+		writeError(w, r, status, code, message)
+		return false
+	}
+
+	// Reject anything after the first JSON value
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		writeError(w, r, http.StatusBadRequest, "invalid_request_body", "Request body must contain a single JSON object")
+		return false
+	}
+
+	// Apply the DTO's `validate` tags (and Validate method, if any)
+	if err := validate.Struct(dst); err != nil {
+		writeValidationError(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// writeValidationError writes a 400 problem listing each invalid field
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problem.New(r, http.StatusBadRequest, "validation_failed", "One or more fields are invalid")
+
+	var fieldErrors validate.Errors
+	if errors.As(err, &fieldErrors) {
+		for _, fe := range fieldErrors {
+			p.InvalidParams = append(p.InvalidParams, problem.InvalidParam{Name: fe.Field, Reason: fe.Message})
+		}
+	} else {
+		p.Detail = err.Error()
+	}
+	p.Write(w)
+}
+
+// describeDecodeError maps a JSON decoding error to a status code and client-facing message
+func describeDecodeError(err error) (int, string) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit)
+	case errors.As(err, &syntaxErr):
+		return http.StatusBadRequest, fmt.Sprintf("Malformed JSON at position %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "Malformed JSON"
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, fmt.Sprintf("Invalid value for field %q", typeErr.Field)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return http.StatusBadRequest, fmt.Sprintf("Unknown field %s", field)
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, "Request body must not be empty"
+	default:
+		return http.StatusBadRequest, "Invalid request body"
+	}
+}
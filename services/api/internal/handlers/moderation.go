@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/middleware"
+	"api-service/internal/moderation"
+)
+
+// ModerationHandler lets admins review the messages held in the moderation quarantine
+type ModerationHandler struct {
+	quarantine *moderation.Quarantine
+}
+
+// NewModerationHandler creates a new moderation handler
+func NewModerationHandler(quarantine *moderation.Quarantine) *ModerationHandler {
+	return &ModerationHandler{quarantine: quarantine}
+}
+
+// QuarantineResponse lists quarantined messages
+type QuarantineResponse struct {
+	Items []moderation.QuarantineItem `json:"items"`
+}
+
+// List handles GET /api/admin/moderation/quarantine, optionally filtered by ?status=pending,
+// approved or removed
+func (h *ModerationHandler) List(w http.ResponseWriter, r *http.Request) {
+	status := moderation.ReviewStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", moderation.ReviewPending, moderation.ReviewApproved, moderation.ReviewRemoved:
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid_status", "status must be pending, approved or removed")
+		return
+	}
+	writeJSON(w, http.StatusOK, QuarantineResponse{Items: h.quarantine.List(status)})
+}
+
+// Approve handles POST /api/admin/moderation/quarantine/{id}/approve, keeping the message
+func (h *ModerationHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.resolve(w, r, moderation.ReviewApproved)
+}
+
+// Remove handles POST /api/admin/moderation/quarantine/{id}/remove, taking the message down
+func (h *ModerationHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	h.resolve(w, r, moderation.ReviewRemoved)
+}
+
+func (h *ModerationHandler) resolve(w http.ResponseWriter, r *http.Request, status moderation.ReviewStatus) {
+	reviewer, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	item, err := h.quarantine.Resolve(r.Context(), r.PathValue("id"), status, reviewer)
+	switch {
+	case errors.Is(err, moderation.ErrQuarantineItemNotFound):
+		writeError(w, r, http.StatusNotFound, "quarantine_item_not_found", "No quarantined message with this ID")
+		return
+	case errors.Is(err, moderation.ErrAlreadyReviewed):
+		writeError(w, r, http.StatusConflict, "already_reviewed", "The quarantined message was already reviewed")
+		return
+	case err != nil:
+		log.Printf("Failed to remove quarantined message %s: %v", r.PathValue("id"), err)
+		writeError(w, r, http.StatusServiceUnavailable, "moderation_unavailable", "The message could not be removed")
+		return
+	}
+
+	log.Printf("Quarantined message %s %s by %s (%s)", item.Flag.MessageID, status, reviewer.Email, reviewer.ID)
+	writeJSON(w, http.StatusOK, item)
+}
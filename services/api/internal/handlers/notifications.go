@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"api-service/internal/middleware"
+	"api-service/internal/store"
+	"api-service/internal/teams"
+	"api-service/internal/validate"
+	"api-service/internal/webpush"
+)
+
+// clockTime matches HH:MM times of day
+var clockTime = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// NotificationHandler returns the full messages behind push notifications and manages
+// users' notification preferences
+type NotificationHandler struct {
+	inbox       *webpush.Inbox
+	preferences store.PreferenceStore
+	teams       *teams.Notifier // Nil when Teams notifications are disabled
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(inbox *webpush.Inbox, preferences store.PreferenceStore, notifier *teams.Notifier) *NotificationHandler {
+	return &NotificationHandler{
+		inbox:       inbox,
+		preferences: preferences,
+		teams:       notifier,
+	}
+}
+
+// NotificationPreferencesRequest replaces the caller's notification preferences
+type NotificationPreferencesRequest struct {
+	Push        *bool             `json:"push,omitempty"` // On when omitted
+	Email       bool              `json:"email"`
+	Teams       bool              `json:"teams"`
+	TeamsChatID string            `json:"teamsChatId,omitempty" validate:"trim,max=256"` // Required in Graph mode
+	QuietHours  *store.QuietHours `json:"quietHours,omitempty"`
+	Events      map[string]bool   `json:"events,omitempty"` // Keys from store.NotificationEvents
+}
+
+// Validate checks the quiet hours and event types
+func (req *NotificationPreferencesRequest) Validate(errs *validate.Errors) {
+	if q := req.QuietHours; q != nil {
+		if !clockTime.MatchString(q.Start) || !clockTime.MatchString(q.End) {
+			errs.Add("quietHours", "'start' and 'end' must be HH:MM times")
+		} else if q.Start == q.End {
+			errs.Add("quietHours", "'start' and 'end' must differ")
+		}
+		if _, err := time.LoadLocation(q.TimeZone); err != nil || q.TimeZone == "Local" {
+			errs.Add("quietHours", "'timeZone' must be an IANA time zone such as Europe/London")
+		}
+	}
+	for event := range req.Events {
+		known := false
+		for _, e := range store.NotificationEvents {
+			known = known || e == event
+		}
+		if !known {
+			errs.Add("events", "unknown event type '"+event+"'")
+			break
+		}
+	}
+}
+
+// Get handles GET /api/notifications/{id}. Only the recipient can fetch a message; anyone
+// else gets the same 404 as for an unknown or expired notification.
+func (h *NotificationHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	msg, ok := h.inbox.Get(user.ID, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "notification_not_found", "Notification not found or expired")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// Preferences handles GET /api/user/me/notifications
+func (h *NotificationHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	prefs, err := h.preferences.NotificationPreferences(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to read notification preferences of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "preferences_unavailable", "Notification preferences are temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// SetPreferences handles PUT /api/user/me/notifications
+func (h *NotificationHandler) SetPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req NotificationPreferencesRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	now := time.Now().UTC()
+	prefs := &store.NotificationPreferences{
+		UserID:      user.ID,
+		TenantID:    user.TenantID,
+		Push:        req.Push == nil || *req.Push,
+		Email:       req.Email,
+		Teams:       req.Teams,
+		TeamsChatID: req.TeamsChatID,
+		QuietHours:  req.QuietHours,
+		Events:      req.Events,
+		UpdatedAt:   &now,
+	}
+	if prefs.Teams && h.teams == nil {
+		writeError(w, r, http.StatusBadRequest, "teams_unavailable", "Teams notifications are not enabled")
+		return
+	}
+	if h.teams != nil {
+		if err := h.teams.CheckPreferences(prefs); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_preferences", err.Error())
+			return
+		}
+	}
+
+	if err := h.preferences.SaveNotificationPreferences(r.Context(), prefs); err != nil {
+		log.Printf("Failed to save notification preferences of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "preferences_unavailable", "Notification preferences are temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+
+	"api-service/internal/openapi"
+)
+
+// swaggerUIVersion pins the Swagger UI assets loaded from the CDN
+const swaggerUIVersion = "5.17.14"
+
+// OpenAPIHandler serves the generated OpenAPI document and an optional Swagger UI
+type OpenAPIHandler struct {
+	spec    *openapi.Spec
+	specURL string
+}
+
+// NewOpenAPIHandler creates a new OpenAPI handler; specURL is where the UI loads the document from
+func NewOpenAPIHandler(spec *openapi.Spec, specURL string) *OpenAPIHandler {
+	return &OpenAPIHandler{
+		spec:    spec,
+		specURL: specURL,
+	}
+}
+
+// ServeHTTP handles GET /api/openapi.json
+func (h *OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.spec.Document())
+}
+
+// SwaggerUI handles GET /api/docs
+func (h *OpenAPIHandler) SwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>API Docs</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "%[2]s", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`, swaggerUIVersion, html.EscapeString(h.specURL))
+}
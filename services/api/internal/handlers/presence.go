@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+)
+
+// PresenceHandler lets connected users set their availability
+type PresenceHandler struct {
+	manager *events.Manager
+}
+
+// NewPresenceHandler creates a new presence handler
+func NewPresenceHandler(manager *events.Manager) *PresenceHandler {
+	return &PresenceHandler{
+		manager: manager,
+	}
+}
+
+// SetPresenceRequest sets the caller's status and optional custom status text
+type SetPresenceRequest struct {
+	Status string `json:"status" validate:"trim,required,oneof=online away busy"`
+	Text   string `json:"text,omitempty" validate:"trim,max=100"`
+}
+
+// Set handles PUT /api/presence
+func (h *PresenceHandler) Set(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req SetPresenceRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	presence, err := h.manager.SetPresence(user.ID, events.PresenceStatus(req.Status), req.Text)
+	if err != nil {
+		writeError(w, r, http.StatusConflict, "not_connected", "Presence can only be set while connected to the realtime API")
+		return
+	}
+	writeJSON(w, http.StatusOK, presence)
+}
+
+// Get handles GET /api/presence/{userId}
+func (h *PresenceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.manager.GetPresence(r.PathValue("userId")))
+}
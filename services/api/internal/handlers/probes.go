@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"api-service/internal/health"
+	"api-service/internal/models"
+)
+
+// ProbeHandler serves the Kubernetes/Container Apps liveness, readiness and startup probes
+type ProbeHandler struct {
+	checks  *health.Registry
+	started atomic.Bool
+}
+
+// NewProbeHandler creates a new probe handler using the checks in the registry for readiness
+func NewProbeHandler(checks *health.Registry) *ProbeHandler {
+	return &ProbeHandler{
+		checks: checks,
+	}
+}
+
+// Liveness handles /healthz. It only reports that the process is serving requests;
+// dependency failures must not cause the container to be restarted.
+func (h *ProbeHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, models.ProbeResponse{Status: "ok"})
+}
+
+// Readiness handles /readyz, returning 503 with per-check detail when a dependency is down
+func (h *ProbeHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	h.runChecks(w, r)
+}
+
+// Startup handles /startupz. It succeeds once all readiness checks have passed at least once.
+func (h *ProbeHandler) Startup(w http.ResponseWriter, r *http.Request) {
+	if h.started.Load() {
+		writeJSON(w, http.StatusOK, models.ProbeResponse{Status: "ok"})
+		return
+	}
+	h.runChecks(w, r)
+}
+
+// runChecks runs every registered check and writes a 200 or 503 probe response
+func (h *ProbeHandler) runChecks(w http.ResponseWriter, r *http.Request) {
+	results, ready := h.checks.Run(r.Context())
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, models.ProbeResponse{Status: "unavailable", Checks: results})
+		return
+	}
+
+	h.started.Store(true)
+	writeJSON(w, http.StatusOK, models.ProbeResponse{Status: "ok", Checks: results})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+)
+
+// ProtocolHandler manages the default event protocol version (blue/green switch)
+type ProtocolHandler struct {
+	protocols *events.ProtocolSwitch
+}
+
+// NewProtocolHandler creates a new protocol handler
+func NewProtocolHandler(protocols *events.ProtocolSwitch) *ProtocolHandler {
+	return &ProtocolHandler{
+		protocols: protocols,
+	}
+}
+
+// SetProtocolRequest changes the default protocol for new connections
+type SetProtocolRequest struct {
+	Default string `json:"default"`
+}
+
+// Get handles GET /api/admin/events/protocol
+func (h *ProtocolHandler) Get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.protocols.Status())
+}
+
+// Put handles PUT /api/admin/events/protocol, changing the default protocol for new connections
+func (h *ProtocolHandler) Put(w http.ResponseWriter, r *http.Request) {
+	var req SetProtocolRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	version, err := events.ParseProtocolVersion(req.Default)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_protocol", err.Error())
+		return
+	}
+	if err := h.protocols.SetDefault(version); err != nil {
+		writeError(w, r, http.StatusConflict, "protocol_disabled", err.Error())
+		return
+	}
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Default event protocol set to %s by %s (%s)", version, admin.Email, admin.ID)
+	}
+	writeJSON(w, http.StatusOK, h.protocols.Status())
+}
+
+// Rollback handles POST /api/admin/events/protocol/rollback, restoring the previous default
+func (h *ProtocolHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	version := h.protocols.Rollback()
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Default event protocol rolled back to %s by %s (%s)", version, admin.Email, admin.ID)
+	}
+	writeJSON(w, http.StatusOK, h.protocols.Status())
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/middleware"
+	"api-service/internal/store"
+	"api-service/internal/webpush"
+)
+
+// PushHandler lets users register the browsers they want Web Push notifications on
+type PushHandler struct {
+	pusher *webpush.Pusher
+}
+
+// NewPushHandler creates a new push subscription handler
+func NewPushHandler(pusher *webpush.Pusher) *PushHandler {
+	return &PushHandler{pusher: pusher}
+}
+
+// VAPIDKeyResponse is the applicationServerKey browsers subscribe with
+type VAPIDKeyResponse struct {
+	PublicKey string `json:"publicKey"`
+}
+
+// PushSubscribeRequest is a browser's PushSubscription.toJSON()
+type PushSubscribeRequest struct {
+	Endpoint string       `json:"endpoint" validate:"trim,required,max=2048"`
+	Keys     webpush.Keys `json:"keys"`
+}
+
+// PushSubscriptionsResponse lists the caller's push subscriptions
+type PushSubscriptionsResponse struct {
+	Subscriptions []*store.PushSubscription `json:"subscriptions"`
+}
+
+// VAPIDKey handles GET /api/push/vapid-public-key
+func (h *PushHandler) VAPIDKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, VAPIDKeyResponse{PublicKey: h.pusher.PublicKey()})
+}
+
+// Subscribe handles POST /api/push/subscriptions
+func (h *PushHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req PushSubscribeRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	sub, err := h.pusher.Subscribe(r.Context(), user, req.Endpoint, req.Keys, r.UserAgent())
+	switch {
+	case errors.Is(err, webpush.ErrInvalidSubscription):
+		writeError(w, r, http.StatusBadRequest, "invalid_subscription", err.Error())
+	case errors.Is(err, webpush.ErrTooManySubscriptions):
+		writeError(w, r, http.StatusConflict, "too_many_subscriptions", err.Error())
+	case err != nil:
+		log.Printf("Failed to save push subscription of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "push_unavailable", "Push subscriptions are temporarily unavailable")
+	default:
+		writeJSON(w, http.StatusCreated, sub)
+	}
+}
+
+// List handles GET /api/push/subscriptions
+func (h *PushHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	subs, err := h.pusher.Subscriptions(r.Context(), user)
+	if err != nil {
+		log.Printf("Failed to list push subscriptions of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "push_unavailable", "Push subscriptions are temporarily unavailable")
+		return
+	}
+	if subs == nil {
+		subs = []*store.PushSubscription{}
+	}
+	writeJSON(w, http.StatusOK, PushSubscriptionsResponse{Subscriptions: subs})
+}
+
+// Unsubscribe handles DELETE /api/push/subscriptions/{id}
+func (h *PushHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	err := h.pusher.Unsubscribe(r.Context(), user, r.PathValue("id"))
+	switch {
+	case errors.Is(err, webpush.ErrSubscriptionNotFound):
+		writeError(w, r, http.StatusNotFound, "subscription_not_found", "Push subscription not found")
+	case err != nil:
+		log.Printf("Failed to delete push subscription of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusServiceUnavailable, "push_unavailable", "Push subscriptions are temporarily unavailable")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/store"
+	"api-service/internal/validate"
+)
+
+// ReactionRequest adds an emoji reaction to a message
+type ReactionRequest struct {
+	Emoji string `json:"emoji" validate:"trim,required"`
+}
+
+// Validate requires an emoji rather than text or a shortcode
+func (req *ReactionRequest) Validate(errs *validate.Errors) {
+	if req.Emoji != "" && !models.IsEmoji(req.Emoji) {
+		errs.Add("emoji", "must be an emoji")
+	}
+}
+
+// ReactionsResponse lists a message's reactions after a change
+type ReactionsResponse struct {
+	MessageID string            `json:"messageId"`
+	Reactions []*store.Reaction `json:"reactions"`
+}
+
+// AddReaction handles POST /api/messages/{id}/reactions
+func (h *ChatHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req ReactionRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	reactions, err := h.chat.React(r.Context(), user, r.PathValue("id"), req.Emoji)
+	if err != nil {
+		writeReactionError(w, r, err)
+		return
+	}
+	writeReactions(w, r.PathValue("id"), reactions)
+}
+
+// RemoveReaction handles DELETE /api/messages/{id}/reactions?emoji=
+func (h *ChatHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	emoji := r.URL.Query().Get("emoji")
+	if !models.IsEmoji(emoji) {
+		writeError(w, r, http.StatusBadRequest, "invalid_emoji", "emoji must be an emoji")
+		return
+	}
+
+	reactions, err := h.chat.Unreact(r.Context(), user, r.PathValue("id"), emoji)
+	if err != nil {
+		writeReactionError(w, r, err)
+		return
+	}
+	writeReactions(w, r.PathValue("id"), reactions)
+}
+
+// writeReactions writes a message's reactions
+func writeReactions(w http.ResponseWriter, messageID string, reactions []*store.Reaction) {
+	if reactions == nil {
+		reactions = []*store.Reaction{}
+	}
+	writeJSON(w, http.StatusOK, ReactionsResponse{MessageID: messageID, Reactions: reactions})
+}
+
+// writeReactionError maps a reaction error to a problem response
+func writeReactionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, chat.ErrMessageNotFound):
+		writeError(w, r, http.StatusNotFound, "message_not_found", "Message not found")
+	case errors.Is(err, chat.ErrReactionNotFound):
+		writeError(w, r, http.StatusNotFound, "reaction_not_found", "You haven't reacted with this emoji")
+	case errors.Is(err, chat.ErrMessageDeleted):
+		writeError(w, r, http.StatusConflict, "message_deleted", "Message was deleted")
+	case errors.Is(err, chat.ErrTooManyReactions):
+		writeError(w, r, http.StatusConflict, "too_many_reactions", "This message has too many different reactions")
+	case errors.Is(err, chat.ErrTenantReadOnly):
+		writeError(w, r, http.StatusForbidden, "tenant_read_only", "Tenant is frozen and read-only")
+	default:
+		log.Printf("Reaction update failed: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "messages_unavailable", "Messages are temporarily unavailable")
+	}
+}
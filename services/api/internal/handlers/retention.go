@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/audit"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/retention"
+	"api-service/internal/store"
+)
+
+// RetentionHandler shows the retention policy applying to users' conversations and lets
+// admins override it per tenant or per room
+type RetentionHandler struct {
+	policies *retention.Policies
+	rooms    store.RoomStore
+	auditLog audit.Log
+}
+
+// NewRetentionHandler creates a new retention handler
+func NewRetentionHandler(policies *retention.Policies, rooms store.RoomStore, auditLog audit.Log) *RetentionHandler {
+	return &RetentionHandler{
+		policies: policies,
+		rooms:    rooms,
+		auditLog: auditLog,
+	}
+}
+
+// RetentionPolicyRequest sets how long a tenant's or room's messages are kept
+type RetentionPolicyRequest struct {
+	Days   int    `json:"days"`                                             // 0 keeps messages forever
+	Action string `json:"action,omitempty" validate:"oneof=delete archive"` // Default delete
+}
+
+// Get handles GET /api/retention, the policy applying to the caller's direct conversations.
+// Room policies are part of the room details.
+func (h *RetentionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.policies.Effective(user.TenantID, ""))
+}
+
+// List handles GET /api/admin/retention
+func (h *RetentionHandler) List(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.policies.Overrides())
+}
+
+// PutTenant handles PUT /api/admin/retention/tenants/{id}
+func (h *RetentionHandler) PutTenant(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	h.set(w, r, "tenant", r.PathValue("id"), policy, h.policies.SetTenant)
+}
+
+// DeleteTenant handles DELETE /api/admin/retention/tenants/{id}, restoring the default policy
+func (h *RetentionHandler) DeleteTenant(w http.ResponseWriter, r *http.Request) {
+	h.set(w, r, "tenant", r.PathValue("id"), nil, h.policies.SetTenant)
+}
+
+// PutRoom handles PUT /api/admin/retention/rooms/{id}
+func (h *RetentionHandler) PutRoom(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if _, err := h.rooms.Room(r.Context(), r.PathValue("id")); err != nil {
+		if errors.Is(err, store.ErrRoomNotFound) {
+			writeError(w, r, http.StatusNotFound, "room_not_found", "Room not found")
+			return
+		}
+		log.Printf("Failed to look up room %s: %v", r.PathValue("id"), err)
+		writeError(w, r, http.StatusServiceUnavailable, "rooms_unavailable", "Rooms are temporarily unavailable")
+		return
+	}
+	h.set(w, r, "room", r.PathValue("id"), policy, h.policies.SetRoom)
+}
+
+// DeleteRoom handles DELETE /api/admin/retention/rooms/{id}, restoring the tenant's policy
+func (h *RetentionHandler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	h.set(w, r, "room", r.PathValue("id"), nil, h.policies.SetRoom)
+}
+
+func (h *RetentionHandler) decode(w http.ResponseWriter, r *http.Request) (*retention.Policy, bool) {
+	var req RetentionPolicyRequest
+	if !decodeJSONBody(w, r, &req) {
+		return nil, false
+	}
+
+	policy := &retention.Policy{Days: req.Days, Action: retention.Action(req.Action)}
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		policy.UpdatedBy = admin.ID
+	}
+	return policy, true
+}
+
+func (h *RetentionHandler) set(w http.ResponseWriter, r *http.Request, scope, id string, policy *retention.Policy,
+	set func(id string, policy *retention.Policy) (*retention.Policy, error)) {
+	stored, err := set(id, policy)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_retention_policy", err.Error())
+		return
+	}
+
+	admin, _ := middleware.GetUserFromContext(r.Context())
+	if stored == nil {
+		h.record(admin, scope, "delete", id, nil)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.record(admin, scope, "set", id, stored)
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// record audits a retention policy change
+func (h *RetentionHandler) record(admin *models.User, scope, change, target string, policy *retention.Policy) {
+	rec := audit.Record{Action: "retention." + scope + "." + change, Target: target, Outcome: "success"}
+	if policy != nil {
+		rec.Details = map[string]interface{}{"days": policy.Days, "action": policy.Action}
+	}
+	if admin != nil {
+		rec.Actor = admin.ID
+		rec.TenantID = admin.TenantID
+		log.Printf("Retention policy of %s %s changed by %s (%s)", scope, target, admin.Email, admin.ID)
+	}
+	h.auditLog.Record(rec)
+}
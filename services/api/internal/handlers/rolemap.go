@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/middleware"
+	"api-service/internal/rolemap"
+)
+
+// RoleMappingHandler manages the group → role mapping table
+type RoleMappingHandler struct {
+	mapper *rolemap.Mapper
+}
+
+// NewRoleMappingHandler creates a new role mapping handler
+func NewRoleMappingHandler(mapper *rolemap.Mapper) *RoleMappingHandler {
+	return &RoleMappingHandler{
+		mapper: mapper,
+	}
+}
+
+// RoleMappingsRequest replaces the whole group → roles table
+type RoleMappingsRequest struct {
+	Mappings map[string][]string `json:"mappings"`
+}
+
+// Get handles GET /api/admin/role-mappings
+func (h *RoleMappingHandler) Get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"mappings": h.mapper.Snapshot(),
+	})
+}
+
+// Put handles PUT /api/admin/role-mappings, replacing the whole table on every replica
+func (h *RoleMappingHandler) Put(w http.ResponseWriter, r *http.Request) {
+	var req RoleMappingsRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Mappings == nil {
+		writeError(w, r, http.StatusBadRequest, "missing_fields", "Missing 'mappings' field")
+		return
+	}
+
+	if err := h.mapper.Replace(r.Context(), req.Mappings); err != nil {
+		if errors.Is(err, rolemap.ErrInvalidMappings) {
+			writeError(w, r, http.StatusBadRequest, "invalid_mappings", err.Error())
+			return
+		}
+		log.Printf("Failed to replace group role mappings: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Failed to save the role mappings")
+		return
+	}
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Group role mappings replaced by %s (%s)", admin.Email, admin.ID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"mappings": h.mapper.Snapshot(),
+	})
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/rooms"
+	"api-service/internal/store"
+	"api-service/internal/usage"
+	"api-service/internal/validate"
+)
+
+// RoomHandler serves group chat rooms
+type RoomHandler struct {
+	rooms *rooms.Service
+}
+
+// NewRoomHandler creates a new room handler
+func NewRoomHandler(service *rooms.Service) *RoomHandler {
+	return &RoomHandler{
+		rooms: service,
+	}
+}
+
+// CreateRoomRequest names a new room
+type CreateRoomRequest struct {
+	Name string `json:"name" validate:"trim,required,max=100"`
+}
+
+// RoomListResponse lists the rooms the caller has joined
+type RoomListResponse struct {
+	Rooms []*store.Room `json:"rooms"`
+	Count int           `json:"count"`
+}
+
+// RoomMessageRequest is a message sent to a room, as plain-text "content" or a versioned
+// "message" body
+type RoomMessageRequest struct {
+	Content         *string                `json:"content,omitempty" validate:"trim"`
+	Message         *models.MessageContent `json:"message,omitempty"`
+	ParentMessageID string                 `json:"parentMessageId,omitempty" validate:"trim,pattern=id"` // Reply in this message's thread
+}
+
+// Validate requires exactly one non-empty body and enforces the message length limit
+func (req *RoomMessageRequest) Validate(errs *validate.Errors) {
+	validateMessageBody(errs, req.Content, req.Message)
+}
+
+// Create handles POST /api/rooms
+func (h *RoomHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req CreateRoomRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	room, err := h.rooms.Create(r.Context(), user, req.Name)
+	if err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, room)
+}
+
+// List handles GET /api/rooms
+func (h *RoomHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	joined, err := h.rooms.List(r.Context(), user)
+	if err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	if joined == nil {
+		joined = []*store.Room{}
+	}
+	writeJSON(w, http.StatusOK, RoomListResponse{Rooms: joined, Count: len(joined)})
+}
+
+// Get handles GET /api/rooms/{id}
+func (h *RoomHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	room, err := h.rooms.Get(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// Join handles POST /api/rooms/{id}/join
+func (h *RoomHandler) Join(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	room, err := h.rooms.Join(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// Leave handles POST /api/rooms/{id}/leave
+func (h *RoomHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	if err := h.rooms.Leave(r.Context(), user, r.PathValue("id")); err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendMessage handles POST /api/rooms/{id}/messages
+func (h *RoomHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	var req RoomMessageRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	message := req.Message
+	if message == nil {
+		message = models.NewMessageContent(*req.Content)
+	}
+
+	delivery, err := h.rooms.SendMessage(r.Context(), user, r.PathValue("id"), message, req.ParentMessageID)
+	if err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// History handles GET /api/rooms/{id}/messages: the room's messages, newest first. Pages are
+// limited by ?limit= and continue from ?before=.
+func (h *RoomHandler) History(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	before, limit, ok := parseHistoryPage(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := h.rooms.History(r.Context(), user, r.PathValue("id"), before, limit)
+	if err != nil {
+		writeRoomError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newMessageHistoryResponse(messages, limit))
+}
+
+// writeRoomError maps a rooms service error to a problem response
+func writeRoomError(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *usage.QuotaError
+	var rejectedErr *moderation.RejectedError
+	switch {
+	case errors.As(err, &quotaErr):
+		writeQuotaError(w, r, quotaErr)
+	case errors.As(err, &rejectedErr):
+		writeRejectedError(w, r, rejectedErr)
+	case errors.Is(err, rooms.ErrRoomNotFound):
+		writeError(w, r, http.StatusNotFound, "room_not_found", "Room not found")
+	case errors.Is(err, rooms.ErrNotMember):
+		writeError(w, r, http.StatusForbidden, "not_room_member", "You are not a member of this room")
+	case errors.Is(err, chat.ErrTenantReadOnly):
+		writeError(w, r, http.StatusForbidden, "tenant_read_only", "Tenant is frozen and read-only")
+	case errors.Is(err, chat.ErrParentNotFound):
+		writeError(w, r, http.StatusNotFound, "parent_message_not_found", "Parent message not found in this room")
+	default:
+		log.Printf("Room operation failed: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "rooms_unavailable", "Rooms are temporarily unavailable")
+	}
+}
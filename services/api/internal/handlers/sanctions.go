@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"api-service/internal/middleware"
+	"api-service/internal/sanctions"
+	"api-service/internal/validate"
+)
+
+// SanctionHandler lets admins kick and ban users
+type SanctionHandler struct {
+	sanctions *sanctions.Service
+}
+
+// NewSanctionHandler creates a new sanction handler
+func NewSanctionHandler(service *sanctions.Service) *SanctionHandler {
+	return &SanctionHandler{sanctions: service}
+}
+
+// KickRequest closes a user's connections
+type KickRequest struct {
+	Reason string `json:"reason,omitempty" validate:"trim,max=500"` // Shown to the user
+}
+
+// KickResponse reports how many connections were closed
+type KickResponse struct {
+	Connections int `json:"connections"`
+}
+
+// BanRequest keeps a user from authenticating for a while
+type BanRequest struct {
+	Duration string `json:"duration" validate:"trim,required"`        // e.g. "30m", "24h"
+	Reason   string `json:"reason,omitempty" validate:"trim,max=500"` // Shown to the user
+}
+
+// Validate requires a duration Go can parse
+func (req *BanRequest) Validate(errs *validate.Errors) {
+	if req.Duration == "" {
+		return
+	}
+	if d, err := time.ParseDuration(req.Duration); err != nil || d <= 0 || d > sanctions.MaxBan {
+		errs.Add("duration", "must be a positive duration such as 30m or 24h, at most "+sanctions.MaxBan.String())
+	}
+}
+
+// BansResponse lists the bans in force
+type BansResponse struct {
+	Bans []sanctions.Ban `json:"bans"`
+}
+
+// Kick handles POST /api/admin/users/{id}/kick
+func (h *SanctionHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req KickRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	writeJSON(w, http.StatusOK, KickResponse{Connections: h.sanctions.Kick(admin, r.PathValue("id"), req.Reason)})
+}
+
+// Ban handles POST /api/admin/users/{id}/ban
+func (h *SanctionHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req BanRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if r.PathValue("id") == admin.ID {
+		writeError(w, r, http.StatusBadRequest, "cannot_ban_self", "Admins can't ban themselves")
+		return
+	}
+
+	duration, _ := time.ParseDuration(req.Duration)
+	ban, err := h.sanctions.Ban(admin, r.PathValue("id"), duration, req.Reason)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_ban", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ban)
+}
+
+// Unban handles DELETE /api/admin/users/{id}/ban
+func (h *SanctionHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	if !h.sanctions.Unban(admin, r.PathValue("id")) {
+		writeError(w, r, http.StatusNotFound, "ban_not_found", "User is not banned")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBans handles GET /api/admin/bans
+func (h *SanctionHandler) ListBans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, BansResponse{Bans: h.sanctions.List()})
+}
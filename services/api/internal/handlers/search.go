@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"api-service/internal/middleware"
+	"api-service/internal/search"
+)
+
+// maxSearchQueryLength bounds the text of a search
+const maxSearchQueryLength = 200
+
+// SearchHandler serves full-text search over the caller's messages
+type SearchHandler struct {
+	search *search.Service
+}
+
+// NewSearchHandler creates a new search handler
+func NewSearchHandler(service *search.Service) *SearchHandler {
+	return &SearchHandler{
+		search: service,
+	}
+}
+
+// Search handles GET /api/messages/search?q=: messages of the caller's conversations matching
+// q, best matches first, optionally only those exchanged with ?peer=. Pages are limited by
+// ?limit= and continue from ?offset=.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	query := r.URL.Query()
+	text := strings.TrimSpace(query.Get("q"))
+	if text == "" || utf8.RuneCountInString(text) > maxSearchQueryLength {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", fmt.Sprintf("q must be between 1 and %d characters", maxSearchQueryLength))
+		return
+	}
+
+	limit := search.DefaultPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > search.MaxPageSize {
+			writeError(w, r, http.StatusBadRequest, "invalid_limit", fmt.Sprintf("limit must be between 1 and %d", search.MaxPageSize))
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > search.MaxOffset {
+			writeError(w, r, http.StatusBadRequest, "invalid_offset", fmt.Sprintf("offset must be between 0 and %d", search.MaxOffset))
+			return
+		}
+		offset = n
+	}
+
+	results, err := h.search.Search(r.Context(), user, text, strings.TrimSpace(query.Get("peer")), limit, offset)
+	if err != nil {
+		log.Printf("Error searching messages: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "search_unavailable", "Search is temporarily unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
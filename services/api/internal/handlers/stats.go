@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api-service/internal/clienterrors"
+	"api-service/internal/deadletter"
+	"api-service/internal/eventgrid"
+	"api-service/internal/eventhubs"
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+	"api-service/internal/notificationhubs"
+	"api-service/internal/outbox"
+	"api-service/internal/search"
+	"api-service/internal/teams"
+	"api-service/internal/webhooks"
+	"api-service/internal/webpush"
+)
+
+// StatsHandler serves operational statistics to admins
+type StatsHandler struct {
+	manager      *events.Manager
+	clientErrors *clienterrors.Aggregator
+	auth         *middleware.AuthMiddleware
+	eventHubs    *eventhubs.Publisher         // Optional
+	eventGrid    *eventgrid.Publisher         // Optional
+	eventGridIn  *eventgrid.Receiver          // Optional
+	search       *search.Index                // Optional
+	webhooks     *webhooks.Service            // Optional
+	teams        *teams.Notifier              // Optional
+	push         *webpush.Pusher              // Optional
+	devicePush   *notificationhubs.Dispatcher // Optional
+	outbox       *outbox.Relay                // Optional
+	deadLetters  *deadletter.Queue            // Optional
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(manager *events.Manager, clientErrors *clienterrors.Aggregator, auth *middleware.AuthMiddleware) *StatsHandler {
+	return &StatsHandler{
+		manager:      manager,
+		clientErrors: clientErrors,
+		auth:         auth,
+	}
+}
+
+// SetEventHubs includes the Event Hubs publisher's metrics in the stats
+func (h *StatsHandler) SetEventHubs(publisher *eventhubs.Publisher) {
+	h.eventHubs = publisher
+}
+
+// SetEventGrid includes the Event Grid publisher's metrics in the stats
+func (h *StatsHandler) SetEventGrid(publisher *eventgrid.Publisher) {
+	h.eventGrid = publisher
+}
+
+// SetEventGridReceiver includes the metrics of events received from Event Grid in the stats
+func (h *StatsHandler) SetEventGridReceiver(receiver *eventgrid.Receiver) {
+	h.eventGridIn = receiver
+}
+
+// SetSearch includes the search index's metrics in the stats
+func (h *StatsHandler) SetSearch(index *search.Index) {
+	h.search = index
+}
+
+// SetWebhooks includes webhook delivery metrics in the stats
+func (h *StatsHandler) SetWebhooks(service *webhooks.Service) {
+	h.webhooks = service
+}
+
+// SetTeams includes Teams notification metrics in the stats
+func (h *StatsHandler) SetTeams(notifier *teams.Notifier) {
+	h.teams = notifier
+}
+
+// SetPush includes Web Push delivery metrics in the stats
+func (h *StatsHandler) SetPush(pusher *webpush.Pusher) {
+	h.push = pusher
+}
+
+// SetDevicePush includes mobile push metrics in the stats
+func (h *StatsHandler) SetDevicePush(dispatcher *notificationhubs.Dispatcher) {
+	h.devicePush = dispatcher
+}
+
+// SetDeadLetters includes dead letter metrics in the stats
+func (h *StatsHandler) SetDeadLetters(letters *deadletter.Queue) {
+	h.deadLetters = letters
+}
+
+// SetOutbox includes outbox relay metrics in the stats
+func (h *StatsHandler) SetOutbox(relay *outbox.Relay) {
+	h.outbox = relay
+}
+
+// ServeHTTP handles GET /api/admin/stats
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats := map[string]interface{}{
+		"activeConnections": len(h.manager.GetActiveUsers()),
+		"eventProtocols":    h.manager.Protocols().Status(),
+		"websocketQuotas":   h.manager.QuotaStats(),
+		"fanOut":            h.manager.FanOutStats(),
+		"sendOverflow":      h.manager.OverflowStats(),
+		"backplane":         h.manager.BackplaneStats(),
+		"clientErrors":      h.clientErrors.Stats(),
+		"jwks":              h.auth.JWKSStatus(),
+	}
+	if h.eventHubs != nil {
+		stats["eventHubs"] = h.eventHubs.Stats()
+	}
+	if h.eventGrid != nil {
+		stats["eventGrid"] = h.eventGrid.Stats()
+	}
+	if h.eventGridIn != nil {
+		stats["eventGridInbound"] = h.eventGridIn.Stats()
+	}
+	if h.search != nil {
+		stats["search"] = h.search.Stats()
+	}
+	if h.webhooks != nil {
+		stats["webhooks"] = h.webhooks.Stats()
+	}
+	if h.teams != nil {
+		stats["teamsNotifications"] = h.teams.Stats()
+	}
+	if h.push != nil {
+		stats["webPush"] = h.push.Stats()
+	}
+	if h.devicePush != nil {
+		stats["mobilePush"] = h.devicePush.Stats()
+	}
+	if h.outbox != nil {
+		stats["outbox"] = h.outbox.Stats()
+	}
+	if h.deadLetters != nil {
+		stats["deadLetters"] = h.deadLetters.Stats()
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
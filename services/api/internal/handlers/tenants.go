@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/middleware"
+	"api-service/internal/tenants"
+)
+
+// TenantHandler handles tenant administration requests
+type TenantHandler struct {
+	registry       *tenants.Registry
+	decommissioner *tenants.Decommissioner
+}
+
+// NewTenantHandler creates a new tenant handler
+func NewTenantHandler(registry *tenants.Registry, decommissioner *tenants.Decommissioner) *TenantHandler {
+	return &TenantHandler{
+		registry:       registry,
+		decommissioner: decommissioner,
+	}
+}
+
+// OnboardTenantRequest represents a tenant onboarding request
+type OnboardTenantRequest struct {
+	TenantID         string   `json:"tenantId" validate:"trim,required,pattern=id"`
+	Name             string   `json:"name" validate:"trim,required,max=200"`
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	Features         []string `json:"features"`
+	StoragePartition string   `json:"storagePartition"`
+	PushContent      string   `json:"pushContent" validate:"trim,oneof=full minimal"`
+
+	Onboarding []tenants.OnboardingStep `json:"onboarding"` // Optional tenant-specific welcome sequence
+}
+
+// List handles GET /api/admin/tenants, returning all onboarded tenants
+func (h *TenantHandler) List(w http.ResponseWriter, r *http.Request) {
+	tenantList := h.registry.List()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tenants": tenantList,
+		"count":   len(tenantList),
+	})
+}
+
+// Onboard handles POST /api/admin/tenants, registering and provisioning a new tenant
+func (h *TenantHandler) Onboard(w http.ResponseWriter, r *http.Request) {
+	var req OnboardTenantRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	tenant, err := h.registry.Onboard(r.Context(), &tenants.Tenant{
+		ID:               req.TenantID,
+		Name:             req.Name,
+		AllowedOrigins:   req.AllowedOrigins,
+		Features:         req.Features,
+		StoragePartition: req.StoragePartition,
+		PushContent:      req.PushContent,
+		Onboarding:       req.Onboarding,
+	})
+	if errors.Is(err, tenants.ErrTenantExists) {
+		writeError(w, r, http.StatusConflict, "tenant_exists", "Tenant is already onboarded")
+		return
+	}
+	if err != nil {
+		log.Printf("Tenant onboarding failed: %v", err)
+		writeError(w, r, http.StatusBadRequest, "onboarding_failed", err.Error())
+		return
+	}
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Tenant %s onboarded by %s (%s)", tenant.ID, admin.Email, admin.ID)
+	}
+
+	writeJSON(w, http.StatusCreated, tenant)
+}
+
+// DecommissionTenantRequest represents a tenant decommission request
+type DecommissionTenantRequest struct {
+	ExportContainerURL string `json:"exportContainerUrl" validate:"trim,required,prefix=https://"` // SAS URL of the tenant's Blob container
+}
+
+// Get handles GET /api/admin/tenants/{id}
+func (h *TenantHandler) Get(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.registry.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "tenant_not_found", "Tenant not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, tenant)
+}
+
+// Freeze handles POST /api/admin/tenants/{id}/freeze, making the tenant read-only
+func (h *TenantHandler) Freeze(w http.ResponseWriter, r *http.Request) {
+	tenant, err := h.decommissioner.Freeze(r.Context(), r.PathValue("id"))
+	if errors.Is(err, tenants.ErrTenantNotFound) {
+		writeError(w, r, http.StatusNotFound, "tenant_not_found", "Tenant not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "freeze_failed", err.Error())
+		return
+	}
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Tenant %s frozen by %s (%s)", tenant.ID, admin.Email, admin.ID)
+	}
+
+	writeJSON(w, http.StatusOK, tenant)
+}
+
+// Decommission handles POST /api/admin/tenants/{id}/decommission. The tenant's data is exported
+// to its Blob container, purged everywhere and verified in the background; the verification
+// report is available from GET /api/admin/tenants/{id} once complete.
+func (h *TenantHandler) Decommission(w http.ResponseWriter, r *http.Request) {
+	var req DecommissionTenantRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	report, err := h.decommissioner.Start(r.Context(), r.PathValue("id"), req.ExportContainerURL)
+	switch {
+	case errors.Is(err, tenants.ErrTenantNotFound):
+		writeError(w, r, http.StatusNotFound, "tenant_not_found", "Tenant not found")
+		return
+	case errors.Is(err, tenants.ErrTenantActive), errors.Is(err, tenants.ErrDecommissionRunning):
+		writeError(w, r, http.StatusConflict, "decommission_rejected", err.Error())
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, "decommission_failed", err.Error())
+		return
+	}
+
+	if admin, ok := middleware.GetUserFromContext(r.Context()); ok {
+		log.Printf("Tenant %s decommission started by %s (%s)", report.TenantID, admin.Email, admin.ID)
+	}
+
+	writeJSON(w, http.StatusAccepted, report)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"api-service/internal/audit"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/topics"
+)
+
+// TopicACLHandler manages per-topic access control rules
+type TopicACLHandler struct {
+	acl      *topics.ACL
+	auditLog audit.Log
+}
+
+// NewTopicACLHandler creates a new topic ACL handler
+func NewTopicACLHandler(acl *topics.ACL, auditLog audit.Log) *TopicACLHandler {
+	return &TopicACLHandler{
+		acl:      acl,
+		auditLog: auditLog,
+	}
+}
+
+// TopicACLRequest sets who may subscribe and publish to the topics matching a pattern
+type TopicACLRequest struct {
+	Subscribe topics.Grant `json:"subscribe"`
+	Publish   topics.Grant `json:"publish"`
+}
+
+// TopicACLsResponse lists the topic ACL rules
+type TopicACLsResponse struct {
+	Mode  string        `json:"mode"`
+	Rules []topics.Rule `json:"rules"`
+}
+
+// List handles GET /api/admin/topic-acls
+func (h *TopicACLHandler) List(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, TopicACLsResponse{
+		Mode:  h.acl.Mode(),
+		Rules: h.acl.List(),
+	})
+}
+
+// Put handles PUT /api/admin/topic-acls/{pattern}, creating or replacing the rule
+func (h *TopicACLHandler) Put(w http.ResponseWriter, r *http.Request) {
+	var req TopicACLRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	admin, _ := middleware.GetUserFromContext(r.Context())
+	rule := topics.Rule{
+		Pattern:   r.PathValue("pattern"),
+		Subscribe: req.Subscribe,
+		Publish:   req.Publish,
+	}
+	if admin != nil {
+		rule.UpdatedBy = admin.ID
+	}
+
+	rule, err := h.acl.Set(rule)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_topic_pattern", err.Error())
+		return
+	}
+
+	h.record(admin, "topic_acl.set", rule.Pattern)
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// Delete handles DELETE /api/admin/topic-acls/{pattern}, reopening the matching topics
+func (h *TopicACLHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	pattern := r.PathValue("pattern")
+	if !h.acl.Delete(pattern) {
+		writeError(w, r, http.StatusNotFound, "topic_acl_not_found", "No ACL for this topic pattern")
+		return
+	}
+
+	admin, _ := middleware.GetUserFromContext(r.Context())
+	h.record(admin, "topic_acl.delete", pattern)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// record audits an ACL change
+func (h *TopicACLHandler) record(admin *models.User, action, pattern string) {
+	rec := audit.Record{Action: action, Target: pattern, Outcome: "success"}
+	if admin != nil {
+		rec.Actor = admin.ID
+		rec.TenantID = admin.TenantID
+		log.Printf("Topic ACL %s changed by %s (%s)", pattern, admin.Email, admin.ID)
+	}
+	h.auditLog.Record(rec)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+	"api-service/internal/topics"
+	"api-service/internal/validate"
+)
+
+// TopicHandler publishes application events to topic subscribers
+type TopicHandler struct {
+	manager *events.Manager
+	acl     *topics.ACL
+}
+
+// NewTopicHandler creates a new topic handler
+func NewTopicHandler(manager *events.Manager, acl *topics.ACL) *TopicHandler {
+	return &TopicHandler{
+		manager: manager,
+		acl:     acl,
+	}
+}
+
+// PublishTopicEventRequest is an application event; data is relayed to subscribers as-is
+type PublishTopicEventRequest struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// Validate requires data
+func (req *PublishTopicEventRequest) Validate(errs *validate.Errors) {
+	if len(req.Data) == 0 || bytes.Equal(req.Data, []byte("null")) {
+		errs.Add("data", "is required")
+	}
+}
+
+// PublishTopicEventResponse identifies a published event
+type PublishTopicEventResponse struct {
+	EventID string `json:"eventId"`
+	Topic   string `json:"topic"`
+}
+
+// Publish handles POST /api/topics/{topic}/events
+func (h *TopicHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	topic := r.PathValue("topic")
+	if err := topics.ValidateTopic(topic); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_topic", err.Error())
+		return
+	}
+
+	var req PublishTopicEventRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	if err := h.acl.Authorize(user, topic, topics.ActionPublish); err != nil {
+		writeError(w, r, http.StatusForbidden, "topic_forbidden", "You may not publish on this topic")
+		return
+	}
+
+	event := events.NewTopicEvent(topic, user.TenantID, user.ID, req.Data)
+	h.manager.BroadcastEvent(event)
+	writeJSON(w, http.StatusAccepted, PublishTopicEventResponse{EventID: event.ID, Topic: topic})
+}
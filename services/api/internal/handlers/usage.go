@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"api-service/internal/middleware"
+	"api-service/internal/problem"
+	"api-service/internal/usage"
+)
+
+// UsageHandler reports storage usage against quotas
+type UsageHandler struct {
+	tracker *usage.Tracker
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(tracker *usage.Tracker) *UsageHandler {
+	return &UsageHandler{
+		tracker: tracker,
+	}
+}
+
+// UserUsageResponse is the caller's storage usage
+type UserUsageResponse struct {
+	UserID string      `json:"userId"`
+	Usage  usage.Usage `json:"usage"`
+}
+
+// Me handles GET /api/user/me/usage
+func (h *UsageHandler) Me(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	userUsage, err := h.tracker.UserUsage(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to read storage usage of %s: %v", user.ID, err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Failed to read storage usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, UserUsageResponse{
+		UserID: user.ID,
+		Usage:  userUsage,
+	})
+}
+
+// writeQuotaError writes a 403 storage_quota_exceeded problem with the quota's usage details
+func writeQuotaError(w http.ResponseWriter, r *http.Request, err *usage.QuotaError) {
+	p := problem.New(r, http.StatusForbidden, "storage_quota_exceeded",
+		fmt.Sprintf("The %s storage quota is exhausted", err.Scope))
+	p.Quota = &problem.Quota{
+		Scope:          err.Scope,
+		UsedBytes:      err.Used,
+		LimitBytes:     err.Limit,
+		RequestedBytes: err.Requested,
+	}
+	p.Write(w)
+}
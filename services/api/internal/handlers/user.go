@@ -17,19 +17,13 @@ func NewUserHandler() *UserHandler {
 	return &UserHandler{}
 }
 
-// ServeHTTP handles the /api/user/me endpoint
+// ServeHTTP handles GET /api/user/me
 func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user from context (populated by auth middleware)
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
 		log.Printf("User not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
 		return
 	}
 
@@ -38,7 +32,6 @@ func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewEncoder(w).Encode(user); err != nil {
 		log.Printf("Error encoding user response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+	"api-service/internal/webhooks"
+)
+
+// WebhookHandler lets admins register webhooks and inspect deliveries that failed
+type WebhookHandler struct {
+	webhooks *webhooks.Service
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(service *webhooks.Service) *WebhookHandler {
+	return &WebhookHandler{webhooks: service}
+}
+
+// CreateWebhookRequest registers a webhook
+type CreateWebhookRequest struct {
+	URL         string             `json:"url" validate:"trim,required,max=2048"`
+	Secret      string             `json:"secret,omitempty" validate:"max=256"` // Generated when empty
+	EventTypes  []events.EventType `json:"eventTypes" validate:"required,max=32"`
+	Description string             `json:"description,omitempty" validate:"trim,max=200"`
+}
+
+// WebhooksResponse lists webhooks
+type WebhooksResponse struct {
+	Webhooks []webhooks.Webhook `json:"webhooks"`
+}
+
+// Create handles POST /api/webhooks; the response is the only one carrying the secret
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req CreateWebhookRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	created, err := h.webhooks.Create(r.Context(), admin, &webhooks.Webhook{
+		URL:         req.URL,
+		Secret:      req.Secret,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+	})
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidWebhook):
+		writeError(w, r, http.StatusBadRequest, "invalid_webhook", err.Error())
+	case errors.Is(err, webhooks.ErrTooManyWebhooks):
+		writeError(w, r, http.StatusConflict, "too_many_webhooks", err.Error())
+	case err != nil:
+		log.Printf("Failed to register webhook: %v", err)
+		writeError(w, r, http.StatusServiceUnavailable, "webhooks_unavailable", "Webhooks are temporarily unavailable")
+	default:
+		log.Printf("Webhook %s registered by %s (%s)", created.ID, admin.Email, admin.ID)
+		writeJSON(w, http.StatusCreated, created)
+	}
+}
+
+// List handles GET /api/webhooks
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, WebhooksResponse{Webhooks: h.webhooks.List()})
+}
+
+// Get handles GET /api/webhooks/{id}
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.webhooks.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// Delete handles DELETE /api/webhooks/{id}
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	err := h.webhooks.Delete(r.Context(), admin, r.PathValue("id"))
+	switch {
+	case errors.Is(err, webhooks.ErrWebhookNotFound):
+		writeError(w, r, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+	case err != nil:
+		log.Printf("Failed to delete webhook %s: %v", r.PathValue("id"), err)
+		writeError(w, r, http.StatusServiceUnavailable, "webhooks_unavailable", "Webhooks are temporarily unavailable")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+
+	"api-service/internal/events"
+	"api-service/internal/middleware"
+)
+
+// webTransportKeepAlive keeps idle sessions within QUIC's idle timeout (30 seconds by default)
+const webTransportKeepAlive = 20 * time.Second
+
+// Session error codes sent when the server ends a WebTransport session
+const (
+	webTransportClosed      webtransport.SessionErrorCode = 0 // The subscription ended (shutdown, kick, or the client fell behind)
+	webTransportWriteFailed webtransport.SessionErrorCode = 1 // The event stream could not be written
+)
+
+// WebTransportHandler delivers realtime events over WebTransport (HTTP/3), an experimental
+// alternative to the WebSocket for clients on lossy networks. Sessions are registered with the
+// event manager like WebSocket connections, so both transports share fan-out; clients send
+// through the REST API.
+type WebTransportHandler struct {
+	events *events.Manager
+	server *webtransport.Server
+}
+
+// NewWebTransportHandler creates a new WebTransport handler. Sessions are accepted from the
+// same origins as WebSockets (see SetWebSocketOrigins).
+func NewWebTransportHandler(manager *events.Manager) *WebTransportHandler {
+	return &WebTransportHandler{
+		events: manager,
+		server: &webtransport.Server{CheckOrigin: checkOrigin},
+	}
+}
+
+// Server configures the HTTP/3 listener on addr (a UDP address) serving handler, which should
+// only route CONNECT requests for the WebTransport endpoint, to ServeHTTP
+func (h *WebTransportHandler) Server(addr string, tlsConfig *tls.Config, handler http.Handler) *webtransport.Server {
+	h.server.H3 = http3.Server{
+		Addr:       addr,
+		TLSConfig:  tlsConfig,
+		QUICConfig: &quic.Config{KeepAlivePeriod: webTransportKeepAlive},
+		Handler:    handler,
+	}
+	return h.server
+}
+
+// ServeHTTP handles CONNECT /api/events/webtransport over HTTP/3. The protocol, encoding and
+// payload schema are negotiated with ?protocol=, ?encoding= and ?schema= as for the WebSocket.
+// Events are written to one unidirectional stream opened by the server, each prefixed with its
+// length as a 4-byte big-endian integer.
+func (h *WebTransportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	requested, encoding, err := events.SplitEncoding(r.URL.Query().Get("protocol"))
+	if err == nil && r.URL.Query().Get("encoding") != "" {
+		encoding, err = events.ParseEncoding(r.URL.Query().Get("encoding"))
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "unsupported_encoding", err.Error())
+		return
+	}
+	protocol, err := h.events.Protocols().Negotiate(requested)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "unsupported_protocol", err.Error())
+		return
+	}
+	schemaVersion, err := events.ParseSchemaVersion(r.URL.Query().Get("schema"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "unsupported_schema", err.Error())
+		return
+	}
+
+	session, err := h.server.Upgrade(unwrapResponseWriter(w), r)
+	if err != nil {
+		log.Printf("Failed to upgrade WebTransport session for %s (%s): %v", user.Name, user.ID, err)
+		writeError(w, r, http.StatusBadRequest, "webtransport_required", "This endpoint only accepts WebTransport sessions over HTTP/3")
+		return
+	}
+	stream, err := session.OpenUniStream()
+	if err != nil {
+		log.Printf("Failed to open WebTransport event stream for %s (%s): %v", user.Name, user.ID, err)
+		session.CloseWithError(webTransportWriteFailed, "event stream unavailable")
+		return
+	}
+
+	client := &events.Client{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		TenantID:      user.TenantID,
+		Protocol:      protocol,
+		Encoding:      encoding,
+		SchemaVersion: schemaVersion,
+		AppVersion:    clientAppVersion(r),
+		RemoteAddr:    middleware.ClientIP(r),
+		User:          user,
+	}
+	frames := h.events.Subscribe(client, h.events.SendBuffer())
+	defer h.events.UnregisterClient(client)
+
+	log.Printf("WebTransport session connected: %s (%s)", user.Name, user.ID)
+
+	var prefix [4]byte
+	for {
+		select {
+		case <-session.Context().Done():
+			log.Printf("WebTransport session disconnected: %s (%s)", user.Name, user.ID)
+			return
+		case data, ok := <-frames:
+			if !ok {
+				session.CloseWithError(webTransportClosed, "")
+				return
+			}
+			binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+			if _, err := stream.Write(append(prefix[:], data...)); err != nil {
+				log.Printf("WebTransport write error for %s: %v", user.Name, err)
+				session.CloseWithError(webTransportWriteFailed, "event stream write failed")
+				return
+			}
+		}
+	}
+}
+
+// unwrapResponseWriter returns the writer of the HTTP/3 server beneath middleware wrappers,
+// which the WebTransport upgrade needs to take over the request stream
+func unwrapResponseWriter(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"api-service/internal/middleware"
+)
+
+// TicketHandler issues one-time tickets for authenticating streaming connections
+type TicketHandler struct {
+	tickets *middleware.TicketStore
+}
+
+// NewTicketHandler creates a new ticket handler
+func NewTicketHandler(tickets *middleware.TicketStore) *TicketHandler {
+	return &TicketHandler{
+		tickets: tickets,
+	}
+}
+
+// TicketResponse is a one-time ticket to pass as ?ticket= when opening the WebSocket (or an
+// SSE or long-poll stream) instead of the bearer token
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ServeHTTP handles POST /api/ws/ticket
+func (h *TicketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	ticket, expiresAt := h.tickets.Issue(user)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, TicketResponse{
+		Ticket:    ticket,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
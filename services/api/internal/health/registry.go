@@ -0,0 +1,120 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// defaultCheckTimeout bounds how long a single check may take
+const defaultCheckTimeout = 3 * time.Second
+
+// Checker checks the health of a single dependency or subsystem
+type Checker interface {
+	// Name identifies the check in health responses
+	Name() string
+	// Check returns an error when the dependency is unhealthy
+	Check(ctx context.Context) error
+}
+
+// checkerFunc adapts a function to the Checker interface
+type checkerFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewChecker creates a Checker from a function
+func NewChecker(name string, fn func(ctx context.Context) error) Checker {
+	return &checkerFunc{name: name, fn: fn}
+}
+
+func (c *checkerFunc) Name() string                    { return c.name }
+func (c *checkerFunc) Check(ctx context.Context) error { return c.fn(ctx) }
+
+// lastFailure records the most recent failure of a check
+type lastFailure struct {
+	err string
+	at  time.Time
+}
+
+// Registry holds the health checks registered by subsystems (Redis, Cosmos, Service Bus, ...)
+type Registry struct {
+	checkers []Checker
+	failures map[string]lastFailure
+	timeout  time.Duration
+	mu       sync.RWMutex
+}
+
+// NewRegistry creates an empty health check registry
+func NewRegistry() *Registry {
+	return &Registry{
+		failures: make(map[string]lastFailure),
+		timeout:  defaultCheckTimeout,
+	}
+}
+
+// Register adds a check to the registry
+func (r *Registry) Register(checker Checker) {
+	r.mu.Lock()
+	r.checkers = append(r.checkers, checker)
+	r.mu.Unlock()
+}
+
+// Run executes all checks concurrently and reports whether every check passed
+func (r *Registry) Run(ctx context.Context) ([]models.CheckResult, bool) {
+	r.mu.RLock()
+	checkers := append([]Checker(nil), r.checkers...)
+	r.mu.RUnlock()
+
+	results := make([]models.CheckResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			results[i] = r.runCheck(ctx, checker)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	healthy := true
+	for _, result := range results {
+		if result.Status != models.CheckStatusOK {
+			healthy = false
+		}
+	}
+	return results, healthy
+}
+
+// runCheck executes one check with a timeout and records its outcome
+func (r *Registry) runCheck(ctx context.Context, checker Checker) models.CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.Check(ctx)
+	latency := time.Since(start)
+
+	result := models.CheckResult{
+		Name:      checker.Name(),
+		Status:    models.CheckStatusOK,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+	}
+
+	r.mu.Lock()
+	if err != nil {
+		result.Status = models.CheckStatusFailed
+		result.Error = err.Error()
+		r.failures[checker.Name()] = lastFailure{err: err.Error(), at: time.Now().UTC()}
+	}
+	if failure, ok := r.failures[checker.Name()]; ok {
+		at := failure.at
+		result.LastError = failure.err
+		result.LastErrorAt = &at
+	}
+	r.mu.Unlock()
+
+	return result
+}
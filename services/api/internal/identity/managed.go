@@ -0,0 +1,113 @@
+// Package identity acquires Microsoft Entra ID access tokens for the app's managed identity
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// imdsEndpoint is the Azure Instance Metadata Service token endpoint (VMs, AKS)
+const imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// refreshMargin renews cached tokens this long before they expire
+const refreshMargin = 5 * time.Minute
+
+// ManagedIdentity fetches and caches tokens for the system-assigned or a user-assigned
+// managed identity. Container Apps and App Service expose IDENTITY_ENDPOINT and
+// IDENTITY_HEADER; elsewhere the Instance Metadata Service is used.
+type ManagedIdentity struct {
+	clientID string // User-assigned identity client ID; empty for system-assigned
+	client   *http.Client
+	tokens   map[string]cachedToken // Resource -> token
+	mu       sync.Mutex
+}
+
+// cachedToken is an access token and its expiry
+type cachedToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewManagedIdentity creates a token source; clientID selects a user-assigned identity
+func NewManagedIdentity(clientID string) *ManagedIdentity {
+	return &ManagedIdentity{
+		clientID: clientID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		tokens:   make(map[string]cachedToken),
+	}
+}
+
+// Token returns an access token for resource (e.g. "https://servicebus.azure.net")
+func (m *ManagedIdentity) Token(ctx context.Context, resource string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token, ok := m.tokens[resource]; ok && time.Until(token.expiresAt) > refreshMargin {
+		return token.value, nil
+	}
+
+	token, err := m.fetch(ctx, resource)
+	if err != nil {
+		return "", err
+	}
+	m.tokens[resource] = token
+	return token.value, nil
+}
+
+// fetch requests a new token from the managed identity endpoint
+func (m *ManagedIdentity) fetch(ctx context.Context, resource string) (cachedToken, error) {
+	query := url.Values{"resource": {resource}}
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+
+	endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER")
+	var req *http.Request
+	var err error
+	if endpoint != "" && header != "" {
+		query.Set("api-version", "2019-08-01")
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+		if err == nil {
+			req.Header.Set("X-IDENTITY-HEADER", header)
+		}
+	} else {
+		query.Set("api-version", "2018-02-01")
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, imdsEndpoint+"?"+query.Encode(), nil)
+		if err == nil {
+			req.Header.Set("Metadata", "true")
+		}
+	}
+	if err != nil {
+		return cachedToken{}, err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("managed identity token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return cachedToken{}, fmt.Errorf("managed identity token request returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"` // Unix seconds
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return cachedToken{}, fmt.Errorf("invalid managed identity token response: %w", err)
+	}
+	expiresOn, err := strconv.ParseInt(body.ExpiresOn, 10, 64)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("invalid managed identity token expiry %q", body.ExpiresOn)
+	}
+
+	return cachedToken{value: body.AccessToken, expiresAt: time.Unix(expiresOn, 0)}, nil
+}
@@ -0,0 +1,321 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"api-service/internal/attachments"
+	"api-service/internal/handlers"
+	"api-service/internal/store"
+	"api-service/internal/testidp"
+)
+
+// TestFlows runs every flow against two replicas on each backplane
+func TestFlows(t *testing.T) {
+	flows := []struct {
+		name string
+		run  func(t *testing.T, h *Harness)
+	}{
+		{"connect, send, receive and history", connectSendReceiveHistory},
+		{"topic events cross replicas", publishAcrossReplicas},
+		{"attachments upload, complete and download", attachmentRoundTrip},
+		{"tokens of another issuer are refused", foreignTokenRefused},
+	}
+
+	for _, backplane := range []string{backplaneRedis, backplaneNATS} {
+		t.Run(backplane, func(t *testing.T) {
+			h := start(t, backplane)
+			for _, flow := range flows {
+				t.Run(flow.name, func(t *testing.T) {
+					flow.run(t, h)
+				})
+			}
+		})
+	}
+}
+
+// user is a user of a flow, with a token from the identity provider
+type user struct {
+	ID    string
+	Name  string
+	Token string
+}
+
+// newUser mints a token for a user with a unique ID, so flows don't see each other's data
+func newUser(h *Harness, name string) *user {
+	b := make([]byte, 6)
+	rand.Read(b)
+	id := strings.ToLower(name) + "-" + hex.EncodeToString(b)
+	return &user{
+		ID:    id,
+		Name:  name,
+		Token: h.IdP.Token(testidp.Claims{"oid": id, "name": name, "email": id + "@example.com"}),
+	}
+}
+
+// flowContext returns a context bounding one flow to a minute
+func flowContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// wsEvent is an event received over the WebSocket (protocol v1)
+type wsEvent struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// dial opens a WebSocket as u, authenticating with the bearer subprotocol
+func dial(ctx context.Context, h *Harness, u *user) (*websocket.Conn, *http.Response, error) {
+	wsURL := "ws" + strings.TrimPrefix(h.BaseURL, "http") + "/api/v1/ws"
+	dialer := websocket.Dialer{Subprotocols: []string{"bearer", u.Token}, HandshakeTimeout: 10 * time.Second}
+	return dialer.DialContext(ctx, wsURL, nil)
+}
+
+// connect opens a WebSocket as u and waits until the server has registered it (its welcome
+// user_joined event). The connection is closed when the test ends.
+func connect(ctx context.Context, t *testing.T, h *Harness, u *user) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := dial(ctx, h, u)
+	if err != nil {
+		if resp != nil {
+			t.Fatalf("connecting as %s: %v (status %d)", u.ID, err, resp.StatusCode)
+		}
+		t.Fatalf("connecting as %s: %v", u.ID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	waitForEvent(t, conn, "user_joined", func(payload json.RawMessage) bool {
+		var joined struct {
+			UserID string `json:"user_id"`
+		}
+		return json.Unmarshal(payload, &joined) == nil && joined.UserID == u.ID
+	})
+	return conn
+}
+
+// waitForEvent reads events until one of the type matches, for up to 10 seconds
+func waitForEvent(t *testing.T, conn *websocket.Conn, eventType string, match func(json.RawMessage) bool) json.RawMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var event wsEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("waiting for a %s event: %v", eventType, err)
+		}
+		if event.Type == eventType && (match == nil || match(event.Payload)) {
+			return event.Payload
+		}
+	}
+}
+
+// sendMessage sends a direct message over REST from one user to another connected to the
+// same replica, returning its ID
+func sendMessage(ctx context.Context, t *testing.T, h *Harness, from, to *user, content string) string {
+	t.Helper()
+	var sent handlers.SendMessageResponse
+	resp, err := h.Do(ctx, http.MethodPost, "/api/v1/messages/send", from.Token, map[string]string{"to": to.ID, "content": content}, &sent)
+	if err != nil {
+		t.Fatalf("sending a message: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || sent.MessageID == "" {
+		t.Fatalf("sending a message: status %d, message ID %q", resp.StatusCode, sent.MessageID)
+	}
+	return sent.MessageID
+}
+
+// connectSendReceiveHistory sends a message over REST to a connected user, who receives it
+// on the WebSocket and then finds it in the history (stored in PostgreSQL) read through the
+// other replica. Direct messages are delivered by the replica that receives them, so both
+// users use the same one.
+func connectSendReceiveHistory(t *testing.T, h *Harness) {
+	ctx := flowContext(t)
+	alice, bob := newUser(h, "Alice"), newUser(h, "Bob")
+	conn := connect(ctx, t, h, bob)
+
+	content := "hello from " + alice.ID
+	messageID := sendMessage(ctx, t, h, alice, bob, content)
+
+	payload := waitForEvent(t, conn, "chat", nil)
+	var received struct {
+		From    string `json:"from"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(payload, &received); err != nil {
+		t.Fatalf("decoding the chat event: %v", err)
+	}
+	if received.From != alice.ID || received.Content != content {
+		t.Fatalf("received %q from %s, want %q from %s", received.Content, received.From, content, alice.ID)
+	}
+
+	var history handlers.MessageHistoryResponse
+	resp, err := h.Peer.Do(ctx, http.MethodGet, "/api/v1/messages?with="+url.QueryEscape(alice.ID), bob.Token, nil, &history)
+	if err != nil {
+		t.Fatalf("fetching the history: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("fetching the history: status %d", resp.StatusCode)
+	}
+	for _, message := range history.Messages {
+		if message.ID == messageID {
+			if message.SenderID != alice.ID || message.Message == nil || message.Message.Text != content {
+				t.Fatalf("history has message %s from %s with %+v", message.ID, message.SenderID, message.Message)
+			}
+			return
+		}
+	}
+	t.Fatalf("message %s missing from the history (%d messages)", messageID, history.Count)
+}
+
+// publishAcrossReplicas publishes a topic event on one replica to a subscriber connected to
+// the other, which receives it through the backplane
+func publishAcrossReplicas(t *testing.T, h *Harness) {
+	ctx := flowContext(t)
+	alice, bob := newUser(h, "Alice"), newUser(h, "Bob")
+	conn := connect(ctx, t, h.Peer, bob)
+
+	topic := "flows." + bob.ID
+	if err := conn.WriteJSON(map[string]interface{}{"type": "subscribe", "payload": map[string]string{"topic": topic}}); err != nil {
+		t.Fatalf("subscribing to %s: %v", topic, err)
+	}
+	waitForEvent(t, conn, "subscribed", nil)
+
+	var published handlers.PublishTopicEventResponse
+	resp, err := h.Do(ctx, http.MethodPost, "/api/v1/topics/"+topic+"/events", alice.Token, map[string]interface{}{"data": map[string]string{"from": alice.ID}}, &published)
+	if err != nil {
+		t.Fatalf("publishing on %s: %v", topic, err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("publishing on %s: status %d", topic, resp.StatusCode)
+	}
+
+	payload := waitForEvent(t, conn, "topic_event", nil)
+	var received struct {
+		Topic string            `json:"topic"`
+		From  string            `json:"from"`
+		Data  map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &received); err != nil {
+		t.Fatalf("decoding the topic event: %v", err)
+	}
+	if received.Topic != topic || received.From != alice.ID || received.Data["from"] != alice.ID {
+		t.Fatalf("received %+v, want an event on %s from %s", received, topic, alice.ID)
+	}
+}
+
+// attachmentRoundTrip uploads a file to Azurite with the URL from initiate, attaches it to a
+// message and downloads it through the other replica. Writing to the upload URL again after
+// completing must not change the attached file.
+func attachmentRoundTrip(t *testing.T, h *Harness) {
+	ctx := flowContext(t)
+	alice, bob := newUser(h, "Alice"), newUser(h, "Bob")
+	connect(ctx, t, h, bob)
+	messageID := sendMessage(ctx, t, h, alice, bob, "a file for "+bob.ID)
+
+	content := []byte("attached by " + alice.ID)
+	var upload attachments.Upload
+	resp, err := h.Do(ctx, http.MethodPost, "/api/v1/attachments/initiate", alice.Token,
+		map[string]interface{}{"fileName": "notes.txt", "contentType": "text/plain", "size": len(content)}, &upload)
+	if err != nil {
+		t.Fatalf("initiating an upload: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("initiating an upload: status %d", resp.StatusCode)
+	}
+	put(ctx, t, upload, content)
+
+	var msg store.Message
+	resp, err = h.Do(ctx, http.MethodPost, "/api/v1/attachments/complete", alice.Token,
+		map[string]string{"attachmentId": upload.AttachmentID, "messageId": messageID}, &msg)
+	if err != nil {
+		t.Fatalf("completing the upload: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(msg.Attachments) != 1 || msg.Attachments[0].ID != upload.AttachmentID {
+		t.Fatalf("completing the upload: status %d, attachments %+v", resp.StatusCode, msg.Attachments)
+	}
+
+	put(ctx, t, upload, []byte("replaced after completing"))
+
+	var download attachments.Download
+	resp, err = h.Peer.Do(ctx, http.MethodGet, "/api/v1/messages/"+messageID+"/attachments/"+upload.AttachmentID, bob.Token, nil, &download)
+	if err != nil {
+		t.Fatalf("fetching the download URL: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("fetching the download URL: status %d", resp.StatusCode)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download.URL, nil)
+	if err != nil {
+		t.Fatalf("downloading the attachment: %v", err)
+	}
+	fileResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("downloading the attachment: %v", err)
+	}
+	defer fileResp.Body.Close()
+	data, err := io.ReadAll(fileResp.Body)
+	if err != nil || fileResp.StatusCode != http.StatusOK {
+		t.Fatalf("downloading the attachment: status %d, %v", fileResp.StatusCode, err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("downloaded %q, want %q", data, content)
+	}
+}
+
+// put uploads data to an upload URL with the headers initiate asked for
+func put(ctx context.Context, t *testing.T, upload attachments.Upload, data []byte) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, upload.URL, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("uploading: %v", err)
+	}
+	for name, value := range upload.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("uploading: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("uploading: status %d", resp.StatusCode)
+	}
+}
+
+// foreignTokenRefused checks that tokens signed by another provider are refused on REST
+// and WebSocket requests
+func foreignTokenRefused(t *testing.T, h *Harness) {
+	ctx := flowContext(t)
+	other := testidp.New()
+	t.Cleanup(other.Close)
+	other.TenantID, other.ClientID = h.IdP.TenantID, h.IdP.ClientID
+	token := other.Token(testidp.Claims{"iss": h.IdP.Issuer()})
+
+	resp, err := h.Do(ctx, http.MethodGet, "/api/v1/user/me", token, nil, nil)
+	if err != nil {
+		t.Fatalf("GET /api/v1/user/me: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /api/v1/user/me with a foreign token: status %d, want 401", resp.StatusCode)
+	}
+
+	if conn, _, err := dial(ctx, h, &user{ID: "intruder", Token: token}); err == nil {
+		conn.Close()
+		t.Errorf("WebSocket accepted a foreign token")
+	}
+}
@@ -0,0 +1,376 @@
+//go:build integration
+
+// Package integration runs the API end to end against real dependencies: PostgreSQL (message
+// store), Azurite (attachments) and a Redis or NATS backplane in containers started by
+// testcontainers-go, with tokens from the in-memory identity provider (see testidp). Two
+// replicas of the server share them, and the tests drive both over HTTP and WebSocket like
+// clients would, so events published on one replica reach clients of the other through the
+// backplane.
+//
+// It is built with the integration tag only; with Docker available, run it with:
+//
+//	go test -tags integration ./internal/integration/
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"api-service/internal/testidp"
+)
+
+// apiBinary is the API server, built once for every test (see TestMain)
+var apiBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "api-integration-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating a build directory: %v\n", err)
+		os.Exit(1)
+	}
+	apiBinary = filepath.Join(dir, "api-service")
+	build := exec.Command("go", "build", "-o", apiBinary, "./cmd/api")
+	build.Dir = filepath.Join("..", "..")
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building the API: %v: %s\n", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// Backplanes the suite runs against
+const (
+	backplaneRedis = "redis"
+	backplaneNATS  = "nats"
+)
+
+// Azurite's well-known development account
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// attachmentsContainer is the container attachments are stored in (ATTACHMENTS_CONTAINER's
+// default)
+const attachmentsContainer = "attachments"
+
+// Harness is a running API server with its dependencies, stopped when the test ends
+type Harness struct {
+	BaseURL string // e.g. http://127.0.0.1:43121
+	IdP     *testidp.Provider
+	Peer    *Harness // A second replica sharing the dependencies; nil on the peer itself
+}
+
+// start starts PostgreSQL, Azurite, the backplane, the identity provider and two replicas of
+// the API server, and waits until both are ready. Everything is torn down by t.Cleanup.
+func start(t *testing.T, backplane string) *Harness {
+	t.Helper()
+	ctx := context.Background()
+
+	env := []string{
+		"MESSAGE_STORE=postgres",
+		"POSTGRES_URL=" + startPostgres(ctx, t),
+		"BACKPLANE=" + backplane,
+		"ATTACHMENTS_STORAGE_URL=" + startAzurite(ctx, t),
+		"ATTACHMENTS_STORAGE_KEY=" + azuriteKey,
+		"ATTACHMENTS_THUMBNAIL_SIZES=none", // Thumbnails need a container with anonymous reads
+	}
+	switch backplane {
+	case backplaneRedis:
+		env = append(env, "REDIS_URL="+startRedis(ctx, t))
+	case backplaneNATS:
+		env = append(env, "NATS_URL="+startNATS(ctx, t))
+	default:
+		t.Fatalf("unknown backplane %q", backplane)
+	}
+
+	h := &Harness{IdP: testidp.New()}
+	t.Cleanup(h.IdP.Close)
+	h.startServer(t, "replica-1", env)
+	h.Peer = &Harness{IdP: h.IdP}
+	h.Peer.startServer(t, "replica-2", env)
+	return h
+}
+
+// startPostgres runs PostgreSQL, returning its connection URL
+func startPostgres(ctx context.Context, t *testing.T) string {
+	t.Helper()
+	container, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("chat"),
+		tcpostgres.WithUsername("postgres"),
+		tcpostgres.WithPassword("postgres"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	terminateOnCleanup(t, container)
+	if err != nil {
+		t.Fatalf("starting PostgreSQL: %v", err)
+	}
+	url, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("PostgreSQL connection string: %v", err)
+	}
+	return url
+}
+
+// startRedis runs Redis, returning its connection URL
+func startRedis(ctx context.Context, t *testing.T) string {
+	t.Helper()
+	container, err := tcredis.Run(ctx, "redis:7-alpine")
+	terminateOnCleanup(t, container)
+	if err != nil {
+		t.Fatalf("starting Redis: %v", err)
+	}
+	url, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("Redis connection string: %v", err)
+	}
+	return url
+}
+
+// startNATS runs a NATS server, returning its URL
+func startNATS(ctx context.Context, t *testing.T) string {
+	t.Helper()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "nats:2.10-alpine",
+			ExposedPorts: []string{"4222/tcp"},
+			WaitingFor:   wait.ForLog("Server is ready"),
+		},
+		Started: true,
+	})
+	terminateOnCleanup(t, container)
+	if err != nil {
+		t.Fatalf("starting NATS: %v", err)
+	}
+	endpoint, err := container.PortEndpoint(ctx, "4222/tcp", "nats")
+	if err != nil {
+		t.Fatalf("NATS endpoint: %v", err)
+	}
+	return endpoint
+}
+
+// startAzurite runs Azurite's Blob service and creates the attachments container in it,
+// returning the account URL
+func startAzurite(ctx context.Context, t *testing.T) string {
+	t.Helper()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "mcr.microsoft.com/azure-storage/azurite",
+			Cmd:          []string{"azurite-blob", "--blobHost", "0.0.0.0", "--skipApiVersionCheck"},
+			ExposedPorts: []string{"10000/tcp"},
+			WaitingFor:   wait.ForListeningPort("10000/tcp"),
+		},
+		Started: true,
+	})
+	terminateOnCleanup(t, container)
+	if err != nil {
+		t.Fatalf("starting Azurite: %v", err)
+	}
+	endpoint, err := container.PortEndpoint(ctx, "10000/tcp", "http")
+	if err != nil {
+		t.Fatalf("Azurite endpoint: %v", err)
+	}
+	accountURL := endpoint + "/" + azuriteAccount
+	createContainer(ctx, t, accountURL, attachmentsContainer)
+	return accountURL
+}
+
+// createContainer creates a blob container, authorized with the account key (Shared Key),
+// since a SAS can't create containers
+func createContainer(ctx context.Context, t *testing.T, accountURL, name string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, accountURL+"/"+name+"?restype=container", nil)
+	if err != nil {
+		t.Fatalf("creating container %s: %v", name, err)
+	}
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("x-ms-version", "2021-08-06")
+
+	// The verb, eleven standard headers (all empty), the x-ms- headers and the resource
+	stringToSign := http.MethodPut + strings.Repeat("\n", 12) +
+		"x-ms-date:" + date + "\nx-ms-version:2021-08-06\n" +
+		"/" + azuriteAccount + req.URL.Path + "\nrestype:container"
+	key, _ := base64.StdEncoding.DecodeString(azuriteKey)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+azuriteAccount+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("creating container %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("creating container %s: status %d: %s", name, resp.StatusCode, body)
+	}
+}
+
+// terminateOnCleanup removes a container when the test ends. The container is returned along
+// with the error when it started but never became ready, so it's registered before the error
+// is checked.
+func terminateOnCleanup(t *testing.T, container testcontainers.Container) {
+	t.Cleanup(func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			t.Errorf("removing a container: %v", err)
+		}
+	})
+}
+
+// startServer runs the API as the replica named instance with the identity provider's
+// configuration and env, in a temporary directory so a developer's .env isn't picked up, and
+// waits until it's ready. Its log is printed when the test fails.
+func (h *Harness) startServer(t *testing.T, instance string, env []string) {
+	t.Helper()
+	port := freePort(t)
+	h.BaseURL = "http://127.0.0.1:" + port
+
+	workDir := t.TempDir()
+	logFile, err := os.Create(filepath.Join(workDir, "api.log"))
+	if err != nil {
+		t.Fatalf("creating the server log: %v", err)
+	}
+
+	cfg := h.IdP.Config()
+	server := exec.Command(apiBinary)
+	server.Dir = workDir
+	server.Env = append(os.Environ(),
+		"PORT="+port,
+		"AZURE_TENANT_ID="+cfg.AzureTenantID,
+		"AZURE_CLIENT_ID="+cfg.AzureClientID,
+		"AUTH_JWKS_URL="+cfg.AuthJWKSURL,
+		"AUTH_ISSUER="+cfg.AuthIssuer,
+		"SKIP_TOKEN_VERIFICATION=false",
+		"INSTANCE_ID="+instance,
+	)
+	server.Env = append(server.Env, env...)
+	server.Stdout = logFile
+	server.Stderr = logFile
+	if err := server.Start(); err != nil {
+		t.Fatalf("starting the API: %v", err)
+	}
+
+	// Registered after the containers' cleanups, so it runs before them
+	t.Cleanup(func() {
+		server.Process.Signal(os.Interrupt)
+		done := make(chan struct{})
+		go func() {
+			server.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(30 * time.Second):
+			server.Process.Kill()
+			<-done
+		}
+		logFile.Close()
+		if t.Failed() {
+			data, _ := os.ReadFile(logFile.Name())
+			t.Logf("API server log (%s):\n%s", instance, data)
+		}
+	})
+
+	waitFor(t, "api server", func(ctx context.Context) error {
+		resp, err := h.Do(ctx, http.MethodGet, "/readyz", "", nil, nil)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("readyz returned %d", resp.StatusCode)
+		}
+		return err
+	})
+}
+
+// Do sends a request to the server with token (if any) and body encoded as JSON (if any),
+// decoding a 2xx JSON response into out (if any)
+func (h *Harness) Do(ctx context.Context, method, path, token string, body, out interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if out != nil && resp.StatusCode/100 == 2 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp, fmt.Errorf("decoding %s %s: %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
+
+// waitFor retries check until it succeeds, failing the test after a minute
+func waitFor(t *testing.T, what string, check func(ctx context.Context) error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for {
+		attemptCtx, cancelAttempt := context.WithTimeout(ctx, 5*time.Second)
+		err := check(attemptCtx)
+		cancelAttempt()
+		if err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s not ready: %v", what, err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// freePort returns a local TCP port that was free a moment ago
+func freePort(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("finding a free port: %v", err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
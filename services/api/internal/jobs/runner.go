@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"api-service/internal/locks"
+)
+
+// DefaultLockTTL is how long a job lock is held without renewal
+const DefaultLockTTL = 30 * time.Second
+
+// Job is a periodic background task that must run on exactly one instance
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Status describes a job and the instance currently running it
+type Status struct {
+	Name           string      `json:"name"`
+	Interval       string      `json:"interval"`
+	Leader         bool        `json:"leader"` // this instance holds the job lock
+	Holder         *locks.Info `json:"holder"` // current lock holder, from the lock backend
+	HolderError    string      `json:"holderError,omitempty"`
+	LastRunAt      *time.Time  `json:"lastRunAt,omitempty"` // last run on this instance
+	LastDurationMs float64     `json:"lastDurationMs,omitempty"`
+	LastError      string      `json:"lastError,omitempty"`
+}
+
+// Runner runs singleton jobs. Each job has its own lock: the instance holding it is the
+// job's leader and runs it every Interval, renewing the lock until it shuts down or loses it.
+type Runner struct {
+	locker  locks.Locker
+	lockTTL time.Duration
+
+	mu      sync.Mutex
+	jobs    []*jobState
+	started bool
+	loops   sync.WaitGroup
+}
+
+type jobState struct {
+	job Job
+
+	mu           sync.Mutex
+	leader       bool
+	lastRunAt    time.Time
+	lastDuration time.Duration
+	lastError    string
+}
+
+// NewRunner creates a job runner using locker for leader election
+func NewRunner(locker locks.Locker, lockTTL time.Duration) *Runner {
+	if lockTTL <= 0 {
+		lockTTL = DefaultLockTTL
+	}
+	return &Runner{
+		locker:  locker,
+		lockTTL: lockTTL,
+	}
+}
+
+// Register adds a job. Jobs must be registered before Start.
+func (r *Runner) Register(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started {
+		log.Printf("⚠️  Job %s registered after start; ignoring", job.Name)
+		return
+	}
+	r.jobs = append(r.jobs, &jobState{job: job})
+}
+
+// Start launches the election loop of every registered job. Locks are released when ctx is cancelled.
+func (r *Runner) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = true
+	for _, state := range r.jobs {
+		r.loops.Add(1)
+		go func() {
+			defer r.loops.Done()
+			r.loop(ctx, state)
+		}()
+	}
+}
+
+// Wait blocks until every job loop has stopped, after the context given to Start is cancelled,
+// including any run in progress and the release of held locks
+func (r *Runner) Wait() {
+	r.loops.Wait()
+}
+
+// Backend names the lock backend in use
+func (r *Runner) Backend() string {
+	return r.locker.Backend()
+}
+
+// Statuses returns the state of every job, including the current lock holder
+func (r *Runner) Statuses(ctx context.Context) []Status {
+	r.mu.Lock()
+	jobs := append([]*jobState(nil), r.jobs...)
+	r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(jobs))
+	for _, state := range jobs {
+		state.mu.Lock()
+		status := Status{
+			Name:      state.job.Name,
+			Interval:  state.job.Interval.String(),
+			Leader:    state.leader,
+			LastError: state.lastError,
+		}
+		if !state.lastRunAt.IsZero() {
+			lastRunAt := state.lastRunAt
+			status.LastRunAt = &lastRunAt
+			status.LastDurationMs = float64(state.lastDuration.Microseconds()) / 1000
+		}
+		state.mu.Unlock()
+
+		holder, err := r.locker.Holder(ctx, state.job.Name)
+		if err != nil {
+			status.HolderError = err.Error()
+		}
+		status.Holder = holder
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// loop contends for the job lock, renews it while held, and runs the job on its interval
+func (r *Runner) loop(ctx context.Context, state *jobState) {
+	name := state.job.Name
+	ticker := time.NewTicker(r.lockTTL / 3)
+	defer ticker.Stop()
+
+	var (
+		lock      locks.Lock
+		nextRun   time.Time
+		running   bool
+		cancelRun context.CancelFunc = func() {}
+		done                         = make(chan struct{})
+	)
+
+	resign := func() {
+		cancelRun()
+		state.setLeader(false)
+		lock = nil
+	}
+
+	for {
+		if lock == nil {
+			acquired, err := r.locker.TryAcquire(ctx, name, r.lockTTL)
+			if err != nil {
+				log.Printf("⚠️  Job %s: failed to acquire lock: %v", name, err)
+			} else if acquired != nil {
+				lock = acquired
+				nextRun = time.Now()
+				state.setLeader(true)
+				log.Printf("👑 Job %s: this instance is now the leader", name)
+			}
+		} else if err := lock.Renew(ctx); err != nil {
+			log.Printf("⚠️  Job %s: lost lock: %v", name, err)
+			resign()
+		}
+
+		if lock != nil && !running && !time.Now().Before(nextRun) {
+			runCtx, cancel := context.WithCancel(ctx)
+			cancelRun = cancel
+			running = true
+			nextRun = time.Now().Add(state.job.Interval)
+			go func() {
+				defer cancel()
+				state.run(runCtx)
+				done <- struct{}{}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			held := lock
+			resign()
+			if running {
+				<-done
+			}
+			if held != nil {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := held.Release(releaseCtx); err != nil {
+					log.Printf("⚠️  Job %s: failed to release lock: %v", name, err)
+				}
+				cancel()
+			}
+			return
+		case <-done:
+			running = false
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes the job once and records the outcome
+func (s *jobState) run(ctx context.Context) {
+	start := time.Now()
+	err := s.job.Run(ctx)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRunAt = start
+	s.lastDuration = duration
+	s.lastError = ""
+	if err != nil {
+		s.lastError = err.Error()
+		log.Printf("❌ Job %s failed after %s: %v", s.job.Name, duration, err)
+	}
+}
+
+func (s *jobState) setLeader(leader bool) {
+	s.mu.Lock()
+	s.leader = leader
+	s.mu.Unlock()
+}
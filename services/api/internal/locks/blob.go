@@ -0,0 +1,116 @@
+package locks
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-service/internal/blob"
+)
+
+// Blob leases must be between 15 and 60 seconds
+const (
+	minLeaseDuration = 15 * time.Second
+	maxLeaseDuration = 60 * time.Second
+)
+
+// BlobLocker implements Locker with Azure Blob Storage leases.
+// Each lock is an empty blob named "<prefix><name>"; the holder identity is stored in its metadata.
+type BlobLocker struct {
+	containerURL string
+	prefix       string
+	holder       string
+}
+
+// NewBlobLocker creates a lease-based locker for a container SAS URL; holder identifies this instance
+func NewBlobLocker(containerURL, holder string) *BlobLocker {
+	return &BlobLocker{
+		containerURL: containerURL,
+		prefix:       "locks/",
+		holder:       holder,
+	}
+}
+
+// TryAcquire leases the lock blob. The TTL is clamped to the 15-60s range supported by Blob leases.
+func (l *BlobLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	ttl = min(max(ttl, minLeaseDuration), maxLeaseDuration)
+
+	leaseID, err := newLeaseID()
+	if err != nil {
+		return nil, err
+	}
+
+	blobName := l.prefix + name
+	if err := blob.AcquireLease(ctx, l.containerURL, blobName, leaseID, ttl); err != nil {
+		if errors.Is(err, blob.ErrLeaseConflict) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	lock := &blobLock{containerURL: l.containerURL, blobName: blobName, leaseID: leaseID}
+	metadata := map[string]string{
+		"holder":     l.holder,
+		"acquiredat": time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := blob.SetMetadata(ctx, l.containerURL, blobName, leaseID, metadata); err != nil {
+		lock.Release(context.WithoutCancel(ctx))
+		return nil, fmt.Errorf("failed to record lock holder: %w", err)
+	}
+	return lock, nil
+}
+
+// Holder reads the holder identity of a leased lock blob
+func (l *BlobLocker) Holder(ctx context.Context, name string) (*Info, error) {
+	props, err := blob.GetProperties(ctx, l.containerURL, l.prefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if props == nil || props.LeaseState != "leased" {
+		return nil, nil
+	}
+
+	info := &Info{Holder: props.Metadata["holder"]}
+	info.AcquiredAt, _ = time.Parse(time.RFC3339, props.Metadata["acquiredat"])
+	return info, nil
+}
+
+// Backend returns "blob"
+func (l *BlobLocker) Backend() string {
+	return "blob"
+}
+
+type blobLock struct {
+	containerURL string
+	blobName     string
+	leaseID      string
+}
+
+// Renew renews the blob lease
+func (b *blobLock) Renew(ctx context.Context) error {
+	if err := blob.RenewLease(ctx, b.containerURL, b.blobName, b.leaseID); err != nil {
+		if errors.Is(err, blob.ErrLeaseConflict) {
+			return ErrLockLost
+		}
+		return err
+	}
+	return nil
+}
+
+// Release releases the blob lease so another instance can take over immediately
+func (b *blobLock) Release(ctx context.Context) error {
+	return blob.ReleaseLease(ctx, b.containerURL, b.blobName, b.leaseID)
+}
+
+// newLeaseID generates a random GUID, as required for proposed lease IDs
+func newLeaseID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate lease ID: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,32 @@
+package locks
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLockLost is returned when renewing a lock that has expired or been taken over
+var ErrLockLost = errors.New("lock lost")
+
+// Locker grants named, expiring locks shared by every instance of the service
+type Locker interface {
+	// TryAcquire attempts to take the named lock for ttl. It returns (nil, nil) if another holder has it.
+	TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+	// Holder reports who currently holds the named lock, or nil if it is free
+	Holder(ctx context.Context, name string) (*Info, error)
+	// Backend names the implementation (e.g. "memory", "blob")
+	Backend() string
+}
+
+// Lock is a held lock that must be renewed before its TTL elapses
+type Lock interface {
+	Renew(ctx context.Context) error
+	Release(ctx context.Context) error
+}
+
+// Info describes the current holder of a lock
+type Info struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
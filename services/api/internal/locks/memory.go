@@ -0,0 +1,91 @@
+package locks
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker is a process-local Locker, suitable only for single-instance deployments
+type MemoryLocker struct {
+	holder string
+
+	mu    sync.Mutex
+	locks map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	token      *memoryLock
+	acquiredAt time.Time
+	expiresAt  time.Time
+}
+
+// NewMemoryLocker creates a process-local locker; holder identifies this instance
+func NewMemoryLocker(holder string) *MemoryLocker {
+	return &MemoryLocker{
+		holder: holder,
+		locks:  make(map[string]*memoryEntry),
+	}
+}
+
+// TryAcquire takes the named lock if it is free or expired
+func (l *MemoryLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := l.locks[name]; ok && now.Before(entry.expiresAt) {
+		return nil, nil
+	}
+
+	lock := &memoryLock{locker: l, name: name, ttl: ttl}
+	l.locks[name] = &memoryEntry{token: lock, acquiredAt: now, expiresAt: now.Add(ttl)}
+	return lock, nil
+}
+
+// Holder reports the current holder of the named lock
+func (l *MemoryLocker) Holder(ctx context.Context, name string) (*Info, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.locks[name]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, nil
+	}
+	return &Info{Holder: l.holder, AcquiredAt: entry.acquiredAt}, nil
+}
+
+// Backend returns "memory"
+func (l *MemoryLocker) Backend() string {
+	return "memory"
+}
+
+type memoryLock struct {
+	locker *MemoryLocker
+	name   string
+	ttl    time.Duration
+}
+
+// Renew extends the lock by its TTL
+func (m *memoryLock) Renew(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	entry, ok := m.locker.locks[m.name]
+	if !ok || entry.token != m || time.Now().After(entry.expiresAt) {
+		return ErrLockLost
+	}
+	entry.expiresAt = time.Now().Add(m.ttl)
+	return nil
+}
+
+// Release frees the lock if it is still held
+func (m *memoryLock) Release(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	if entry, ok := m.locker.locks[m.name]; ok && entry.token == m {
+		delete(m.locker.locks, m.name)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Package longpoll delivers realtime events to clients that can use neither WebSockets nor SSE.
+// Each user gets a subscription with the event manager that outlives individual poll requests;
+// events are buffered between polls and handed out after the client's cursor.
+package longpoll
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/chat"
+	"api-service/internal/models"
+)
+
+// bufferSize is the number of undelivered events kept per session; older ones are dropped
+const bufferSize = 256
+
+// Result is the response to one poll
+type Result struct {
+	Events []json.RawMessage `json:"events"` // v2 event envelopes, oldest first
+	Cursor string            `json:"cursor"` // Pass as ?cursor= on the next poll
+	Reset  bool              `json:"reset"`  // Events may have been missed (new session or buffer overflow)
+}
+
+// entry is a buffered event and its sequence number
+type entry struct {
+	seq  int64
+	data json.RawMessage
+}
+
+// session is a user's subscription between polls
+type session struct {
+	id          string // Distinguishes sessions in cursors, so a stale cursor is detected
+	entries     []entry
+	nextSeq     int64
+	dropped     bool          // Events were discarded since the last poll
+	notify      chan struct{} // Closed and replaced when events arrive
+	lastPoll    time.Time
+	polling     int
+	closed      bool
+	unsubscribe func()
+}
+
+// Poller manages long-poll sessions
+type Poller struct {
+	chat     *chat.Service
+	idle     time.Duration
+	sessions map[string]*session // User ID -> session
+	mu       sync.Mutex
+}
+
+// NewPoller creates a poller; sessions not polled for idle are closed
+func NewPoller(chatService *chat.Service, idle time.Duration) *Poller {
+	p := &Poller{
+		chat:     chatService,
+		idle:     idle,
+		sessions: make(map[string]*session),
+	}
+	go p.expireLoop()
+	return p
+}
+
+// Poll returns the user's events after cursor, waiting up to wait for new ones when none are
+// buffered. Events up to cursor are acknowledged and discarded.
+func (p *Poller) Poll(ctx context.Context, user *models.User, cursor string, wait time.Duration) Result {
+	s, created := p.session(user)
+
+	p.mu.Lock()
+	s.polling++
+	reset := created || s.dropped
+	if sessionID, seq, ok := parseCursor(cursor); ok && sessionID == s.id {
+		s.ack(seq)
+	} else if cursor != "" {
+		reset = true // Cursor from an expired session
+	}
+	s.dropped = false
+	notify := s.notify
+	empty := len(s.entries) == 0
+	p.mu.Unlock()
+
+	if empty && !reset {
+		timer := time.NewTimer(wait)
+		select {
+		case <-notify:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s.polling--
+	s.lastPoll = time.Now()
+
+	result := Result{Events: []json.RawMessage{}, Reset: reset || s.dropped, Cursor: formatCursor(s.id, s.nextSeq-1)}
+	for _, e := range s.entries {
+		result.Events = append(result.Events, e.data)
+	}
+	s.dropped = false
+	return result
+}
+
+// session returns the user's session, subscribing a new one if needed (created is true then)
+func (p *Poller) session(user *models.User) (s *session, created bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.sessions[user.ID]; ok && !s.closed {
+		return s, false
+	}
+
+	stream, unsubscribe := p.chat.Subscribe(user)
+	s = &session{
+		id:          strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextSeq:     1,
+		notify:      make(chan struct{}),
+		lastPoll:    time.Now(),
+		unsubscribe: unsubscribe,
+	}
+	p.sessions[user.ID] = s
+	go p.collect(user, s, stream)
+
+	log.Printf("Long-poll session started: %s (%s)", user.Name, user.ID)
+	return s, true
+}
+
+// collect buffers a session's events until its subscription ends
+func (p *Poller) collect(user *models.User, s *session, stream <-chan []byte) {
+	for data := range stream {
+		p.mu.Lock()
+		s.entries = append(s.entries, entry{seq: s.nextSeq, data: data})
+		s.nextSeq++
+		if len(s.entries) > bufferSize {
+			s.entries = s.entries[len(s.entries)-bufferSize:]
+			s.dropped = true
+		}
+		close(s.notify)
+		s.notify = make(chan struct{})
+		p.mu.Unlock()
+	}
+
+	// The subscription ended: expired, or replaced by another connection of the user
+	p.mu.Lock()
+	s.closed = true
+	if p.sessions[user.ID] == s {
+		delete(p.sessions, user.ID)
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+	p.mu.Unlock()
+	log.Printf("Long-poll session ended: %s (%s)", user.Name, user.ID)
+}
+
+// ack discards events up to and including seq (caller holds the lock)
+func (s *session) ack(seq int64) {
+	i := 0
+	for i < len(s.entries) && s.entries[i].seq <= seq {
+		i++
+	}
+	s.entries = s.entries[i:]
+}
+
+// expireLoop closes sessions that haven't been polled for the idle timeout
+func (p *Poller) expireLoop() {
+	ticker := time.NewTicker(p.idle / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-p.idle)
+
+		p.mu.Lock()
+		var expired []*session
+		for _, s := range p.sessions {
+			if s.polling == 0 && s.lastPoll.Before(cutoff) {
+				expired = append(expired, s)
+			}
+		}
+		p.mu.Unlock()
+
+		// The session is removed by collect once the subscription's channel closes
+		for _, s := range expired {
+			s.unsubscribe()
+		}
+	}
+}
+
+// formatCursor encodes a session ID and the last sequence number handed out
+func formatCursor(sessionID string, seq int64) string {
+	return sessionID + "." + strconv.FormatInt(seq, 10)
+}
+
+// parseCursor decodes a cursor from formatCursor
+func parseCursor(cursor string) (sessionID string, seq int64, ok bool) {
+	sessionID, seqText, found := strings.Cut(cursor, ".")
+	if !found {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	return sessionID, seq, err == nil
+}
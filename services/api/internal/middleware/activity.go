@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"api-service/internal/models"
+)
+
+// Activity describes a successful state-changing request
+type Activity struct {
+	Method string
+	Route  string            // Route pattern relative to the API root, e.g. "/admin/tenants/{id}/freeze"
+	Path   string            // Request path relative to the API root, e.g. "/admin/tenants/contoso/freeze"
+	Params map[string]string // Route parameters
+	Status int
+	User   *models.User // Nil if unauthenticated
+}
+
+// ActivityMiddleware reports successful state-changing requests, e.g. to publish them as events
+type ActivityMiddleware struct {
+	report func(Activity)
+}
+
+// NewActivityMiddleware creates a middleware calling report after each successful
+// (2xx) request that isn't a GET, HEAD or OPTIONS. report must not block.
+func NewActivityMiddleware(report func(Activity)) *ActivityMiddleware {
+	return &ActivityMiddleware{
+		report: report,
+	}
+}
+
+// statusRecorder captures the response status
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Middleware wraps an http.Handler with activity reporting
+func (am *ActivityMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status < 200 || recorder.status > 299 {
+			return
+		}
+
+		activity := Activity{
+			Method: r.Method,
+			Path:   apiRelative(r.URL.Path),
+			Params: make(map[string]string),
+			Status: recorder.status,
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			activity.Route = apiRelative(rctx.RoutePattern())
+			for i, key := range rctx.URLParams.Keys {
+				if key != "*" { // Mount wildcards
+					activity.Params[key] = rctx.URLParams.Values[i]
+				}
+			}
+		}
+		activity.User, _ = GetUserFromContext(r.Context())
+		am.report(activity)
+	})
+}
+
+// apiRelative strips the /api/v1 or legacy /api mount prefix
+func apiRelative(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/api/v1/"); ok {
+		return "/" + rest
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/"); ok {
+		return "/" + rest
+	}
+	return path
+}
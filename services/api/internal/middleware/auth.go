@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -13,8 +14,10 @@ import (
 	"sync"
 	"time"
 
+	"api-service/internal/audit"
 	"api-service/internal/config"
 	"api-service/internal/models"
+	"api-service/internal/problem"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -27,6 +30,18 @@ const (
 	UserContextKey contextKey = "user"
 )
 
+// Token validation failures. Each maps to its own problem type so clients can tell them apart.
+var (
+	ErrTokenExpired      = errors.New("token expired")
+	ErrTokenNotYetValid  = errors.New("token not yet valid")
+	ErrTokenMalformed    = errors.New("malformed token")
+	ErrInvalidSignature  = errors.New("invalid token signature")
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+	ErrInvalidIssuer     = errors.New("invalid issuer")
+	ErrInvalidAudience   = errors.New("invalid audience")
+	ErrUserBanned        = errors.New("user is banned")
+)
+
 // JWK represents a JSON Web Key
 type JWK struct {
 	Kid string   `json:"kid"`
@@ -42,12 +57,34 @@ type JWKSet struct {
 	Keys []JWK `json:"keys"`
 }
 
+// TenantResolver decides whether tokens from additional (onboarded) tenants are accepted
+type TenantResolver interface {
+	IsTenantAllowed(tenantID string) bool
+}
+
 // AuthMiddleware handles JWT authentication
 type AuthMiddleware struct {
 	config     *config.Config
 	jwks       map[string]*rsa.PublicKey
 	jwksMutex  sync.RWMutex
 	lastUpdate time.Time
+	tenants    TenantResolver
+	roleMapper RoleMapper
+	bans       BanChecker
+	auditLog   audit.Log
+
+	// JWKS outage tracking and pinned fallback keys (see jwks_fallback.go)
+	outage jwksOutage
+}
+
+// BanChecker reports users banned from authenticating, and until when
+type BanChecker interface {
+	BannedUntil(userID string) (time.Time, bool)
+}
+
+// RoleMapper grants additional roles based on group membership
+type RoleMapper interface {
+	Apply(roles, groups []string) []string
 }
 
 // NewAuthMiddleware creates a new authentication middleware
@@ -65,39 +102,130 @@ func NewAuthMiddleware(cfg *config.Config) *AuthMiddleware {
 	return am
 }
 
+// SetTenantResolver enables accepting tokens issued by onboarded tenants
+func (am *AuthMiddleware) SetTenantResolver(resolver TenantResolver) {
+	am.tenants = resolver
+}
+
+// JWKSReady reports whether signing keys are loaded, retrying the fetch (at most every 30s)
+// when they are not. It always succeeds when token verification is skipped.
+func (am *AuthMiddleware) JWKSReady() error {
+	if am.config.SkipTokenVerification {
+		return nil
+	}
+
+	am.jwksMutex.RLock()
+	loaded := len(am.jwks) > 0
+	am.jwksMutex.RUnlock()
+
+	// Pinned fallback keys keep the replica serving once an outage passes the threshold
+	if loaded || am.fallbackActive() {
+		return nil
+	}
+	if err := am.tryRefreshJWKS(); err != nil && !errors.Is(err, errJWKSRefreshThrottled) {
+		return err
+	}
+
+	am.jwksMutex.RLock()
+	defer am.jwksMutex.RUnlock()
+	if len(am.jwks) == 0 {
+		return fmt.Errorf("no signing keys loaded")
+	}
+	return nil
+}
+
+// SetBanChecker refuses valid tokens of banned users
+func (am *AuthMiddleware) SetBanChecker(bans BanChecker) {
+	am.bans = bans
+}
+
+// SetAuditLog records rejected credentials to log
+func (am *AuthMiddleware) SetAuditLog(log audit.Log) {
+	am.auditLog = log
+}
+
+// RecordFailure audits a request (or call) to target rejected for the given problem code,
+// derived from err when empty
+func (am *AuthMiddleware) RecordFailure(target, remoteAddr, code string, err error) {
+	if am.auditLog == nil {
+		return
+	}
+	if code == "" {
+		code = tokenProblemCode(err)
+	}
+	details := map[string]interface{}{"reason": code, "remoteAddr": remoteAddr}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	am.auditLog.Record(audit.Record{
+		Action:  "auth.failure",
+		Target:  target,
+		Outcome: "denied",
+		Details: details,
+	})
+}
+
+// SetRoleMapper enables deriving roles from group membership during claims mapping
+func (am *AuthMiddleware) SetRoleMapper(mapper RoleMapper) {
+	am.roleMapper = mapper
+}
+
 // Middleware wraps an http.Handler with JWT authentication
 func (am *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract token from Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+			am.RecordFailure(r.URL.Path, ClientIP(r), "missing_authorization", nil)
+			problem.Write(w, r, http.StatusUnauthorized, "missing_authorization", "Missing authorization header")
 			return
 		}
 
 		// Check for Bearer token
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			am.RecordFailure(r.URL.Path, ClientIP(r), "invalid_authorization_header", nil)
+			problem.Write(w, r, http.StatusUnauthorized, "invalid_authorization_header", "Authorization header must be of the form \"Bearer <token>\"")
 			return
 		}
 
 		tokenString := parts[1]
 
 		// Parse and validate token
-		user, err := am.validateToken(tokenString)
+		user, err := am.ValidateToken(tokenString)
+		if errors.Is(err, ErrUserBanned) {
+			am.RecordFailure(r.URL.Path, ClientIP(r), "user_banned", err)
+			problem.Write(w, r, http.StatusForbidden, "user_banned", err.Error())
+			return
+		}
 		if err != nil {
 			log.Printf("Token validation failed: %v", err)
-			http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+			am.RecordFailure(r.URL.Path, ClientIP(r), "", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			problem.Write(w, r, http.StatusUnauthorized, tokenProblemCode(err), err.Error())
 			return
 		}
 
 		// Add user to context
-		ctx := context.WithValue(r.Context(), UserContextKey, user)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user)))
 	})
 }
 
+// ValidateToken validates a bearer token, also received outside of HTTP requests (e.g. gRPC
+// metadata). Tokens of banned users fail with ErrUserBanned.
+func (am *AuthMiddleware) ValidateToken(tokenString string) (*models.User, error) {
+	user, err := am.validateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if am.bans != nil {
+		if until, banned := am.bans.BannedUntil(user.ID); banned {
+			return nil, fmt.Errorf("%w until %s", ErrUserBanned, until.Format(time.RFC3339))
+		}
+	}
+	return user, nil
+}
+
 // validateToken validates and parses a JWT token
 func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error) {
 	// Skip verification mode for development/debugging
@@ -106,7 +234,7 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error
 		parser := jwt.NewParser(jwt.WithoutClaimsValidation())
 		token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse token: %w", err)
+			return nil, classifyParseError(err)
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
@@ -123,8 +251,8 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error
 	}
 
 	// Refresh JWKS if needed (cache for 1 hour)
-	if time.Since(am.lastUpdate) > time.Hour {
-		if err := am.refreshJWKS(); err != nil {
+	if am.jwksStale() {
+		if err := am.tryRefreshJWKS(); err != nil && !errors.Is(err, errJWKSRefreshThrottled) {
 			log.Printf("Failed to refresh JWKS: %v", err)
 		}
 	}
@@ -158,17 +286,21 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error
 		am.jwksMutex.RUnlock()
 
 		if !exists {
-			// Try refreshing JWKS if key not found
+			// Try refreshing JWKS if key not found (rate-limited, so unknown kids can't hammer Azure AD)
 			log.Printf("Public key not found for kid: %s, refreshing JWKS...", kid)
-			if err := am.refreshJWKS(); err != nil {
-				return nil, fmt.Errorf("failed to refresh JWKS: %w", err)
-			}
+			refreshErr := am.tryRefreshJWKS()
 			am.jwksMutex.RLock()
 			publicKey, exists = am.jwks[kid]
 			am.jwksMutex.RUnlock()
 
 			if !exists {
-				return nil, fmt.Errorf("public key not found for kid: %s after refresh", kid)
+				if fallbackKey := am.fallbackKey(kid); fallbackKey != nil {
+					return fallbackKey, nil
+				}
+				if refreshErr != nil && !errors.Is(refreshErr, errJWKSRefreshThrottled) {
+					return nil, fmt.Errorf("failed to refresh JWKS: %w", refreshErr)
+				}
+				return nil, fmt.Errorf("%w: no public key for kid %s after refresh", ErrUnknownSigningKey, kid)
 			}
 		}
 
@@ -177,7 +309,7 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, classifyParseError(err)
 	}
 
 	if !token.Valid {
@@ -193,21 +325,21 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error
 	// Validate issuer - Azure AD can use different issuer formats
 	iss, ok := claims["iss"].(string)
 	if !ok {
-		return nil, fmt.Errorf("issuer claim not found")
+		return nil, fmt.Errorf("%w: issuer claim not found", ErrInvalidIssuer)
 	}
 
 	// Accept both v2.0 and v1.0 issuer formats
 	expectedIssuerV2 := am.config.GetIssuer()
 	expectedIssuerV1 := fmt.Sprintf("https://sts.windows.net/%s/", am.config.AzureTenantID)
 
-	if iss != expectedIssuerV2 && iss != expectedIssuerV1 {
-		return nil, fmt.Errorf("invalid issuer: expected %s or %s, got %s", expectedIssuerV2, expectedIssuerV1, iss)
+	if iss != expectedIssuerV2 && iss != expectedIssuerV1 && !am.isOnboardedIssuer(iss, claims) {
+		return nil, fmt.Errorf("%w: expected %s or %s, got %s", ErrInvalidIssuer, expectedIssuerV2, expectedIssuerV1, iss)
 	}
 
 	// Validate audience (client ID)
 	aud, ok := claims["aud"].(string)
 	if !ok || aud != am.config.AzureClientID {
-		return nil, fmt.Errorf("invalid audience: expected %s, got %s", am.config.AzureClientID, aud)
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrInvalidAudience, am.config.AzureClientID, aud)
 	}
 
 	// Convert claims to UserClaims
@@ -219,6 +351,61 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*models.User, error
 	return userClaims.ToUser(), nil
 }
 
+// classifyParseError wraps a jwt parsing error with the matching validation failure
+func classifyParseError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownSigningKey):
+		return err
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return fmt.Errorf("%w: %v", ErrTokenExpired, err)
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return fmt.Errorf("%w: %v", ErrTokenNotYetValid, err)
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	default:
+		return fmt.Errorf("failed to parse token: %w", err)
+	}
+}
+
+// tokenProblemCode maps a token validation error to its problem type code
+func tokenProblemCode(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return "token_expired"
+	case errors.Is(err, ErrTokenNotYetValid):
+		return "token_not_yet_valid"
+	case errors.Is(err, ErrTokenMalformed):
+		return "token_malformed"
+	case errors.Is(err, ErrInvalidSignature):
+		return "invalid_signature"
+	case errors.Is(err, ErrUnknownSigningKey):
+		return "unknown_signing_key"
+	case errors.Is(err, ErrInvalidIssuer):
+		return "invalid_issuer"
+	case errors.Is(err, ErrInvalidAudience):
+		return "invalid_audience"
+	default:
+		return "invalid_token"
+	}
+}
+
+// isOnboardedIssuer reports whether the issuer belongs to an onboarded tenant
+func (am *AuthMiddleware) isOnboardedIssuer(iss string, claims jwt.MapClaims) bool {
+	if am.tenants == nil {
+		return false
+	}
+
+	tid, ok := claims["tid"].(string)
+	if !ok || !am.tenants.IsTenantAllowed(tid) {
+		return false
+	}
+
+	return iss == fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", tid) ||
+		iss == fmt.Sprintf("https://sts.windows.net/%s/", tid)
+}
+
 // mapClaimsToUserClaims converts jwt.MapClaims to UserClaims
 func (am *AuthMiddleware) mapClaimsToUserClaims(claims jwt.MapClaims) (*models.UserClaims, error) {
 	userClaims := &models.UserClaims{}
@@ -280,31 +467,74 @@ func (am *AuthMiddleware) mapClaimsToUserClaims(claims jwt.MapClaims) (*models.U
 		}
 	}
 
+	// Derive roles from group membership for tenants without app roles
+	if am.roleMapper != nil {
+		userClaims.Roles = am.roleMapper.Apply(userClaims.Roles, userClaims.Groups)
+	}
+
+	// Platform administration is reserved for the home tenant; admins of onboarded tenants
+	// are scoped to their own tenant
+	if !strings.EqualFold(userClaims.Tid, am.config.AzureTenantID) {
+		for i, role := range userClaims.Roles {
+			if role == models.RoleAdmin {
+				userClaims.Roles[i] = models.RoleTenantAdmin
+			}
+		}
+	}
+
 	return userClaims, nil
 }
 
 // refreshJWKS fetches and caches the JWKS from Azure AD
 func (am *AuthMiddleware) refreshJWKS() error {
+	am.outage.recordAttempt()
+
+	newJWKS, err := am.fetchJWKS()
+	if err != nil {
+		am.recordRefreshFailure(err)
+		return err
+	}
+
+	// Update cached JWKS
+	am.jwksMutex.Lock()
+	am.jwks = newJWKS
+	am.lastUpdate = time.Now()
+	am.jwksMutex.Unlock()
+	am.recordRefreshSuccess()
+
+	log.Printf("Refreshed JWKS: loaded %d keys", len(newJWKS))
+	for kid := range newJWKS {
+		log.Printf("  - kid: %s", kid)
+	}
+	return nil
+}
+
+// fetchJWKS downloads and parses the tenant's signing keys
+func (am *AuthMiddleware) fetchJWKS() (map[string]*rsa.PublicKey, error) {
 	jwksURL := am.config.GetJWKSURL()
 	log.Printf("Fetching JWKS from: %s", jwksURL)
 
-	resp, err := http.Get(jwksURL)
+	resp, err := jwksClient.Get(jwksURL)
 	if err != nil {
-		return fmt.Errorf("failed to fetch JWKS: %w", err)
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("JWKS endpoint returned status: %d", resp.StatusCode)
+		return nil, fmt.Errorf("JWKS endpoint returned status: %d", resp.StatusCode)
 	}
 
 	var jwkSet JWKSet
 	if err := json.NewDecoder(resp.Body).Decode(&jwkSet); err != nil {
-		return fmt.Errorf("failed to decode JWKS: %w", err)
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
 	}
 
 	log.Printf("Received %d keys from JWKS endpoint", len(jwkSet.Keys))
+	return am.parseJWKSet(jwkSet)
+}
 
+// parseJWKSet converts the RSA keys of a JWK set to public keys by kid
+func (am *AuthMiddleware) parseJWKSet(jwkSet JWKSet) (map[string]*rsa.PublicKey, error) {
 	// Convert JWKs to RSA public keys
 	newJWKS := make(map[string]*rsa.PublicKey)
 	for i, jwk := range jwkSet.Keys {
@@ -326,20 +556,9 @@ func (am *AuthMiddleware) refreshJWKS() error {
 	}
 
 	if len(newJWKS) == 0 {
-		return fmt.Errorf("no valid RSA keys found in JWKS")
-	}
-
-	// Update cached JWKS
-	am.jwksMutex.Lock()
-	am.jwks = newJWKS
-	am.lastUpdate = time.Now()
-	am.jwksMutex.Unlock()
-
-	log.Printf("Refreshed JWKS: loaded %d keys", len(newJWKS))
-	for kid := range newJWKS {
-		log.Printf("  - kid: %s", kid)
+		return nil, fmt.Errorf("no valid RSA keys found in JWKS")
 	}
-	return nil
+	return newJWKS, nil
 }
 
 // jwkToRSAPublicKey converts a JWK to an RSA public key
@@ -395,6 +614,11 @@ func (am *AuthMiddleware) jwkToRSAPublicKey(jwk JWK) (*rsa.PublicKey, error) {
 	}, nil
 }
 
+// ContextWithUser returns a copy of ctx carrying the authenticated user
+func ContextWithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, UserContextKey, user)
+}
+
 // GetUserFromContext extracts the user from the request context
 func GetUserFromContext(ctx context.Context) (*models.User, bool) {
 	user, ok := ctx.Value(UserContextKey).(*models.User)
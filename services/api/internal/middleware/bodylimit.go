@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"api-service/internal/problem"
+)
+
+// DefaultMaxBodyBytes is the default request body limit (1MB)
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+// BodyLimitMiddleware caps the size of incoming request bodies
+type BodyLimitMiddleware struct {
+	maxBytes int64
+}
+
+// NewBodyLimitMiddleware creates a new body limit middleware
+func NewBodyLimitMiddleware(maxBytes int64) *BodyLimitMiddleware {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	return &BodyLimitMiddleware{
+		maxBytes: maxBytes,
+	}
+}
+
+// Middleware wraps an http.Handler with a request body size limit.
+// Requests that declare a larger Content-Length are rejected up front; bodies
+// without a declared length fail with *http.MaxBytesError once the limit is read.
+func (bm *BodyLimitMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > bm.maxBytes {
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("Request body must not exceed %d bytes", bm.maxBytes))
+			return
+		}
+
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, bm.maxBytes)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPKey is the context key of the resolved client address
+const clientIPKey contextKey = "clientIP"
+
+// ClientIPResolver finds the address of the client that sent a request. Behind a reverse proxy
+// (such as the Container Apps ingress) the peer address is the proxy's, so X-Forwarded-For is
+// used instead, but only as far as it was appended by trusted proxies: clients can put anything
+// in the header themselves.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver creates a resolver trusting the X-Forwarded-For of the given proxies, each
+// an IP address or a CIDR range. Invalid entries are ignored (the configuration validates them).
+// Without trusted proxies the peer address is always the client's.
+func NewClientIPResolver(trustedProxies []string) *ClientIPResolver {
+	cr := &ClientIPResolver{}
+	for _, proxy := range trustedProxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			cr.trusted = append(cr.trusted, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(proxy); err == nil {
+			cr.trusted = append(cr.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return cr
+}
+
+// Resolve returns the client address of a request: the peer address, or when that's a trusted
+// proxy, the rightmost X-Forwarded-For address not belonging to one
+func (cr *ClientIPResolver) Resolve(r *http.Request) string {
+	client := peerIP(r.RemoteAddr)
+	if len(cr.trusted) == 0 || !cr.isTrusted(client) {
+		return client
+	}
+
+	// Each proxy appends the address it received the request from, so walk back from the
+	// nearest until reaching an address no trusted proxy would have sent
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break // Malformed, so nothing further left can be trusted
+		}
+		client = hop
+		if !cr.isTrusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// Middleware makes the resolved client address available to handlers through ClientIP
+func (cr *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, cr.Resolve(r))))
+	})
+}
+
+// isTrusted reports whether an address belongs to a trusted proxy
+func (cr *ClientIPResolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range cr.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent a request, as resolved by
+// ClientIPResolver.Middleware; without it, the peer address. Use it instead of r.RemoteAddr
+// to identify callers in logs, audit records and limits.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return peerIP(r.RemoteAddr)
+}
+
+// peerIP strips the port from a peer address
+func peerIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -2,7 +2,11 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"api-service/internal/origins"
 )
 
 // CORSConfig holds CORS configuration
@@ -12,6 +16,8 @@ type CORSConfig struct {
 	AllowedHeaders   []string
 	ExposedHeaders   []string
 	AllowCredentials bool
+	MaxAge           time.Duration            // How long browsers cache preflight responses
+	AllowOriginFunc  func(origin string) bool // Optional dynamic origin check (e.g. onboarded tenants)
 }
 
 // DefaultCORSConfig returns a permissive CORS configuration for development
@@ -19,9 +25,10 @@ func DefaultCORSConfig() *CORSConfig {
 	return &CORSConfig{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Link", "Deprecation", "Sunset", "X-Request-ID", "Idempotent-Replayed"},
 		AllowCredentials: false,
+		MaxAge:           24 * time.Hour,
 	}
 }
 
@@ -30,9 +37,10 @@ func ProductionCORSConfig(allowedOrigins []string) *CORSConfig {
 	return &CORSConfig{
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Link", "Deprecation", "Sunset", "X-Request-ID", "Idempotent-Replayed"},
 		AllowCredentials: true,
+		MaxAge:           24 * time.Hour,
 	}
 }
 
@@ -56,10 +64,20 @@ func (cm *CORSMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 
+		// Unless every origin is allowed, whether this one is changes the response, so shared
+		// caches must key on the Origin header, including for responses that don't allow it
+		anyOrigin := len(cm.config.AllowedOrigins) == 1 && cm.config.AllowedOrigins[0] == "*"
+		if !anyOrigin {
+			w.Header().Add("Vary", "Origin")
+		}
+
 		// Check if origin is allowed
 		if cm.isOriginAllowed(origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
-		} else if len(cm.config.AllowedOrigins) == 1 && cm.config.AllowedOrigins[0] == "*" {
+			if anyOrigin {
+				w.Header().Add("Vary", "Origin") // The origin is echoed back
+			}
+		} else if anyOrigin {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
 
@@ -80,9 +98,12 @@ func (cm *CORSMiddleware) Middleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Expose-Headers", strings.Join(cm.config.ExposedHeaders, ", "))
 		}
 
-		// Handle preflight requests
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
+		// Handle preflight requests; other OPTIONS requests (e.g. webhook validation handshakes)
+		// are routed
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if cm.config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cm.config.MaxAge.Seconds())))
+			}
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -93,17 +114,8 @@ func (cm *CORSMiddleware) Middleware(next http.Handler) http.Handler {
 
 // isOriginAllowed checks if the origin is in the allowed list
 func (cm *CORSMiddleware) isOriginAllowed(origin string) bool {
-	for _, allowedOrigin := range cm.config.AllowedOrigins {
-		if allowedOrigin == "*" || allowedOrigin == origin {
-			return true
-		}
-		// Support wildcard subdomains like *.example.com
-		if strings.HasPrefix(allowedOrigin, "*.") {
-			domain := allowedOrigin[2:]
-			if strings.HasSuffix(origin, domain) {
-				return true
-			}
-		}
+	if origin != "" && cm.config.AllowOriginFunc != nil && cm.config.AllowOriginFunc(origin) {
+		return true
 	}
-	return false
+	return origins.Match(origin, cm.config.AllowedOrigins)
 }
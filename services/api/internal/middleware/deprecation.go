@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecation describes a deprecated route
+type Deprecation struct {
+	Since     time.Time // When the route was deprecated (Deprecation header, RFC 9745)
+	Sunset    time.Time // Optional: when the route will be removed (Sunset header, RFC 8594)
+	Successor string    // Optional: path of the replacement route
+}
+
+// Deprecated returns middleware that marks responses from a route as deprecated
+func Deprecated(d Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+			if !d.Sunset.IsZero() {
+				w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Successor != "" {
+				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", d.Successor))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
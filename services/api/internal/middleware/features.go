@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"api-service/internal/features"
+	"api-service/internal/problem"
+)
+
+// RequireFeature returns middleware that answers 404 to users the feature flag is off for, as
+// if the endpoint didn't exist. It must be applied after the auth middleware.
+func RequireFeature(flags *features.Set, name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := GetUserFromContext(r.Context())
+			if !flags.EnabledFor(name, user) {
+				problem.Write(w, r, http.StatusNotFound, "feature_disabled", "The "+name+" feature isn't enabled for you")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"api-service/internal/problem"
+)
+
+// Idempotency headers: clients send a key with a request they may retry, and replayed responses
+// are marked so clients can tell
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotencyKeys      = 100000 // Results kept; requests beyond that aren't protected
+	idempotencySweepEvery   = time.Minute
+)
+
+// IdempotencyCache remembers the responses of requests sent with an Idempotency-Key, per user,
+// so retries of a request get its original response instead of repeating it. Responses are
+// kept in memory, so retries must reach the replica that answered the request.
+type IdempotencyCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	results   map[string]*idempotentResult // User ID + key -> result
+	lastSweep time.Time
+}
+
+// idempotentResult is the outcome of a keyed request, pending until its response is recorded
+type idempotentResult struct {
+	fingerprint string // Method, route, path parameters and body hash of the request that used the key
+	pending     bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// NewIdempotencyCache creates a cache keeping responses for ttl
+func NewIdempotencyCache(ttl time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{
+		ttl:     ttl,
+		results: make(map[string]*idempotentResult),
+	}
+}
+
+// begin claims a key for a request. It returns the key's recorded result when there's one (or a
+// pending result when the request is still running), or nil when the request should run.
+func (c *IdempotencyCache) begin(key, fingerprint string) (*idempotentResult, bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= idempotencySweepEvery {
+		for k, result := range c.results {
+			if !result.pending && now.After(result.expiresAt) {
+				delete(c.results, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	if result, ok := c.results[key]; ok && (result.pending || now.Before(result.expiresAt)) {
+		copied := *result
+		return &copied, true
+	}
+	if len(c.results) >= maxIdempotencyKeys {
+		return nil, false
+	}
+	c.results[key] = &idempotentResult{fingerprint: fingerprint, pending: true}
+	return nil, true
+}
+
+// finish records the response of a claimed key, or releases the key when there's no response
+// worth replaying
+func (c *IdempotencyCache) finish(key string, rec *idempotencyRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.results[key]
+	if !ok {
+		return
+	}
+	if rec.status == 0 || rec.status >= 500 {
+		delete(c.results, key)
+		return
+	}
+	result.pending = false
+	result.status = rec.status
+	result.contentType = rec.Header().Get("Content-Type")
+	result.body = rec.body.Bytes()
+	result.expiresAt = time.Now().Add(c.ttl)
+}
+
+// idempotencyRecorder passes a response through while keeping a copy of it
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Idempotency returns middleware that replays the original response to retries of a request
+// with the same Idempotency-Key header. Keys are scoped to the user, so it must be applied
+// after the auth middleware. Requests without the header run normally. A key reused with a
+// different request gets 422, and a retry while the original is still running 409. Server
+// errors (5xx) aren't kept, so those requests can be retried.
+func Idempotency(cache *IdempotencyCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+			if idempotencyKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(idempotencyKey) {
+				problem.Write(w, r, http.StatusBadRequest, "invalid_idempotency_key", fmt.Sprintf("Idempotency-Key must be 1 to %d printable ASCII characters", maxIdempotencyKeyLength))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					problem.Write(w, r, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit))
+					return
+				}
+				problem.Write(w, r, http.StatusBadRequest, "invalid_body", "Request body could not be read")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			user, _ := GetUserFromContext(r.Context())
+			userID := ""
+			if user != nil {
+				userID = user.ID
+			}
+			key := userID + "\x00" + idempotencyKey
+			fingerprint := fmt.Sprintf("%s %s %x", r.Method, routeOf(r), sha256.Sum256(body))
+
+			result, claimed := cache.begin(key, fingerprint)
+			switch {
+			case result != nil && result.fingerprint != fingerprint:
+				problem.Write(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used with a different request")
+				return
+			case result != nil && result.pending:
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, r, http.StatusConflict, "idempotency_key_in_progress", "A request with this Idempotency-Key is still in progress")
+				return
+			case result != nil:
+				if result.contentType != "" {
+					w.Header().Set("Content-Type", result.contentType)
+				}
+				w.Header().Set(IdempotencyReplayedHeader, "true")
+				w.WriteHeader(result.status)
+				w.Write(result.body)
+				return
+			case !claimed:
+				log.Printf("⚠️  Idempotency cache full (%d keys); running a keyed request unprotected", maxIdempotencyKeys)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &idempotencyRecorder{ResponseWriter: w}
+			defer cache.finish(key, rec) // Also releases the key when the handler panics
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// routeOf returns the pattern of the route serving r within the API router, with its path
+// parameters, so a retry through /api/v1 and through its /api alias are the same request
+func routeOf(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || len(rctx.RoutePatterns) == 0 {
+		return r.URL.Path
+	}
+	route := rctx.RoutePatterns[len(rctx.RoutePatterns)-1]
+	for i, key := range rctx.URLParams.Keys {
+		if key != "*" { // Set by the mount points
+			route += " " + key + "=" + rctx.URLParams.Values[i]
+		}
+	}
+	return route
+}
+
+// validIdempotencyKey reports whether a key is short printable ASCII
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksRetryInterval is the minimum time between JWKS fetch attempts
+	jwksRetryInterval = 30 * time.Second
+	// jwksAlertInterval rate-limits outage alerts so a long outage doesn't flood the logs
+	jwksAlertInterval = 5 * time.Minute
+	// DefaultJWKSFallbackAfter is how long the JWKS endpoint must be down before fallback keys are used
+	DefaultJWKSFallbackAfter = 10 * time.Minute
+)
+
+// jwksClient fetches signing keys; the timeout keeps requests from hanging on a stalled endpoint
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// errJWKSRefreshThrottled is returned when a fetch was attempted too recently
+var errJWKSRefreshThrottled = errors.New("JWKS refresh throttled")
+
+// jwksOutage tracks JWKS endpoint failures and the pinned fallback keys used during long outages
+type jwksOutage struct {
+	mu                    sync.Mutex
+	lastAttempt           time.Time
+	failingSince          time.Time // Zero while the endpoint is healthy
+	consecutiveFailures   int
+	totalFailures         int64
+	lastError             string
+	lastAlert             time.Time
+	fallback              map[string]*rsa.PublicKey
+	fallbackAfter         time.Duration
+	fallbackAnnounced     bool
+	fallbackVerifications int64
+}
+
+// JWKSStatus reports signing key health for operators
+type JWKSStatus struct {
+	Keys                  int        `json:"keys"`
+	LastRefresh           *time.Time `json:"lastRefresh,omitempty"`
+	FailingSince          *time.Time `json:"failingSince,omitempty"`
+	ConsecutiveFailures   int        `json:"consecutiveFailures"`
+	TotalFailures         int64      `json:"totalFailures"`
+	LastError             string     `json:"lastError,omitempty"`
+	FallbackKeys          int        `json:"fallbackKeys"`
+	FallbackAfter         string     `json:"fallbackAfter"`
+	FallbackActive        bool       `json:"fallbackActive"`
+	FallbackVerifications int64      `json:"fallbackVerifications"`
+}
+
+// SetFallbackKeys pins signing keys (a JWKS document, e.g. fetched at deploy time into Key Vault)
+// that are only trusted once the JWKS endpoint has been failing for longer than after.
+func (am *AuthMiddleware) SetFallbackKeys(jwksJSON string, after time.Duration) error {
+	var jwkSet JWKSet
+	if err := json.Unmarshal([]byte(jwksJSON), &jwkSet); err != nil {
+		return fmt.Errorf("invalid fallback JWKS: %w", err)
+	}
+	keys, err := am.parseJWKSet(jwkSet)
+	if err != nil {
+		return fmt.Errorf("invalid fallback JWKS: %w", err)
+	}
+	if after <= 0 {
+		after = DefaultJWKSFallbackAfter
+	}
+
+	am.outage.mu.Lock()
+	am.outage.fallback = keys
+	am.outage.fallbackAfter = after
+	am.outage.mu.Unlock()
+
+	log.Printf("🔑 Loaded %d fallback signing keys (used after %s of JWKS outage)", len(keys), after)
+	return nil
+}
+
+// JWKSStatus returns the current signing key and outage state
+func (am *AuthMiddleware) JWKSStatus() JWKSStatus {
+	am.jwksMutex.RLock()
+	status := JWKSStatus{Keys: len(am.jwks)}
+	if !am.lastUpdate.IsZero() {
+		lastUpdate := am.lastUpdate
+		status.LastRefresh = &lastUpdate
+	}
+	am.jwksMutex.RUnlock()
+
+	o := &am.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.failingSince.IsZero() {
+		failingSince := o.failingSince
+		status.FailingSince = &failingSince
+	}
+	status.ConsecutiveFailures = o.consecutiveFailures
+	status.TotalFailures = o.totalFailures
+	status.LastError = o.lastError
+	status.FallbackKeys = len(o.fallback)
+	status.FallbackAfter = o.fallbackAfter.String()
+	status.FallbackActive = o.fallbackActiveLocked()
+	status.FallbackVerifications = o.fallbackVerifications
+	return status
+}
+
+// tryRefreshJWKS refreshes the JWKS unless an attempt was made within jwksRetryInterval
+func (am *AuthMiddleware) tryRefreshJWKS() error {
+	am.outage.mu.Lock()
+	throttled := time.Since(am.outage.lastAttempt) < jwksRetryInterval
+	am.outage.mu.Unlock()
+
+	if throttled {
+		return errJWKSRefreshThrottled
+	}
+	return am.refreshJWKS()
+}
+
+// jwksStale reports whether the cached keys are due for a refresh (cached for 1 hour)
+func (am *AuthMiddleware) jwksStale() bool {
+	am.jwksMutex.RLock()
+	defer am.jwksMutex.RUnlock()
+	return time.Since(am.lastUpdate) > time.Hour
+}
+
+// fallbackActive reports whether fallback keys may currently be used
+func (am *AuthMiddleware) fallbackActive() bool {
+	am.outage.mu.Lock()
+	defer am.outage.mu.Unlock()
+	return am.outage.fallbackActiveLocked()
+}
+
+// fallbackKey returns the pinned key for kid if the outage has passed the threshold
+func (am *AuthMiddleware) fallbackKey(kid string) *rsa.PublicKey {
+	o := &am.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.fallbackActiveLocked() {
+		return nil
+	}
+	key, ok := o.fallback[kid]
+	if !ok {
+		return nil
+	}
+
+	o.fallbackVerifications++
+	if !o.fallbackAnnounced {
+		o.fallbackAnnounced = true
+		log.Printf("🚨 ALERT: JWKS endpoint down for %s; verifying tokens with pinned fallback keys", time.Since(o.failingSince).Round(time.Second))
+	}
+	return key
+}
+
+func (o *jwksOutage) recordAttempt() {
+	o.mu.Lock()
+	o.lastAttempt = time.Now()
+	o.mu.Unlock()
+}
+
+func (o *jwksOutage) fallbackActiveLocked() bool {
+	return len(o.fallback) > 0 && !o.failingSince.IsZero() && time.Since(o.failingSince) >= o.fallbackAfter
+}
+
+// recordRefreshFailure tracks a failed fetch and raises a (rate-limited) alert
+func (am *AuthMiddleware) recordRefreshFailure(err error) {
+	o := &am.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	if o.failingSince.IsZero() {
+		o.failingSince = now
+	}
+	o.consecutiveFailures++
+	o.totalFailures++
+	o.lastError = err.Error()
+
+	if now.Sub(o.lastAlert) < jwksAlertInterval {
+		return
+	}
+	o.lastAlert = now
+
+	fallback := "no fallback keys configured"
+	switch {
+	case o.fallbackActiveLocked():
+		fallback = "fallback keys active"
+	case len(o.fallback) > 0:
+		fallback = fmt.Sprintf("fallback keys activate after %s", o.fallbackAfter)
+	}
+	log.Printf("🚨 ALERT: JWKS refresh failing for %s (%d consecutive failures, %s): %v",
+		now.Sub(o.failingSince).Round(time.Second), o.consecutiveFailures, fallback, err)
+}
+
+// recordRefreshSuccess clears the outage state
+func (am *AuthMiddleware) recordRefreshSuccess() {
+	o := &am.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.failingSince.IsZero() {
+		log.Printf("✅ JWKS endpoint recovered after %s (%d failures)", time.Since(o.failingSince).Round(time.Second), o.consecutiveFailures)
+	}
+	o.failingSince = time.Time{}
+	o.consecutiveFailures = 0
+	o.lastError = ""
+	o.lastAlert = time.Time{}
+	o.fallbackAnnounced = false
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"api-service/internal/requestid"
+)
+
+// maxRequestIDLength bounds caller-supplied request IDs
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns every request an ID, echoed in the X-Request-ID response header
+type RequestIDMiddleware struct{}
+
+// NewRequestIDMiddleware creates a new request ID middleware
+func NewRequestIDMiddleware() *RequestIDMiddleware {
+	return &RequestIDMiddleware{}
+}
+
+// Middleware wraps an http.Handler with request ID propagation.
+// A well-formed incoming X-Request-ID (e.g. from Front Door or the SPA) is kept; otherwise one is generated.
+func (rm *RequestIDMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !validRequestID(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts short IDs made of URL-safe characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
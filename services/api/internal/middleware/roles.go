@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"api-service/internal/audit"
+	"api-service/internal/problem"
+)
+
+// RequireRoles returns middleware that only allows users holding at least one of the given roles.
+// It must be applied after the auth middleware so the user is present in the context. Denials
+// are recorded to auditLog.
+func RequireRoles(auditLog audit.Log, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, "unauthorized", "Authentication required")
+				return
+			}
+
+			for _, role := range roles {
+				if user.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			log.Printf("Access denied for %s (%s) to %s: requires one of %v", user.Email, user.ID, r.URL.Path, roles)
+			auditLog.Record(audit.Record{
+				Action:   "auth.forbidden",
+				Actor:    user.ID,
+				TenantID: user.TenantID,
+				Target:   r.URL.Path,
+				Outcome:  "denied",
+				Details:  map[string]interface{}{"method": r.Method, "requiredRoles": roles},
+			})
+			problem.Write(w, r, http.StatusForbidden, "forbidden", fmt.Sprintf("Requires one of the roles: %s", strings.Join(roles, ", ")))
+		})
+	}
+}
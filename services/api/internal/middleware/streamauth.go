@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/problem"
+)
+
+// BearerSubprotocol marks the next WebSocket subprotocol as a bearer token:
+// Sec-WebSocket-Protocol: events.v2, bearer, <token>
+const BearerSubprotocol = "bearer"
+
+// queryTokenDeprecatedAt is when ?token= authentication was deprecated in favour of tickets
+// and the bearer subprotocol
+var queryTokenDeprecatedAt = time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)
+
+// TicketStore issues one-time tickets that authenticate a streaming request (WebSocket, SSE,
+// long-poll) in place of a bearer token, so the token stays out of URLs. Tickets are kept in
+// memory, so they must be redeemed on the replica that issued them.
+type TicketStore struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	tickets   map[string]issuedTicket
+	lastSweep time.Time
+}
+
+// issuedTicket is the user a ticket authenticates and when it expires
+type issuedTicket struct {
+	user      *models.User
+	expiresAt time.Time
+}
+
+// NewTicketStore creates a store of tickets valid for ttl
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]issuedTicket),
+	}
+}
+
+// Issue returns a new ticket for the user and when it expires
+func (s *TicketStore) Issue(user *models.User) (string, time.Time) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for key, issued := range s.tickets {
+			if now.After(issued.expiresAt) {
+				delete(s.tickets, key)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.tickets[ticket] = issuedTicket{user: user, expiresAt: expiresAt}
+	return ticket, expiresAt
+}
+
+// Redeem returns the user of an unexpired ticket, which can't be used again
+func (s *TicketStore) Redeem(ticket string) (*models.User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	issued, ok := s.tickets[ticket]
+	if !ok {
+		return nil, false
+	}
+	delete(s.tickets, ticket)
+	if time.Now().After(issued.expiresAt) {
+		return nil, false
+	}
+	return issued.user, true
+}
+
+// StreamCredentials configures how streaming requests may authenticate besides the
+// Authorization header, which browsers can't set on WebSocket and EventSource requests
+type StreamCredentials struct {
+	Tickets    *TicketStore // ?ticket= from POST /api/ws/ticket; nil disables tickets
+	QueryToken bool         // Deprecated: the bearer token itself in ?token=
+}
+
+// StreamMiddleware authenticates streaming requests with, in order: a one-time ?ticket=, a
+// bearer token in the WebSocket subprotocols, the Authorization header, or (when still
+// allowed) a ?token= query parameter
+func (am *AuthMiddleware) StreamMiddleware(creds StreamCredentials) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authenticated := am.Middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			if ticket := query.Get("ticket"); ticket != "" && creds.Tickets != nil {
+				user, ok := creds.Tickets.Redeem(ticket)
+				if !ok {
+					am.RecordFailure(r.URL.Path, ClientIP(r), "invalid_ticket", nil)
+					problem.Write(w, r, http.StatusUnauthorized, "invalid_ticket", "Ticket is unknown, expired or already used")
+					return
+				}
+				if am.bans != nil {
+					if until, banned := am.bans.BannedUntil(user.ID); banned {
+						err := fmt.Errorf("%w until %s", ErrUserBanned, until.Format(time.RFC3339))
+						am.RecordFailure(r.URL.Path, ClientIP(r), "user_banned", err)
+						problem.Write(w, r, http.StatusForbidden, "user_banned", err.Error())
+						return
+					}
+				}
+				next.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user)))
+				return
+			}
+
+			if token := subprotocolToken(r); token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			} else if token := query.Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+				if !creds.QueryToken {
+					am.RecordFailure(r.URL.Path, ClientIP(r), "query_token_disabled", nil)
+					problem.Write(w, r, http.StatusUnauthorized, "query_token_disabled", "Tokens in the query string are no longer accepted; use a ticket from POST /api/ws/ticket")
+					return
+				}
+				// WebSocket handshakes drop these headers, hence the log
+				log.Printf("⚠️  Deprecated ?token= authentication on %s from %s", r.URL.Path, ClientIP(r))
+				r.Header.Set("Authorization", "Bearer "+token)
+				Deprecated(Deprecation{Since: queryTokenDeprecatedAt, Successor: "/api/ws/ticket"})(authenticated).ServeHTTP(w, r)
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	}
+}
+
+// subprotocolToken returns the token following the bearer WebSocket subprotocol, or ""
+func subprotocolToken(r *http.Request) string {
+	var subprotocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, subprotocol := range strings.Split(header, ",") {
+			subprotocols = append(subprotocols, strings.TrimSpace(subprotocol))
+		}
+	}
+	for i, subprotocol := range subprotocols {
+		if subprotocol == BearerSubprotocol && i+1 < len(subprotocols) {
+			return subprotocols[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"api-service/internal/problem"
+)
+
+// ReadOnlyChecker reports whether a tenant has been placed in read-only mode
+type ReadOnlyChecker interface {
+	IsReadOnly(tenantID string) bool
+}
+
+// TenantGuardMiddleware rejects write requests from users of read-only (frozen) tenants
+type TenantGuardMiddleware struct {
+	checker ReadOnlyChecker
+}
+
+// NewTenantGuardMiddleware creates a new tenant guard middleware
+func NewTenantGuardMiddleware(checker ReadOnlyChecker) *TenantGuardMiddleware {
+	return &TenantGuardMiddleware{
+		checker: checker,
+	}
+}
+
+// Middleware wraps an http.Handler with read-only enforcement.
+// It must be applied after the auth middleware so the user is present in the context.
+func (tg *TenantGuardMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if user, ok := GetUserFromContext(r.Context()); ok && tg.checker.IsReadOnly(user.TenantID) {
+			problem.Write(w, r, http.StatusForbidden, "tenant_read_only", "Tenant is frozen and read-only")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
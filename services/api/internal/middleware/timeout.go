@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"api-service/internal/problem"
+)
+
+// TimeoutMiddleware enforces handler deadlines on a per-route basis
+type TimeoutMiddleware struct {
+	defaultTimeout time.Duration
+}
+
+// NewTimeoutMiddleware creates a new timeout middleware with the given default deadline
+func NewTimeoutMiddleware(defaultTimeout time.Duration) *TimeoutMiddleware {
+	if defaultTimeout <= 0 {
+		defaultTimeout = 10 * time.Second
+	}
+	return &TimeoutMiddleware{
+		defaultTimeout: defaultTimeout,
+	}
+}
+
+// Middleware wraps an http.Handler with the default handler deadline
+func (tm *TimeoutMiddleware) Middleware(next http.Handler) http.Handler {
+	return tm.WithTimeout(tm.defaultTimeout, next)
+}
+
+// WithTimeout wraps an http.Handler with a route-specific deadline.
+// The request context is cancelled when the deadline passes and the client
+// receives a 503 response. Long-lived routes (WebSocket) must not be wrapped,
+// as the buffered response writer does not support hijacking the connection.
+func (tm *TimeoutMiddleware) WithTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// TimeoutHandler writes a fixed body, so render the problem (with this request's ID) up front
+		message := problem.New(r, http.StatusServiceUnavailable, "request_timeout", "The request took too long to process").JSON()
+		w.Header().Set("Content-Type", problem.ContentType)
+		http.TimeoutHandler(next, timeout, message).ServeHTTP(w, r)
+	})
+}
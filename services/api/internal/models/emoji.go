@@ -0,0 +1,37 @@
+package models
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxEmojiLength bounds an emoji's length in code points; ZWJ sequences such as family or
+// flag emoji take several
+const MaxEmojiLength = 16
+
+// IsEmoji reports whether s is made of emoji only: pictographic symbols, optionally combined
+// with skin tone modifiers, variation selectors, zero-width joiners, keycaps or tag sequences.
+// Text, including shortcodes like ":+1:", is rejected.
+func IsEmoji(s string) bool {
+	if s == "" || utf8.RuneCountInString(s) > MaxEmojiLength {
+		return false
+	}
+
+	symbols := 0
+	keycap := false
+	for i, r := range s {
+		switch {
+		case unicode.Is(unicode.So, r):
+			symbols++
+		case r == 0x20E3: // Combining keycap, as in 1️⃣
+			keycap = true
+		case r == 0x200D, r == 0xFE0E, r == 0xFE0F, // Zero-width joiner, variation selectors
+			r >= 0x1F3FB && r <= 0x1F3FF, // Skin tone modifiers
+			r >= 0xE0020 && r <= 0xE007F: // Tags, as in subdivision flags
+		case i == 0 && (r == '#' || r == '*' || (r >= '0' && r <= '9')): // Keycap base
+		default:
+			return false
+		}
+	}
+	return symbols > 0 || keycap
+}
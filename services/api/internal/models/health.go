@@ -1,8 +1,33 @@
 package models
 
+import "time"
+
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status  string `json:"status"`
-	Service string `json:"service"`
-	Version string `json:"version"`
+	Status  string        `json:"status"`
+	Service string        `json:"service"`
+	Version string        `json:"version"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// ProbeResponse represents a liveness/readiness/startup probe response
+type ProbeResponse struct {
+	Status string        `json:"status"` // "ok" or "unavailable"
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Check statuses
+const (
+	CheckStatusOK     = "ok"
+	CheckStatusFailed = "failed"
+)
+
+// CheckResult represents the outcome of a single dependency check
+type CheckResult struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"` // "ok" or "failed"
+	LatencyMs   float64    `json:"latencyMs"`
+	Error       string     `json:"error,omitempty"`       // Error from this run
+	LastError   string     `json:"lastError,omitempty"`   // Most recent failure, even if since recovered
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"` // Time of the most recent failure
 }
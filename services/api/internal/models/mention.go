@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxMentions bounds the distinct users one message can mention
+const MaxMentions = 20
+
+// maxMentionLength bounds a mention handle, like user IDs
+const maxMentionLength = 128
+
+// ParseMentions returns the distinct handles mentioned in text as "@handle", in order of
+// first mention. A handle is a user ID or the local part of an email address; an "@" inside
+// a word, as in an email address, isn't a mention. Trailing punctuation is ignored.
+func ParseMentions(text string) []string {
+	var handles []string
+	seen := make(map[string]bool)
+
+	runes := []rune(text)
+	for i := 0; i < len(runes) && len(handles) < MaxMentions; i++ {
+		if runes[i] != '@' || (i > 0 && isHandleRune(runes[i-1])) || (i > 0 && runes[i-1] == '@') {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isHandleRune(runes[end]) {
+			end++
+		}
+		handle := strings.TrimRight(string(runes[i+1:end]), ".:-")
+		i = end - 1
+
+		if handle == "" || len(handle) > maxMentionLength || !isAlphanumeric(rune(handle[0])) {
+			continue
+		}
+		if key := strings.ToLower(handle); !seen[key] {
+			seen[key] = true
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// isHandleRune reports whether r can appear in a mention handle
+func isHandleRune(r rune) bool {
+	return isAlphanumeric(r) || r == '.' || r == '_' || r == '-' || r == ':'
+}
+
+// isAlphanumeric reports whether r is an ASCII letter or digit
+func isAlphanumeric(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
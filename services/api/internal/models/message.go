@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MessageSchemaVersion is the newest message content schema version understood by this server
+const MessageSchemaVersion = 1
+
+// MaxMessageTextLength is the maximum length, in characters, of a message's text
+const MaxMessageTextLength = 4000
+
+// MessageContent is the versioned body of a chat message.
+//
+// Messages are relayed (and stored) by servers that may be older than the client that
+// produced them, so any fields this version does not know about are kept in Extra and
+// written back out unchanged. A v(N+1) payload therefore round-trips through a vN server
+// intact, including its original schemaVersion tag.
+type MessageContent struct {
+	SchemaVersion int                        // Schema version the content was produced with
+	Text          string                     // Plain-text body
+	Extra         map[string]json.RawMessage // Fields unknown to this server version, preserved verbatim
+}
+
+// NewMessageContent creates plain-text content tagged with the current schema version
+func NewMessageContent(text string) *MessageContent {
+	return &MessageContent{
+		SchemaVersion: MessageSchemaVersion,
+		Text:          text,
+	}
+}
+
+// UnmarshalJSON decodes message content, preserving unknown fields
+func (m *MessageContent) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*m = MessageContent{SchemaVersion: MessageSchemaVersion}
+
+	if raw, ok := fields["schemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &m.SchemaVersion); err != nil {
+			return fmt.Errorf("invalid schemaVersion: %w", err)
+		}
+		if m.SchemaVersion < 1 {
+			return fmt.Errorf("invalid schemaVersion: %d", m.SchemaVersion)
+		}
+		delete(fields, "schemaVersion")
+	}
+
+	if raw, ok := fields["text"]; ok {
+		if err := json.Unmarshal(raw, &m.Text); err != nil {
+			return fmt.Errorf("invalid text: %w", err)
+		}
+		delete(fields, "text")
+	}
+
+	if len(fields) > 0 {
+		m.Extra = fields
+	}
+	return nil
+}
+
+// MarshalJSON encodes message content, including any preserved unknown fields
+func (m MessageContent) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(m.Extra)+2)
+	for key, raw := range m.Extra {
+		fields[key] = raw
+	}
+
+	schemaVersion := m.SchemaVersion
+	if schemaVersion == 0 {
+		schemaVersion = MessageSchemaVersion
+	}
+	fields["schemaVersion"] = schemaVersion
+	fields["text"] = m.Text
+
+	return json.Marshal(fields)
+}
+
+// IsNewerSchema reports whether the content was produced by a newer schema than this server understands
+func (m *MessageContent) IsNewerSchema() bool {
+	return m.SchemaVersion > MessageSchemaVersion
+}
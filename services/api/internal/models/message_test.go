@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageContentPreservesUnknownFields(t *testing.T) {
+	input := `{"schemaVersion":1,"text":"hello","attachments":[{"id":"a1","size":42}],"format":{"bold":[0,5]}}`
+
+	var content MessageContent
+	if err := json.Unmarshal([]byte(input), &content); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if content.Text != "hello" {
+		t.Errorf("Text = %q, want %q", content.Text, "hello")
+	}
+	for _, key := range []string{"attachments", "format"} {
+		if _, ok := content.Extra[key]; !ok {
+			t.Errorf("Extra is missing %q: %v", key, content.Extra)
+		}
+	}
+	if _, ok := content.Extra["text"]; ok {
+		t.Errorf("Extra holds the known field text")
+	}
+
+	output, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	assertSameJSON(t, output, input)
+}
+
+func TestMessageContentKeepsNewerSchemaVersion(t *testing.T) {
+	input := `{"schemaVersion":3,"text":"hi","reactions":{"👍":2}}`
+
+	var content MessageContent
+	if err := json.Unmarshal([]byte(input), &content); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if content.SchemaVersion != 3 {
+		t.Errorf("SchemaVersion = %d, want 3", content.SchemaVersion)
+	}
+	if !content.IsNewerSchema() {
+		t.Errorf("IsNewerSchema() = false for schema version 3")
+	}
+
+	output, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	assertSameJSON(t, output, input)
+}
+
+func TestMessageContentDefaults(t *testing.T) {
+	var content MessageContent
+	if err := json.Unmarshal([]byte(`{"text":"plain"}`), &content); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if content.SchemaVersion != MessageSchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", content.SchemaVersion, MessageSchemaVersion)
+	}
+	if content.Extra != nil {
+		t.Errorf("Extra = %v, want nil", content.Extra)
+	}
+	if content.IsNewerSchema() {
+		t.Errorf("IsNewerSchema() = true for the current schema version")
+	}
+}
+
+func TestMessageContentRejectsInvalidFields(t *testing.T) {
+	for _, input := range []string{
+		`{"schemaVersion":0,"text":"x"}`,
+		`{"schemaVersion":"2","text":"x"}`,
+		`{"text":42}`,
+		`["not","an","object"]`,
+	} {
+		var content MessageContent
+		if err := json.Unmarshal([]byte(input), &content); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want an error", input)
+		}
+	}
+}
+
+// assertSameJSON fails unless got and want encode the same JSON value, ignoring key order
+func assertSameJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("JSON = %s, want %s", gotJSON, wantJSON)
+	}
+}
@@ -44,3 +44,26 @@ func (uc *UserClaims) ToUser() *User {
 		ExpiresAt:         time.Unix(uc.Exp, 0),
 	}
 }
+
+// RoleAdmin is the app role granting access to administrative endpoints
+const RoleAdmin = "Admin"
+
+// RoleTenantAdmin replaces RoleAdmin for administrators of onboarded customer tenants. It only
+// grants visibility and moderation within the administrator's own tenant.
+const RoleTenantAdmin = "TenantAdmin"
+
+// RoleCompliance is the app role granting compliance exports of the tenant's conversations
+const RoleCompliance = "Compliance"
+
+// RoleEventsIngest is the app role granting backend applications POST /api/events/ingest
+const RoleEventsIngest = "Events.Ingest"
+
+// HasRole reports whether the user has the given app role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,402 @@
+// Package moderation screens chat content against acceptable-use policies before it is
+// delivered. Filters decide whether a message is allowed, rejected, redacted or flagged for
+// review; the Moderator runs them in order, or in the background once the message is
+// delivered for filters too slow to hold it up. Flagged content can be held in a quarantine
+// queue for human review.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/models"
+)
+
+// Outcome is a filter's decision about a message
+type Outcome string
+
+// Filter outcomes, from the mildest to the strictest
+const (
+	OutcomeAllow  Outcome = "allow"  // Deliver the message unchanged
+	OutcomeFlag   Outcome = "flag"   // Deliver the message and report it for review
+	OutcomeRedact Outcome = "redact" // Deliver the message with the offending text replaced
+	OutcomeReject Outcome = "reject" // Refuse the message
+)
+
+// Failure modes, when a filter fails to screen a message
+const (
+	FailOpen   = "allow"  // Deliver the message unscreened by that filter
+	FailClosed = "reject" // Refuse the message
+)
+
+// reviewQueueSize bounds the delivered messages and images waiting for background review;
+// more are skipped
+const reviewQueueSize = 256
+
+// reviewTimeout bounds the background review of one message or image
+const reviewTimeout = time.Minute
+
+// MaxImageBytes is the size of the largest image screened; larger attachments are delivered
+// unscreened
+const MaxImageBytes = 4 << 20
+
+// Request is a message to screen
+type Request struct {
+	SenderID       string
+	TenantID       string
+	ConversationID string // dm:<userId>:<userId> or room:<roomId>
+	MessageID      string // Set when the message was already delivered, for background reviews
+	Message        *models.MessageContent
+}
+
+// ImageRequest is an image attached to a message, to screen
+type ImageRequest struct {
+	SenderID       string
+	TenantID       string
+	ConversationID string
+	MessageID      string
+	AttachmentID   string
+	ContentType    string
+	Data           []byte
+}
+
+// Verdict is a filter's decision about a message
+type Verdict struct {
+	Outcome    Outcome  `json:"outcome"`
+	Reason     string   `json:"reason,omitempty"`     // Shown to the sender when rejected
+	Categories []string `json:"categories,omitempty"` // What was found, e.g. "profanity", "email"
+	Text       string   `json:"-"`                    // Replacement text, for OutcomeRedact
+	Quarantine bool     `json:"-"`                    // Hold the content for human review when flagged
+}
+
+// Filter screens chat content. Filters must be safe for concurrent use.
+type Filter interface {
+	// Name identifies the filter in flags and logs
+	Name() string
+	// Check screens a message. A nil verdict allows it.
+	Check(ctx context.Context, req *Request) (*Verdict, error)
+}
+
+// ImageFilter is a filter that also screens attached images
+type ImageFilter interface {
+	Filter
+	// CheckImage screens an image. A nil verdict allows it; images can't be redacted.
+	CheckImage(ctx context.Context, req *ImageRequest) (*Verdict, error)
+}
+
+// RejectedError is returned when a filter rejects a message
+type RejectedError struct {
+	Filter     string
+	Reason     string
+	Categories []string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("message rejected by %s: %s", e.Filter, e.Reason)
+}
+
+// Flag reports a delivered message for review
+type Flag struct {
+	MessageID      string    `json:"messageId"`
+	AttachmentID   string    `json:"attachmentId,omitempty"` // Set when an attached image was flagged
+	ConversationID string    `json:"conversationId"`
+	SenderID       string    `json:"senderId"`
+	TenantID       string    `json:"tenantId"`
+	Filter         string    `json:"filter"`
+	Outcome        Outcome   `json:"outcome"` // flag, or redact when the message was also changed
+	Reason         string    `json:"reason,omitempty"`
+	Categories     []string  `json:"categories,omitempty"`
+	Quarantine     bool      `json:"quarantine"` // Held for human review
+	FlaggedAt      time.Time `json:"flaggedAt"`
+}
+
+// Decision is the result of screening a message or image that may be delivered
+type Decision struct {
+	Message *models.MessageContent // The content to deliver, redacted if a filter asked for it
+	flags   []Flag
+	request *Request      // Reviewed in the background once delivered
+	image   *ImageRequest // Reviewed in the background once delivered, for images
+}
+
+// Moderator runs filters over messages before they are delivered. Filters run in order, each
+// seeing the content as redacted by the previous ones; the first rejection stops screening.
+// Reviewers run in the background once a message is delivered and can only flag it.
+type Moderator struct {
+	filters   []Filter
+	reviewers []Filter
+	failMode  string
+	audit     audit.Log
+	reviews   chan *Decision // Delivered content waiting for the reviewers
+
+	mu       sync.Mutex
+	handlers []func(Flag)
+}
+
+// NewModerator creates a moderator running filters in order. failMode (FailOpen or
+// FailClosed) sets what happens to a message when a filter fails.
+func NewModerator(filters []Filter, failMode string, auditLog audit.Log) (*Moderator, error) {
+	if failMode == "" {
+		failMode = FailOpen
+	}
+	if failMode != FailOpen && failMode != FailClosed {
+		return nil, fmt.Errorf("unknown moderation failure mode %q (expected %s or %s)", failMode, FailOpen, FailClosed)
+	}
+	return &Moderator{
+		filters:  filters,
+		failMode: failMode,
+		audit:    auditLog,
+		reviews:  make(chan *Decision, reviewQueueSize),
+	}, nil
+}
+
+// AddReviewer registers a filter run in the background over delivered messages and images,
+// for checks too slow to hold up delivery. Its rejections and redactions can't be applied
+// anymore, so they raise flags held in quarantine instead. It must be called before Run.
+func (m *Moderator) AddReviewer(filter Filter) {
+	m.reviewers = append(m.reviewers, filter)
+}
+
+// AddFlagHandler registers a function called with every flag raised for a delivered message
+func (m *Moderator) AddFlagHandler(handler func(Flag)) {
+	m.mu.Lock()
+	m.handlers = append(m.handlers, handler)
+	m.mu.Unlock()
+}
+
+// Filters names the filters in use, in order, followed by the reviewers
+func (m *Moderator) Filters() []string {
+	names := make([]string, 0, len(m.filters)+len(m.reviewers))
+	for _, filter := range m.filters {
+		names = append(names, filter.Name())
+	}
+	for _, reviewer := range m.reviewers {
+		names = append(names, reviewer.Name()+" (background)")
+	}
+	return names
+}
+
+// ScreensImages reports whether any filter or reviewer screens attached images
+func (m *Moderator) ScreensImages() bool {
+	for _, filter := range append(append([]Filter{}, m.filters...), m.reviewers...) {
+		if _, ok := filter.(ImageFilter); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Screen runs the filters over a message. A *RejectedError is returned when the message must
+// not be delivered; otherwise the decision holds the content to deliver. The message itself is
+// never modified.
+func (m *Moderator) Screen(ctx context.Context, req *Request) (*Decision, error) {
+	screened := *req
+	decision := &Decision{Message: req.Message, request: req}
+
+	for _, filter := range m.filters {
+		verdict, err := filter.Check(ctx, &screened)
+		if err != nil {
+			log.Printf("⚠️  Moderation filter %s failed: %v", filter.Name(), err)
+			if m.failMode == FailClosed {
+				return nil, m.reject(req, filter.Name(), &Verdict{Reason: "message could not be screened"})
+			}
+			continue
+		}
+		if verdict == nil {
+			continue
+		}
+
+		switch verdict.Outcome {
+		case OutcomeReject:
+			return nil, m.reject(req, filter.Name(), verdict)
+		case OutcomeRedact:
+			redacted := *decision.Message
+			redacted.Text = verdict.Text
+			decision.Message = &redacted
+			screened.Message = &redacted
+		case OutcomeFlag:
+		default:
+			continue
+		}
+		decision.flags = append(decision.flags, newFlag(req.SenderID, req.TenantID, req.ConversationID, filter.Name(), verdict))
+	}
+	return decision, nil
+}
+
+// ScreenImage runs the image filters over an image about to be attached to a message. A
+// *RejectedError is returned when it must not be attached. Images can't be redacted, so
+// redactions only flag them.
+func (m *Moderator) ScreenImage(ctx context.Context, req *ImageRequest) (*Decision, error) {
+	decision := &Decision{image: req}
+	for _, filter := range m.filters {
+		imageFilter, ok := filter.(ImageFilter)
+		if !ok {
+			continue
+		}
+		verdict, err := imageFilter.CheckImage(ctx, req)
+		if err != nil {
+			log.Printf("⚠️  Moderation filter %s failed to screen an image: %v", filter.Name(), err)
+			if m.failMode == FailClosed {
+				return nil, m.reject(&Request{SenderID: req.SenderID, TenantID: req.TenantID, ConversationID: req.ConversationID},
+					filter.Name(), &Verdict{Reason: "image could not be screened"})
+			}
+			continue
+		}
+		if verdict == nil || verdict.Outcome == OutcomeAllow {
+			continue
+		}
+		if verdict.Outcome == OutcomeReject {
+			return nil, m.reject(&Request{SenderID: req.SenderID, TenantID: req.TenantID, ConversationID: req.ConversationID}, filter.Name(), verdict)
+		}
+		flag := newFlag(req.SenderID, req.TenantID, req.ConversationID, filter.Name(), verdict)
+		flag.AttachmentID = req.AttachmentID
+		flag.Outcome = OutcomeFlag
+		decision.flags = append(decision.flags, flag)
+	}
+	return decision, nil
+}
+
+// Delivered records the flags raised for a message once it has been delivered with the
+// given ID, auditing each and passing it to the flag handlers, and queues the message for
+// the reviewers. It never blocks; when the review queue is full the message isn't reviewed.
+func (m *Moderator) Delivered(decision *Decision, messageID string) {
+	m.raise(decision.flags, messageID)
+
+	if len(m.reviewers) == 0 || (decision.request == nil && decision.image == nil) {
+		return
+	}
+	review := &Decision{Message: decision.Message}
+	if decision.request != nil {
+		req := *decision.request
+		req.MessageID = messageID
+		req.Message = decision.Message
+		review.request = &req
+	}
+	if decision.image != nil {
+		image := *decision.image
+		image.MessageID = messageID
+		review.image = &image
+	}
+	select {
+	case m.reviews <- review:
+	default:
+		log.Printf("⚠️  Moderation review queue full, message %s not reviewed", messageID)
+	}
+}
+
+// Run reviews delivered messages and images in the background until ctx is cancelled
+func (m *Moderator) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case review := <-m.reviews:
+			reviewCtx, cancel := context.WithTimeout(ctx, reviewTimeout)
+			m.review(reviewCtx, review)
+			cancel()
+		}
+	}
+}
+
+// review runs the reviewers over delivered content, raising a quarantined flag for every
+// verdict other than allow
+func (m *Moderator) review(ctx context.Context, review *Decision) {
+	var flags []Flag
+	var messageID string
+	for _, reviewer := range m.reviewers {
+		var verdict *Verdict
+		var err error
+		var flag Flag
+		switch {
+		case review.image != nil:
+			imageFilter, ok := reviewer.(ImageFilter)
+			if !ok {
+				continue
+			}
+			req := review.image
+			messageID = req.MessageID
+			if verdict, err = imageFilter.CheckImage(ctx, req); verdict != nil {
+				flag = newFlag(req.SenderID, req.TenantID, req.ConversationID, reviewer.Name(), verdict)
+				flag.AttachmentID = req.AttachmentID
+			}
+		default:
+			req := review.request
+			messageID = req.MessageID
+			if verdict, err = reviewer.Check(ctx, req); verdict != nil {
+				flag = newFlag(req.SenderID, req.TenantID, req.ConversationID, reviewer.Name(), verdict)
+			}
+		}
+		if err != nil {
+			log.Printf("⚠️  Moderation reviewer %s failed to review message %s: %v", reviewer.Name(), messageID, err)
+			continue
+		}
+		if verdict == nil || verdict.Outcome == OutcomeAllow {
+			continue
+		}
+		flag.Outcome = OutcomeFlag
+		flag.Quarantine = true
+		flags = append(flags, flag)
+	}
+	m.raise(flags, messageID)
+}
+
+// raise audits flags raised for a delivered message and passes them to the flag handlers
+func (m *Moderator) raise(flags []Flag, messageID string) {
+	if len(flags) == 0 {
+		return
+	}
+	m.mu.Lock()
+	handlers := append([]func(Flag){}, m.handlers...)
+	m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, flag := range flags {
+		flag.MessageID = messageID
+		flag.FlaggedAt = now
+		details := map[string]interface{}{"filter": flag.Filter, "categories": flag.Categories, "conversationId": flag.ConversationID}
+		if flag.AttachmentID != "" {
+			details["attachmentId"] = flag.AttachmentID
+		}
+		m.audit.Record(audit.Record{
+			Action:   "message." + string(flag.Outcome),
+			Actor:    flag.SenderID,
+			TenantID: flag.TenantID,
+			Target:   messageID,
+			Outcome:  string(flag.Outcome),
+			Details:  details,
+		})
+		for _, handler := range handlers {
+			handler(flag)
+		}
+	}
+}
+
+// reject audits a rejected message and returns the error reported to the sender
+func (m *Moderator) reject(req *Request, filter string, verdict *Verdict) error {
+	m.audit.Record(audit.Record{
+		Action:   "message.reject",
+		Actor:    req.SenderID,
+		TenantID: req.TenantID,
+		Target:   req.ConversationID,
+		Outcome:  string(OutcomeReject),
+		Details:  map[string]interface{}{"filter": filter, "categories": verdict.Categories},
+	})
+	return &RejectedError{Filter: filter, Reason: verdict.Reason, Categories: verdict.Categories}
+}
+
+// newFlag creates the flag raised by a filter's verdict, before the message ID is known
+func newFlag(senderID, tenantID, conversationID, filter string, verdict *Verdict) Flag {
+	return Flag{
+		ConversationID: conversationID,
+		SenderID:       senderID,
+		TenantID:       tenantID,
+		Filter:         filter,
+		Outcome:        verdict.Outcome,
+		Reason:         verdict.Reason,
+		Categories:     verdict.Categories,
+		Quarantine:     verdict.Quarantine,
+	}
+}
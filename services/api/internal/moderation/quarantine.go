@@ -0,0 +1,166 @@
+package moderation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/models"
+)
+
+// ReviewStatus is where a quarantined message stands in human review
+type ReviewStatus string
+
+// Review statuses
+const (
+	ReviewPending  ReviewStatus = "pending"  // Waiting for a reviewer
+	ReviewApproved ReviewStatus = "approved" // The message was found acceptable and kept
+	ReviewRemoved  ReviewStatus = "removed"  // The message was taken down
+)
+
+// Quarantine errors
+var (
+	ErrQuarantineItemNotFound = errors.New("quarantined message not found")
+	ErrAlreadyReviewed        = errors.New("quarantined message was already reviewed")
+)
+
+// QuarantineItem is a flagged message held for human review
+type QuarantineItem struct {
+	ID         string       `json:"id"`
+	Flag       Flag         `json:"flag"`
+	Status     ReviewStatus `json:"status"`
+	ReviewedBy string       `json:"reviewedBy,omitempty"`
+	ReviewedAt *time.Time   `json:"reviewedAt,omitempty"`
+}
+
+// Remover takes down a message a reviewer removed from quarantine
+type Remover func(ctx context.Context, reviewer *models.User, flag Flag) error
+
+// Quarantine holds flagged messages for human review. Items are kept in memory, up to a
+// capacity beyond which the oldest reviewed items, then the oldest pending ones, are dropped.
+type Quarantine struct {
+	capacity int
+	remove   Remover
+	audit    audit.Log
+
+	mu    sync.Mutex
+	items []*QuarantineItem // Oldest first
+}
+
+// NewQuarantine creates a quarantine queue holding up to capacity items; remove takes down
+// the messages reviewers remove
+func NewQuarantine(capacity int, remove Remover, auditLog audit.Log) *Quarantine {
+	return &Quarantine{
+		capacity: capacity,
+		remove:   remove,
+		audit:    auditLog,
+	}
+}
+
+// Hold queues a flag for review when its filter asked for quarantine; it is registered with
+// Moderator.AddFlagHandler
+func (q *Quarantine) Hold(flag Flag) {
+	if !flag.Quarantine {
+		return
+	}
+	item := &QuarantineItem{ID: newItemID(), Flag: flag, Status: ReviewPending}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.capacity {
+		drop := 0
+		for i, held := range q.items {
+			if held.Status != ReviewPending {
+				drop = i
+				break
+			}
+		}
+		q.items = append(q.items[:drop], q.items[drop+1:]...)
+	}
+	q.items = append(q.items, item)
+}
+
+// List returns the items with the given status (all when empty), oldest first
+func (q *Quarantine) List(status ReviewStatus) []QuarantineItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := []QuarantineItem{}
+	for _, item := range q.items {
+		if status == "" || item.Status == status {
+			items = append(items, *item)
+		}
+	}
+	return items
+}
+
+// Pending returns the number of items waiting for review
+func (q *Quarantine) Pending() int {
+	return len(q.List(ReviewPending))
+}
+
+// Resolve records a reviewer's decision on a pending item: approved keeps the message,
+// removed takes it down
+func (q *Quarantine) Resolve(ctx context.Context, id string, status ReviewStatus, reviewer *models.User) (*QuarantineItem, error) {
+	if status != ReviewApproved && status != ReviewRemoved {
+		return nil, fmt.Errorf("unknown review status %q (expected %s or %s)", status, ReviewApproved, ReviewRemoved)
+	}
+
+	q.mu.Lock()
+	var item *QuarantineItem
+	for _, held := range q.items {
+		if held.ID == id {
+			item = held
+		}
+	}
+	switch {
+	case item == nil:
+		q.mu.Unlock()
+		return nil, ErrQuarantineItemNotFound
+	case item.Status != ReviewPending:
+		q.mu.Unlock()
+		return nil, ErrAlreadyReviewed
+	}
+	// Claim the item while the message is taken down, so it isn't resolved twice
+	item.Status = status
+	flag := item.Flag
+	q.mu.Unlock()
+
+	if status == ReviewRemoved {
+		if err := q.remove(ctx, reviewer, flag); err != nil {
+			q.mu.Lock()
+			item.Status = ReviewPending
+			q.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	q.mu.Lock()
+	item.ReviewedBy = reviewer.ID
+	item.ReviewedAt = &now
+	resolved := *item
+	q.mu.Unlock()
+
+	q.audit.Record(audit.Record{
+		Action:   "moderation.review",
+		Actor:    reviewer.ID,
+		TenantID: flag.TenantID,
+		Target:   flag.MessageID,
+		Outcome:  string(status),
+		Details:  map[string]interface{}{"filter": flag.Filter, "categories": flag.Categories, "quarantineId": id},
+	})
+	return &resolved, nil
+}
+
+// newItemID returns a random quarantine item ID
+func newItemID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"api-service/internal/redact"
+)
+
+// Categories found by the regex filter
+const (
+	CategoryProfanity  = "profanity"
+	CategoryEmail      = "email"
+	CategoryPhone      = "phone"
+	CategoryCardNumber = "card_number"
+)
+
+var piiPatterns = map[string]*regexp.Regexp{
+	CategoryEmail:      regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	CategoryPhone:      regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?\(?\d{2,4}\)?[\s.-]?\d{3,4}[\s.-]?\d{3,4}\b`),
+	CategoryCardNumber: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+}
+
+// RegexConfig configures the built-in regex filter. An empty action turns a check off.
+type RegexConfig struct {
+	Words           []string // Profane words; redact.DefaultProfanity when empty
+	ProfanityAction Outcome  // reject, redact or flag
+	PIIAction       Outcome  // reject, redact or flag, for email addresses, phone and card numbers
+}
+
+// RegexFilter finds profanity and PII (email addresses, phone and card numbers) in message
+// text with regular expressions. Redaction masks profane words with asterisks and PII with
+// redact.Placeholder.
+type RegexFilter struct {
+	profanity       *regexp.Regexp
+	profanityAction Outcome
+	piiAction       Outcome
+}
+
+// NewRegexFilter creates the built-in regex filter
+func NewRegexFilter(cfg RegexConfig) (*RegexFilter, error) {
+	for _, action := range []Outcome{cfg.ProfanityAction, cfg.PIIAction} {
+		switch action {
+		case "", OutcomeReject, OutcomeRedact, OutcomeFlag:
+		default:
+			return nil, fmt.Errorf("unknown moderation action %q (expected %s, %s or %s)", action, OutcomeReject, OutcomeRedact, OutcomeFlag)
+		}
+	}
+
+	words := cfg.Words
+	if len(words) == 0 {
+		words = redact.DefaultProfanity
+	}
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+
+	return &RegexFilter{
+		profanity:       regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`),
+		profanityAction: cfg.ProfanityAction,
+		piiAction:       cfg.PIIAction,
+	}, nil
+}
+
+// Name identifies the filter
+func (f *RegexFilter) Name() string {
+	return "regex"
+}
+
+// Check screens the message text. When both profanity and PII are found, the stricter action
+// applies to the whole message.
+func (f *RegexFilter) Check(ctx context.Context, req *Request) (*Verdict, error) {
+	text := req.Message.Text
+	var categories []string
+	outcome := OutcomeAllow
+
+	if f.profanityAction != "" && f.profanity.MatchString(text) {
+		categories = append(categories, CategoryProfanity)
+		outcome = stricter(outcome, f.profanityAction)
+	}
+	if f.piiAction != "" {
+		var found []string
+		for category, pattern := range piiPatterns {
+			if pattern.MatchString(text) {
+				found = append(found, category)
+			}
+		}
+		if len(found) > 0 {
+			sort.Strings(found)
+			categories = append(categories, found...)
+			outcome = stricter(outcome, f.piiAction)
+		}
+	}
+	if outcome == OutcomeAllow {
+		return nil, nil
+	}
+
+	verdict := &Verdict{Outcome: outcome, Categories: categories}
+	switch outcome {
+	case OutcomeReject:
+		verdict.Reason = "message contains " + strings.Join(categories, ", ")
+	case OutcomeRedact:
+		verdict.Text = f.redact(text)
+	}
+	return verdict, nil
+}
+
+// redact masks the profanity and PII whose action is redact; what is only flagged is kept
+func (f *RegexFilter) redact(text string) string {
+	if f.piiAction == OutcomeRedact {
+		for _, category := range []string{CategoryEmail, CategoryCardNumber, CategoryPhone} {
+			text = piiPatterns[category].ReplaceAllString(text, redact.Placeholder)
+		}
+	}
+	if f.profanityAction == OutcomeRedact {
+		text = f.profanity.ReplaceAllStringFunc(text, func(word string) string {
+			return strings.Repeat("*", len(word))
+		})
+	}
+	return text
+}
+
+// stricter returns the stricter of two outcomes
+func stricter(a, b Outcome) Outcome {
+	rank := map[Outcome]int{OutcomeAllow: 0, OutcomeFlag: 1, OutcomeRedact: 2, OutcomeReject: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,271 @@
+package notificationhubs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/store"
+	"api-service/internal/webpush"
+)
+
+const (
+	queueSize      = 256 // Offline messages waiting to be pushed; more are dropped
+	maxDevices     = 10  // Per user
+	maxTokenLength = 4096
+	maxBodyRunes   = 1000 // Message text shown in a notification (full content mode only)
+	minimalBody    = "New message"
+	minimalBodies  = "%d new messages"
+)
+
+// Token formats: APNs device tokens are hex, FCM registration tokens URL-safe characters
+var (
+	apnsToken = regexp.MustCompile(`^[0-9a-fA-F]{64,200}$`)
+	fcmToken  = regexp.MustCompile(`^[A-Za-z0-9_:\-]{32,}$`)
+)
+
+var (
+	ErrInvalidDevice  = errors.New("invalid device")
+	ErrTooManyDevices = errors.New("too many devices")
+	ErrDeviceNotFound = errors.New("device not found")
+)
+
+// Stats reports dispatcher metrics
+type Stats struct {
+	Sent        int64 `json:"sent"`
+	Failures    int64 `json:"failures"`
+	Invalidated int64 `json:"invalidated"` // Devices whose token was rejected, which were removed
+	Dropped     int64 `json:"dropped"`     // Queue overflow
+}
+
+// pushJob is a message to push to an offline recipient's devices
+type pushJob struct {
+	tenantID string
+	message  webpush.Message
+}
+
+// Dispatcher keeps users' devices and pushes a notification to them when a message arrives
+// while they're offline. Notifications share the push service's content minimization and
+// inbox, so tapping one fetches the full message like a Web Push notification.
+type Dispatcher struct {
+	hub         *Hub
+	service     *webpush.Service
+	devices     store.DeviceStore
+	preferences store.PreferenceStore
+	queue       chan pushJob
+
+	sent        atomic.Int64
+	failures    atomic.Int64
+	invalidated atomic.Int64
+	dropped     atomic.Int64
+}
+
+// NewDispatcher creates a dispatcher sending the service's notifications through hub to the
+// users whose notification preferences allow push
+func NewDispatcher(hub *Hub, service *webpush.Service, devices store.DeviceStore, preferences store.PreferenceStore) *Dispatcher {
+	return &Dispatcher{
+		hub:         hub,
+		service:     service,
+		devices:     devices,
+		preferences: preferences,
+		queue:       make(chan pushJob, queueSize),
+	}
+}
+
+// Register adds a device of the user. Registering a token again replaces its name.
+func (d *Dispatcher) Register(ctx context.Context, user *models.User, platform, token, name string) (*store.Device, error) {
+	switch platform {
+	case store.PlatformAPNs:
+		if !apnsToken.MatchString(token) {
+			return nil, fmt.Errorf("%w: not an APNs device token", ErrInvalidDevice)
+		}
+	case store.PlatformFCM:
+		if !fcmToken.MatchString(token) || len(token) > maxTokenLength {
+			return nil, fmt.Errorf("%w: not an FCM registration token", ErrInvalidDevice)
+		}
+	default:
+		return nil, fmt.Errorf("%w: platform must be %s or %s", ErrInvalidDevice, store.PlatformFCM, store.PlatformAPNs)
+	}
+
+	sum := sha256.Sum256([]byte(platform + ":" + token))
+	device := &store.Device{
+		ID:        hex.EncodeToString(sum[:16]),
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		Platform:  platform,
+		Token:     token,
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+	existing, err := d.devices.Devices(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	replaces := false
+	for _, e := range existing {
+		replaces = replaces || e.ID == device.ID
+	}
+	if !replaces && len(existing) >= maxDevices {
+		return nil, fmt.Errorf("%w: at most %d per user", ErrTooManyDevices, maxDevices)
+	}
+
+	if err := d.devices.SaveDevice(ctx, device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Unregister removes a device of the user
+func (d *Dispatcher) Unregister(ctx context.Context, user *models.User, id string) error {
+	deleted, err := d.devices.DeleteDevice(ctx, user.ID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// Devices returns the user's devices
+func (d *Dispatcher) Devices(ctx context.Context, user *models.User) ([]*store.Device, error) {
+	return d.devices.Devices(ctx, user.ID)
+}
+
+// NotifyOffline queues a push of a message the recipient wasn't connected to receive,
+// reporting false when the queue is full. It never blocks.
+func (d *Dispatcher) NotifyOffline(sender *models.User, recipientID, messageID string, message *models.MessageContent) bool {
+	// The recipient's tenant isn't known while they're offline; direct messages stay within
+	// the sender's
+	job := pushJob{
+		tenantID: sender.TenantID,
+		message: webpush.Message{
+			MessageID:   messageID,
+			RecipientID: recipientID,
+			SenderID:    sender.ID,
+			SenderName:  sender.Name,
+			Message:     message,
+		},
+	}
+	select {
+	case d.queue <- job:
+		return true
+	default:
+		d.dropped.Add(1)
+		return false
+	}
+}
+
+// Run pushes queued messages until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		var job pushJob
+		select {
+		case <-ctx.Done():
+			return
+		case job = <-d.queue:
+		}
+
+		devices, err := d.devices.Devices(ctx, job.message.RecipientID)
+		if err != nil {
+			d.failures.Add(1)
+			log.Printf("⚠️  Reading devices of %s failed: %v", job.message.RecipientID, err)
+			continue
+		}
+		if len(devices) == 0 {
+			continue
+		}
+		prefs, err := d.preferences.NotificationPreferences(ctx, job.message.RecipientID)
+		if err != nil {
+			d.failures.Add(1)
+			log.Printf("⚠️  Reading notification preferences of %s failed: %v", job.message.RecipientID, err)
+			continue
+		}
+		if !prefs.Allows(store.ChannelPush, store.EventDirectMessage, time.Now()) {
+			continue
+		}
+
+		notification := d.service.Notify(job.tenantID, job.message)
+		for _, device := range devices {
+			body, err := payload(device.Platform, notification)
+			if err == nil {
+				err = d.hub.Send(ctx, device.Platform, device.Token, body)
+			}
+			switch {
+			case errors.Is(err, ErrInvalidToken):
+				d.invalidated.Add(1)
+				if _, err := d.devices.DeleteDevice(ctx, device.UserID, device.ID); err != nil {
+					log.Printf("⚠️  Removing device %s with an invalid token failed: %v", device.ID, err)
+				}
+			case err != nil:
+				d.failures.Add(1)
+				log.Printf("⚠️  Push to device %s of %s failed: %v", device.ID, device.UserID, err)
+			default:
+				d.sent.Add(1)
+			}
+		}
+	}
+}
+
+// Stats returns dispatcher metrics
+func (d *Dispatcher) Stats() Stats {
+	return Stats{
+		Sent:        d.sent.Load(),
+		Failures:    d.failures.Load(),
+		Invalidated: d.invalidated.Load(),
+		Dropped:     d.dropped.Load(),
+	}
+}
+
+// payload builds the FCM v1 or APNs payload of a notification. The text is only there in
+// full content mode; otherwise the body counts the sender's unread messages.
+func payload(platform string, notification webpush.Notification) ([]byte, error) {
+	body := notification.Text
+	if runes := []rune(body); len(runes) > maxBodyRunes {
+		body = string(runes[:maxBodyRunes-1]) + "…"
+	}
+	if body == "" {
+		body = minimalBody
+		if notification.Count > 1 {
+			body = fmt.Sprintf(minimalBodies, notification.Count)
+		}
+	}
+
+	switch platform {
+	case store.PlatformAPNs:
+		return json.Marshal(map[string]interface{}{
+			"aps": map[string]interface{}{
+				"alert":     map[string]string{"title": notification.SenderName, "body": body},
+				"sound":     "default",
+				"thread-id": notification.SenderID,
+			},
+			"type":     notification.Type,
+			"id":       notification.ID,
+			"senderId": notification.SenderID,
+			"url":      notification.URL,
+		})
+	default:
+		// FCM data values must be strings
+		return json.Marshal(map[string]interface{}{
+			"message": map[string]interface{}{
+				"notification": map[string]string{"title": notification.SenderName, "body": body},
+				"data": map[string]string{
+					"type":     notification.Type,
+					"id":       notification.ID,
+					"senderId": notification.SenderID,
+					"count":    strconv.Itoa(notification.Count),
+					"url":      notification.URL,
+				},
+			},
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Package notificationhubs pushes notifications of messages that arrive while a user is
+// offline to the mobile devices they registered (FCM and APNs tokens), through Azure
+// Notification Hubs direct sends
+package notificationhubs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-service/internal/store"
+)
+
+// apiVersion is the Notification Hubs REST API version (the first with FCM v1 support)
+const apiVersion = "2023-10-01-preview"
+
+// sasTTL is how long the shared access signatures of requests are valid
+const sasTTL = time.Hour
+
+// ErrInvalidToken is returned when the push service rejects a device token as unknown or
+// expired, so the device should be forgotten
+var ErrInvalidToken = errors.New("device token is invalid or expired")
+
+// Hub sends notifications through a notification hub, authenticated with a shared access key
+type Hub struct {
+	endpoint string // https://<namespace>.servicebus.windows.net/<hub>
+	keyName  string
+	key      string
+	client   *http.Client
+}
+
+// NewHub parses a notification hub connection string
+// (Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=...;SharedAccessKey=...)
+func NewHub(connectionString, hubName string) (*Hub, error) {
+	var endpoint, keyName, key string
+	for _, part := range strings.Split(connectionString, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(name) {
+		case "endpoint":
+			endpoint = value
+		case "sharedaccesskeyname":
+			keyName = value
+		case "sharedaccesskey":
+			key = value
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || keyName == "" || key == "" {
+		return nil, fmt.Errorf("notification hubs connection string needs Endpoint, SharedAccessKeyName and SharedAccessKey")
+	}
+	if hubName == "" {
+		return nil, fmt.Errorf("notification hub name is required")
+	}
+	return &Hub{
+		endpoint: "https://" + u.Host + "/" + url.PathEscape(hubName),
+		keyName:  keyName,
+		key:      key,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Send pushes a platform payload directly to one device. ErrInvalidToken is returned when
+// the push service no longer accepts the token.
+func (h *Hub) Send(ctx context.Context, platform, token string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.endpoint+"/messages/?direct&api-version="+apiVersion, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", h.signature(time.Now().Add(sasTTL)))
+	req.Header.Set("Content-Type", "application/json;charset=utf-8")
+	req.Header.Set("ServiceBusNotification-DeviceHandle", token)
+	switch platform {
+	case store.PlatformAPNs:
+		req.Header.Set("ServiceBusNotification-Format", "apple")
+		req.Header.Set("apns-push-type", "alert")
+		req.Header.Set("apns-priority", "10")
+	default:
+		req.Header.Set("ServiceBusNotification-Format", "fcmv1")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	// Gone, or a bad request naming the device handle: the token was unregistered or malformed
+	if resp.StatusCode == http.StatusGone || (resp.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(string(body)), "handle")) {
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("notification hubs returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// signature returns a shared access signature for the hub, valid until expiry
+func (h *Hub) signature(expiry time.Time) string {
+	resource := url.QueryEscape(strings.ToLower(h.endpoint))
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(h.key))
+	mac.Write([]byte(resource + "\n" + se))
+	sig := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return "SharedAccessSignature sr=" + resource + "&sig=" + sig + "&se=" + se + "&skn=" + h.keyName
+}
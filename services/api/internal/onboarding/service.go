@@ -0,0 +1,100 @@
+package onboarding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"api-service/internal/events"
+	"api-service/internal/tenants"
+)
+
+// Step is one system message or event in the onboarding sequence
+type Step = tenants.OnboardingStep
+
+// ParseSteps parses a JSON array of onboarding steps
+func ParseSteps(value string) ([]Step, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var steps []Step
+	if err := json.Unmarshal([]byte(value), &steps); err != nil {
+		return nil, fmt.Errorf("invalid onboarding steps: %w", err)
+	}
+	for i, step := range steps {
+		if step.Event == "" {
+			return nil, fmt.Errorf("onboarding step %d is missing 'event'", i)
+		}
+	}
+	return steps, nil
+}
+
+// Tracker records which users have already received the onboarding sequence. The message
+// store is one (store.OnboardingStore), so every replica sees the same users.
+type Tracker interface {
+	// MarkOnboarded marks the user as onboarded, returning true only the first time it is
+	// called for them
+	MarkOnboarded(ctx context.Context, userID, tenantID string) (bool, error)
+}
+
+// Service sends the onboarding sequence on a user's first-ever connection.
+// Tenants can define their own sequence; otherwise the configured default is used.
+type Service struct {
+	defaults []Step
+	tenants  *tenants.Registry
+	tracker  Tracker
+	manager  *events.Manager
+}
+
+// NewService creates a new onboarding service
+func NewService(defaults []Step, registry *tenants.Registry, tracker Tracker, manager *events.Manager) *Service {
+	return &Service{
+		defaults: defaults,
+		tenants:  registry,
+		tracker:  tracker,
+		manager:  manager,
+	}
+}
+
+// HandleConnect sends the onboarding sequence if this is the client's first-ever connection
+func (s *Service) HandleConnect(client *events.Client) {
+	steps := s.stepsFor(client.TenantID)
+	if len(steps) == 0 {
+		return
+	}
+
+	// Mark before sending so the sequence is delivered at most once, even across concurrent connections
+	first, err := s.tracker.MarkOnboarded(context.Background(), client.ID, client.TenantID)
+	if err != nil {
+		log.Printf("⚠️  Failed to record onboarding of %s: %v", client.ID, err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	log.Printf("👋 Sending %d onboarding messages to %s (%s)", len(steps), client.Name, client.ID)
+	for i, step := range steps {
+		payload := make(map[string]interface{}, len(step.Payload)+2)
+		for key, value := range step.Payload {
+			payload[key] = value
+		}
+		payload["step"] = i + 1
+		payload["totalSteps"] = len(steps)
+
+		if !s.manager.SendEventToUser(client.ID, events.NewEvent(events.EventType(step.Event), payload)) {
+			log.Printf("Failed to deliver onboarding step %d to %s", i+1, client.ID)
+			return
+		}
+	}
+}
+
+// stepsFor returns the tenant's sequence, falling back to the default
+func (s *Service) stepsFor(tenantID string) []Step {
+	if tenant, ok := s.tenants.Get(tenantID); ok && len(tenant.Onboarding) > 0 {
+		return tenant.Onboarding
+	}
+	return s.defaults
+}
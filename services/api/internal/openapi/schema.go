@@ -0,0 +1,184 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-service/internal/validate"
+)
+
+// Schema is a (subset of an) OpenAPI 3 schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the schema of a Go type, registering named structs as components
+func (s *Spec) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if override, ok := s.overrides[t]; ok {
+		return s.component(t, func() *Schema { return override })
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return s.component(t, func() *Schema { return s.structSchema(t) })
+	default:
+		// interface{} and anything else: any JSON value
+		return &Schema{}
+	}
+}
+
+// component registers a named type under components/schemas and returns a reference to it
+func (s *Spec) component(t reflect.Type, build func() *Schema) *Schema {
+	name := t.Name()
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := s.doc.Components.Schemas[name]; ok {
+		return ref
+	}
+
+	// Reserve the name first so self-referencing types terminate
+	s.doc.Components.Schemas[name] = &Schema{}
+	s.doc.Components.Schemas[name] = build()
+	return ref
+}
+
+// structSchema builds an object schema from a struct's exported, JSON-visible fields.
+// For DTOs with `validate` tags the tags decide which fields are required and add
+// constraints; otherwise fields without omitempty are listed as required.
+func (s *Spec) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	validated := hasValidateTags(t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embeddedType := field.Type
+			if embeddedType.Kind() == reflect.Pointer {
+				embeddedType = embeddedType.Elem()
+			}
+			embedded := s.structSchema(embeddedType)
+			for k, v := range embedded.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := s.schemaFor(field.Type)
+		schema.Properties[name] = fieldSchema
+
+		if validated {
+			rules := validate.Rules(field.Tag.Get("validate"))
+			if applyRules(fieldSchema, rules) {
+				schema.Required = append(schema.Required, name)
+			}
+		} else if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// hasValidateTags reports whether any field of a struct carries validation rules
+func hasValidateTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("validate") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules adds validation constraints to an inline field schema, reporting whether the field is required
+func applyRules(schema *Schema, rules []validate.Rule) bool {
+	required := false
+	for _, rule := range rules {
+		n, err := strconv.Atoi(rule.Param)
+		hasN := err == nil
+
+		switch {
+		case rule.Name == "required":
+			required = true
+		case schema.Ref != "":
+			// Constraints can't be attached to a $ref
+		case rule.Name == "min" && hasN && schema.Type == "string":
+			schema.MinLength = &n
+		case rule.Name == "max" && hasN && schema.Type == "string":
+			schema.MaxLength = &n
+		case rule.Name == "min" && hasN && schema.Type == "array":
+			schema.MinItems = &n
+		case rule.Name == "max" && hasN && schema.Type == "array":
+			schema.MaxItems = &n
+		case rule.Name == "oneof":
+			schema.Enum = strings.Fields(rule.Param)
+		case rule.Name == "pattern":
+			if re, ok := validate.Pattern(rule.Param); ok {
+				schema.Pattern = re.String()
+			}
+		case rule.Name == "prefix":
+			schema.Pattern = "^" + regexp.QuoteMeta(rule.Param)
+		}
+	}
+	return required
+}
@@ -0,0 +1,254 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Operation documents one method on one route
+type Operation struct {
+	Method      string   // HTTP method; required when the route pattern has none
+	Summary     string   // One-line summary
+	Description string   // Optional longer description
+	Tags        []string // Grouping in generated clients and Swagger UI
+	Public      bool     // No bearer token required
+	APIKey      bool     // An X-API-Key header is accepted instead of a bearer token
+	Roles       []string // App roles required (documents 403 responses)
+	Request     any      // Example value of the JSON request body type, e.g. handlers.SendMessageRequest{}
+	Response    any      // Example value of the JSON success response type; nil for an untyped object
+	Status      int      // Success status code (default 200)
+	Query       []Param  // Query string parameters
+	Headers     []Param  // Request headers
+}
+
+// Param documents a query string parameter or request header
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]*opObject `json:"paths"`
+	Components components                      `json:"components"`
+}
+
+// Info is the OpenAPI info object
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`   // apiKey schemes
+	Name         string `json:"name,omitempty"` // apiKey schemes
+}
+
+type opObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Security    []map[string][]string `json:"security"`
+	Parameters  []paramObject         `json:"parameters,omitempty"`
+	RequestBody *bodyObject           `json:"requestBody,omitempty"`
+	Responses   map[string]*response  `json:"responses"`
+}
+
+type paramObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type bodyObject struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// problemSchema documents RFC 7807 error responses (see internal/problem)
+var problemSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"type":      {Type: "string", Description: "Problem type, e.g. /problems/token_expired"},
+		"title":     {Type: "string"},
+		"status":    {Type: "integer", Format: "int32"},
+		"detail":    {Type: "string"},
+		"instance":  {Type: "string"},
+		"requestId": {Type: "string"},
+	},
+	Required: []string{"type", "title", "status"},
+}
+
+// Spec collects documented routes into an OpenAPI document
+type Spec struct {
+	doc       *Document
+	overrides map[reflect.Type]*Schema
+}
+
+// NewSpec creates an empty spec
+func NewSpec(info Info) *Spec {
+	return &Spec{
+		doc: &Document{
+			OpenAPI: "3.0.3",
+			Info:    info,
+			Paths:   make(map[string]map[string]*opObject),
+			Components: components{
+				Schemas: map[string]*Schema{"Problem": problemSchema},
+				SecuritySchemes: map[string]securityScheme{
+					"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+					"apiKeyAuth": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				},
+			},
+		},
+		overrides: make(map[reflect.Type]*Schema),
+	}
+}
+
+// Define sets the schema of a type whose JSON form isn't derived from its fields (custom marshalers)
+func (s *Spec) Define(v any, schema *Schema) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s.overrides[t] = schema
+}
+
+// Add documents an operation on a route pattern ("[METHOD ]/path/{param}")
+func (s *Spec) Add(pattern string, op Operation) {
+	method, path, hasMethod := strings.Cut(pattern, " ")
+	if !hasMethod {
+		method, path = op.Method, pattern
+	}
+	method = strings.ToLower(method)
+	if method == "" {
+		method = "get"
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	o := &opObject{
+		OperationID: operationID(method, path),
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Security:    []map[string][]string{{"bearerAuth": {}}},
+		Responses:   make(map[string]*response),
+	}
+	if op.Public {
+		o.Security = []map[string][]string{}
+	}
+	if op.APIKey {
+		o.Security = append(o.Security, map[string][]string{"apiKeyAuth": {}})
+	}
+
+	for _, name := range pathParams(path) {
+		o.Parameters = append(o.Parameters, paramObject{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, q := range op.Query {
+		o.Parameters = append(o.Parameters, paramObject{Name: q.Name, In: "query", Description: q.Description, Required: q.Required, Schema: &Schema{Type: "string"}})
+	}
+	for _, h := range op.Headers {
+		o.Parameters = append(o.Parameters, paramObject{Name: h.Name, In: "header", Description: h.Description, Required: h.Required, Schema: &Schema{Type: "string"}})
+	}
+
+	if op.Request != nil {
+		o.RequestBody = &bodyObject{
+			Required: true,
+			Content:  map[string]mediaType{"application/json": {Schema: s.schemaFor(reflect.TypeOf(op.Request))}},
+		}
+		o.Responses["400"] = problemResponse("Invalid request body")
+		o.Responses["413"] = problemResponse("Request body too large")
+	}
+
+	success := &Schema{Type: "object"}
+	if op.Response != nil {
+		success = s.schemaFor(reflect.TypeOf(op.Response))
+	}
+	o.Responses[fmt.Sprint(status)] = &response{Description: http.StatusText(status)}
+	if status != http.StatusSwitchingProtocols && status != http.StatusNoContent {
+		o.Responses[fmt.Sprint(status)].Content = map[string]mediaType{"application/json": {Schema: success}}
+	}
+
+	if !op.Public {
+		o.Responses["401"] = problemResponse("Missing or invalid bearer token")
+		if op.APIKey {
+			o.Responses["401"] = problemResponse("Missing or invalid bearer token or API key")
+		}
+	}
+	if len(op.Roles) > 0 {
+		o.Responses["403"] = problemResponse("Requires one of the roles: " + strings.Join(op.Roles, ", "))
+	}
+
+	if s.doc.Paths[path] == nil {
+		s.doc.Paths[path] = make(map[string]*opObject)
+	}
+	s.doc.Paths[path][method] = o
+}
+
+// Document returns the assembled OpenAPI document
+func (s *Spec) Document() *Document {
+	return s.doc
+}
+
+func problemResponse(description string) *response {
+	return &response{
+		Description: description,
+		Content:     map[string]mediaType{"application/problem+json": {Schema: &Schema{Ref: "#/components/schemas/Problem"}}},
+	}
+}
+
+// pathParams returns the {param} names in a path
+func pathParams(path string) []string {
+	var params []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}"))
+		}
+	}
+	return params
+}
+
+// operationID derives a stable camelCase ID from method and path, e.g. postAdminTenantsIdFreeze
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(method)
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.Trim(segment, "{}")
+		if segment == "" || segment == "api" || segment == "v1" {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+// Package origins matches browser origins against allowed origin patterns, for CORS,
+// WebSocket upgrades and the origins of onboarded tenants
+package origins
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RegexPrefix marks an allowed origin that's a regular expression matched against the
+// whole origin, e.g. regex:https://pr-[0-9]+\.example\.com (anchors are implied)
+const RegexPrefix = "regex:"
+
+// regexps caches the compiled regular expressions of allowed origins
+var regexps sync.Map // Pattern -> *regexp.Regexp (nil when invalid)
+
+// Match reports whether the origin is one of the allowed ones, each of which is:
+//   - "*", matching any origin
+//   - an origin, e.g. https://chat.example.com, matching it on the default port of its scheme
+//     unless one is given
+//   - a wildcard subdomain, e.g. *.example.com (any scheme and port) or https://*.example.com
+//     (HTTPS on port 443), matching https://app.example.com but not https://example.com or
+//     https://evilexample.com
+//   - a regular expression with RegexPrefix
+//
+// Schemes and hosts are compared case-insensitively.
+func Match(origin string, allowedOrigins []string) bool {
+	if origin == "" {
+		return false
+	}
+	scheme, host, port, ok := split(origin)
+	for _, allowedOrigin := range allowedOrigins {
+		switch {
+		case allowedOrigin == "*":
+			return true
+		case strings.HasPrefix(allowedOrigin, RegexPrefix):
+			if re := compile(allowedOrigin); re != nil && re.MatchString(origin) {
+				return true
+			}
+		case ok && matchPattern(allowedOrigin, scheme, host, port):
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches the parts of an origin against an exact or wildcard pattern
+func matchPattern(pattern, scheme, host, port string) bool {
+	patternScheme, patternHost, patternPort := "", pattern, ""
+	if strings.Contains(pattern, "://") {
+		var ok bool
+		if patternScheme, patternHost, patternPort, ok = split(pattern); !ok {
+			return false
+		}
+		if patternScheme != scheme || patternPort != port {
+			return false
+		}
+	} else if h, p, err := net.SplitHostPort(pattern); err == nil {
+		patternHost, patternPort = strings.ToLower(h), p
+		if patternPort != port {
+			return false
+		}
+	} else {
+		patternHost = strings.ToLower(pattern)
+	}
+
+	if domain, ok := strings.CutPrefix(patternHost, "*."); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+	return host == patternHost
+}
+
+// split splits an origin (scheme://host[:port]) into its lower-case scheme and host and
+// its port, defaulting to the scheme's
+func split(origin string) (scheme, host, port string, ok bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.User != nil {
+		return "", "", "", false
+	}
+	scheme, host, port = strings.ToLower(u.Scheme), strings.ToLower(u.Hostname()), u.Port()
+	if port == "" {
+		switch scheme {
+		case "http", "ws":
+			port = "80"
+		case "https", "wss":
+			port = "443"
+		}
+	}
+	return scheme, host, port, true
+}
+
+// compile returns the compiled regular expression of an allowed origin, anchored at both
+// ends, or nil when it's invalid (which configuration validation rejects)
+func compile(pattern string) *regexp.Regexp {
+	if cached, ok := regexps.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(`^(?:` + strings.TrimPrefix(pattern, RegexPrefix) + `)$`)
+	if err != nil {
+		re = nil
+	}
+	regexps.Store(pattern, re)
+	return re
+}
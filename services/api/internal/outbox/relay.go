@@ -0,0 +1,120 @@
+// Package outbox relays the messages recorded in the message store's transactional outbox to
+// external publishers, so every persisted message gets published even when a replica dies
+// between saving it and publishing it
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"api-service/internal/events"
+	"api-service/internal/store"
+)
+
+// JobName is the name of the relay's singleton job
+const JobName = "outbox-relay"
+
+// batchSize is the number of outbox entries published at once
+const batchSize = 100
+
+// Publisher publishes message events, returning once they are accepted
+type Publisher interface {
+	Publish(ctx context.Context, events []*events.Event) error
+}
+
+// Stats reports relay metrics
+type Stats struct {
+	Relayed  int64 `json:"relayed"`
+	Failures int64 `json:"failures"`
+	Backlog  int64 `json:"backlog"` // Entries waiting after the last run on this replica
+}
+
+// Relay publishes outbox entries and removes them once every publisher accepted them. It runs
+// as a singleton job, so one replica relays at a time, in order. Delivery is at-least-once:
+// when a run fails after a publisher accepted a batch (the replica died, or the entries
+// couldn't be removed), the batch is published again with the same event IDs, for consumers
+// to drop as duplicates.
+type Relay struct {
+	outbox     store.OutboxStore
+	publishers []Publisher
+
+	relayed  atomic.Int64
+	failures atomic.Int64
+	backlog  atomic.Int64
+}
+
+// NewRelay creates a relay from outbox to publishers
+func NewRelay(outbox store.OutboxStore, publishers ...Publisher) *Relay {
+	return &Relay{
+		outbox:     outbox,
+		publishers: publishers,
+	}
+}
+
+// Run publishes the pending entries until the outbox is empty
+func (r *Relay) Run(ctx context.Context) error {
+	defer func() {
+		if backlog, err := r.outbox.OutboxBacklog(ctx); err == nil {
+			r.backlog.Store(int64(backlog))
+		}
+	}()
+
+	for {
+		entries, err := r.outbox.PendingOutbox(ctx, batchSize)
+		if err != nil {
+			r.failures.Add(1)
+			return fmt.Errorf("reading the outbox: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		evts := make([]*events.Event, len(entries))
+		seqs := make([]int64, len(entries))
+		for i, entry := range entries {
+			evts[i] = Event(entry.Message)
+			seqs[i] = entry.Seq
+		}
+		for _, publisher := range r.publishers {
+			if err := publisher.Publish(ctx, evts); err != nil {
+				r.failures.Add(1)
+				return fmt.Errorf("publishing %d outbox entries: %w", len(entries), err)
+			}
+		}
+		if err := r.outbox.DeleteOutbox(ctx, seqs); err != nil {
+			r.failures.Add(1)
+			return fmt.Errorf("removing %d published outbox entries: %w", len(entries), err)
+		}
+		r.relayed.Add(int64(len(entries)))
+
+		if len(entries) < batchSize {
+			return nil
+		}
+	}
+}
+
+// Stats returns relay metrics
+func (r *Relay) Stats() Stats {
+	return Stats{
+		Relayed:  r.relayed.Load(),
+		Failures: r.failures.Load(),
+		Backlog:  r.backlog.Load(),
+	}
+}
+
+// Event rebuilds the chat event a persisted message was delivered with, keeping its ID and
+// timestamp. The sender's email isn't stored, so it's left out.
+func Event(msg *store.Message) *events.Event {
+	var event *events.Event
+	if roomID, ok := strings.CutPrefix(msg.ConversationID, store.RoomConversationID("")); ok {
+		event = events.NewRoomChatEvent(roomID, msg.SenderID, msg.SenderName, "", msg.Message)
+	} else {
+		event = events.NewChatEvent(msg.SenderID, msg.SenderName, "", msg.Message)
+	}
+	event = events.InThread(event, msg.ParentID)
+	event.ID = msg.ID
+	event.Timestamp = msg.CreatedAt
+	return event
+}
@@ -0,0 +1,80 @@
+package problem
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"api-service/internal/requestid"
+)
+
+// ContentType is the media type of RFC 7807 problem details
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes problem codes to form the problem type URI
+const TypeBase = "/problems/"
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type      string `json:"type"`                // Stable identifier clients can switch on, e.g. /problems/token_expired
+	Title     string `json:"title"`               // Short summary of the problem type
+	Status    int    `json:"status"`              // HTTP status code
+	Detail    string `json:"detail,omitempty"`    // Explanation specific to this occurrence
+	Instance  string `json:"instance,omitempty"`  // Request path the problem occurred on
+	RequestID string `json:"requestId,omitempty"` // Correlates the response with server logs
+
+	InvalidParams []InvalidParam `json:"invalidParams,omitempty"` // Field-level details for validation failures
+	Quota         *Quota         `json:"quota,omitempty"`         // Usage details for quota problems
+}
+
+// InvalidParam describes why one request field was rejected
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Quota describes the quota a request would have exceeded
+type Quota struct {
+	Scope          string `json:"scope"` // What the quota applies to, e.g. "user" or "room"
+	UsedBytes      int64  `json:"usedBytes"`
+	LimitBytes     int64  `json:"limitBytes"`
+	RequestedBytes int64  `json:"requestedBytes"`
+}
+
+// New creates a problem for a request. code identifies the problem type (e.g. "token_expired").
+func New(r *http.Request, status int, code, detail string) *Problem {
+	p := &Problem{
+		Type:   TypeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+	return p
+}
+
+// Write writes a problem details response
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	New(r, status, code, detail).Write(w)
+}
+
+// Write writes the problem as the response
+func (p *Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Printf("Error encoding problem response: %v", err)
+	}
+}
+
+// JSON returns the encoded problem, for APIs that take a pre-rendered body
+func (p *Problem) JSON() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
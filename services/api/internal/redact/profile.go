@@ -0,0 +1,75 @@
+// Package redact removes or pseudonymizes PII and profanity in data leaving the service
+// through outbound sinks (exports, webhooks, event streams) and in audit record details. Each
+// sink is assigned a profile describing what to do with emails, user IDs, display names and
+// message content. Credentials (tokens, passwords, secrets) are masked by every profile.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Action is what a profile does with one kind of data
+type Action string
+
+const (
+	Keep Action = "keep" // Leave as is
+	Drop Action = "drop" // Remove the field
+	Mask Action = "mask" // Replace with a placeholder; in content, scrub PII and profanity from the text
+	Hash Action = "hash" // Replace with a stable keyed hash (a pseudonym that can still be joined on)
+)
+
+// Placeholder replaces masked values
+const Placeholder = "[redacted]"
+
+// Profile describes how a sink's data is redacted
+type Profile struct {
+	Name       string   `json:"name"`
+	Emails     Action   `json:"emails,omitempty"`     // Email fields, and addresses inside message content
+	UserIDs    Action   `json:"userIds,omitempty"`    // User ID fields (userId, from, to, actor, ...)
+	Names      Action   `json:"names,omitempty"`      // Display name fields
+	Content    Action   `json:"content,omitempty"`    // Message bodies
+	Profanity  bool     `json:"profanity,omitempty"`  // Mask profane words in content that is kept
+	DropFields []string `json:"dropFields,omitempty"` // Additional fields removed wherever they appear
+}
+
+// Built-in profiles
+var builtins = map[string]Profile{
+	"none":     {Name: "none"},
+	"internal": {Name: "internal", Profanity: true},
+	"partner":  {Name: "partner", Emails: Mask, UserIDs: Hash, Content: Mask, Profanity: true},
+	"strict":   {Name: "strict", Emails: Drop, UserIDs: Hash, Names: Drop, Content: Drop},
+}
+
+// validate checks the profile's actions and fills in defaults (Keep)
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("redaction profile is missing 'name'")
+	}
+
+	for field, action := range map[string]*Action{"emails": &p.Emails, "userIds": &p.UserIDs, "names": &p.Names, "content": &p.Content} {
+		switch *action {
+		case "":
+			*action = Keep
+		case Keep, Drop, Mask, Hash:
+		default:
+			return fmt.Errorf("redaction profile %q: invalid %s action %q", p.Name, field, *action)
+		}
+	}
+	if p.Content == Hash {
+		return fmt.Errorf("redaction profile %q: content can't be hashed", p.Name)
+	}
+	return nil
+}
+
+// ParseProfiles parses a JSON array of custom profiles (the REDACTION_PROFILES setting)
+func ParseProfiles(value string) ([]Profile, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var profiles []Profile
+	if err := json.Unmarshal([]byte(value), &profiles); err != nil {
+		return nil, fmt.Errorf("invalid redaction profiles: %w", err)
+	}
+	return profiles, nil
+}
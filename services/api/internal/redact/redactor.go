@@ -0,0 +1,179 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Redactor redacts a JSON document (as produced by encoding/json: maps, slices and scalars)
+type Redactor interface {
+	Redact(doc interface{}) interface{}
+}
+
+// Apply converts v to a generic JSON document and redacts it
+func Apply(r Redactor, v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return r.Redact(doc), nil
+}
+
+// Field kinds, by lower-cased JSON key
+var (
+	emailFields   = set("email", "mail", "upn", "preferred_username")
+	userIDFields  = set("userid", "user_id", "oid", "sub", "from", "to", "actor", "recipient", "sender")
+	nameFields    = set("name", "displayname", "display_name", "username")
+	contentFields = set("content", "text", "message", "body")
+
+	// Credentials are masked by every profile, including none
+	credentialFields = set("token", "accesstoken", "access_token", "refreshtoken", "refresh_token", "idtoken", "id_token",
+		"password", "secret", "clientsecret", "client_secret", "apikey", "api_key", "authorization", "cookie")
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?\(?\d{2,4}\)?[\s.-]?\d{3,4}[\s.-]?\d{3,4}\b`)
+
+	// Bearer credentials and JWTs inside any string
+	tokenPattern = regexp.MustCompile(`(?i:bearer)\s+[A-Za-z0-9._~+/-]+=*|eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// profileRedactor applies a Profile
+type profileRedactor struct {
+	profile   Profile
+	hashKey   []byte
+	drop      map[string]bool
+	profanity *regexp.Regexp
+}
+
+// Redact redacts doc in place and returns it
+func (r *profileRedactor) Redact(doc interface{}) interface{} {
+	return r.value("", doc)
+}
+
+func (r *profileRedactor) value(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if credentialFields[key] {
+			return Placeholder
+		}
+		if contentFields[key] && r.profile.Content == Mask {
+			return r.scrubAll(v)
+		}
+		for k, child := range v {
+			lower := strings.ToLower(k)
+			if r.drop[lower] || r.action(lower) == Drop {
+				delete(v, k)
+				continue
+			}
+			v[k] = r.value(lower, child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.value(key, child)
+		}
+		return v
+	case string:
+		return r.str(key, v)
+	default:
+		return v
+	}
+}
+
+// action returns what the profile does with a field
+func (r *profileRedactor) action(key string) Action {
+	switch {
+	case emailFields[key]:
+		return r.profile.Emails
+	case userIDFields[key]:
+		return r.profile.UserIDs
+	case nameFields[key]:
+		return r.profile.Names
+	case contentFields[key]:
+		return r.profile.Content
+	}
+	return Keep
+}
+
+func (r *profileRedactor) str(key, s string) string {
+	if credentialFields[key] {
+		return Placeholder
+	}
+	s = tokenPattern.ReplaceAllString(s, Placeholder)
+
+	action := r.action(key)
+	switch {
+	case contentFields[key]:
+		if action == Mask {
+			return r.scrub(s)
+		}
+		return r.scrubProfanity(s)
+	case action == Mask:
+		return Placeholder
+	case action == Hash:
+		return r.hash(s)
+	}
+	return s
+}
+
+// scrubAll scrubs every string inside a structured message body
+func (r *profileRedactor) scrubAll(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = r.scrubAll(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.scrubAll(child)
+		}
+		return v
+	case string:
+		return r.scrub(v)
+	default:
+		return v
+	}
+}
+
+// scrub masks credentials, email addresses, phone numbers and profanity inside free text
+func (r *profileRedactor) scrub(s string) string {
+	s = tokenPattern.ReplaceAllString(s, Placeholder)
+	s = emailPattern.ReplaceAllString(s, Placeholder)
+	s = phonePattern.ReplaceAllString(s, Placeholder)
+	return r.scrubProfanity(s)
+}
+
+func (r *profileRedactor) scrubProfanity(s string) string {
+	if !r.profile.Profanity || r.profanity == nil {
+		return s
+	}
+	return r.profanity.ReplaceAllStringFunc(s, func(word string) string {
+		return strings.Repeat("*", len(word))
+	})
+}
+
+// hash returns a keyed SHA-256 pseudonym, stable for a given key
+func (r *profileRedactor) hash(s string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(s))
+	return "h:" + hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+func set(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
@@ -0,0 +1,142 @@
+package redact
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Sink names used by the outbound adapters
+const (
+	SinkExport    = "export"    // Tenant data exports
+	SinkWebhooks  = "webhooks"  // Outbound webhooks
+	SinkEventHubs = "eventhubs" // Event Hubs firehose
+	SinkEventGrid = "eventgrid" // Event Grid system events
+	SinkAudit     = "audit"     // Details of audit records, in the service log, the audit file and audit sinks
+)
+
+// DefaultProfanity is the word list used when none is configured
+var DefaultProfanity = []string{"fuck", "shit", "bitch", "bastard", "asshole", "dick", "cunt", "damn"}
+
+// Sinks maps outbound sinks to their redactors
+type Sinks struct {
+	redactors map[string]Redactor
+	profiles  map[string]Profile
+	assigned  map[string]string
+	fallback  string
+}
+
+// Config configures the sink redactors
+type Config struct {
+	Profiles       []Profile         // Custom profiles, in addition to the built-ins (none, internal, partner, strict)
+	Assignments    map[string]string // Sink name -> profile name
+	DefaultProfile string            // Profile for sinks without an assignment
+	HashKey        string            // Key for hashed pseudonyms; random (unstable across restarts) when empty
+	Profanity      []string          // Words masked by profiles with Profanity set
+}
+
+// NewSinks validates the configuration and builds a redactor per profile
+func NewSinks(cfg Config) (*Sinks, error) {
+	profiles := make(map[string]Profile, len(builtins)+len(cfg.Profiles))
+	for name, profile := range builtins {
+		profiles[name] = profile
+	}
+	for _, profile := range cfg.Profiles {
+		if _, exists := builtins[profile.Name]; exists {
+			return nil, fmt.Errorf("redaction profile %q redefines a built-in profile", profile.Name)
+		}
+		profiles[profile.Name] = profile
+	}
+
+	hashKey := []byte(cfg.HashKey)
+	if len(hashKey) == 0 {
+		hashKey = make([]byte, 32)
+		rand.Read(hashKey)
+		log.Printf("⚠️  REDACTION_HASH_KEY not set; hashed IDs won't be stable across restarts")
+	}
+
+	words := cfg.Profanity
+	if len(words) == 0 {
+		words = DefaultProfanity
+	}
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(strings.TrimSpace(word))
+	}
+	profanity := regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+
+	s := &Sinks{
+		redactors: make(map[string]Redactor, len(profiles)),
+		profiles:  profiles,
+		assigned:  cfg.Assignments,
+		fallback:  cfg.DefaultProfile,
+	}
+	for name, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return nil, err
+		}
+		profiles[name] = profile
+
+		drop := make(map[string]bool, len(profile.DropFields))
+		for _, field := range profile.DropFields {
+			drop[strings.ToLower(field)] = true
+		}
+		s.redactors[name] = &profileRedactor{profile: profile, hashKey: hashKey, drop: drop, profanity: profanity}
+	}
+
+	if s.fallback == "" {
+		s.fallback = "strict"
+	}
+	if _, ok := profiles[s.fallback]; !ok {
+		return nil, fmt.Errorf("unknown default redaction profile %q", s.fallback)
+	}
+	for sink, name := range s.assigned {
+		if _, ok := profiles[name]; !ok {
+			return nil, fmt.Errorf("sink %q uses unknown redaction profile %q", sink, name)
+		}
+	}
+	return s, nil
+}
+
+// ParseAssignments parses "sink=profile" pairs separated by commas (the SINK_REDACTION setting)
+func ParseAssignments(value string) (map[string]string, error) {
+	assignments := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		sink, profile, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sink redaction %q: expected <sink>=<profile>", entry)
+		}
+		assignments[strings.TrimSpace(sink)] = strings.TrimSpace(profile)
+	}
+	return assignments, nil
+}
+
+// For returns the redactor for a sink
+func (s *Sinks) For(sink string) Redactor {
+	return s.redactors[s.ProfileName(sink)]
+}
+
+// ProfileName returns the name of the profile applied to a sink
+func (s *Sinks) ProfileName(sink string) string {
+	if name, ok := s.assigned[sink]; ok {
+		return name
+	}
+	return s.fallback
+}
+
+// Profiles returns every known profile ordered by name
+func (s *Sinks) Profiles() []Profile {
+	profiles := make([]Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
@@ -0,0 +1,198 @@
+// Package retention enforces how long chat messages are kept: policies set service-wide, per
+// tenant or per room, and a reaper that deletes or archives messages once they expire
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is what happens to expired messages
+type Action string
+
+// Retention actions
+const (
+	ActionDelete  Action = "delete"  // Messages are removed for good
+	ActionArchive Action = "archive" // Messages are copied to the archive container, then removed
+)
+
+// Policy scopes, from the most general to the most specific
+const (
+	ScopeDefault = "default"
+	ScopeTenant  = "tenant"
+	ScopeRoom    = "room"
+)
+
+// MaxDays bounds the retention period that can be configured (100 years)
+const MaxDays = 36500
+
+// Policy sets how long messages are kept. Zero days keeps messages forever.
+type Policy struct {
+	Days      int       `json:"days"`
+	Action    Action    `json:"action"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+}
+
+// Effective is the policy that applies to a conversation, and where it was set
+type Effective struct {
+	Days      int        `json:"days"`
+	Action    Action     `json:"action"`
+	Scope     string     `json:"scope"`               // default, tenant or room
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Messages sent before this time are due for removal; unset when kept forever
+}
+
+// Overrides lists the tenant and room policies replacing the default
+type Overrides struct {
+	Default Policy             `json:"default"`
+	Tenants map[string]*Policy `json:"tenants"`
+	Rooms   map[string]*Policy `json:"rooms"`
+}
+
+// Policies holds the service-wide retention policy and the tenant and room policies that
+// override it. A room's policy beats its tenant's, which beats the default.
+type Policies struct {
+	mu         sync.RWMutex
+	def        Policy
+	tenants    map[string]*Policy // Tenant ID -> policy
+	rooms      map[string]*Policy // Room ID -> policy
+	canArchive bool
+}
+
+// NewPolicies creates policies with the given default. canArchive reports whether an
+// archive container is configured; without one, archive policies are refused.
+func NewPolicies(def Policy, canArchive bool) (*Policies, error) {
+	p := &Policies{
+		tenants:    make(map[string]*Policy),
+		rooms:      make(map[string]*Policy),
+		canArchive: canArchive,
+	}
+	if err := p.check(&def); err != nil {
+		return nil, fmt.Errorf("invalid default retention policy: %w", err)
+	}
+	p.def = def
+	return p, nil
+}
+
+// check validates a policy, defaulting its action to delete
+func (p *Policies) check(policy *Policy) error {
+	if policy.Days < 0 || policy.Days > MaxDays {
+		return fmt.Errorf("days must be between 0 (keep forever) and %d", MaxDays)
+	}
+	switch policy.Action {
+	case "":
+		policy.Action = ActionDelete
+	case ActionDelete:
+	case ActionArchive:
+		if !p.canArchive {
+			return fmt.Errorf("archive requires RETENTION_ARCHIVE_CONTAINER_URL")
+		}
+	default:
+		return fmt.Errorf("unknown action %q (expected %s or %s)", policy.Action, ActionDelete, ActionArchive)
+	}
+	return nil
+}
+
+// SetTenant sets the policy of a tenant's conversations; nil restores the default
+func (p *Policies) SetTenant(tenantID string, policy *Policy) (*Policy, error) {
+	return p.set(p.tenants, strings.ToLower(tenantID), policy)
+}
+
+// SetRoom sets the policy of a room; nil restores its tenant's policy
+func (p *Policies) SetRoom(roomID string, policy *Policy) (*Policy, error) {
+	return p.set(p.rooms, roomID, policy)
+}
+
+func (p *Policies) set(policies map[string]*Policy, key string, policy *Policy) (*Policy, error) {
+	if policy == nil {
+		p.mu.Lock()
+		delete(policies, key)
+		p.mu.Unlock()
+		return nil, nil
+	}
+
+	stored := *policy
+	if err := p.check(&stored); err != nil {
+		return nil, err
+	}
+	stored.UpdatedAt = time.Now().UTC()
+
+	p.mu.Lock()
+	policies[key] = &stored
+	p.mu.Unlock()
+
+	result := stored
+	return &result, nil
+}
+
+// Effective returns the policy applying to messages of the tenant, in the given room (empty
+// for direct conversations)
+func (p *Policies) Effective(tenantID, roomID string) Effective {
+	p.mu.RLock()
+	policy, scope := p.def, ScopeDefault
+	if tenantPolicy, ok := p.tenants[strings.ToLower(tenantID)]; ok {
+		policy, scope = *tenantPolicy, ScopeTenant
+	}
+	if roomPolicy, ok := p.rooms[roomID]; ok && roomID != "" {
+		policy, scope = *roomPolicy, ScopeRoom
+	}
+	p.mu.RUnlock()
+
+	effective := Effective{Days: policy.Days, Action: policy.Action, Scope: scope}
+	if policy.Days > 0 {
+		expiresAt := Cutoff(time.Now(), policy.Days)
+		effective.ExpiresAt = &expiresAt
+	}
+	return effective
+}
+
+// Overrides returns the default policy with every tenant and room override
+func (p *Policies) Overrides() Overrides {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	overrides := Overrides{
+		Default: p.def,
+		Tenants: make(map[string]*Policy, len(p.tenants)),
+		Rooms:   make(map[string]*Policy, len(p.rooms)),
+	}
+	for id, policy := range p.tenants {
+		c := *policy
+		overrides.Tenants[id] = &c
+	}
+	for id, policy := range p.rooms {
+		c := *policy
+		overrides.Rooms[id] = &c
+	}
+	return overrides
+}
+
+// shortestDays returns the shortest retention of any policy, or 0 when every policy keeps
+// messages forever
+func (p *Policies) shortestDays() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	days := []int{p.def.Days}
+	for _, policy := range p.tenants {
+		days = append(days, policy.Days)
+	}
+	for _, policy := range p.rooms {
+		days = append(days, policy.Days)
+	}
+	sort.Ints(days)
+	for _, d := range days {
+		if d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Cutoff returns the time before which messages kept for the given days have expired
+func Cutoff(now time.Time, days int) time.Time {
+	return now.UTC().AddDate(0, 0, -days)
+}
@@ -0,0 +1,117 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"api-service/internal/blob"
+	"api-service/internal/store"
+)
+
+// JobName is the name of the reaper's singleton job
+const JobName = "message-retention"
+
+// reapBatchSize is the number of expired messages archived and purged at once
+const reapBatchSize = 100
+
+// Purger removes messages for good, releasing the storage they used
+type Purger func(ctx context.Context, msgs []*store.Message) error
+
+// Reaper removes messages that outlived their retention policy
+type Reaper struct {
+	policies   *Policies
+	store      store.RetentionStore
+	purge      Purger
+	archiveURL string // Container SAS URL archived messages are written to
+}
+
+// NewReaper creates a reaper scanning messageStore and removing expired messages with purge.
+// Messages under an archive policy are written to archiveURL first.
+func NewReaper(policies *Policies, messageStore store.RetentionStore, purge Purger, archiveURL string) *Reaper {
+	return &Reaper{
+		policies:   policies,
+		store:      messageStore,
+		purge:      purge,
+		archiveURL: archiveURL,
+	}
+}
+
+// Run removes every expired message once; it is run periodically as a singleton job
+func (r *Reaper) Run(ctx context.Context) error {
+	shortest := r.policies.shortestDays()
+	if shortest == 0 {
+		return nil // Everything is kept forever
+	}
+
+	now := time.Now()
+	var deleted, archived []*store.Message
+	var removed int
+	flush := func(msgs []*store.Message, action Action) error {
+		if len(msgs) == 0 {
+			return nil
+		}
+		if action == ActionArchive {
+			if err := r.archive(ctx, msgs, now); err != nil {
+				return err
+			}
+		}
+		if err := r.purge(ctx, msgs); err != nil {
+			return fmt.Errorf("failed to purge expired messages: %w", err)
+		}
+		removed += len(msgs)
+		return nil
+	}
+
+	err := r.store.ScanMessages(ctx, Cutoff(now, shortest), func(msg *store.Message) error {
+		roomID, _ := strings.CutPrefix(msg.ConversationID, store.RoomConversationID(""))
+		policy := r.policies.Effective(msg.TenantID, roomID)
+		if policy.Days == 0 || !msg.CreatedAt.Before(Cutoff(now, policy.Days)) {
+			return nil
+		}
+
+		if policy.Action == ActionArchive {
+			if archived = append(archived, msg); len(archived) == reapBatchSize {
+				err := flush(archived, ActionArchive)
+				archived = nil
+				return err
+			}
+			return nil
+		}
+		if deleted = append(deleted, msg); len(deleted) == reapBatchSize {
+			err := flush(deleted, ActionDelete)
+			deleted = nil
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush(archived, ActionArchive)
+	}
+	if err == nil {
+		err = flush(deleted, ActionDelete)
+	}
+
+	if removed > 0 {
+		log.Printf("🗑️  Retention: removed %d expired messages", removed)
+	}
+	return err
+}
+
+// archive writes a batch of messages to the archive container as a JSON array, one blob per
+// batch under archive/<date>/
+func (r *Reaper) archive(ctx context.Context, msgs []*store.Message, now time.Time) error {
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("failed to encode archived messages: %w", err)
+	}
+
+	name := fmt.Sprintf("archive/%s/%d-%s.json", now.UTC().Format("2006-01-02"), now.UnixNano(), msgs[0].ID)
+	if err := blob.UploadBlockBlob(ctx, r.archiveURL, name, "application/json", data); err != nil {
+		return fmt.Errorf("failed to archive expired messages: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package rolemap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/blob"
+)
+
+// guidPattern matches an Azure AD group object ID
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// blobName is the blob the table is persisted to, in the role mappings container
+const blobName = "role-mappings.json"
+
+// maxBlobBytes bounds the persisted table
+const maxBlobBytes = 1 << 20
+
+// ErrInvalidMappings is returned for a table with a malformed group ID or an empty role
+var ErrInvalidMappings = errors.New("invalid group role mappings")
+
+// Mapper maps Azure AD group memberships to logical app roles, for tenants that
+// don't configure app roles on their enterprise application. With a container URL, tables
+// set with Replace are persisted to Blob Storage and reloaded periodically, so every replica
+// applies them and they survive restarts.
+type Mapper struct {
+	containerURL string
+	groups       map[string][]string // Group object ID -> roles
+	mu           sync.RWMutex
+}
+
+// NewMapper creates a mapper with the given group → roles table, which a table persisted to
+// containerURL (if any) replaces when loaded
+func NewMapper(containerURL string, mappings map[string][]string) (*Mapper, error) {
+	m := &Mapper{containerURL: containerURL}
+	if err := m.Set(mappings); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Parse parses a mapping table in the form "<group-guid>:<role>,<group-guid>:<role>".
+// A group may appear more than once to grant several roles.
+func Parse(value string) (map[string][]string, error) {
+	mappings := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		group, role, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid group mapping %q: expected <group-id>:<role>", entry)
+		}
+		group = strings.TrimSpace(group)
+		mappings[group] = append(mappings[group], strings.TrimSpace(role))
+	}
+	return mappings, nil
+}
+
+// Set validates and replaces the whole mapping table on this replica only
+func (m *Mapper) Set(mappings map[string][]string) error {
+	normalized, err := normalize(mappings)
+	if err != nil {
+		return err
+	}
+	m.swap(normalized)
+	return nil
+}
+
+// Replace validates and replaces the whole mapping table, persisting it for every replica
+// when the mapper has a container
+func (m *Mapper) Replace(ctx context.Context, mappings map[string][]string) error {
+	normalized, err := normalize(mappings)
+	if err != nil {
+		return err
+	}
+	if m.containerURL != "" {
+		data, err := json.Marshal(normalized)
+		if err != nil {
+			return err
+		}
+		if err := blob.UploadBlockBlob(ctx, m.containerURL, blobName, "application/json", data); err != nil {
+			return fmt.Errorf("persisting group role mappings: %w", err)
+		}
+	}
+	m.swap(normalized)
+	return nil
+}
+
+// Load reads the persisted table, at startup
+func (m *Mapper) Load(ctx context.Context) error {
+	if m.containerURL == "" {
+		return nil
+	}
+	return m.reload(ctx)
+}
+
+// Run reloads the persisted table every interval until ctx is cancelled; it returns at once
+// without a container
+func (m *Mapper) Run(ctx context.Context, interval time.Duration) {
+	if m.containerURL == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := m.reload(ctx); err != nil {
+			log.Printf("⚠️  Failed to reload group role mappings: %v", err)
+		}
+	}
+}
+
+// reload replaces the table with the persisted one, if a table was persisted and differs
+func (m *Mapper) reload(ctx context.Context) error {
+	data, err := blob.DownloadBlob(ctx, m.containerURL, blobName, maxBlobBytes)
+	if err != nil || data == nil {
+		return err
+	}
+	var mappings map[string][]string
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return fmt.Errorf("decoding group role mappings: %w", err)
+	}
+	normalized, err := normalize(mappings)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	unchanged := reflect.DeepEqual(m.groups, normalized)
+	m.mu.RUnlock()
+	if !unchanged {
+		m.swap(normalized)
+	}
+	return nil
+}
+
+// swap installs a normalized table
+func (m *Mapper) swap(normalized map[string][]string) {
+	m.mu.Lock()
+	m.groups = normalized
+	m.mu.Unlock()
+
+	log.Printf("👥 Group role mappings updated: %d groups", len(normalized))
+}
+
+// normalize validates a table, lowercasing group IDs and sorting and deduplicating roles
+func normalize(mappings map[string][]string) (map[string][]string, error) {
+	normalized := make(map[string][]string, len(mappings))
+	for group, roles := range mappings {
+		if !guidPattern.MatchString(group) {
+			return nil, fmt.Errorf("%w: invalid group ID %q: must be a GUID", ErrInvalidMappings, group)
+		}
+		for _, role := range roles {
+			if role == "" {
+				return nil, fmt.Errorf("%w: empty role for group %s", ErrInvalidMappings, group)
+			}
+		}
+		normalized[strings.ToLower(group)] = dedupe(roles)
+	}
+	return normalized, nil
+}
+
+// Snapshot returns a copy of the current mapping table
+func (m *Mapper) Snapshot() map[string][]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := make(map[string][]string, len(m.groups))
+	for group, roles := range m.groups {
+		snapshot[group] = append([]string{}, roles...)
+	}
+	return snapshot
+}
+
+// Apply returns the token roles merged with the roles granted by the given group memberships
+func (m *Mapper) Apply(roles, groups []string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.groups) == 0 || len(groups) == 0 {
+		return roles
+	}
+
+	merged := append([]string{}, roles...)
+	for _, group := range groups {
+		merged = append(merged, m.groups[strings.ToLower(group)]...)
+	}
+	return dedupe(merged)
+}
+
+// dedupe returns the sorted unique values of a slice
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
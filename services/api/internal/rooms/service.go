@@ -0,0 +1,315 @@
+// Package rooms implements group chat: users of a tenant create and join rooms, and messages
+// sent to a room fan out to all of its connected members
+package rooms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"api-service/internal/chat"
+	"api-service/internal/events"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/retention"
+	"api-service/internal/store"
+	"api-service/internal/tenants"
+	"api-service/internal/usage"
+)
+
+var (
+	// ErrRoomNotFound is also returned for rooms of other tenants, so their IDs aren't revealed
+	ErrRoomNotFound = store.ErrRoomNotFound
+	ErrNotMember    = errors.New("not a member of the room")
+)
+
+// Details is a room with its members
+type Details struct {
+	*store.Room
+	Members   []*store.Member      `json:"members"`
+	Usage     usage.Usage          `json:"usage"`               // Storage used by the room's messages
+	Retention *retention.Effective `json:"retention,omitempty"` // How long the room's messages are kept
+}
+
+// Delivery reports a message sent to a room
+type Delivery struct {
+	MessageID string `json:"messageId"`
+	Delivered int    `json:"delivered"` // Members connected to this replica who received it
+}
+
+// Service manages rooms and delivers room messages
+type Service struct {
+	manager *events.Manager
+	tenants *tenants.Registry
+	usage   *usage.Tracker
+	store   store.Store
+
+	retention *retention.Policies   // Nil when retention isn't enforced
+	moderator *moderation.Moderator // Nil when moderation is disabled
+}
+
+// NewService creates a new rooms service
+func NewService(manager *events.Manager, registry *tenants.Registry, tracker *usage.Tracker, rooms store.Store) *Service {
+	return &Service{
+		manager: manager,
+		tenants: registry,
+		usage:   tracker,
+		store:   rooms,
+	}
+}
+
+// SetRetention sets the retention policies reported in room details
+func (s *Service) SetRetention(policies *retention.Policies) {
+	s.retention = policies
+}
+
+// SetModerator screens the content of room messages before it is delivered
+func (s *Service) SetModerator(moderator *moderation.Moderator) {
+	s.moderator = moderator
+}
+
+// Create creates a room in the user's tenant, with the user as its first member
+func (s *Service) Create(ctx context.Context, user *models.User, name string) (*Details, error) {
+	if s.tenants.IsReadOnly(user.TenantID) {
+		return nil, chat.ErrTenantReadOnly
+	}
+
+	now := time.Now().UTC()
+	room := &store.Room{
+		ID:        newRoomID(),
+		Name:      name,
+		TenantID:  user.TenantID,
+		CreatedBy: user.ID,
+		CreatedAt: now,
+	}
+	if err := s.store.CreateRoom(ctx, room); err != nil {
+		return nil, err
+	}
+	member := &store.Member{UserID: user.ID, Name: user.Name, Email: user.Email, JoinedAt: now}
+	if _, err := s.store.AddMember(ctx, room, member); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Room %s (%s) created by %s", room.ID, room.Name, user.Name)
+	return s.details(ctx, room, []*store.Member{member})
+}
+
+// Get returns a room the user is a member of
+func (s *Service) Get(ctx context.Context, user *models.User, roomID string) (*Details, error) {
+	room, members, err := s.membership(ctx, user, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember(members, user.ID) {
+		return nil, ErrNotMember
+	}
+	return s.details(ctx, room, members)
+}
+
+// List returns the rooms the user has joined
+func (s *Service) List(ctx context.Context, user *models.User) ([]*store.Room, error) {
+	return s.store.UserRooms(ctx, user.ID)
+}
+
+// Join adds the user to a room of their tenant. The room's connected members get a
+// room-scoped user_joined event; joining a room again is a no-op.
+func (s *Service) Join(ctx context.Context, user *models.User, roomID string) (*Details, error) {
+	if s.tenants.IsReadOnly(user.TenantID) {
+		return nil, chat.ErrTenantReadOnly
+	}
+	room, _, err := s.membership(ctx, user, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	member := &store.Member{UserID: user.ID, Name: user.Name, Email: user.Email, JoinedAt: time.Now().UTC()}
+	added, err := s.store.AddMember(ctx, room, member)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.store.Members(ctx, room.ID)
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		log.Printf("%s joined room %s", user.Name, room.ID)
+		s.fanOut(members, "", events.NewRoomUserJoinedEvent(room.ID, user.ID, user.Name, user.Email))
+	}
+	return s.details(ctx, room, members)
+}
+
+// Leave removes the user from a room and tells the remaining connected members
+func (s *Service) Leave(ctx context.Context, user *models.User, roomID string) error {
+	room, _, err := s.membership(ctx, user, roomID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.store.RemoveMember(ctx, room.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotMember
+	}
+
+	log.Printf("%s left room %s", user.Name, room.ID)
+	members, err := s.store.Members(ctx, room.ID)
+	if err != nil {
+		return err
+	}
+	s.fanOut(members, "", events.NewRoomUserLeftEvent(room.ID, user.ID, user.Name, user.Email))
+	return nil
+}
+
+// SendMessage delivers a message from a member to the room's other connected members and
+// persists it. A non-empty parentID makes it a reply in the thread of an earlier message of
+// the room. Mentioned members also get a mention event. Message bytes count against the sender's and the room's storage quotas; a
+// *usage.QuotaError is returned when either is exhausted, and a *moderation.RejectedError when
+// moderation refuses the message.
+func (s *Service) SendMessage(ctx context.Context, sender *models.User, roomID string, message *models.MessageContent, parentID string) (*Delivery, error) {
+	if s.tenants.IsReadOnly(sender.TenantID) {
+		return nil, chat.ErrTenantReadOnly
+	}
+	room, members, err := s.membership(ctx, sender, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember(members, sender.ID) {
+		return nil, ErrNotMember
+	}
+	threadID, err := chat.ThreadRoot(ctx, s.store, store.RoomConversationID(room.ID), parentID)
+	if err != nil {
+		return nil, err
+	}
+	decision, err := chat.Moderate(ctx, s.moderator, sender, store.RoomConversationID(room.ID), message)
+	if err != nil {
+		return nil, err
+	}
+	message = decision.Message
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(encoded))
+	if err := s.usage.Reserve(ctx, sender.ID, room.ID, usage.KindMessages, size); err != nil {
+		return nil, err
+	}
+
+	s.manager.MarkActive(sender.ID)
+	event := events.InThread(events.NewRoomChatEvent(room.ID, sender.ID, sender.Name, sender.Email, message), threadID)
+	delivered := s.fanOut(members, sender.ID, event)
+
+	msg := &store.Message{
+		ID:             event.ID,
+		ConversationID: store.RoomConversationID(room.ID),
+		SenderID:       sender.ID,
+		SenderName:     sender.Name,
+		TenantID:       sender.TenantID,
+		ParentID:       threadID,
+		Message:        message,
+		Mentions:       chat.ResolveMentions(message, members),
+		CreatedAt:      event.Timestamp,
+	}
+	mention := events.InRoom(events.NewMentionEvent(msg.ID, sender.ID, sender.Name, message), room.ID)
+	chat.NotifyMentions(s.manager, msg, events.InThread(mention, threadID))
+	chat.Delivered(s.moderator, decision, msg.ID)
+
+	// As with direct messages, a storage failure after delivery is logged rather than reported
+	if err := s.store.SaveMessage(ctx, msg); err != nil {
+		log.Printf("⚠️  Failed to persist room message %s: %v", event.ID, err)
+	}
+
+	log.Printf("Message sent from %s to room %s (%d of %d members connected)", sender.Name, room.ID, delivered, len(members)-1)
+	return &Delivery{MessageID: event.ID, Delivered: delivered}, nil
+}
+
+// Typing tells the connected members of a room that the user started or stopped typing in it
+func (s *Service) Typing(ctx context.Context, user *models.User, roomID string, typing bool) error {
+	room, members, err := s.membership(ctx, user, roomID)
+	if err != nil {
+		return err
+	}
+	if !isMember(members, user.ID) {
+		return ErrNotMember
+	}
+	s.fanOut(members, user.ID, events.InRoom(events.NewTypingEvent(user.ID, user.Name, typing), room.ID))
+	return nil
+}
+
+// History returns up to limit messages of a room the user is a member of, sent before the
+// given time (zero for the latest), newest first
+func (s *Service) History(ctx context.Context, user *models.User, roomID string, before time.Time, limit int) ([]*store.Message, error) {
+	room, members, err := s.membership(ctx, user, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember(members, user.ID) {
+		return nil, ErrNotMember
+	}
+	return s.store.Messages(ctx, store.RoomConversationID(room.ID), before, limit)
+}
+
+// details returns a room with its members, storage usage and retention policy
+func (s *Service) details(ctx context.Context, room *store.Room, members []*store.Member) (*Details, error) {
+	roomUsage, err := s.usage.RoomUsage(ctx, room.ID)
+	if err != nil {
+		return nil, err
+	}
+	details := &Details{Room: room, Members: members, Usage: roomUsage}
+	if s.retention != nil {
+		policy := s.retention.Effective(room.TenantID, room.ID)
+		details.Retention = &policy
+	}
+	return details, nil
+}
+
+// membership loads a room visible to the user (one of their tenant) and its members
+func (s *Service) membership(ctx context.Context, user *models.User, roomID string) (*store.Room, []*store.Member, error) {
+	room, err := s.store.Room(ctx, roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if room.TenantID != user.TenantID {
+		return nil, nil, ErrRoomNotFound
+	}
+	members, err := s.store.Members(ctx, room.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return room, members, nil
+}
+
+// fanOut sends an event to the connected members other than except, returning how many
+// received it
+func (s *Service) fanOut(members []*store.Member, except string, event *events.Event) int {
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.UserID != except {
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+	return s.manager.SendEventToUsers(userIDs, event)
+}
+
+// isMember reports whether userID is among members
+func isMember(members []*store.Member, userID string) bool {
+	for _, member := range members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// newRoomID returns a random 64-bit hex room ID
+func newRoomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
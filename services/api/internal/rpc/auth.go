@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"api-service/internal/middleware"
+)
+
+// publicMethods don't require a token (probes can't send one)
+var publicMethods = map[string]bool{
+	"/grpc.health.v1.Health/Check": true,
+	"/grpc.health.v1.Health/Watch": true,
+}
+
+// authenticator validates the bearer token in the "authorization" metadata, the gRPC
+// counterpart of the HTTP auth middleware
+type authenticator struct {
+	auth *middleware.AuthMiddleware
+}
+
+// unary authenticates unary calls
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// stream authenticates streaming calls
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if publicMethods[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate returns ctx carrying the user identified by the call's bearer token
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	method, _ := grpc.Method(ctx)
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		a.auth.RecordFailure(method, remoteAddr, "missing_authorization", nil)
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		a.auth.RecordFailure(method, remoteAddr, "invalid_authorization_header", nil)
+		return nil, status.Error(codes.Unauthenticated, `authorization metadata must be of the form "Bearer <token>"`)
+	}
+
+	user, err := a.auth.ValidateToken(token)
+	if errors.Is(err, middleware.ErrUserBanned) {
+		a.auth.RecordFailure(method, remoteAddr, "user_banned", err)
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		log.Printf("gRPC token validation failed: %v", err)
+		a.auth.RecordFailure(method, remoteAddr, "", err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return middleware.ContextWithUser(ctx, user), nil
+}
+
+// authenticatedStream overrides the stream context with the authenticated one
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the authenticated context
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
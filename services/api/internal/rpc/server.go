@@ -0,0 +1,170 @@
+// Package rpc serves the chat API over gRPC for internal services.
+//
+// The service is defined in proto/chat/v1/chat.proto; after changing it, regenerate chatv1 from
+// the services/api directory with:
+//
+//	protoc -I proto --go_out=. --go_opt=module=api-service --go-grpc_out=. --go-grpc_opt=module=api-service chat/v1/chat.proto
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"api-service/internal/chat"
+	"api-service/internal/middleware"
+	"api-service/internal/models"
+	"api-service/internal/moderation"
+	"api-service/internal/rpc/chatv1"
+	"api-service/internal/usage"
+	"api-service/internal/validate"
+)
+
+// NewServer creates a gRPC server exposing the chat service and the standard health service.
+// tlsConfig may be nil to serve plaintext (e.g. behind an ingress terminating TLS).
+func NewServer(auth *middleware.AuthMiddleware, chatService *chat.Service, tlsConfig *tls.Config) *grpc.Server {
+	authenticator := &authenticator{auth: auth}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(authenticator.unary),
+		grpc.ChainStreamInterceptor(authenticator.stream),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(opts...)
+	chatv1.RegisterChatServiceServer(server, &chatServer{chat: chatService})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	return server
+}
+
+// chatServer implements chatv1.ChatServiceServer on top of the chat service
+type chatServer struct {
+	chatv1.UnimplementedChatServiceServer
+	chat *chat.Service
+}
+
+// sendMessageInput applies the HTTP API's validation rules to gRPC requests
+type sendMessageInput struct {
+	To              string `json:"to" validate:"trim,required,pattern=id"`
+	Text            string `json:"text" validate:"trim,required"`
+	ParentMessageID string `json:"parent_message_id" validate:"trim,pattern=id"`
+}
+
+// Validate enforces the message length limit
+func (in *sendMessageInput) Validate(errs *validate.Errors) {
+	if len([]rune(in.Text)) > models.MaxMessageTextLength {
+		errs.Add("text", "is too long")
+	}
+}
+
+// SendMessage delivers a message to a connected user
+func (s *chatServer) SendMessage(ctx context.Context, req *chatv1.SendMessageRequest) (*chatv1.SendMessageResponse, error) {
+	sender, _ := middleware.GetUserFromContext(ctx)
+
+	in := sendMessageInput{To: req.GetTo(), Text: req.GetText(), ParentMessageID: req.GetParentMessageId()}
+	if err := validate.Struct(&in); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	messageID, err := s.chat.SendMessage(ctx, sender, in.To, models.NewMessageContent(in.Text), in.ParentMessageID)
+	switch {
+	case errors.Is(err, usage.ErrQuotaExceeded):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, chat.ErrTenantReadOnly), errors.Is(err, chat.ErrBlocked):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.As(err, new(*moderation.RejectedError)):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, chat.ErrRecipientUnavailable), errors.Is(err, chat.ErrParentNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &chatv1.SendMessageResponse{MessageId: messageID}, nil
+}
+
+// AckMessage acknowledges receipt of a message by the caller
+func (s *chatServer) AckMessage(ctx context.Context, req *chatv1.AckMessageRequest) (*chatv1.AckMessageResponse, error) {
+	user, _ := middleware.GetUserFromContext(ctx)
+
+	if err := s.chat.Ack(user, req.GetMessageId()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &chatv1.AckMessageResponse{}, nil
+}
+
+// GetActiveUsers lists the currently connected users
+func (s *chatServer) GetActiveUsers(ctx context.Context, req *chatv1.GetActiveUsersRequest) (*chatv1.GetActiveUsersResponse, error) {
+	users := s.chat.ActiveUsers()
+
+	resp := &chatv1.GetActiveUsersResponse{Count: int32(len(users))}
+	for _, user := range users {
+		resp.Users = append(resp.Users, &chatv1.User{Id: user["id"], Name: user["name"], Email: user["email"]})
+	}
+	return resp, nil
+}
+
+// Events streams the caller's realtime events until the client cancels or the subscription ends
+func (s *chatServer) Events(req *chatv1.EventsRequest, stream chatv1.ChatService_EventsServer) error {
+	user, _ := middleware.GetUserFromContext(stream.Context())
+
+	events, unsubscribe := s.chat.Subscribe(user)
+	defer unsubscribe()
+	log.Printf("gRPC event stream opened for %s (%s)", user.Name, user.ID)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			log.Printf("gRPC event stream closed by %s (%s)", user.Name, user.ID)
+			return nil
+		case encoded, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "event stream ended")
+			}
+			event, err := toProtoEvent(encoded)
+			if err != nil {
+				log.Printf("Failed to convert event for gRPC stream: %v", err)
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toProtoEvent converts a v2-encoded event envelope to its protobuf form
+func toProtoEvent(encoded []byte) (*chatv1.Event, error) {
+	var envelope struct {
+		ID        string                 `json:"id"`
+		Type      string                 `json:"type"`
+		Timestamp time.Time              `json:"timestamp"`
+		Payload   map[string]interface{} `json:"payload"`
+	}
+	if err := json.Unmarshal(encoded, &envelope); err != nil {
+		return nil, err
+	}
+
+	payload, err := structpb.NewStruct(envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return &chatv1.Event{
+		Id:        envelope.ID,
+		Type:      envelope.Type,
+		Timestamp: timestamppb.New(envelope.Timestamp),
+		Payload:   payload,
+	}, nil
+}
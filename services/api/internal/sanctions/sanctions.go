@@ -0,0 +1,169 @@
+// Package sanctions lets admins kick users off their connections and ban them from
+// authenticating for a while
+package sanctions
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/events"
+	"api-service/internal/models"
+)
+
+// WebSocket close codes sent to sanctioned users (application range; mirror HTTP 401 and 403)
+const (
+	CloseKicked = 4401 // The client may reconnect
+	CloseBanned = 4403 // The client can't reconnect until the ban expires
+)
+
+// MaxBan bounds the duration of a ban
+const MaxBan = 365 * 24 * time.Hour
+
+// Ban keeps a user from authenticating until it expires
+type Ban struct {
+	UserID    string    `json:"userId"`
+	Reason    string    `json:"reason,omitempty"`
+	BannedBy  string    `json:"bannedBy"`
+	BannedAt  time.Time `json:"bannedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Service kicks and bans users. Bans are held in memory by each replica and connections are
+// closed on the replica handling the request.
+type Service struct {
+	manager *events.Manager
+	audit   audit.Log
+
+	mu   sync.Mutex
+	bans map[string]*Ban // User ID -> ban
+}
+
+// NewService creates a sanctions service closing connections through manager
+func NewService(manager *events.Manager, auditLog audit.Log) *Service {
+	return &Service{
+		manager: manager,
+		audit:   auditLog,
+		bans:    make(map[string]*Ban),
+	}
+}
+
+// Kick sends the user a kicked event and closes their connections, returning how many were
+// closed. They may reconnect right away.
+func (s *Service) Kick(admin *models.User, userID, reason string) int {
+	closed := s.disconnect(userID, events.NewKickedEvent(reason), CloseKicked, "kicked by an admin")
+	s.record(admin, "user.kick", userID, map[string]interface{}{"reason": reason, "connections": closed})
+	log.Printf("👢 User %s kicked by %s (%s), %d connections closed", userID, admin.Email, admin.ID, closed)
+	return closed
+}
+
+// Ban keeps the user from authenticating for the given duration, replacing an earlier ban,
+// and closes their connections after sending them a banned event
+func (s *Service) Ban(admin *models.User, userID string, duration time.Duration, reason string) (*Ban, error) {
+	if duration <= 0 || duration > MaxBan {
+		return nil, fmt.Errorf("duration must be positive and at most %s", MaxBan)
+	}
+
+	now := time.Now().UTC()
+	ban := &Ban{
+		UserID:    userID,
+		Reason:    reason,
+		BannedBy:  admin.ID,
+		BannedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+	s.mu.Lock()
+	s.bans[userID] = ban
+	s.mu.Unlock()
+
+	closed := s.disconnect(userID, events.NewBannedEvent(reason, ban.ExpiresAt), CloseBanned, "banned until "+ban.ExpiresAt.Format(time.RFC3339))
+	s.record(admin, "user.ban", userID, map[string]interface{}{"reason": reason, "expiresAt": ban.ExpiresAt, "connections": closed})
+	log.Printf("🚫 User %s banned until %s by %s (%s)", userID, ban.ExpiresAt.Format(time.RFC3339), admin.Email, admin.ID)
+
+	result := *ban
+	return &result, nil
+}
+
+// Unban lifts a user's ban, reporting whether they were banned
+func (s *Service) Unban(admin *models.User, userID string) bool {
+	_, banned := s.Banned(userID)
+	s.mu.Lock()
+	delete(s.bans, userID)
+	s.mu.Unlock()
+
+	if banned {
+		s.record(admin, "user.unban", userID, nil)
+		log.Printf("User %s unbanned by %s (%s)", userID, admin.Email, admin.ID)
+	}
+	return banned
+}
+
+// Banned returns the user's ban when one is in force
+func (s *Service) Banned(userID string) (*Ban, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban, ok := s.bans[userID]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(ban.ExpiresAt) {
+		delete(s.bans, userID)
+		return nil, false
+	}
+	result := *ban
+	return &result, true
+}
+
+// BannedUntil reports when a user's ban expires, for the auth middleware
+func (s *Service) BannedUntil(userID string) (time.Time, bool) {
+	ban, ok := s.Banned(userID)
+	if !ok {
+		return time.Time{}, false
+	}
+	return ban.ExpiresAt, true
+}
+
+// List returns the bans in force, soonest to expire first
+func (s *Service) List() []Ban {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bans := []Ban{}
+	for userID, ban := range s.bans {
+		if !now.Before(ban.ExpiresAt) {
+			delete(s.bans, userID)
+			continue
+		}
+		bans = append(bans, *ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ExpiresAt.Before(bans[j].ExpiresAt) })
+	return bans
+}
+
+// disconnect sends the user an event and closes their connection once it has been sent
+func (s *Service) disconnect(userID string, event *events.Event, code int, reason string) int {
+	client, ok := s.manager.Client(userID)
+	if !ok {
+		return 0
+	}
+	s.manager.SendEventToUser(userID, event)
+	s.manager.CloseClient(client, code, reason)
+	return 1
+}
+
+// record audits a sanction
+func (s *Service) record(admin *models.User, action, userID string, details map[string]interface{}) {
+	s.audit.Record(audit.Record{
+		Action:   action,
+		Actor:    admin.ID,
+		TenantID: admin.TenantID,
+		Target:   userID,
+		Outcome:  "success",
+		Details:  details,
+	})
+}
@@ -0,0 +1,340 @@
+// Package search indexes persisted chat messages into Azure AI Search and runs full-text
+// queries against them, restricted to the conversations the caller takes part in
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/identity"
+	"api-service/internal/store"
+)
+
+// searchResource is the token audience for Azure AI Search
+const searchResource = "https://search.azure.com"
+
+// apiVersion is the Azure AI Search REST API version used
+const apiVersion = "2024-07-01"
+
+const (
+	queueSize   = 4096 // Index actions waiting to be sent; more are dropped
+	maxBatch    = 500  // Index actions per request (at most 1000)
+	maxAttempts = 3    // Send attempts before a batch is dropped
+)
+
+// Config configures the index
+type Config struct {
+	Endpoint string // Search service name, host name or endpoint URL
+	Index    string // Index name; created or updated at startup
+	APIKey   string // Admin key; the managed identity is used when empty
+}
+
+// Stats reports indexing metrics
+type Stats struct {
+	Queued   int   `json:"queued"`
+	Indexed  int64 `json:"indexed"`
+	Dropped  int64 `json:"dropped"` // Queue overflow or batches that exhausted their retries
+	Failures int64 `json:"failures"`
+}
+
+// document is a message as indexed. Participants is set for direct messages only; room
+// messages are matched by conversation instead, so leaving a room hides its messages.
+type document struct {
+	Action          string    `json:"@search.action"`
+	ID              string    `json:"id"`
+	TenantID        string    `json:"tenantId"`
+	ConversationID  string    `json:"conversationId"`
+	Participants    []string  `json:"participants"`
+	SenderID        string    `json:"senderId"`
+	SenderName      string    `json:"senderName"`
+	Text            string    `json:"text"`
+	ParentMessageID string    `json:"parentMessageId"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// deletion removes a message from the index
+type deletion struct {
+	Action string `json:"@search.action"`
+	ID     string `json:"id"`
+}
+
+// field is a field of the index definition
+type field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Key         bool   `json:"key,omitempty"`
+	Searchable  bool   `json:"searchable"`
+	Filterable  bool   `json:"filterable"`
+	Sortable    bool   `json:"sortable"`
+	Facetable   bool   `json:"facetable"`
+	Retrievable bool   `json:"retrievable"`
+	Analyzer    string `json:"analyzer,omitempty"`
+}
+
+// fields defines the index
+var fields = []field{
+	{Name: "id", Type: "Edm.String", Key: true, Filterable: true, Retrievable: true},
+	{Name: "tenantId", Type: "Edm.String", Filterable: true, Retrievable: true},
+	{Name: "conversationId", Type: "Edm.String", Filterable: true, Retrievable: true},
+	{Name: "participants", Type: "Collection(Edm.String)", Filterable: true, Retrievable: true},
+	{Name: "senderId", Type: "Edm.String", Filterable: true, Retrievable: true},
+	{Name: "senderName", Type: "Edm.String", Searchable: true, Retrievable: true, Analyzer: "standard.lucene"},
+	{Name: "text", Type: "Edm.String", Searchable: true, Retrievable: true, Analyzer: "standard.lucene"},
+	{Name: "parentMessageId", Type: "Edm.String", Filterable: true, Retrievable: true},
+	{Name: "createdAt", Type: "Edm.DateTimeOffset", Filterable: true, Sortable: true, Retrievable: true},
+}
+
+// Index sends messages to an Azure AI Search index in the background and queries it
+type Index struct {
+	cfg      Config
+	endpoint string
+	identity *identity.ManagedIdentity
+	client   *http.Client
+	queue    chan interface{} // *document or *deletion
+
+	indexed  atomic.Int64
+	dropped  atomic.Int64
+	failures atomic.Int64
+}
+
+// NewIndex creates an index client; mi is used when cfg has no API key
+func NewIndex(cfg Config, mi *identity.ManagedIdentity) (*Index, error) {
+	endpoint := cfg.Endpoint
+	switch {
+	case strings.Contains(endpoint, "://"):
+	case strings.Contains(endpoint, "."):
+		endpoint = "https://" + endpoint
+	default:
+		endpoint = "https://" + endpoint + ".search.windows.net"
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid search endpoint %q: %w", cfg.Endpoint, err)
+	}
+	if cfg.APIKey == "" && mi == nil {
+		return nil, fmt.Errorf("a search API key or managed identity is required")
+	}
+
+	return &Index{
+		cfg:      cfg,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		identity: mi,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		queue:    make(chan interface{}, queueSize),
+	}, nil
+}
+
+// EnsureIndex creates the index, or adds fields missing from an existing one
+func (x *Index) EnsureIndex(ctx context.Context) error {
+	body := map[string]interface{}{"name": x.cfg.Index, "fields": fields}
+	resp, err := x.do(ctx, http.MethodPut, "/indexes/"+url.PathEscape(x.cfg.Index), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return responseError("create index", resp)
+	}
+	return nil
+}
+
+// Upload queues a message to be indexed, replacing an earlier version. Deleted messages are
+// removed instead. It never blocks.
+func (x *Index) Upload(msg *store.Message) {
+	if msg.DeletedAt != nil || msg.Message == nil {
+		x.Delete(msg.ID)
+		return
+	}
+	doc := &document{
+		Action:          "mergeOrUpload",
+		ID:              msg.ID,
+		TenantID:        msg.TenantID,
+		ConversationID:  msg.ConversationID,
+		Participants:    []string{},
+		SenderID:        msg.SenderID,
+		SenderName:      msg.SenderName,
+		Text:            msg.Message.Text,
+		ParentMessageID: msg.ParentID,
+		CreatedAt:       msg.CreatedAt,
+	}
+	if msg.RecipientID != "" {
+		doc.Participants = []string{msg.SenderID, msg.RecipientID}
+	}
+	x.enqueue(doc)
+}
+
+// Delete queues a message to be removed from the index. It never blocks.
+func (x *Index) Delete(messageID string) {
+	x.enqueue(&deletion{Action: "delete", ID: messageID})
+}
+
+// enqueue queues an index action, dropping it when the queue is full
+func (x *Index) enqueue(action interface{}) {
+	select {
+	case x.queue <- action:
+	default:
+		x.dropped.Add(1)
+	}
+}
+
+// Run sends queued index actions in batches until ctx is cancelled
+func (x *Index) Run(ctx context.Context) {
+	for {
+		var batch []interface{}
+		select {
+		case <-ctx.Done():
+			return
+		case action := <-x.queue:
+			batch = append(batch, action)
+		}
+	collect:
+		for len(batch) < maxBatch {
+			select {
+			case action := <-x.queue:
+				batch = append(batch, action)
+			default:
+				break collect
+			}
+		}
+
+		for attempt := 1; ; attempt++ {
+			err := x.send(ctx, batch)
+			if err == nil {
+				x.indexed.Add(int64(len(batch)))
+				break
+			}
+			x.failures.Add(1)
+			if attempt == maxAttempts || ctx.Err() != nil {
+				x.dropped.Add(int64(len(batch)))
+				log.Printf("⚠️  Search indexing failed, dropped %d messages: %v", len(batch), err)
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+	}
+}
+
+// send posts a batch of index actions. Deleting a message that isn't indexed succeeds, so
+// only 207 Multi-Status responses with failed actions other than those are errors.
+func (x *Index) send(ctx context.Context, batch []interface{}) error {
+	resp, err := x.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(x.cfg.Index)+"/docs/index", map[string]interface{}{"value": batch})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusMultiStatus:
+		var result struct {
+			Value []struct {
+				Key          string `json:"key"`
+				Status       bool   `json:"status"`
+				ErrorMessage string `json:"errorMessage"`
+			} `json:"value"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("decoding index response: %w", err)
+		}
+		for _, item := range result.Value {
+			if !item.Status {
+				return fmt.Errorf("indexing message %s failed: %s", item.Key, item.ErrorMessage)
+			}
+		}
+		return nil
+	default:
+		return responseError("index", resp)
+	}
+}
+
+// query is a search request
+type query struct {
+	Search           string `json:"search"`
+	SearchFields     string `json:"searchFields"`
+	SearchMode       string `json:"searchMode"`
+	Filter           string `json:"filter,omitempty"`
+	Highlight        string `json:"highlight"`
+	HighlightPreTag  string `json:"highlightPreTag"`
+	HighlightPostTag string `json:"highlightPostTag"`
+	Select           string `json:"select"`
+	Count            bool   `json:"count"`
+	Top              int    `json:"top"`
+	Skip             int    `json:"skip"`
+}
+
+// result is a search response
+type result struct {
+	Count int64 `json:"@odata.count"`
+	Value []struct {
+		document
+		Score      float64             `json:"@search.score"`
+		Highlights map[string][]string `json:"@search.highlights"`
+	} `json:"value"`
+}
+
+// search runs a query
+func (x *Index) search(ctx context.Context, q *query) (*result, error) {
+	resp, err := x.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(x.cfg.Index)+"/docs/search", q)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("search", resp)
+	}
+	var res result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decoding search response: %w", err)
+	}
+	return &res, nil
+}
+
+// do sends an authenticated request with a JSON body
+func (x *Index) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, x.endpoint+path+"?api-version="+apiVersion, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if x.cfg.APIKey != "" {
+		req.Header.Set("api-key", x.cfg.APIKey)
+	} else {
+		token, err := x.identity.Token(ctx, searchResource)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return x.client.Do(req)
+}
+
+// Stats returns indexing metrics
+func (x *Index) Stats() Stats {
+	return Stats{
+		Queued:   len(x.queue),
+		Indexed:  x.indexed.Load(),
+		Dropped:  x.dropped.Load(),
+		Failures: x.failures.Load(),
+	}
+}
+
+// responseError describes a failed request
+func responseError(operation string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("search %s returned status %d: %s", operation, resp.StatusCode, strings.TrimSpace(string(detail)))
+}
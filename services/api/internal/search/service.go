@@ -0,0 +1,140 @@
+package search
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// DefaultPageSize and MaxPageSize bound the hits returned by one search
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 50
+)
+
+// MaxOffset is the largest offset Azure AI Search can skip to
+const MaxOffset = 100_000
+
+// Highlight markers requested from the service: private-use characters rather than tags, so
+// fragments can be HTML-escaped before the markers are turned into <mark> tags
+const (
+	highlightStart = "\uE000"
+	highlightEnd   = "\uE001"
+)
+
+// Hit is a message matching a search
+type Hit struct {
+	MessageID       string    `json:"messageId"`
+	ConversationID  string    `json:"conversationId"`
+	PeerID          string    `json:"peerId,omitempty"` // The other user of a direct conversation
+	RoomID          string    `json:"roomId,omitempty"`
+	SenderID        string    `json:"senderId"`
+	SenderName      string    `json:"senderName"`
+	Text            string    `json:"text"`
+	ParentMessageID string    `json:"parentMessageId,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	Highlights      []string  `json:"highlights"` // HTML fragments of the text with matches in <mark> tags
+	Score           float64   `json:"score"`
+}
+
+// Results is a page of search hits, best matches first
+type Results struct {
+	Hits       []*Hit `json:"hits"`
+	Count      int    `json:"count"`                // Hits on this page
+	Total      int64  `json:"total"`                // Hits on all pages
+	NextOffset int    `json:"nextOffset,omitempty"` // Pass as ?offset= for the next page; omitted on the last page
+}
+
+// Service searches the messages of the conversations a user takes part in
+type Service struct {
+	index *Index
+	store store.Store
+}
+
+// NewService creates a search service; rooms are looked up in messages
+func NewService(index *Index, messages store.Store) *Service {
+	return &Service{index: index, store: messages}
+}
+
+// Search returns up to limit messages matching text, skipping the first offset, from the
+// user's direct conversations and the rooms they're currently a member of. A non-empty peer
+// restricts it to the direct conversation with that user.
+func (s *Service) Search(ctx context.Context, user *models.User, text, peer string, limit, offset int) (*Results, error) {
+	var filter string
+	if peer != "" {
+		filter = "conversationId eq " + literal(store.ConversationID(user.ID, peer))
+	} else {
+		rooms, err := s.store.UserRooms(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		filter = "participants/any(p: p eq " + literal(user.ID) + ")"
+		if len(rooms) > 0 {
+			ids := make([]string, len(rooms))
+			for i, room := range rooms {
+				ids[i] = store.RoomConversationID(room.ID)
+			}
+			filter += " or search.in(conversationId, " + literal(strings.Join(ids, "|")) + ", '|')"
+		}
+	}
+
+	res, err := s.index.search(ctx, &query{
+		Search:           text,
+		SearchFields:     "text,senderName",
+		SearchMode:       "all",
+		Filter:           filter,
+		Highlight:        "text",
+		HighlightPreTag:  highlightStart,
+		HighlightPostTag: highlightEnd,
+		Select:           "id,conversationId,participants,senderId,senderName,text,parentMessageId,createdAt",
+		Count:            true,
+		Top:              limit,
+		Skip:             offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := &Results{Hits: make([]*Hit, 0, len(res.Value)), Total: res.Count}
+	for _, value := range res.Value {
+		hit := &Hit{
+			MessageID:       value.ID,
+			ConversationID:  value.ConversationID,
+			SenderID:        value.SenderID,
+			SenderName:      value.SenderName,
+			Text:            value.Text,
+			ParentMessageID: value.ParentMessageID,
+			CreatedAt:       value.CreatedAt.UTC(),
+			Highlights:      make([]string, 0, len(value.Highlights["text"])),
+			Score:           value.Score,
+		}
+		if roomID, ok := strings.CutPrefix(value.ConversationID, store.RoomConversationID("")); ok {
+			hit.RoomID = roomID
+		}
+		for _, participant := range value.Participants {
+			if participant != user.ID || hit.PeerID == "" { // Messages to oneself have only the user
+				hit.PeerID = participant
+			}
+		}
+		for _, fragment := range value.Highlights["text"] {
+			fragment = html.EscapeString(fragment)
+			fragment = strings.ReplaceAll(fragment, highlightStart, "<mark>")
+			hit.Highlights = append(hit.Highlights, strings.ReplaceAll(fragment, highlightEnd, "</mark>"))
+		}
+		results.Hits = append(results.Hits, hit)
+	}
+	results.Count = len(results.Hits)
+	if next := offset + len(results.Hits); int64(next) < res.Count && len(results.Hits) == limit && next <= MaxOffset {
+		results.NextOffset = next
+	}
+	return results, nil
+}
+
+// literal quotes a string as an OData string literal
+func literal(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
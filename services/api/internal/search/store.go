@@ -0,0 +1,63 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+// IndexedStore is a message store that keeps an index up to date with the messages it
+// persists: saved and edited messages are (re)indexed, deleted and purged ones removed.
+// Indexing happens in the background after the store succeeds, so search results may lag by
+// a few seconds.
+type IndexedStore struct {
+	store.Store
+	index *Index
+}
+
+// NewIndexedStore wraps a message store to index its messages
+func NewIndexedStore(messages store.Store, index *Index) *IndexedStore {
+	return &IndexedStore{Store: messages, index: index}
+}
+
+// SaveMessage persists a message and indexes it
+func (s *IndexedStore) SaveMessage(ctx context.Context, msg *store.Message) error {
+	if err := s.Store.SaveMessage(ctx, msg); err != nil {
+		return err
+	}
+	s.index.Upload(msg)
+	return nil
+}
+
+// EditMessage replaces a message's content and reindexes it
+func (s *IndexedStore) EditMessage(ctx context.Context, msg *store.Message, content *models.MessageContent, editedBy string, at time.Time) (*store.Message, error) {
+	updated, err := s.Store.EditMessage(ctx, msg, content, editedBy, at)
+	if err != nil {
+		return nil, err
+	}
+	s.index.Upload(updated)
+	return updated, nil
+}
+
+// DeleteMessage replaces a message with a tombstone and removes it from the index
+func (s *IndexedStore) DeleteMessage(ctx context.Context, msg *store.Message, deletedBy string, at time.Time) (*store.Message, error) {
+	deleted, err := s.Store.DeleteMessage(ctx, msg, deletedBy, at)
+	if err != nil {
+		return nil, err
+	}
+	s.index.Delete(deleted.ID)
+	return deleted, nil
+}
+
+// PurgeMessages removes messages for good and removes them from the index
+func (s *IndexedStore) PurgeMessages(ctx context.Context, msgs []*store.Message) error {
+	if err := s.Store.PurgeMessages(ctx, msgs); err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		s.index.Delete(msg.ID)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// tenantPurgeWait bounds how long PurgeTenant waits for deletions to show in the results,
+// as the index is eventually consistent
+const tenantPurgeWait = 10 * time.Second
+
+// tenantPage is the most documents looked up (and deleted) at once; a batch holds at most 1000
+// actions
+const tenantPage = 1000
+
+// tenantDocuments returns the IDs of up to top of the tenant's indexed messages, and how many
+// there are
+func (x *Index) tenantDocuments(ctx context.Context, tenantID string, top int) ([]string, int, error) {
+	resp, err := x.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(x.cfg.Index)+"/docs/search", map[string]interface{}{
+		"search": "*",
+		"filter": "tenantId eq " + literal(tenantID),
+		"select": "id",
+		"count":  true,
+		"top":    top,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, responseError("search", resp)
+	}
+	var res struct {
+		Count int `json:"@odata.count"`
+		Value []struct {
+			ID string `json:"id"`
+		} `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, 0, fmt.Errorf("decoding search response: %w", err)
+	}
+	ids := make([]string, len(res.Value))
+	for i, doc := range res.Value {
+		ids[i] = doc.ID
+	}
+	return ids, res.Count, nil
+}
+
+// PurgeTenant deletes the tenant's messages from the index and returns how many were deleted.
+// It looks them up until none are left, giving up once deletions stop showing for
+// tenantPurgeWait; CountTenant then reports those still found.
+func (x *Index) PurgeTenant(ctx context.Context, tenantID string) (int, error) {
+	deleted := make(map[string]bool)
+	deadline := time.Now().Add(tenantPurgeWait)
+	for {
+		ids, _, err := x.tenantDocuments(ctx, tenantID, tenantPage)
+		if err != nil || len(ids) == 0 {
+			return len(deleted), err
+		}
+
+		var batch []interface{}
+		for _, id := range ids {
+			if !deleted[id] {
+				deleted[id] = true
+				batch = append(batch, deletion{Action: "delete", ID: id})
+			}
+		}
+		if len(batch) > 0 {
+			if err := x.send(ctx, batch); err != nil {
+				return len(deleted) - len(batch), err
+			}
+			deadline = time.Now().Add(tenantPurgeWait)
+		} else if time.Now().After(deadline) {
+			return len(deleted), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return len(deleted), ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// CountTenant counts the tenant's indexed messages
+func (x *Index) CountTenant(ctx context.Context, tenantID string) (int, error) {
+	_, count, err := x.tenantDocuments(ctx, tenantID, 0)
+	return count, err
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// MaxAttachments bounds the files attached to one message
+const MaxAttachments = 10
+
+var (
+	// ErrTooManyAttachments is returned when attaching a file to a message that has MaxAttachments
+	ErrTooManyAttachments = errors.New("message has too many attachments")
+	// ErrAttachmentNotFound is returned when a message has no attachment with an ID
+	ErrAttachmentNotFound = errors.New("attachment not found")
+)
+
+// Attachment is a file uploaded to Blob Storage and attached to a message. The blob itself
+// is named after the message's tenant, sender and the attachment ID.
+type Attachment struct {
+	ID          string       `json:"id"`
+	FileName    string       `json:"fileName"`
+	ContentType string       `json:"contentType"`
+	Size        int64        `json:"size"`                 // In bytes
+	Thumbnails  []*Thumbnail `json:"thumbnails,omitempty"` // Generated for images after they're attached, smallest first
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+// Thumbnail is a downscaled JPEG copy of an image attachment
+type Thumbnail struct {
+	Size   int    `json:"size"` // The longest edge it was scaled to fit
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// AttachmentStore persists the files attached to messages
+type AttachmentStore interface {
+	// AddAttachment attaches a file to msg and returns the updated message, reporting false if
+	// an attachment with its ID was already attached (ErrMessageDeleted for deleted messages,
+	// ErrTooManyAttachments when the message has MaxAttachments)
+	AddAttachment(ctx context.Context, msg *Message, attachment *Attachment) (*Message, bool, error)
+	// SetThumbnails records the thumbnails generated for an attachment of msg and returns the
+	// updated message (ErrAttachmentNotFound if it has no such attachment)
+	SetThumbnails(ctx context.Context, msg *Message, attachmentID string, thumbnails []*Thumbnail) (*Message, error)
+}
+
+// attach adds attachment to msg, which must be a copy the caller owns, reporting false if it
+// was already attached
+func attach(msg *Message, attachment *Attachment) (bool, error) {
+	if msg.DeletedAt != nil {
+		return false, ErrMessageDeleted
+	}
+	for _, existing := range msg.Attachments {
+		if existing.ID == attachment.ID {
+			return false, nil
+		}
+	}
+	if len(msg.Attachments) >= MaxAttachments {
+		return false, ErrTooManyAttachments
+	}
+	msg.Attachments = append(append([]*Attachment(nil), msg.Attachments...), attachment)
+	return true, nil
+}
+
+// withThumbnails sets the thumbnails of an attachment of msg, which must be a copy the caller owns
+func withThumbnails(msg *Message, attachmentID string, thumbnails []*Thumbnail) error {
+	if msg.DeletedAt != nil {
+		return ErrMessageDeleted
+	}
+	for i, attachment := range msg.Attachments {
+		if attachment.ID == attachmentID {
+			updated := *attachment
+			updated.Thumbnails = thumbnails
+			msg.Attachments = append([]*Attachment(nil), msg.Attachments...)
+			msg.Attachments[i] = &updated
+			return nil
+		}
+	}
+	return ErrAttachmentNotFound
+}
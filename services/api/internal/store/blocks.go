@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrBlockNotFound is returned when a user hasn't blocked or muted another
+var ErrBlockNotFound = errors.New("user is not blocked")
+
+// BlockKind says how a user is kept out of another's way
+type BlockKind string
+
+const (
+	// BlockKindBlock withholds the blocked user's events and refuses their direct messages
+	BlockKindBlock BlockKind = "block"
+	// BlockKindMute only withholds the muted user's events; their direct messages are still
+	// accepted and kept in the conversation's history
+	BlockKindMute BlockKind = "mute"
+)
+
+// Block is an entry of a user's block list
+type Block struct {
+	UserID    string    `json:"-"`             // The user who blocked
+	TenantID  string    `json:"-"`             // Their tenant
+	BlockedID string    `json:"blockedUserId"` // The user they blocked
+	Kind      BlockKind `json:"kind"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BlockStore persists each user's block list
+type BlockStore interface {
+	// SaveBlock adds an entry to the block list of block.UserID. An earlier entry for the
+	// same user is replaced when its kind differs and kept otherwise.
+	SaveBlock(ctx context.Context, block *Block) error
+	// DeleteBlock removes blockedID from the user's block list, reporting false if it
+	// wasn't there
+	DeleteBlock(ctx context.Context, userID, blockedID string) (bool, error)
+	// Block returns the user's entry for blockedID, or ErrBlockNotFound
+	Block(ctx context.Context, userID, blockedID string) (*Block, error)
+	// Blocks returns the user's block list, oldest first
+	Blocks(ctx context.Context, userID string) ([]*Block, error)
+}
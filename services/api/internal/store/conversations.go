@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// ConversationStore finds a user's direct conversations and tracks how far they've read
+// each conversation
+type ConversationStore interface {
+	// DirectConversations returns the IDs of the direct conversations the user sent or
+	// received messages in
+	DirectConversations(ctx context.Context, userID string) ([]string, error)
+	// CountUnread counts a conversation's messages outside threads, not deleted, sent by
+	// users other than userID after the given time
+	CountUnread(ctx context.Context, conversationID, userID string, after time.Time) (int, error)
+	// MarkRead moves the user's read marker for a conversation forward to at; a marker
+	// that's already later is kept. The marker belongs to the user's tenant.
+	MarkRead(ctx context.Context, userID, tenantID, conversationID string, at time.Time) error
+	// ReadMarkers returns the user's read markers by conversation ID
+	ReadMarkers(ctx context.Context, userID string) (map[string]time.Time, error)
+}
@@ -0,0 +1,1594 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-service/internal/identity"
+	"api-service/internal/models"
+)
+
+// cosmosResource is the token audience for Cosmos DB data plane access
+const cosmosResource = "https://cosmos.azure.com"
+
+// cosmosAPIVersion is the Cosmos DB REST API version used
+const cosmosAPIVersion = "2018-12-31"
+
+// Cosmos DB Emulator defaults (https://learn.microsoft.com/azure/cosmos-db/emulator)
+const (
+	EmulatorEndpoint = "https://localhost:8081"
+	EmulatorKey      = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw=="
+)
+
+// CosmosConfig configures the Cosmos DB store
+type CosmosConfig struct {
+	Endpoint       string // Account endpoint, e.g. https://<account>.documents.azure.com
+	Database       string
+	Container      string // Messages, partitioned on /conversationId
+	RoomsContainer string // Rooms and their members, partitioned on /roomId
+	ReadsContainer string // Read markers and block lists, partitioned on /userId
+	Key            string // Account key; the managed identity is used when empty
+	Emulator       bool   // Default the endpoint and key to the emulator's and trust its self-signed certificate
+}
+
+// Cosmos persists messages in a Cosmos DB container partitioned by conversation, rooms in a
+// second container partitioned by room, and read markers and block lists in a third
+// partitioned by user, using the REST API. With an account key (e.g. the emulator) the
+// database and containers are created if missing; with a managed identity they must already
+// exist, because data plane role assignments can't create them.
+type Cosmos struct {
+	cfg      CosmosConfig
+	key      []byte
+	identity *identity.ManagedIdentity
+	client   *http.Client
+}
+
+// cosmosDocument is a message as stored in Cosmos DB
+type cosmosDocument struct {
+	*Message
+	Timestamp int64 `json:"ts"` // CreatedAt in Unix microseconds, for ordering (exact as a JSON number)
+}
+
+// cosmosRoomDocument is a room, or one of its members, as stored in Cosmos DB. A member
+// document repeats the room's details so a user's rooms can be listed with one query.
+type cosmosRoomDocument struct {
+	ID     string  `json:"id"` // The room ID, or "member:<userId>"
+	RoomID string  `json:"roomId"`
+	Type   string  `json:"type"` // "room" or "member"
+	Room   *Room   `json:"room"`
+	Member *Member `json:"member,omitempty"`
+}
+
+// NewCosmos connects to the containers, creating them first when an account key is configured
+func NewCosmos(ctx context.Context, cfg CosmosConfig, mi *identity.ManagedIdentity) (*Cosmos, error) {
+	if cfg.Emulator {
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = EmulatorEndpoint
+		}
+		if cfg.Key == "" {
+			cfg.Key = EmulatorKey
+		}
+	}
+
+	c := &Cosmos{
+		cfg:      cfg,
+		identity: mi,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	c.cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.Emulator {
+		c.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	if cfg.Key != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Cosmos DB key: %w", err)
+		}
+		c.key = key
+		if err := c.provision(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// provision creates the database and container if they don't exist
+func (c *Cosmos) provision(ctx context.Context) error {
+	status, _, err := c.do(ctx, http.MethodPost, "dbs", "", "dbs", nil, map[string]string{"id": c.cfg.Database})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated && status != http.StatusConflict {
+		return fmt.Errorf("creating Cosmos DB database %s returned status %d", c.cfg.Database, status)
+	}
+
+	if err := c.provisionContainer(ctx, c.cfg.Container, "/conversationId"); err != nil {
+		return err
+	}
+	if err := c.provisionContainer(ctx, c.cfg.RoomsContainer, "/roomId"); err != nil {
+		return err
+	}
+	return c.provisionContainer(ctx, c.cfg.ReadsContainer, "/userId")
+}
+
+// provisionContainer creates a container if it doesn't exist
+func (c *Cosmos) provisionContainer(ctx context.Context, name, partitionKeyPath string) error {
+	dbLink := "dbs/" + c.cfg.Database
+	status, _, err := c.do(ctx, http.MethodPost, "colls", dbLink, dbLink+"/colls", nil, map[string]interface{}{
+		"id": name,
+		"partitionKey": map[string]interface{}{
+			"paths":   []string{partitionKeyPath},
+			"kind":    "Hash",
+			"version": 2,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated && status != http.StatusConflict {
+		return fmt.Errorf("creating Cosmos DB container %s returned status %d", name, status)
+	}
+	return nil
+}
+
+// collLink is the resource link of the messages container
+func (c *Cosmos) collLink() string {
+	return "dbs/" + c.cfg.Database + "/colls/" + c.cfg.Container
+}
+
+// roomsLink is the resource link of the rooms container
+func (c *Cosmos) roomsLink() string {
+	return "dbs/" + c.cfg.Database + "/colls/" + c.cfg.RoomsContainer
+}
+
+// readsLink is the resource link of the read markers container
+func (c *Cosmos) readsLink() string {
+	return "dbs/" + c.cfg.Database + "/colls/" + c.cfg.ReadsContainer
+}
+
+// SaveMessage creates the message document in its conversation's partition
+func (c *Cosmos) SaveMessage(ctx context.Context, msg *Message) error {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.collLink(), c.collLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(msg.ConversationID)},
+		cosmosDocument{Message: msg, Timestamp: msg.CreatedAt.UnixMicro()})
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated, http.StatusConflict: // Conflict: already saved
+		return nil
+	default:
+		return fmt.Errorf("saving message to Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// Messages queries a conversation's partition, newest first. Messages outside threads have
+// no parentMessageId property.
+func (c *Cosmos) Messages(ctx context.Context, conversationID string, before time.Time, limit int) ([]*Message, error) {
+	return c.page(ctx, conversationID, "NOT IS_DEFINED(c.parentMessageId)", nil, before, limit)
+}
+
+// Message finds a message by ID across conversations
+func (c *Cosmos) Message(ctx context.Context, id string) (*Message, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.id = @id",
+		"parameters": []map[string]interface{}{{"name": "@id", "value": id}},
+	}
+
+	var messages []*Message
+	err := c.query(ctx, c.collLink(), "", query, 1, func(documents json.RawMessage) (int, error) {
+		var page []*Message
+		err := json.Unmarshal(documents, &page)
+		messages = append(messages, page...)
+		return len(messages), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	return messages[0], nil
+}
+
+// Replies queries a thread's replies in the conversation's partition, newest first
+func (c *Cosmos) Replies(ctx context.Context, conversationID, parentID string, before time.Time, limit int) ([]*Message, error) {
+	return c.page(ctx, conversationID, "c.parentMessageId = @parentId",
+		[]map[string]interface{}{{"name": "@parentId", "value": parentID}}, before, limit)
+}
+
+// ConversationMessages queries a conversation's partition, oldest first
+func (c *Cosmos) ConversationMessages(ctx context.Context, conversationID string, after time.Time, limit int) ([]*Message, error) {
+	var afterTS int64
+	if !after.IsZero() {
+		afterTS = after.UnixMicro()
+	}
+	query := map[string]interface{}{
+		"query": "SELECT TOP @limit * FROM c WHERE c.conversationId = @conversationId AND c.ts > @after ORDER BY c.ts",
+		"parameters": []map[string]interface{}{
+			{"name": "@limit", "value": limit},
+			{"name": "@conversationId", "value": conversationID},
+			{"name": "@after", "value": afterTS},
+		},
+	}
+
+	var messages []*Message
+	err := c.query(ctx, c.collLink(), conversationID, query, limit, func(documents json.RawMessage) (int, error) {
+		var page []*Message
+		err := json.Unmarshal(documents, &page)
+		messages = append(messages, page...)
+		return len(messages), err
+	})
+	return messages, err
+}
+
+// page queries up to limit of a conversation's messages matching filter (a condition using
+// the given parameters) created before the given time, newest first
+func (c *Cosmos) page(ctx context.Context, conversationID, filter string, parameters []map[string]interface{}, before time.Time, limit int) ([]*Message, error) {
+	beforeTS := int64(math.MaxInt64 >> 10) // Exactly representable as a JSON number
+	if !before.IsZero() {
+		beforeTS = before.UnixMicro()
+	}
+	query := map[string]interface{}{
+		"query": "SELECT TOP @limit * FROM c WHERE c.conversationId = @conversationId AND c.ts < @before AND " + filter + " ORDER BY c.ts DESC",
+		"parameters": append([]map[string]interface{}{
+			{"name": "@limit", "value": limit},
+			{"name": "@conversationId", "value": conversationID},
+			{"name": "@before", "value": beforeTS},
+		}, parameters...),
+	}
+
+	var messages []*Message
+	err := c.query(ctx, c.collLink(), conversationID, query, limit, func(documents json.RawMessage) (int, error) {
+		var page []*Message
+		err := json.Unmarshal(documents, &page)
+		messages = append(messages, page...)
+		return len(messages), err
+	})
+	return messages, err
+}
+
+// ScanMessages queries the messages created before the given time across partitions
+func (c *Cosmos) ScanMessages(ctx context.Context, before time.Time, each func(msg *Message) error) error {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.ts < @before",
+		"parameters": []map[string]interface{}{{"name": "@before", "value": before.UnixMicro()}},
+	}
+
+	var eachErr error
+	err := c.query(ctx, c.collLink(), "", query, 0, func(documents json.RawMessage) (int, error) {
+		var page []*Message
+		if err := json.Unmarshal(documents, &page); err != nil {
+			return 0, err
+		}
+		for _, msg := range page {
+			if eachErr = each(msg); eachErr != nil {
+				return 0, eachErr
+			}
+		}
+		return 0, nil
+	})
+	if eachErr != nil {
+		return eachErr
+	}
+	return err
+}
+
+// PurgeMessages deletes the message documents from their conversations' partitions
+func (c *Cosmos) PurgeMessages(ctx context.Context, msgs []*Message) error {
+	for _, msg := range msgs {
+		docLink := c.collLink() + "/docs/" + msg.ID
+		status, body, err := c.do(ctx, http.MethodDelete, "docs", docLink, docLink,
+			map[string]string{"x-ms-documentdb-partitionkey": partitionKey(msg.ConversationID)}, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusNoContent && status != http.StatusNotFound {
+			return fmt.Errorf("deleting message from Cosmos DB returned status %d: %s", status, body)
+		}
+	}
+	return nil
+}
+
+// cosmosUpdateAttempts bounds the read-modify-replace retries when concurrent updates to a
+// message conflict
+const cosmosUpdateAttempts = 5
+
+// AddReaction adds a reaction to the message document
+func (c *Cosmos) AddReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error) {
+	var added bool
+	updated, err := c.update(ctx, msg, func(msg *Message) (bool, error) {
+		msg.Reactions, added = withReaction(msg.Reactions, emoji, userID)
+		return added, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return updated.Reactions, added, nil
+}
+
+// RemoveReaction removes a reaction from the message document
+func (c *Cosmos) RemoveReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error) {
+	var removed bool
+	updated, err := c.update(ctx, msg, func(msg *Message) (bool, error) {
+		msg.Reactions, removed = withoutReaction(msg.Reactions, emoji, userID)
+		return removed, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return updated.Reactions, removed, nil
+}
+
+// EditMessage replaces the content of the message document
+func (c *Cosmos) EditMessage(ctx context.Context, msg *Message, content *models.MessageContent, editedBy string, at time.Time) (*Message, error) {
+	return c.update(ctx, msg, func(msg *Message) (bool, error) {
+		return true, edit(msg, content, editedBy, at)
+	})
+}
+
+// DeleteMessage replaces the message document with a tombstone
+func (c *Cosmos) DeleteMessage(ctx context.Context, msg *Message, deletedBy string, at time.Time) (*Message, error) {
+	return c.update(ctx, msg, func(msg *Message) (bool, error) {
+		return true, tombstone(msg, deletedBy, at)
+	})
+}
+
+// AddAttachment adds an attachment to the message document
+func (c *Cosmos) AddAttachment(ctx context.Context, msg *Message, attachment *Attachment) (*Message, bool, error) {
+	var added bool
+	updated, err := c.update(ctx, msg, func(msg *Message) (bool, error) {
+		var err error
+		added, err = attach(msg, attachment)
+		return added, err
+	})
+	return updated, added, err
+}
+
+// SetThumbnails records the thumbnails of an attachment in the message document
+func (c *Cosmos) SetThumbnails(ctx context.Context, msg *Message, attachmentID string, thumbnails []*Thumbnail) (*Message, error) {
+	return c.update(ctx, msg, func(msg *Message) (bool, error) {
+		return true, withThumbnails(msg, attachmentID, thumbnails)
+	})
+}
+
+// update reads the message document, applies change to it and replaces it if change reports
+// a change. The replace is conditional on the document's ETag, so a concurrent update makes
+// it start over rather than be lost.
+func (c *Cosmos) update(ctx context.Context, msg *Message, change func(msg *Message) (bool, error)) (*Message, error) {
+	docLink := c.collLink() + "/docs/" + msg.ID
+	headers := map[string]string{"x-ms-documentdb-partitionkey": partitionKey(msg.ConversationID)}
+
+	for attempt := 0; attempt < cosmosUpdateAttempts; attempt++ {
+		resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink, headers, nil)
+		if err != nil {
+			return nil, err
+		}
+		var doc struct {
+			cosmosDocument
+			ETag string `json:"_etag"`
+		}
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&doc)
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, ErrMessageNotFound
+		case resp.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("reading message from Cosmos DB returned status %d", resp.StatusCode)
+		case err != nil || doc.Message == nil:
+			return nil, fmt.Errorf("decoding Cosmos DB message %s: %v", msg.ID, err)
+		}
+
+		changed, err := change(doc.Message)
+		if err != nil || !changed {
+			return doc.Message, err
+		}
+
+		status, body, err := c.do(ctx, http.MethodPut, "docs", docLink, docLink,
+			map[string]string{"x-ms-documentdb-partitionkey": partitionKey(msg.ConversationID), "If-Match": doc.ETag},
+			doc.cosmosDocument)
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case http.StatusOK:
+			return doc.Message, nil
+		case http.StatusPreconditionFailed: // Changed since it was read
+			continue
+		default:
+			return nil, fmt.Errorf("updating message in Cosmos DB returned status %d: %s", status, body)
+		}
+	}
+	return nil, fmt.Errorf("updating message %s in Cosmos DB: too many concurrent updates", msg.ID)
+}
+
+// query runs a query in one partition (or across partitions when partition is empty),
+// passing each page's documents to add until it reports limit results (0 for all)
+func (c *Cosmos) query(ctx context.Context, collLink, partition string, query interface{}, limit int, add func(documents json.RawMessage) (int, error)) error {
+	continuation := ""
+	for {
+		headers := map[string]string{
+			"Content-Type":            "application/query+json",
+			"x-ms-documentdb-isquery": "True",
+		}
+		if partition != "" {
+			headers["x-ms-documentdb-partitionkey"] = partitionKey(partition)
+		} else {
+			headers["x-ms-documentdb-query-enablecrosspartition"] = "True"
+		}
+		if limit > 0 {
+			headers["x-ms-max-item-count"] = strconv.Itoa(limit)
+		}
+		if continuation != "" {
+			headers["x-ms-continuation"] = continuation
+		}
+
+		resp, err := c.request(ctx, http.MethodPost, "docs", collLink, collLink+"/docs", headers, query)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Documents json.RawMessage `json:"Documents"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("querying Cosmos DB returned status %d", resp.StatusCode)
+		}
+		if err != nil {
+			return fmt.Errorf("decoding Cosmos DB query results: %w", err)
+		}
+
+		count, err := add(page.Documents)
+		if err != nil {
+			return fmt.Errorf("decoding Cosmos DB query results: %w", err)
+		}
+		continuation = resp.Header.Get("x-ms-continuation")
+		if continuation == "" || (limit > 0 && count >= limit) {
+			return nil
+		}
+	}
+}
+
+// DirectConversations queries the user's direct messages across partitions for their
+// conversation IDs. Only the IDs are returned, but the query reads every direct message the
+// user sent or received.
+func (c *Cosmos) DirectConversations(ctx context.Context, userID string) ([]string, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT VALUE c.conversationId FROM c WHERE c.recipientId != '' AND (c.senderId = @userId OR c.recipientId = @userId)",
+		"parameters": []map[string]interface{}{{"name": "@userId", "value": userID}},
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	err := c.query(ctx, c.collLink(), "", query, 0, func(documents json.RawMessage) (int, error) {
+		var page []string
+		err := json.Unmarshal(documents, &page)
+		for _, id := range page {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return len(ids), err
+	})
+	return ids, err
+}
+
+// CountUnread counts a conversation's messages from others after the given time in its partition
+func (c *Cosmos) CountUnread(ctx context.Context, conversationID, userID string, after time.Time) (int, error) {
+	var afterTS int64
+	if !after.IsZero() {
+		afterTS = after.UnixMicro()
+	}
+	query := map[string]interface{}{
+		"query": "SELECT VALUE COUNT(1) FROM c WHERE c.conversationId = @conversationId AND c.ts > @after AND c.senderId != @userId " +
+			"AND NOT IS_DEFINED(c.parentMessageId) AND NOT IS_DEFINED(c.deletedAt)",
+		"parameters": []map[string]interface{}{
+			{"name": "@conversationId", "value": conversationID},
+			{"name": "@after", "value": afterTS},
+			{"name": "@userId", "value": userID},
+		},
+	}
+
+	count := 0
+	err := c.query(ctx, c.collLink(), conversationID, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []int
+		err := json.Unmarshal(documents, &page)
+		for _, n := range page {
+			count += n
+		}
+		return count, err
+	})
+	return count, err
+}
+
+// cosmosReadMarker is a user's read marker for one conversation, as stored in Cosmos DB
+type cosmosReadMarker struct {
+	ID       string    `json:"id"` // The conversation ID
+	UserID   string    `json:"userId"`
+	TenantID string    `json:"tenantId,omitempty"`
+	ReadAt   time.Time `json:"readAt"`
+}
+
+// MarkRead creates or moves forward the user's read marker document for a conversation.
+// Like message updates, replaces are conditional on the document's ETag.
+func (c *Cosmos) MarkRead(ctx context.Context, userID, tenantID, conversationID string, at time.Time) error {
+	docLink := c.readsLink() + "/docs/" + conversationID
+	headers := map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)}
+	marker := cosmosReadMarker{ID: conversationID, UserID: userID, TenantID: tenantID, ReadAt: at}
+
+	for attempt := 0; attempt < cosmosUpdateAttempts; attempt++ {
+		resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink, headers, nil)
+		if err != nil {
+			return err
+		}
+		var doc struct {
+			cosmosReadMarker
+			ETag string `json:"_etag"`
+		}
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&doc)
+		}
+		resp.Body.Close()
+
+		var status int
+		var body string
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			status, body, err = c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs", headers, marker)
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("reading read marker from Cosmos DB returned status %d", resp.StatusCode)
+		case err != nil:
+			return fmt.Errorf("decoding Cosmos DB read marker: %w", err)
+		case !at.After(doc.ReadAt):
+			return nil
+		default:
+			status, body, err = c.do(ctx, http.MethodPut, "docs", docLink, docLink,
+				map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID), "If-Match": doc.ETag}, marker)
+		}
+		if err != nil {
+			return err
+		}
+		switch status {
+		case http.StatusOK, http.StatusCreated:
+			return nil
+		case http.StatusConflict, http.StatusPreconditionFailed: // Created or changed since it was read
+			continue
+		default:
+			return fmt.Errorf("saving read marker to Cosmos DB returned status %d: %s", status, body)
+		}
+	}
+	return fmt.Errorf("saving read marker for %s in Cosmos DB: too many concurrent updates", conversationID)
+}
+
+// ReadMarkers queries the user's read markers in their partition (which also holds their
+// block list, notification preferences, push subscriptions and devices)
+func (c *Cosmos) ReadMarkers(ctx context.Context, userID string) (map[string]time.Time, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.userId = @userId AND IS_DEFINED(c.readAt)",
+		"parameters": []map[string]interface{}{{"name": "@userId", "value": userID}},
+	}
+
+	markers := make(map[string]time.Time)
+	err := c.query(ctx, c.readsLink(), userID, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosReadMarker
+		err := json.Unmarshal(documents, &page)
+		for _, marker := range page {
+			markers[marker.ID] = marker.ReadAt.UTC()
+		}
+		return len(markers), err
+	})
+	return markers, err
+}
+
+// cosmosBlock is an entry of a user's block list, as stored in Cosmos DB next to their read
+// markers
+type cosmosBlock struct {
+	ID        string    `json:"id"` // "block:" + the blocked user's ID
+	UserID    string    `json:"userId"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	BlockedID string    `json:"blockedId"`
+	Kind      BlockKind `json:"kind"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SaveBlock upserts the block document in the user's partition, unless it already has the
+// same kind
+func (c *Cosmos) SaveBlock(ctx context.Context, block *Block) error {
+	existing, err := c.Block(ctx, block.UserID, block.BlockedID)
+	if err == nil && existing.Kind == block.Kind {
+		return nil
+	}
+	if err != nil && !errors.Is(err, ErrBlockNotFound) {
+		return err
+	}
+
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(block.UserID), "x-ms-documentdb-is-upsert": "True"},
+		cosmosBlock{ID: "block:" + block.BlockedID, UserID: block.UserID, TenantID: block.TenantID, BlockedID: block.BlockedID, Kind: block.Kind, CreatedAt: block.CreatedAt})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("saving block to Cosmos DB returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// DeleteBlock deletes the block document
+func (c *Cosmos) DeleteBlock(ctx context.Context, userID, blockedID string) (bool, error) {
+	docLink := c.readsLink() + "/docs/block:" + blockedID
+	status, body, err := c.do(ctx, http.MethodDelete, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)}, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("deleting block from Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// Block reads the block document
+func (c *Cosmos) Block(ctx context.Context, userID, blockedID string) (*Block, error) {
+	docLink := c.readsLink() + "/docs/block:" + blockedID
+	resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrBlockNotFound
+	default:
+		return nil, fmt.Errorf("reading block from Cosmos DB returned status %d", resp.StatusCode)
+	}
+	var doc cosmosBlock
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding Cosmos DB block %s: %v", blockedID, err)
+	}
+	return &Block{UserID: doc.UserID, BlockedID: doc.BlockedID, Kind: doc.Kind, CreatedAt: doc.CreatedAt.UTC()}, nil
+}
+
+// Blocks queries the block documents in the user's partition
+func (c *Cosmos) Blocks(ctx context.Context, userID string) ([]*Block, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.userId = @userId AND IS_DEFINED(c.blockedId)",
+		"parameters": []map[string]interface{}{{"name": "@userId", "value": userID}},
+	}
+
+	var blocks []*Block
+	err := c.query(ctx, c.readsLink(), userID, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosBlock
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			blocks = append(blocks, &Block{UserID: doc.UserID, BlockedID: doc.BlockedID, Kind: doc.Kind, CreatedAt: doc.CreatedAt.UTC()})
+		}
+		return len(blocks), err
+	})
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].CreatedAt.Before(blocks[j].CreatedAt) })
+	return blocks, err
+}
+
+// cosmosPreferencesID is the ID of a user's notification preferences document, stored in
+// Cosmos DB next to their read markers
+const cosmosPreferencesID = "preferences:notifications"
+
+// cosmosPreferences is a user's notification preferences document
+type cosmosPreferences struct {
+	ID          string          `json:"id"` // cosmosPreferencesID
+	UserID      string          `json:"userId"`
+	TenantID    string          `json:"tenantId,omitempty"`
+	Push        *bool           `json:"push"` // Unset in documents saved before push could be turned off
+	Email       bool            `json:"email,omitempty"`
+	Teams       bool            `json:"teams"`
+	TeamsChatID string          `json:"teamsChatId,omitempty"`
+	QuietHours  *QuietHours     `json:"quietHours,omitempty"`
+	Events      map[string]bool `json:"events,omitempty"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// SaveNotificationPreferences upserts the preferences document in the user's partition
+func (c *Cosmos) SaveNotificationPreferences(ctx context.Context, prefs *NotificationPreferences) error {
+	doc := cosmosPreferences{
+		ID:          cosmosPreferencesID,
+		UserID:      prefs.UserID,
+		TenantID:    prefs.TenantID,
+		Push:        &prefs.Push,
+		Email:       prefs.Email,
+		Teams:       prefs.Teams,
+		TeamsChatID: prefs.TeamsChatID,
+		QuietHours:  prefs.QuietHours,
+		Events:      prefs.Events,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if prefs.UpdatedAt != nil {
+		doc.UpdatedAt = *prefs.UpdatedAt
+	}
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(prefs.UserID), "x-ms-documentdb-is-upsert": "True"}, doc)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("saving notification preferences to Cosmos DB returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// NotificationPreferences reads the preferences document
+func (c *Cosmos) NotificationPreferences(ctx context.Context, userID string) (*NotificationPreferences, error) {
+	docLink := c.readsLink() + "/docs/" + cosmosPreferencesID
+	resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return DefaultNotificationPreferences(userID), nil
+	default:
+		return nil, fmt.Errorf("reading notification preferences from Cosmos DB returned status %d", resp.StatusCode)
+	}
+	var doc cosmosPreferences
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding Cosmos DB notification preferences of %s: %v", userID, err)
+	}
+	return doc.preferences(), nil
+}
+
+// preferences converts the document to the user's notification preferences
+func (doc *cosmosPreferences) preferences() *NotificationPreferences {
+	updatedAt := doc.UpdatedAt.UTC()
+	return &NotificationPreferences{
+		UserID:      doc.UserID,
+		TenantID:    doc.TenantID,
+		Push:        doc.Push == nil || *doc.Push,
+		Email:       doc.Email,
+		Teams:       doc.Teams,
+		TeamsChatID: doc.TeamsChatID,
+		QuietHours:  doc.QuietHours,
+		Events:      doc.Events,
+		UpdatedAt:   &updatedAt,
+	}
+}
+
+// cosmosPushSubscription is a user's push subscription, as stored in Cosmos DB next to their
+// read markers
+type cosmosPushSubscription struct {
+	ID             string    `json:"id"` // "push:" + the subscription ID
+	UserID         string    `json:"userId"`
+	TenantID       string    `json:"tenantId,omitempty"`
+	SubscriptionID string    `json:"subscriptionId"`
+	Endpoint       string    `json:"endpoint"`
+	P256dh         string    `json:"p256dh"`
+	Auth           string    `json:"auth"`
+	UserAgent      string    `json:"userAgent,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// SavePushSubscription upserts the subscription document in the user's partition
+func (c *Cosmos) SavePushSubscription(ctx context.Context, sub *PushSubscription) error {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(sub.UserID), "x-ms-documentdb-is-upsert": "True"},
+		cosmosPushSubscription{ID: "push:" + sub.ID, UserID: sub.UserID, TenantID: sub.TenantID, SubscriptionID: sub.ID, Endpoint: sub.Endpoint,
+			P256dh: sub.P256dh, Auth: sub.Auth, UserAgent: sub.UserAgent, CreatedAt: sub.CreatedAt})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("saving push subscription to Cosmos DB returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// DeletePushSubscription deletes the subscription document
+func (c *Cosmos) DeletePushSubscription(ctx context.Context, userID, id string) (bool, error) {
+	docLink := c.readsLink() + "/docs/push:" + id
+	status, body, err := c.do(ctx, http.MethodDelete, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)}, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("deleting push subscription from Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// PushSubscriptions queries the subscription documents in the user's partition
+func (c *Cosmos) PushSubscriptions(ctx context.Context, userID string) ([]*PushSubscription, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.userId = @userId AND IS_DEFINED(c.subscriptionId)",
+		"parameters": []map[string]interface{}{{"name": "@userId", "value": userID}},
+	}
+
+	var subs []*PushSubscription
+	err := c.query(ctx, c.readsLink(), userID, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosPushSubscription
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			subs = append(subs, &PushSubscription{ID: doc.SubscriptionID, UserID: doc.UserID, Endpoint: doc.Endpoint,
+				P256dh: doc.P256dh, Auth: doc.Auth, UserAgent: doc.UserAgent, CreatedAt: doc.CreatedAt.UTC()})
+		}
+		return len(subs), err
+	})
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, err
+}
+
+// cosmosDevice is a user's device, as stored in Cosmos DB next to their read markers
+type cosmosDevice struct {
+	ID        string    `json:"id"` // "device:" + the device ID
+	UserID    string    `json:"userId"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	DeviceID  string    `json:"deviceId"`
+	Platform  string    `json:"platform"`
+	Token     string    `json:"token"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SaveDevice upserts the device document in the user's partition
+func (c *Cosmos) SaveDevice(ctx context.Context, device *Device) error {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(device.UserID), "x-ms-documentdb-is-upsert": "True"},
+		cosmosDevice{ID: "device:" + device.ID, UserID: device.UserID, TenantID: device.TenantID, DeviceID: device.ID, Platform: device.Platform,
+			Token: device.Token, Name: device.Name, CreatedAt: device.CreatedAt})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("saving device to Cosmos DB returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// DeleteDevice deletes the device document
+func (c *Cosmos) DeleteDevice(ctx context.Context, userID, id string) (bool, error) {
+	docLink := c.readsLink() + "/docs/device:" + id
+	status, body, err := c.do(ctx, http.MethodDelete, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)}, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("deleting device from Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// Devices queries the device documents in the user's partition
+func (c *Cosmos) Devices(ctx context.Context, userID string) ([]*Device, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.userId = @userId AND IS_DEFINED(c.deviceId)",
+		"parameters": []map[string]interface{}{{"name": "@userId", "value": userID}},
+	}
+
+	var devices []*Device
+	err := c.query(ctx, c.readsLink(), userID, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosDevice
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			devices = append(devices, &Device{ID: doc.DeviceID, UserID: doc.UserID, Platform: doc.Platform,
+				Token: doc.Token, Name: doc.Name, CreatedAt: doc.CreatedAt.UTC()})
+		}
+		return len(devices), err
+	})
+	sort.SliceStable(devices, func(i, j int) bool { return devices[i].CreatedAt.Before(devices[j].CreatedAt) })
+	return devices, err
+}
+
+// TenantPushSubscriptions queries the subscription documents of the tenant's users across
+// partitions
+func (c *Cosmos) TenantPushSubscriptions(ctx context.Context, tenantID string) (map[string][]*PushSubscription, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE " + cosmosTenantPushFilter,
+		"parameters": []map[string]interface{}{{"name": "@tenantId", "value": tenantID}},
+	}
+
+	subs := make(map[string][]*PushSubscription)
+	err := c.query(ctx, c.readsLink(), "", query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosPushSubscription
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			subs[doc.UserID] = append(subs[doc.UserID], &PushSubscription{ID: doc.SubscriptionID, UserID: doc.UserID, TenantID: doc.TenantID,
+				Endpoint: doc.Endpoint, P256dh: doc.P256dh, Auth: doc.Auth, UserAgent: doc.UserAgent, CreatedAt: doc.CreatedAt.UTC()})
+		}
+		return 0, err
+	})
+	return subs, err
+}
+
+// PurgeTenantPushSubscriptions deletes the subscription documents of the tenant's users
+func (c *Cosmos) PurgeTenantPushSubscriptions(ctx context.Context, tenantID string) (int, error) {
+	return c.purge(ctx, c.readsLink(), "SELECT c.id, c.userId AS partition FROM c WHERE "+cosmosTenantPushFilter, tenantID)
+}
+
+// TenantDevices queries the device documents of the tenant's users across partitions
+func (c *Cosmos) TenantDevices(ctx context.Context, tenantID string) (map[string][]*Device, error) {
+	query := map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE " + cosmosTenantDeviceFilter,
+		"parameters": []map[string]interface{}{{"name": "@tenantId", "value": tenantID}},
+	}
+
+	devices := make(map[string][]*Device)
+	err := c.query(ctx, c.readsLink(), "", query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosDevice
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			devices[doc.UserID] = append(devices[doc.UserID], &Device{ID: doc.DeviceID, UserID: doc.UserID, TenantID: doc.TenantID,
+				Platform: doc.Platform, Token: doc.Token, Name: doc.Name, CreatedAt: doc.CreatedAt.UTC()})
+		}
+		return 0, err
+	})
+	return devices, err
+}
+
+// PurgeTenantDevices deletes the device documents of the tenant's users
+func (c *Cosmos) PurgeTenantDevices(ctx context.Context, tenantID string) (int, error) {
+	return c.purge(ctx, c.readsLink(), "SELECT c.id, c.userId AS partition FROM c WHERE "+cosmosTenantDeviceFilter, tenantID)
+}
+
+// tenantsPartition is the partition of the reads container holding tenant registry
+// documents; user IDs are GUIDs, so it can't collide with a user's partition
+const tenantsPartition = "tenants:registry"
+
+// cosmosTenant is a tenant registry record ("tenant:" + the tenant ID), or the claim on a
+// storage partition ("partition:" + the partition, without a record)
+type cosmosTenant struct {
+	ID               string          `json:"id"`
+	UserID           string          `json:"userId"` // tenantsPartition
+	TenantID         string          `json:"tenantId"`
+	StoragePartition string          `json:"storagePartition"`
+	Record           json.RawMessage `json:"record,omitempty"`
+}
+
+// ProvisionTenant creates the partition claim document, failing if another tenant made it
+func (c *Cosmos) ProvisionTenant(ctx context.Context, tenantID, partition string) error {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(tenantsPartition)},
+		cosmosTenant{ID: "partition:" + partition, UserID: tenantsPartition, TenantID: tenantID, StoragePartition: partition})
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+	default:
+		return fmt.Errorf("claiming storage partition in Cosmos DB returned status %d: %s", status, body)
+	}
+
+	docLink := c.readsLink() + "/docs/partition:" + partition
+	resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(tenantsPartition)}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reading storage partition claim from Cosmos DB returned status %d", resp.StatusCode)
+	}
+	var claim cosmosTenant
+	if err := json.NewDecoder(resp.Body).Decode(&claim); err != nil {
+		return fmt.Errorf("decoding Cosmos DB storage partition claim: %w", err)
+	}
+	if claim.TenantID != tenantID {
+		return ErrPartitionClaimed
+	}
+	return nil
+}
+
+// SaveTenant upserts the tenant's record document
+func (c *Cosmos) SaveTenant(ctx context.Context, tenantID, partition string, record json.RawMessage) error {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(tenantsPartition), "x-ms-documentdb-is-upsert": "True"},
+		cosmosTenant{ID: "tenant:" + tenantID, UserID: tenantsPartition, TenantID: tenantID, StoragePartition: partition, Record: record})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("saving tenant to Cosmos DB returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// Tenants queries the record documents in the tenants partition
+func (c *Cosmos) Tenants(ctx context.Context) ([]json.RawMessage, error) {
+	query := map[string]interface{}{
+		"query": "SELECT * FROM c WHERE IS_DEFINED(c.record)",
+	}
+
+	var records []json.RawMessage
+	err := c.query(ctx, c.readsLink(), tenantsPartition, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosTenant
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			records = append(records, doc.Record)
+		}
+		return len(records), err
+	})
+	return records, err
+}
+
+// Conditions on @tenantId selecting a tenant's documents in the reads container. Tenant
+// registry documents have a tenantId too, but also a storagePartition. Documents saved
+// before they were tagged with the user's tenant have no tenantId and are never selected.
+const (
+	cosmosTenantUserFilter   = "c.tenantId = @tenantId AND NOT IS_DEFINED(c.storagePartition) AND NOT IS_DEFINED(c.subscriptionId) AND NOT IS_DEFINED(c.deviceId)"
+	cosmosTenantPushFilter   = "c.tenantId = @tenantId AND IS_DEFINED(c.subscriptionId)"
+	cosmosTenantDeviceFilter = "c.tenantId = @tenantId AND IS_DEFINED(c.deviceId)"
+)
+
+// Queries selecting the ID and partition key of a tenant's documents in each container
+const (
+	cosmosTenantMessages = "SELECT c.id, c.conversationId AS partition FROM c WHERE c.tenantId = @tenantId"
+	cosmosTenantRooms    = "SELECT c.id, c.roomId AS partition FROM c WHERE c.room.tenantId = @tenantId"
+	cosmosTenantUserDocs = "SELECT c.id, c.userId AS partition FROM c WHERE " + cosmosTenantUserFilter
+)
+
+// cosmosRef locates a document: its ID and partition key value
+type cosmosRef struct {
+	ID        string `json:"id"`
+	Partition string `json:"partition"`
+}
+
+// refs runs a query on @tenantId selecting document IDs and partition keys across partitions
+func (c *Cosmos) refs(ctx context.Context, collLink, query, tenantID string) ([]cosmosRef, error) {
+	var refs []cosmosRef
+	err := c.query(ctx, collLink, "", map[string]interface{}{
+		"query":      query,
+		"parameters": []map[string]interface{}{{"name": "@tenantId", "value": tenantID}},
+	}, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosRef
+		err := json.Unmarshal(documents, &page)
+		refs = append(refs, page...)
+		return len(refs), err
+	})
+	return refs, err
+}
+
+// purge deletes the documents a refs query selects and returns how many were deleted
+func (c *Cosmos) purge(ctx context.Context, collLink, query, tenantID string) (int, error) {
+	refs, err := c.refs(ctx, collLink, query, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, ref := range refs {
+		docLink := collLink + "/docs/" + ref.ID
+		status, body, err := c.do(ctx, http.MethodDelete, "docs", docLink, docLink,
+			map[string]string{"x-ms-documentdb-partitionkey": partitionKey(ref.Partition)}, nil)
+		if err != nil {
+			return purged, err
+		}
+		switch status {
+		case http.StatusNoContent:
+			purged++
+		case http.StatusNotFound:
+		default:
+			return purged, fmt.Errorf("deleting tenant document from Cosmos DB returned status %d: %s", status, body)
+		}
+	}
+	return purged, nil
+}
+
+// ExportTenant queries the tenant's messages, rooms and members, and the read markers, block
+// lists and notification preferences of its users across partitions
+func (c *Cosmos) ExportTenant(ctx context.Context, tenantID string) (*TenantData, error) {
+	data := &TenantData{
+		Messages:    []*Message{},
+		Rooms:       []*TenantRoom{},
+		ReadMarkers: make(map[string]map[string]time.Time),
+		Blocks:      make(map[string][]*Block),
+		Preferences: make(map[string]*NotificationPreferences),
+	}
+	parameters := []map[string]interface{}{{"name": "@tenantId", "value": tenantID}}
+
+	err := c.query(ctx, c.collLink(), "", map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.tenantId = @tenantId",
+		"parameters": parameters,
+	}, 0, func(documents json.RawMessage) (int, error) {
+		var page []*Message
+		err := json.Unmarshal(documents, &page)
+		data.Messages = append(data.Messages, page...)
+		return len(data.Messages), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(data.Messages, func(i, j int) bool { return data.Messages[i].CreatedAt.Before(data.Messages[j].CreatedAt) })
+
+	rooms := make(map[string]*TenantRoom)
+	err = c.query(ctx, c.roomsLink(), "", map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE c.room.tenantId = @tenantId",
+		"parameters": parameters,
+	}, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosRoomDocument
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			room, ok := rooms[doc.RoomID]
+			if !ok {
+				room = &TenantRoom{Room: doc.Room, Members: []*Member{}}
+				rooms[doc.RoomID] = room
+				data.Rooms = append(data.Rooms, room)
+			}
+			if doc.Member != nil {
+				room.Members = append(room.Members, doc.Member)
+			}
+		}
+		return len(rooms), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(data.Rooms, func(i, j int) bool { return data.Rooms[i].CreatedAt.Before(data.Rooms[j].CreatedAt) })
+	for _, room := range data.Rooms {
+		sort.SliceStable(room.Members, func(i, j int) bool { return room.Members[i].JoinedAt.Before(room.Members[j].JoinedAt) })
+	}
+
+	err = c.query(ctx, c.readsLink(), "", map[string]interface{}{
+		"query":      "SELECT * FROM c WHERE " + cosmosTenantUserFilter,
+		"parameters": parameters,
+	}, 0, func(documents json.RawMessage) (int, error) {
+		var page []json.RawMessage
+		if err := json.Unmarshal(documents, &page); err != nil {
+			return 0, err
+		}
+		for _, raw := range page {
+			var kind struct {
+				ID        string `json:"id"`
+				BlockedID string `json:"blockedId"`
+				ReadAt    string `json:"readAt"`
+			}
+			if err := json.Unmarshal(raw, &kind); err != nil {
+				return 0, err
+			}
+			switch {
+			case kind.ID == cosmosPreferencesID:
+				var doc cosmosPreferences
+				if err := json.Unmarshal(raw, &doc); err != nil {
+					return 0, err
+				}
+				data.Preferences[doc.UserID] = doc.preferences()
+			case kind.BlockedID != "":
+				var doc cosmosBlock
+				if err := json.Unmarshal(raw, &doc); err != nil {
+					return 0, err
+				}
+				data.Blocks[doc.UserID] = append(data.Blocks[doc.UserID], &Block{UserID: doc.UserID, TenantID: doc.TenantID,
+					BlockedID: doc.BlockedID, Kind: doc.Kind, CreatedAt: doc.CreatedAt.UTC()})
+			case kind.ReadAt != "":
+				var doc cosmosReadMarker
+				if err := json.Unmarshal(raw, &doc); err != nil {
+					return 0, err
+				}
+				if data.ReadMarkers[doc.UserID] == nil {
+					data.ReadMarkers[doc.UserID] = make(map[string]time.Time)
+				}
+				data.ReadMarkers[doc.UserID][doc.ID] = doc.ReadAt.UTC()
+			}
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// tenantDocs pairs each container with the query selecting a tenant's documents in it
+func (c *Cosmos) tenantDocs() []struct{ collLink, query string } {
+	return []struct{ collLink, query string }{
+		{c.collLink(), cosmosTenantMessages},
+		{c.roomsLink(), cosmosTenantRooms},
+		{c.readsLink(), cosmosTenantUserDocs},
+	}
+}
+
+// PurgeTenant deletes the tenant's message, room and member documents, and the read marker,
+// block and notification preferences documents of its users
+func (c *Cosmos) PurgeTenant(ctx context.Context, tenantID string) (int, error) {
+	purged := 0
+	for _, docs := range c.tenantDocs() {
+		n, err := c.purge(ctx, docs.collLink, docs.query, tenantID)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// CountTenant counts the documents PurgeTenant deletes
+func (c *Cosmos) CountTenant(ctx context.Context, tenantID string) (int, error) {
+	count := 0
+	for _, docs := range c.tenantDocs() {
+		refs, err := c.refs(ctx, docs.collLink, docs.query, tenantID)
+		if err != nil {
+			return 0, err
+		}
+		count += len(refs)
+	}
+	return count, nil
+}
+
+// CreateRoom creates the room document in the room's partition
+func (c *Cosmos) CreateRoom(ctx context.Context, room *Room) error {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.roomsLink(), c.roomsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(room.ID)},
+		cosmosRoomDocument{ID: room.ID, RoomID: room.ID, Type: "room", Room: room})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("saving room to Cosmos DB returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// Room reads the room document
+func (c *Cosmos) Room(ctx context.Context, id string) (*Room, error) {
+	docLink := c.roomsLink() + "/docs/" + id
+	resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(id)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrRoomNotFound
+	default:
+		return nil, fmt.Errorf("reading room from Cosmos DB returned status %d", resp.StatusCode)
+	}
+	var doc cosmosRoomDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil || doc.Room == nil {
+		return nil, fmt.Errorf("decoding Cosmos DB room %s: %v", id, err)
+	}
+	return doc.Room, nil
+}
+
+// AddMember creates the member document in the room's partition
+func (c *Cosmos) AddMember(ctx context.Context, room *Room, member *Member) (bool, error) {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.roomsLink(), c.roomsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(room.ID)},
+		cosmosRoomDocument{ID: "member:" + member.UserID, RoomID: room.ID, Type: "member", Room: room, Member: member})
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusConflict: // Already a member
+		return false, nil
+	default:
+		return false, fmt.Errorf("saving room member to Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// RemoveMember deletes the member document
+func (c *Cosmos) RemoveMember(ctx context.Context, roomID, userID string) (bool, error) {
+	docLink := c.roomsLink() + "/docs/member:" + userID
+	status, body, err := c.do(ctx, http.MethodDelete, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(roomID)}, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("deleting room member from Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// Members queries the member documents of the room's partition
+func (c *Cosmos) Members(ctx context.Context, roomID string) ([]*Member, error) {
+	query := map[string]interface{}{
+		"query": "SELECT * FROM c WHERE c.roomId = @roomId AND c.type = 'member'",
+		"parameters": []map[string]interface{}{
+			{"name": "@roomId", "value": roomID},
+		},
+	}
+
+	var members []*Member
+	err := c.query(ctx, c.roomsLink(), roomID, query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosRoomDocument
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			if doc.Member != nil {
+				members = append(members, doc.Member)
+			}
+		}
+		return len(members), err
+	})
+	sort.SliceStable(members, func(i, j int) bool { return members[i].JoinedAt.Before(members[j].JoinedAt) })
+	return members, err
+}
+
+// UserRooms queries the user's member documents across rooms
+func (c *Cosmos) UserRooms(ctx context.Context, userID string) ([]*Room, error) {
+	query := map[string]interface{}{
+		"query": "SELECT * FROM c WHERE c.type = 'member' AND c.member.userId = @userId",
+		"parameters": []map[string]interface{}{
+			{"name": "@userId", "value": userID},
+		},
+	}
+
+	var rooms []*Room
+	err := c.query(ctx, c.roomsLink(), "", query, 0, func(documents json.RawMessage) (int, error) {
+		var page []cosmosRoomDocument
+		err := json.Unmarshal(documents, &page)
+		for _, doc := range page {
+			if doc.Room != nil {
+				rooms = append(rooms, doc.Room)
+			}
+		}
+		return len(rooms), err
+	})
+	sort.SliceStable(rooms, func(i, j int) bool { return rooms[i].CreatedAt.Before(rooms[j].CreatedAt) })
+	return rooms, err
+}
+
+// cosmosOnboardingID is the ID of the document marking a user as onboarded, stored in their
+// partition of the reads container. It carries their tenant, so tenant purges remove it.
+const cosmosOnboardingID = "onboarding"
+
+// cosmosOnboarding marks a user as onboarded
+type cosmosOnboarding struct {
+	ID          string    `json:"id"` // cosmosOnboardingID
+	UserID      string    `json:"userId"`
+	TenantID    string    `json:"tenantId,omitempty"`
+	OnboardedAt time.Time `json:"onboardedAt"`
+}
+
+// MarkOnboarded creates the user's onboarding document; only the first call succeeds, later
+// ones conflict with it
+func (c *Cosmos) MarkOnboarded(ctx context.Context, userID, tenantID string) (bool, error) {
+	status, body, err := c.do(ctx, http.MethodPost, "docs", c.readsLink(), c.readsLink()+"/docs",
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(userID)},
+		cosmosOnboarding{ID: cosmosOnboardingID, UserID: userID, TenantID: tenantID, OnboardedAt: time.Now().UTC()})
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		return false, fmt.Errorf("saving onboarding mark to Cosmos DB returned status %d: %s", status, body)
+	}
+}
+
+// cosmosUsageID is the ID of a user's or room's storage usage document, stored in the user's
+// partition of the reads container or the room's partition of the rooms container
+const cosmosUsageID = "usage:storage"
+
+// cosmosUsage is a storage usage document
+type cosmosUsage struct {
+	ID     string `json:"id"` // cosmosUsageID
+	UserID string `json:"userId,omitempty"`
+	RoomID string `json:"roomId,omitempty"`
+	Type   string `json:"type"` // "usage"
+	StorageUsage
+}
+
+// usageDoc returns the container and document of a user's or room's storage usage
+func (c *Cosmos) usageDoc(scope, id string) (string, cosmosUsage) {
+	if scope == UsageScopeRoom {
+		return c.roomsLink(), cosmosUsage{ID: cosmosUsageID, RoomID: id, Type: "usage"}
+	}
+	return c.readsLink(), cosmosUsage{ID: cosmosUsageID, UserID: id, Type: "usage"}
+}
+
+// AddStorageUsage updates the usage document. Like read markers, replaces are conditional on
+// the document's ETag, so concurrent writers on other replicas can't overshoot the limit.
+func (c *Cosmos) AddStorageUsage(ctx context.Context, scope, id string, delta StorageUsage, limit int64) (StorageUsage, bool, error) {
+	collLink, doc := c.usageDoc(scope, id)
+	docLink := collLink + "/docs/" + cosmosUsageID
+	headers := map[string]string{"x-ms-documentdb-partitionkey": partitionKey(id)}
+
+	for attempt := 0; attempt < cosmosUpdateAttempts; attempt++ {
+		current, etag, err := c.storageUsage(ctx, collLink, id)
+		if err != nil {
+			return StorageUsage{}, false, err
+		}
+		usage, added := addUsage(current, delta, limit)
+		if !added {
+			return current, false, nil
+		}
+
+		doc.StorageUsage = usage
+		var status int
+		var body string
+		if etag == "" {
+			status, body, err = c.do(ctx, http.MethodPost, "docs", collLink, collLink+"/docs", headers, doc)
+		} else {
+			status, body, err = c.do(ctx, http.MethodPut, "docs", docLink, docLink,
+				map[string]string{"x-ms-documentdb-partitionkey": partitionKey(id), "If-Match": etag}, doc)
+		}
+		if err != nil {
+			return StorageUsage{}, false, err
+		}
+		switch status {
+		case http.StatusOK, http.StatusCreated:
+			return usage, true, nil
+		case http.StatusConflict, http.StatusPreconditionFailed: // Created or changed since it was read
+			continue
+		default:
+			return StorageUsage{}, false, fmt.Errorf("saving storage usage to Cosmos DB returned status %d: %s", status, body)
+		}
+	}
+	return StorageUsage{}, false, fmt.Errorf("saving storage usage of %s %s in Cosmos DB: too many concurrent updates", scope, id)
+}
+
+// StorageUsage reads the usage document
+func (c *Cosmos) StorageUsage(ctx context.Context, scope, id string) (StorageUsage, error) {
+	collLink, _ := c.usageDoc(scope, id)
+	usage, _, err := c.storageUsage(ctx, collLink, id)
+	return usage, err
+}
+
+// storageUsage reads the usage document in a partition of a container with its ETag, which
+// is empty if the document doesn't exist yet
+func (c *Cosmos) storageUsage(ctx context.Context, collLink, partition string) (StorageUsage, string, error) {
+	docLink := collLink + "/docs/" + cosmosUsageID
+	resp, err := c.request(ctx, http.MethodGet, "docs", docLink, docLink,
+		map[string]string{"x-ms-documentdb-partitionkey": partitionKey(partition)}, nil)
+	if err != nil {
+		return StorageUsage{}, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return StorageUsage{}, "", nil
+	default:
+		return StorageUsage{}, "", fmt.Errorf("reading storage usage from Cosmos DB returned status %d", resp.StatusCode)
+	}
+	var doc struct {
+		cosmosUsage
+		ETag string `json:"_etag"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return StorageUsage{}, "", fmt.Errorf("decoding Cosmos DB storage usage: %w", err)
+	}
+	return doc.StorageUsage, doc.ETag, nil
+}
+
+// Ping reads the containers, for health checks
+func (c *Cosmos) Ping(ctx context.Context) error {
+	for _, name := range []string{c.cfg.Container, c.cfg.RoomsContainer, c.cfg.ReadsContainer} {
+		collLink := "dbs/" + c.cfg.Database + "/colls/" + name
+		status, _, err := c.do(ctx, http.MethodGet, "colls", collLink, collLink, nil, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("reading Cosmos DB container %s returned status %d", name, status)
+		}
+	}
+	return nil
+}
+
+// Backend returns "cosmos"
+func (c *Cosmos) Backend() string {
+	return "cosmos"
+}
+
+// do sends a request and returns the status and (truncated) body
+func (c *Cosmos) do(ctx context.Context, method, resourceType, resourceLink, path string, headers map[string]string, body interface{}) (int, string, error) {
+	resp, err := c.request(ctx, method, resourceType, resourceLink, path, headers, body)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, string(data), nil
+}
+
+// request sends an authorized request for the resource at path
+func (c *Cosmos) request(ctx context.Context, method, resourceType, resourceLink, path string, headers map[string]string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.Endpoint+"/"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	date := time.Now().UTC().Format(http.TimeFormat)
+	auth, err := c.authorization(ctx, method, resourceType, resourceLink, date)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("x-ms-version", cosmosAPIVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	return c.client.Do(req)
+}
+
+// authorization builds the Authorization header: a master key signature, or a managed
+// identity token
+func (c *Cosmos) authorization(ctx context.Context, method, resourceType, resourceLink, date string) (string, error) {
+	if c.key == nil {
+		token, err := c.identity.Token(ctx, cosmosResource)
+		if err != nil {
+			return "", err
+		}
+		return url.QueryEscape("type=aad&ver=1.0&sig=" + token), nil
+	}
+
+	payload := strings.ToLower(method) + "\n" + strings.ToLower(resourceType) + "\n" + resourceLink + "\n" + strings.ToLower(date) + "\n\n"
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return url.QueryEscape("type=master&ver=1.0&sig=" + signature), nil
+}
+
+// partitionKey formats a partition key header value
+func partitionKey(value string) string {
+	data, _ := json.Marshal([]string{value})
+	return string(data)
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Device platforms
+const (
+	PlatformFCM  = "fcm"  // Firebase Cloud Messaging (Android)
+	PlatformAPNs = "apns" // Apple Push Notification service (iOS)
+)
+
+// Device is a mobile device a user registered the push token of
+type Device struct {
+	ID        string    `json:"id"` // Derived from the platform and token, so registering it again replaces it
+	UserID    string    `json:"-"`
+	TenantID  string    `json:"-"`
+	Platform  string    `json:"platform"`
+	Token     string    `json:"-"` // Never returned
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DeviceStore persists each user's mobile devices
+type DeviceStore interface {
+	// SaveDevice adds a device of device.UserID, replacing one with the same ID
+	SaveDevice(ctx context.Context, device *Device) error
+	// DeleteDevice removes a device of the user, reporting false if it wasn't there
+	DeleteDevice(ctx context.Context, userID, id string) (bool, error)
+	// Devices returns the user's devices, oldest first
+	Devices(ctx context.Context, userID string) ([]*Device, error)
+	// TenantDevices returns the devices of the tenant's users by user ID
+	TenantDevices(ctx context.Context, tenantID string) (map[string][]*Device, error)
+	// PurgeTenantDevices deletes the devices of the tenant's users and returns how many were
+	// deleted
+	PurgeTenantDevices(ctx context.Context, tenantID string) (int, error)
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// ErrMessageDeleted is returned when changing a message that was deleted
+var ErrMessageDeleted = errors.New("message was deleted")
+
+// Revision is an earlier version of an edited message
+type Revision struct {
+	Message    *models.MessageContent `json:"message"`
+	ReplacedAt time.Time              `json:"replacedAt"`
+	EditedBy   string                 `json:"editedBy"` // Who replaced it: the sender, or an admin
+}
+
+// EditStore persists message edits and deletions
+type EditStore interface {
+	// EditMessage replaces a message's content, keeping the previous version in its
+	// revisions, and returns the updated message (ErrMessageDeleted for deleted messages)
+	EditMessage(ctx context.Context, msg *Message, content *models.MessageContent, editedBy string, at time.Time) (*Message, error)
+	// DeleteMessage replaces a message with a tombstone: its content, mentions, revisions,
+	// reactions and attachments are dropped, and the message stays in its conversation marked as deleted
+	DeleteMessage(ctx context.Context, msg *Message, deletedBy string, at time.Time) (*Message, error)
+}
+
+// edit applies an edit to msg, which must be a copy the caller owns
+func edit(msg *Message, content *models.MessageContent, editedBy string, at time.Time) error {
+	if msg.DeletedAt != nil {
+		return ErrMessageDeleted
+	}
+	msg.Revisions = append(append([]*Revision(nil), msg.Revisions...), &Revision{Message: msg.Message, ReplacedAt: at, EditedBy: editedBy})
+	msg.Message = content
+	msg.EditedAt = &at
+	return nil
+}
+
+// tombstone turns msg, which must be a copy the caller owns, into a deleted message
+func tombstone(msg *Message, deletedBy string, at time.Time) error {
+	if msg.DeletedAt != nil {
+		return ErrMessageDeleted
+	}
+	msg.Message = nil
+	msg.Mentions = nil
+	msg.Revisions = nil
+	msg.Reactions = nil
+	msg.Attachments = nil
+	msg.DeletedAt = &at
+	msg.DeletedBy = deletedBy
+	return nil
+}
@@ -0,0 +1,946 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// Memory keeps messages and rooms in process memory. They are lost on restart, so it is only
+// suitable for development and single-replica deployments.
+type Memory struct {
+	conversations map[string][]*Message // Conversation ID -> messages, oldest first
+	ids           map[string]*Message
+	rooms         map[string]*Room
+	members       map[string][]*Member                // Room ID -> members, in join order
+	readMarkers   map[string]map[string]time.Time     // User ID -> conversation ID -> read up to
+	readTenants   map[string]string                   // User ID -> tenant of their read markers
+	blocks        map[string][]*Block                 // User ID -> block list, oldest first
+	preferences   map[string]*NotificationPreferences // User ID -> notification preferences
+	push          map[string][]*PushSubscription      // User ID -> push subscriptions, oldest first
+	devices       map[string][]*Device                // User ID -> devices, oldest first
+	tenants       map[string]json.RawMessage          // Tenant ID -> registry record
+	partitions    map[string]string                   // Storage partition -> tenant ID
+	usage         map[string]StorageUsage             // Scope + ":" + user or room ID -> usage
+	onboarded     map[string]string                   // User ID -> tenant, of onboarded users
+	outbox        []*OutboxEntry                      // Oldest first; nil unless enabled
+	outboxOn      bool
+	outboxSeq     int64
+	mu            sync.RWMutex
+}
+
+// NewMemory creates an in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		conversations: make(map[string][]*Message),
+		ids:           make(map[string]*Message),
+		rooms:         make(map[string]*Room),
+		members:       make(map[string][]*Member),
+		readMarkers:   make(map[string]map[string]time.Time),
+		readTenants:   make(map[string]string),
+		blocks:        make(map[string][]*Block),
+		preferences:   make(map[string]*NotificationPreferences),
+		push:          make(map[string][]*PushSubscription),
+		devices:       make(map[string][]*Device),
+		tenants:       make(map[string]json.RawMessage),
+		partitions:    make(map[string]string),
+		usage:         make(map[string]StorageUsage),
+		onboarded:     make(map[string]string),
+	}
+}
+
+// SaveMessage persists a message
+func (m *Memory) SaveMessage(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ids[msg.ID]; ok {
+		return nil
+	}
+	m.ids[msg.ID] = msg
+
+	messages := m.conversations[msg.ConversationID]
+	i := sort.Search(len(messages), func(i int) bool { return messages[i].CreatedAt.After(msg.CreatedAt) })
+	messages = append(messages, nil)
+	copy(messages[i+1:], messages[i:])
+	messages[i] = msg
+	m.conversations[msg.ConversationID] = messages
+
+	if m.outboxOn {
+		m.outboxSeq++
+		saved := *msg
+		m.outbox = append(m.outbox, &OutboxEntry{Seq: m.outboxSeq, Message: &saved, CreatedAt: time.Now().UTC()})
+	}
+	return nil
+}
+
+// EnableOutbox records saved messages in the outbox
+func (m *Memory) EnableOutbox() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outboxOn = true
+}
+
+// PendingOutbox returns the oldest outbox entries
+func (m *Memory) PendingOutbox(ctx context.Context, limit int) ([]*OutboxEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := m.outbox[:min(limit, len(m.outbox))]
+	return append([]*OutboxEntry(nil), entries...), nil
+}
+
+// DeleteOutbox removes outbox entries
+func (m *Memory) DeleteOutbox(ctx context.Context, seqs []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	published := make(map[int64]bool, len(seqs))
+	for _, seq := range seqs {
+		published[seq] = true
+	}
+	remaining := make([]*OutboxEntry, 0, len(m.outbox))
+	for _, entry := range m.outbox {
+		if !published[entry.Seq] {
+			remaining = append(remaining, entry)
+		}
+	}
+	m.outbox = remaining
+	return nil
+}
+
+// OutboxBacklog counts the outbox entries
+func (m *Memory) OutboxBacklog(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.outbox), nil
+}
+
+// Messages returns a conversation's messages created before the given time, newest first
+func (m *Memory) Messages(ctx context.Context, conversationID string, before time.Time, limit int) ([]*Message, error) {
+	return m.page(conversationID, "", before, limit), nil
+}
+
+// Message returns a message by ID
+func (m *Memory) Message(ctx context.Context, id string) (*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	msg, ok := m.ids[id]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+// Replies returns the replies in a thread created before the given time, newest first
+func (m *Memory) Replies(ctx context.Context, conversationID, parentID string, before time.Time, limit int) ([]*Message, error) {
+	return m.page(conversationID, parentID, before, limit), nil
+}
+
+// ConversationMessages returns a conversation's messages and replies created after the given
+// time, oldest first
+func (m *Memory) ConversationMessages(ctx context.Context, conversationID string, after time.Time, limit int) ([]*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var page []*Message
+	for _, msg := range m.conversations[conversationID] {
+		if len(page) == limit {
+			break
+		}
+		if msg.CreatedAt.After(after) {
+			page = append(page, msg)
+		}
+	}
+	return page, nil
+}
+
+// page returns a conversation's messages with the given parent ("" for messages outside
+// threads) created before the given time, newest first
+func (m *Memory) page(conversationID, parentID string, before time.Time, limit int) []*Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var page []*Message
+	messages := m.conversations[conversationID]
+	for i := len(messages) - 1; i >= 0 && len(page) < limit; i-- {
+		if messages[i].ParentID == parentID && (before.IsZero() || messages[i].CreatedAt.Before(before)) {
+			page = append(page, messages[i])
+		}
+	}
+	return page
+}
+
+// ScanMessages calls each with the messages created before the given time. The messages
+// are collected first, so each may purge them.
+func (m *Memory) ScanMessages(ctx context.Context, before time.Time, each func(msg *Message) error) error {
+	m.mu.RLock()
+	var old []*Message
+	for _, messages := range m.conversations {
+		for _, msg := range messages {
+			if !msg.CreatedAt.Before(before) {
+				break // Conversations are kept oldest first
+			}
+			old = append(old, msg)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, msg := range old {
+		if err := each(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeMessages removes messages from their conversations
+func (m *Memory) PurgeMessages(ctx context.Context, msgs []*Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range msgs {
+		m.remove(msg.ID)
+	}
+	return nil
+}
+
+// remove removes a message from its conversation, reporting false if it wasn't saved. The
+// caller holds the write lock.
+func (m *Memory) remove(id string) bool {
+	existing, ok := m.ids[id]
+	if !ok {
+		return false
+	}
+	delete(m.ids, id)
+	messages := m.conversations[existing.ConversationID]
+	for i, candidate := range messages {
+		if candidate == existing {
+			messages = append(messages[:i:i], messages[i+1:]...)
+			break
+		}
+	}
+	if len(messages) == 0 {
+		delete(m.conversations, existing.ConversationID)
+	} else {
+		m.conversations[existing.ConversationID] = messages
+	}
+	return true
+}
+
+// AddReaction records a reaction to a message
+func (m *Memory) AddReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error) {
+	var added bool
+	updated, err := m.update(msg.ID, func(msg *Message) (bool, error) {
+		msg.Reactions, added = withReaction(msg.Reactions, emoji, userID)
+		return added, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return updated.Reactions, added, nil
+}
+
+// RemoveReaction removes a reaction to a message
+func (m *Memory) RemoveReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error) {
+	var removed bool
+	updated, err := m.update(msg.ID, func(msg *Message) (bool, error) {
+		msg.Reactions, removed = withoutReaction(msg.Reactions, emoji, userID)
+		return removed, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return updated.Reactions, removed, nil
+}
+
+// EditMessage replaces a message's content
+func (m *Memory) EditMessage(ctx context.Context, msg *Message, content *models.MessageContent, editedBy string, at time.Time) (*Message, error) {
+	return m.update(msg.ID, func(msg *Message) (bool, error) {
+		return true, edit(msg, content, editedBy, at)
+	})
+}
+
+// DeleteMessage replaces a message with a tombstone
+func (m *Memory) DeleteMessage(ctx context.Context, msg *Message, deletedBy string, at time.Time) (*Message, error) {
+	return m.update(msg.ID, func(msg *Message) (bool, error) {
+		return true, tombstone(msg, deletedBy, at)
+	})
+}
+
+// AddAttachment attaches a file to a message
+func (m *Memory) AddAttachment(ctx context.Context, msg *Message, attachment *Attachment) (*Message, bool, error) {
+	var added bool
+	updated, err := m.update(msg.ID, func(msg *Message) (bool, error) {
+		var err error
+		added, err = attach(msg, attachment)
+		return added, err
+	})
+	return updated, added, err
+}
+
+// SetThumbnails records the thumbnails of an attachment
+func (m *Memory) SetThumbnails(ctx context.Context, msg *Message, attachmentID string, thumbnails []*Thumbnail) (*Message, error) {
+	return m.update(msg.ID, func(msg *Message) (bool, error) {
+		return true, withThumbnails(msg, attachmentID, thumbnails)
+	})
+}
+
+// update applies change to a copy of a message and, if it reports a change, stores the copy
+// in its place. Messages handed out earlier may still be read, so they're never modified.
+func (m *Memory) update(id string, change func(msg *Message) (bool, error)) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg, ok := m.ids[id]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	updated := *msg
+	changed, err := change(&updated)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return msg, nil
+	}
+
+	m.ids[id] = &updated
+	for i, existing := range m.conversations[msg.ConversationID] {
+		if existing == msg {
+			m.conversations[msg.ConversationID][i] = &updated
+			break
+		}
+	}
+	return &updated, nil
+}
+
+// DirectConversations returns the direct conversations the user has messages in
+func (m *Memory) DirectConversations(ctx context.Context, userID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []string
+	for id, messages := range m.conversations {
+		if msg := messages[0]; msg.RecipientID != "" && (msg.SenderID == userID || msg.RecipientID == userID) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// CountUnread counts a conversation's messages from others after the given time
+func (m *Memory) CountUnread(ctx context.Context, conversationID, userID string, after time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, msg := range m.conversations[conversationID] {
+		if msg.ParentID == "" && msg.DeletedAt == nil && msg.SenderID != userID && msg.CreatedAt.After(after) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MarkRead moves the user's read marker for a conversation forward
+func (m *Memory) MarkRead(ctx context.Context, userID, tenantID, conversationID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	markers, ok := m.readMarkers[userID]
+	if !ok {
+		markers = make(map[string]time.Time)
+		m.readMarkers[userID] = markers
+	}
+	m.readTenants[userID] = tenantID
+	if at.After(markers[conversationID]) {
+		markers[conversationID] = at
+	}
+	return nil
+}
+
+// ReadMarkers returns a copy of the user's read markers
+func (m *Memory) ReadMarkers(ctx context.Context, userID string) (map[string]time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	markers := make(map[string]time.Time, len(m.readMarkers[userID]))
+	for id, at := range m.readMarkers[userID] {
+		markers[id] = at
+	}
+	return markers, nil
+}
+
+// SaveBlock adds or replaces an entry of the user's block list
+func (m *Memory) SaveBlock(ctx context.Context, block *Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *block
+	blocks := m.blocks[block.UserID]
+	for i, existing := range blocks {
+		if existing.BlockedID == block.BlockedID {
+			if existing.Kind != block.Kind {
+				blocks[i] = &saved
+			}
+			return nil
+		}
+	}
+	m.blocks[block.UserID] = append(blocks, &saved)
+	return nil
+}
+
+// DeleteBlock removes an entry of the user's block list
+func (m *Memory) DeleteBlock(ctx context.Context, userID, blockedID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blocks := m.blocks[userID]
+	for i, existing := range blocks {
+		if existing.BlockedID == blockedID {
+			m.blocks[userID] = append(blocks[:i:i], blocks[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Block returns a copy of the user's entry for blockedID
+func (m *Memory) Block(ctx context.Context, userID, blockedID string) (*Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, existing := range m.blocks[userID] {
+		if existing.BlockedID == blockedID {
+			block := *existing
+			return &block, nil
+		}
+	}
+	return nil, ErrBlockNotFound
+}
+
+// Blocks returns a copy of the user's block list
+func (m *Memory) Blocks(ctx context.Context, userID string) ([]*Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	blocks := make([]*Block, len(m.blocks[userID]))
+	for i, existing := range m.blocks[userID] {
+		block := *existing
+		blocks[i] = &block
+	}
+	return blocks, nil
+}
+
+// SaveNotificationPreferences replaces the user's notification preferences
+func (m *Memory) SaveNotificationPreferences(ctx context.Context, prefs *NotificationPreferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.preferences[prefs.UserID] = copyPreferences(prefs)
+	return nil
+}
+
+// NotificationPreferences returns a copy of the user's notification preferences
+func (m *Memory) NotificationPreferences(ctx context.Context, userID string) (*NotificationPreferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if saved, ok := m.preferences[userID]; ok {
+		return copyPreferences(saved), nil
+	}
+	return DefaultNotificationPreferences(userID), nil
+}
+
+// copyPreferences returns a deep copy of notification preferences
+func copyPreferences(prefs *NotificationPreferences) *NotificationPreferences {
+	copied := *prefs
+	if prefs.QuietHours != nil {
+		quietHours := *prefs.QuietHours
+		copied.QuietHours = &quietHours
+	}
+	if prefs.Events != nil {
+		copied.Events = make(map[string]bool, len(prefs.Events))
+		for event, notify := range prefs.Events {
+			copied.Events[event] = notify
+		}
+	}
+	return &copied
+}
+
+// SavePushSubscription adds or replaces a push subscription of the user
+func (m *Memory) SavePushSubscription(ctx context.Context, sub *PushSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *sub
+	subs := m.push[sub.UserID]
+	for i, existing := range subs {
+		if existing.ID == sub.ID {
+			subs[i] = &saved
+			return nil
+		}
+	}
+	m.push[sub.UserID] = append(subs, &saved)
+	return nil
+}
+
+// DeletePushSubscription removes a push subscription of the user
+func (m *Memory) DeletePushSubscription(ctx context.Context, userID, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := m.push[userID]
+	for i, existing := range subs {
+		if existing.ID == id {
+			m.push[userID] = append(subs[:i:i], subs[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PushSubscriptions returns copies of the user's push subscriptions
+func (m *Memory) PushSubscriptions(ctx context.Context, userID string) ([]*PushSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subs := make([]*PushSubscription, len(m.push[userID]))
+	for i, existing := range m.push[userID] {
+		sub := *existing
+		subs[i] = &sub
+	}
+	return subs, nil
+}
+
+// TenantPushSubscriptions returns copies of the push subscriptions of the tenant's users
+func (m *Memory) TenantPushSubscriptions(ctx context.Context, tenantID string) (map[string][]*PushSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subs := make(map[string][]*PushSubscription)
+	for userID, existing := range m.push {
+		for _, s := range existing {
+			if s.TenantID == tenantID {
+				sub := *s
+				subs[userID] = append(subs[userID], &sub)
+			}
+		}
+	}
+	return subs, nil
+}
+
+// PurgeTenantPushSubscriptions removes the push subscriptions of the tenant's users
+func (m *Memory) PurgeTenantPushSubscriptions(ctx context.Context, tenantID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for userID, existing := range m.push {
+		kept := existing[:0:0]
+		for _, s := range existing {
+			if s.TenantID != tenantID {
+				kept = append(kept, s)
+			}
+		}
+		purged += len(existing) - len(kept)
+		m.push[userID] = kept
+	}
+	return purged, nil
+}
+
+// SaveDevice adds or replaces a device of the user
+func (m *Memory) SaveDevice(ctx context.Context, device *Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *device
+	devices := m.devices[device.UserID]
+	for i, existing := range devices {
+		if existing.ID == device.ID {
+			devices[i] = &saved
+			return nil
+		}
+	}
+	m.devices[device.UserID] = append(devices, &saved)
+	return nil
+}
+
+// DeleteDevice removes a device of the user
+func (m *Memory) DeleteDevice(ctx context.Context, userID, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices := m.devices[userID]
+	for i, existing := range devices {
+		if existing.ID == id {
+			m.devices[userID] = append(devices[:i:i], devices[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Devices returns copies of the user's devices
+func (m *Memory) Devices(ctx context.Context, userID string) ([]*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]*Device, len(m.devices[userID]))
+	for i, existing := range m.devices[userID] {
+		device := *existing
+		devices[i] = &device
+	}
+	return devices, nil
+}
+
+// TenantDevices returns copies of the devices of the tenant's users
+func (m *Memory) TenantDevices(ctx context.Context, tenantID string) (map[string][]*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make(map[string][]*Device)
+	for userID, existing := range m.devices {
+		for _, d := range existing {
+			if d.TenantID == tenantID {
+				device := *d
+				devices[userID] = append(devices[userID], &device)
+			}
+		}
+	}
+	return devices, nil
+}
+
+// PurgeTenantDevices removes the devices of the tenant's users
+func (m *Memory) PurgeTenantDevices(ctx context.Context, tenantID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for userID, existing := range m.devices {
+		kept := existing[:0:0]
+		for _, d := range existing {
+			if d.TenantID != tenantID {
+				kept = append(kept, d)
+			}
+		}
+		purged += len(existing) - len(kept)
+		m.devices[userID] = kept
+	}
+	return purged, nil
+}
+
+// ProvisionTenant claims the storage partition for the tenant
+func (m *Memory) ProvisionTenant(ctx context.Context, tenantID, partition string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if holder, ok := m.partitions[partition]; ok && holder != tenantID {
+		return ErrPartitionClaimed
+	}
+	m.partitions[partition] = tenantID
+	return nil
+}
+
+// SaveTenant stores a copy of the tenant's record
+func (m *Memory) SaveTenant(ctx context.Context, tenantID, partition string, record json.RawMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.partitions[partition] = tenantID
+	m.tenants[tenantID] = append(json.RawMessage(nil), record...)
+	return nil
+}
+
+// Tenants returns copies of the stored records, ordered by tenant ID
+func (m *Memory) Tenants(ctx context.Context) ([]json.RawMessage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.tenants))
+	for id := range m.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	records := make([]json.RawMessage, len(ids))
+	for i, id := range ids {
+		records[i] = append(json.RawMessage(nil), m.tenants[id]...)
+	}
+	return records, nil
+}
+
+// ExportTenant returns copies of the tenant's data
+func (m *Memory) ExportTenant(ctx context.Context, tenantID string) (*TenantData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data := &TenantData{
+		Messages:    []*Message{},
+		Rooms:       []*TenantRoom{},
+		ReadMarkers: make(map[string]map[string]time.Time),
+		Blocks:      make(map[string][]*Block),
+		Preferences: make(map[string]*NotificationPreferences),
+	}
+	for _, msg := range m.ids {
+		if msg.TenantID == tenantID {
+			saved := *msg
+			data.Messages = append(data.Messages, &saved)
+		}
+	}
+	sort.Slice(data.Messages, func(i, j int) bool { return data.Messages[i].CreatedAt.Before(data.Messages[j].CreatedAt) })
+	for id, room := range m.rooms {
+		if room.TenantID == tenantID {
+			data.Rooms = append(data.Rooms, &TenantRoom{Room: room, Members: append([]*Member{}, m.members[id]...)})
+		}
+	}
+	sort.Slice(data.Rooms, func(i, j int) bool { return data.Rooms[i].CreatedAt.Before(data.Rooms[j].CreatedAt) })
+	for userID, markers := range m.readMarkers {
+		if m.readTenants[userID] != tenantID {
+			continue
+		}
+		data.ReadMarkers[userID] = make(map[string]time.Time, len(markers))
+		for id, at := range markers {
+			data.ReadMarkers[userID][id] = at
+		}
+	}
+	for userID, blocks := range m.blocks {
+		for _, existing := range blocks {
+			if existing.TenantID == tenantID {
+				block := *existing
+				data.Blocks[userID] = append(data.Blocks[userID], &block)
+			}
+		}
+	}
+	for userID, prefs := range m.preferences {
+		if prefs.TenantID == tenantID {
+			data.Preferences[userID] = copyPreferences(prefs)
+		}
+	}
+	return data, nil
+}
+
+// PurgeTenant removes the tenant's messages (and their outbox entries), rooms, and the read
+// markers, block lists, notification preferences and onboarding marks of its users
+func (m *Memory) PurgeTenant(ctx context.Context, tenantID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, msg := range m.ids {
+		if msg.TenantID == tenantID && m.remove(id) {
+			purged++
+		}
+	}
+	outbox := m.outbox[:0:0]
+	for _, entry := range m.outbox {
+		if entry.Message.TenantID != tenantID {
+			outbox = append(outbox, entry)
+		}
+	}
+	purged += len(m.outbox) - len(outbox)
+	m.outbox = outbox
+	for id, room := range m.rooms {
+		if room.TenantID == tenantID {
+			purged += 1 + len(m.members[id])
+			delete(m.rooms, id)
+			delete(m.members, id)
+		}
+	}
+	for userID, tenant := range m.readTenants {
+		if tenant == tenantID {
+			purged += len(m.readMarkers[userID])
+			delete(m.readMarkers, userID)
+			delete(m.readTenants, userID)
+		}
+	}
+	for userID, blocks := range m.blocks {
+		kept := blocks[:0:0]
+		for _, block := range blocks {
+			if block.TenantID != tenantID {
+				kept = append(kept, block)
+			}
+		}
+		purged += len(blocks) - len(kept)
+		m.blocks[userID] = kept
+	}
+	for userID, prefs := range m.preferences {
+		if prefs.TenantID == tenantID {
+			purged++
+			delete(m.preferences, userID)
+		}
+	}
+	for userID, tenant := range m.onboarded {
+		if tenant == tenantID {
+			purged++
+			delete(m.onboarded, userID)
+		}
+	}
+	return purged, nil
+}
+
+// CountTenant counts what PurgeTenant would remove
+func (m *Memory) CountTenant(ctx context.Context, tenantID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, msg := range m.ids {
+		if msg.TenantID == tenantID {
+			count++
+		}
+	}
+	for _, entry := range m.outbox {
+		if entry.Message.TenantID == tenantID {
+			count++
+		}
+	}
+	for id, room := range m.rooms {
+		if room.TenantID == tenantID {
+			count += 1 + len(m.members[id])
+		}
+	}
+	for userID, tenant := range m.readTenants {
+		if tenant == tenantID {
+			count += len(m.readMarkers[userID])
+		}
+	}
+	for _, blocks := range m.blocks {
+		for _, block := range blocks {
+			if block.TenantID == tenantID {
+				count++
+			}
+		}
+	}
+	for _, prefs := range m.preferences {
+		if prefs.TenantID == tenantID {
+			count++
+		}
+	}
+	for _, tenant := range m.onboarded {
+		if tenant == tenantID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CreateRoom persists a new room
+func (m *Memory) CreateRoom(ctx context.Context, room *Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.rooms[room.ID]; exists {
+		return fmt.Errorf("room %s already exists", room.ID)
+	}
+	m.rooms[room.ID] = room
+	return nil
+}
+
+// Room returns a room
+func (m *Memory) Room(ctx context.Context, id string) (*Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	return room, nil
+}
+
+// AddMember adds a user to a room
+func (m *Memory) AddMember(ctx context.Context, room *Room, member *Member) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.members[room.ID] {
+		if existing.UserID == member.UserID {
+			return false, nil
+		}
+	}
+	m.members[room.ID] = append(m.members[room.ID], member)
+	return true, nil
+}
+
+// RemoveMember removes a user from a room
+func (m *Memory) RemoveMember(ctx context.Context, roomID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := m.members[roomID]
+	for i, member := range members {
+		if member.UserID == userID {
+			m.members[roomID] = append(members[:i:i], members[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Members returns a room's members in the order they joined
+func (m *Memory) Members(ctx context.Context, roomID string) ([]*Member, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Member(nil), m.members[roomID]...), nil
+}
+
+// UserRooms returns the rooms a user has joined, oldest first
+func (m *Memory) UserRooms(ctx context.Context, userID string) ([]*Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []*Room
+	for roomID, members := range m.members {
+		for _, member := range members {
+			if member.UserID == userID {
+				rooms = append(rooms, m.rooms[roomID])
+				break
+			}
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].CreatedAt.Before(rooms[j].CreatedAt) })
+	return rooms, nil
+}
+
+// MarkOnboarded records an onboarded user
+func (m *Memory) MarkOnboarded(ctx context.Context, userID, tenantID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.onboarded[userID]; ok {
+		return false, nil
+	}
+	m.onboarded[userID] = tenantID
+	return true, nil
+}
+
+// AddStorageUsage adds to a user's or room's usage counters
+func (m *Memory) AddStorageUsage(ctx context.Context, scope, id string, delta StorageUsage, limit int64) (StorageUsage, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, added := addUsage(m.usage[scope+":"+id], delta, limit)
+	if added {
+		m.usage[scope+":"+id] = usage
+	}
+	return usage, added, nil
+}
+
+// StorageUsage returns a user's or room's usage counters
+func (m *Memory) StorageUsage(ctx context.Context, scope, id string) (StorageUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.usage[scope+":"+id], nil
+}
+
+// Backend returns "memory"
+func (m *Memory) Backend() string {
+	return "memory"
+}
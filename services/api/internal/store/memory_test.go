@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"api-service/internal/models"
+)
+
+func TestMemoryKeepsUnknownMessageFields(t *testing.T) {
+	input := fmt.Sprintf(`{"schemaVersion":%d,"text":"hi","poll":{"question":"Lunch?"}}`, models.MessageSchemaVersion+1)
+	var content models.MessageContent
+	if err := json.Unmarshal([]byte(input), &content); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	ctx := context.Background()
+	m := NewMemory()
+	msg := &Message{
+		ID:             "m1",
+		ConversationID: ConversationID("u1", "u2"),
+		SenderID:       "u1",
+		RecipientID:    "u2",
+		TenantID:       "t1",
+		Message:        &content,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := m.SaveMessage(ctx, msg); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+
+	saved, err := m.Message(ctx, "m1")
+	if err != nil {
+		t.Fatalf("Message: %v", err)
+	}
+	history, err := m.Messages(ctx, msg.ConversationID, time.Time{}, 10)
+	if err != nil {
+		t.Fatalf("Messages: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Messages returned %d messages, want 1", len(history))
+	}
+
+	for name, got := range map[string]*Message{"Message": saved, "Messages": history[0]} {
+		if got.Message == nil {
+			t.Fatalf("%s lost the message body", name)
+		}
+		output, err := json.Marshal(got.Message)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var want, have interface{}
+		if err := json.Unmarshal([]byte(input), &want); err != nil {
+			t.Fatalf("invalid JSON %s: %v", input, err)
+		}
+		if err := json.Unmarshal(output, &have); err != nil {
+			t.Fatalf("invalid JSON %s: %v", output, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%s returned %s, want %s", name, output, input)
+		}
+	}
+}
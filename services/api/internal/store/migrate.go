@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrations holds the schema migrations, named like golang-migrate's
+// ({version}_{title}.up.sql, with .down.sql for the migrate CLI)
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// migrationLockID is the advisory lock key held while migrating
+const migrationLockID = 0x6170692d73746f72 // "api-stor"
+
+// migration is one embedded up migration
+type migration struct {
+	version int64
+	name    string
+}
+
+// migratePostgres applies pending migrations at startup. Replicas starting together serialize
+// on a session advisory lock, so each migration runs once. Progress is recorded in the
+// schema_migrations table in golang-migrate's format, so its CLI can be used on the database.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	migrations, err := listMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1::bigint)", int64(migrationLockID)); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1::bigint)", int64(migrationLockID))
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)"); err != nil {
+		return err
+	}
+
+	var current int64
+	var dirty bool
+	err = conn.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&current, &dirty)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database schema is dirty at version %d; fix it and clear the flag in schema_migrations", current)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		script, err := postgresMigrations.ReadFile(path.Join("migrations/postgres", m.name))
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM schema_migrations"); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)", m.version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		log.Printf("🗄️  Applied migration %s", m.name)
+	}
+	return nil
+}
+
+// listMigrations returns the embedded up migrations in version order
+func listMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version prefix", name)
+		}
+		migrations = append(migrations, migration{version: version, name: name})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
@@ -0,0 +1,12 @@
+CREATE TABLE messages (
+    id              text        PRIMARY KEY,
+    conversation_id text        NOT NULL,
+    sender_id       text        NOT NULL,
+    sender_name     text        NOT NULL,
+    recipient_id    text        NOT NULL,
+    tenant_id       text        NOT NULL,
+    message         jsonb       NOT NULL,
+    created_at      timestamptz NOT NULL
+);
+
+CREATE INDEX messages_conversation_created_at_idx ON messages (conversation_id, created_at DESC);
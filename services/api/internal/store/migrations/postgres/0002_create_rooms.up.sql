@@ -0,0 +1,18 @@
+CREATE TABLE rooms (
+    id         text        PRIMARY KEY,
+    name       text        NOT NULL,
+    tenant_id  text        NOT NULL,
+    created_by text        NOT NULL,
+    created_at timestamptz NOT NULL
+);
+
+CREATE TABLE room_members (
+    room_id   text        NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id   text        NOT NULL,
+    name      text        NOT NULL,
+    email     text        NOT NULL,
+    joined_at timestamptz NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX room_members_user_id_idx ON room_members (user_id);
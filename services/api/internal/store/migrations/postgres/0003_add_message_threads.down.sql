@@ -0,0 +1,2 @@
+DROP INDEX messages_thread_created_at_idx;
+ALTER TABLE messages DROP COLUMN parent_id;
@@ -0,0 +1,3 @@
+ALTER TABLE messages ADD COLUMN parent_id text NOT NULL DEFAULT '';
+
+CREATE INDEX messages_thread_created_at_idx ON messages (conversation_id, parent_id, created_at DESC);
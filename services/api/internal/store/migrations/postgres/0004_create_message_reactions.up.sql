@@ -0,0 +1,7 @@
+CREATE TABLE message_reactions (
+    message_id text        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    emoji      text        NOT NULL,
+    user_id    text        NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (message_id, emoji, user_id)
+);
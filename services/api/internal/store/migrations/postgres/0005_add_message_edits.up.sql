@@ -0,0 +1,11 @@
+ALTER TABLE messages ADD COLUMN edited_at timestamptz;
+ALTER TABLE messages ADD COLUMN deleted_at timestamptz;
+ALTER TABLE messages ADD COLUMN deleted_by text NOT NULL DEFAULT '';
+
+CREATE TABLE message_revisions (
+    message_id  text        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    message     jsonb       NOT NULL,
+    replaced_at timestamptz NOT NULL,
+    edited_by   text        NOT NULL,
+    PRIMARY KEY (message_id, replaced_at)
+);
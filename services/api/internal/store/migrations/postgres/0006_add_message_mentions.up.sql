@@ -0,0 +1 @@
+ALTER TABLE messages ADD COLUMN mentions jsonb NOT NULL DEFAULT '[]';
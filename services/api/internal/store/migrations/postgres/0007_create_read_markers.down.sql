@@ -0,0 +1,3 @@
+DROP INDEX messages_recipient_idx;
+DROP INDEX messages_sender_idx;
+DROP TABLE read_markers;
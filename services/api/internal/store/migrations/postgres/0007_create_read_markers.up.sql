@@ -0,0 +1,9 @@
+CREATE TABLE read_markers (
+    user_id         text        NOT NULL,
+    conversation_id text        NOT NULL,
+    read_at         timestamptz NOT NULL,
+    PRIMARY KEY (user_id, conversation_id)
+);
+
+CREATE INDEX messages_sender_idx ON messages (sender_id);
+CREATE INDEX messages_recipient_idx ON messages (recipient_id);
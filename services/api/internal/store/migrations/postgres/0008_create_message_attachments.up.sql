@@ -0,0 +1,9 @@
+CREATE TABLE message_attachments (
+    message_id   text        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    id           text        NOT NULL,
+    file_name    text        NOT NULL,
+    content_type text        NOT NULL,
+    size         bigint      NOT NULL,
+    created_at   timestamptz NOT NULL,
+    PRIMARY KEY (message_id, id)
+);
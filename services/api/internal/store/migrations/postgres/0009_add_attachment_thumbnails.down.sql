@@ -0,0 +1 @@
+ALTER TABLE message_attachments DROP COLUMN thumbnails;
@@ -0,0 +1 @@
+ALTER TABLE message_attachments ADD COLUMN thumbnails jsonb NOT NULL DEFAULT '[]';
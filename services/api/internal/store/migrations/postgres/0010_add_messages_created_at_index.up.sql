@@ -0,0 +1 @@
+CREATE INDEX messages_created_at_idx ON messages (created_at, id);
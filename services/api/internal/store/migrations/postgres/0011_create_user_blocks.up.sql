@@ -0,0 +1,7 @@
+CREATE TABLE user_blocks (
+    user_id    text        NOT NULL,
+    blocked_id text        NOT NULL,
+    kind       text        NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (user_id, blocked_id)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE notification_preferences (
+    user_id       text        NOT NULL PRIMARY KEY,
+    teams         boolean     NOT NULL DEFAULT false,
+    teams_chat_id text        NOT NULL DEFAULT '',
+    updated_at    timestamptz NOT NULL
+);
@@ -0,0 +1,10 @@
+CREATE TABLE push_subscriptions (
+    user_id    text        NOT NULL,
+    id         text        NOT NULL,
+    endpoint   text        NOT NULL,
+    p256dh     text        NOT NULL,
+    auth       text        NOT NULL,
+    user_agent text        NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (user_id, id)
+);
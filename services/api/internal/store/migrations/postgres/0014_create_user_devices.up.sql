@@ -0,0 +1,9 @@
+CREATE TABLE user_devices (
+    user_id    text        NOT NULL,
+    id         text        NOT NULL,
+    platform   text        NOT NULL,
+    token      text        NOT NULL,
+    name       text        NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (user_id, id)
+);
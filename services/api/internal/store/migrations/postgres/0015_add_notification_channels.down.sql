@@ -0,0 +1,5 @@
+ALTER TABLE notification_preferences
+    DROP COLUMN push,
+    DROP COLUMN email,
+    DROP COLUMN quiet_hours,
+    DROP COLUMN events;
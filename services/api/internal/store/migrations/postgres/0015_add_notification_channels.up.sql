@@ -0,0 +1,5 @@
+ALTER TABLE notification_preferences
+    ADD COLUMN push        boolean NOT NULL DEFAULT true,
+    ADD COLUMN email       boolean NOT NULL DEFAULT false,
+    ADD COLUMN quiet_hours jsonb,
+    ADD COLUMN events      jsonb   NOT NULL DEFAULT '{}';
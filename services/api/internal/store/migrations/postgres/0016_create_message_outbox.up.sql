@@ -0,0 +1,6 @@
+CREATE TABLE message_outbox (
+    seq        bigserial   PRIMARY KEY,
+    message_id text        NOT NULL,
+    message    jsonb       NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+CREATE TABLE tenants (
+    id                text        PRIMARY KEY,
+    storage_partition text        NOT NULL UNIQUE,
+    record            jsonb,
+    updated_at        timestamptz NOT NULL DEFAULT now()
+);
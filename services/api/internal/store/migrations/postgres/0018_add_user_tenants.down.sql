@@ -0,0 +1,8 @@
+ALTER TABLE read_markers DROP COLUMN tenant_id;
+ALTER TABLE user_blocks DROP COLUMN tenant_id;
+ALTER TABLE notification_preferences DROP COLUMN tenant_id;
+ALTER TABLE push_subscriptions DROP COLUMN tenant_id;
+ALTER TABLE user_devices DROP COLUMN tenant_id;
+
+DROP INDEX messages_tenant_idx;
+DROP INDEX rooms_tenant_idx;
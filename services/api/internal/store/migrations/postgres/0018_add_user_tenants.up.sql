@@ -0,0 +1,23 @@
+ALTER TABLE read_markers ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE user_blocks ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE notification_preferences ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE push_subscriptions ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE user_devices ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+
+-- Attribute existing rows to the tenant their user last sent a message from
+CREATE TEMPORARY TABLE user_tenants ON COMMIT DROP AS
+    SELECT DISTINCT ON (sender_id) sender_id AS user_id, tenant_id FROM messages ORDER BY sender_id, created_at DESC;
+
+UPDATE read_markers t SET tenant_id = u.tenant_id FROM user_tenants u WHERE u.user_id = t.user_id;
+UPDATE user_blocks t SET tenant_id = u.tenant_id FROM user_tenants u WHERE u.user_id = t.user_id;
+UPDATE notification_preferences t SET tenant_id = u.tenant_id FROM user_tenants u WHERE u.user_id = t.user_id;
+UPDATE push_subscriptions t SET tenant_id = u.tenant_id FROM user_tenants u WHERE u.user_id = t.user_id;
+UPDATE user_devices t SET tenant_id = u.tenant_id FROM user_tenants u WHERE u.user_id = t.user_id;
+
+CREATE INDEX read_markers_tenant_idx ON read_markers (tenant_id);
+CREATE INDEX user_blocks_tenant_idx ON user_blocks (tenant_id);
+CREATE INDEX notification_preferences_tenant_idx ON notification_preferences (tenant_id);
+CREATE INDEX push_subscriptions_tenant_idx ON push_subscriptions (tenant_id);
+CREATE INDEX user_devices_tenant_idx ON user_devices (tenant_id);
+CREATE INDEX messages_tenant_idx ON messages (tenant_id);
+CREATE INDEX rooms_tenant_idx ON rooms (tenant_id);
@@ -0,0 +1,24 @@
+CREATE TABLE storage_usage (
+    scope            text   NOT NULL,
+    id               text   NOT NULL,
+    message_bytes    bigint NOT NULL DEFAULT 0,
+    attachment_bytes bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, id)
+);
+
+-- Seed the counters from the messages stored so far. Contents are measured as jsonb text,
+-- which is a little longer than the encoding the API counts.
+WITH sizes AS (
+    SELECT m.sender_id,
+           m.conversation_id,
+           octet_length(m.message::text)
+               + COALESCE((SELECT SUM(octet_length(r.message::text)) FROM message_revisions r WHERE r.message_id = m.id), 0) AS message_bytes,
+           COALESCE((SELECT SUM(a.size) FROM message_attachments a WHERE a.message_id = m.id), 0) AS attachment_bytes
+    FROM messages m
+    WHERE m.deleted_at IS NULL
+)
+INSERT INTO storage_usage (scope, id, message_bytes, attachment_bytes)
+SELECT 'user', sender_id, SUM(message_bytes), SUM(attachment_bytes) FROM sizes GROUP BY sender_id
+UNION ALL
+SELECT 'room', substr(conversation_id, 6), SUM(message_bytes), SUM(attachment_bytes) FROM sizes
+WHERE conversation_id LIKE 'room:%' GROUP BY conversation_id;
@@ -0,0 +1,7 @@
+CREATE TABLE user_onboarding (
+    user_id      text        PRIMARY KEY,
+    tenant_id    text        NOT NULL,
+    onboarded_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_onboarding_tenant_idx ON user_onboarding (tenant_id);
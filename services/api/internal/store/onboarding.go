@@ -0,0 +1,11 @@
+package store
+
+import "context"
+
+// OnboardingStore records which users have received the onboarding sequence, so it is sent
+// once per user whichever replica they connect to and across restarts
+type OnboardingStore interface {
+	// MarkOnboarded records that a user of tenantID was onboarded, returning true only the
+	// first time it is called for them
+	MarkOnboarded(ctx context.Context, userID, tenantID string) (bool, error)
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// OutboxEntry is a saved message waiting in the outbox to be published
+type OutboxEntry struct {
+	Seq       int64     // Position in the outbox, increasing in save order
+	Message   *Message  // As saved
+	CreatedAt time.Time // When the message was saved
+}
+
+// OutboxStore records each newly saved message in a transactional outbox, written together
+// with the message, so a relay can publish every persisted message even when the process
+// dies right after saving it. The Cosmos DB store has no outbox.
+type OutboxStore interface {
+	// EnableOutbox makes SaveMessage record messages in the outbox. Call it before messages
+	// are saved.
+	EnableOutbox()
+	// PendingOutbox returns up to limit entries not yet published, oldest first
+	PendingOutbox(ctx context.Context, limit int) ([]*OutboxEntry, error)
+	// DeleteOutbox removes published entries
+	DeleteOutbox(ctx context.Context, seqs []int64) error
+	// OutboxBacklog counts the entries not yet published
+	OutboxBacklog(ctx context.Context) (int, error)
+}
@@ -0,0 +1,1238 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"api-service/internal/identity"
+	"api-service/internal/models"
+)
+
+// postgresResource is the token audience for Azure Database for PostgreSQL
+const postgresResource = "https://ossrdbms-aad.database.windows.net"
+
+// Postgres persists messages and rooms in PostgreSQL (e.g. Azure Database for PostgreSQL flexible server)
+type Postgres struct {
+	pool   *pgxpool.Pool
+	outbox bool // Saved messages are recorded in message_outbox
+}
+
+// NewPostgres connects to the database at url (a postgres:// URL or key=value DSN) and
+// applies pending migrations. When mi is set, its Microsoft Entra ID token is used as the
+// password, and url names the Entra user.
+func NewPostgres(ctx context.Context, url string, mi *identity.ManagedIdentity) (*Postgres, error) {
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL URL: %w", err)
+	}
+	if mi != nil {
+		// Tokens expire, so fetch one (cached by the identity) for each new connection
+		cfg.BeforeConnect = func(ctx context.Context, conn *pgx.ConnConfig) error {
+			token, err := mi.Token(ctx, postgresResource)
+			if err != nil {
+				return err
+			}
+			conn.Password = token
+			return nil
+		}
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("connecting to PostgreSQL: %w", err)
+	}
+	if err := migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrating PostgreSQL: %w", err)
+	}
+
+	return &Postgres{
+		pool: pool,
+	}, nil
+}
+
+// messageColumns are the columns scanned by scanMessages, in order
+const messageColumns = "id, conversation_id, sender_id, sender_name, recipient_id, tenant_id, parent_id, message, mentions, created_at, edited_at, deleted_at, deleted_by"
+
+// SaveMessage inserts the message, ignoring IDs already saved
+func (p *Postgres) SaveMessage(ctx context.Context, msg *Message) error {
+	content, err := json.Marshal(msg.Message)
+	if err != nil {
+		return err
+	}
+	mentions := msg.Mentions
+	if mentions == nil {
+		mentions = []*Mention{}
+	}
+	mentioned, err := json.Marshal(mentions)
+	if err != nil {
+		return err
+	}
+
+	if !p.outbox {
+		_, err = p.pool.Exec(ctx, `
+			INSERT INTO messages (id, conversation_id, sender_id, sender_name, recipient_id, tenant_id, parent_id, message, mentions, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (id) DO NOTHING`,
+			msg.ID, msg.ConversationID, msg.SenderID, msg.SenderName, msg.RecipientID, msg.TenantID, msg.ParentID, content, mentioned, msg.CreatedAt)
+		return err
+	}
+
+	// One statement, so the outbox entry is written if and only if the message is
+	snapshot, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, `
+		WITH saved AS (
+			INSERT INTO messages (id, conversation_id, sender_id, sender_name, recipient_id, tenant_id, parent_id, message, mentions, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id
+		)
+		INSERT INTO message_outbox (message_id, message) SELECT id, $11::jsonb FROM saved`,
+		msg.ID, msg.ConversationID, msg.SenderID, msg.SenderName, msg.RecipientID, msg.TenantID, msg.ParentID, content, mentioned, msg.CreatedAt, snapshot)
+	return err
+}
+
+// EnableOutbox records saved messages in message_outbox
+func (p *Postgres) EnableOutbox() {
+	p.outbox = true
+}
+
+// PendingOutbox returns the oldest rows of message_outbox
+func (p *Postgres) PendingOutbox(ctx context.Context, limit int) ([]*OutboxEntry, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT seq, message, created_at FROM message_outbox ORDER BY seq LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		var snapshot []byte
+		if err := rows.Scan(&entry.Seq, &snapshot, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(snapshot, &entry.Message); err != nil {
+			return nil, fmt.Errorf("decoding outbox entry %d: %w", entry.Seq, err)
+		}
+		entry.CreatedAt = entry.CreatedAt.UTC()
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteOutbox removes published rows of message_outbox
+func (p *Postgres) DeleteOutbox(ctx context.Context, seqs []int64) error {
+	// By seq rather than up to the last one: sequence values can commit out of order
+	_, err := p.pool.Exec(ctx, `DELETE FROM message_outbox WHERE seq = ANY($1)`, seqs)
+	return err
+}
+
+// OutboxBacklog counts the rows of message_outbox
+func (p *Postgres) OutboxBacklog(ctx context.Context) (int, error) {
+	var count int
+	err := p.pool.QueryRow(ctx, `SELECT count(*) FROM message_outbox`).Scan(&count)
+	return count, err
+}
+
+// Messages returns a conversation's messages created before the given time, newest first
+func (p *Postgres) Messages(ctx context.Context, conversationID string, before time.Time, limit int) ([]*Message, error) {
+	return p.Replies(ctx, conversationID, "", before, limit)
+}
+
+// Message returns a message by ID
+func (p *Postgres) Message(ctx context.Context, id string) (*Message, error) {
+	messages, err := p.messages(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	return messages[0], nil
+}
+
+// Replies returns the replies in a thread created before the given time, newest first.
+// Messages outside threads have an empty parent_id, so Messages shares the query.
+func (p *Postgres) Replies(ctx context.Context, conversationID, parentID string, before time.Time, limit int) ([]*Message, error) {
+	if before.IsZero() {
+		before = time.Now().Add(time.Hour)
+	}
+
+	return p.messages(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE conversation_id = $1 AND parent_id = $2 AND created_at < $3
+		ORDER BY created_at DESC
+		LIMIT $4`,
+		conversationID, parentID, before, limit)
+}
+
+// ConversationMessages returns a conversation's messages and replies created after the
+// given time, oldest first
+func (p *Postgres) ConversationMessages(ctx context.Context, conversationID string, after time.Time, limit int) ([]*Message, error) {
+	return p.messages(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE conversation_id = $1 AND created_at > $2
+		ORDER BY created_at
+		LIMIT $3`,
+		conversationID, after, limit)
+}
+
+// ScanMessages pages through the messages created before the given time, oldest first
+func (p *Postgres) ScanMessages(ctx context.Context, before time.Time, each func(msg *Message) error) error {
+	var afterTime time.Time
+	var afterID string
+	for {
+		page, err := p.messages(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages
+			WHERE created_at < $1 AND (created_at, id) > ($2, $3)
+			ORDER BY created_at, id
+			LIMIT $4`,
+			before, afterTime, afterID, MaxPageSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range page {
+			if err := each(msg); err != nil {
+				return err
+			}
+		}
+		if len(page) < MaxPageSize {
+			return nil
+		}
+		afterTime, afterID = page[len(page)-1].CreatedAt, page[len(page)-1].ID
+	}
+}
+
+// PurgeMessages deletes messages; their reactions, revisions and attachments cascade
+func (p *Postgres) PurgeMessages(ctx context.Context, msgs []*Message) error {
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	_, err := p.pool.Exec(ctx, `DELETE FROM messages WHERE id = ANY($1)`, ids)
+	return err
+}
+
+// messages runs a query selecting messageColumns and loads the reactions, revisions and
+// attachments of the messages found
+func (p *Postgres) messages(ctx context.Context, query string, args ...interface{}) ([]*Message, error) {
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return messages, err
+	}
+
+	ids := make([]string, len(messages))
+	byID := make(map[string]*Message, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+		byID[msg.ID] = msg
+	}
+	reactions, err := p.reactions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, list := range reactions {
+		byID[id].Reactions = list
+	}
+	revisions, err := p.revisions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, list := range revisions {
+		byID[id].Revisions = list
+	}
+	attachments, err := p.attachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, list := range attachments {
+		byID[id].Attachments = list
+	}
+	return messages, nil
+}
+
+// attachments returns the files attached to the given messages, by message ID, in the order
+// they were attached
+func (p *Postgres) attachments(ctx context.Context, messageIDs []string) (map[string][]*Attachment, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT message_id, id, file_name, content_type, size, thumbnails, created_at FROM message_attachments
+		WHERE message_id = ANY($1)
+		ORDER BY created_at, id`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[string][]*Attachment)
+	for rows.Next() {
+		var messageID string
+		var thumbnails []byte
+		attachment := &Attachment{}
+		if err := rows.Scan(&messageID, &attachment.ID, &attachment.FileName, &attachment.ContentType, &attachment.Size, &thumbnails, &attachment.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(thumbnails, &attachment.Thumbnails); err != nil {
+			return nil, fmt.Errorf("decoding thumbnails of attachment %s: %w", attachment.ID, err)
+		}
+		attachment.CreatedAt = attachment.CreatedAt.UTC()
+		attachments[messageID] = append(attachments[messageID], attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// revisions returns the earlier versions of the given messages, by message ID, oldest first
+func (p *Postgres) revisions(ctx context.Context, messageIDs []string) (map[string][]*Revision, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT message_id, message, replaced_at, edited_by FROM message_revisions
+		WHERE message_id = ANY($1)
+		ORDER BY replaced_at`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make(map[string][]*Revision)
+	for rows.Next() {
+		var messageID string
+		var content []byte
+		revision := &Revision{Message: &models.MessageContent{}}
+		if err := rows.Scan(&messageID, &content, &revision.ReplacedAt, &revision.EditedBy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, revision.Message); err != nil {
+			return nil, fmt.Errorf("decoding revision of message %s: %w", messageID, err)
+		}
+		revision.ReplacedAt = revision.ReplacedAt.UTC()
+		revisions[messageID] = append(revisions[messageID], revision)
+	}
+	return revisions, rows.Err()
+}
+
+// reactions returns the reactions to the given messages, by message ID
+func (p *Postgres) reactions(ctx context.Context, messageIDs []string) (map[string][]*Reaction, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT message_id, emoji, user_id FROM message_reactions
+		WHERE message_id = ANY($1)
+		ORDER BY created_at, user_id`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := make(map[string][]*Reaction)
+	for rows.Next() {
+		var messageID, emoji, userID string
+		if err := rows.Scan(&messageID, &emoji, &userID); err != nil {
+			return nil, err
+		}
+		reactions[messageID], _ = withReaction(reactions[messageID], emoji, userID)
+	}
+	return reactions, rows.Err()
+}
+
+// AddReaction inserts a reaction, ignoring reactions already recorded
+func (p *Postgres) AddReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error) {
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO message_reactions (message_id, emoji, user_id, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, emoji, user_id) DO NOTHING`,
+		msg.ID, emoji, userID, time.Now().UTC())
+	if err != nil {
+		return nil, false, err
+	}
+	reactions, err := p.reactions(ctx, []string{msg.ID})
+	return reactions[msg.ID], tag.RowsAffected() == 1, err
+}
+
+// RemoveReaction deletes a reaction
+func (p *Postgres) RemoveReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error) {
+	tag, err := p.pool.Exec(ctx, `
+		DELETE FROM message_reactions WHERE message_id = $1 AND emoji = $2 AND user_id = $3`,
+		msg.ID, emoji, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	reactions, err := p.reactions(ctx, []string{msg.ID})
+	return reactions[msg.ID], tag.RowsAffected() == 1, err
+}
+
+// EditMessage moves the current content to message_revisions and replaces it. Setting
+// edited_at first locks the row, so concurrent edits each keep the version they replaced.
+func (p *Postgres) EditMessage(ctx context.Context, msg *Message, content *models.MessageContent, editedBy string, at time.Time) (*Message, error) {
+	updated, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE messages SET edited_at = $2 WHERE id = $1 AND deleted_at IS NULL`, msg.ID, at)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return p.unchangeable(ctx, tx, msg.ID)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO message_revisions (message_id, message, replaced_at, edited_by)
+			SELECT id, message, $2, $3 FROM messages WHERE id = $1`,
+			msg.ID, at, editedBy); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE messages SET message = $2 WHERE id = $1`, msg.ID, updated)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.Message(ctx, msg.ID)
+}
+
+// DeleteMessage replaces the message's content with JSON null, marks it deleted and drops
+// its mentions, revisions, reactions and attachments
+func (p *Postgres) DeleteMessage(ctx context.Context, msg *Message, deletedBy string, at time.Time) (*Message, error) {
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE messages SET message = 'null', mentions = '[]', deleted_at = $2, deleted_by = $3
+			WHERE id = $1 AND deleted_at IS NULL`,
+			msg.ID, at, deletedBy)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return p.unchangeable(ctx, tx, msg.ID)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM message_revisions WHERE message_id = $1`, msg.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM message_attachments WHERE message_id = $1`, msg.ID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM message_reactions WHERE message_id = $1`, msg.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.Message(ctx, msg.ID)
+}
+
+// AddAttachment inserts an attachment, ignoring IDs already attached to the message. Touching
+// the message row first locks it, so concurrent attachments can't exceed MaxAttachments.
+func (p *Postgres) AddAttachment(ctx context.Context, msg *Message, attachment *Attachment) (*Message, bool, error) {
+	var added bool
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `UPDATE messages SET deleted_by = deleted_by WHERE id = $1`, msg.ID); err != nil {
+			return err
+		}
+		var deleted bool
+		err := tx.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM messages WHERE id = $1`, msg.ID).Scan(&deleted)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrMessageNotFound
+		case err != nil:
+			return err
+		case deleted:
+			return ErrMessageDeleted
+		}
+
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM message_attachments WHERE message_id = $1 AND id = $2)`,
+			msg.ID, attachment.ID).Scan(&exists); err != nil || exists {
+			return err
+		}
+		var count int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM message_attachments WHERE message_id = $1`, msg.ID).Scan(&count); err != nil {
+			return err
+		}
+		if count >= MaxAttachments {
+			return ErrTooManyAttachments
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO message_attachments (message_id, id, file_name, content_type, size, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			msg.ID, attachment.ID, attachment.FileName, attachment.ContentType, attachment.Size, attachment.CreatedAt)
+		added = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	updated, err := p.Message(ctx, msg.ID)
+	return updated, added, err
+}
+
+// SetThumbnails updates the thumbnails of an attachment
+func (p *Postgres) SetThumbnails(ctx context.Context, msg *Message, attachmentID string, thumbnails []*Thumbnail) (*Message, error) {
+	encoded, err := json.Marshal(thumbnails)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := p.pool.Exec(ctx, `UPDATE message_attachments SET thumbnails = $3 WHERE message_id = $1 AND id = $2`,
+		msg.ID, attachmentID, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := p.Message(ctx, msg.ID)
+	switch {
+	case err != nil:
+		return nil, err
+	case updated.DeletedAt != nil:
+		return nil, ErrMessageDeleted
+	case tag.RowsAffected() == 0 && !hasAttachment(updated, attachmentID):
+		return nil, ErrAttachmentNotFound
+	}
+	return updated, nil
+}
+
+// hasAttachment reports whether msg has an attachment with the ID
+func hasAttachment(msg *Message, id string) bool {
+	for _, attachment := range msg.Attachments {
+		if attachment.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// unchangeable explains why updating a message that isn't deleted matched no row
+func (p *Postgres) unchangeable(ctx context.Context, tx pgx.Tx, id string) error {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrMessageNotFound
+	}
+	return ErrMessageDeleted
+}
+
+// DirectConversations returns the direct conversations the user sent or received messages in
+// (room messages have no recipient)
+func (p *Postgres) DirectConversations(ctx context.Context, userID string) ([]string, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT DISTINCT conversation_id FROM messages
+		WHERE recipient_id <> '' AND (sender_id = $1 OR recipient_id = $1)`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// CountUnread counts a conversation's messages from others after the given time
+func (p *Postgres) CountUnread(ctx context.Context, conversationID, userID string, after time.Time) (int, error) {
+	var count int
+	err := p.pool.QueryRow(ctx, `
+		SELECT count(*) FROM messages
+		WHERE conversation_id = $1 AND parent_id = '' AND deleted_at IS NULL AND sender_id <> $2 AND created_at > $3`,
+		conversationID, userID, after).Scan(&count)
+	return count, err
+}
+
+// MarkRead upserts the user's read marker, keeping the later time
+func (p *Postgres) MarkRead(ctx context.Context, userID, tenantID, conversationID string, at time.Time) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO read_markers (user_id, conversation_id, read_at, tenant_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, conversation_id) DO UPDATE SET read_at = GREATEST(read_markers.read_at, EXCLUDED.read_at), tenant_id = EXCLUDED.tenant_id`,
+		userID, conversationID, at, tenantID)
+	return err
+}
+
+// ReadMarkers returns the user's read markers
+func (p *Postgres) ReadMarkers(ctx context.Context, userID string) (map[string]time.Time, error) {
+	rows, err := p.pool.Query(ctx, `SELECT conversation_id, read_at FROM read_markers WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := make(map[string]time.Time)
+	for rows.Next() {
+		var conversationID string
+		var at time.Time
+		if err := rows.Scan(&conversationID, &at); err != nil {
+			return nil, err
+		}
+		markers[conversationID] = at.UTC()
+	}
+	return markers, rows.Err()
+}
+
+// SaveBlock upserts an entry of the user's block list. Replacing an entry keeps its creation
+// time unless the kind changes.
+func (p *Postgres) SaveBlock(ctx context.Context, block *Block) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO user_blocks (user_id, blocked_id, kind, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, blocked_id) DO UPDATE SET kind = EXCLUDED.kind, created_at = EXCLUDED.created_at, tenant_id = EXCLUDED.tenant_id
+		WHERE user_blocks.kind <> EXCLUDED.kind`,
+		block.UserID, block.BlockedID, string(block.Kind), block.CreatedAt, block.TenantID)
+	return err
+}
+
+// DeleteBlock deletes an entry of the user's block list
+func (p *Postgres) DeleteBlock(ctx context.Context, userID, blockedID string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM user_blocks WHERE user_id = $1 AND blocked_id = $2`, userID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Block returns the user's entry for blockedID
+func (p *Postgres) Block(ctx context.Context, userID, blockedID string) (*Block, error) {
+	block := Block{UserID: userID, BlockedID: blockedID}
+	err := p.pool.QueryRow(ctx, `
+		SELECT kind, created_at FROM user_blocks WHERE user_id = $1 AND blocked_id = $2`, userID, blockedID).
+		Scan(&block.Kind, &block.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrBlockNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	block.CreatedAt = block.CreatedAt.UTC()
+	return &block, nil
+}
+
+// Blocks returns the user's block list, oldest first
+func (p *Postgres) Blocks(ctx context.Context, userID string) ([]*Block, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT blocked_id, kind, created_at FROM user_blocks
+		WHERE user_id = $1
+		ORDER BY created_at, blocked_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*Block
+	for rows.Next() {
+		block := Block{UserID: userID}
+		if err := rows.Scan(&block.BlockedID, &block.Kind, &block.CreatedAt); err != nil {
+			return nil, err
+		}
+		block.CreatedAt = block.CreatedAt.UTC()
+		blocks = append(blocks, &block)
+	}
+	return blocks, rows.Err()
+}
+
+// SaveNotificationPreferences upserts the user's notification preferences
+func (p *Postgres) SaveNotificationPreferences(ctx context.Context, prefs *NotificationPreferences) error {
+	updatedAt := time.Now().UTC()
+	if prefs.UpdatedAt != nil {
+		updatedAt = *prefs.UpdatedAt
+	}
+	var quietHours []byte // NULL when unset
+	if prefs.QuietHours != nil {
+		encoded, err := json.Marshal(prefs.QuietHours)
+		if err != nil {
+			return err
+		}
+		quietHours = encoded
+	}
+	events := prefs.Events
+	if events == nil {
+		events = map[string]bool{}
+	}
+	encodedEvents, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO notification_preferences (user_id, push, email, teams, teams_chat_id, quiet_hours, events, updated_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id) DO UPDATE SET push = EXCLUDED.push, email = EXCLUDED.email, teams = EXCLUDED.teams, teams_chat_id = EXCLUDED.teams_chat_id,
+			quiet_hours = EXCLUDED.quiet_hours, events = EXCLUDED.events, updated_at = EXCLUDED.updated_at, tenant_id = EXCLUDED.tenant_id`,
+		prefs.UserID, prefs.Push, prefs.Email, prefs.Teams, prefs.TeamsChatID, quietHours, encodedEvents, updatedAt, prefs.TenantID)
+	return err
+}
+
+// NotificationPreferences returns the user's notification preferences
+func (p *Postgres) NotificationPreferences(ctx context.Context, userID string) (*NotificationPreferences, error) {
+	prefs := NotificationPreferences{UserID: userID}
+	var quietHours, events []byte
+	var updatedAt time.Time
+	err := p.pool.QueryRow(ctx, `
+		SELECT push, email, teams, teams_chat_id, quiet_hours, events, updated_at FROM notification_preferences WHERE user_id = $1`, userID).
+		Scan(&prefs.Push, &prefs.Email, &prefs.Teams, &prefs.TeamsChatID, &quietHours, &events, &updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if quietHours != nil {
+		if err := json.Unmarshal(quietHours, &prefs.QuietHours); err != nil {
+			return nil, fmt.Errorf("decoding quiet hours of %s: %w", userID, err)
+		}
+	}
+	if err := json.Unmarshal(events, &prefs.Events); err != nil {
+		return nil, fmt.Errorf("decoding notification events of %s: %w", userID, err)
+	}
+	if len(prefs.Events) == 0 {
+		prefs.Events = nil
+	}
+	updatedAt = updatedAt.UTC()
+	prefs.UpdatedAt = &updatedAt
+	return &prefs, nil
+}
+
+// SavePushSubscription upserts a push subscription of the user
+func (p *Postgres) SavePushSubscription(ctx context.Context, sub *PushSubscription) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO push_subscriptions (user_id, id, endpoint, p256dh, auth, user_agent, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, id) DO UPDATE SET endpoint = EXCLUDED.endpoint, p256dh = EXCLUDED.p256dh,
+			auth = EXCLUDED.auth, user_agent = EXCLUDED.user_agent, created_at = EXCLUDED.created_at, tenant_id = EXCLUDED.tenant_id`,
+		sub.UserID, sub.ID, sub.Endpoint, sub.P256dh, sub.Auth, sub.UserAgent, sub.CreatedAt, sub.TenantID)
+	return err
+}
+
+// DeletePushSubscription deletes a push subscription of the user
+func (p *Postgres) DeletePushSubscription(ctx context.Context, userID, id string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM push_subscriptions WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// PushSubscriptions returns the user's push subscriptions, oldest first
+func (p *Postgres) PushSubscriptions(ctx context.Context, userID string) ([]*PushSubscription, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, endpoint, p256dh, auth, user_agent, created_at FROM push_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*PushSubscription
+	for rows.Next() {
+		sub := PushSubscription{UserID: userID}
+		if err := rows.Scan(&sub.ID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.UserAgent, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		sub.CreatedAt = sub.CreatedAt.UTC()
+		subs = append(subs, &sub)
+	}
+	return subs, rows.Err()
+}
+
+// SaveDevice upserts a device of the user
+func (p *Postgres) SaveDevice(ctx context.Context, device *Device) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO user_devices (user_id, id, platform, token, name, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, id) DO UPDATE SET name = EXCLUDED.name, created_at = EXCLUDED.created_at, tenant_id = EXCLUDED.tenant_id`,
+		device.UserID, device.ID, device.Platform, device.Token, device.Name, device.CreatedAt, device.TenantID)
+	return err
+}
+
+// DeleteDevice deletes a device of the user
+func (p *Postgres) DeleteDevice(ctx context.Context, userID, id string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM user_devices WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Devices returns the user's devices, oldest first
+func (p *Postgres) Devices(ctx context.Context, userID string) ([]*Device, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, platform, token, name, created_at FROM user_devices
+		WHERE user_id = $1
+		ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*Device
+	for rows.Next() {
+		device := Device{UserID: userID}
+		if err := rows.Scan(&device.ID, &device.Platform, &device.Token, &device.Name, &device.CreatedAt); err != nil {
+			return nil, err
+		}
+		device.CreatedAt = device.CreatedAt.UTC()
+		devices = append(devices, &device)
+	}
+	return devices, rows.Err()
+}
+
+// TenantPushSubscriptions returns the push subscriptions of the tenant's users
+func (p *Postgres) TenantPushSubscriptions(ctx context.Context, tenantID string) (map[string][]*PushSubscription, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT user_id, id, endpoint, p256dh, auth, user_agent, created_at FROM push_subscriptions
+		WHERE tenant_id = $1
+		ORDER BY created_at, id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make(map[string][]*PushSubscription)
+	for rows.Next() {
+		sub := PushSubscription{TenantID: tenantID}
+		if err := rows.Scan(&sub.UserID, &sub.ID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.UserAgent, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		sub.CreatedAt = sub.CreatedAt.UTC()
+		subs[sub.UserID] = append(subs[sub.UserID], &sub)
+	}
+	return subs, rows.Err()
+}
+
+// PurgeTenantPushSubscriptions deletes the push subscriptions of the tenant's users
+func (p *Postgres) PurgeTenantPushSubscriptions(ctx context.Context, tenantID string) (int, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM push_subscriptions WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// TenantDevices returns the devices of the tenant's users
+func (p *Postgres) TenantDevices(ctx context.Context, tenantID string) (map[string][]*Device, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT user_id, id, platform, token, name, created_at FROM user_devices
+		WHERE tenant_id = $1
+		ORDER BY created_at, id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make(map[string][]*Device)
+	for rows.Next() {
+		device := Device{TenantID: tenantID}
+		if err := rows.Scan(&device.UserID, &device.ID, &device.Platform, &device.Token, &device.Name, &device.CreatedAt); err != nil {
+			return nil, err
+		}
+		device.CreatedAt = device.CreatedAt.UTC()
+		devices[device.UserID] = append(devices[device.UserID], &device)
+	}
+	return devices, rows.Err()
+}
+
+// PurgeTenantDevices deletes the devices of the tenant's users
+func (p *Postgres) PurgeTenantDevices(ctx context.Context, tenantID string) (int, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM user_devices WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ProvisionTenant inserts the tenant's row, claiming its storage partition
+func (p *Postgres) ProvisionTenant(ctx context.Context, tenantID, partition string) error {
+	if _, err := p.pool.Exec(ctx, `
+		INSERT INTO tenants (id, storage_partition) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, tenantID, partition); err != nil {
+		return err
+	}
+
+	var holder string
+	err := p.pool.QueryRow(ctx, `SELECT id FROM tenants WHERE storage_partition = $1`, partition).Scan(&holder)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && holder != tenantID) {
+		return ErrPartitionClaimed
+	}
+	return err
+}
+
+// SaveTenant upserts the tenant's record
+func (p *Postgres) SaveTenant(ctx context.Context, tenantID, partition string, record json.RawMessage) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO tenants (id, storage_partition, record) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET storage_partition = EXCLUDED.storage_partition, record = EXCLUDED.record, updated_at = now()`,
+		tenantID, partition, []byte(record))
+	return err
+}
+
+// Tenants returns the records of provisioned tenants that have been saved
+func (p *Postgres) Tenants(ctx context.Context) ([]json.RawMessage, error) {
+	rows, err := p.pool.Query(ctx, `SELECT record FROM tenants WHERE record IS NOT NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []json.RawMessage
+	for rows.Next() {
+		var record []byte
+		if err := rows.Scan(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// ExportTenant reads the tenant's messages, rooms and members, and the read markers, block
+// lists and notification preferences of its users
+func (p *Postgres) ExportTenant(ctx context.Context, tenantID string) (*TenantData, error) {
+	data := &TenantData{
+		Rooms:       []*TenantRoom{},
+		ReadMarkers: make(map[string]map[string]time.Time),
+		Blocks:      make(map[string][]*Block),
+		Preferences: make(map[string]*NotificationPreferences),
+	}
+	var err error
+	data.Messages, err = p.messages(ctx, `SELECT `+messageColumns+` FROM messages WHERE tenant_id = $1 ORDER BY created_at, id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if data.Messages == nil {
+		data.Messages = []*Message{}
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, name, tenant_id, created_by, created_at FROM rooms
+		WHERE tenant_id = $1
+		ORDER BY created_at`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		room := TenantRoom{Room: &Room{}}
+		if err := rows.Scan(&room.ID, &room.Name, &room.TenantID, &room.CreatedBy, &room.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		room.CreatedAt = room.CreatedAt.UTC()
+		data.Rooms = append(data.Rooms, &room)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, room := range data.Rooms {
+		if room.Members, err = p.Members(ctx, room.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = p.pool.Query(ctx, `SELECT user_id, conversation_id, read_at FROM read_markers WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var userID, conversationID string
+		var at time.Time
+		if err := rows.Scan(&userID, &conversationID, &at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if data.ReadMarkers[userID] == nil {
+			data.ReadMarkers[userID] = make(map[string]time.Time)
+		}
+		data.ReadMarkers[userID][conversationID] = at.UTC()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.pool.Query(ctx, `
+		SELECT user_id, blocked_id, kind, created_at FROM user_blocks
+		WHERE tenant_id = $1
+		ORDER BY created_at, blocked_id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		block := Block{TenantID: tenantID}
+		if err := rows.Scan(&block.UserID, &block.BlockedID, &block.Kind, &block.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		block.CreatedAt = block.CreatedAt.UTC()
+		data.Blocks[block.UserID] = append(data.Blocks[block.UserID], &block)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.pool.Query(ctx, `SELECT user_id FROM notification_preferences WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range userIDs {
+		if data.Preferences[userID], err = p.NotificationPreferences(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// tenantPurges delete a tenant's data, in order; the reactions, revisions and attachments
+// of its messages cascade
+var tenantPurges = []string{
+	`DELETE FROM messages WHERE tenant_id = $1`,
+	`DELETE FROM message_outbox WHERE message->>'tenantId' = $1`,
+	`DELETE FROM room_members WHERE room_id IN (SELECT id FROM rooms WHERE tenant_id = $1)`,
+	`DELETE FROM rooms WHERE tenant_id = $1`,
+	`DELETE FROM read_markers WHERE tenant_id = $1`,
+	`DELETE FROM user_blocks WHERE tenant_id = $1`,
+	`DELETE FROM notification_preferences WHERE tenant_id = $1`,
+	`DELETE FROM user_onboarding WHERE tenant_id = $1`,
+}
+
+// PurgeTenant deletes the tenant's data in one transaction
+func (p *Postgres) PurgeTenant(ctx context.Context, tenantID string) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	purged := 0
+	for _, purge := range tenantPurges {
+		tag, err := tx.Exec(ctx, purge, tenantID)
+		if err != nil {
+			return 0, err
+		}
+		purged += int(tag.RowsAffected())
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// CountTenant counts the rows PurgeTenant deletes
+func (p *Postgres) CountTenant(ctx context.Context, tenantID string) (int, error) {
+	var count int
+	err := p.pool.QueryRow(ctx, `
+		SELECT (SELECT count(*) FROM messages WHERE tenant_id = $1)
+			+ (SELECT count(*) FROM message_outbox WHERE message->>'tenantId' = $1)
+			+ (SELECT count(*) FROM room_members WHERE room_id IN (SELECT id FROM rooms WHERE tenant_id = $1))
+			+ (SELECT count(*) FROM rooms WHERE tenant_id = $1)
+			+ (SELECT count(*) FROM read_markers WHERE tenant_id = $1)
+			+ (SELECT count(*) FROM user_blocks WHERE tenant_id = $1)
+			+ (SELECT count(*) FROM notification_preferences WHERE tenant_id = $1)
+			+ (SELECT count(*) FROM user_onboarding WHERE tenant_id = $1)`, tenantID).Scan(&count)
+	return count, err
+}
+
+// scanMessages reads and closes rows selected with messageColumns
+func scanMessages(rows pgx.Rows) ([]*Message, error) {
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		var msg Message
+		var content, mentions []byte
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.SenderName, &msg.RecipientID, &msg.TenantID, &msg.ParentID, &content, &mentions,
+			&msg.CreatedAt, &msg.EditedAt, &msg.DeletedAt, &msg.DeletedBy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(mentions, &msg.Mentions); err != nil {
+			return nil, fmt.Errorf("decoding mentions of message %s: %w", msg.ID, err)
+		}
+		if len(msg.Mentions) == 0 {
+			msg.Mentions = nil
+		}
+		if msg.DeletedAt == nil { // Deleted messages keep JSON null
+			msg.Message = &models.MessageContent{}
+			if err := json.Unmarshal(content, msg.Message); err != nil {
+				return nil, fmt.Errorf("decoding message %s: %w", msg.ID, err)
+			}
+		}
+		msg.CreatedAt = msg.CreatedAt.UTC()
+		for _, at := range []*time.Time{msg.EditedAt, msg.DeletedAt} {
+			if at != nil {
+				*at = at.UTC()
+			}
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
+
+// CreateRoom inserts a new room
+func (p *Postgres) CreateRoom(ctx context.Context, room *Room) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO rooms (id, name, tenant_id, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		room.ID, room.Name, room.TenantID, room.CreatedBy, room.CreatedAt)
+	return err
+}
+
+// Room returns a room
+func (p *Postgres) Room(ctx context.Context, id string) (*Room, error) {
+	var room Room
+	err := p.pool.QueryRow(ctx, `
+		SELECT id, name, tenant_id, created_by, created_at FROM rooms WHERE id = $1`, id).
+		Scan(&room.ID, &room.Name, &room.TenantID, &room.CreatedBy, &room.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	room.CreatedAt = room.CreatedAt.UTC()
+	return &room, nil
+}
+
+// AddMember inserts a membership, ignoring users who are already members
+func (p *Postgres) AddMember(ctx context.Context, room *Room, member *Member) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO room_members (room_id, user_id, name, email, joined_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id, user_id) DO NOTHING`,
+		room.ID, member.UserID, member.Name, member.Email, member.JoinedAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RemoveMember deletes a membership
+func (p *Postgres) RemoveMember(ctx context.Context, roomID, userID string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM room_members WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Members returns a room's members in the order they joined
+func (p *Postgres) Members(ctx context.Context, roomID string) ([]*Member, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT user_id, name, email, joined_at FROM room_members
+		WHERE room_id = $1
+		ORDER BY joined_at`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*Member
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		member.JoinedAt = member.JoinedAt.UTC()
+		members = append(members, &member)
+	}
+	return members, rows.Err()
+}
+
+// UserRooms returns the rooms a user has joined, oldest first
+func (p *Postgres) UserRooms(ctx context.Context, userID string) ([]*Room, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT r.id, r.name, r.tenant_id, r.created_by, r.created_at
+		FROM rooms r JOIN room_members m ON m.room_id = r.id
+		WHERE m.user_id = $1
+		ORDER BY r.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []*Room
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(&room.ID, &room.Name, &room.TenantID, &room.CreatedBy, &room.CreatedAt); err != nil {
+			return nil, err
+		}
+		room.CreatedAt = room.CreatedAt.UTC()
+		rooms = append(rooms, &room)
+	}
+	return rooms, rows.Err()
+}
+
+// Ping checks the connection, for health checks
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+// MarkOnboarded inserts the user's onboarding row, which only the first call creates
+func (p *Postgres) MarkOnboarded(ctx context.Context, userID, tenantID string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `INSERT INTO user_onboarding (user_id, tenant_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, tenantID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// AddStorageUsage adds to a user's or room's usage row, checking the limit in the same
+// statement so concurrent writers on other replicas can't overshoot it together
+func (p *Postgres) AddStorageUsage(ctx context.Context, scope, id string, delta StorageUsage, limit int64) (StorageUsage, bool, error) {
+	if _, ok := addUsage(StorageUsage{}, delta, limit); !ok {
+		usage, err := p.StorageUsage(ctx, scope, id)
+		return usage, false, err
+	}
+
+	var usage StorageUsage
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO storage_usage AS u (scope, id, message_bytes, attachment_bytes)
+		VALUES ($1, $2, GREATEST($3::bigint, 0), GREATEST($4::bigint, 0))
+		ON CONFLICT (scope, id) DO UPDATE SET
+			message_bytes = GREATEST(u.message_bytes + $3, 0),
+			attachment_bytes = GREATEST(u.attachment_bytes + $4, 0)
+		WHERE $5::bigint = 0 OR $3 + $4 <= 0 OR u.message_bytes + u.attachment_bytes + $3 + $4 <= $5
+		RETURNING message_bytes, attachment_bytes`,
+		scope, id, delta.MessageBytes, delta.AttachmentBytes, limit).Scan(&usage.MessageBytes, &usage.AttachmentBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		usage, err = p.StorageUsage(ctx, scope, id)
+		return usage, false, err
+	}
+	if err != nil {
+		return StorageUsage{}, false, err
+	}
+	return usage, true, nil
+}
+
+// StorageUsage reads a user's or room's usage row
+func (p *Postgres) StorageUsage(ctx context.Context, scope, id string) (StorageUsage, error) {
+	var usage StorageUsage
+	err := p.pool.QueryRow(ctx, `SELECT message_bytes, attachment_bytes FROM storage_usage WHERE scope = $1 AND id = $2`,
+		scope, id).Scan(&usage.MessageBytes, &usage.AttachmentBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return StorageUsage{}, nil
+	}
+	return usage, err
+}
+
+// Backend returns "postgres"
+func (p *Postgres) Backend() string {
+	return "postgres"
+}
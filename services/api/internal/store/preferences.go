@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Notification channels, the ways users can be told about messages they receive while offline
+const (
+	ChannelPush  = "push"  // Web Push and mobile push
+	ChannelEmail = "email" // Email
+	ChannelTeams = "teams" // Microsoft Teams notification cards
+)
+
+// Notification event types users can turn off individually
+const (
+	EventDirectMessage = "directMessage" // Direct messages sent while the recipient was offline
+)
+
+// NotificationEvents are the event types notifications are sent for
+var NotificationEvents = []string{EventDirectMessage}
+
+// NotificationPreferences are the ways a user chose to be told about messages they receive
+// while offline. Users who never saved any get push notifications only; with every channel
+// off they only receive messages over their live connections.
+type NotificationPreferences struct {
+	UserID      string          `json:"-"`
+	TenantID    string          `json:"-"`
+	Push        bool            `json:"push"`                  // Web Push and mobile push
+	Email       bool            `json:"email"`                 // Email
+	Teams       bool            `json:"teams"`                 // Microsoft Teams notification cards
+	TeamsChatID string          `json:"teamsChatId,omitempty"` // Chat the cards are posted to in Graph mode
+	QuietHours  *QuietHours     `json:"quietHours,omitempty"`  // No notifications are sent during them
+	Events      map[string]bool `json:"events,omitempty"`      // Event type -> notify; unlisted types notify
+	UpdatedAt   *time.Time      `json:"updatedAt,omitempty"`   // Unset until first saved
+}
+
+// QuietHours is a daily window, in the user's time zone, during which notifications are
+// suppressed. Windows ending before they start span midnight.
+type QuietHours struct {
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+	TimeZone string `json:"timeZone,omitempty"` // IANA time zone; UTC when empty
+}
+
+// DefaultNotificationPreferences returns the preferences of a user who never saved any
+func DefaultNotificationPreferences(userID string) *NotificationPreferences {
+	return &NotificationPreferences{UserID: userID, Push: true}
+}
+
+// Allows reports whether a notification of an event type may be sent over a channel at t
+func (p *NotificationPreferences) Allows(channel, event string, t time.Time) bool {
+	switch channel {
+	case ChannelPush:
+		if !p.Push {
+			return false
+		}
+	case ChannelEmail:
+		if !p.Email {
+			return false
+		}
+	case ChannelTeams:
+		if !p.Teams {
+			return false
+		}
+	default:
+		return false
+	}
+	if notify, ok := p.Events[event]; ok && !notify {
+		return false
+	}
+	return p.QuietHours == nil || !p.QuietHours.Contains(t)
+}
+
+// Contains reports whether t falls within the quiet hours. Invalid quiet hours contain nothing.
+func (q *QuietHours) Contains(t time.Time) bool {
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return false
+	}
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// PreferenceStore persists each user's notification preferences
+type PreferenceStore interface {
+	// SaveNotificationPreferences replaces the preferences of prefs.UserID
+	SaveNotificationPreferences(ctx context.Context, prefs *NotificationPreferences) error
+	// NotificationPreferences returns the user's preferences, the defaults if they never
+	// saved any
+	NotificationPreferences(ctx context.Context, userID string) (*NotificationPreferences, error)
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// PushSubscription is a browser's Web Push subscription (PushSubscription.toJSON), registered
+// by a user to be notified of messages while they're offline
+type PushSubscription struct {
+	ID        string    `json:"id"` // Derived from the endpoint, so registering it again replaces it
+	UserID    string    `json:"-"`
+	TenantID  string    `json:"-"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"p256dh"` // Base64url user agent public key
+	Auth      string    `json:"-"`      // Base64url authentication secret, never returned
+	UserAgent string    `json:"userAgent,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PushSubscriptionStore persists each user's Web Push subscriptions
+type PushSubscriptionStore interface {
+	// SavePushSubscription adds a subscription of sub.UserID, replacing one with the same ID
+	SavePushSubscription(ctx context.Context, sub *PushSubscription) error
+	// DeletePushSubscription removes a subscription of the user, reporting false if it
+	// wasn't there
+	DeletePushSubscription(ctx context.Context, userID, id string) (bool, error)
+	// PushSubscriptions returns the user's subscriptions, oldest first
+	PushSubscriptions(ctx context.Context, userID string) ([]*PushSubscription, error)
+	// TenantPushSubscriptions returns the subscriptions of the tenant's users by user ID
+	TenantPushSubscriptions(ctx context.Context, tenantID string) (map[string][]*PushSubscription, error)
+	// PurgeTenantPushSubscriptions deletes the subscriptions of the tenant's users and returns
+	// how many were deleted
+	PurgeTenantPushSubscriptions(ctx context.Context, tenantID string) (int, error)
+}
@@ -0,0 +1,70 @@
+package store
+
+import "context"
+
+// Reaction aggregates the users who reacted to a message with one emoji
+type Reaction struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"` // IDs of the users who reacted, in the order they did
+}
+
+// ReactionStore persists reactions to messages
+type ReactionStore interface {
+	// AddReaction records userID reacting to msg with emoji and returns the message's
+	// reactions, reporting false if the user had already reacted with it
+	AddReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error)
+	// RemoveReaction removes userID's emoji reaction to msg and returns the message's
+	// reactions, reporting false if there was none
+	RemoveReaction(ctx context.Context, msg *Message, emoji, userID string) ([]*Reaction, bool, error)
+}
+
+// withReaction returns reactions with userID's emoji reaction added, without modifying them
+func withReaction(reactions []*Reaction, emoji, userID string) ([]*Reaction, bool) {
+	updated := make([]*Reaction, 0, len(reactions)+1)
+	added := true
+	for _, reaction := range reactions {
+		if reaction.Emoji == emoji {
+			for _, id := range reaction.Users {
+				if id == userID {
+					return reactions, false
+				}
+			}
+			users := append(append([]string(nil), reaction.Users...), userID)
+			reaction = &Reaction{Emoji: emoji, Count: len(users), Users: users}
+			added = false
+		}
+		updated = append(updated, reaction)
+	}
+	if added {
+		updated = append(updated, &Reaction{Emoji: emoji, Count: 1, Users: []string{userID}})
+	}
+	return updated, true
+}
+
+// withoutReaction returns reactions with userID's emoji reaction removed, without modifying them
+func withoutReaction(reactions []*Reaction, emoji, userID string) ([]*Reaction, bool) {
+	updated := make([]*Reaction, 0, len(reactions))
+	removed := false
+	for _, reaction := range reactions {
+		if reaction.Emoji == emoji {
+			users := make([]string, 0, len(reaction.Users))
+			for _, id := range reaction.Users {
+				if id == userID {
+					removed = true
+				} else {
+					users = append(users, id)
+				}
+			}
+			if len(users) == 0 {
+				continue
+			}
+			reaction = &Reaction{Emoji: emoji, Count: len(users), Users: users}
+		}
+		updated = append(updated, reaction)
+	}
+	if !removed {
+		return reactions, false
+	}
+	return updated, true
+}
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// RetentionStore finds old messages across conversations and removes them for good, so
+// retention policies can be enforced
+type RetentionStore interface {
+	// ScanMessages calls each with every message of any conversation created before the
+	// given time, in no particular order. An error returned by each stops the scan. Messages
+	// may be purged while the scan is running.
+	ScanMessages(ctx context.Context, before time.Time, each func(msg *Message) error) error
+	// PurgeMessages removes messages with their reactions, revisions and attachments,
+	// leaving no tombstone. Messages that no longer exist are skipped.
+	PurgeMessages(ctx context.Context, msgs []*Message) error
+}
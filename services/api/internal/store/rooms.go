@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRoomNotFound is returned for rooms that don't exist
+var ErrRoomNotFound = errors.New("room not found")
+
+// Room is a group conversation
+type Room struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	TenantID  string    `json:"tenantId"` // Only users of this tenant may join
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Member is a user who has joined a room
+type Member struct {
+	UserID   string    `json:"userId"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// RoomStore persists rooms and their membership
+type RoomStore interface {
+	// CreateRoom persists a new room
+	CreateRoom(ctx context.Context, room *Room) error
+	// Room returns a room, or ErrRoomNotFound
+	Room(ctx context.Context, id string) (*Room, error)
+	// AddMember adds a user to a room, reporting false if they were already a member
+	AddMember(ctx context.Context, room *Room, member *Member) (bool, error)
+	// RemoveMember removes a user from a room, reporting false if they weren't a member
+	RemoveMember(ctx context.Context, roomID, userID string) (bool, error)
+	// Members returns a room's members in the order they joined
+	Members(ctx context.Context, roomID string) ([]*Member, error)
+	// UserRooms returns the rooms a user has joined
+	UserRooms(ctx context.Context, userID string) ([]*Room, error)
+}
+
+// RoomConversationID returns the conversation ID under which a room's messages are stored
+func RoomConversationID(roomID string) string {
+	return "room:" + roomID
+}
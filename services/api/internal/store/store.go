@@ -0,0 +1,93 @@
+// Package store persists chat messages and rooms so they survive restarts and can be fetched
+// later
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api-service/internal/models"
+)
+
+// DefaultPageSize and MaxPageSize bound the messages returned by one Messages call
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// ErrMessageNotFound is returned for messages that don't exist
+var ErrMessageNotFound = errors.New("message not found")
+
+// Message is a persisted chat message
+type Message struct {
+	ID             string                 `json:"id"` // The chat event ID
+	ConversationID string                 `json:"conversationId"`
+	SenderID       string                 `json:"senderId"`
+	SenderName     string                 `json:"senderName"`
+	RecipientID    string                 `json:"recipientId"`
+	TenantID       string                 `json:"tenantId"`                  // Sender's tenant
+	ParentID       string                 `json:"parentMessageId,omitempty"` // Root of the thread this message replies in
+	Message        *models.MessageContent `json:"message"`                   // Nil once deleted
+	Mentions       []*Mention             `json:"mentions,omitempty"`        // Participants mentioned as @handle when sent
+	Reactions      []*Reaction            `json:"reactions,omitempty"`       // In the order each emoji was first used
+	Revisions      []*Revision            `json:"revisions,omitempty"`       // Versions replaced by edits, oldest first
+	Attachments    []*Attachment          `json:"attachments,omitempty"`     // In the order they were attached
+	CreatedAt      time.Time              `json:"createdAt"`
+	EditedAt       *time.Time             `json:"editedAt,omitempty"`
+	DeletedAt      *time.Time             `json:"deletedAt,omitempty"`
+	DeletedBy      string                 `json:"deletedBy,omitempty"`
+}
+
+// Mention is a participant of a conversation mentioned in a message
+type Mention struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+}
+
+// Store persists chat messages, partitioned by conversation, their reactions, edits and
+// attachments, read markers, block lists, notification preferences, push subscriptions,
+// devices, rooms, the tenant registry, storage usage and onboarded users, removes messages past their retention
+// and purges decommissioned tenants
+type Store interface {
+	RoomStore
+	ReactionStore
+	EditStore
+	AttachmentStore
+	ConversationStore
+	RetentionStore
+	BlockStore
+	PreferenceStore
+	PushSubscriptionStore
+	DeviceStore
+	TenantStore
+	TenantDataStore
+	UsageStore
+	OnboardingStore
+
+	// SaveMessage persists a message; saving a message ID again is a no-op
+	SaveMessage(ctx context.Context, msg *Message) error
+	// Messages returns up to limit messages of a conversation created before the given time
+	// (zero for the latest), newest first. Thread replies are left out (see Replies).
+	Messages(ctx context.Context, conversationID string, before time.Time, limit int) ([]*Message, error)
+	// Message returns a message by ID, or ErrMessageNotFound
+	Message(ctx context.Context, id string) (*Message, error)
+	// Replies returns up to limit replies in the thread of parentID created before the given
+	// time (zero for the latest), newest first
+	Replies(ctx context.Context, conversationID, parentID string, before time.Time, limit int) ([]*Message, error)
+	// ConversationMessages returns up to limit messages of a conversation, thread replies and
+	// deleted messages included, created after the given time (zero for the first), oldest
+	// first
+	ConversationMessages(ctx context.Context, conversationID string, after time.Time, limit int) ([]*Message, error)
+	// Backend names the implementation (e.g. "memory", "cosmos")
+	Backend() string
+}
+
+// ConversationID returns the ID of the direct conversation between two users, which is the
+// same whichever of them sends
+func ConversationID(userA, userB string) string {
+	if userB < userA {
+		userA, userB = userB, userA
+	}
+	return "dm:" + userA + ":" + userB
+}
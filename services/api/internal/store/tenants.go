@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrPartitionClaimed is returned when provisioning a tenant whose storage partition another
+// tenant holds
+var ErrPartitionClaimed = errors.New("storage partition is claimed by another tenant")
+
+// TenantStore persists the tenant registry, so onboarded tenants survive restarts and are
+// known to every replica. Records are the registry's JSON documents.
+type TenantStore interface {
+	// ProvisionTenant claims a storage partition for a tenant, returning ErrPartitionClaimed
+	// if another tenant holds it; provisioning the same tenant again is a no-op
+	ProvisionTenant(ctx context.Context, tenantID, partition string) error
+	// SaveTenant stores a tenant's record, replacing the previous one
+	SaveTenant(ctx context.Context, tenantID, partition string, record json.RawMessage) error
+	// Tenants returns every stored record
+	Tenants(ctx context.Context) ([]json.RawMessage, error)
+}
+
+// TenantData is everything the store holds for a tenant: its messages and rooms, and the read
+// markers, block lists and notification preferences of its users (by user ID)
+type TenantData struct {
+	Messages    []*Message                          `json:"messages"`
+	Rooms       []*TenantRoom                       `json:"rooms"`
+	ReadMarkers map[string]map[string]time.Time     `json:"readMarkers"`
+	Blocks      map[string][]*Block                 `json:"blocks"`
+	Preferences map[string]*NotificationPreferences `json:"notificationPreferences"`
+}
+
+// TenantRoom is a room of a tenant with its members
+type TenantRoom struct {
+	*Room
+	Members []*Member `json:"members"`
+}
+
+// TenantDataStore exports and purges a tenant's data when it is decommissioned. Push
+// subscriptions and devices are left to PushSubscriptionStore and DeviceStore.
+type TenantDataStore interface {
+	// ExportTenant returns the tenant's data
+	ExportTenant(ctx context.Context, tenantID string) (*TenantData, error)
+	// PurgeTenant deletes the tenant's data, including outbox entries of its messages, and
+	// returns the number of records deleted
+	PurgeTenant(ctx context.Context, tenantID string) (int, error)
+	// CountTenant returns the number of records still held for the tenant
+	CountTenant(ctx context.Context, tenantID string) (int, error)
+}
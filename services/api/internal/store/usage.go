@@ -0,0 +1,43 @@
+package store
+
+import "context"
+
+// Storage usage scopes
+const (
+	UsageScopeUser = "user"
+	UsageScopeRoom = "room"
+)
+
+// StorageUsage is the number of bytes a user or room stores, by kind
+type StorageUsage struct {
+	MessageBytes    int64 `json:"messageBytes"`
+	AttachmentBytes int64 `json:"attachmentBytes"`
+}
+
+// Total returns the bytes stored of every kind
+func (u StorageUsage) Total() int64 {
+	return u.MessageBytes + u.AttachmentBytes
+}
+
+// UsageStore keeps the storage usage counters of users and rooms, so quotas hold across
+// replicas and restarts
+type UsageStore interface {
+	// AddStorageUsage adds delta to the usage of a user or room (scope is UsageScopeUser or
+	// UsageScopeRoom), unless it grows and the total would exceed limit (0 for no limit).
+	// Counters never go below zero. It reports whether delta was added, and the usage after
+	// it was, or as it stands when it wasn't.
+	AddStorageUsage(ctx context.Context, scope, id string, delta StorageUsage, limit int64) (StorageUsage, bool, error)
+	// StorageUsage returns the usage of a user or room
+	StorageUsage(ctx context.Context, scope, id string) (StorageUsage, error)
+}
+
+// addUsage applies delta to usage as AddStorageUsage does
+func addUsage(usage, delta StorageUsage, limit int64) (StorageUsage, bool) {
+	if limit > 0 && delta.Total() > 0 && usage.Total()+delta.Total() > limit {
+		return usage, false
+	}
+	return StorageUsage{
+		MessageBytes:    max(usage.MessageBytes+delta.MessageBytes, 0),
+		AttachmentBytes: max(usage.AttachmentBytes+delta.AttachmentBytes, 0),
+	}, true
+}
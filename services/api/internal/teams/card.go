@@ -0,0 +1,81 @@
+package teams
+
+// contentTypeAdaptiveCard is the attachment content type of Adaptive Cards
+const contentTypeAdaptiveCard = "application/vnd.microsoft.card.adaptive"
+
+// card is an Adaptive Card
+type card struct {
+	Schema  string      `json:"$schema"`
+	Type    string      `json:"type"` // Always "AdaptiveCard"
+	Version string      `json:"version"`
+	Body    []cardBlock `json:"body"`
+}
+
+// cardBlock is a TextBlock or FactSet element of a card
+type cardBlock struct {
+	Type     string     `json:"type"`
+	Text     string     `json:"text,omitempty"`
+	Weight   string     `json:"weight,omitempty"`
+	Size     string     `json:"size,omitempty"`
+	IsSubtle bool       `json:"isSubtle,omitempty"`
+	Wrap     bool       `json:"wrap,omitempty"`
+	Facts    []cardFact `json:"facts,omitempty"`
+}
+
+// cardFact is a title and value of a FactSet
+type cardFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// newCard builds the card for a notification. Cards posted to a shared webhook name the
+// recipient.
+func newCard(notif notification, shared bool) card {
+	c := card{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []cardBlock{
+			{Type: "TextBlock", Text: "New message from " + notif.senderName, Weight: "Bolder", Size: "Medium", Wrap: true},
+		},
+	}
+	if notif.text != "" {
+		c.Body = append(c.Body, cardBlock{Type: "TextBlock", Text: notif.text, Wrap: true})
+	}
+	if shared {
+		c.Body = append(c.Body, cardBlock{Type: "FactSet", Facts: []cardFact{{Title: "To", Value: notif.recipientID}}})
+	}
+	c.Body = append(c.Body, cardBlock{Type: "TextBlock", Text: "Sent while you were offline", Size: "Small", IsSubtle: true, Wrap: true})
+	return c
+}
+
+// webhookMessage is the body of a post to an incoming webhook
+type webhookMessage struct {
+	Type        string              `json:"type"` // Always "message"
+	Attachments []webhookAttachment `json:"attachments"`
+}
+
+// webhookAttachment is a card attached to a webhook message
+type webhookAttachment struct {
+	ContentType string `json:"contentType"`
+	Content     card   `json:"content"`
+}
+
+// graphChatMessage is the body of a Microsoft Graph chat message post
+type graphChatMessage struct {
+	Body        graphItemBody     `json:"body"`
+	Attachments []graphAttachment `json:"attachments"`
+}
+
+// graphItemBody is the content of a chat message, which references its attachments
+type graphItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+// graphAttachment is a card attached to a chat message; Graph takes the card as a JSON string
+type graphAttachment struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
@@ -0,0 +1,272 @@
+// Package teams tells users about direct messages sent to them while they're offline with
+// Microsoft Teams notification cards, posted to an incoming webhook or, through Microsoft
+// Graph, to a chat of the user's choosing. Users opt in with their notification preferences,
+// whose quiet hours and event toggles are respected too.
+package teams
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/identity"
+	"api-service/internal/models"
+	"api-service/internal/store"
+	"api-service/internal/webpush"
+)
+
+// Delivery modes
+const (
+	ModeWebhook = "webhook" // Cards are posted to one incoming webhook (a channel or workflow)
+	ModeGraph   = "graph"   // Cards are posted to each user's chosen chat with Microsoft Graph
+)
+
+// graphResource is the token audience for Microsoft Graph
+const graphResource = "https://graph.microsoft.com"
+
+// graphEndpoint is the Microsoft Graph API root
+const graphEndpoint = "https://graph.microsoft.com/v1.0"
+
+const (
+	queueSize    = 256 // Notifications waiting to be sent; more are dropped
+	maxAttempts  = 3   // Send attempts before a notification is dropped
+	maxTextRunes = 500 // Message text shown on a card (full content mode only)
+)
+
+// ErrInvalidPreferences is returned for preferences Teams notifications can't be sent with
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// Config configures the notifier
+type Config struct {
+	Mode       string        // ModeWebhook or ModeGraph
+	WebhookURL string        // Incoming webhook cards are posted to (webhook mode)
+	Timeout    time.Duration // Per send attempt
+}
+
+// Stats reports notifier metrics
+type Stats struct {
+	Sent     int64 `json:"sent"`
+	Failures int64 `json:"failures"`
+	Dropped  int64 `json:"dropped"` // Queue overflow or notifications that exhausted their retries
+}
+
+// notification is a message to tell an offline recipient about
+type notification struct {
+	recipientID string
+	senderName  string
+	text        string // Empty unless the sender's tenant allows full content
+}
+
+// Notifier posts notification cards in the background to the users who opted in
+type Notifier struct {
+	cfg         Config
+	preferences store.PreferenceStore
+	identity    *identity.ManagedIdentity
+	push        *webpush.Service // Decides, per tenant, whether cards carry the message text
+	client      *http.Client
+	queue       chan notification
+
+	sent     atomic.Int64
+	failures atomic.Int64
+	dropped  atomic.Int64
+}
+
+// NewNotifier creates a notifier. Cards carry the message text only for tenants whose push
+// content mode is full.
+func NewNotifier(cfg Config, preferences store.PreferenceStore, mi *identity.ManagedIdentity, push *webpush.Service) (*Notifier, error) {
+	switch cfg.Mode {
+	case ModeWebhook:
+		u, err := url.Parse(cfg.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("teams webhook URL must be an https URL")
+		}
+	case ModeGraph:
+	default:
+		return nil, fmt.Errorf("unknown teams notification mode %q (expected %s or %s)", cfg.Mode, ModeWebhook, ModeGraph)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &Notifier{
+		cfg:         cfg,
+		preferences: preferences,
+		identity:    mi,
+		push:        push,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		queue:       make(chan notification, queueSize),
+	}, nil
+}
+
+// Mode returns the delivery mode
+func (n *Notifier) Mode() string {
+	return n.cfg.Mode
+}
+
+// CheckPreferences validates preferences turning Teams notifications on: Graph mode needs
+// the ID of the chat to post to
+func (n *Notifier) CheckPreferences(prefs *store.NotificationPreferences) error {
+	if !prefs.Teams {
+		return nil
+	}
+	if n.cfg.Mode == ModeGraph && prefs.TeamsChatID == "" {
+		return fmt.Errorf("%w: 'teamsChatId' is required to receive Teams notifications", ErrInvalidPreferences)
+	}
+	if prefs.TeamsChatID != "" && (!strings.HasPrefix(prefs.TeamsChatID, "19:") || strings.ContainsAny(prefs.TeamsChatID, "/?#")) {
+		return fmt.Errorf("%w: 'teamsChatId' is not a Teams chat ID", ErrInvalidPreferences)
+	}
+	return nil
+}
+
+// NotifyOffline queues a notification about a message the recipient wasn't connected to
+// receive, reporting false when the queue is full. Whether they opted in is checked in the
+// background; it never blocks.
+func (n *Notifier) NotifyOffline(sender *models.User, recipientID, messageID string, message *models.MessageContent) bool {
+	// The recipient's tenant isn't known while they're offline; direct messages stay within
+	// the sender's
+	notif := notification{
+		recipientID: recipientID,
+		senderName:  sender.Name,
+	}
+	if message != nil && n.push.ModeFor(sender.TenantID) == webpush.ContentFull {
+		notif.text = truncate(message.Text, maxTextRunes)
+	}
+
+	select {
+	case n.queue <- notif:
+		return true
+	default:
+		n.dropped.Add(1)
+		return false
+	}
+}
+
+// Run sends queued notifications until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		var notif notification
+		select {
+		case <-ctx.Done():
+			return
+		case notif = <-n.queue:
+		}
+
+		prefs, err := n.preferences.NotificationPreferences(ctx, notif.recipientID)
+		if err != nil {
+			n.dropped.Add(1)
+			log.Printf("⚠️  Teams notification for %s dropped, reading preferences failed: %v", notif.recipientID, err)
+			continue
+		}
+		if !prefs.Allows(store.ChannelTeams, store.EventDirectMessage, time.Now()) {
+			continue
+		}
+
+		for attempt := 1; ; attempt++ {
+			err := n.send(ctx, prefs, notif)
+			if err == nil {
+				n.sent.Add(1)
+				break
+			}
+			n.failures.Add(1)
+			if attempt == maxAttempts || ctx.Err() != nil {
+				n.dropped.Add(1)
+				log.Printf("⚠️  Teams notification for %s dropped: %v", notif.recipientID, err)
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+	}
+}
+
+// send posts the card for a notification
+func (n *Notifier) send(ctx context.Context, prefs *store.NotificationPreferences, notif notification) error {
+	card := newCard(notif, n.cfg.Mode == ModeWebhook)
+
+	var endpoint string
+	var body interface{}
+	switch n.cfg.Mode {
+	case ModeGraph:
+		if prefs.TeamsChatID == "" {
+			return fmt.Errorf("no teams chat ID in the preferences")
+		}
+		content, err := json.Marshal(card)
+		if err != nil {
+			return err
+		}
+		endpoint = graphEndpoint + "/chats/" + url.PathEscape(prefs.TeamsChatID) + "/messages"
+		body = graphChatMessage{
+			Body: graphItemBody{ContentType: "html", Content: `<attachment id="card"></attachment>`},
+			Attachments: []graphAttachment{{
+				ID:          "card",
+				ContentType: contentTypeAdaptiveCard,
+				Content:     string(content),
+			}},
+		}
+	default:
+		endpoint = n.cfg.WebhookURL
+		body = webhookMessage{
+			Type:        "message",
+			Attachments: []webhookAttachment{{ContentType: contentTypeAdaptiveCard, Content: card}},
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.cfg.Mode == ModeGraph {
+		token, err := n.identity.Token(ctx, graphResource)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := n.client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err // Without the URL, which holds the webhook's signature
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("teams %s returned status %d", n.cfg.Mode, resp.StatusCode)
+	}
+	return nil
+}
+
+// Stats returns notifier metrics
+func (n *Notifier) Stats() Stats {
+	return Stats{
+		Sent:     n.sent.Load(),
+		Failures: n.failures.Load(),
+		Dropped:  n.dropped.Load(),
+	}
+}
+
+// truncate shortens text to at most max runes, marking the cut with an ellipsis
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
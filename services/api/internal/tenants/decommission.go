@@ -0,0 +1,313 @@
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-service/internal/blob"
+	"api-service/internal/redact"
+)
+
+var (
+	// ErrTenantActive is returned when decommissioning a tenant that has not been frozen
+	ErrTenantActive = errors.New("tenant must be frozen before it can be decommissioned")
+	// ErrDecommissionRunning is returned when a decommission is already in progress for the tenant
+	ErrDecommissionRunning = errors.New("decommission already in progress")
+)
+
+// Decommission workflow states
+const (
+	DecommissionRunning   = "running"
+	DecommissionCompleted = "completed"
+	DecommissionFailed    = "failed"
+)
+
+// DataOwner is implemented by subsystems (stores, backplanes, the event hub) holding tenant data
+type DataOwner interface {
+	// Name identifies the subsystem in exports and reports
+	Name() string
+	// PurgeTenant removes all data belonging to the tenant and returns the number of records removed
+	PurgeTenant(ctx context.Context, tenantID string) (int, error)
+	// CountTenant returns the number of records still held for the tenant
+	CountTenant(ctx context.Context, tenantID string) (int, error)
+}
+
+// DataExporter is optionally implemented by data owners with data to hand back to the tenant
+type DataExporter interface {
+	// ExportTenant returns a JSON-serializable snapshot of the tenant's data
+	ExportTenant(ctx context.Context, tenantID string) (interface{}, error)
+}
+
+// ExportResult describes one exported blob
+type ExportResult struct {
+	Owner string `json:"owner"`
+	Blob  string `json:"blob"`
+	Bytes int    `json:"bytes"`
+}
+
+// PurgeResult describes the purge and verification of one data owner
+type PurgeResult struct {
+	Owner     string `json:"owner"`
+	Purged    int    `json:"purged"`
+	Remaining int    `json:"remaining"`
+	Verified  bool   `json:"verified"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DecommissionReport is the verification report produced by offboarding a tenant
+type DecommissionReport struct {
+	TenantID    string         `json:"tenantId"`
+	Status      string         `json:"status"` // running, completed or failed
+	Error       string         `json:"error,omitempty"`
+	StartedAt   time.Time      `json:"startedAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+	Exports     []ExportResult `json:"exports"`
+	Purges      []PurgeResult  `json:"purges"`
+	Verified    bool           `json:"verified"` // True when every owner reports zero remaining records
+}
+
+// Decommissioner runs the freeze → export → purge → verify offboarding workflow
+type Decommissioner struct {
+	registry *Registry
+	owners   []DataOwner
+	required []string        // Owners that must be registered for a decommission to verify
+	redactor redact.Redactor // Applied to exported owner data; nil exports as is
+	mu       sync.Mutex
+}
+
+// NewDecommissioner creates a new decommissioner for the given registry
+func NewDecommissioner(registry *Registry) *Decommissioner {
+	return &Decommissioner{
+		registry: registry,
+	}
+}
+
+// AddDataOwner registers a subsystem whose tenant data must be exported and purged
+func (d *Decommissioner) AddDataOwner(owner DataOwner) {
+	d.mu.Lock()
+	d.owners = append(d.owners, owner)
+	d.mu.Unlock()
+}
+
+// Require names data owners that hold tenant data in this deployment. A decommission run
+// without one of them registered reports it unverified rather than skipping it.
+func (d *Decommissioner) Require(names ...string) {
+	d.mu.Lock()
+	d.required = append(d.required, names...)
+	d.mu.Unlock()
+}
+
+// SetRedactor sets the redaction applied to exported data
+func (d *Decommissioner) SetRedactor(r redact.Redactor) {
+	d.mu.Lock()
+	d.redactor = r
+	d.mu.Unlock()
+}
+
+// Freeze puts the tenant into read-only mode
+func (d *Decommissioner) Freeze(ctx context.Context, tenantID string) (*Tenant, error) {
+	return d.registry.SetStatus(ctx, tenantID, StatusFrozen)
+}
+
+// Start begins decommissioning a frozen tenant in the background. Progress and the final
+// verification report are recorded on the tenant (Tenant.Decommission).
+func (d *Decommissioner) Start(ctx context.Context, tenantID, exportContainerURL string) (*DecommissionReport, error) {
+	report := DecommissionReport{
+		Status:    DecommissionRunning,
+		StartedAt: time.Now().UTC(),
+		Exports:   []ExportResult{},
+		Purges:    []PurgeResult{},
+	}
+	tenant, err := d.registry.update(ctx, tenantID, func(tenant *Tenant) error {
+		if tenant.Status == StatusActive {
+			return ErrTenantActive
+		}
+		if tenant.Decommission != nil && tenant.Decommission.Status == DecommissionRunning {
+			return ErrDecommissionRunning
+		}
+		report.TenantID = tenant.ID
+		started := report
+		tenant.Decommission = &started
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ctx := context.Background()
+		if err := d.run(ctx, tenant, report, exportContainerURL); err != nil {
+			log.Printf("❌ Decommission of tenant %s failed: %v", tenant.ID, err)
+			failed := report
+			failed.Status = DecommissionFailed
+			failed.Error = err.Error()
+			completedAt := time.Now().UTC()
+			failed.CompletedAt = &completedAt
+			if _, err := d.registry.update(ctx, tenant.ID, func(tenant *Tenant) error {
+				tenant.Decommission = &failed
+				return nil
+			}); err != nil {
+				log.Printf("❌ Failed to record the decommission failure of tenant %s: %v", tenant.ID, err)
+			}
+		}
+	}()
+
+	return &report, nil
+}
+
+// run exports the tenant's data to the given Blob container (SAS URL), purges it from
+// every registered data owner and verifies nothing remains
+func (d *Decommissioner) run(ctx context.Context, tenant *Tenant, report DecommissionReport, exportContainerURL string) error {
+	d.mu.Lock()
+	owners := append([]DataOwner(nil), d.owners...)
+	required := append([]string(nil), d.required...)
+	redactor := d.redactor
+	d.mu.Unlock()
+
+	var exports []ExportResult
+	var purges []PurgeResult
+
+	prefix := fmt.Sprintf("%s/%s", tenant.ID, report.StartedAt.Format("20060102T150405Z"))
+
+	// Export everything before anything is purged; any export failure aborts the workflow
+	tenantBytes, _ := json.MarshalIndent(struct {
+		ID               string   `json:"id"`
+		Name             string   `json:"name"`
+		AllowedOrigins   []string `json:"allowedOrigins"`
+		Features         []string `json:"features"`
+		StoragePartition string   `json:"storagePartition"`
+	}{tenant.ID, tenant.Name, tenant.AllowedOrigins, tenant.Features, tenant.StoragePartition}, "", "  ")
+
+	if err := blob.UploadBlockBlob(ctx, exportContainerURL, prefix+"/tenant.json", "application/json", tenantBytes); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	exports = append(exports, ExportResult{Owner: "tenant", Blob: prefix + "/tenant.json", Bytes: len(tenantBytes)})
+
+	for _, owner := range owners {
+		exporter, ok := owner.(DataExporter)
+		if !ok {
+			continue
+		}
+
+		data, err := exporter.ExportTenant(ctx, tenant.ID)
+		if err != nil {
+			return fmt.Errorf("export of %s failed: %w", owner.Name(), err)
+		}
+		if redactor != nil {
+			if data, err = redact.Apply(redactor, data); err != nil {
+				return fmt.Errorf("redaction of %s export failed: %w", owner.Name(), err)
+			}
+		}
+
+		dataBytes, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return fmt.Errorf("export of %s failed: %w", owner.Name(), err)
+		}
+
+		blobName := fmt.Sprintf("%s/%s.json", prefix, owner.Name())
+		if err := blob.UploadBlockBlob(ctx, exportContainerURL, blobName, "application/json", dataBytes); err != nil {
+			return fmt.Errorf("export of %s failed: %w", owner.Name(), err)
+		}
+		exports = append(exports, ExportResult{Owner: owner.Name(), Blob: blobName, Bytes: len(dataBytes)})
+	}
+
+	// Purge and verify each owner; a required owner that isn't registered can't be verified
+	verified := true
+	for _, name := range required {
+		registered := false
+		for _, owner := range owners {
+			registered = registered || owner.Name() == name
+		}
+		if !registered {
+			verified = false
+			log.Printf("⚠️  Purge verification failed for tenant %s: no data owner registered for %s", tenant.ID, name)
+			purges = append(purges, PurgeResult{Owner: name, Error: "no data owner registered"})
+		}
+	}
+	for _, owner := range owners {
+		result := PurgeResult{Owner: owner.Name()}
+
+		purged, err := owner.PurgeTenant(ctx, tenant.ID)
+		result.Purged = purged
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		remaining, err := owner.CountTenant(ctx, tenant.ID)
+		result.Remaining = remaining
+		if err != nil && result.Error == "" {
+			result.Error = err.Error()
+		}
+
+		result.Verified = result.Error == "" && remaining == 0
+		if !result.Verified {
+			verified = false
+			log.Printf("⚠️  Purge verification failed for tenant %s in %s: remaining=%d, error=%s", tenant.ID, owner.Name(), remaining, result.Error)
+		}
+		purges = append(purges, result)
+	}
+
+	// Strip tenant configuration, keeping only the record needed to reject future access
+	report.Exports = exports
+	report.Purges = purges
+	report.Verified = verified
+	report.Status = DecommissionCompleted
+	completedAt := time.Now().UTC()
+	report.CompletedAt = &completedAt
+	if _, err := d.registry.update(ctx, tenant.ID, func(tenant *Tenant) error {
+		tenant.AllowedOrigins = []string{}
+		tenant.Features = []string{}
+		tenant.Onboarding = nil
+		tenant.Status = StatusDecommissioned
+		tenant.Decommission = &report
+		return nil
+	}); err != nil {
+		return fmt.Errorf("recording the report failed: %w", err)
+	}
+
+	log.Printf("🏢 Tenant %s decommissioned (verified=%v)", tenant.ID, verified)
+	return nil
+}
+
+// ownerFuncs adapts plain functions to the DataOwner interface
+type ownerFuncs struct {
+	name  string
+	purge func(ctx context.Context, tenantID string) (int, error)
+	count func(ctx context.Context, tenantID string) (int, error)
+}
+
+// NewDataOwner creates a DataOwner from purge and count functions
+func NewDataOwner(name string, purge, count func(ctx context.Context, tenantID string) (int, error)) DataOwner {
+	return &ownerFuncs{name: name, purge: purge, count: count}
+}
+
+// exportingOwnerFuncs adds an export function to ownerFuncs
+type exportingOwnerFuncs struct {
+	ownerFuncs
+	export func(ctx context.Context, tenantID string) (interface{}, error)
+}
+
+// NewExportingDataOwner creates a DataOwner that is also a DataExporter from export, purge
+// and count functions
+func NewExportingDataOwner(name string, export func(ctx context.Context, tenantID string) (interface{}, error), purge, count func(ctx context.Context, tenantID string) (int, error)) DataOwner {
+	return &exportingOwnerFuncs{ownerFuncs: ownerFuncs{name: name, purge: purge, count: count}, export: export}
+}
+
+func (o *exportingOwnerFuncs) ExportTenant(ctx context.Context, tenantID string) (interface{}, error) {
+	return o.export(ctx, tenantID)
+}
+
+func (o *ownerFuncs) Name() string { return o.name }
+
+func (o *ownerFuncs) PurgeTenant(ctx context.Context, tenantID string) (int, error) {
+	return o.purge(ctx, tenantID)
+}
+
+func (o *ownerFuncs) CountTenant(ctx context.Context, tenantID string) (int, error) {
+	return o.count(ctx, tenantID)
+}
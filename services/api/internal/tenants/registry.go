@@ -0,0 +1,364 @@
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/origins"
+)
+
+var (
+	// ErrTenantExists is returned when onboarding a tenant that is already registered
+	ErrTenantExists = errors.New("tenant already exists")
+	// ErrTenantNotFound is returned when a tenant is not registered
+	ErrTenantNotFound = errors.New("tenant not found")
+)
+
+// guidPattern matches an Azure AD tenant ID
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// partitionPattern matches a storage partition name, which stores use in keys and document IDs
+var partitionPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+// Status represents the lifecycle state of a tenant
+type Status string
+
+const (
+	StatusActive         Status = "active"
+	StatusFrozen         Status = "frozen"         // Read-only while offboarding
+	StatusDecommissioned Status = "decommissioned" // Data exported and purged
+)
+
+// Tenant represents an onboarded customer tenant
+type Tenant struct {
+	ID               string               `json:"id"`                       // Azure AD tenant ID
+	Name             string               `json:"name"`                     // Display name
+	AllowedOrigins   []string             `json:"allowedOrigins"`           // Browser origins allowed for this tenant
+	Features         []string             `json:"features"`                 // Enabled feature set
+	StoragePartition string               `json:"storagePartition"`         // Partition key used by data stores
+	Onboarding       []OnboardingStep     `json:"onboarding,omitempty"`     // Messages sent on a user's first-ever connection
+	ClientVersions   *ClientVersionPolicy `json:"clientVersions,omitempty"` // Replaces the default client version policy
+	PushContent      string               `json:"pushContent,omitempty"`    // Web Push content: "full" or "minimal" (sender and count only)
+	Status           Status               `json:"status"`
+	CreatedAt        time.Time            `json:"createdAt"`
+
+	Decommission *DecommissionReport `json:"decommission,omitempty"` // Set once offboarding has run
+}
+
+// OnboardingStep is one system message or event sent to new users
+type OnboardingStep struct {
+	Event   string                 `json:"event"`   // Event type, e.g. "system_message" or "feature_tour"
+	Payload map[string]interface{} `json:"payload"` // Event payload sent to the client
+}
+
+// ClientVersionPolicy sets which frontend app versions may connect
+type ClientVersionPolicy struct {
+	Minimum           string `json:"minimum,omitempty"`           // Older clients are refused
+	Recommended       string `json:"recommended,omitempty"`       // Older clients are asked to upgrade
+	UpgradeURL        string `json:"upgradeUrl,omitempty"`        // Where users get the current version
+	RejectUnversioned bool   `json:"rejectUnversioned,omitempty"` // Refuse clients that don't report a version
+}
+
+// HasFeature reports whether the tenant has the given feature enabled
+func (t *Tenant) HasFeature(feature string) bool {
+	for _, f := range t.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a copy of the tenant that is safe to use outside the registry lock
+func (t *Tenant) clone() *Tenant {
+	c := *t
+	c.AllowedOrigins = append([]string{}, t.AllowedOrigins...)
+	c.Features = append([]string{}, t.Features...)
+	c.Onboarding = append([]OnboardingStep(nil), t.Onboarding...)
+	if t.ClientVersions != nil {
+		policy := *t.ClientVersions
+		c.ClientVersions = &policy
+	}
+	if t.Decommission != nil {
+		report := *t.Decommission
+		c.Decommission = &report
+	}
+	return &c
+}
+
+// Provisioner prepares the resources a tenant needs (store partitions, config entries)
+type Provisioner func(ctx context.Context, tenant *Tenant) error
+
+// Store persists the registry (implemented by the message stores)
+type Store interface {
+	// SaveTenant stores a tenant's record, replacing the previous one
+	SaveTenant(ctx context.Context, tenantID, partition string, record json.RawMessage) error
+	// Tenants returns every stored record
+	Tenants(ctx context.Context) ([]json.RawMessage, error)
+}
+
+// Registry holds onboarded tenants and runs provisioning steps at runtime. Every change is
+// written to the store, which is reloaded periodically so all replicas see the same tenants.
+type Registry struct {
+	store        Store
+	tenants      map[string]*Tenant // Tenant ID -> Tenant
+	provisioners []Provisioner
+	mu           sync.RWMutex
+	writeMu      sync.Mutex // Serializes changes and reloads, so a reload can't revert a change being saved
+}
+
+// NewRegistry creates a new tenant registry persisted to store
+func NewRegistry(store Store) *Registry {
+	return &Registry{
+		store:   store,
+		tenants: make(map[string]*Tenant),
+	}
+}
+
+// AddProvisioner registers a provisioning step run for every newly onboarded tenant
+func (r *Registry) AddProvisioner(p Provisioner) {
+	r.mu.Lock()
+	r.provisioners = append(r.provisioners, p)
+	r.mu.Unlock()
+}
+
+// Load reads the persisted tenants, at startup
+func (r *Registry) Load(ctx context.Context) error {
+	return r.reload(ctx)
+}
+
+// Run reloads the persisted tenants every interval until ctx is cancelled, picking up tenants
+// onboarded and changed by other replicas
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.reload(ctx); err != nil {
+			log.Printf("⚠️  Failed to reload tenants: %v", err)
+		}
+	}
+}
+
+// reload replaces the tenants with the persisted ones
+func (r *Registry) reload(ctx context.Context) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	records, err := r.store.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+	tenants := make(map[string]*Tenant, len(records))
+	for _, record := range records {
+		var tenant Tenant
+		if err := json.Unmarshal(record, &tenant); err != nil {
+			return fmt.Errorf("decoding tenant: %w", err)
+		}
+		tenants[tenant.ID] = &tenant
+	}
+
+	r.mu.Lock()
+	r.tenants = tenants
+	r.mu.Unlock()
+	return nil
+}
+
+// save persists a tenant and makes it visible. The caller holds writeMu.
+func (r *Registry) save(ctx context.Context, tenant *Tenant) error {
+	record, err := json.Marshal(tenant)
+	if err != nil {
+		return err
+	}
+	if err := r.store.SaveTenant(ctx, tenant.ID, tenant.StoragePartition, record); err != nil {
+		return fmt.Errorf("failed to save tenant %s: %w", tenant.ID, err)
+	}
+
+	r.mu.Lock()
+	r.tenants[tenant.ID] = tenant
+	r.mu.Unlock()
+	return nil
+}
+
+// update applies a change to a copy of the tenant and saves it
+func (r *Registry) update(ctx context.Context, tenantID string, apply func(tenant *Tenant) error) (*Tenant, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.mu.RLock()
+	current, ok := r.tenants[strings.ToLower(tenantID)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+
+	tenant := current.clone()
+	if err := apply(tenant); err != nil {
+		return nil, err
+	}
+	if err := r.save(ctx, tenant); err != nil {
+		return nil, err
+	}
+	return tenant.clone(), nil
+}
+
+// Onboard validates and registers a new tenant, running all provisioning steps.
+// The tenant is only visible once every provisioner has succeeded and it has been saved.
+func (r *Registry) Onboard(ctx context.Context, tenant *Tenant) (*Tenant, error) {
+	tenant.ID = strings.ToLower(strings.TrimSpace(tenant.ID))
+	if !guidPattern.MatchString(tenant.ID) {
+		return nil, fmt.Errorf("invalid tenant ID %q: must be a GUID", tenant.ID)
+	}
+
+	for i, step := range tenant.Onboarding {
+		if step.Event == "" {
+			return nil, fmt.Errorf("onboarding step %d is missing 'event'", i)
+		}
+	}
+
+	for _, origin := range tenant.AllowedOrigins {
+		if !strings.HasPrefix(origin, "https://") && !strings.HasPrefix(origin, "http://") {
+			return nil, fmt.Errorf("invalid origin %q: must include scheme", origin)
+		}
+	}
+
+	if tenant.StoragePartition == "" {
+		tenant.StoragePartition = "tenant-" + tenant.ID
+	}
+	if !partitionPattern.MatchString(tenant.StoragePartition) {
+		return nil, fmt.Errorf("invalid storage partition %q: use letters, digits, '-' and '_'", tenant.StoragePartition)
+	}
+	if tenant.Features == nil {
+		tenant.Features = []string{}
+	}
+	if tenant.AllowedOrigins == nil {
+		tenant.AllowedOrigins = []string{}
+	}
+	tenant.Status = StatusActive
+	tenant.CreatedAt = time.Now().UTC()
+
+	r.mu.RLock()
+	_, exists := r.tenants[tenant.ID]
+	provisioners := append([]Provisioner(nil), r.provisioners...)
+	r.mu.RUnlock()
+
+	if exists {
+		return nil, ErrTenantExists
+	}
+
+	for _, provision := range provisioners {
+		if err := provision(ctx, tenant); err != nil {
+			return nil, fmt.Errorf("failed to provision tenant %s: %w", tenant.ID, err)
+		}
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.RLock()
+	_, exists = r.tenants[tenant.ID]
+	r.mu.RUnlock()
+	if exists {
+		return nil, ErrTenantExists
+	}
+	if err := r.save(ctx, tenant); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🏢 Tenant onboarded: %s (%s), partition=%s", tenant.Name, tenant.ID, tenant.StoragePartition)
+	return tenant.clone(), nil
+}
+
+// Get returns the tenant with the given ID
+func (r *Registry) Get(tenantID string) (*Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant, ok := r.tenants[strings.ToLower(tenantID)]
+	if !ok {
+		return nil, false
+	}
+	return tenant.clone(), true
+}
+
+// List returns all registered tenants ordered by ID
+func (r *Registry) List() []*Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := make([]*Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant.clone())
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// SetStatus changes the lifecycle state of a tenant
+func (r *Registry) SetStatus(ctx context.Context, tenantID string, status Status) (*Tenant, error) {
+	tenant, err := r.update(ctx, tenantID, func(tenant *Tenant) error {
+		tenant.Status = status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🏢 Tenant %s status changed to %s", tenant.ID, status)
+	return tenant, nil
+}
+
+// SetClientVersions replaces the tenant's client version policy; nil restores the default
+func (r *Registry) SetClientVersions(ctx context.Context, tenantID string, policy *ClientVersionPolicy) (*Tenant, error) {
+	tenant, err := r.update(ctx, tenantID, func(tenant *Tenant) error {
+		if policy != nil {
+			p := *policy
+			policy = &p
+		}
+		tenant.ClientVersions = policy
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🏢 Tenant %s client version policy updated", tenant.ID)
+	return tenant, nil
+}
+
+// IsTenantAllowed reports whether tokens issued by the given tenant are accepted.
+// Frozen tenants can still sign in to read and export their data.
+func (r *Registry) IsTenantAllowed(tenantID string) bool {
+	tenant, ok := r.Get(tenantID)
+	return ok && (tenant.Status == StatusActive || tenant.Status == StatusFrozen)
+}
+
+// IsReadOnly reports whether the tenant has been frozen or decommissioned
+func (r *Registry) IsReadOnly(tenantID string) bool {
+	tenant, ok := r.Get(tenantID)
+	return ok && tenant.Status != StatusActive
+}
+
+// IsOriginAllowed reports whether any active tenant allows the given origin, matched as
+// origins.Match does
+func (r *Registry) IsOriginAllowed(origin string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, tenant := range r.tenants {
+		if tenant.Status == StatusActive && origins.Match(origin, tenant.AllowedOrigins) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+// Package testidp is an in-memory identity provider for tests. It serves a JWKS from a local
+// HTTP server and mints tokens signed with its key, so handlers can be tested end to end
+// through AuthMiddleware without Azure AD or SKIP_TOKEN_VERIFICATION:
+//
+//	idp := testidp.New()
+//	defer idp.Close()
+//	auth := middleware.NewAuthMiddleware(idp.Config())
+//	req.Header.Set("Authorization", "Bearer "+idp.Token(testidp.Claims{"oid": "user-1", "roles": []string{"Admin"}}))
+//
+// The dev token generator (cmd/devtoken) serves one with a key kept on disk, so tokens can be
+// minted locally. It is meant for tests and local tools only and must not be imported by the
+// service.
+package testidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"api-service/internal/config"
+	"api-service/internal/middleware"
+)
+
+// Default identifiers of the fake tenant and application
+const (
+	DefaultTenantID = "00000000-0000-0000-0000-00000000a11d"
+	DefaultClientID = "00000000-0000-0000-0000-0000000c11e7"
+)
+
+// TokenLifetime is the lifetime of minted tokens without an exp claim
+const TokenLifetime = time.Hour
+
+// Claims are token claims, merged over the defaults (see Provider.Token)
+type Claims map[string]interface{}
+
+// Provider is a fake identity provider: a signing key and the JWKS endpoint publishing it
+type Provider struct {
+	TenantID string
+	ClientID string
+
+	baseURL string
+	server  *httptest.Server // nil when served by the caller (see Handler)
+	mu      sync.RWMutex
+	keys    []signingKey // The first one signs; all are published
+}
+
+// signingKey is an RSA key and its key ID
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+// New starts a provider for DefaultTenantID and DefaultClientID; Close it when done
+func New() *Provider {
+	p := &Provider{
+		TenantID: DefaultTenantID,
+		ClientID: DefaultClientID,
+	}
+	p.RotateKey()
+	p.server = httptest.NewServer(p.Handler())
+	p.baseURL = p.server.URL
+	return p
+}
+
+// NewWithKey creates a provider signing with key, whose JWKS the caller serves at baseURL
+// (see Handler), for DefaultTenantID and DefaultClientID
+func NewWithKey(key *rsa.PrivateKey, baseURL string) *Provider {
+	return &Provider{
+		TenantID: DefaultTenantID,
+		ClientID: DefaultClientID,
+		baseURL:  baseURL,
+		keys:     []signingKey{{kid: keyID(key), key: key}},
+	}
+}
+
+// Close shuts down the JWKS endpoint started by New
+func (p *Provider) Close() {
+	if p.server != nil {
+		p.server.Close()
+	}
+}
+
+// Handler serves the provider's JWKS
+func (p *Provider) Handler() http.Handler {
+	return http.HandlerFunc(p.serveJWKS)
+}
+
+// JWKSURL returns the URL of the provider's JWKS endpoint
+func (p *Provider) JWKSURL() string {
+	return p.baseURL + "/discovery/v2.0/keys"
+}
+
+// Issuer returns the iss claim of minted tokens
+func (p *Provider) Issuer() string {
+	return p.baseURL + "/" + p.TenantID + "/v2.0"
+}
+
+// Configure points a configuration at the provider, so AuthMiddleware verifies its tokens
+func (p *Provider) Configure(cfg *config.Config) {
+	cfg.AzureTenantID = p.TenantID
+	cfg.AzureClientID = p.ClientID
+	cfg.AuthJWKSURL = p.JWKSURL()
+	cfg.AuthIssuer = p.Issuer()
+	cfg.SkipTokenVerification = false
+}
+
+// Config returns a minimal configuration pointed at the provider
+func (p *Provider) Config() *config.Config {
+	cfg := &config.Config{}
+	p.Configure(cfg)
+	return cfg
+}
+
+// RotateKey generates a new signing key. The previous keys stay published, so tokens they
+// signed remain valid, as during an Azure AD key rollover. AuthMiddleware throttles JWKS
+// refreshes, so it may take up to 30s to accept tokens signed with a key rotated after it
+// started.
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("testidp: generating a signing key: %v", err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append([]signingKey{{kid: keyID(key), key: key}}, p.keys...)
+}
+
+// keyID derives a stable key ID from the key's modulus, so a key kept on disk keeps its kid
+func keyID(key *rsa.PrivateKey) string {
+	sum := sha256.Sum256(key.N.Bytes())
+	return "testidp-" + hex.EncodeToString(sum[:8])
+}
+
+// LoadOrCreateKey reads a PEM (PKCS#1) RSA key from path, generating and saving one (readable
+// by the owner only) when the file doesn't exist
+func LoadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("generating a signing key: %w", err)
+		}
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			return nil, fmt.Errorf("saving the signing key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM encoded RSA private key", path)
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// Token mints a token signed with the current key. claims are merged over defaults for a
+// user of the provider's tenant (iss, aud, tid, oid, name, email, iat, nbf, exp); a nil
+// value removes a default claim.
+func (p *Provider) Token(claims Claims) string {
+	now := time.Now()
+	merged := jwt.MapClaims{
+		"iss":                p.Issuer(),
+		"aud":                p.ClientID,
+		"tid":                p.TenantID,
+		"oid":                "00000000-0000-0000-0000-000000000001",
+		"name":               "Test User",
+		"email":              "test.user@example.com",
+		"preferred_username": "test.user@example.com",
+		"iat":                now.Unix(),
+		"nbf":                now.Unix(),
+		"exp":                now.Add(TokenLifetime).Unix(),
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = value
+	}
+	return p.sign(merged)
+}
+
+// ExpiredToken mints a token that expired a minute ago
+func (p *Provider) ExpiredToken(claims Claims) string {
+	merged := Claims{
+		"iat": time.Now().Add(-TokenLifetime).Unix(),
+		"nbf": time.Now().Add(-TokenLifetime).Unix(),
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}
+	for name, value := range claims {
+		merged[name] = value
+	}
+	return p.Token(merged)
+}
+
+// sign signs claims with the current key
+func (p *Provider) sign(claims jwt.MapClaims) string {
+	p.mu.RLock()
+	current := p.keys[0]
+	p.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = current.kid
+	signed, err := token.SignedString(current.key)
+	if err != nil {
+		panic(fmt.Sprintf("testidp: signing a token: %v", err))
+	}
+	return signed
+}
+
+// serveJWKS publishes the public keys
+func (p *Provider) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	jwkSet := middleware.JWKSet{Keys: make([]middleware.JWK, 0, len(p.keys))}
+	for _, k := range p.keys {
+		jwkSet.Keys = append(jwkSet.Keys, middleware.JWK{
+			Kid: k.kid,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+	p.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jwkSet)
+}
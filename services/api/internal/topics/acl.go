@@ -0,0 +1,273 @@
+package topics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/models"
+)
+
+// Action is an operation on a topic
+type Action string
+
+// Topic actions
+const (
+	ActionSubscribe Action = "subscribe"
+	ActionPublish   Action = "publish"
+)
+
+// ACL modes
+const (
+	ModeEnforce = "enforce" // Denied operations are rejected
+	ModeAudit   = "audit"   // Denied operations are audited but allowed (for rolling out new ACLs)
+)
+
+// ErrForbidden is returned when an ACL denies a topic operation
+var ErrForbidden = errors.New("topic access denied")
+
+// Grant lists who may perform an action. An empty grant allows nobody.
+type Grant struct {
+	Roles  []string `json:"roles,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Users  []string `json:"users,omitempty"`
+}
+
+// Rule controls access to the topics matching Pattern
+type Rule struct {
+	Pattern   string    `json:"pattern"`
+	Subscribe Grant     `json:"subscribe"`
+	Publish   Grant     `json:"publish"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+}
+
+// ACL holds per-topic access rules. Topics no rule matches are open to every
+// authenticated user; when several rules match, the most specific one applies.
+type ACL struct {
+	mu    sync.RWMutex
+	rules map[string]*Rule
+	mode  string
+	audit audit.Log
+}
+
+// NewACL creates an empty ACL in the given mode (ModeEnforce or ModeAudit)
+func NewACL(mode string, auditLog audit.Log) (*ACL, error) {
+	if mode == "" {
+		mode = ModeEnforce
+	}
+	if mode != ModeEnforce && mode != ModeAudit {
+		return nil, fmt.Errorf("unknown topic ACL mode %q (expected %s or %s)", mode, ModeEnforce, ModeAudit)
+	}
+	return &ACL{
+		rules: make(map[string]*Rule),
+		mode:  mode,
+		audit: auditLog,
+	}, nil
+}
+
+// ParseRules parses a JSON array of rules (the TOPIC_ACLS setting)
+func ParseRules(value string) ([]Rule, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var rules []Rule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("invalid topic ACLs: %w", err)
+	}
+	return rules, nil
+}
+
+// Mode returns the ACL mode
+func (a *ACL) Mode() string {
+	return a.mode
+}
+
+// Set creates or replaces the rule for a pattern
+func (a *ACL) Set(rule Rule) (Rule, error) {
+	if err := ValidatePattern(rule.Pattern); err != nil {
+		return Rule{}, err
+	}
+	rule.UpdatedAt = time.Now().UTC()
+
+	a.mu.Lock()
+	a.rules[rule.Pattern] = &rule
+	a.mu.Unlock()
+	return rule, nil
+}
+
+// Delete removes the rule for a pattern, reporting whether it existed
+func (a *ACL) Delete(pattern string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.rules[pattern]; !ok {
+		return false
+	}
+	delete(a.rules, pattern)
+	return true
+}
+
+// List returns all rules sorted by pattern
+func (a *ACL) List() []Rule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rules := make([]Rule, 0, len(a.rules))
+	for _, rule := range a.rules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Pattern < rules[j].Pattern })
+	return rules
+}
+
+// Authorize checks whether user may perform action on topic. Denials are audited;
+// in audit mode they are allowed through.
+func (a *ACL) Authorize(user *models.User, topic string, action Action) error {
+	rule := a.match(topic)
+	if rule == nil || allowed(grantFor(rule, action), user) {
+		return nil
+	}
+
+	outcome := "denied"
+	if a.mode == ModeAudit {
+		outcome = "allowed_audit_mode"
+	}
+	if a.audit != nil {
+		a.audit.Record(audit.Record{
+			Action:   "topic." + string(action) + "_denied",
+			Actor:    user.ID,
+			TenantID: user.TenantID,
+			Target:   topic,
+			Outcome:  outcome,
+			Details:  map[string]interface{}{"rule": rule.Pattern},
+		})
+	}
+
+	if a.mode == ModeAudit {
+		return nil
+	}
+	return fmt.Errorf("%w: %s on %s", ErrForbidden, action, topic)
+}
+
+// Allowed reports whether user may perform action on topic, without auditing denials. It
+// backs checks repeated for every event, such as delivering a topic's events to a client
+// subscribed through a wildcard; in audit mode everything is allowed.
+func (a *ACL) Allowed(user *models.User, topic string, action Action) bool {
+	if a.mode == ModeAudit {
+		return true
+	}
+	rule := a.match(topic)
+	return rule == nil || allowed(grantFor(rule, action), user)
+}
+
+// match returns the most specific rule matching topic, or nil
+func (a *ACL) match(topic string) *Rule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var best *Rule
+	bestScore := -1
+	for pattern, rule := range a.rules {
+		if score, ok := matchPattern(pattern, topic); ok && score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best
+}
+
+func grantFor(rule *Rule, action Action) Grant {
+	if action == ActionPublish {
+		return rule.Publish
+	}
+	return rule.Subscribe
+}
+
+func allowed(grant Grant, user *models.User) bool {
+	for _, id := range grant.Users {
+		if id == user.ID {
+			return true
+		}
+	}
+	for _, role := range grant.Roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+	for _, group := range grant.Groups {
+		for _, g := range user.Groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidatePattern checks a topic pattern: dot-separated segments, where "*" matches
+// exactly one segment, and a final "*" also matches any number of further segments
+func ValidatePattern(pattern string) error {
+	if pattern == "" || len(pattern) > 256 {
+		return fmt.Errorf("topic pattern must be 1-256 characters")
+	}
+	for _, segment := range strings.Split(pattern, ".") {
+		if segment == "" {
+			return fmt.Errorf("topic pattern %q has an empty segment", pattern)
+		}
+		if segment != "*" && strings.Contains(segment, "*") {
+			return fmt.Errorf("topic pattern %q: '*' must be a whole segment", pattern)
+		}
+	}
+	return nil
+}
+
+// ValidateTopic checks a concrete topic name: a pattern without wildcards
+func ValidateTopic(topic string) error {
+	if err := ValidatePattern(topic); err != nil {
+		return err
+	}
+	if strings.Contains(topic, "*") {
+		return fmt.Errorf("topic %q must not contain wildcards", topic)
+	}
+	return nil
+}
+
+// Match reports whether topic matches pattern
+func Match(pattern, topic string) bool {
+	_, ok := matchPattern(pattern, topic)
+	return ok
+}
+
+// matchPattern reports whether topic matches pattern, scoring the match by its number of literal segments
+func matchPattern(pattern, topic string) (int, bool) {
+	patternSegments := strings.Split(pattern, ".")
+	topicSegments := strings.Split(topic, ".")
+
+	score := 0
+	for i, p := range patternSegments {
+		last := i == len(patternSegments)-1
+		if i >= len(topicSegments) {
+			return 0, false
+		}
+		if p == "*" {
+			if last {
+				return score, true
+			}
+			continue
+		}
+		if p != topicSegments[i] {
+			return 0, false
+		}
+		score++
+	}
+	if len(patternSegments) != len(topicSegments) {
+		return 0, false
+	}
+	// Exact matches outrank wildcard matches with the same literal prefix
+	return score + 1, true
+}
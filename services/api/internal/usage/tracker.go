@@ -0,0 +1,159 @@
+// Package usage tracks storage consumption per user and per room and enforces quotas, so a few
+// heavy users can't exhaust a tenant's storage budget
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"api-service/internal/store"
+)
+
+// Kind is a category of stored data
+type Kind string
+
+const (
+	KindMessages    Kind = "messages"
+	KindAttachments Kind = "attachments"
+)
+
+// Quota scopes
+const (
+	ScopeUser = store.UsageScopeUser
+	ScopeRoom = store.UsageScopeRoom
+)
+
+// ErrQuotaExceeded is matched (errors.Is) by every QuotaError
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaError reports the quota a write would have exceeded
+type QuotaError struct {
+	Scope     string // ScopeUser or ScopeRoom
+	ID        string // User or room ID
+	Used      int64
+	Limit     int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %s storage quota exceeded: %d of %d bytes used, %d requested", e.Scope, e.ID, e.Used, e.Limit, e.Requested)
+}
+
+// Is makes errors.Is(err, ErrQuotaExceeded) match
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Limits are the storage quotas in bytes; zero means unlimited
+type Limits struct {
+	UserBytes int64
+	RoomBytes int64
+}
+
+// Usage is the storage consumed by a user or room
+type Usage struct {
+	MessageBytes    int64  `json:"messageBytes"`
+	AttachmentBytes int64  `json:"attachmentBytes"`
+	TotalBytes      int64  `json:"totalBytes"`
+	LimitBytes      int64  `json:"limitBytes"`               // 0 when unlimited
+	RemainingBytes  *int64 `json:"remainingBytes,omitempty"` // Omitted when unlimited
+}
+
+// Tracker counts stored bytes per user and per room in the store and enforces the quotas.
+// Counters are kept by the store, so they survive restarts and every replica sees the writes
+// and releases of the others.
+type Tracker struct {
+	limits Limits
+	store  store.UsageStore
+}
+
+// NewTracker creates a tracker enforcing limits on the counters kept by usageStore
+func NewTracker(limits Limits, usageStore store.UsageStore) *Tracker {
+	return &Tracker{limits: limits, store: usageStore}
+}
+
+// Limits returns the configured quotas
+func (t *Tracker) Limits() Limits {
+	return t.limits
+}
+
+// Reserve records bytes of kind stored by a user, optionally in a room (roomID may be empty).
+// Nothing is recorded and a *QuotaError is returned if either quota would be exceeded.
+func (t *Tracker) Reserve(ctx context.Context, userID, roomID string, kind Kind, bytes int64) error {
+	delta := deltaOf(kind, bytes)
+	used, ok, err := t.store.AddStorageUsage(ctx, store.UsageScopeUser, userID, delta, t.limits.UserBytes)
+	if err != nil {
+		return fmt.Errorf("reserving storage for user %s: %w", userID, err)
+	}
+	if !ok {
+		return &QuotaError{Scope: ScopeUser, ID: userID, Used: used.Total(), Limit: t.limits.UserBytes, Requested: bytes}
+	}
+	if roomID == "" {
+		return nil
+	}
+
+	used, ok, err = t.store.AddStorageUsage(ctx, store.UsageScopeRoom, roomID, delta, t.limits.RoomBytes)
+	if err == nil && ok {
+		return nil
+	}
+	t.release(ctx, store.UsageScopeUser, userID, deltaOf(kind, -bytes))
+	if err != nil {
+		return fmt.Errorf("reserving storage for room %s: %w", roomID, err)
+	}
+	return &QuotaError{Scope: ScopeRoom, ID: roomID, Used: used.Total(), Limit: t.limits.RoomBytes, Requested: bytes}
+}
+
+// Release returns bytes previously reserved, e.g. when the data is deleted or a send fails.
+// Failures are logged.
+func (t *Tracker) Release(ctx context.Context, userID, roomID string, kind Kind, bytes int64) {
+	delta := deltaOf(kind, -bytes)
+	t.release(ctx, store.UsageScopeUser, userID, delta)
+	if roomID != "" {
+		t.release(ctx, store.UsageScopeRoom, roomID, delta)
+	}
+}
+
+// UserUsage returns a user's storage usage
+func (t *Tracker) UserUsage(ctx context.Context, userID string) (Usage, error) {
+	used, err := t.store.StorageUsage(ctx, store.UsageScopeUser, userID)
+	return usageOf(used, t.limits.UserBytes), err
+}
+
+// RoomUsage returns a room's storage usage
+func (t *Tracker) RoomUsage(ctx context.Context, roomID string) (Usage, error) {
+	used, err := t.store.StorageUsage(ctx, store.UsageScopeRoom, roomID)
+	return usageOf(used, t.limits.RoomBytes), err
+}
+
+// release adds a negative delta to a counter, logging failures. It isn't cancelled with
+// ctx, so a request that ends meanwhile doesn't leak the bytes it reserved.
+func (t *Tracker) release(ctx context.Context, scope, id string, delta store.StorageUsage) {
+	if _, _, err := t.store.AddStorageUsage(context.WithoutCancel(ctx), scope, id, delta, 0); err != nil {
+		log.Printf("⚠️  Failed to release storage of %s %s: %v", scope, id, err)
+	}
+}
+
+// deltaOf returns a change of bytes of kind
+func deltaOf(kind Kind, bytes int64) store.StorageUsage {
+	if kind == KindAttachments {
+		return store.StorageUsage{AttachmentBytes: bytes}
+	}
+	return store.StorageUsage{MessageBytes: bytes}
+}
+
+// usageOf summarizes counters against a limit
+func usageOf(used store.StorageUsage, limit int64) Usage {
+	u := Usage{
+		MessageBytes:    used.MessageBytes,
+		AttachmentBytes: used.AttachmentBytes,
+		TotalBytes:      used.Total(),
+		LimitBytes:      limit,
+	}
+	if limit > 0 {
+		remaining := max(limit-u.TotalBytes, 0)
+		u.RemainingBytes = &remaining
+	}
+	return u
+}
@@ -0,0 +1,214 @@
+// Package validate checks decoded request DTOs using `validate` struct tags.
+//
+// Rules are comma-separated and applied in order:
+//
+//	trim          trim surrounding whitespace (strings and string pointers; modifies the value)
+//	required      must be non-zero (non-empty string, slice or map; non-nil pointer)
+//	min=N, max=N  length bounds: characters for strings, elements for slices and maps
+//	oneof=a b c   string must be one of the space-separated values
+//	pattern=name  string must match a registered pattern (see RegisterPattern)
+//	prefix=p      string must start with p
+//
+// Empty optional values skip every rule but required. Field names in errors come from
+// json tags. Types implementing Validator get a final call for cross-field rules.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes why one field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects field errors; it is returned as an error when non-empty
+type Errors []FieldError
+
+// Error implements error
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records an error for a field
+func (e *Errors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Validator is implemented by DTOs with rules that span fields
+type Validator interface {
+	Validate(errs *Errors)
+}
+
+var (
+	patternsMu sync.RWMutex
+	patterns   = map[string]*regexp.Regexp{
+		// Object IDs, user IDs and similar opaque identifiers
+		"id": regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:@-]{0,127}$`),
+		// Short, log-safe version identifiers (e.g. 1.4.2, 2025.10.1-beta+abc)
+		"version": regexp.MustCompile(`^[0-9A-Za-z._+-]{1,64}$`),
+	}
+)
+
+// RegisterPattern adds a named pattern for use with pattern=name
+func RegisterPattern(name string, re *regexp.Regexp) {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	patterns[name] = re
+}
+
+// Pattern returns a registered pattern
+func Pattern(name string) (*regexp.Regexp, bool) {
+	patternsMu.RLock()
+	defer patternsMu.RUnlock()
+	re, ok := patterns[name]
+	return re, ok
+}
+
+// Struct validates (and normalizes) the struct v points to. It returns Errors when invalid.
+func Struct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	checkStruct(rv.Elem(), &errs)
+	if validator, ok := v.(Validator); ok {
+		validator.Validate(&errs)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Rule is one parsed tag rule
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// Rules parses a validate tag
+func Rules(tag string) []Rule {
+	if tag == "" {
+		return nil
+	}
+	var rules []Rule
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+	return rules
+}
+
+// FieldName returns the JSON name of a struct field
+func FieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func checkStruct(rv reflect.Value, errs *Errors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		rules := Rules(field.Tag.Get("validate"))
+		if len(rules) == 0 || !field.IsExported() {
+			continue
+		}
+		if message := checkField(rv.Field(i), rules); message != "" {
+			errs.Add(FieldName(field), message)
+		}
+	}
+}
+
+// checkField applies rules to one field, returning the first failure
+func checkField(fv reflect.Value, rules []Rule) string {
+	for _, rule := range rules {
+		if rule.Name != "trim" {
+			continue
+		}
+		if fv.Kind() == reflect.String && fv.CanSet() {
+			fv.SetString(strings.TrimSpace(fv.String()))
+		} else if fv.Kind() == reflect.Pointer && !fv.IsNil() && fv.Elem().Kind() == reflect.String {
+			fv.Elem().SetString(strings.TrimSpace(fv.Elem().String()))
+		}
+	}
+
+	if fv.IsZero() || (isLengthKind(fv.Kind()) && fv.Len() == 0) {
+		for _, rule := range rules {
+			if rule.Name == "required" {
+				return "is required"
+			}
+		}
+		return ""
+	}
+
+	for _, rule := range rules {
+		switch rule.Name {
+		case "min", "max":
+			limit, err := strconv.Atoi(rule.Param)
+			if err != nil || !isLengthKind(fv.Kind()) {
+				continue
+			}
+			length := fv.Len()
+			unit := "items"
+			if fv.Kind() == reflect.String {
+				length = utf8.RuneCountInString(fv.String())
+				unit = "characters"
+			}
+			if rule.Name == "min" && length < limit {
+				return fmt.Sprintf("must be at least %d %s", limit, unit)
+			}
+			if rule.Name == "max" && length > limit {
+				return fmt.Sprintf("must be at most %d %s", limit, unit)
+			}
+		case "oneof":
+			if fv.Kind() != reflect.String {
+				continue
+			}
+			options := strings.Fields(rule.Param)
+			if !contains(options, fv.String()) {
+				return "must be one of: " + strings.Join(options, ", ")
+			}
+		case "pattern":
+			re, ok := Pattern(rule.Param)
+			if ok && fv.Kind() == reflect.String && !re.MatchString(fv.String()) {
+				return fmt.Sprintf("must be a valid %s", rule.Param)
+			}
+		case "prefix":
+			if fv.Kind() == reflect.String && !strings.HasPrefix(fv.String(), rule.Param) {
+				return fmt.Sprintf("must start with %q", rule.Param)
+			}
+		}
+	}
+	return ""
+}
+
+func isLengthKind(kind reflect.Kind) bool {
+	return kind == reflect.String || kind == reflect.Slice || kind == reflect.Map || kind == reflect.Array
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api-service/internal/deadletter"
+	"api-service/internal/events"
+	"api-service/internal/redact"
+)
+
+// Request headers of a delivery
+const (
+	HeaderSignature = "X-Webhook-Signature" // "sha256=" + hex HMAC-SHA256 of timestamp + "." + body
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix seconds the attempt was signed at
+	HeaderDelivery  = "X-Webhook-Delivery"  // Delivery ID, the same across retries
+	HeaderEvent     = "X-Webhook-Event"     // Event type
+	HeaderWebhook   = "X-Webhook-ID"        // Webhook ID
+)
+
+const (
+	queueSize    = 1024 // Deliveries waiting to be sent; more are dead-lettered
+	workers      = 4    // Concurrent deliveries
+	maxErrorBody = 512  // Bytes of a failed response's body kept in its dead letter
+
+	initialBackoff = 2 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// Notification is the JSON body POSTed to a webhook
+type Notification struct {
+	ID        string           `json:"id"` // Event ID
+	Type      events.EventType `json:"type"`
+	Timestamp time.Time        `json:"timestamp"`
+	TenantID  string           `json:"tenantId,omitempty"` // Topic events
+	Topic     string           `json:"topic,omitempty"`    // Topic events
+	Data      interface{}      `json:"data"`               // The event payload, redacted for the webhooks sink
+}
+
+// delivery is a notification on its way to a webhook
+type delivery struct {
+	id        string
+	webhookID string
+	eventType events.EventType
+	body      []byte
+	attempts  int
+}
+
+// attemptError is a failed delivery attempt
+type attemptError struct {
+	status     int
+	message    string
+	retry      bool          // Worth retrying (network errors, timeouts, 408, 429 and 5xx)
+	retryAfter time.Duration // Asked for by the receiver's Retry-After
+}
+
+func (e *attemptError) Error() string {
+	return e.message
+}
+
+// Observe queues deliveries of an event to its tenant's webhooks subscribed to its type;
+// register it with Manager.AddEventObserver
+func (s *Service) Observe(event *events.Event) {
+	// Topic events belong to their tenant; the rest aren't scoped to one and go to the home
+	// tenant's webhooks only
+	tenantID := event.TenantID
+	if tenantID == "" {
+		tenantID = s.cfg.HomeTenantID
+	}
+	subscribed := s.subscribers(event.Type, tenantID)
+	if len(subscribed) == 0 {
+		return
+	}
+
+	data, err := redact.Apply(s.redactor, event.Payload)
+	if err != nil {
+		log.Printf("⚠️  Failed to redact a %s event for webhooks: %v", event.Type, err)
+		return
+	}
+	notification := Notification{
+		ID:        event.ID,
+		Type:      event.Type,
+		Timestamp: event.Timestamp,
+		TenantID:  event.TenantID,
+		Topic:     event.Topic,
+		Data:      data,
+	}
+	if notification.ID == "" {
+		notification.ID = newID()
+	}
+	if notification.Timestamp.IsZero() {
+		notification.Timestamp = time.Now().UTC()
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		log.Printf("⚠️  Failed to encode a %s event for webhooks: %v", event.Type, err)
+		return
+	}
+
+	for _, w := range subscribed {
+		s.enqueue(&delivery{id: newID(), webhookID: w.ID, eventType: event.Type, body: body})
+	}
+}
+
+// enqueue queues a delivery, dead-lettering it when the queue is full. It never blocks.
+func (s *Service) enqueue(d *delivery) {
+	select {
+	case s.queue <- d:
+	default:
+		s.deadLetter(d, &attemptError{message: "delivery queue full"})
+	}
+}
+
+// deliver sends queued deliveries until ctx is cancelled
+func (s *Service) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-s.queue:
+			s.attempt(ctx, d)
+		}
+	}
+}
+
+// attempt sends a delivery once, scheduling a retry with exponential backoff when it fails
+func (s *Service) attempt(ctx context.Context, d *delivery) {
+	w := s.lookup(d.webhookID)
+	if w == nil {
+		return // Deleted since the event was queued
+	}
+
+	d.attempts++
+	err := s.send(ctx, w, d)
+	if err == nil {
+		s.delivered.Add(1)
+		return
+	}
+	s.failures.Add(1)
+	if !err.retry || d.attempts >= s.cfg.MaxAttempts || ctx.Err() != nil {
+		s.deadLetter(d, err)
+		return
+	}
+
+	delay := backoff(d.attempts)
+	if err.retryAfter > delay {
+		delay = min(err.retryAfter, maxBackoff)
+	}
+	time.AfterFunc(delay, func() {
+		if ctx.Err() == nil {
+			s.enqueue(d)
+		}
+	})
+}
+
+// send POSTs a delivery's notification, signed with the webhook's secret
+func (s *Service) send(ctx context.Context, w *Webhook, d *delivery) *attemptError {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return &attemptError{message: err.Error()}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "api-service-webhooks")
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, d.body))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderDelivery, d.id)
+	req.Header.Set(HeaderEvent, string(d.eventType))
+	req.Header.Set(HeaderWebhook, w.ID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &attemptError{message: err.Error(), retry: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	message := fmt.Sprintf("webhook returned status %d", resp.StatusCode)
+	if len(body) > 0 {
+		message += ": " + string(bytes.TrimSpace(body))
+	}
+	attemptErr := &attemptError{status: resp.StatusCode, message: message}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		attemptErr.retry = true
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			attemptErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return attemptErr
+}
+
+// Sign returns the X-Webhook-Signature of a body sent at the given timestamp (Unix seconds).
+// Receivers compute it with the webhook's secret and compare it in constant time, and should
+// refuse timestamps more than a few minutes old.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff is the delay before retrying after the given number of attempts: 2s, 4s, 8s and so
+// on, up to 5 minutes
+func backoff(attempts int) time.Duration {
+	delay := initialBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// deadLetter records a delivery that won't be retried
+func (s *Service) deadLetter(d *delivery, err *attemptError) {
+	s.deadLettered.Add(1)
+	log.Printf("⚠️  Webhook %s delivery %s (%s) dead-lettered after %d attempts: %s", d.webhookID, d.id, d.eventType, d.attempts, err.message)
+
+	s.deadLetters.Add(deadletter.Letter{
+		ID:       d.id,
+		Source:   deadletter.SourceWebhooks,
+		Type:     string(d.eventType),
+		Target:   d.webhookID,
+		Attempts: d.attempts,
+		Status:   err.status,
+		Error:    err.message,
+		Payload:  d.body,
+	})
+}
+
+// redrive queues a dead-lettered delivery again; it's the webhooks source's redriver
+func (s *Service) redrive(_ context.Context, letter *deadletter.Letter) error {
+	if s.lookup(letter.Target) == nil {
+		return ErrWebhookNotFound
+	}
+	s.enqueue(&delivery{id: letter.ID, webhookID: letter.Target, eventType: events.EventType(letter.Type), body: letter.Payload})
+	return nil
+}
+
+// Stats returns delivery metrics
+func (s *Service) Stats() Stats {
+	s.mu.RLock()
+	registered := len(s.webhooks)
+	s.mu.RUnlock()
+	return Stats{
+		Webhooks:     registered,
+		Delivered:    s.delivered.Load(),
+		Failures:     s.failures.Load(),
+		DeadLettered: s.deadLettered.Load(),
+		Pending:      len(s.queue),
+	}
+}
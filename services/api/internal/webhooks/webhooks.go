@@ -0,0 +1,494 @@
+// Package webhooks delivers service events to URLs registered by admins, signed with each
+// registration's secret and retried with backoff, so external systems can react to chat and
+// user activity without holding a WebSocket open
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/audit"
+	"api-service/internal/blob"
+	"api-service/internal/deadletter"
+	"api-service/internal/events"
+	"api-service/internal/locks"
+	"api-service/internal/models"
+	"api-service/internal/redact"
+)
+
+// AllTypes subscribes a webhook to every type in Types
+const AllTypes = "*"
+
+// Types lists the event types webhooks can subscribe to
+var Types = []events.EventType{
+	events.EventTypeChat,
+	events.EventTypeUserJoined,
+	events.EventTypeUserLeft,
+	events.EventTypePresence,
+	events.EventTypeReactionAdded,
+	events.EventTypeReactionRemoved,
+	events.EventTypeMessageUpdated,
+	events.EventTypeMessageDeleted,
+	events.EventTypeMention,
+	events.EventTypeAttachmentAdded,
+	events.EventTypeTopic,
+	events.EventTypeAnnouncement,
+	events.EventTypeKicked,
+	events.EventTypeBanned,
+}
+
+const (
+	maxWebhooks     = 100 // Registrations
+	minSecretLength = 16  // Characters of a secret given at registration
+)
+
+// blobName is the blob webhooks are persisted to, in the webhooks container
+const blobName = "webhooks.json"
+
+// maxBlobBytes bounds the persisted webhooks
+const maxBlobBytes = 1 << 20
+
+// lockName is the lock serializing changes to the persisted webhooks across replicas
+const lockName = "webhooks"
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrTooManyWebhooks = errors.New("too many webhooks")
+)
+
+// Webhook is a registration: events of the listed types are POSTed to URL, signed with Secret
+type Webhook struct {
+	ID          string             `json:"id"`
+	URL         string             `json:"url"`
+	Secret      string             `json:"secret,omitempty"` // Only returned when the webhook is created
+	EventTypes  []events.EventType `json:"eventTypes"`       // Or AllTypes
+	Description string             `json:"description,omitempty"`
+	TenantID    string             `json:"tenantId,omitempty"` // Creator's tenant, whose events it receives
+	CreatedBy   string             `json:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt"`
+}
+
+// Subscribed reports whether the webhook receives events of the type
+func (w *Webhook) Subscribed(eventType events.EventType) bool {
+	for _, t := range w.EventTypes {
+		if t == eventType || t == AllTypes {
+			return true
+		}
+	}
+	return false
+}
+
+// Config configures the service
+type Config struct {
+	ContainerURL string        // Container SAS URL webhooks are persisted to; in memory on this replica when empty
+	MaxAttempts  int           // Delivery attempts before a delivery is dead-lettered
+	Timeout      time.Duration // Per delivery attempt
+	AllowHTTP    bool          // Allow http:// URLs (local development); https is required otherwise
+	HomeTenantID string        // Receives events not scoped to a tenant, and owns webhooks registered without one
+}
+
+// Stats reports delivery metrics
+type Stats struct {
+	Webhooks     int   `json:"webhooks"`
+	Delivered    int64 `json:"delivered"`
+	Failures     int64 `json:"failures"`     // Failed attempts, including those retried
+	DeadLettered int64 `json:"deadLettered"` // Deliveries that exhausted their retries or were refused
+	Pending      int   `json:"pending"`      // Queued deliveries, excluding those waiting to be retried
+}
+
+// Service holds the webhook registrations and delivers events to them from this replica.
+// With a container URL, registrations are persisted to Blob Storage and reloaded periodically,
+// so every replica delivers the events it observes and they survive restarts.
+type Service struct {
+	cfg      Config
+	locker   locks.Locker
+	redactor redact.Redactor
+	audit    audit.Log
+	client   *http.Client
+	queue    chan *delivery
+
+	mu       sync.RWMutex
+	webhooks map[string]*Webhook // ID -> webhook
+
+	deadLetters *deadletter.Queue
+
+	delivered    atomic.Int64
+	failures     atomic.Int64
+	deadLettered atomic.Int64
+}
+
+// NewService creates a webhooks service; redactor is applied to event payloads. Deliveries
+// that fail for good are kept in deadLetters, which redrives them through the service.
+func NewService(cfg Config, locker locks.Locker, redactor redact.Redactor, auditLog audit.Log, deadLetters *deadletter.Queue) *Service {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	s := &Service{
+		cfg:      cfg,
+		locker:   locker,
+		redactor: redactor,
+		audit:    auditLog,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// Redirects aren't followed, so a receiver can't bounce signed events elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		queue:       make(chan *delivery, queueSize),
+		webhooks:    make(map[string]*Webhook),
+		deadLetters: deadLetters,
+	}
+	deadLetters.Handle(deadletter.SourceWebhooks, s.redrive)
+	return s
+}
+
+// Create validates and registers a webhook, generating a secret when none is given. The
+// returned webhook is the only one with the secret.
+func (s *Service) Create(ctx context.Context, admin *models.User, w *Webhook) (*Webhook, error) {
+	created := *w
+	created.ID = newID()
+	created.URL = strings.TrimSpace(created.URL)
+	created.TenantID = admin.TenantID
+	created.CreatedBy = admin.ID
+	created.CreatedAt = time.Now().UTC()
+	if err := s.validateURL(created.URL); err != nil {
+		return nil, err
+	}
+	eventTypes, err := normalizeTypes(created.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	created.EventTypes = eventTypes
+	switch {
+	case created.Secret == "":
+		created.Secret = newSecret()
+	case len(created.Secret) < minSecretLength:
+		return nil, fmt.Errorf("%w: secret must be at least %d characters", ErrInvalidWebhook, minSecretLength)
+	}
+
+	if err := s.change(ctx, func(webhooks map[string]*Webhook) error {
+		if len(webhooks) >= maxWebhooks {
+			return fmt.Errorf("%w: at most %d can be registered", ErrTooManyWebhooks, maxWebhooks)
+		}
+		webhooks[created.ID] = &created
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(audit.Record{
+		Action:   "webhook.create",
+		Actor:    admin.ID,
+		TenantID: admin.TenantID,
+		Target:   created.ID,
+		Outcome:  "success",
+		Details:  map[string]interface{}{"url": redactURL(created.URL), "eventTypes": created.EventTypes},
+	})
+	result := created
+	return &result, nil
+}
+
+// Delete removes a webhook; deliveries waiting to be retried are abandoned
+func (s *Service) Delete(ctx context.Context, admin *models.User, id string) error {
+	if err := s.change(ctx, func(webhooks map[string]*Webhook) error {
+		if webhooks[id] == nil {
+			return ErrWebhookNotFound
+		}
+		delete(webhooks, id)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	s.audit.Record(audit.Record{
+		Action:   "webhook.delete",
+		Actor:    admin.ID,
+		TenantID: admin.TenantID,
+		Target:   id,
+		Outcome:  "success",
+	})
+	return nil
+}
+
+// Get returns a webhook, without its secret
+func (s *Service) Get(id string) (*Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	w := s.webhooks[id]
+	if w == nil {
+		return nil, ErrWebhookNotFound
+	}
+	result := *w
+	result.Secret = ""
+	return &result, nil
+}
+
+// List returns the webhooks, oldest first, without their secrets
+func (s *Service) List() []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		result := *w
+		result.Secret = ""
+		list = append(list, result)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// lookup returns a webhook with its secret, or nil when it was deleted
+func (s *Service) lookup(id string) *Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.webhooks[id]
+}
+
+// subscribers returns the tenant's webhooks receiving events of the type
+func (s *Service) subscribers(eventType events.EventType, tenantID string) []*Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subscribed []*Webhook
+	for _, w := range s.webhooks {
+		owner := w.TenantID
+		if owner == "" {
+			owner = s.cfg.HomeTenantID
+		}
+		if owner == tenantID && w.Subscribed(eventType) {
+			subscribed = append(subscribed, w)
+		}
+	}
+	return subscribed
+}
+
+// Run delivers queued events and, with a container, reloads the registrations every
+// interval, until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	var delivering sync.WaitGroup
+	defer delivering.Wait()
+	for i := 0; i < workers; i++ {
+		delivering.Add(1)
+		go func() {
+			defer delivering.Done()
+			s.deliver(ctx)
+		}()
+	}
+	if s.cfg.ContainerURL == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.reload(ctx); err != nil {
+			log.Printf("⚠️  Failed to reload webhooks: %v", err)
+		}
+	}
+}
+
+// Load reads the persisted webhooks, at startup
+func (s *Service) Load(ctx context.Context) error {
+	if s.cfg.ContainerURL == "" {
+		return nil
+	}
+	return s.reload(ctx)
+}
+
+// reload replaces the webhooks with the persisted ones
+func (s *Service) reload(ctx context.Context) error {
+	webhooks, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.webhooks = webhooks
+	s.mu.Unlock()
+	return nil
+}
+
+// change applies a change to the webhooks and persists them. With a container, the change is
+// made to the latest persisted webhooks while holding the webhooks lock.
+func (s *Service) change(ctx context.Context, apply func(webhooks map[string]*Webhook) error) error {
+	if s.cfg.ContainerURL == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return apply(s.webhooks)
+	}
+
+	lock, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(context.Background()); err != nil {
+			log.Printf("⚠️  Failed to release the webhooks lock: %v", err)
+		}
+	}()
+
+	webhooks, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+	if err := apply(webhooks); err != nil {
+		return err
+	}
+	if err := s.write(ctx, webhooks); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.webhooks = webhooks
+	s.mu.Unlock()
+	return nil
+}
+
+// acquire takes the webhooks lock, waiting a few seconds for another replica to release it
+func (s *Service) acquire(ctx context.Context) (locks.Lock, error) {
+	for attempt := 0; attempt < 20; attempt++ {
+		lock, err := s.locker.TryAcquire(ctx, lockName, 15*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if lock != nil {
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	return nil, fmt.Errorf("webhooks are being changed by another replica")
+}
+
+// read loads the persisted webhooks
+func (s *Service) read(ctx context.Context) (map[string]*Webhook, error) {
+	data, err := blob.DownloadBlob(ctx, s.cfg.ContainerURL, blobName, maxBlobBytes)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Webhook
+	if data != nil {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("decoding webhooks: %w", err)
+		}
+	}
+
+	webhooks := make(map[string]*Webhook, len(list))
+	for _, w := range list {
+		webhooks[w.ID] = w
+	}
+	return webhooks, nil
+}
+
+// write persists the webhooks
+func (s *Service) write(ctx context.Context, webhooks map[string]*Webhook) error {
+	list := make([]*Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return blob.UploadBlockBlob(ctx, s.cfg.ContainerURL, blobName, "application/json", data)
+}
+
+// validateURL requires an absolute https URL (or http when allowed)
+func (s *Service) validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute URL", ErrInvalidWebhook)
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && s.cfg.AllowHTTP:
+	default:
+		return fmt.Errorf("%w: url must use https", ErrInvalidWebhook)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: url can't include credentials (sign requests with the secret instead)", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+// normalizeTypes validates event type filters and removes duplicates
+func normalizeTypes(eventTypes []events.EventType) ([]events.EventType, error) {
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("%w: eventTypes must list at least one event type (or %q for all)", ErrInvalidWebhook, AllTypes)
+	}
+	seen := make(map[events.EventType]bool)
+	var normalized []events.EventType
+	for _, eventType := range eventTypes {
+		eventType = events.EventType(strings.TrimSpace(string(eventType)))
+		if eventType == AllTypes {
+			return []events.EventType{AllTypes}, nil
+		}
+		if !knownType(eventType) {
+			names := make([]string, len(Types))
+			for i, t := range Types {
+				names[i] = string(t)
+			}
+			return nil, fmt.Errorf("%w: unknown event type %q (expected %q or one of %s)", ErrInvalidWebhook, eventType, AllTypes, strings.Join(names, ", "))
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			normalized = append(normalized, eventType)
+		}
+	}
+	return normalized, nil
+}
+
+// knownType reports whether webhooks can subscribe to the event type
+func knownType(eventType events.EventType) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL drops the query string (which may carry a token) from a URL for the audit log
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery = ""
+	return u.String()
+}
+
+// newID returns a random 64-bit hex ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newSecret returns a random 256-bit hex signing secret
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
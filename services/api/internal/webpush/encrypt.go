@@ -0,0 +1,151 @@
+// Package webpush sends Web Push notifications of messages that arrive while a user is
+// offline to the browsers they subscribed: payloads are minimized according to the tenant's
+// policy, encrypted end-to-end for the subscribing browser (RFC 8291, aes128gcm) and signed
+// for the push service with VAPID (RFC 8292).
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ContentEncoding is the Content-Encoding header value for encrypted payloads
+const ContentEncoding = "aes128gcm"
+
+// recordSize is the aes128gcm record size; payloads are sent as a single record
+const recordSize = 4096
+
+// headerSize is the aes128gcm header: salt (16) + record size (4) + key ID length (1) + public key (65)
+const headerSize = 16 + 4 + 1 + 65
+
+// MaxPayloadSize is the largest plaintext that fits in one record (delimiter and GCM tag excluded)
+const MaxPayloadSize = recordSize - headerSize - 1 - 16
+
+// ErrPayloadTooLarge is returned when a payload doesn't fit in a push message
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// Keys are the encryption keys of a browser push subscription (PushSubscription.getKey)
+type Keys struct {
+	P256dh string `json:"p256dh"` // Base64url user agent public key (uncompressed P-256 point)
+	Auth   string `json:"auth"`   // Base64url 16-byte authentication secret
+}
+
+// Check reports whether the keys are a valid P-256 public key and 16-byte auth secret
+func (k Keys) Check() error {
+	public, err := decodeKey(k.P256dh)
+	if err == nil {
+		_, err = ecdh.P256().NewPublicKey(public)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	if auth, err := decodeKey(k.Auth); err != nil || len(auth) != 16 {
+		return fmt.Errorf("invalid auth secret")
+	}
+	return nil
+}
+
+// Encrypt encrypts plaintext for the subscription's keys, padding it to padTo bytes
+// (0 for no padding) so payload sizes don't reveal the content length
+func Encrypt(keys Keys, plaintext []byte, padTo int) ([]byte, error) {
+	if len(plaintext) > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+
+	uaPublicBytes, err := decodeKey(keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeKey(keys.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, fmt.Errorf("invalid auth secret")
+	}
+
+	// Ephemeral application server key pair and salt, fresh for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return encrypt(uaPublic, authSecret, asPrivate, salt, plaintext, padTo)
+}
+
+// encrypt performs the RFC 8291 encryption with the given ephemeral key and salt
+func encrypt(uaPublic *ecdh.PublicKey, authSecret []byte, asPrivate *ecdh.PrivateKey, salt, plaintext []byte, padTo int) ([]byte, error) {
+	uaPublicBytes := uaPublic.Bytes()
+	asPublic := asPrivate.PublicKey().Bytes()
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 8291 section 3.4: combine the ECDH secret with the auth secret...
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	// ...then derive the content encryption key and nonce (RFC 8188)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	// Single final record: plaintext, 0x02 delimiter, zero padding
+	padding := 0
+	if padTo > len(plaintext) {
+		padding = padTo - len(plaintext)
+	}
+	if len(plaintext)+padding > MaxPayloadSize {
+		padding = MaxPayloadSize - len(plaintext)
+	}
+	record := make([]byte, len(plaintext)+1+padding)
+	copy(record, plaintext)
+	record[len(plaintext)] = 0x02
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, headerSize, headerSize+len(record)+gcm.Overhead())
+	copy(body, salt)
+	binary.BigEndian.PutUint32(body[16:], recordSize)
+	body[20] = byte(len(asPublic))
+	copy(body[21:], asPublic)
+	return gcm.Seal(body, nonce, record, nil), nil
+}
+
+// hkdf is HKDF-SHA-256 (RFC 5869) for outputs of at most one hash block
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeKey decodes a base64url key, with or without padding
+func decodeKey(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
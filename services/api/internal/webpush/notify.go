@@ -0,0 +1,197 @@
+package webpush
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/tenants"
+)
+
+// Content modes, set per tenant (tenants.Tenant.PushContent) with a service-wide default
+const (
+	ContentFull    = "full"    // Sender and message text in the notification
+	ContentMinimal = "minimal" // Sender and unread count only; the text is fetched when tapped
+)
+
+// padBlock is the granularity payloads are padded to, so sizes don't reveal message lengths
+const padBlock = 256
+
+// Notification is the JSON payload delivered to the service worker
+type Notification struct {
+	Type       string `json:"type"` // Always "message"
+	ID         string `json:"id"`
+	SenderID   string `json:"senderId"`
+	SenderName string `json:"senderName"`
+	Count      int    `json:"count"`          // Unread notified messages from this sender
+	Text       string `json:"text,omitempty"` // Full mode only
+	URL        string `json:"url"`            // Authenticated API path returning the full message
+}
+
+// Message is a message held for a notification until the recipient fetches it
+type Message struct {
+	ID          string                 `json:"id"`
+	MessageID   string                 `json:"messageId,omitempty"` // The chat event ID
+	RecipientID string                 `json:"recipientId"`
+	SenderID    string                 `json:"senderId"`
+	SenderName  string                 `json:"senderName"`
+	Message     *models.MessageContent `json:"message"`
+	CreatedAt   time.Time              `json:"createdAt"`
+
+	read bool
+}
+
+// Inbox holds notified messages for a limited time so the full content never has to travel
+// through the push service
+type Inbox struct {
+	ttl      time.Duration
+	messages map[string]*Message // Notification ID -> message
+	mu       sync.Mutex
+}
+
+// NewInbox creates an inbox keeping messages for ttl
+func NewInbox(ttl time.Duration) *Inbox {
+	return &Inbox{
+		ttl:      ttl,
+		messages: make(map[string]*Message),
+	}
+}
+
+// Hold stores a message and returns it with its notification ID set. A message already held
+// for the recipient (by MessageID, when set) is returned as is, so every channel notifying of
+// it shares one notification.
+func (i *Inbox) Hold(msg Message) Message {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expire()
+
+	if msg.MessageID != "" {
+		for _, held := range i.messages {
+			if held.MessageID == msg.MessageID && held.RecipientID == msg.RecipientID {
+				return *held
+			}
+		}
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	msg.ID = hex.EncodeToString(b)
+	msg.CreatedAt = time.Now().UTC()
+	i.messages[msg.ID] = &msg
+	return msg
+}
+
+// Get returns a held message to its recipient and marks it read
+func (i *Inbox) Get(recipientID, id string) (*Message, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expire()
+
+	msg, ok := i.messages[id]
+	if !ok || msg.RecipientID != recipientID {
+		return nil, false
+	}
+	msg.read = true
+	c := *msg
+	return &c, true
+}
+
+// Unread counts a recipient's unread held messages from a sender
+func (i *Inbox) Unread(recipientID, senderID string) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	count := 0
+	for _, msg := range i.messages {
+		if msg.RecipientID == recipientID && msg.SenderID == senderID && !msg.read {
+			count++
+		}
+	}
+	return count
+}
+
+// expire drops messages older than the TTL (caller holds the lock)
+func (i *Inbox) expire() {
+	cutoff := time.Now().Add(-i.ttl)
+	for id, msg := range i.messages {
+		if msg.CreatedAt.Before(cutoff) {
+			delete(i.messages, id)
+		}
+	}
+}
+
+// Service builds and encrypts message notifications
+type Service struct {
+	inbox       *Inbox
+	tenants     *tenants.Registry
+	defaultMode string
+}
+
+// NewService creates a notification service; defaultMode applies to tenants without a PushContent policy
+func NewService(defaultMode string, inbox *Inbox, registry *tenants.Registry) (*Service, error) {
+	if defaultMode == "" {
+		defaultMode = ContentMinimal
+	}
+	if defaultMode != ContentFull && defaultMode != ContentMinimal {
+		return nil, fmt.Errorf("unknown push content mode %q (expected %s or %s)", defaultMode, ContentFull, ContentMinimal)
+	}
+	return &Service{
+		inbox:       inbox,
+		tenants:     registry,
+		defaultMode: defaultMode,
+	}, nil
+}
+
+// Inbox returns the inbox notified messages are held in
+func (s *Service) Inbox() *Inbox {
+	return s.inbox
+}
+
+// ModeFor returns the content mode of a tenant
+func (s *Service) ModeFor(tenantID string) string {
+	if tenant, ok := s.tenants.Get(tenantID); ok && tenant.PushContent != "" {
+		return tenant.PushContent
+	}
+	return s.defaultMode
+}
+
+// Notify holds the message for its recipient and returns the notification to push,
+// minimized according to the recipient tenant's policy
+func (s *Service) Notify(recipientTenantID string, msg Message) Notification {
+	held := s.inbox.Hold(msg)
+
+	notification := Notification{
+		Type:       "message",
+		ID:         held.ID,
+		SenderID:   held.SenderID,
+		SenderName: held.SenderName,
+		Count:      s.inbox.Unread(held.RecipientID, held.SenderID),
+		URL:        "/api/v1/notifications/" + held.ID,
+	}
+	if s.ModeFor(recipientTenantID) == ContentFull && held.Message != nil {
+		notification.Text = held.Message.Text
+	}
+	return notification
+}
+
+// Seal encodes and encrypts a notification for one subscription. Full-mode text that
+// doesn't fit is dropped; the client fetches it from the notification URL instead.
+func Seal(keys Keys, notification Notification) ([]byte, error) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > MaxPayloadSize && notification.Text != "" {
+		notification.Text = ""
+		if payload, err = json.Marshal(notification); err != nil {
+			return nil, err
+		}
+	}
+
+	padTo := (len(payload)/padBlock + 1) * padBlock
+	return Encrypt(keys, payload, padTo)
+}
@@ -0,0 +1,302 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api-service/internal/models"
+	"api-service/internal/store"
+)
+
+const (
+	queueSize        = 256 // Offline messages waiting to be pushed; more are dropped
+	maxSubscriptions = 10  // Per user
+)
+
+// DefaultAllowedHosts are the push services of the major browsers (Chrome and Edge's FCM,
+// Firefox's autopush, Safari's APNs and WNS). Subdomains are allowed too.
+var DefaultAllowedHosts = []string{
+	"fcm.googleapis.com",
+	"push.services.mozilla.com",
+	"push.apple.com",
+	"notify.windows.com",
+}
+
+var (
+	ErrInvalidSubscription  = errors.New("invalid push subscription")
+	ErrTooManySubscriptions = errors.New("too many push subscriptions")
+	ErrSubscriptionNotFound = errors.New("push subscription not found")
+)
+
+// PusherConfig configures the pusher
+type PusherConfig struct {
+	AllowedHosts []string      // Push service hosts subscription endpoints may point at; DefaultAllowedHosts when empty
+	TTL          time.Duration // How long push services keep undelivered notifications
+}
+
+// PusherStats reports pusher metrics
+type PusherStats struct {
+	Sent     int64 `json:"sent"`
+	Failures int64 `json:"failures"`
+	Expired  int64 `json:"expired"` // Subscriptions the push service reported gone, which were removed
+	Dropped  int64 `json:"dropped"` // Queue overflow
+}
+
+// pushJob is a message to push to an offline recipient's subscriptions
+type pushJob struct {
+	tenantID string
+	message  Message
+}
+
+// Pusher keeps users' push subscriptions and pushes a notification to them when a message
+// arrives while they're offline
+type Pusher struct {
+	service       *Service
+	vapid         *VAPID
+	subscriptions store.PushSubscriptionStore
+	preferences   store.PreferenceStore
+	allowedHosts  []string
+	ttl           time.Duration
+	client        *http.Client
+	queue         chan pushJob
+
+	sent     atomic.Int64
+	failures atomic.Int64
+	expired  atomic.Int64
+	dropped  atomic.Int64
+}
+
+// NewPusher creates a pusher sending the service's notifications, signed with vapid, to the
+// users whose notification preferences allow push
+func NewPusher(service *Service, vapid *VAPID, subscriptions store.PushSubscriptionStore, preferences store.PreferenceStore, cfg PusherConfig) *Pusher {
+	if len(cfg.AllowedHosts) == 0 {
+		cfg.AllowedHosts = DefaultAllowedHosts
+	}
+	return &Pusher{
+		service:       service,
+		vapid:         vapid,
+		subscriptions: subscriptions,
+		preferences:   preferences,
+		allowedHosts:  cfg.AllowedHosts,
+		ttl:           cfg.TTL,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		queue: make(chan pushJob, queueSize),
+	}
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (p *Pusher) PublicKey() string {
+	return p.vapid.PublicKey()
+}
+
+// Subscribe registers a browser subscription of the user. Registering an endpoint again
+// replaces its keys.
+func (p *Pusher) Subscribe(ctx context.Context, user *models.User, endpoint string, keys Keys, userAgent string) (*store.PushSubscription, error) {
+	if err := p.checkEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	if err := keys.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+
+	sum := sha256.Sum256([]byte(endpoint))
+	sub := &store.PushSubscription{
+		ID:        hex.EncodeToString(sum[:16]),
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		Endpoint:  endpoint,
+		P256dh:    keys.P256dh,
+		Auth:      keys.Auth,
+		UserAgent: userAgent,
+		CreatedAt: time.Now().UTC(),
+	}
+	existing, err := p.subscriptions.PushSubscriptions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	replaces := false
+	for _, s := range existing {
+		replaces = replaces || s.ID == sub.ID
+	}
+	if !replaces && len(existing) >= maxSubscriptions {
+		return nil, fmt.Errorf("%w: at most %d per user", ErrTooManySubscriptions, maxSubscriptions)
+	}
+
+	if err := p.subscriptions.SavePushSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription of the user
+func (p *Pusher) Unsubscribe(ctx context.Context, user *models.User, id string) error {
+	deleted, err := p.subscriptions.DeletePushSubscription(ctx, user.ID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// Subscriptions returns the user's subscriptions
+func (p *Pusher) Subscriptions(ctx context.Context, user *models.User) ([]*store.PushSubscription, error) {
+	return p.subscriptions.PushSubscriptions(ctx, user.ID)
+}
+
+// checkEndpoint requires an https endpoint on an allowed push service, so subscriptions
+// can't point the service at arbitrary hosts
+func (p *Pusher) checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return fmt.Errorf("%w: endpoint must be an https URL", ErrInvalidSubscription)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range p.allowedHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not an allowed push service", ErrInvalidSubscription, host)
+}
+
+// NotifyOffline queues a push of a message the recipient wasn't connected to receive,
+// reporting false when the queue is full. It never blocks.
+func (p *Pusher) NotifyOffline(sender *models.User, recipientID, messageID string, message *models.MessageContent) bool {
+	// The recipient's tenant isn't known while they're offline; direct messages stay within
+	// the sender's
+	job := pushJob{
+		tenantID: sender.TenantID,
+		message: Message{
+			MessageID:   messageID,
+			RecipientID: recipientID,
+			SenderID:    sender.ID,
+			SenderName:  sender.Name,
+			Message:     message,
+		},
+	}
+	select {
+	case p.queue <- job:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Run pushes queued messages until ctx is cancelled
+func (p *Pusher) Run(ctx context.Context) {
+	for {
+		var job pushJob
+		select {
+		case <-ctx.Done():
+			return
+		case job = <-p.queue:
+		}
+
+		subs, err := p.subscriptions.PushSubscriptions(ctx, job.message.RecipientID)
+		if err != nil {
+			p.failures.Add(1)
+			log.Printf("⚠️  Reading push subscriptions of %s failed: %v", job.message.RecipientID, err)
+			continue
+		}
+		if len(subs) == 0 {
+			continue
+		}
+		prefs, err := p.preferences.NotificationPreferences(ctx, job.message.RecipientID)
+		if err != nil {
+			p.failures.Add(1)
+			log.Printf("⚠️  Reading notification preferences of %s failed: %v", job.message.RecipientID, err)
+			continue
+		}
+		if !prefs.Allows(store.ChannelPush, store.EventDirectMessage, time.Now()) {
+			continue
+		}
+
+		notification := p.service.Notify(job.tenantID, job.message)
+		for _, sub := range subs {
+			err := p.push(ctx, sub, notification)
+			switch {
+			case errors.Is(err, errSubscriptionGone):
+				p.expired.Add(1)
+				if _, err := p.subscriptions.DeletePushSubscription(ctx, sub.UserID, sub.ID); err != nil {
+					log.Printf("⚠️  Removing expired push subscription %s failed: %v", sub.ID, err)
+				}
+			case err != nil:
+				p.failures.Add(1)
+				log.Printf("⚠️  Push to subscription %s of %s failed: %v", sub.ID, sub.UserID, err)
+			default:
+				p.sent.Add(1)
+			}
+		}
+	}
+}
+
+// errSubscriptionGone is returned when the push service no longer knows a subscription
+var errSubscriptionGone = errors.New("push subscription expired or unsubscribed")
+
+// push encrypts a notification for a subscription and sends it to the push service
+func (p *Pusher) push(ctx context.Context, sub *store.PushSubscription, notification Notification) error {
+	body, err := Seal(Keys{P256dh: sub.P256dh, Auth: sub.Auth}, notification)
+	if err != nil {
+		return err
+	}
+	authorization, err := p.vapid.Authorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", ContentEncoding)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(p.ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+
+	resp, err := p.client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err // Without the endpoint, which identifies the browser
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errSubscriptionGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stats returns pusher metrics
+func (p *Pusher) Stats() PusherStats {
+	return PusherStats{
+		Sent:     p.sent.Load(),
+		Failures: p.failures.Load(),
+		Expired:  p.expired.Load(),
+		Dropped:  p.dropped.Load(),
+	}
+}
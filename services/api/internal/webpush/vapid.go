@@ -0,0 +1,99 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// vapidTokenTTL is how long VAPID tokens are valid (push services accept up to 24 hours)
+const vapidTokenTTL = 12 * time.Hour
+
+// VAPID identifies the application server to push services (RFC 8292)
+type VAPID struct {
+	private   *ecdsa.PrivateKey
+	publicKey string // Base64url uncompressed public key, the browser's applicationServerKey
+	subject   string // mailto: or https: contact of the operator
+	tokens    map[string]vapidToken
+	mu        sync.Mutex
+}
+
+// vapidToken is a signed token for one push service origin
+type vapidToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewVAPID parses a base64url P-256 private key (as generated by `npx web-push
+// generate-vapid-keys`); subject is a mailto: or https: URL push services can reach the
+// operator at
+func NewVAPID(privateKey, subject string) (*VAPID, error) {
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, fmt.Errorf("VAPID subject must be a mailto: or https: URL")
+	}
+	d, err := decodeKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public := key.PublicKey().Bytes() // 0x04 || X || Y
+	return &VAPID{
+		private: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(d),
+		},
+		publicKey: base64.RawURLEncoding.EncodeToString(public),
+		subject:   subject,
+		tokens:    make(map[string]vapidToken),
+	}, nil
+}
+
+// PublicKey returns the base64url public key subscriptions are created with
+func (v *VAPID) PublicKey() string {
+	return v.publicKey
+}
+
+// Authorization returns the Authorization header of a push to endpoint. Tokens are cached
+// per push service origin and renewed halfway through their lifetime.
+func (v *VAPID) Authorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid push endpoint")
+	}
+	audience := u.Scheme + "://" + u.Host
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	token, ok := v.tokens[audience]
+	if !ok || time.Until(token.expiresAt) < vapidTokenTTL/2 {
+		expiresAt := time.Now().Add(vapidTokenTTL)
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"aud": audience,
+			"exp": expiresAt.Unix(),
+			"sub": v.subject,
+		}).SignedString(v.private)
+		if err != nil {
+			return "", err
+		}
+		token = vapidToken{value: signed, expiresAt: expiresAt}
+		v.tokens[audience] = token
+	}
+	return "vapid t=" + token.value + ", k=" + v.publicKey, nil
+}
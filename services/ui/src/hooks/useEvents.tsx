@@ -71,7 +71,8 @@ export const EventsProvider: React.FC<EventsProviderProps> = ({ children }) => {
     console.log("Attempting WebSocket connection...");
     setConnectionStatus("connecting");
 
-    const websocket = new WebSocket(`${wsUrl}?token=${user.access_token}`);
+    // The token goes in the subprotocols rather than the URL, which ends up in access logs
+    const websocket = new WebSocket(wsUrl, ["bearer", user.access_token]);
 
     websocket.onopen = () => {
       console.log("✅ WebSocket connected successfully");